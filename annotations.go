@@ -13,12 +13,25 @@ type FunctionAnnotation struct {
 	Comment string `json:"comment,omitempty"`
 }
 
+// StructAnnotation renames a recovered struct and its fields; Fields is
+// keyed by the decimal offset of the field.
+type StructAnnotation struct {
+	Name   string                      `json:"name,omitempty"`
+	Fields map[string]*FieldAnnotation `json:"fields,omitempty"`
+}
+
+type FieldAnnotation struct {
+	Name string `json:"name,omitempty"`
+	Type string `json:"type,omitempty"`
+}
+
 type Annotations struct {
 	Version           int                            `json:"version"`
 	Functions         map[string]*FunctionAnnotation `json:"functions,omitempty"`
 	Comments          map[string]string              `json:"comments,omitempty"`
 	DecompileComments map[string]string              `json:"decompileComments,omitempty"`
 	Bookmarks         []uint32                       `json:"bookmarks,omitempty"`
+	Structs           map[string]*StructAnnotation   `json:"structs,omitempty"`
 }
 
 func NewAnnotations() *Annotations {
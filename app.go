@@ -2,9 +2,12 @@ package main
 
 import (
 	"context"
+	"encoding/hex"
 	"fmt"
+	"os"
 
 	"github.com/0xInception/wasmspy/pkg/decompile"
+	"github.com/0xInception/wasmspy/pkg/trace"
 	"github.com/0xInception/wasmspy/pkg/wasm"
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
@@ -13,12 +16,26 @@ type App struct {
 	ctx         context.Context
 	modules     map[string]*wasm.ResolvedModule
 	annotations map[string]*Annotations
+	callGraphs  map[string]*decompile.CallGraph
+	structs     map[string]*structRecovery
+	files       map[string][]byte
+	layouts     map[string]*wasm.Layout
+	traces      map[string]*trace.Trace
+
+	debugSessions map[string]*debugSession
 }
 
 func NewApp() *App {
 	return &App{
 		modules:     make(map[string]*wasm.ResolvedModule),
 		annotations: make(map[string]*Annotations),
+		callGraphs:  make(map[string]*decompile.CallGraph),
+		structs:     make(map[string]*structRecovery),
+		files:       make(map[string][]byte),
+		layouts:     make(map[string]*wasm.Layout),
+		traces:      make(map[string]*trace.Trace),
+
+		debugSessions: make(map[string]*debugSession),
 	}
 }
 
@@ -58,6 +75,17 @@ type ModuleInfo struct {
 	Memories  []MemoryInfo   `json:"memories"`
 	Tables    []TableInfo    `json:"tables"`
 	Globals   []GlobalInfo   `json:"globals"`
+
+	CustomSections []CustomSectionInfo `json:"customSections"`
+}
+
+type CustomSectionInfo struct {
+	Index   int    `json:"index"`
+	Name    string `json:"name"`
+	Offset  int    `json:"offset"`
+	Size    int    `json:"size"`
+	Decoded bool   `json:"decoded"`
+	Error   string `json:"error,omitempty"`
 }
 
 type MemoryInfo struct {
@@ -95,10 +123,15 @@ type ExportInfo struct {
 }
 
 func (a *App) LoadModuleFromPath(path string) (*ModuleInfo, error) {
-	mod, err := wasm.ParseFile(path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	mod, err := wasm.Parse(data)
 	if err != nil {
 		return nil, err
 	}
+	a.files[path] = data
 	return a.loadModule(path, mod)
 }
 
@@ -109,6 +142,11 @@ func (a *App) loadModule(path string, mod *wasm.Module) (*ModuleInfo, error) {
 	}
 	a.modules[path] = resolved
 	a.annotations[path] = loadAnnotationsFromFile(path)
+	delete(a.callGraphs, path)
+	a.structs[path] = a.recoverStructs(path, resolved)
+	a.layouts[path] = wasm.BuildLayout(mod)
+	delete(a.traces, path)
+	a.StopDebugSession(path)
 
 	info := &ModuleInfo{}
 
@@ -177,6 +215,21 @@ func (a *App) loadModule(path string, mod *wasm.Module) (*ModuleInfo, error) {
 		})
 	}
 
+	for i := range resolved.CustomSections {
+		cs := &resolved.CustomSections[i]
+		csi := CustomSectionInfo{
+			Index:   i,
+			Name:    cs.Name,
+			Offset:  int(cs.Offset),
+			Size:    len(cs.Data),
+			Decoded: cs.Decoded(),
+		}
+		if cs.Err != nil {
+			csi.Error = cs.Err.Error()
+		}
+		info.CustomSections = append(info.CustomSections, csi)
+	}
+
 	return info, nil
 }
 
@@ -217,7 +270,7 @@ func (a *App) DecompileFunction(path string, index uint32) (string, error) {
 	if fn.Imported {
 		return fmt.Sprintf("// imported: %s", fn.Name), nil
 	}
-	return decompile.Decompile(fn, module), nil
+	return decompile.DecompileWithStructs(fn, module, a.structSet(path, module, false)).Code, nil
 }
 
 func (a *App) DecompileFunctionWithMappings(path string, index uint32) (*decompile.DecompileResult, error) {
@@ -235,7 +288,7 @@ func (a *App) DecompileFunctionWithMappings(path string, index uint32) (*decompi
 			Mappings: nil,
 		}, nil
 	}
-	return decompile.DecompileWithMappings(fn, module), nil
+	return decompile.DecompileWithStructs(fn, module, a.structSet(path, module, false)), nil
 }
 
 func (a *App) GetMemory(path string, index int) (string, error) {
@@ -293,11 +346,37 @@ func (a *App) GetGlobal(path string, index int) (string, error) {
 	return fmt.Sprintf(";; Global %d\n(global %s %s)", index, mut, init), nil
 }
 
+// GetCustomSection describes custom section index followed by a hexdump of
+// its payload.
+func (a *App) GetCustomSection(path string, index int) (string, error) {
+	module := a.modules[path]
+	if module == nil {
+		return "", fmt.Errorf("module not loaded: %s", path)
+	}
+	if index < 0 || index >= len(module.CustomSections) {
+		return "", fmt.Errorf("custom section %d not found", index)
+	}
+	cs := &module.CustomSections[index]
+	out := fmt.Sprintf(";; Custom section %q\n;; %d bytes at 0x%x\n", cs.Name, len(cs.Data), cs.Offset)
+	switch {
+	case cs.Err != nil:
+		out += fmt.Sprintf(";; decode error: %v\n", cs.Err)
+	case cs.Decoded():
+		out += fmt.Sprintf(";; decoded: %v\n", cs.Value)
+	default:
+		out += ";; no decoder registered\n"
+	}
+	return out + "\n" + hex.Dump(cs.Data), nil
+}
+
 type MemoryData struct {
 	Data      []byte        `json:"data"`
 	TotalSize int           `json:"totalSize"`
 	Offset    int           `json:"offset"`
 	Segments  []DataSegInfo `json:"segments"`
+	// Snapshot is set when Data comes from an attached memory snapshot
+	// rather than the data segments.
+	Snapshot bool `json:"snapshot"`
 }
 
 type DataSegInfo struct {
@@ -306,8 +385,9 @@ type DataSegInfo struct {
 }
 
 type FunctionRef struct {
-	Index uint32 `json:"index"`
-	Name  string `json:"name"`
+	Index    uint32 `json:"index"`
+	Name     string `json:"name"`
+	Indirect bool   `json:"indirect"`
 }
 
 type XRefInfo struct {
@@ -321,22 +401,26 @@ func (a *App) GetMemoryData(path string, memIndex int, offset int, length int) (
 		return nil, fmt.Errorf("module not loaded: %s", path)
 	}
 
+	img := module.MemoryImage()
 	var segments []DataSegInfo
-	for _, seg := range module.Data {
-		segOffset := getDataSegOffset(seg.Offset)
+	for _, seg := range img.Segments {
+		if seg.Err != nil {
+			continue
+		}
 		segments = append(segments, DataSegInfo{
-			Offset: int(segOffset),
-			Size:   len(seg.Data),
+			Offset: int(seg.Offset),
+			Size:   int(seg.Size),
 		})
 	}
 
-	mem := module.BuildMemory()
+	snapshot := module.Snapshot() != nil
+	mem := module.MemoryData()
 	if mem == nil {
-		return &MemoryData{Data: []byte{}, TotalSize: 0, Offset: 0, Segments: segments}, nil
+		return &MemoryData{Data: []byte{}, TotalSize: 0, Offset: 0, Segments: segments, Snapshot: snapshot}, nil
 	}
 	totalSize := len(mem)
 	if offset >= totalSize {
-		return &MemoryData{Data: []byte{}, TotalSize: totalSize, Offset: offset, Segments: segments}, nil
+		return &MemoryData{Data: []byte{}, TotalSize: totalSize, Offset: offset, Segments: segments, Snapshot: snapshot}, nil
 	}
 	end := offset + length
 	if end > totalSize {
@@ -347,6 +431,7 @@ func (a *App) GetMemoryData(path string, memIndex int, offset int, length int) (
 		TotalSize: totalSize,
 		Offset:    offset,
 		Segments:  segments,
+		Snapshot:  snapshot,
 	}, nil
 }
 
@@ -356,7 +441,11 @@ func (a *App) GetXRefs(path string, funcIndex uint32) (*XRefInfo, error) {
 		return nil, fmt.Errorf("module not loaded: %s", path)
 	}
 
-	cg := decompile.BuildCallGraph(module)
+	cg := a.callGraphs[path]
+	if cg == nil {
+		cg = decompile.BuildCallGraph(module)
+		a.callGraphs[path] = cg
+	}
 	info := &XRefInfo{
 		Callers: []FunctionRef{},
 		Callees: []FunctionRef{},
@@ -371,7 +460,7 @@ func (a *App) GetXRefs(path string, funcIndex uint32) (*XRefInfo, error) {
 		if name == "" {
 			name = fmt.Sprintf("func_%d", callerIdx)
 		}
-		info.Callers = append(info.Callers, FunctionRef{Index: callerIdx, Name: name})
+		info.Callers = append(info.Callers, FunctionRef{Index: callerIdx, Name: name, Indirect: cg.Indirect(callerIdx, funcIndex)})
 	}
 
 	for _, calleeIdx := range cg.Callees[funcIndex] {
@@ -383,7 +472,7 @@ func (a *App) GetXRefs(path string, funcIndex uint32) (*XRefInfo, error) {
 		if name == "" {
 			name = fmt.Sprintf("func_%d", calleeIdx)
 		}
-		info.Callees = append(info.Callees, FunctionRef{Index: calleeIdx, Name: name})
+		info.Callees = append(info.Callees, FunctionRef{Index: calleeIdx, Name: name, Indirect: cg.Indirect(funcIndex, calleeIdx)})
 	}
 
 	return info, nil
@@ -439,17 +528,3 @@ func (a *App) GetModuleErrors(path string) (*ModuleErrorsInfo, error) {
 
 	return result, nil
 }
-
-func getDataSegOffset(instrs []wasm.Instruction) uint32 {
-	for _, instr := range instrs {
-		if instr.Opcode == wasm.OpI32Const && len(instr.Immediates) > 0 {
-			if v, ok := instr.Immediates[0].(int32); ok {
-				return uint32(v)
-			}
-			if v, ok := instr.Immediates[0].(uint32); ok {
-				return v
-			}
-		}
-	}
-	return 0
-}
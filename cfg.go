@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/0xInception/wasmspy/pkg/cfg"
+)
+
+type CFGEdge struct {
+	From int    `json:"from"`
+	To   int    `json:"to"`
+	Kind string `json:"kind"`
+	// Case is the br_table label position, or -1 for its default.
+	Case int `json:"case"`
+}
+
+type CFGBlock struct {
+	Index       int       `json:"index"`
+	StartOffset uint64    `json:"startOffset"`
+	EndOffset   uint64    `json:"endOffset"`
+	Lines       []string  `json:"lines"`
+	Succs       []CFGEdge `json:"succs"`
+	IDom        int       `json:"idom"`
+	IPDom       int       `json:"ipdom"`
+	Loop        int       `json:"loop"`
+	Reachable   bool      `json:"reachable"`
+	Exit        bool      `json:"exit"`
+}
+
+type CFGLoop struct {
+	Header  int   `json:"header"`
+	Latches []int `json:"latches"`
+	Blocks  []int `json:"blocks"`
+	Parent  int   `json:"parent"`
+	Depth   int   `json:"depth"`
+}
+
+type CFGInfo struct {
+	Blocks []CFGBlock `json:"blocks"`
+	Loops  []CFGLoop  `json:"loops"`
+	Entry  int        `json:"entry"`
+	Exit   int        `json:"exit"`
+}
+
+// GetCFG returns the control-flow graph of a function for the graph view.
+// Dominators, loops and edge targets refer to blocks by index; -1 means
+// none.
+func (a *App) GetCFG(path string, index uint32) (*CFGInfo, error) {
+	module := a.modules[path]
+	if module == nil {
+		return nil, fmt.Errorf("module not loaded: %s", path)
+	}
+	fn := module.GetFunction(index)
+	if fn == nil {
+		return nil, fmt.Errorf("function %d not found", index)
+	}
+	g, err := cfg.Build(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &CFGInfo{Blocks: []CFGBlock{}, Loops: []CFGLoop{}, Entry: g.Entry, Exit: g.Exit}
+	for _, b := range g.Blocks {
+		blk := CFGBlock{
+			Index:     b.Index,
+			Lines:     []string{},
+			Succs:     []CFGEdge{},
+			IDom:      g.IDom[b.Index],
+			IPDom:     g.IPDom[b.Index],
+			Loop:      g.LoopOf[b.Index],
+			Reachable: g.Reachable(b.Index),
+			Exit:      b.Index == g.Exit,
+		}
+		instrs := g.Instructions(b)
+		if len(instrs) > 0 {
+			blk.StartOffset, blk.EndOffset = instrs[0].Offset, instrs[len(instrs)-1].Offset
+		}
+		for i := range instrs {
+			blk.Lines = append(blk.Lines, fmt.Sprintf("%08x: %s", instrs[i].Offset, formatInstrWithImm(&instrs[i])))
+		}
+		for _, e := range b.Succs {
+			blk.Succs = append(blk.Succs, CFGEdge{From: e.From, To: e.To, Kind: e.Kind.String(), Case: e.Case})
+		}
+		info.Blocks = append(info.Blocks, blk)
+	}
+	for _, l := range g.Loops {
+		info.Loops = append(info.Loops, CFGLoop{
+			Header:  l.Header,
+			Latches: append([]int{}, l.Latches...),
+			Blocks:  append([]int{}, l.Blocks...),
+			Parent:  l.Parent,
+			Depth:   l.Depth,
+		})
+	}
+	return info, nil
+}
@@ -1,10 +1,26 @@
 package main
 
 import (
+	"encoding/hex"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 
+	"github.com/0xInception/wasmspy/pkg/cfg"
 	"github.com/0xInception/wasmspy/pkg/decompile"
+	"github.com/0xInception/wasmspy/pkg/diffcheck"
+	"github.com/0xInception/wasmspy/pkg/emulate"
+	"github.com/0xInception/wasmspy/pkg/harness"
+	"github.com/0xInception/wasmspy/pkg/interp"
+	"github.com/0xInception/wasmspy/pkg/stubs"
+	"github.com/0xInception/wasmspy/pkg/symex"
+	"github.com/0xInception/wasmspy/pkg/trace"
+	"github.com/0xInception/wasmspy/pkg/wasi"
 	"github.com/0xInception/wasmspy/pkg/wasm"
 )
 
@@ -42,6 +58,27 @@ func main() {
 		}
 		cmdCallGraph(os.Args[2])
 
+	case "cfg":
+		if len(os.Args) < 4 {
+			fmt.Fprintf(os.Stderr, "usage: wasmspy cfg <file.wasm> <func_name>\n")
+			os.Exit(1)
+		}
+		cmdCFG(os.Args[2], os.Args[3])
+
+	case "ssa":
+		if len(os.Args) < 4 {
+			fmt.Fprintf(os.Stderr, "usage: wasmspy ssa <file.wasm> <func_name>\n")
+			os.Exit(1)
+		}
+		cmdSSA(os.Args[2], os.Args[3])
+
+	case "structs":
+		if len(os.Args) < 3 {
+			fmt.Fprintf(os.Stderr, "usage: wasmspy structs <file.wasm>\n")
+			os.Exit(1)
+		}
+		cmdStructs(os.Args[2])
+
 	case "info":
 		if len(os.Args) < 3 {
 			fmt.Fprintf(os.Stderr, "usage: wasmspy info <file.wasm>\n")
@@ -49,6 +86,36 @@ func main() {
 		}
 		cmdInfo(os.Args[2])
 
+	case "run":
+		cmdRun(os.Args[2:])
+
+	case "emulate":
+		cmdEmulate(os.Args[2:])
+
+	case "reach":
+		cmdReach(os.Args[2:])
+
+	case "test":
+		if len(os.Args) < 4 {
+			fmt.Fprintf(os.Stderr, "usage: wasmspy test <file.wasm> <suite.yaml>\n")
+			os.Exit(1)
+		}
+		cmdTest(os.Args[2], os.Args[3])
+
+	case "diffcheck":
+		cmdDiffCheck(os.Args[2:])
+
+	case "tracediff":
+		if len(os.Args) < 4 {
+			fmt.Fprintf(os.Stderr, "usage: wasmspy tracediff <a.trace> <b.trace> [file.wasm]\n")
+			os.Exit(1)
+		}
+		modulePath := ""
+		if len(os.Args) >= 5 {
+			modulePath = os.Args[4]
+		}
+		cmdTraceDiff(os.Args[2], os.Args[3], modulePath)
+
 	case "help", "-h", "--help":
 		usage()
 
@@ -72,7 +139,16 @@ commands:
   wat        output WAT format (default)
   decompile  decompile to pseudocode
   callgraph  show function call graph
+  cfg        show the basic blocks and control-flow edges of a function
+  ssa        show the SSA form of a function with its dead values marked
+  structs    propose struct layouts from pointer access patterns
   info       show module information
+  run        call a function in the interpreter (WASI commands run _start)
+  emulate    run a function on the static memory image and show what it wrote
+  reach      find inputs that make a function reach an instruction
+  test       run a YAML or JSON suite of function unit tests
+  diffcheck  compare decompiled code with the instructions on random inputs
+  tracediff  compare two traces recorded with run -trace
   help       show this help
 
 examples:
@@ -80,6 +156,17 @@ examples:
   wasmspy decompile module.wasm
   wasmspy decompile module.wasm main
   wasmspy callgraph module.wasm
+  wasmspy cfg module.wasm main
+  wasmspy ssa module.wasm main
+  wasmspy structs module.wasm
+  wasmspy run module.wasm add 1 2
+  wasmspy run -dir ./data:/data app.wasm input.txt
+  wasmspy run -preset auto -stubs zero -log-imports app.wasm main
+  wasmspy emulate -callsites module.wasm decrypt_str
+  wasmspy reach -sym key@0x400:16 module.wasm check_key 0x1a2b
+  wasmspy test module.wasm tests.yaml
+  wasmspy diffcheck -runs 100 module.wasm
+  wasmspy tracediff a.trace b.trace module.wasm
 `)
 }
 
@@ -147,6 +234,62 @@ func cmdCallGraph(path string) {
 	}
 }
 
+func cmdCFG(path, funcName string) {
+	module := loadModule(path)
+	fn := module.GetFunctionByName(funcName)
+	if fn == nil {
+		fmt.Fprintf(os.Stderr, "function not found: %s\n", funcName)
+		os.Exit(1)
+	}
+	g, err := cfg.Build(fn)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Print(g)
+}
+
+func cmdSSA(path, funcName string) {
+	module := loadModule(path)
+	fn := module.GetFunctionByName(funcName)
+	if fn == nil {
+		fmt.Fprintf(os.Stderr, "function not found: %s\n", funcName)
+		os.Exit(1)
+	}
+	f, err := decompile.BuildSSA(fn, module)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	f.PropagateCopies()
+	f.EliminateDeadCode()
+	fmt.Print(f)
+}
+
+func cmdStructs(path string) {
+	module := loadModule(path)
+	set := decompile.RecoverStructs(module)
+	if len(set.Structs) == 0 {
+		fmt.Println("(no structs found)")
+		return
+	}
+	for i, s := range set.Structs {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Print(s)
+		fmt.Print("used by:")
+		for _, u := range s.Uses {
+			name := fmt.Sprintf("func_%d", u.Func)
+			if fn := module.GetFunction(u.Func); fn != nil && fn.Name != "" {
+				name = fn.Name
+			}
+			fmt.Printf(" %s:local%d", name, u.Local)
+		}
+		fmt.Println()
+	}
+}
+
 func cmdInfo(path string) {
 	module := loadModule(path)
 
@@ -179,6 +322,527 @@ func cmdInfo(path string) {
 			fmt.Printf("  %s.%s (%s)\n", imp.Module, imp.Name, importKind(imp.Kind))
 		}
 	}
+
+	if len(module.CustomSections) > 0 {
+		fmt.Println("\ncustom sections:")
+		for i := range module.CustomSections {
+			cs := &module.CustomSections[i]
+			switch {
+			case cs.Err != nil:
+				fmt.Printf("  %s (%d bytes at 0x%x): decode error: %v\n", cs.Name, len(cs.Data), cs.Offset, cs.Err)
+			case cs.Decoded():
+				fmt.Printf("  %s (%d bytes at 0x%x)", cs.Name, len(cs.Data), cs.Offset)
+				if s, ok := cs.Value.(fmt.Stringer); ok {
+					fmt.Printf(": %s", s)
+				} else if s, ok := cs.Value.(string); ok {
+					fmt.Printf(": %s", s)
+				}
+				fmt.Println()
+				continue
+			default:
+				fmt.Printf("  %s (%d bytes at 0x%x): undecoded\n", cs.Name, len(cs.Data), cs.Offset)
+			}
+			fmt.Print(indentLines(hexdump(cs.Data, maxInfoHexdump), "    "))
+		}
+	}
+}
+
+const maxInfoHexdump = 256
+
+// stringList collects the values of a repeatable flag.
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ",") }
+func (l *stringList) Set(v string) error { *l = append(*l, v); return nil }
+
+func cmdRun(argv []string) {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	var dirs, env stringList
+	flags.Var(&dirs, "dir", "preopen a host directory for WASI, as host[:guest] (repeatable)")
+	flags.Var(&env, "env", "set a WASI environment variable, as KEY=VALUE (repeatable)")
+	traceFile := flags.String("trace", "", "record an execution trace to this file")
+	stubOpts := stubFlags(flags, "trap")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: wasmspy run [-dir host[:guest]] [-env KEY=VALUE] [-trace out.trace] [stub options] <file.wasm> [func_name] [args...]\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(argv)
+	if flags.NArg() < 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+	path := flags.Arg(0)
+	module := loadModule(path)
+
+	funcName := "_start"
+	args := flags.Args()[1:]
+	if len(args) > 0 {
+		funcName, args = args[0], args[1:]
+	}
+
+	fn := module.GetFunctionByName(funcName)
+	if fn == nil {
+		fmt.Fprintf(os.Stderr, "function not found: %s\n", funcName)
+		os.Exit(1)
+	}
+
+	imports := interp.NewImports()
+	stubOptions := stubOpts.options(module)
+
+	// os.Exit skips deferred calls, so every exit past this point goes
+	// through quit, which closes the WASI host first.
+	closeHost := func() {}
+	quit := func(code int) {
+		closeHost()
+		os.Exit(code)
+	}
+
+	// A WASI command's _start takes no parameters; the remaining command
+	// line becomes its argv instead.
+	command := wasi.Imports(module) && funcName == "_start"
+	if wasi.Imports(module) {
+		cfg := wasi.Config{
+			Env:    env,
+			Stdin:  os.Stdin,
+			Stdout: os.Stdout,
+			Stderr: os.Stderr,
+		}
+		if command {
+			cfg.Args = append([]string{filepath.Base(path)}, args...)
+		}
+		for _, d := range dirs {
+			host, guest := splitDir(d)
+			cfg.Dirs = append(cfg.Dirs, wasi.Preopen{HostPath: host, GuestPath: guest})
+		}
+		host, err := wasi.New(cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error opening WASI directories: %v\n", err)
+			quit(1)
+		}
+		closeHost = func() { host.Close() }
+		host.Register(imports)
+	}
+	if err := stubs.Register(module, imports, stubOptions); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		quit(1)
+	}
+
+	var values []uint64
+	if !command {
+		var err error
+		values, err = interp.ParseArgs(fn, args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			quit(1)
+		}
+	}
+
+	inst, err := interp.Instantiate(module, imports)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error instantiating module: %v\n", err)
+		quit(1)
+	}
+
+	var rec *trace.Recorder
+	if *traceFile != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error reading file: %v\n", err)
+			quit(1)
+		}
+		rec = trace.NewRecorder(data)
+		inst.Tracer = rec.Record
+	}
+
+	results, err := inst.CallFunc(fn.Index, values...)
+	if rec != nil {
+		if werr := trace.WriteFile(*traceFile, rec.Trace); werr != nil {
+			fmt.Fprintf(os.Stderr, "error writing trace: %v\n", werr)
+		}
+	}
+	var exit *wasi.ExitError
+	if errors.As(err, &exit) {
+		quit(int(exit.Code))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		if trap, ok := err.(*interp.Trap); ok {
+			fmt.Fprint(os.Stderr, trap.Backtrace(func(idx uint32) string {
+				if f := module.GetFunction(idx); f != nil {
+					return f.Name
+				}
+				return ""
+			}))
+		}
+		quit(1)
+	}
+	for i, r := range results {
+		fmt.Println(interp.FormatValue(fn.Type.Results[i], r))
+	}
+	closeHost()
+}
+
+// splitDir splits a -dir value into host and guest paths at its last
+// colon, so a Windows host path such as C:\data keeps its drive. Without
+// a guest path the directory is mounted under its host path.
+func splitDir(spec string) (host, guest string) {
+	i := strings.LastIndex(spec, ":")
+	if i < 0 || i == 1 && len(spec) > 2 && (spec[2] == '\\' || spec[2] == '/') {
+		return spec, spec
+	}
+	return spec[:i], spec[i+1:]
+}
+
+// stubConfig holds the flags that choose how unresolved imports behave.
+type stubConfig struct {
+	mode    *string
+	presets stringList
+	script  *string
+	log     *bool
+}
+
+func stubFlags(flags *flag.FlagSet, mode string) *stubConfig {
+	c := &stubConfig{
+		mode:   flags.String("stubs", mode, "behavior of imports nothing implements: trap or zero"),
+		script: flags.String("script", "", "canned import responses from a YAML or JSON file"),
+		log:    flags.Bool("log-imports", false, "log every import call to stderr"),
+	}
+	flags.Var(&c.presets, "preset", "import helpers for a toolchain: "+strings.Join(stubs.PresetNames(), ", ")+" or auto (repeatable)")
+	return c
+}
+
+func (c *stubConfig) options(module *wasm.ResolvedModule) stubs.Options {
+	opts, err := stubs.ParseOptions(module, *c.mode, c.presets)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	if *c.script != "" {
+		script, err := stubs.LoadScript(*c.script)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error reading script: %v\n", err)
+			os.Exit(1)
+		}
+		opts.Script = script
+	}
+	if *c.log {
+		opts.OnCall = func(call *stubs.Call) {
+			fmt.Fprintf(os.Stderr, "import: %s\n", call)
+		}
+	}
+	return opts
+}
+
+func cmdEmulate(argv []string) {
+	flags := flag.NewFlagSet("emulate", flag.ExitOnError)
+	maxSteps := flags.Uint64("steps", emulate.DefaultMaxSteps, "instruction budget")
+	callSites := flags.Bool("callsites", false, "emulate every call site with constant arguments instead")
+	stubOpts := stubFlags(flags, "zero")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: wasmspy emulate [-steps n] [-callsites] [stub options] <file.wasm> <func_name> [args...]\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(argv)
+	if flags.NArg() < 2 {
+		flags.Usage()
+		os.Exit(1)
+	}
+	module := loadModule(flags.Arg(0))
+	funcName, args := flags.Arg(1), flags.Args()[2:]
+
+	fn := module.GetFunctionByName(funcName)
+	if fn == nil || fn.Type == nil {
+		fmt.Fprintf(os.Stderr, "function not found: %s\n", funcName)
+		os.Exit(1)
+	}
+	opts := emulate.Options{MaxSteps: *maxSteps, Stubs: stubOpts.options(module)}
+
+	if *callSites {
+		for _, sr := range emulate.RunCallSites(module, fn.Index, opts) {
+			caller := fmt.Sprintf("func_%d", sr.Caller)
+			if c := module.GetFunction(sr.Caller); c != nil && c.Name != "" {
+				caller = c.Name
+			}
+			switch {
+			case !sr.Known:
+				fmt.Printf("%s @0x%x: arguments not constant\n", caller, sr.Offset)
+			case sr.Err != nil:
+				fmt.Printf("%s @0x%x: %v\n", caller, sr.Offset, sr.Err)
+			default:
+				fmt.Printf("%s @0x%x: %s\n", caller, sr.Offset, sr.Result.Summary())
+			}
+		}
+		return
+	}
+
+	values, err := interp.ParseArgs(fn, args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	opts.Args = values
+
+	res, err := emulate.Run(module, fn.Index, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	for i, r := range res.Results {
+		fmt.Println(interp.FormatValue(fn.Type.Results[i], r))
+	}
+	if res.Err != nil {
+		fmt.Printf("error: %v\n", res.Err)
+	}
+	fmt.Printf("%d steps\n", res.Steps)
+	var stubbed []string
+	for name := range res.ImportCalls {
+		stubbed = append(stubbed, name)
+	}
+	sort.Strings(stubbed)
+	for _, name := range stubbed {
+		fmt.Printf("stubbed %s called %d times\n", name, res.ImportCalls[name])
+	}
+	for i := range res.Changes {
+		c := &res.Changes[i]
+		fmt.Printf("\nchanged 0x%x, %d bytes", c.Addr, len(c.After))
+		if text := c.Text(); text != "" {
+			fmt.Printf(": %q", text)
+		}
+		fmt.Println()
+		fmt.Print(indentLines(hexdump(c.After, 256), "  "))
+	}
+}
+
+// parseRegion parses a symbolic region given as name@addr:size.
+func parseRegion(s string) (symex.Region, error) {
+	name, rest, ok := strings.Cut(s, "@")
+	addr, size, ok2 := strings.Cut(rest, ":")
+	if !ok || !ok2 || name == "" {
+		return symex.Region{}, fmt.Errorf("region %q: want name@addr:size", s)
+	}
+	a, err := strconv.ParseUint(addr, 0, 32)
+	if err != nil {
+		return symex.Region{}, fmt.Errorf("region %q: %w", s, err)
+	}
+	n, err := strconv.ParseUint(size, 0, 32)
+	if err != nil {
+		return symex.Region{}, fmt.Errorf("region %q: %w", s, err)
+	}
+	return symex.Region{Name: name, Addr: uint32(a), Size: uint32(n)}, nil
+}
+
+func cmdReach(argv []string) {
+	flags := flag.NewFlagSet("reach", flag.ExitOnError)
+	var regions stringList
+	flags.Var(&regions, "sym", "make memory symbolic, as name@addr:size (repeatable)")
+	maxSteps := flags.Int("steps", symex.DefaultMaxSteps, "instruction budget over all paths")
+	maxPaths := flags.Int("paths", symex.DefaultMaxPaths, "path budget")
+	loopBound := flags.Int("loops", symex.DefaultLoopBound, "iterations of one loop per path")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: wasmspy reach [-sym name@addr:size] [-steps n] [-paths n] [-loops n] <file.wasm> <func_name> <offset> [args...]\n")
+		fmt.Fprintf(os.Stderr, "arguments given as ? or left out are symbolic\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(argv)
+	if flags.NArg() < 3 {
+		flags.Usage()
+		os.Exit(1)
+	}
+	module := loadModule(flags.Arg(0))
+	funcName, args := flags.Arg(1), flags.Args()[3:]
+	target, err := strconv.ParseUint(flags.Arg(2), 0, 64)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid offset: %s\n", flags.Arg(2))
+		os.Exit(1)
+	}
+
+	fn := module.GetFunctionByName(funcName)
+	if fn == nil || fn.Type == nil {
+		fmt.Fprintf(os.Stderr, "function not found: %s\n", funcName)
+		os.Exit(1)
+	}
+	fixed, err := interp.ParseFixedArgs(fn, args, "?")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	opts := symex.Options{Fixed: fixed, MaxSteps: *maxSteps, MaxPaths: *maxPaths, LoopBound: *loopBound}
+	for _, r := range regions {
+		region, err := parseRegion(r)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		opts.Symbolic = append(opts.Symbolic, region)
+	}
+
+	res, err := symex.Reach(module, fn.Index, target, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("%d paths, %d steps\n", res.Paths, res.Steps)
+	if res.Incomplete {
+		fmt.Println("search incomplete: some behavior was approximated or paths were cut off")
+	}
+	if !res.Reached {
+		fmt.Printf("0x%x not reached\n", target)
+		return
+	}
+	verified := "not verified"
+	if res.Verified {
+		verified = "verified"
+	}
+	fmt.Printf("0x%x reached (%s)\n", target, verified)
+	for i, v := range res.Params {
+		fmt.Printf("  p%d = %s\n", i, interp.FormatValue(fn.Type.Params[i], v))
+	}
+	for _, r := range opts.Symbolic {
+		fmt.Printf("  %s @0x%x:\n", r.Name, r.Addr)
+		fmt.Print(indentLines(hexdump(res.Memory[r.Name], 256), "    "))
+	}
+}
+
+func cmdTest(modulePath, suitePath string) {
+	module := loadModule(modulePath)
+	suite, err := harness.LoadSuite(suitePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error reading %s: %v\n", suitePath, err)
+		os.Exit(1)
+	}
+	report, err := harness.Run(module, suite)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	for _, c := range report.Cases {
+		if c.Passed {
+			fmt.Printf("PASS %s\n", c.Name)
+			continue
+		}
+		fmt.Printf("FAIL %s\n", c.Name)
+		for _, f := range c.Failures {
+			fmt.Printf("  %s\n", f)
+		}
+	}
+	fmt.Printf("\n%d passed, %d failed\n", report.Passed, report.Failed)
+	if report.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func cmdDiffCheck(argv []string) {
+	flags := flag.NewFlagSet("diffcheck", flag.ExitOnError)
+	runs := flags.Int("runs", diffcheck.DefaultRuns, "random inputs per function")
+	seed := flags.Int64("seed", 0, "random seed")
+	maxSteps := flags.Uint64("steps", diffcheck.DefaultMaxSteps, "instruction budget of each run")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: wasmspy diffcheck [-runs n] [-seed n] [-steps n] <file.wasm> [func_name]\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(argv)
+	if flags.NArg() < 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+	module := loadModule(flags.Arg(0))
+	opts := diffcheck.Options{Runs: *runs, Seed: *seed, MaxSteps: *maxSteps}
+
+	var results []diffcheck.Result
+	if flags.NArg() >= 2 {
+		fn := module.GetFunctionByName(flags.Arg(1))
+		if fn == nil {
+			fmt.Fprintf(os.Stderr, "function not found: %s\n", flags.Arg(1))
+			os.Exit(1)
+		}
+		r, err := diffcheck.Check(module, fn.Index, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		results = append(results, *r)
+	} else {
+		var err error
+		if results, err = diffcheck.CheckModule(module, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	counts := make(map[diffcheck.Status]int)
+	for _, r := range results {
+		counts[r.Status]++
+		name := r.Name
+		if name == "" {
+			name = fmt.Sprintf("func_%d", r.Func)
+		}
+		switch r.Status {
+		case diffcheck.Agree:
+			fmt.Printf("AGREE   %s (%d runs)\n", name, r.Runs)
+		case diffcheck.Diverge:
+			fn := module.GetFunction(r.Func)
+			args := make([]string, len(r.Args))
+			for i, v := range r.Args {
+				args[i] = interp.FormatValue(fn.Type.Params[i], v)
+			}
+			fmt.Printf("DIVERGE %s(%s)\n  %s\n", name, strings.Join(args, ", "), r.Reason)
+		default:
+			fmt.Printf("SKIP    %s: %s\n", name, r.Reason)
+		}
+	}
+	fmt.Printf("\n%d agree, %d diverge, %d skipped\n", counts[diffcheck.Agree], counts[diffcheck.Diverge], counts[diffcheck.Skip])
+	if counts[diffcheck.Diverge] > 0 {
+		os.Exit(1)
+	}
+}
+
+func cmdTraceDiff(pathA, pathB, modulePath string) {
+	a, err := trace.ReadFile(pathA)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error reading %s: %v\n", pathA, err)
+		os.Exit(1)
+	}
+	b, err := trace.ReadFile(pathB)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error reading %s: %v\n", pathB, err)
+		os.Exit(1)
+	}
+
+	var name func(uint32) string
+	if modulePath != "" {
+		module := loadModule(modulePath)
+		name = func(idx uint32) string {
+			if fn := module.GetFunction(idx); fn != nil {
+				return fn.Name
+			}
+			return ""
+		}
+	}
+
+	d := trace.Compare(a, b)
+	fmt.Print(d.String(name))
+	if !d.Identical() {
+		os.Exit(1)
+	}
+}
+
+// hexdump formats up to limit bytes of data, noting how many were left out.
+func hexdump(data []byte, limit int) string {
+	if len(data) <= limit {
+		return hex.Dump(data)
+	}
+	return hex.Dump(data[:limit]) + fmt.Sprintf("... %d more bytes\n", len(data)-limit)
+}
+
+func indentLines(s, prefix string) string {
+	lines := strings.SplitAfter(s, "\n")
+	var b strings.Builder
+	for _, line := range lines {
+		if line != "" {
+			b.WriteString(prefix + line)
+		}
+	}
+	return b.String()
 }
 
 func exportKind(k wasm.ExportKind) string {
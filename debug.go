@@ -0,0 +1,363 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/0xInception/wasmspy/pkg/debug"
+	"github.com/0xInception/wasmspy/pkg/decompile"
+	"github.com/0xInception/wasmspy/pkg/interp"
+	"github.com/0xInception/wasmspy/pkg/wasi"
+	"github.com/0xInception/wasmspy/pkg/wasm"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+type DebugValue struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+	Raw   string `json:"raw"`
+}
+
+type DebugFrame struct {
+	Func   uint32 `json:"func"`
+	Name   string `json:"name"`
+	Offset uint64 `json:"offset"`
+}
+
+type DebugState struct {
+	Path          string       `json:"path"`
+	Reason        string       `json:"reason"`
+	Func          uint32       `json:"func"`
+	FuncName      string       `json:"funcName"`
+	Offset        uint64       `json:"offset"`
+	Instr         string       `json:"instr"`
+	DecompileLine int          `json:"decompileLine"`
+	Stack         []DebugValue `json:"stack"`
+	Locals        []DebugValue `json:"locals"`
+	Globals       []DebugValue `json:"globals"`
+	CallStack     []DebugFrame `json:"callStack"`
+}
+
+type DebugExit struct {
+	Path    string   `json:"path"`
+	Results []string `json:"results"`
+	Error   string   `json:"error"`
+}
+
+// debugSession pairs a running session with the static analyses used to
+// type its values and map offsets to decompiled lines. The caches are
+// filled from both the execution goroutine and App calls, so the session
+// keeps its own module rather than reading App's maps.
+type debugSession struct {
+	module   *wasm.ResolvedModule
+	session  *debug.Session
+	host     *wasi.Host
+	mu       sync.Mutex
+	analyses map[uint32]*decompile.Analysis
+	mappings map[uint32][]decompile.LineMapping
+}
+
+func (d *debugSession) analysis(module *wasm.ResolvedModule, idx uint32) *decompile.Analysis {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if a, ok := d.analyses[idx]; ok {
+		return a
+	}
+	var a *decompile.Analysis
+	if fn := module.GetFunction(idx); fn != nil && !fn.Imported {
+		a = decompile.Analyze(fn, module)
+	}
+	d.analyses[idx] = a
+	return a
+}
+
+func (d *debugSession) lineMappings(module *wasm.ResolvedModule, idx uint32) []decompile.LineMapping {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if m, ok := d.mappings[idx]; ok {
+		return m
+	}
+	var m []decompile.LineMapping
+	if fn := module.GetFunction(idx); fn != nil && !fn.Imported {
+		m = decompile.DecompileWithMappings(fn, module).Mappings
+	}
+	d.mappings[idx] = m
+	return m
+}
+
+func debugValue(t wasm.ValType, v uint64) DebugValue {
+	return DebugValue{Type: t.String(), Value: interp.FormatValue(t, v), Raw: fmt.Sprintf("0x%x", v)}
+}
+
+func (a *App) funcName(module *wasm.ResolvedModule, idx uint32) string {
+	if fn := module.GetFunction(idx); fn != nil && fn.Name != "" {
+		return fn.Name
+	}
+	return fmt.Sprintf("func_%d", idx)
+}
+
+func (a *App) toDebugState(path string, d *debugSession, st *debug.State) *DebugState {
+	module := d.module
+	ds := &DebugState{
+		Path:          path,
+		Reason:        string(st.Reason),
+		Func:          st.Func,
+		FuncName:      a.funcName(module, st.Func),
+		Offset:        st.Offset,
+		Instr:         formatInstrWithImm(st.Instr),
+		DecompileLine: -1,
+		Stack:         []DebugValue{},
+		Locals:        []DebugValue{},
+		Globals:       []DebugValue{},
+	}
+
+	// The static frame at this instruction types the live values. Its
+	// stack is aligned at the top, since unreachable code can leave the
+	// two at different heights.
+	var frame *decompile.Frame
+	if an := d.analysis(module, st.Func); an != nil && st.PC < len(an.Frames) {
+		frame = &an.Frames[st.PC]
+	}
+	for i, v := range st.Stack {
+		t := wasm.ValI32
+		if frame != nil {
+			if j := len(frame.Stack) - len(st.Stack) + i; j >= 0 && j < len(frame.Stack) && frame.Stack[j] != nil {
+				t = frame.Stack[j].Type
+			}
+		}
+		ds.Stack = append(ds.Stack, debugValue(t, v))
+	}
+	for i, v := range st.Locals {
+		t := wasm.ValI32
+		if frame != nil && i < len(frame.Locals) && frame.Locals[i] != nil {
+			t = frame.Locals[i].Type
+		}
+		ds.Locals = append(ds.Locals, debugValue(t, v))
+	}
+	for _, g := range d.session.Inst.Globals {
+		ds.Globals = append(ds.Globals, debugValue(g.Type.Type, g.Value))
+	}
+	for _, f := range st.CallStack {
+		ds.CallStack = append(ds.CallStack, DebugFrame{Func: f.Func, Name: a.funcName(module, f.Func), Offset: f.Offset})
+	}
+
+	for _, m := range d.lineMappings(module, st.Func) {
+		for _, off := range m.Offsets {
+			if off == st.Offset {
+				ds.DecompileLine = m.Line
+				break
+			}
+		}
+		if ds.DecompileLine >= 0 {
+			break
+		}
+	}
+	return ds
+}
+
+// StartDebugSession instantiates the module and starts a call to the given
+// function paused before its first instruction. Pauses and the final result
+// are delivered as "debug:paused" and "debug:exited" events; a call that
+// finishes without pausing is reported as an error and leaves no session.
+// WASI modules run with no directory access.
+func (a *App) StartDebugSession(path string, index uint32, args []string) (*DebugState, error) {
+	module := a.modules[path]
+	if module == nil {
+		return nil, fmt.Errorf("module not loaded: %s", path)
+	}
+	fn := module.GetFunction(index)
+	if fn == nil || fn.Type == nil {
+		return nil, fmt.Errorf("function %d not found", index)
+	}
+	values, err := interp.ParseArgs(fn, args)
+	if err != nil {
+		return nil, err
+	}
+
+	a.StopDebugSession(path)
+
+	imports := interp.NewImports()
+	imports.Fallback = interp.TrapUnresolved
+	d := &debugSession{
+		module:   module,
+		analyses: make(map[uint32]*decompile.Analysis),
+		mappings: make(map[uint32][]decompile.LineMapping),
+	}
+	if wasi.Imports(module) {
+		host, err := wasi.New(wasi.Config{Args: []string{fn.Name}})
+		if err != nil {
+			return nil, err
+		}
+		host.Register(imports)
+		d.host = host
+	}
+	inst, err := interp.Instantiate(module, imports)
+	if err != nil {
+		if d.host != nil {
+			d.host.Close()
+		}
+		return nil, err
+	}
+
+	d.session = debug.New(inst)
+	entry := make(chan *debug.State, 1)
+	d.session.OnPause = func(st *debug.State) {
+		if st.Reason == debug.ReasonEntry {
+			entry <- st
+			return
+		}
+		runtime.EventsEmit(a.ctx, "debug:paused", a.toDebugState(path, d, st))
+	}
+	d.session.OnExit = func(results []uint64, err error) {
+		exit := &DebugExit{Path: path, Results: []string{}}
+		for i, r := range results {
+			exit.Results = append(exit.Results, interp.FormatValue(fn.Type.Results[i], r))
+		}
+		if err != nil {
+			exit.Error = err.Error()
+		}
+		if d.host != nil {
+			d.host.Close()
+		}
+		runtime.EventsEmit(a.ctx, "debug:exited", exit)
+		close(entry)
+	}
+
+	a.debugSessions[path] = d
+	d.session.Start(index, values...)
+	st, ok := <-entry
+	if !ok {
+		// The function has no instructions to pause on; its result went
+		// out as "debug:exited".
+		delete(a.debugSessions, path)
+		return nil, fmt.Errorf("function %d returned without pausing", index)
+	}
+	return a.toDebugState(path, d, st), nil
+}
+
+func (a *App) debugSession(path string) (*debugSession, error) {
+	d := a.debugSessions[path]
+	if d == nil {
+		return nil, fmt.Errorf("no debug session for %s", path)
+	}
+	return d, nil
+}
+
+func (a *App) DebugContinue(path string) error {
+	d, err := a.debugSession(path)
+	if err != nil {
+		return err
+	}
+	return d.session.Continue()
+}
+
+func (a *App) DebugStepIn(path string) error {
+	d, err := a.debugSession(path)
+	if err != nil {
+		return err
+	}
+	return d.session.StepIn()
+}
+
+func (a *App) DebugStepOver(path string) error {
+	d, err := a.debugSession(path)
+	if err != nil {
+		return err
+	}
+	return d.session.StepOver()
+}
+
+func (a *App) DebugStepOut(path string) error {
+	d, err := a.debugSession(path)
+	if err != nil {
+		return err
+	}
+	return d.session.StepOut()
+}
+
+func (a *App) DebugPause(path string) error {
+	d, err := a.debugSession(path)
+	if err != nil {
+		return err
+	}
+	d.session.Pause()
+	return nil
+}
+
+func (a *App) StopDebugSession(path string) {
+	if d := a.debugSessions[path]; d != nil {
+		d.session.Stop()
+		delete(a.debugSessions, path)
+	}
+}
+
+// GetDebugState returns the state of a paused session, or nil while it is
+// running or after it finished.
+func (a *App) GetDebugState(path string) (*DebugState, error) {
+	d, err := a.debugSession(path)
+	if err != nil {
+		return nil, err
+	}
+	st := d.session.State()
+	if st == nil {
+		return nil, nil
+	}
+	return a.toDebugState(path, d, st), nil
+}
+
+// SetBreakpoint sets or clears a breakpoint at an instruction offset. It
+// may be called while the session is running.
+func (a *App) SetBreakpoint(path string, offset uint64, enabled bool) error {
+	d, err := a.debugSession(path)
+	if err != nil {
+		return err
+	}
+	d.session.SetBreakpoint(offset, enabled)
+	return nil
+}
+
+// SetBreakpointAtLine sets or clears a breakpoint on the first instruction
+// of a decompiled line and returns the offset used.
+func (a *App) SetBreakpointAtLine(path string, index uint32, line int, enabled bool) (uint64, error) {
+	d, err := a.debugSession(path)
+	if err != nil {
+		return 0, err
+	}
+	for _, m := range d.lineMappings(d.module, index) {
+		if m.Line != line || len(m.Offsets) == 0 {
+			continue
+		}
+		offsets := append([]uint64(nil), m.Offsets...)
+		sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+		d.session.SetBreakpoint(offsets[0], enabled)
+		return offsets[0], nil
+	}
+	return 0, fmt.Errorf("line %d of function %d has no instructions", line, index)
+}
+
+func (a *App) GetBreakpoints(path string) ([]uint64, error) {
+	d, err := a.debugSession(path)
+	if err != nil {
+		return nil, err
+	}
+	offsets := d.session.Breakpoints()
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	return offsets, nil
+}
+
+// ReadDebugMemory reads the live memory of a paused or finished session.
+func (a *App) ReadDebugMemory(path string, offset int, length int) (*MemoryData, error) {
+	d, err := a.debugSession(path)
+	if err != nil {
+		return nil, err
+	}
+	if offset < 0 || length < 0 {
+		return nil, fmt.Errorf("invalid range")
+	}
+	data, total, err := d.session.ReadMemory(uint32(offset), uint32(length))
+	if err != nil {
+		return nil, err
+	}
+	return &MemoryData{Data: data, TotalSize: total, Offset: offset}, nil
+}
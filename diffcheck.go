@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/0xInception/wasmspy/pkg/diffcheck"
+	"github.com/0xInception/wasmspy/pkg/interp"
+)
+
+type DiffCheckResult struct {
+	Func   uint32   `json:"func"`
+	Name   string   `json:"name"`
+	Status string   `json:"status"`
+	Reason string   `json:"reason"`
+	Args   []string `json:"args"`
+	Runs   int      `json:"runs"`
+}
+
+// CheckDecompiler runs every defined function of a module and its decompiled
+// code on the same random inputs and reports where they disagree. status is
+// "agree", "diverge" or "skip".
+func (a *App) CheckDecompiler(path string, runs int) ([]DiffCheckResult, error) {
+	module := a.modules[path]
+	if module == nil {
+		return nil, fmt.Errorf("module not loaded: %s", path)
+	}
+	results, err := diffcheck.CheckModule(module, diffcheck.Options{Runs: runs})
+	if err != nil {
+		return nil, err
+	}
+	out := []DiffCheckResult{}
+	for _, r := range results {
+		dr := DiffCheckResult{Func: r.Func, Name: r.Name, Status: r.Status.String(), Reason: r.Reason, Args: []string{}, Runs: r.Runs}
+		if fn := module.GetFunction(r.Func); fn != nil && fn.Type != nil {
+			for i, v := range r.Args {
+				dr.Args = append(dr.Args, interp.FormatValue(fn.Type.Params[i], v))
+			}
+		}
+		out = append(out, dr)
+	}
+	return out, nil
+}
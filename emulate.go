@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/0xInception/wasmspy/pkg/emulate"
+	"github.com/0xInception/wasmspy/pkg/interp"
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+type MemoryChange struct {
+	Addr   uint32 `json:"addr"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+	Text   string `json:"text"`
+}
+
+type ImportCallCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type EmulationResult struct {
+	Results     []string          `json:"results"`
+	Error       string            `json:"error"`
+	Steps       uint64            `json:"steps"`
+	Changes     []MemoryChange    `json:"changes"`
+	ImportCalls []ImportCallCount `json:"importCalls"`
+	Summary     string            `json:"summary"`
+}
+
+type EmulatedCallSite struct {
+	Caller     uint32           `json:"caller"`
+	CallerName string           `json:"callerName"`
+	Offset     uint64           `json:"offset"`
+	Args       []string         `json:"args"`
+	Known      bool             `json:"known"`
+	Result     *EmulationResult `json:"result"`
+}
+
+func toEmulationResult(fn *wasm.ResolvedFunction, res *emulate.Result) *EmulationResult {
+	out := &EmulationResult{
+		Results:     []string{},
+		Steps:       res.Steps,
+		Changes:     []MemoryChange{},
+		ImportCalls: []ImportCallCount{},
+		Summary:     res.Summary(),
+	}
+	for i, r := range res.Results {
+		out.Results = append(out.Results, interp.FormatValue(fn.Type.Results[i], r))
+	}
+	if res.Err != nil {
+		out.Error = res.Err.Error()
+	}
+	for i := range res.Changes {
+		c := &res.Changes[i]
+		out.Changes = append(out.Changes, MemoryChange{
+			Addr:   c.Addr,
+			Before: hex.EncodeToString(c.Before),
+			After:  hex.EncodeToString(c.After),
+			Text:   c.Text(),
+		})
+	}
+	for name, count := range res.ImportCalls {
+		out.ImportCalls = append(out.ImportCalls, ImportCallCount{Name: name, Count: count})
+	}
+	sort.Slice(out.ImportCalls, func(i, j int) bool { return out.ImportCalls[i].Name < out.ImportCalls[j].Name })
+	return out
+}
+
+// EmulateFunction runs a function on a copy of the static memory image with
+// every import stubbed and reports the memory it changed. A maxSteps of zero
+// uses the default budget. Traps are reported in the result.
+func (a *App) EmulateFunction(path string, index uint32, args []string, maxSteps uint64) (*EmulationResult, error) {
+	module := a.modules[path]
+	if module == nil {
+		return nil, fmt.Errorf("module not loaded: %s", path)
+	}
+	fn := module.GetFunction(index)
+	if fn == nil || fn.Type == nil {
+		return nil, fmt.Errorf("function %d not found", index)
+	}
+	values, err := interp.ParseArgs(fn, args)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := emulate.Run(module, index, emulate.Options{Args: values, MaxSteps: maxSteps})
+	if err != nil {
+		return nil, err
+	}
+	return toEmulationResult(fn, res), nil
+}
+
+// EmulateCallSites emulates a function once for every direct call to it with
+// constant arguments. With annotate set, each emulated call site gets the
+// result summary as its disassembly comment.
+func (a *App) EmulateCallSites(path string, index uint32, annotate bool) ([]EmulatedCallSite, error) {
+	module := a.modules[path]
+	if module == nil {
+		return nil, fmt.Errorf("module not loaded: %s", path)
+	}
+	fn := module.GetFunction(index)
+	if fn == nil || fn.Type == nil {
+		return nil, fmt.Errorf("function %d not found", index)
+	}
+
+	sites := []EmulatedCallSite{}
+	for _, sr := range emulate.RunCallSites(module, index, emulate.Options{}) {
+		site := EmulatedCallSite{
+			Caller:     sr.Caller,
+			CallerName: a.funcName(module, sr.Caller),
+			Offset:     sr.Offset,
+			Args:       []string{},
+			Known:      sr.Known,
+		}
+		for i, arg := range sr.Args {
+			site.Args = append(site.Args, interp.FormatValue(fn.Type.Params[i], arg))
+		}
+		if sr.Err != nil {
+			return nil, sr.Err
+		}
+		if sr.Result != nil {
+			site.Result = toEmulationResult(fn, sr.Result)
+			if annotate {
+				a.SetOffsetComment(path, sr.Offset, site.Result.Summary, false)
+			}
+		}
+		sites = append(sites, site)
+	}
+	return sites, nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/0xInception/wasmspy/pkg/wasm"
 )
@@ -83,26 +84,10 @@ func formatFunctionDisasm(fn *wasm.ResolvedFunction, rm *wasm.ResolvedModule, in
 }
 
 func formatInstrWithImm(instr *wasm.Instruction) string {
-	if len(instr.Immediates) == 0 {
-		return instr.Name
-	}
-	result := instr.Name
-	for _, imm := range instr.Immediates {
-		switch v := imm.(type) {
-		case []uint32:
-			result += " ["
-			for i, n := range v {
-				if i > 0 {
-					result += ", "
-				}
-				result += fmt.Sprintf("%d", n)
-			}
-			result += "]"
-		default:
-			result += fmt.Sprintf(" %v", imm)
-		}
+	if instr.Opcode == wasm.OpBrTable {
+		return fmt.Sprintf("%s [%s]", instr.Name, strings.Join(instr.Operands(), ", "))
 	}
-	return result
+	return formatInstr(instr)
 }
 
 func formatFunctionWAT(fn *wasm.ResolvedFunction, rm *wasm.ResolvedModule) string {
@@ -156,12 +141,9 @@ func formatFunctionWAT(fn *wasm.ResolvedFunction, rm *wasm.ResolvedModule) strin
 }
 
 func formatInstr(instr *wasm.Instruction) string {
-	if len(instr.Immediates) == 0 {
+	ops := instr.Operands()
+	if len(ops) == 0 {
 		return instr.Name
 	}
-	result := instr.Name
-	for _, imm := range instr.Immediates {
-		result += fmt.Sprintf(" %v", imm)
-	}
-	return result
+	return instr.Name + " " + strings.Join(ops, " ")
 }
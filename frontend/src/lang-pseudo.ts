@@ -2,10 +2,11 @@ import { StreamLanguage } from '@codemirror/language';
 
 const keywords = new Set([
   'func', 'if', 'else', 'switch', 'case', 'break', 'return', 'loop', 'block',
-  'br', 'br_if', 'unreachable', 'nop', 'default', 'mem',
+  'br', 'br_if', 'unreachable', 'nop', 'default', 'mem', 'while', 'do', 'for',
+  'continue', 'goto', 'true',
 ]);
 
-const types = new Set(['i32', 'i64', 'f32', 'f64', 'v128']);
+const types = new Set(['i32', 'i64', 'f32', 'f64', 'v128', 'i8', 'i16', 'u8', 'u16', 'u32', 'u64', 'bool', 'void']);
 
 export const pseudo = StreamLanguage.define({
   token(stream) {
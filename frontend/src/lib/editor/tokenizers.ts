@@ -25,8 +25,8 @@ export interface ThemeColors {
 const watKeywords = new Set(['module', 'func', 'param', 'result', 'local', 'global', 'table', 'memory', 'export', 'import', 'type', 'data', 'elem', 'start', 'offset', 'mut']);
 const watTypes = new Set(['i32', 'i64', 'f32', 'f64', 'funcref', 'externref', 'v128']);
 const watInstructions = new Set(['unreachable', 'nop', 'block', 'loop', 'if', 'else', 'end', 'br', 'br_if', 'br_table', 'return', 'call', 'call_indirect', 'drop', 'select', 'local.get', 'local.set', 'local.tee', 'global.get', 'global.set', 'i32.load', 'i64.load', 'f32.load', 'f64.load', 'i32.store', 'i64.store', 'f32.store', 'f64.store', 'memory.size', 'memory.grow', 'i32.const', 'i64.const', 'f32.const', 'f64.const', 'i32.add', 'i32.sub', 'i32.mul', 'i32.div_s', 'i32.div_u', 'i32.and', 'i32.or', 'i32.xor', 'i32.shl', 'i32.shr_s', 'i32.shr_u', 'i32.eq', 'i32.ne', 'i32.lt_s', 'i32.lt_u', 'i32.gt_s', 'i32.gt_u', 'i32.le_s', 'i32.le_u', 'i32.ge_s', 'i32.ge_u', 'i32.eqz', 'i64.add', 'i64.sub', 'i64.mul', 'i64.eq', 'i64.ne', 'i64.eqz', 'i32.wrap_i64', 'i64.extend_i32_s', 'i64.extend_i32_u', 'f32.add', 'f32.sub', 'f32.mul', 'f32.div', 'f64.add', 'f64.sub', 'f64.mul', 'f64.div']);
-const pseudoKeywords = new Set(['func', 'if', 'else', 'switch', 'case', 'break', 'return', 'loop', 'block', 'br', 'br_if', 'unreachable', 'nop', 'default', 'mem']);
-const pseudoTypes = new Set(['i32', 'i64', 'f32', 'f64', 'v128']);
+const pseudoKeywords = new Set(['func', 'if', 'else', 'switch', 'case', 'break', 'return', 'loop', 'block', 'br', 'br_if', 'unreachable', 'nop', 'default', 'mem', 'while', 'do', 'for', 'continue', 'goto', 'true']);
+const pseudoTypes = new Set(['i32', 'i64', 'f32', 'f64', 'v128', 'i8', 'i16', 'u8', 'u16', 'u32', 'u64', 'bool', 'void']);
 
 export function tokenizeWat(text: string, lineFrom: number): Token[] {
   const tokens: Token[] = [];
@@ -32,12 +32,245 @@ export interface ExportInfo {
   index: number;
 }
 
+export interface CustomSectionInfo {
+  index: number;
+  name: string;
+  offset: number;
+  size: number;
+  decoded: boolean;
+  error?: string;
+}
+
+export interface TraceSummary {
+  events: number;
+  instructions: number;
+  functions: number[] | null;
+  results: string[] | null;
+  steps: number;
+  stdout: string;
+  error: string;
+  sameModule: boolean;
+}
+
+export interface FunctionCoverage {
+  offsets: number[];
+  hits: number[];
+  decompileLines: number[];
+}
+
+export interface DebugValue {
+  type: string;
+  value: string;
+  raw: string;
+}
+
+export interface DebugFrame {
+  func: number;
+  name: string;
+  offset: number;
+}
+
+// Payload of StartDebugSession, GetDebugState and the "debug:paused" event.
+export interface DebugState {
+  path: string;
+  reason: 'entry' | 'breakpoint' | 'step' | 'pause';
+  func: number;
+  funcName: string;
+  offset: number;
+  instr: string;
+  decompileLine: number;
+  stack: DebugValue[];
+  locals: DebugValue[];
+  globals: DebugValue[];
+  callStack: DebugFrame[] | null;
+}
+
+// Payload of the "debug:exited" event.
+export interface DebugExit {
+  path: string;
+  results: string[];
+  error: string;
+}
+
+export interface MemoryChange {
+  addr: number;
+  before: string;
+  after: string;
+  text: string;
+}
+
+export interface ImportCallCount {
+  name: string;
+  count: number;
+}
+
+export interface EmulationResult {
+  results: string[];
+  error: string;
+  steps: number;
+  changes: MemoryChange[];
+  importCalls: ImportCallCount[];
+  summary: string;
+}
+
+export interface EmulatedCallSite {
+  caller: number;
+  callerName: string;
+  offset: number;
+  args: string[];
+  known: boolean;
+  result: EmulationResult | null;
+}
+
+export interface SnapshotInfo {
+  size: number;
+  globals: number;
+}
+
+export interface GlobalValueInfo {
+  index: number;
+  type: string;
+  value: string;
+  snapshot: boolean;
+}
+
+export interface PointerInfo {
+  addr: number;
+  target: number;
+  string: string;
+}
+
+export interface StubConfig {
+  default: string;
+  presets: string[];
+  script: string;
+}
+
+export interface ImportCallInfo {
+  import: string;
+  args: string[];
+  results: string[];
+  error: string;
+}
+
+export interface StubRunResult {
+  results: string[];
+  error: string;
+  steps: number;
+  stdout: string;
+  calls: ImportCallInfo[];
+  droppedCalls: number;
+}
+
+export interface SymbolicRegion {
+  name: string;
+  addr: number;
+  size: number;
+}
+
+export interface RegionValue {
+  name: string;
+  addr: number;
+  hex: string;
+  text: string;
+}
+
+export interface ReachResult {
+  reached: boolean;
+  params: string[];
+  memory: RegionValue[];
+  condition: string;
+  paths: number;
+  steps: number;
+  incomplete: boolean;
+  verified: boolean;
+}
+
+export interface UnitTestCase {
+  name: string;
+  passed: boolean;
+  failures: string[];
+  results: string[];
+  error: string;
+  steps: number;
+}
+
+export interface UnitTestReport {
+  cases: UnitTestCase[];
+  passed: number;
+  failed: number;
+}
+
+export interface DiffCheckResult {
+  func: number;
+  name: string;
+  status: 'agree' | 'diverge' | 'skip';
+  reason: string;
+  args: string[];
+  runs: number;
+}
+
+export interface CFGEdge {
+  from: number;
+  to: number;
+  kind: string;
+  case: number;
+}
+
+export interface CFGBlock {
+  index: number;
+  startOffset: number;
+  endOffset: number;
+  lines: string[];
+  succs: CFGEdge[];
+  idom: number;
+  ipdom: number;
+  loop: number;
+  reachable: boolean;
+  exit: boolean;
+}
+
+export interface CFGLoop {
+  header: number;
+  latches: number[];
+  blocks: number[];
+  parent: number;
+  depth: number;
+}
+
+export interface CFGInfo {
+  blocks: CFGBlock[];
+  loops: CFGLoop[];
+  entry: number;
+  exit: number;
+}
+
+export interface StructField {
+  offset: number;
+  name: string;
+  type: string;
+}
+
+export interface StructUse {
+  func: number;
+  local: number;
+}
+
+export interface Struct {
+  id: string;
+  name: string;
+  size: number;
+  fields: StructField[];
+  uses: StructUse[];
+}
+
 export interface ModuleInfo {
   functions: FunctionInfo[] | null;
   exports: ExportInfo[] | null;
   memories: MemoryInfo[] | null;
   tables: TableInfo[] | null;
   globals: GlobalInfo[] | null;
+  customSections: CustomSectionInfo[] | null;
 }
 
 export interface Bookmark {
@@ -50,6 +283,7 @@ export interface Bookmark {
 export interface FunctionRef {
   index: number;
   name: string;
+  indirect: boolean;
 }
 
 export interface XRefInfo {
@@ -86,6 +320,17 @@ export interface Annotations {
   comments?: Record<string, string>;
   decompileComments?: Record<string, string>;
   bookmarks?: number[];
+  structs?: Record<string, StructAnnotation>;
+}
+
+export interface FieldAnnotation {
+  name?: string;
+  type?: string;
+}
+
+export interface StructAnnotation {
+  name?: string;
+  fields?: Record<string, FieldAnnotation>;
 }
 
 export type GroupedFunctions = [string, FunctionInfo[]][];
@@ -127,7 +372,7 @@ export interface OpenTab {
   id: string;
   title: string;
   icon: string;
-  type: 'function' | 'memory';
+  type: 'function' | 'memory' | 'custom';
   modulePath: string;
   index: number;
   decompileContent: string | null;
@@ -140,4 +385,5 @@ export interface OpenTab {
   showRight: boolean;
   showOffsets: boolean;
   disasmIndent: boolean;
+  textContent?: string;
 }
@@ -0,0 +1,81 @@
+// Package wasmtest assembles small modules byte by byte for tests.
+package wasmtest
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+// Header is the magic number and version every module starts with.
+var Header = []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+
+func uleb(n int) []byte {
+	var out []byte
+	for ; n >= 0x80; n >>= 7 {
+		out = append(out, byte(n)|0x80)
+	}
+	return append(out, byte(n))
+}
+
+// Section prefixes content with the section id and its size.
+func Section(id byte, content ...byte) []byte {
+	return Cat([]byte{id}, uleb(len(content)), content)
+}
+
+// Name encodes s as a length-prefixed name.
+func Name(s string) []byte {
+	return append(uleb(len(s)), s...)
+}
+
+// Cat concatenates parts.
+func Cat(parts ...[]byte) []byte {
+	var out []byte
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
+
+// Body prefixes a function body, its locals and code, with its size.
+func Body(code ...byte) []byte {
+	return append(uleb(len(code)), code...)
+}
+
+// Code builds the code section holding bodies.
+func Code(bodies ...[]byte) []byte {
+	return Section(0x0a, Cat(uleb(len(bodies)), Cat(bodies...))...)
+}
+
+// Module parses and resolves the module made of sections, which must be
+// given in section order, failing t on error.
+func Module(t testing.TB, sections ...[]byte) *wasm.ResolvedModule {
+	t.Helper()
+	mod, err := wasm.Parse(Cat(Header, Cat(sections...)))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	rm, err := wasm.Resolve(mod)
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	return rm
+}
+
+// Load parses and resolves the module tests/testdata/name, failing t on
+// error.
+func Load(t testing.TB, name string) *wasm.ResolvedModule {
+	t.Helper()
+	_, file, _, _ := runtime.Caller(0)
+	mod, err := wasm.ParseFile(filepath.Join(filepath.Dir(file), "..", "..", "tests", "testdata", name))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	rm, err := wasm.Resolve(mod)
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	return rm
+}
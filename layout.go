@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+type LayoutRegion struct {
+	Kind     string         `json:"kind"`
+	Label    string         `json:"label"`
+	Start    int            `json:"start"`
+	End      int            `json:"end"`
+	Section  string         `json:"section"`
+	Index    int            `json:"index"`
+	Children []LayoutRegion `json:"children,omitempty"`
+}
+
+type FileData struct {
+	Data      []byte `json:"data"`
+	TotalSize int    `json:"totalSize"`
+	Offset    int    `json:"offset"`
+}
+
+func (a *App) toLayoutRegion(module *wasm.ResolvedModule, r *wasm.Region, withChildren bool) LayoutRegion {
+	lr := LayoutRegion{
+		Kind:    string(r.Kind),
+		Label:   r.Label,
+		Start:   int(r.Start),
+		End:     int(r.End),
+		Section: r.Section.String(),
+		Index:   r.Index,
+	}
+	if r.Kind == wasm.RegionEntry && (r.Section == wasm.SectionCode || r.Section == wasm.SectionFunction) {
+		if fn := module.GetFunction(uint32(r.Index)); fn != nil {
+			lr.Label += " " + fn.Name
+		}
+	}
+	if withChildren {
+		for i := range r.Children {
+			lr.Children = append(lr.Children, a.toLayoutRegion(module, &r.Children[i], true))
+		}
+	}
+	return lr
+}
+
+// GetFileLayout returns the interval map of the module file, for overlaying
+// structure on the raw hex view.
+func (a *App) GetFileLayout(path string) ([]LayoutRegion, error) {
+	module := a.modules[path]
+	layout := a.layouts[path]
+	if module == nil || layout == nil {
+		return nil, fmt.Errorf("module not loaded: %s", path)
+	}
+	regions := make([]LayoutRegion, 0, len(layout.Regions))
+	for i := range layout.Regions {
+		regions = append(regions, a.toLayoutRegion(module, &layout.Regions[i], true))
+	}
+	return regions, nil
+}
+
+// GetRegionAt returns the regions owning the byte at offset, outermost first.
+func (a *App) GetRegionAt(path string, offset int) ([]LayoutRegion, error) {
+	module := a.modules[path]
+	layout := a.layouts[path]
+	if module == nil || layout == nil {
+		return nil, fmt.Errorf("module not loaded: %s", path)
+	}
+	if offset < 0 {
+		return []LayoutRegion{}, nil
+	}
+	chain := layout.Lookup(uint64(offset))
+	regions := make([]LayoutRegion, 0, len(chain))
+	for _, r := range chain {
+		regions = append(regions, a.toLayoutRegion(module, r, false))
+	}
+	return regions, nil
+}
+
+func (a *App) GetFileData(path string, offset int, length int) (*FileData, error) {
+	data, ok := a.files[path]
+	if !ok {
+		return nil, fmt.Errorf("module not loaded: %s", path)
+	}
+	totalSize := len(data)
+	if offset < 0 || offset >= totalSize {
+		return &FileData{Data: []byte{}, TotalSize: totalSize, Offset: offset}, nil
+	}
+	end := offset + length
+	if end > totalSize {
+		end = totalSize
+	}
+	return &FileData{
+		Data:      data[offset:end],
+		TotalSize: totalSize,
+		Offset:    offset,
+	}, nil
+}
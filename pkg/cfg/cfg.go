@@ -0,0 +1,371 @@
+// Package cfg builds the control-flow graph of a function body: basic
+// blocks of instructions joined by typed edges, with dominator and
+// post-dominator trees and the loop nesting forest computed over it.
+//
+// Structured markers start blocks where control can join: a loop header
+// begins at its loop instruction, an else branch at its else, and the code
+// after a block or if that is branched to at its end. Every function has a
+// virtual exit block without instructions that returns, traps and the end
+// of the body lead to.
+package cfg
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+type EdgeKind int
+
+const (
+	// EdgeFallthrough is flow without a branch: into the next block, or
+	// from the end of a then branch past its else.
+	EdgeFallthrough EdgeKind = iota
+	EdgeBr
+	EdgeBrIfTrue
+	EdgeBrIfFalse
+	// EdgeBrTable is one target of a br_table; Edge.Case says which.
+	EdgeBrTable
+	EdgeIfTrue
+	EdgeIfFalse
+	EdgeReturn
+	// EdgeUnreachable leads from an unreachable instruction to the exit.
+	EdgeUnreachable
+)
+
+var edgeKindNames = [...]string{
+	EdgeFallthrough: "fallthrough",
+	EdgeBr:          "br",
+	EdgeBrIfTrue:    "br_if true",
+	EdgeBrIfFalse:   "br_if false",
+	EdgeBrTable:     "br_table",
+	EdgeIfTrue:      "if true",
+	EdgeIfFalse:     "if false",
+	EdgeReturn:      "return",
+	EdgeUnreachable: "unreachable",
+}
+
+func (k EdgeKind) String() string {
+	if int(k) < len(edgeKindNames) {
+		return edgeKindNames[k]
+	}
+	return fmt.Sprintf("EdgeKind(%d)", int(k))
+}
+
+// DefaultCase is the Case of the br_table edge for its default label.
+const DefaultCase = -1
+
+type Edge struct {
+	From, To int
+	Kind     EdgeKind
+	// Case is the br_table label position for EdgeBrTable, or DefaultCase.
+	Case int
+}
+
+// Block is a basic block: the instructions in [Start, End) of the body.
+type Block struct {
+	Index      int
+	Start, End int
+	Succs      []Edge
+	Preds      []Edge
+}
+
+type Graph struct {
+	Func   *wasm.ResolvedFunction
+	Blocks []*Block
+	Entry  int
+	Exit   int
+
+	// IDom and IPDom give each block's immediate dominator and immediate
+	// post-dominator, or -1 for the roots and for blocks unreachable from
+	// the entry or unable to reach the exit.
+	IDom  []int
+	IPDom []int
+
+	Loops []*Loop
+	// LoopOf is the innermost loop containing each block, or -1.
+	LoopOf []int
+}
+
+// Instructions returns the instructions of block b.
+func (g *Graph) Instructions(b *Block) []wasm.Instruction {
+	return g.Func.Body.Instructions[b.Start:b.End]
+}
+
+// BlockAt returns the block holding the instruction at a byte offset, or nil.
+func (g *Graph) BlockAt(offset uint64) *Block {
+	instrs := g.Func.Body.Instructions
+	for _, b := range g.Blocks {
+		if b.Start < b.End && instrs[b.Start].Offset <= offset && offset <= instrs[b.End-1].Offset {
+			return b
+		}
+	}
+	return nil
+}
+
+// Reachable reports whether block i can be reached from the entry.
+func (g *Graph) Reachable(i int) bool {
+	return i == g.Entry || g.IDom[i] >= 0
+}
+
+type frameKind int
+
+const (
+	frameFunc frameKind = iota
+	frameBlock
+	frameLoop
+	frameIf
+)
+
+type frame struct {
+	kind frameKind
+	// header is the loop's first block.
+	header *Block
+	// cond is the block ending in the if instruction.
+	cond    *Block
+	hasElse bool
+	// pending are edges to the code after the end, whose block does not
+	// exist yet; their To is filled in at the end.
+	pending []Edge
+}
+
+type builder struct {
+	g      *Graph
+	cur    *Block
+	frames []*frame
+}
+
+// Build constructs the graph of a defined function.
+func Build(fn *wasm.ResolvedFunction) (*Graph, error) {
+	if fn.Body == nil || len(fn.Body.Instructions) == 0 {
+		return nil, fmt.Errorf("function %d has no body", fn.Index)
+	}
+	b := &builder{g: &Graph{Func: fn}, frames: []*frame{{kind: frameFunc}}}
+	b.cur = b.newBlock(0)
+
+	instrs := fn.Body.Instructions
+	for i := range instrs {
+		if len(b.frames) == 0 {
+			return nil, fmt.Errorf("instruction at 0x%x after the end of the body", instrs[i].Offset)
+		}
+		if err := b.instr(i, &instrs[i]); err != nil {
+			return nil, err
+		}
+	}
+	if len(b.frames) != 0 {
+		return nil, fmt.Errorf("function %d: unterminated block", fn.Index)
+	}
+
+	g := b.g
+	g.Exit = len(g.Blocks)
+	exit := b.newBlock(len(instrs))
+	exit.End = len(instrs)
+	for _, blk := range g.Blocks {
+		for i := range blk.Succs {
+			if blk.Succs[i].To < 0 {
+				blk.Succs[i].To = g.Exit
+			}
+			e := blk.Succs[i]
+			g.Blocks[e.To].Preds = append(g.Blocks[e.To].Preds, e)
+		}
+	}
+	g.IDom = dominators(g, false)
+	g.IPDom = dominators(g, true)
+	findLoops(g)
+	return g, nil
+}
+
+func (b *builder) newBlock(start int) *Block {
+	blk := &Block{Index: len(b.g.Blocks), Start: start, End: -1}
+	b.g.Blocks = append(b.g.Blocks, blk)
+	return blk
+}
+
+// split starts a new block at instruction i, reached by falling through
+// from the current block if there is one. A current block that starts at i
+// is still empty and is used as is.
+func (b *builder) split(i int) *Block {
+	if b.cur != nil && b.cur.Start == i {
+		return b.cur
+	}
+	next := b.newBlock(i)
+	if b.cur != nil {
+		b.cur.End = i
+		b.edge(b.cur, next.Index, EdgeFallthrough, 0)
+	}
+	b.cur = next
+	return next
+}
+
+// terminate ends the current block after instruction i; what follows is
+// dead until the next block starts.
+func (b *builder) terminate(i int) {
+	b.cur.End = i + 1
+	b.cur = nil
+}
+
+// edge adds an edge from blk to block to, or to the exit when to is -1.
+func (b *builder) edge(blk *Block, to int, kind EdgeKind, c int) {
+	blk.Succs = append(blk.Succs, Edge{From: blk.Index, To: to, Kind: kind, Case: c})
+}
+
+// branch adds an edge for a branch to the label at depth.
+func (b *builder) branch(depth uint32, kind EdgeKind, c int) error {
+	if int(depth) >= len(b.frames) {
+		return fmt.Errorf("branch depth %d out of range", depth)
+	}
+	f := b.frames[len(b.frames)-1-int(depth)]
+	switch f.kind {
+	case frameFunc:
+		b.edge(b.cur, -1, kind, c)
+	case frameLoop:
+		b.edge(b.cur, f.header.Index, kind, c)
+	default:
+		f.pending = append(f.pending, Edge{From: b.cur.Index, Kind: kind, Case: c})
+	}
+	return nil
+}
+
+func (b *builder) instr(i int, ins *wasm.Instruction) error {
+	top := b.frames[len(b.frames)-1]
+	switch ins.Opcode {
+	case wasm.OpLoop:
+		b.split(i)
+		b.frames = append(b.frames, &frame{kind: frameLoop, header: b.cur})
+		return nil
+
+	case wasm.OpElse:
+		if top.kind != frameIf {
+			return fmt.Errorf("else at 0x%x outside an if", ins.Offset)
+		}
+		if b.cur != nil {
+			b.cur.End = i
+			top.pending = append(top.pending, Edge{From: b.cur.Index, Kind: EdgeFallthrough})
+		}
+		b.cur = nil
+		b.split(i)
+		b.edge(top.cond, b.cur.Index, EdgeIfFalse, 0)
+		top.hasElse = true
+		return nil
+
+	case wasm.OpEnd:
+		b.frames = b.frames[:len(b.frames)-1]
+		if top.kind == frameIf && !top.hasElse {
+			top.pending = append(top.pending, Edge{From: top.cond.Index, Kind: EdgeIfFalse})
+		}
+		switch {
+		case top.kind == frameFunc:
+			if b.cur == nil {
+				b.split(i)
+			}
+			b.edge(b.cur, -1, EdgeFallthrough, 0)
+			b.terminate(i)
+		case len(top.pending) > 0:
+			join := b.split(i)
+			for _, e := range top.pending {
+				e.To = join.Index
+				from := b.g.Blocks[e.From]
+				from.Succs = append(from.Succs, e)
+			}
+		case b.cur == nil:
+			b.split(i)
+		}
+		return nil
+	}
+
+	if b.cur == nil {
+		// Dead code after a branch gets a block without predecessors.
+		b.split(i)
+	}
+	switch ins.Opcode {
+	case wasm.OpBlock:
+		b.frames = append(b.frames, &frame{kind: frameBlock})
+
+	case wasm.OpIf:
+		cond := b.cur
+		b.terminate(i)
+		b.frames = append(b.frames, &frame{kind: frameIf, cond: cond})
+		b.split(i + 1)
+		b.edge(cond, b.cur.Index, EdgeIfTrue, 0)
+
+	case wasm.OpBr:
+		if err := b.branch(ins.Index(), EdgeBr, 0); err != nil {
+			return err
+		}
+		b.terminate(i)
+
+	case wasm.OpBrIf:
+		if err := b.branch(ins.Index(), EdgeBrIfTrue, 0); err != nil {
+			return err
+		}
+		from := b.cur
+		b.terminate(i)
+		b.split(i + 1)
+		b.edge(from, b.cur.Index, EdgeBrIfFalse, 0)
+
+	case wasm.OpBrTable:
+		labels := ins.Labels()
+		for n, depth := range labels {
+			c := n
+			if n == len(labels)-1 {
+				c = DefaultCase
+			}
+			if err := b.branch(depth, EdgeBrTable, c); err != nil {
+				return err
+			}
+		}
+		b.terminate(i)
+
+	case wasm.OpReturn:
+		b.edge(b.cur, -1, EdgeReturn, 0)
+		b.terminate(i)
+
+	case wasm.OpUnreachable:
+		b.edge(b.cur, -1, EdgeUnreachable, 0)
+		b.terminate(i)
+	}
+	return nil
+}
+
+// String lists the blocks with their instructions and successors.
+func (g *Graph) String() string {
+	var sb strings.Builder
+	for _, b := range g.Blocks {
+		if b.Index == g.Exit {
+			fmt.Fprintf(&sb, "B%d exit\n", b.Index)
+			continue
+		}
+		fmt.Fprintf(&sb, "B%d", b.Index)
+		if !g.Reachable(b.Index) {
+			sb.WriteString(" (unreachable)")
+		}
+		if l := g.LoopOf[b.Index]; l >= 0 {
+			if g.Loops[l].Header == b.Index {
+				fmt.Fprintf(&sb, " loop header, depth %d", g.Loops[l].Depth)
+			} else {
+				fmt.Fprintf(&sb, " in loop B%d", g.Loops[l].Header)
+			}
+		}
+		sb.WriteByte('\n')
+		for _, ins := range g.Instructions(b) {
+			fmt.Fprintf(&sb, "  %08x: %s", ins.Offset, ins.Name)
+			if ops := ins.Operands(); len(ops) > 0 {
+				sb.WriteString(" " + strings.Join(ops, " "))
+			}
+			sb.WriteByte('\n')
+		}
+		for _, e := range b.Succs {
+			fmt.Fprintf(&sb, "  -> B%d %s", e.To, e.Kind)
+			switch {
+			case e.Kind != EdgeBrTable:
+			case e.Case == DefaultCase:
+				sb.WriteString(" default")
+			default:
+				fmt.Fprintf(&sb, " %d", e.Case)
+			}
+			sb.WriteByte('\n')
+		}
+	}
+	return sb.String()
+}
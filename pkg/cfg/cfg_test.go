@@ -0,0 +1,112 @@
+package cfg
+
+import (
+	"testing"
+
+	"github.com/0xInception/wasmspy/internal/wasmtest"
+)
+
+func succs(b *Block) []Edge {
+	out := make([]Edge, len(b.Succs))
+	for i, e := range b.Succs {
+		out[i] = Edge{To: e.To, Kind: e.Kind, Case: e.Case, From: b.Index}
+	}
+	return out
+}
+
+func checkSuccs(t *testing.T, g *Graph, b int, want ...Edge) {
+	t.Helper()
+	got := succs(g.Blocks[b])
+	if len(got) != len(want) {
+		t.Fatalf("B%d successors %v, want %v", b, got, want)
+	}
+	for i := range want {
+		want[i].From = b
+		if got[i] != want[i] {
+			t.Errorf("B%d successor %d: %+v, want %+v", b, i, got[i], want[i])
+		}
+	}
+}
+
+func TestBuildIfElse(t *testing.T) {
+	rm := wasmtest.Load(t, "control_flow.wasm")
+	g, err := Build(rm.GetFunctionByName("abs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Blocks) != 5 || g.Exit != 4 {
+		t.Fatalf("%d blocks, exit %d", len(g.Blocks), g.Exit)
+	}
+	checkSuccs(t, g, 0, Edge{To: 1, Kind: EdgeIfTrue}, Edge{To: 2, Kind: EdgeIfFalse})
+	checkSuccs(t, g, 1, Edge{To: 3, Kind: EdgeFallthrough})
+	checkSuccs(t, g, 2, Edge{To: 3, Kind: EdgeFallthrough})
+	if g.IDom[3] != 0 || g.IPDom[0] != 3 || !g.PostDominates(3, 1) || g.Dominates(1, 3) {
+		t.Errorf("idom %v, ipdom %v", g.IDom, g.IPDom)
+	}
+	if len(g.Loops) != 0 {
+		t.Errorf("loops %v", g.Loops)
+	}
+	if b := g.BlockAt(0x50); b == nil || b.Index != 1 {
+		t.Errorf("block at 0x50: %+v", b)
+	}
+}
+
+func TestBuildLoop(t *testing.T) {
+	rm := wasmtest.Load(t, "control_flow.wasm")
+	g, err := Build(rm.GetFunctionByName("sum_to_n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSuccs(t, g, 1, Edge{To: 2, Kind: EdgeBrIfFalse}, Edge{To: 4, Kind: EdgeBrIfTrue})
+	checkSuccs(t, g, 2, Edge{To: 1, Kind: EdgeBr})
+	if len(g.Loops) != 1 {
+		t.Fatalf("loops %v", g.Loops)
+	}
+	l := g.Loops[0]
+	if l.Header != 1 || len(l.Latches) != 1 || l.Latches[0] != 2 || len(l.Blocks) != 2 || l.Depth != 1 {
+		t.Errorf("loop %+v", l)
+	}
+	if g.LoopOf[2] != 0 || g.LoopOf[4] != -1 {
+		t.Errorf("loop of %v", g.LoopOf)
+	}
+	// The end of the loop follows its back edge and is dead.
+	if g.Reachable(3) || len(g.Blocks[3].Preds) != 0 {
+		t.Errorf("B3 reachable: %+v", g.Blocks[3])
+	}
+}
+
+// TestBuildBrTable builds
+//
+//	block
+//	  block
+//	    local.get 0
+//	    br_table 0 1
+//	  end
+//	  unreachable
+//	end
+//	i32.const 7
+func TestBuildBrTable(t *testing.T) {
+	rm := wasmtest.Module(t,
+		wasmtest.Section(0x01, 0x01, 0x60, 0x01, 0x7f, 0x01, 0x7f),
+		wasmtest.Section(0x03, 0x01, 0x00),
+		wasmtest.Code(wasmtest.Body(0x00,
+			0x02, 0x40, 0x02, 0x40, 0x20, 0x00, 0x0e, 0x01, 0x00, 0x01, 0x0b,
+			0x00, 0x0b, 0x41, 0x07, 0x0b)),
+	)
+	g, err := Build(rm.GetFunction(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Blocks) != 4 {
+		t.Fatalf("%d blocks", len(g.Blocks))
+	}
+	checkSuccs(t, g, 0, Edge{To: 1, Kind: EdgeBrTable, Case: 0}, Edge{To: 2, Kind: EdgeBrTable, Case: DefaultCase})
+	checkSuccs(t, g, 1, Edge{To: 3, Kind: EdgeUnreachable})
+	checkSuccs(t, g, 2, Edge{To: 3, Kind: EdgeFallthrough})
+	if b := g.Blocks[1]; b.Start != 4 || b.End != 6 {
+		t.Errorf("B1 spans [%d, %d)", b.Start, b.End)
+	}
+	if g.IPDom[0] != 3 || g.IDom[3] != 0 {
+		t.Errorf("idom %v, ipdom %v", g.IDom, g.IPDom)
+	}
+}
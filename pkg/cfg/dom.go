@@ -0,0 +1,221 @@
+package cfg
+
+import "sort"
+
+// dominators computes immediate dominators with the iterative algorithm of
+// Cooper, Harvey and Kennedy. With reverse set it computes immediate
+// post-dominators, walking from the exit over reversed edges.
+func dominators(g *Graph, reverse bool) []int {
+	n := len(g.Blocks)
+	root := g.Entry
+	succs := func(b int) []int {
+		var out []int
+		for _, e := range g.Blocks[b].Succs {
+			out = append(out, e.To)
+		}
+		return out
+	}
+	preds := func(b int) []int {
+		var out []int
+		for _, e := range g.Blocks[b].Preds {
+			out = append(out, e.From)
+		}
+		return out
+	}
+	if reverse {
+		root = g.Exit
+		succs, preds = preds, succs
+	}
+
+	order := postorder(n, root, succs)
+	po := make([]int, n)
+	idom := make([]int, n)
+	for i := range po {
+		po[i], idom[i] = -1, -1
+	}
+	for i, b := range order {
+		po[b] = i
+	}
+	intersect := func(a, b int) int {
+		for a != b {
+			for po[a] < po[b] {
+				a = idom[a]
+			}
+			for po[b] < po[a] {
+				b = idom[b]
+			}
+		}
+		return a
+	}
+
+	idom[root] = root
+	for changed := true; changed; {
+		changed = false
+		for i := len(order) - 1; i >= 0; i-- {
+			b := order[i]
+			if b == root {
+				continue
+			}
+			d := -1
+			for _, p := range preds(b) {
+				if idom[p] < 0 {
+					continue
+				}
+				if d < 0 {
+					d = p
+				} else {
+					d = intersect(p, d)
+				}
+			}
+			if idom[b] != d {
+				idom[b] = d
+				changed = true
+			}
+		}
+	}
+	idom[root] = -1
+	return idom
+}
+
+// postorder lists the blocks reachable from root in depth-first postorder.
+func postorder(n, root int, succs func(int) []int) []int {
+	type item struct {
+		b    int
+		next []int
+	}
+	seen := make([]bool, n)
+	seen[root] = true
+	stack := []item{{root, succs(root)}}
+	var order []int
+	for len(stack) > 0 {
+		top := &stack[len(stack)-1]
+		if len(top.next) == 0 {
+			order = append(order, top.b)
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		s := top.next[0]
+		top.next = top.next[1:]
+		if !seen[s] {
+			seen[s] = true
+			stack = append(stack, item{s, succs(s)})
+		}
+	}
+	return order
+}
+
+// Dominates reports whether block a dominates block b. Every block
+// dominates itself; unreachable blocks are dominated by nothing else.
+func (g *Graph) Dominates(a, b int) bool {
+	return above(g.IDom, a, b)
+}
+
+// PostDominates reports whether every path from block b to the exit passes
+// through block a.
+func (g *Graph) PostDominates(a, b int) bool {
+	return above(g.IPDom, a, b)
+}
+
+func above(tree []int, a, b int) bool {
+	for ; b >= 0; b = tree[b] {
+		if b == a {
+			return true
+		}
+	}
+	return false
+}
+
+// Loop is a natural loop: the blocks that can reach one of its back edges
+// without passing through its header.
+type Loop struct {
+	Header int
+	// Latches are the sources of the back edges to the header.
+	Latches []int
+	Blocks  []int
+	// Parent is the index in Graph.Loops of the innermost enclosing loop,
+	// or -1; Depth is 1 for outermost loops.
+	Parent int
+	Depth  int
+}
+
+// Contains reports whether block b belongs to the loop.
+func (l *Loop) Contains(b int) bool {
+	i := sort.SearchInts(l.Blocks, b)
+	return i < len(l.Blocks) && l.Blocks[i] == b
+}
+
+// findLoops finds the natural loops of g from the back edges of its
+// dominator tree and nests them. Structured control flow is reducible, so
+// two loops are either nested or disjoint.
+func findLoops(g *Graph) {
+	byHeader := make(map[int]*Loop)
+	for _, blk := range g.Blocks {
+		for _, e := range blk.Succs {
+			if !g.Reachable(e.From) || !g.Dominates(e.To, e.From) {
+				continue
+			}
+			l := byHeader[e.To]
+			if l == nil {
+				l = &Loop{Header: e.To, Parent: -1}
+				byHeader[e.To] = l
+				g.Loops = append(g.Loops, l)
+			}
+			l.Latches = append(l.Latches, e.From)
+		}
+	}
+	sort.Slice(g.Loops, func(i, j int) bool { return g.Loops[i].Header < g.Loops[j].Header })
+
+	for _, l := range g.Loops {
+		in := map[int]bool{l.Header: true}
+		work := append([]int(nil), l.Latches...)
+		for len(work) > 0 {
+			b := work[len(work)-1]
+			work = work[:len(work)-1]
+			if in[b] {
+				continue
+			}
+			in[b] = true
+			for _, e := range g.Blocks[b].Preds {
+				if g.Reachable(e.From) {
+					work = append(work, e.From)
+				}
+			}
+		}
+		for b := range in {
+			l.Blocks = append(l.Blocks, b)
+		}
+		sort.Ints(l.Blocks)
+	}
+
+	g.LoopOf = make([]int, len(g.Blocks))
+	for i := range g.LoopOf {
+		g.LoopOf[i] = -1
+	}
+	// The innermost loop around a block is the smallest one containing it.
+	for i, l := range g.Loops {
+		for _, b := range l.Blocks {
+			if cur := g.LoopOf[b]; cur < 0 || len(g.Loops[cur].Blocks) > len(l.Blocks) {
+				g.LoopOf[b] = i
+			}
+		}
+	}
+	for i, l := range g.Loops {
+		for j, outer := range g.Loops {
+			if i == j || !outer.Contains(l.Header) || len(outer.Blocks) <= len(l.Blocks) {
+				continue
+			}
+			if l.Parent < 0 || len(g.Loops[l.Parent].Blocks) > len(outer.Blocks) {
+				l.Parent = j
+			}
+		}
+	}
+	for _, l := range g.Loops {
+		for p := l; p != nil; {
+			l.Depth++
+			if p.Parent < 0 {
+				break
+			}
+			p = g.Loops[p.Parent]
+		}
+	}
+}
@@ -0,0 +1,281 @@
+// Package debug drives an interpreter instance under debugger control:
+// breakpoints by instruction offset, stepping and inspection of the paused
+// frame.
+package debug
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/0xInception/wasmspy/pkg/interp"
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+var (
+	// ErrStopped is the result error of a session ended with Stop.
+	ErrStopped = errors.New("debug session stopped")
+	// ErrNotPaused is returned by commands that need a paused session.
+	ErrNotPaused = errors.New("execution is not paused")
+)
+
+type Reason string
+
+const (
+	ReasonEntry      Reason = "entry"
+	ReasonBreakpoint Reason = "breakpoint"
+	ReasonStep       Reason = "step"
+	ReasonPause      Reason = "pause"
+)
+
+// State is a snapshot of a paused session. Locals and Stack are copies;
+// CallStack is innermost first with the current offset in its first frame.
+type State struct {
+	Reason    Reason
+	Func      uint32
+	PC        int
+	Offset    uint64
+	Instr     *wasm.Instruction
+	Locals    []uint64
+	Stack     []uint64
+	CallStack []interp.Frame
+}
+
+type mode int
+
+const (
+	modeContinue mode = iota
+	modeStepIn
+	modeStepOver
+	modeStepOut
+)
+
+type command struct {
+	mode mode
+	stop bool
+}
+
+// Session runs one call of a function under debugger control. Execution
+// happens on its own goroutine; the session pauses before the first
+// instruction and reports every pause and the final result through the
+// callbacks, which run on the execution goroutine.
+type Session struct {
+	Inst *interp.Instance
+
+	OnPause func(s *State)
+	OnExit  func(results []uint64, err error)
+
+	mu          sync.Mutex
+	breakpoints map[uint64]bool
+	state       *State
+	done        bool
+	results     []uint64
+	err         error
+
+	cmds     chan command
+	pauseReq atomic.Bool
+	stopReq  atomic.Bool
+	finished chan struct{}
+
+	// Only touched on the execution goroutine.
+	mode    mode
+	depth   int
+	started bool
+}
+
+// New prepares a session on inst. Set the callbacks and breakpoints, then
+// call Start.
+func New(inst *interp.Instance) *Session {
+	return &Session{
+		Inst:        inst,
+		breakpoints: make(map[uint64]bool),
+		cmds:        make(chan command),
+		finished:    make(chan struct{}),
+		mode:        modeStepIn,
+	}
+}
+
+// Start begins executing function idx with args.
+func (s *Session) Start(idx uint32, args ...uint64) {
+	s.Inst.Hook = s.hook
+	go func() {
+		results, err := s.Inst.CallFunc(idx, args...)
+		s.Inst.Hook = nil
+		s.mu.Lock()
+		s.done, s.results, s.err = true, results, err
+		s.mu.Unlock()
+		if s.OnExit != nil {
+			s.OnExit(results, err)
+		}
+		close(s.finished)
+	}()
+}
+
+// Wait blocks until the call finishes and returns its outcome.
+func (s *Session) Wait() ([]uint64, error) {
+	<-s.finished
+	return s.results, s.err
+}
+
+func (s *Session) Done() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.done
+}
+
+// State returns the current pause snapshot, or nil while running.
+func (s *Session) State() *State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+func (s *Session) SetBreakpoint(offset uint64, enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if enabled {
+		s.breakpoints[offset] = true
+	} else {
+		delete(s.breakpoints, offset)
+	}
+}
+
+func (s *Session) Breakpoints() []uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	offsets := make([]uint64, 0, len(s.breakpoints))
+	for off := range s.breakpoints {
+		offsets = append(offsets, off)
+	}
+	return offsets
+}
+
+func (s *Session) resume(cmd command) error {
+	s.mu.Lock()
+	if s.state == nil {
+		s.mu.Unlock()
+		return ErrNotPaused
+	}
+	s.state = nil
+	s.mu.Unlock()
+	s.cmds <- cmd
+	return nil
+}
+
+func (s *Session) Continue() error { return s.resume(command{mode: modeContinue}) }
+func (s *Session) StepIn() error   { return s.resume(command{mode: modeStepIn}) }
+func (s *Session) StepOver() error { return s.resume(command{mode: modeStepOver}) }
+func (s *Session) StepOut() error  { return s.resume(command{mode: modeStepOut}) }
+
+// Pause asks a running session to stop at the next instruction.
+func (s *Session) Pause() {
+	s.pauseReq.Store(true)
+}
+
+// Stop aborts the call, whether paused or running. The call finishes with
+// ErrStopped.
+func (s *Session) Stop() {
+	s.stopReq.Store(true)
+	s.resume(command{stop: true})
+}
+
+// ReadMemory copies up to n bytes of memory 0 at addr, clamped to the end
+// of memory, and returns the memory size. It is only allowed while paused
+// or after the call finished, when the memory is not changing.
+func (s *Session) ReadMemory(addr, n uint32) ([]byte, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state == nil && !s.done {
+		return nil, 0, ErrNotPaused
+	}
+	mem := s.Inst.Memory()
+	if mem == nil {
+		return nil, 0, errors.New("module has no memory")
+	}
+	size := len(mem.Data)
+	if uint64(addr) > uint64(size) {
+		return nil, size, errors.New("address outside memory")
+	}
+	end := min(uint64(addr)+uint64(n), uint64(size))
+	return append([]byte(nil), mem.Data[addr:end]...), size, nil
+}
+
+// Globals copies the current global values, under the same conditions as
+// ReadMemory.
+func (s *Session) Globals() ([]uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state == nil && !s.done {
+		return nil, ErrNotPaused
+	}
+	values := make([]uint64, len(s.Inst.Globals))
+	for i, g := range s.Inst.Globals {
+		values[i] = g.Value
+	}
+	return values, nil
+}
+
+func (s *Session) pauseReason(step *interp.Step) Reason {
+	if s.pauseReq.Swap(false) {
+		return ReasonPause
+	}
+	s.mu.Lock()
+	bp := s.breakpoints[step.Instr.Offset]
+	s.mu.Unlock()
+	if bp {
+		return ReasonBreakpoint
+	}
+	switch s.mode {
+	case modeStepIn:
+		return ReasonStep
+	case modeStepOver:
+		if step.Depth <= s.depth {
+			return ReasonStep
+		}
+	case modeStepOut:
+		if step.Depth < s.depth {
+			return ReasonStep
+		}
+	}
+	return ""
+}
+
+func (s *Session) hook(step *interp.Step) error {
+	if s.stopReq.Load() {
+		return ErrStopped
+	}
+	reason := s.pauseReason(step)
+	if reason == "" {
+		return nil
+	}
+	if !s.started {
+		s.started = true
+		if reason == ReasonStep {
+			reason = ReasonEntry
+		}
+	}
+
+	state := &State{
+		Reason:    reason,
+		Func:      step.Func,
+		PC:        step.PC,
+		Offset:    step.Instr.Offset,
+		Instr:     step.Instr,
+		Locals:    append([]uint64(nil), step.Locals...),
+		Stack:     append([]uint64(nil), step.Stack...),
+		CallStack: s.Inst.CallStack(),
+	}
+	s.mu.Lock()
+	s.state = state
+	s.mu.Unlock()
+	if s.OnPause != nil {
+		s.OnPause(state)
+	}
+
+	cmd := <-s.cmds
+	if cmd.stop {
+		return ErrStopped
+	}
+	s.mode, s.depth = cmd.mode, step.Depth
+	return nil
+}
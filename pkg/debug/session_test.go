@@ -0,0 +1,101 @@
+package debug
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/0xInception/wasmspy/internal/wasmtest"
+	"github.com/0xInception/wasmspy/pkg/interp"
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+func startSession(t *testing.T, name, export string, args ...uint64) (*Session, *wasm.ResolvedModule, chan *State) {
+	t.Helper()
+	rm := wasmtest.Load(t, name)
+	inst, err := interp.Instantiate(rm, nil)
+	if err != nil {
+		t.Fatalf("instantiate: %v", err)
+	}
+	pauses := make(chan *State, 1)
+	s := New(inst)
+	s.OnPause = func(st *State) { pauses <- st }
+	s.Start(rm.GetFunctionByName(export).Index, args...)
+	return s, rm, pauses
+}
+
+func nextPause(t *testing.T, pauses chan *State) *State {
+	t.Helper()
+	select {
+	case st := <-pauses:
+		return st
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for pause")
+	}
+	return nil
+}
+
+func TestBreakpointsAndStepping(t *testing.T) {
+	s, rm, pauses := startSession(t, "control_flow.wasm", "sum_to_n", 3)
+	body := rm.GetFunctionByName("sum_to_n").Body
+
+	entry := nextPause(t, pauses)
+	if entry.Reason != ReasonEntry || entry.PC != 0 {
+		t.Fatalf("expected entry pause at pc 0, got %s at %d", entry.Reason, entry.PC)
+	}
+	if entry.Locals[0] != 3 {
+		t.Errorf("param = %d, want 3", entry.Locals[0])
+	}
+
+	if err := s.StepIn(); err != nil {
+		t.Fatal(err)
+	}
+	step := nextPause(t, pauses)
+	if step.Reason != ReasonStep || step.PC != 1 || len(step.Stack) != 1 {
+		t.Errorf("after step: %s pc %d stack %v", step.Reason, step.PC, step.Stack)
+	}
+
+	// Break on the local.set that stores the running sum.
+	var bp uint64
+	for i, ins := range body.Instructions {
+		if ins.Opcode == wasm.OpLocalSet && ins.Imm.Index == 1 && i > 2 {
+			bp = ins.Offset
+		}
+	}
+	s.SetBreakpoint(bp, true)
+
+	hits := 0
+	for {
+		if err := s.Continue(); err != nil {
+			t.Fatal(err)
+		}
+		if hits == 3 {
+			break
+		}
+		st := nextPause(t, pauses)
+		if st.Reason != ReasonBreakpoint || st.Offset != bp {
+			t.Fatalf("unexpected pause %s at 0x%x", st.Reason, st.Offset)
+		}
+		hits++
+	}
+
+	results, err := s.Wait()
+	if err != nil || len(results) != 1 || results[0] != 3 {
+		t.Errorf("result %v, %v", results, err)
+	}
+	if err := s.Continue(); !errors.Is(err, ErrNotPaused) {
+		t.Errorf("continue after exit: %v", err)
+	}
+}
+
+func TestStop(t *testing.T) {
+	s, _, pauses := startSession(t, "control_flow.wasm", "abs", 5)
+	nextPause(t, pauses)
+	if b, size, err := s.ReadMemory(0, 4); err != nil || len(b) != 4 || size != 65536 {
+		t.Errorf("read memory while paused: %v", err)
+	}
+	s.Stop()
+	if _, err := s.Wait(); !errors.Is(err, ErrStopped) {
+		t.Errorf("expected ErrStopped, got %v", err)
+	}
+}
@@ -49,11 +49,15 @@ type UnaryExpr struct {
 	Type wasm.ValType
 }
 
+// CallExpr is a call. A call_indirect has FuncIndex 0xFFFFFFFF, the
+// element index as Args[0], and the table and type index it names.
 type CallExpr struct {
 	FuncIndex uint32
 	FuncName  string
 	Args      []Expr
 	Type      wasm.ValType
+	Table     uint32
+	TypeIndex uint32
 }
 
 type LoadExpr struct {
@@ -125,20 +129,64 @@ type SwitchCase struct {
 	Body  []Stmt
 }
 
+// FlatSwitchStmt is a br_table with the blocks it branches out of lifted
+// into its cases. Cases do not fall through, and a BreakStmt of Label, the
+// outermost of those blocks, leaves the switch.
 type FlatSwitchStmt struct {
+	Label   int
 	Value   Expr
 	Cases   []SwitchCase
 	Default []Stmt
 	Offsets []uint64
 }
 
+// WhileStmt, DoWhileStmt and ForStmt are loops recovered from loop
+// blocks. Label names the loop for the BreakStmt and ContinueStmt that
+// target it.
 type WhileStmt struct {
+	Label   int
 	Cond    Expr
 	Body    []Stmt
 	Offsets []uint64
 }
 
+type DoWhileStmt struct {
+	Label   int
+	Body    []Stmt
+	Cond    Expr
+	Offsets []uint64
+}
+
+// ForStmt is a while loop whose induction variable is set by Init before
+// it and stepped by Post at the end of every iteration, including those
+// left by a continue.
+type ForStmt struct {
+	Label   int
+	Init    *AssignStmt
+	Cond    Expr
+	Post    *AssignStmt
+	Body    []Stmt
+	Offsets []uint64
+}
+
 type ContinueStmt struct {
+	Label   int
+	Offsets []uint64
+}
+
+// GotoStmt jumps to the LabelStmt with its Label, which follows it in the
+// statement list holding it or in one enclosing that. It is what a branch
+// out of a block becomes when the block has no structured form.
+type GotoStmt struct {
+	Label     int
+	Cond      Expr
+	SrcOffset uint64
+	Offsets   []uint64
+}
+
+// LabelStmt marks where the block Label ended.
+type LabelStmt struct {
+	Label   int
 	Offsets []uint64
 }
 
@@ -188,7 +236,11 @@ func (*DropStmt) node()    {}
 func (*SwitchStmt) node()     {}
 func (*FlatSwitchStmt) node() {}
 func (*WhileStmt) node()      {}
+func (*DoWhileStmt) node()    {}
+func (*ForStmt) node()        {}
 func (*ContinueStmt) node()   {}
+func (*GotoStmt) node()       {}
+func (*LabelStmt) node()      {}
 func (*ErrorStmt) node()      {}
 
 func (*AssignStmt) stmt()  {}
@@ -199,5 +251,9 @@ func (*DropStmt) stmt()    {}
 func (*SwitchStmt) stmt()     {}
 func (*FlatSwitchStmt) stmt() {}
 func (*WhileStmt) stmt()      {}
+func (*DoWhileStmt) stmt()    {}
+func (*ForStmt) stmt()        {}
 func (*ContinueStmt) stmt()   {}
+func (*GotoStmt) stmt()       {}
+func (*LabelStmt) stmt()      {}
 func (*ErrorStmt) stmt()      {}
@@ -7,15 +7,22 @@ import (
 	"github.com/0xInception/wasmspy/pkg/wasm"
 )
 
+// CallGraph holds the calls between functions. A call_indirect through a
+// constant element index adds an edge to the function in that slot; edges
+// only made that way are reported by Indirect. Calls through a computed
+// index could reach any function of the type and add no edges.
 type CallGraph struct {
 	Callers map[uint32][]uint32
 	Callees map[uint32][]uint32
+
+	edges map[[2]uint32]bool
 }
 
 func BuildCallGraph(module *wasm.ResolvedModule) *CallGraph {
 	cg := &CallGraph{
 		Callers: make(map[uint32][]uint32),
 		Callees: make(map[uint32][]uint32),
+		edges:   make(map[[2]uint32]bool),
 	}
 
 	for i := range module.Functions {
@@ -24,10 +31,18 @@ func BuildCallGraph(module *wasm.ResolvedModule) *CallGraph {
 			continue
 		}
 
-		for _, instr := range fn.Body.Instructions {
-			if instr.Opcode == wasm.OpCall {
-				callee := getU32(instr.Immediates, 0)
-				cg.addEdge(uint32(fn.Index), callee)
+		for i, instr := range fn.Body.Instructions {
+			switch instr.Opcode {
+			case wasm.OpCall:
+				cg.addEdge(fn.Index, instr.Index(), false)
+			case wasm.OpCallIndirect:
+				if i == 0 || fn.Body.Instructions[i-1].Opcode != wasm.OpI32Const {
+					continue
+				}
+				elem := &ConstExpr{Value: fn.Body.Instructions[i-1].ConstValue(), Type: wasm.ValI32}
+				for _, callee := range IndirectTargets(module, instr.Index2(), instr.Index(), elem) {
+					cg.addEdge(fn.Index, callee, true)
+				}
 			}
 		}
 	}
@@ -35,16 +50,22 @@ func BuildCallGraph(module *wasm.ResolvedModule) *CallGraph {
 	return cg
 }
 
-func (cg *CallGraph) addEdge(caller, callee uint32) {
-	for _, c := range cg.Callees[caller] {
-		if c == callee {
-			return
-		}
+func (cg *CallGraph) addEdge(caller, callee uint32, indirect bool) {
+	key := [2]uint32{caller, callee}
+	if was, ok := cg.edges[key]; ok {
+		cg.edges[key] = was && indirect
+		return
 	}
+	cg.edges[key] = indirect
 	cg.Callees[caller] = append(cg.Callees[caller], callee)
 	cg.Callers[callee] = append(cg.Callers[callee], caller)
 }
 
+// Indirect reports whether caller only reaches callee through call_indirect.
+func (cg *CallGraph) Indirect(caller, callee uint32) bool {
+	return cg.edges[[2]uint32{caller, callee}]
+}
+
 func (cg *CallGraph) Roots(module *wasm.ResolvedModule) []uint32 {
 	var roots []uint32
 	for i := range module.Functions {
@@ -90,6 +111,9 @@ func (cg *CallGraph) String(module *wasm.ResolvedModule) string {
 			} else {
 				b.WriteString(fmt.Sprintf("func_%d", callee))
 			}
+			if cg.Indirect(uint32(fn.Index), callee) {
+				b.WriteString(" (indirect)")
+			}
 		}
 		b.WriteString("\n")
 	}
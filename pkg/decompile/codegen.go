@@ -3,6 +3,7 @@ package decompile
 import (
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/0xInception/wasmspy/pkg/wasm"
@@ -21,6 +22,17 @@ type DecompileResult struct {
 type codegenCtx struct {
 	names     *NameResolver
 	numParams int
+	module    *wasm.ResolvedModule
+	types     *FuncTypes
+	funcIdx   uint32
+	structs   *StructSet
+	frame     *StackFrame
+	// labeled is the loops and switches printed with their label, scopes
+	// those around the statement being printed and gotos the labels of
+	// blocks left as goto targets.
+	labeled map[int]bool
+	scopes  []jumpScope
+	gotos   map[int]bool
 }
 
 func Decompile(fn *wasm.ResolvedFunction, module *wasm.ResolvedModule) string {
@@ -29,6 +41,12 @@ func Decompile(fn *wasm.ResolvedFunction, module *wasm.ResolvedModule) string {
 }
 
 func DecompileWithMappings(fn *wasm.ResolvedFunction, module *wasm.ResolvedModule) *DecompileResult {
+	return DecompileWithStructs(fn, module, nil)
+}
+
+// DecompileWithStructs decompiles fn showing the locals structs points to
+// as struct pointers and their accesses as fields.
+func DecompileWithStructs(fn *wasm.ResolvedFunction, module *wasm.ResolvedModule, structs *StructSet) *DecompileResult {
 	numParams := 0
 	if fn.Type != nil {
 		numParams = len(fn.Type.Params)
@@ -37,6 +55,9 @@ func DecompileWithMappings(fn *wasm.ResolvedFunction, module *wasm.ResolvedModul
 	ctx := &codegenCtx{
 		names:     NewNameResolver(module, uint32(fn.Index)),
 		numParams: numParams,
+		module:    module,
+		funcIdx:   uint32(fn.Index),
+		structs:   structs,
 	}
 
 	mc := &mappingCodegen{
@@ -54,13 +75,24 @@ func DecompileWithMappings(fn *wasm.ResolvedFunction, module *wasm.ResolvedModul
 		}
 	}
 
-	mc.writeLineWithOffsets(formatSignature(fn, ctx)+" {", []uint64{funcStartOffset})
+	body := BuildBody(fn, module)
+	ctx.types = inferTypes(fn, module, body, true)
+	ctx.frame = RecoverFrame(fn, module, body)
+	ctx.labeled = labeledLoops(body.Stmts)
+	ctx.gotos = gotoLabels(body.Stmts)
 
-	body := BuildStatements(fn, module)
-	SimplifyBody(body)
-	RecoverLoops(body)
-	RecoverIfElse(body)
-	CollapseSwitchBlocks(body)
+	mc.writeLineWithOffsets(formatSignature(fn, ctx)+" {", []uint64{funcStartOffset})
+	for i := numParams; i < len(ctx.types.Locals); i++ {
+		if ctx.types.Used[i] && !ctx.frame.owns(uint32(i)) {
+			decl := fmt.Sprintf("  %s %s", ctx.localType(uint32(i), ""), ctx.names.Local(uint32(i), numParams))
+			mc.writeLineWithOffsets(decl, []uint64{funcStartOffset})
+		}
+	}
+	if ctx.frame != nil {
+		for _, slot := range ctx.frame.Slots {
+			mc.writeLineWithOffsets("  "+slot.Decl(), []uint64{funcStartOffset})
+		}
+	}
 	mc.writeBodyMapped(body, 1)
 
 	mc.writeLineWithOffsets("}", []uint64{funcEndOffset})
@@ -116,6 +148,9 @@ func (mc *mappingCodegen) writeBodyMapped(body *FuncBody, indent int) {
 }
 
 func (mc *mappingCodegen) writeStmtMapped(stmt Stmt, indent int) {
+	if mc.ctx.frame.hides(stmt) {
+		return
+	}
 	prefix := strings.Repeat("  ", indent)
 
 	switch s := stmt.(type) {
@@ -123,12 +158,7 @@ func (mc *mappingCodegen) writeStmtMapped(stmt Stmt, indent int) {
 		mc.writeLineWithOffsets(fmt.Sprintf("%s%s = %s", prefix, exprStr(s.Target, mc.ctx), exprStr(s.Value, mc.ctx)), s.Offsets)
 
 	case *StoreStmt:
-		addr := exprStr(s.Addr, mc.ctx)
-		if s.Offset > 0 {
-			mc.writeLineWithOffsets(fmt.Sprintf("%smem[%s + %d] = %s", prefix, addr, s.Offset, exprStr(s.Value, mc.ctx)), s.Offsets)
-		} else {
-			mc.writeLineWithOffsets(fmt.Sprintf("%smem[%s] = %s", prefix, addr, exprStr(s.Value, mc.ctx)), s.Offsets)
-		}
+		mc.writeLineWithOffsets(fmt.Sprintf("%s%s = %s", prefix, memStr(s.Op, s.Addr, s.Offset, mc.ctx), exprStr(s.Value, mc.ctx)), s.Offsets)
 
 	case *CallStmt:
 		mc.writeLineWithOffsets(fmt.Sprintf("%s%s", prefix, callStr(s.Call, mc.ctx)), s.Offsets)
@@ -162,9 +192,7 @@ func (mc *mappingCodegen) writeStmtMapped(stmt Stmt, indent int) {
 
 	case *LoopStmt:
 		mc.writeLineWithOffsets(fmt.Sprintf("%sloop L%d {", prefix, s.Label), []uint64{s.SrcOffset})
-		for _, inner := range s.Body {
-			mc.writeStmtMapped(inner, indent+1)
-		}
+		mc.writeScope(jumpScope{-1, true}, s.Body, indent+1)
 		mc.writeLineWithOffsets(fmt.Sprintf("%s}", prefix), []uint64{s.EndOffset})
 
 	case *BlockStmt:
@@ -176,55 +204,84 @@ func (mc *mappingCodegen) writeStmtMapped(stmt Stmt, indent int) {
 
 	case *BreakStmt:
 		if s.Cond != nil {
-			mc.writeLineWithOffsets(fmt.Sprintf("%sif %s break L%d", prefix, exprStr(s.Cond, mc.ctx), s.Label), s.Offsets)
+			mc.writeLineWithOffsets(fmt.Sprintf("%sif %s %s", prefix, exprStr(s.Cond, mc.ctx), mc.ctx.jumpStr("break", s.Label)), s.Offsets)
 		} else {
-			mc.writeLineWithOffsets(fmt.Sprintf("%sbreak L%d", prefix, s.Label), s.Offsets)
+			mc.writeLineWithOffsets(prefix+mc.ctx.jumpStr("break", s.Label), s.Offsets)
 		}
 
 	case *SwitchStmt:
 		mc.writeLineWithOffsets(fmt.Sprintf("%sswitch %s {", prefix, exprStr(s.Value, mc.ctx)), s.Offsets)
 		for i, label := range s.Cases {
-			mc.writeLineWithOffsets(fmt.Sprintf("%s  case %d: break L%d", prefix, i, label), offsetsWithSubIndex(s.Offsets, i+1))
+			mc.writeLineWithOffsets(fmt.Sprintf("%s  case %d: %s", prefix, i, mc.ctx.caseStr(label)), offsetsWithSubIndex(s.Offsets, i+1))
 		}
-		mc.writeLineWithOffsets(fmt.Sprintf("%s  default: break L%d", prefix, s.Default), offsetsWithSubIndex(s.Offsets, len(s.Cases)+1))
+		mc.writeLineWithOffsets(fmt.Sprintf("%s  default: %s", prefix, mc.ctx.caseStr(s.Default)), offsetsWithSubIndex(s.Offsets, len(s.Cases)+1))
 		mc.writeLineWithOffsets(fmt.Sprintf("%s}", prefix), offsetsWithSubIndex(s.Offsets, len(s.Cases)+2))
 
 	case *FlatSwitchStmt:
-		mc.writeLineWithOffsets(fmt.Sprintf("%sswitch %s {", prefix, exprStr(s.Value, mc.ctx)), s.Offsets)
+		mc.writeLineWithOffsets(fmt.Sprintf("%s%sswitch %s {", prefix, mc.ctx.loopLabel(s.Label), exprStr(s.Value, mc.ctx)), s.Offsets)
 		subIdx := 1
 		for _, c := range s.Cases {
 			mc.writeLineWithOffsets(fmt.Sprintf("%scase %d:", prefix, c.Value), offsetsWithSubIndex(s.Offsets, subIdx))
 			subIdx++
-			for _, inner := range c.Body {
-				mc.writeStmtMapped(inner, indent+1)
-			}
+			mc.writeScope(jumpScope{s.Label, false}, c.Body, indent+1)
 		}
 		if len(s.Default) > 0 {
 			mc.writeLineWithOffsets(fmt.Sprintf("%sdefault:", prefix), offsetsWithSubIndex(s.Offsets, subIdx))
 			subIdx++
-			for _, inner := range s.Default {
-				mc.writeStmtMapped(inner, indent+1)
-			}
+			mc.writeScope(jumpScope{s.Label, false}, s.Default, indent+1)
 		}
 		mc.writeLineWithOffsets(fmt.Sprintf("%s}", prefix), offsetsWithSubIndex(s.Offsets, subIdx))
 
 	case *WhileStmt:
-		mc.writeLineWithOffsets(fmt.Sprintf("%swhile %s {", prefix, exprStr(s.Cond, mc.ctx)), s.Offsets)
-		for _, inner := range s.Body {
-			mc.writeStmtMapped(inner, indent+1)
-		}
+		mc.writeLineWithOffsets(fmt.Sprintf("%s%swhile %s {", prefix, mc.ctx.loopLabel(s.Label), condStr(s.Cond, mc.ctx)), s.Offsets)
+		mc.writeScope(jumpScope{s.Label, true}, s.Body, indent+1)
+		mc.writeLineWithOffsets(fmt.Sprintf("%s}", prefix), s.Offsets)
+
+	case *DoWhileStmt:
+		mc.writeLineWithOffsets(fmt.Sprintf("%s%sdo {", prefix, mc.ctx.loopLabel(s.Label)), s.Offsets)
+		mc.writeScope(jumpScope{s.Label, true}, s.Body, indent+1)
+		mc.writeLineWithOffsets(fmt.Sprintf("%s} while %s", prefix, exprStr(s.Cond, mc.ctx)), s.Offsets)
+
+	case *ForStmt:
+		offsets := append(append(append([]uint64{}, s.Offsets...), s.Init.Offsets...), s.Post.Offsets...)
+		mc.writeLineWithOffsets(fmt.Sprintf("%s%s%s {", prefix, mc.ctx.loopLabel(s.Label), forStr(s, mc.ctx)), offsets)
+		mc.writeScope(jumpScope{s.Label, true}, s.Body, indent+1)
 		mc.writeLineWithOffsets(fmt.Sprintf("%s}", prefix), s.Offsets)
 
 	case *ContinueStmt:
-		mc.writeLineWithOffsets(fmt.Sprintf("%scontinue", prefix), s.Offsets)
+		mc.writeLineWithOffsets(prefix+mc.ctx.jumpStr("continue", s.Label), s.Offsets)
+
+	case *GotoStmt:
+		if s.Cond != nil {
+			mc.writeLineWithOffsets(fmt.Sprintf("%sif %s goto L%d", prefix, exprStr(s.Cond, mc.ctx), s.Label), s.Offsets)
+		} else {
+			mc.writeLineWithOffsets(fmt.Sprintf("%sgoto L%d", prefix, s.Label), s.Offsets)
+		}
+
+	case *LabelStmt:
+		mc.writeLineWithOffsets(fmt.Sprintf("%sL%d:", prefix, s.Label), s.Offsets)
 
 	case *ErrorStmt:
 		mc.writeLine(fmt.Sprintf("%s// ERROR at 0x%x: %s", prefix, s.Offset, s.Message))
 	}
 }
 
+// writeScope writes the body of a loop or switch.
+func (mc *mappingCodegen) writeScope(scope jumpScope, body []Stmt, indent int) {
+	mc.ctx.scopes = append(mc.ctx.scopes, scope)
+	for _, inner := range body {
+		mc.writeStmtMapped(inner, indent)
+	}
+	mc.ctx.scopes = mc.ctx.scopes[:len(mc.ctx.scopes)-1]
+}
+
 func DecompileModule(module *wasm.ResolvedModule) string {
 	var b strings.Builder
+	structs := RecoverStructs(module)
+	for _, s := range structs.Structs {
+		b.WriteString(s.String())
+		b.WriteString("\n")
+	}
 
 	for i, fn := range module.Functions {
 		if fn.Imported {
@@ -233,7 +290,7 @@ func DecompileModule(module *wasm.ResolvedModule) string {
 		if i > 0 {
 			b.WriteString("\n")
 		}
-		b.WriteString(Decompile(&module.Functions[i], module))
+		b.WriteString(DecompileWithStructs(&module.Functions[i], module, structs).Code)
 	}
 
 	return b.String()
@@ -295,7 +352,7 @@ func formatSignature(fn *wasm.ResolvedFunction, ctx *codegenCtx) string {
 				params += ", "
 			}
 			pname := ctx.names.Local(uint32(i), ctx.numParams)
-			params += fmt.Sprintf("%s %s", p.String(), pname)
+			params += fmt.Sprintf("%s %s", ctx.localType(uint32(i), p.String()), pname)
 		}
 	}
 
@@ -324,6 +381,9 @@ func writeBody(b *strings.Builder, body *FuncBody, indent int, ctx *codegenCtx)
 }
 
 func writeStmt(b *strings.Builder, stmt Stmt, indent int, ctx *codegenCtx) {
+	if ctx.frame.hides(stmt) {
+		return
+	}
 	prefix := strings.Repeat("  ", indent)
 
 	switch s := stmt.(type) {
@@ -331,12 +391,7 @@ func writeStmt(b *strings.Builder, stmt Stmt, indent int, ctx *codegenCtx) {
 		b.WriteString(fmt.Sprintf("%s%s = %s\n", prefix, exprStr(s.Target, ctx), exprStr(s.Value, ctx)))
 
 	case *StoreStmt:
-		addr := exprStr(s.Addr, ctx)
-		if s.Offset > 0 {
-			b.WriteString(fmt.Sprintf("%smem[%s + %d] = %s\n", prefix, addr, s.Offset, exprStr(s.Value, ctx)))
-		} else {
-			b.WriteString(fmt.Sprintf("%smem[%s] = %s\n", prefix, addr, exprStr(s.Value, ctx)))
-		}
+		b.WriteString(fmt.Sprintf("%s%s = %s\n", prefix, memStr(s.Op, s.Addr, s.Offset, ctx), exprStr(s.Value, ctx)))
 
 	case *CallStmt:
 		b.WriteString(fmt.Sprintf("%s%s\n", prefix, callStr(s.Call, ctx)))
@@ -370,9 +425,7 @@ func writeStmt(b *strings.Builder, stmt Stmt, indent int, ctx *codegenCtx) {
 
 	case *LoopStmt:
 		b.WriteString(fmt.Sprintf("%sloop L%d {\n", prefix, s.Label))
-		for _, inner := range s.Body {
-			writeStmt(b, inner, indent+1, ctx)
-		}
+		writeScope(b, jumpScope{-1, true}, s.Body, indent+1, ctx)
 		b.WriteString(fmt.Sprintf("%s}\n", prefix))
 
 	case *BlockStmt:
@@ -384,54 +437,122 @@ func writeStmt(b *strings.Builder, stmt Stmt, indent int, ctx *codegenCtx) {
 
 	case *BreakStmt:
 		if s.Cond != nil {
-			b.WriteString(fmt.Sprintf("%sif %s break L%d\n", prefix, exprStr(s.Cond, ctx), s.Label))
+			b.WriteString(fmt.Sprintf("%sif %s %s\n", prefix, exprStr(s.Cond, ctx), ctx.jumpStr("break", s.Label)))
 		} else {
-			b.WriteString(fmt.Sprintf("%sbreak L%d\n", prefix, s.Label))
+			b.WriteString(fmt.Sprintf("%s%s\n", prefix, ctx.jumpStr("break", s.Label)))
 		}
 
 	case *SwitchStmt:
 		b.WriteString(fmt.Sprintf("%sswitch %s {\n", prefix, exprStr(s.Value, ctx)))
 		for i, label := range s.Cases {
-			b.WriteString(fmt.Sprintf("%s  case %d: break L%d\n", prefix, i, label))
+			b.WriteString(fmt.Sprintf("%s  case %d: %s\n", prefix, i, ctx.caseStr(label)))
 		}
-		b.WriteString(fmt.Sprintf("%s  default: break L%d\n", prefix, s.Default))
+		b.WriteString(fmt.Sprintf("%s  default: %s\n", prefix, ctx.caseStr(s.Default)))
 		b.WriteString(fmt.Sprintf("%s}\n", prefix))
 
 	case *FlatSwitchStmt:
-		b.WriteString(fmt.Sprintf("%sswitch %s {\n", prefix, exprStr(s.Value, ctx)))
+		b.WriteString(fmt.Sprintf("%s%sswitch %s {\n", prefix, ctx.loopLabel(s.Label), exprStr(s.Value, ctx)))
 		for _, c := range s.Cases {
 			b.WriteString(fmt.Sprintf("%scase %d:\n", prefix, c.Value))
-			for _, inner := range c.Body {
-				writeStmt(b, inner, indent+1, ctx)
-			}
+			writeScope(b, jumpScope{s.Label, false}, c.Body, indent+1, ctx)
 		}
 		if len(s.Default) > 0 {
 			b.WriteString(fmt.Sprintf("%sdefault:\n", prefix))
-			for _, inner := range s.Default {
-				writeStmt(b, inner, indent+1, ctx)
-			}
+			writeScope(b, jumpScope{s.Label, false}, s.Default, indent+1, ctx)
 		}
 		b.WriteString(fmt.Sprintf("%s}\n", prefix))
 
 	case *WhileStmt:
-		b.WriteString(fmt.Sprintf("%swhile %s {\n", prefix, exprStr(s.Cond, ctx)))
-		for _, inner := range s.Body {
-			writeStmt(b, inner, indent+1, ctx)
-		}
+		b.WriteString(fmt.Sprintf("%s%swhile %s {\n", prefix, ctx.loopLabel(s.Label), condStr(s.Cond, ctx)))
+		writeScope(b, jumpScope{s.Label, true}, s.Body, indent+1, ctx)
+		b.WriteString(fmt.Sprintf("%s}\n", prefix))
+
+	case *DoWhileStmt:
+		b.WriteString(fmt.Sprintf("%s%sdo {\n", prefix, ctx.loopLabel(s.Label)))
+		writeScope(b, jumpScope{s.Label, true}, s.Body, indent+1, ctx)
+		b.WriteString(fmt.Sprintf("%s} while %s\n", prefix, exprStr(s.Cond, ctx)))
+
+	case *ForStmt:
+		b.WriteString(fmt.Sprintf("%s%s%s {\n", prefix, ctx.loopLabel(s.Label), forStr(s, ctx)))
+		writeScope(b, jumpScope{s.Label, true}, s.Body, indent+1, ctx)
 		b.WriteString(fmt.Sprintf("%s}\n", prefix))
 
 	case *ContinueStmt:
-		b.WriteString(fmt.Sprintf("%scontinue\n", prefix))
+		b.WriteString(fmt.Sprintf("%s%s\n", prefix, ctx.jumpStr("continue", s.Label)))
+
+	case *GotoStmt:
+		if s.Cond != nil {
+			b.WriteString(fmt.Sprintf("%sif %s goto L%d\n", prefix, exprStr(s.Cond, ctx), s.Label))
+		} else {
+			b.WriteString(fmt.Sprintf("%sgoto L%d\n", prefix, s.Label))
+		}
+
+	case *LabelStmt:
+		b.WriteString(fmt.Sprintf("%sL%d:\n", prefix, s.Label))
 
 	case *ErrorStmt:
 		b.WriteString(fmt.Sprintf("%s// ERROR at 0x%x: %s\n", prefix, s.Offset, s.Message))
 	}
 }
 
+func writeScope(b *strings.Builder, scope jumpScope, body []Stmt, indent int, ctx *codegenCtx) {
+	ctx.scopes = append(ctx.scopes, scope)
+	for _, inner := range body {
+		writeStmt(b, inner, indent, ctx)
+	}
+	ctx.scopes = ctx.scopes[:len(ctx.scopes)-1]
+}
+
+// jumpStr renders a break or continue of label, naming the label unless it
+// is the innermost loop.
+func (ctx *codegenCtx) jumpStr(keyword string, label int) string {
+	if bareJump(ctx.scopes, label, keyword == "continue") {
+		return keyword
+	}
+	return fmt.Sprintf("%s L%d", keyword, label)
+}
+
+// caseStr renders the branch of a br_table case to label.
+func (ctx *codegenCtx) caseStr(label int) string {
+	if ctx.gotos[label] {
+		return fmt.Sprintf("goto L%d", label)
+	}
+	return fmt.Sprintf("break L%d", label)
+}
+
+// loopLabel is the prefix of the header of a loop or switch a jump names.
+func (ctx *codegenCtx) loopLabel(label int) string {
+	if ctx.labeled[label] {
+		return fmt.Sprintf("L%d: ", label)
+	}
+	return ""
+}
+
+// condStr renders a loop condition, showing a loop that only ends by a
+// break as while true.
+func condStr(e Expr, ctx *codegenCtx) string {
+	if c, ok := e.(*ConstExpr); ok {
+		if n, ok := toInt64(c.Value); ok && n != 0 {
+			return "true"
+		}
+	}
+	return exprStr(e, ctx)
+}
+
+func forStr(s *ForStmt, ctx *codegenCtx) string {
+	return fmt.Sprintf("for %s = %s; %s; %s = %s",
+		exprStr(s.Init.Target, ctx), exprStr(s.Init.Value, ctx),
+		exprStr(s.Cond, ctx),
+		exprStr(s.Post.Target, ctx), exprStr(s.Post.Value, ctx))
+}
+
 func exprStr(e Expr, ctx *codegenCtx) string {
 	if e == nil {
 		return "?"
 	}
+	if offset, ok := ctx.frameOffset(e, 0); ok {
+		return ctx.frame.slotAddr(offset)
+	}
 	switch v := e.(type) {
 	case *LocalExpr:
 		return ctx.names.Local(v.Index, ctx.numParams)
@@ -442,17 +563,16 @@ func exprStr(e Expr, ctx *codegenCtx) string {
 	case *ConstExpr:
 		return fmt.Sprintf("%v", v.Value)
 	case *BinaryExpr:
+		if v.Op == wasm.OpI32Add || v.Op == wasm.OpI32Sub {
+			return fmt.Sprintf("(%s %s %s)", byteStr(v.Left, ctx), opSymbol(v.Op), byteStr(v.Right, ctx))
+		}
 		return fmt.Sprintf("(%s %s %s)", exprStr(v.Left, ctx), opSymbol(v.Op), exprStr(v.Right, ctx))
 	case *UnaryExpr:
 		return fmt.Sprintf("%s(%s)", opName(v.Op), exprStr(v.Arg, ctx))
 	case *CallExpr:
 		return callStr(v, ctx)
 	case *LoadExpr:
-		addr := exprStr(v.Addr, ctx)
-		if v.Offset > 0 {
-			return fmt.Sprintf("mem[%s + %d]", addr, v.Offset)
-		}
-		return fmt.Sprintf("mem[%s]", addr)
+		return memStr(v.Op, v.Addr, v.Offset, ctx)
 	case *TernaryExpr:
 		return fmt.Sprintf("(%s ? %s : %s)", exprStr(v.Cond, ctx), exprStr(v.ThenResult, ctx), exprStr(v.ElseResult, ctx))
 	case *NegExpr:
@@ -465,19 +585,175 @@ func exprStr(e Expr, ctx *codegenCtx) string {
 	return "?"
 }
 
+// minStringRef is the shortest string an i32 constant is shown to point to.
+const minStringRef = 4
+
+// ptrStr renders e, a value used as an address or passed to a call, with
+// the string it points to when it is a constant. Other constants are
+// left alone, as most are plain numbers that happen to hit a string.
+func ptrStr(e Expr, ctx *codegenCtx) string {
+	if c, ok := e.(*ConstExpr); ok {
+		if addr, ok := c.Value.(int32); ok {
+			if str, ok := stringRef(ctx.module, uint32(addr)); ok {
+				return fmt.Sprintf("%v /* %s */", c.Value, strconv.Quote(str))
+			}
+		}
+	}
+	return exprStr(e, ctx)
+}
+
+// stringRef reports the string an i32 constant points to: the start of a
+// NUL-terminated run of printable bytes in memory 0, which is the attached
+// snapshot when there is one.
+func stringRef(module *wasm.ResolvedModule, addr uint32) (string, bool) {
+	if module == nil || addr == 0 {
+		return "", false
+	}
+	mem := module.MemoryData()
+	if uint64(addr) >= uint64(len(mem)) || mem[addr-1] != 0 {
+		return "", false
+	}
+	str, ok := module.ReadCString(addr, 256)
+	if !ok || len(str) < minStringRef {
+		return "", false
+	}
+	for i := 0; i < len(str); i++ {
+		if c := str[i]; (c < 0x20 || c > 0x7e) && c != '\n' && c != '\t' {
+			return "", false
+		}
+	}
+	return str, true
+}
+
+// localType is the type local idx is declared with: the struct it points to,
+// the recovered type, or def.
+func (ctx *codegenCtx) localType(idx uint32, def string) string {
+	if s := ctx.structs.Lookup(ctx.funcIdx, idx); s != nil {
+		return s.Name + "*"
+	}
+	if t, ok := ctx.types.Local(idx); ok {
+		return t.String()
+	}
+	return def
+}
+
+// byteStr renders e, an operand of address arithmetic. A local declared
+// as a pointer to something wider than a byte is cast to u8*, as C would
+// otherwise scale the offset by the size of what it points to.
+func byteStr(e Expr, ctx *codegenCtx) string {
+	if idx, ok := localOf(e); ok && ctx.scaledPtr(idx) {
+		return "(u8*)" + ctx.names.Local(idx, ctx.numParams)
+	}
+	return exprStr(e, ctx)
+}
+
+// scaledPtr reports whether local idx is declared as a pointer to a struct
+// or to a type wider than a byte.
+func (ctx *codegenCtx) scaledPtr(idx uint32) bool {
+	if ctx.structs.Lookup(ctx.funcIdx, idx) != nil {
+		return true
+	}
+	t, ok := ctx.types.Local(idx)
+	return ok && t.Kind == CPtr && t.Elem != nil && t.Elem.Bits > 8
+}
+
+// frameOffset reports the offset into the shadow-stack frame of address e
+// plus offset.
+func (ctx *codegenCtx) frameOffset(e Expr, offset uint32) (uint32, bool) {
+	if ctx.frame == nil {
+		return 0, false
+	}
+	idx, add, ok := addrBase(e)
+	if !ok || idx != ctx.frame.Local || add < 0 {
+		return 0, false
+	}
+	off := uint32(add) + offset
+	return off, ctx.frame.Slot(off) != nil
+}
+
+// memStr renders the memory a load or store accesses: p->field for a field
+// of the size accessed, *p or p[i] through a local pointing to the type
+// accessed, and a cast of the address otherwise.
+func memStr(op wasm.Opcode, addr Expr, offset uint32, ctx *codegenCtx) string {
+	t := memCType(op)
+	if off, ok := ctx.frameOffset(addr, offset); ok {
+		return ctx.frame.slotMem(off, t)
+	}
+	if idx, add, ok := addrBase(addr); ok && add >= 0 {
+		if s := ctx.structs.Lookup(ctx.funcIdx, idx); s != nil {
+			f := s.Field(uint32(add) + offset)
+			if f != nil && (typeSize(f.Type) == 0 || typeSize(f.Type) == uint32(t.Bits/8)) {
+				return ctx.names.Local(idx, ctx.numParams) + "->" + f.Name
+			}
+		}
+	}
+	if idx, ok := localOf(addr); ok && ctx.structs.Lookup(ctx.funcIdx, idx) == nil {
+		if pt, ok := ctx.types.Local(idx); ok && pt.Kind == CPtr && pt.Elem != nil && pt.Elem.equal(t) {
+			name := ctx.names.Local(idx, ctx.numParams)
+			size := uint32(t.Bits / 8)
+			switch {
+			case offset == 0:
+				return "*" + name
+			case offset%size == 0:
+				return fmt.Sprintf("%s[%d]", name, offset/size)
+			}
+		}
+	}
+	if offset > 0 {
+		return fmt.Sprintf("*(%s*)(%s + %d)", t, byteStr(addr, ctx), offset)
+	}
+	return fmt.Sprintf("*(%s*)%s", t, ptrStr(addr, ctx))
+}
+
 func callStr(c *CallExpr, ctx *codegenCtx) string {
-	name := ctx.names.Func(c.FuncIndex)
 	if c.FuncIndex == 0xFFFFFFFF {
-		name = "indirect"
+		return indirectStr(c, ctx)
 	}
-	args := ""
-	for i, arg := range c.Args {
-		if i > 0 {
-			args += ", "
-		}
-		args += exprStr(arg, ctx)
+	return fmt.Sprintf("%s(%s)", ctx.names.Func(c.FuncIndex), argsStr(c.Args, ctx))
+}
+
+// maxTargets is how many candidates of an indirect call are named; beyond
+// that only their number is shown.
+const maxTargets = 8
+
+// indirectStr renders a call_indirect as (table[idx] as (i32)->i32)(args)
+// followed by the functions it can reach.
+func indirectStr(c *CallExpr, ctx *codegenCtx) string {
+	if len(c.Args) == 0 {
+		return "indirect()"
+	}
+	table := "table"
+	if c.Table != 0 {
+		table = fmt.Sprintf("table%d", c.Table)
+	}
+	callee := fmt.Sprintf("%s[%s]", table, exprStr(c.Args[0], ctx))
+	if ctx.module == nil || int(c.TypeIndex) >= len(ctx.module.Types) {
+		return fmt.Sprintf("%s(%s)", callee, argsStr(c.Args[1:], ctx))
+	}
+	call := fmt.Sprintf("(%s as %s)(%s)", callee, sigString(&ctx.module.Types[c.TypeIndex]), argsStr(c.Args[1:], ctx))
+	if ctx.module.TableImage(c.Table) == nil {
+		return call
+	}
+	targets := IndirectTargets(ctx.module, c.Table, c.TypeIndex, c.Args[0])
+	switch {
+	case len(targets) == 0:
+		return call + " /* no targets */"
+	case len(targets) > maxTargets:
+		return fmt.Sprintf("%s /* %d targets */", call, len(targets))
+	}
+	names := make([]string, len(targets))
+	for i, t := range targets {
+		names[i] = ctx.names.Func(t)
+	}
+	return fmt.Sprintf("%s /* targets: %s */", call, strings.Join(names, ", "))
+}
+
+func argsStr(args []Expr, ctx *codegenCtx) string {
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		strs[i] = ptrStr(arg, ctx)
 	}
-	return fmt.Sprintf("%s(%s)", name, args)
+	return strings.Join(strs, ", ")
 }
 
 func offsetsWithSubIndex(offsets []uint64, subIndex int) []uint64 {
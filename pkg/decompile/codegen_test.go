@@ -2,8 +2,10 @@ package decompile
 
 import (
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/0xInception/wasmspy/internal/wasmtest"
 	"github.com/0xInception/wasmspy/pkg/wasm"
 )
 
@@ -114,3 +116,30 @@ func splitLines(s string) []string {
 	}
 	return lines
 }
+
+func TestStringRefFromSnapshot(t *testing.T) {
+	// func 1 is log(42); return 42, with log imported from env.
+	rm := wasmtest.Module(t,
+		wasmtest.Section(0x01, 0x02, 0x60, 0x01, 0x7f, 0x00, 0x60, 0x00, 0x01, 0x7f),
+		wasmtest.Section(0x02, wasmtest.Cat([]byte{0x01}, wasmtest.Name("env"), wasmtest.Name("log"), []byte{0x00, 0x00})...),
+		wasmtest.Section(0x03, 0x01, 0x01),
+		wasmtest.Section(0x05, 0x01, 0x00, 0x01),
+		wasmtest.Code(wasmtest.Body(0x00, 0x41, 0x2a, 0x10, 0x00, 0x41, 0x2a, 0x0b)),
+	)
+
+	fn := rm.GetFunction(1)
+	if strings.Contains(Decompile(fn, rm), "/*") {
+		t.Fatal("unexpected string reference without a snapshot")
+	}
+
+	mem := make([]byte, 64)
+	copy(mem[42:], "secret\x00")
+	rm.AttachSnapshot(&wasm.Snapshot{Memory: mem})
+	result := Decompile(fn, rm)
+	if !strings.Contains(result, `(42 /* "secret" */)`) {
+		t.Errorf("expected string reference in the call, got:\n%s", result)
+	}
+	if !strings.Contains(result, "return 42\n") {
+		t.Errorf("returned constant annotated:\n%s", result)
+	}
+}
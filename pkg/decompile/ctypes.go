@@ -0,0 +1,510 @@
+package decompile
+
+import (
+	"fmt"
+
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+// CKind is the kind of a recovered type.
+type CKind int
+
+const (
+	CInt CKind = iota
+	CBool
+	CFloat
+	CPtr
+)
+
+// CType is a C-like type recovered for a local or a memory access.
+type CType struct {
+	Kind CKind
+	// Bits is the width of an integer or float.
+	Bits     int
+	Unsigned bool
+	// Elem is what a pointer points to, or nil when that is not known.
+	Elem *CType
+}
+
+func (t CType) String() string {
+	switch t.Kind {
+	case CBool:
+		return "bool"
+	case CFloat:
+		return fmt.Sprintf("f%d", t.Bits)
+	case CPtr:
+		if t.Elem == nil {
+			return "void*"
+		}
+		return t.Elem.String() + "*"
+	}
+	if t.Unsigned {
+		return fmt.Sprintf("u%d", t.Bits)
+	}
+	return fmt.Sprintf("i%d", t.Bits)
+}
+
+func (t CType) equal(o CType) bool {
+	if t.Kind != o.Kind || t.Bits != o.Bits || t.Unsigned != o.Unsigned {
+		return false
+	}
+	if t.Elem == nil || o.Elem == nil {
+		return t.Elem == o.Elem
+	}
+	return t.Elem.equal(*o.Elem)
+}
+
+// valCType is the plain type of a value of type t.
+func valCType(t wasm.ValType) CType {
+	switch t {
+	case wasm.ValI64:
+		return CType{Kind: CInt, Bits: 64}
+	case wasm.ValF32:
+		return CType{Kind: CFloat, Bits: 32}
+	case wasm.ValF64:
+		return CType{Kind: CFloat, Bits: 64}
+	}
+	return CType{Kind: CInt, Bits: 32}
+}
+
+// memCType is the type of the memory a load or store accesses. Narrow
+// stores keep the low bits of the value, so they count as unsigned.
+func memCType(op wasm.Opcode) CType {
+	switch op {
+	case wasm.OpI64Load, wasm.OpI64Store:
+		return CType{Kind: CInt, Bits: 64}
+	case wasm.OpF32Load, wasm.OpF32Store:
+		return CType{Kind: CFloat, Bits: 32}
+	case wasm.OpF64Load, wasm.OpF64Store:
+		return CType{Kind: CFloat, Bits: 64}
+	case wasm.OpI32Load8S, wasm.OpI64Load8S:
+		return CType{Kind: CInt, Bits: 8}
+	case wasm.OpI32Load8U, wasm.OpI64Load8U, wasm.OpI32Store8, wasm.OpI64Store8:
+		return CType{Kind: CInt, Bits: 8, Unsigned: true}
+	case wasm.OpI32Load16S, wasm.OpI64Load16S:
+		return CType{Kind: CInt, Bits: 16}
+	case wasm.OpI32Load16U, wasm.OpI64Load16U, wasm.OpI32Store16, wasm.OpI64Store16:
+		return CType{Kind: CInt, Bits: 16, Unsigned: true}
+	case wasm.OpI64Load32S:
+		return CType{Kind: CInt, Bits: 32}
+	case wasm.OpI64Load32U, wasm.OpI64Store32:
+		return CType{Kind: CInt, Bits: 32, Unsigned: true}
+	}
+	return CType{Kind: CInt, Bits: 32}
+}
+
+// opSign reports whether op treats its integer operands as signed (1) or
+// unsigned (-1).
+func opSign(op wasm.Opcode) int {
+	switch op {
+	case wasm.OpI32LtS, wasm.OpI32GtS, wasm.OpI32LeS, wasm.OpI32GeS,
+		wasm.OpI64LtS, wasm.OpI64GtS, wasm.OpI64LeS, wasm.OpI64GeS,
+		wasm.OpI32DivS, wasm.OpI32RemS, wasm.OpI32ShrS,
+		wasm.OpI64DivS, wasm.OpI64RemS, wasm.OpI64ShrS,
+		wasm.OpI64ExtendI32S, wasm.OpF32ConvertI32S, wasm.OpF32ConvertI64S,
+		wasm.OpF64ConvertI32S, wasm.OpF64ConvertI64S:
+		return 1
+	case wasm.OpI32LtU, wasm.OpI32GtU, wasm.OpI32LeU, wasm.OpI32GeU,
+		wasm.OpI64LtU, wasm.OpI64GtU, wasm.OpI64LeU, wasm.OpI64GeU,
+		wasm.OpI32DivU, wasm.OpI32RemU, wasm.OpI32ShrU,
+		wasm.OpI64DivU, wasm.OpI64RemU, wasm.OpI64ShrU,
+		wasm.OpI64ExtendI32U, wasm.OpF32ConvertI32U, wasm.OpF32ConvertI64U,
+		wasm.OpF64ConvertI32U, wasm.OpF64ConvertI64U:
+		return -1
+	}
+	return 0
+}
+
+// isBoolExpr reports whether e is a comparison or a negation, which give 0
+// or 1.
+func isBoolExpr(e Expr) bool {
+	switch e := e.(type) {
+	case *NotExpr:
+		return true
+	case *UnaryExpr:
+		return isCompare(e.Op)
+	case *BinaryExpr:
+		return isCompare(e.Op)
+	}
+	return false
+}
+
+// isCompare reports whether op is one of the eqz and comparison opcodes,
+// which are numbered together.
+func isCompare(op wasm.Opcode) bool {
+	return op >= wasm.OpI32Eqz && op <= wasm.OpF64Ge
+}
+
+// localOf returns the local e reads.
+func localOf(e Expr) (uint32, bool) {
+	switch e := e.(type) {
+	case *LocalExpr:
+		return e.Index, true
+	case *ParamExpr:
+		return e.Index, true
+	}
+	return 0, false
+}
+
+// addrBase splits an address into the local it is based on and a constant
+// added to it.
+func addrBase(e Expr) (uint32, int64, bool) {
+	if idx, ok := localOf(e); ok {
+		return idx, 0, true
+	}
+	if b, ok := e.(*BinaryExpr); ok && (b.Op == wasm.OpI32Add || b.Op == wasm.OpI64Add) {
+		for _, pair := range [][2]Expr{{b.Left, b.Right}, {b.Right, b.Left}} {
+			idx, ok := localOf(pair[0])
+			c, isConst := pair[1].(*ConstExpr)
+			if !ok || !isConst {
+				continue
+			}
+			if n, ok := toInt64(c.Value); ok {
+				return idx, n, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// FuncTypes holds the types recovered for the locals of a function: its
+// parameters, declared locals and then the temporaries of its body.
+type FuncTypes struct {
+	Locals []CType
+	// Used marks the locals the body reads or writes.
+	Used []bool
+}
+
+// Local returns the type of local idx.
+func (t *FuncTypes) Local(idx uint32) (CType, bool) {
+	if t == nil || int(idx) >= len(t.Locals) {
+		return CType{}, false
+	}
+	return t.Locals[idx], true
+}
+
+// localFacts is what the body shows about one local.
+type localFacts struct {
+	ptr   bool
+	elems []CType
+	sign  int
+	// bools and others count the assignments of comparisons and of other
+	// values; loads lists the types of the loads assigned.
+	bools, others int
+	loads         []CType
+}
+
+type typeInference struct {
+	fn     *wasm.ResolvedFunction
+	module *wasm.ResolvedModule
+	types  []wasm.ValType
+	facts  []localFacts
+	used   []bool
+	parent []int
+	// derived are the pairs of locals where the first is assigned the
+	// second plus a constant, so it points into the same memory.
+	derived [][2]int
+	// callees caches the parameter types of the functions called; it is
+	// nil when calls are not looked into.
+	callees map[uint32][]CType
+}
+
+// InferTypes recovers the types of the locals of fn from how its body uses
+// them: loads and stores make pointers, signed and unsigned operations give
+// signedness, locals only assigned comparisons are booleans and arguments
+// take the parameter types of the functions they are passed to.
+func InferTypes(fn *wasm.ResolvedFunction, module *wasm.ResolvedModule) *FuncTypes {
+	return inferTypes(fn, module, BuildBody(fn, module), true)
+}
+
+func inferTypes(fn *wasm.ResolvedFunction, module *wasm.ResolvedModule, body *FuncBody, calls bool) *FuncTypes {
+	ti := &typeInference{fn: fn, module: module}
+	for _, l := range buildLocals(fn) {
+		ti.types = append(ti.types, l.Type)
+	}
+	ti.types = append(ti.types, body.Temps...)
+	ti.facts = make([]localFacts, len(ti.types))
+	ti.used = make([]bool, len(ti.types))
+	ti.parent = make([]int, len(ti.types))
+	for i := range ti.parent {
+		ti.parent[i] = i
+	}
+	if calls {
+		ti.callees = make(map[uint32][]CType)
+	}
+	ti.stmts(body.Stmts)
+	if body.Return != nil {
+		ti.expr(body.Return)
+	}
+	return ti.resolve()
+}
+
+func (ti *typeInference) valid(idx uint32) bool {
+	return int(idx) < len(ti.facts)
+}
+
+func (ti *typeInference) find(i int) int {
+	for ti.parent[i] != i {
+		ti.parent[i] = ti.parent[ti.parent[i]]
+		i = ti.parent[i]
+	}
+	return i
+}
+
+func (ti *typeInference) stmts(list []Stmt) {
+	for _, s := range list {
+		ti.stmt(s)
+	}
+}
+
+func (ti *typeInference) stmt(s Stmt) {
+	switch s := s.(type) {
+	case *AssignStmt:
+		ti.expr(s.Value)
+		if idx, ok := localOf(s.Target); ok && ti.valid(idx) {
+			ti.used[idx] = true
+			ti.assign(idx, s.Value)
+		}
+	case *StoreStmt:
+		ti.access(s.Op, s.Addr, s.Offset)
+		ti.expr(s.Addr)
+		ti.expr(s.Value)
+	case *CallStmt:
+		ti.expr(s.Call)
+	case *ReturnStmt:
+		if s.Value != nil {
+			ti.expr(s.Value)
+		}
+	case *DropStmt:
+		ti.expr(s.Value)
+	case *IfStmt:
+		ti.expr(s.Cond)
+		ti.stmts(s.Then)
+		ti.stmts(s.Else)
+	case *LoopStmt:
+		ti.stmts(s.Body)
+	case *BlockStmt:
+		ti.stmts(s.Body)
+	case *BreakStmt:
+		if s.Cond != nil {
+			ti.expr(s.Cond)
+		}
+	case *GotoStmt:
+		if s.Cond != nil {
+			ti.expr(s.Cond)
+		}
+	case *SwitchStmt:
+		ti.expr(s.Value)
+	case *FlatSwitchStmt:
+		ti.expr(s.Value)
+		for _, c := range s.Cases {
+			ti.stmts(c.Body)
+		}
+		ti.stmts(s.Default)
+	case *WhileStmt:
+		ti.expr(s.Cond)
+		ti.stmts(s.Body)
+	case *DoWhileStmt:
+		ti.stmts(s.Body)
+		ti.expr(s.Cond)
+	case *ForStmt:
+		ti.stmt(s.Init)
+		ti.expr(s.Cond)
+		ti.stmts(s.Body)
+		ti.stmt(s.Post)
+	}
+}
+
+func (ti *typeInference) expr(e Expr) {
+	switch e := e.(type) {
+	case *LocalExpr, *ParamExpr:
+		if idx, _ := localOf(e); ti.valid(idx) {
+			ti.used[idx] = true
+		}
+	case *BinaryExpr:
+		if sign := opSign(e.Op); sign != 0 {
+			ti.vote(e.Left, sign)
+			ti.vote(e.Right, sign)
+		}
+		ti.expr(e.Left)
+		ti.expr(e.Right)
+	case *UnaryExpr:
+		if sign := opSign(e.Op); sign != 0 {
+			ti.vote(e.Arg, sign)
+		}
+		ti.expr(e.Arg)
+	case *LoadExpr:
+		ti.access(e.Op, e.Addr, e.Offset)
+		ti.expr(e.Addr)
+	case *CallExpr:
+		var params []CType
+		if e.FuncIndex != 0xFFFFFFFF {
+			params = ti.calleeParams(e.FuncIndex)
+		}
+		for i, arg := range e.Args {
+			if idx, ok := localOf(arg); ok && ti.valid(idx) && i < len(params) {
+				ti.use(idx, params[i])
+			}
+			ti.expr(arg)
+		}
+	case *TernaryExpr:
+		ti.expr(e.Cond)
+		ti.expr(e.ThenResult)
+		ti.expr(e.ElseResult)
+	case *NegExpr:
+		ti.expr(e.Arg)
+	case *NotExpr:
+		ti.expr(e.Arg)
+	}
+}
+
+func (ti *typeInference) vote(e Expr, sign int) {
+	if idx, ok := localOf(e); ok && ti.valid(idx) {
+		ti.facts[idx].sign += sign
+	}
+}
+
+// access records a load or store through a local. Only an access at the
+// address the local holds tells what it points to.
+func (ti *typeInference) access(op wasm.Opcode, addr Expr, offset uint32) {
+	idx, add, ok := addrBase(addr)
+	if !ok || !ti.valid(idx) || ti.types[idx] != wasm.ValI32 {
+		return
+	}
+	f := &ti.facts[idx]
+	f.ptr = true
+	if add == 0 && offset == 0 {
+		f.elems = append(f.elems, memCType(op))
+	}
+}
+
+// use records local idx being passed where a value of type t is expected.
+func (ti *typeInference) use(idx uint32, t CType) {
+	f := &ti.facts[idx]
+	switch t.Kind {
+	case CPtr:
+		f.ptr = true
+		if t.Elem != nil {
+			f.elems = append(f.elems, *t.Elem)
+		}
+	case CInt:
+		if t.Unsigned {
+			f.sign--
+		}
+	}
+}
+
+func (ti *typeInference) assign(idx uint32, v Expr) {
+	f := &ti.facts[idx]
+	if isBoolExpr(v) {
+		f.bools++
+		return
+	}
+	if c, ok := v.(*ConstExpr); ok {
+		// 0 and 1 fit a boolean as well as a number.
+		if n, ok := toInt64(c.Value); ok && (n == 0 || n == 1) {
+			return
+		}
+	}
+	// A copy adds nothing to what the two locals show, so they are merged.
+	if src, ok := localOf(v); ok && ti.valid(src) && ti.types[src] == ti.types[idx] {
+		a, b := ti.find(int(idx)), ti.find(int(src))
+		if a != b {
+			ti.parent[a] = b
+		}
+		return
+	}
+	f.others++
+	if l, ok := v.(*LoadExpr); ok {
+		f.loads = append(f.loads, memCType(l.Op))
+		return
+	}
+	if src, add, ok := addrBase(v); ok && add != 0 && ti.valid(src) {
+		ti.derived = append(ti.derived, [2]int{int(idx), int(src)})
+	}
+}
+
+// calleeParams returns the parameter types a function's own body shows.
+func (ti *typeInference) calleeParams(idx uint32) []CType {
+	if ti.callees == nil || ti.module == nil {
+		return nil
+	}
+	if params, ok := ti.callees[idx]; ok {
+		return params
+	}
+	ti.callees[idx] = nil
+	fn := ti.module.GetFunction(idx)
+	if fn == nil || fn.Imported || fn.Body == nil || fn.Type == nil {
+		return nil
+	}
+	types := inferTypes(fn, ti.module, BuildBody(fn, ti.module), false)
+	params := types.Locals[:len(fn.Type.Params)]
+	ti.callees[idx] = params
+	return params
+}
+
+func (ti *typeInference) resolve() *FuncTypes {
+	n := len(ti.facts)
+	groups := make([]localFacts, n)
+	for i := range ti.facts {
+		f, g := &ti.facts[i], &groups[ti.find(i)]
+		g.ptr = g.ptr || f.ptr
+		g.elems = append(g.elems, f.elems...)
+		g.sign += f.sign
+		g.bools += f.bools
+		g.others += f.others
+		g.loads = append(g.loads, f.loads...)
+	}
+	// A local holding a pointer plus a constant is a pointer too.
+	for changed := true; changed; {
+		changed = false
+		for _, d := range ti.derived {
+			to, from := &groups[ti.find(d[0])], &groups[ti.find(d[1])]
+			if from.ptr && !to.ptr {
+				to.ptr = true
+				changed = true
+			}
+		}
+	}
+
+	numParams := 0
+	if ti.fn.Type != nil {
+		numParams = len(ti.fn.Type.Params)
+	}
+	types := &FuncTypes{Locals: make([]CType, n), Used: ti.used}
+	for i, vt := range ti.types {
+		g := &groups[ti.find(i)]
+		t := valCType(vt)
+		switch {
+		case t.Kind != CInt:
+		case g.ptr && vt == wasm.ValI32:
+			t = CType{Kind: CPtr, Bits: 32}
+			if elem, ok := common(g.elems); ok {
+				t.Elem = &elem
+			}
+		case vt == wasm.ValI32 && i >= numParams && g.bools > 0 && g.others == 0:
+			t = CType{Kind: CBool}
+		case g.sign == 0 && len(g.loads) == g.others && g.others > 0:
+			if elem, ok := common(g.loads); ok && elem.Kind == CInt {
+				t = elem
+			}
+		default:
+			t.Unsigned = g.sign < 0
+		}
+		types.Locals[i] = t
+	}
+	return types
+}
+
+// common returns the type every entry of list agrees on.
+func common(list []CType) (CType, bool) {
+	if len(list) == 0 {
+		return CType{}, false
+	}
+	for _, t := range list[1:] {
+		if !t.equal(list[0]) {
+			return CType{}, false
+		}
+	}
+	return list[0], true
+}
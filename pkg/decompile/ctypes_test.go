@@ -0,0 +1,87 @@
+package decompile
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/0xInception/wasmspy/internal/wasmtest"
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+// typesModule holds, by index:
+//
+//	0 first(p0):  return load8_u(p0)
+//	1 udiv(p0, p1): return p0 /u p1
+//	2 flag(p0):   v1 = p0 <s 10; return v1 & v1
+//	3 field(p0):  return load16_u(p0 + 4)
+//	4 caller(p0): return first(p0)
+//	5 pair(p0):   return load(p0) + load(p0 + 8)
+//	6 rebase(p0): v1 = p0 - 16; store(v1 + 8, 5); return load(v1 + 8) + load(p0)
+func typesModule(t *testing.T) *wasm.ResolvedModule {
+	t.Helper()
+	return wasmtest.Module(t,
+		wasmtest.Section(0x01, 0x02, 0x60, 0x01, 0x7f, 0x01, 0x7f, 0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7f),
+		wasmtest.Section(0x03, 0x07, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00),
+		wasmtest.Section(0x05, 0x01, 0x00, 0x01),
+		wasmtest.Code(
+			wasmtest.Body(0x00, 0x20, 0x00, 0x2d, 0x00, 0x00, 0x0b),
+			wasmtest.Body(0x00, 0x20, 0x00, 0x20, 0x01, 0x6e, 0x0b),
+			wasmtest.Body(0x01, 0x01, 0x7f, 0x20, 0x00, 0x41, 0x0a, 0x48, 0x21, 0x01, 0x20, 0x01, 0x20, 0x01, 0x71, 0x0b),
+			wasmtest.Body(0x00, 0x20, 0x00, 0x2f, 0x01, 0x04, 0x0b),
+			wasmtest.Body(0x00, 0x20, 0x00, 0x10, 0x00, 0x0b),
+			wasmtest.Body(0x00, 0x20, 0x00, 0x28, 0x02, 0x00, 0x20, 0x00, 0x28, 0x02, 0x08, 0x6a, 0x0b),
+			wasmtest.Body(0x01, 0x01, 0x7f,
+				0x20, 0x00, 0x41, 0x10, 0x6b, 0x21, 0x01,
+				0x20, 0x01, 0x41, 0x05, 0x36, 0x02, 0x08,
+				0x20, 0x01, 0x28, 0x02, 0x08, 0x20, 0x00, 0x28, 0x02, 0x00, 0x6a, 0x0b),
+		),
+	)
+}
+
+func TestInferTypes(t *testing.T) {
+	rm := typesModule(t)
+	tests := []struct {
+		idx  uint32
+		want []string
+	}{
+		{0, []string{"u8*"}},
+		{1, []string{"u32", "u32"}},
+		{2, []string{"i32", "bool"}},
+		{3, []string{"void*"}},
+		{4, []string{"u8*"}},
+		{5, []string{"i32*"}},
+	}
+	for _, tt := range tests {
+		types := InferTypes(rm.GetFunction(tt.idx), rm)
+		for i, w := range tt.want {
+			if got := types.Locals[i].String(); got != w {
+				t.Errorf("func %d local %d: got %s, want %s", tt.idx, i, got, w)
+			}
+		}
+	}
+}
+
+func TestDecompileTypes(t *testing.T) {
+	rm := typesModule(t)
+	tests := []struct {
+		idx  uint32
+		want []string
+	}{
+		{0, []string{"(u8* p0) -> i32", "return *p0"}},
+		{1, []string{"(u32 p0, u32 p1)"}},
+		{2, []string{"  bool v1\n", "v1 = (p0 < 10)"}},
+		{3, []string{"(void* p0)", "return *(u16*)(p0 + 4)"}},
+		{5, []string{"return (*p0 + p0[2])"}},
+		// Arithmetic on a typed pointer counts bytes, not elements.
+		{6, []string{"(i32* p0)", "v1 = ((u8*)p0 - 16)", "*(i32*)(v1 + 8) = 5"}},
+	}
+	for _, tt := range tests {
+		code := Decompile(rm.GetFunction(tt.idx), rm)
+		for _, w := range tt.want {
+			if !strings.Contains(code, w) {
+				t.Errorf("func %d: missing %q in\n%s", tt.idx, w, code)
+			}
+		}
+	}
+	checkEval(t, rm, 6, []uint64{32})
+}
@@ -0,0 +1,560 @@
+package decompile
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/0xInception/wasmspy/pkg/interp"
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+// ErrUnsupported is returned by Eval for bodies it cannot give a meaning
+// to: the decompiler left error nodes in them, or the function returns more
+// than one value.
+var ErrUnsupported = errors.New("unsupported")
+
+// DefaultEvalSteps is the statement budget of Eval when maxSteps is zero.
+const DefaultEvalSteps = 10_000_000
+
+// BuildBody builds the statements of fn and runs the simplification and
+// structuring passes over them, producing the tree the code generator
+// prints.
+func BuildBody(fn *wasm.ResolvedFunction, module *wasm.ResolvedModule) *FuncBody {
+	body := BuildStatements(fn, module)
+	SimplifyBody(body)
+	RecoverLoops(body)
+	RecoverIfElse(body)
+	CollapseSwitchBlocks(body)
+	StructureGotos(body)
+	return body
+}
+
+// Eval runs a decompiled body of fn on inst: memory, globals, tables and
+// callees come from the instance, and every operation is carried out with
+// the interpreter's semantics. The tree is taken literally, so code the
+// decompiler got wrong produces wrong results or an error describing what
+// could not be evaluated; traps are returned as *interp.Trap.
+func Eval(body *FuncBody, fn *wasm.ResolvedFunction, inst *interp.Instance, args []uint64, maxSteps int) ([]uint64, error) {
+	if fn.Type == nil {
+		return nil, fmt.Errorf("function %d has no type", fn.Index)
+	}
+	if len(args) != len(fn.Type.Params) {
+		return nil, fmt.Errorf("function %d takes %d arguments, got %d", fn.Index, len(fn.Type.Params), len(args))
+	}
+	if len(fn.Type.Results) > 1 {
+		return nil, fmt.Errorf("%w: %d results", ErrUnsupported, len(fn.Type.Results))
+	}
+	if maxSteps <= 0 {
+		maxSteps = DefaultEvalSteps
+	}
+	ev := &evaluator{
+		inst:   inst,
+		locals: make([]uint64, len(buildLocals(fn))+len(body.Temps)),
+		steps:  maxSteps,
+	}
+	copy(ev.locals, args)
+
+	c, err := ev.stmts(body.Stmts)
+	if err != nil {
+		return nil, err
+	}
+	var ret Expr
+	switch c.kind {
+	case flowNone:
+		ret = body.Return
+	case flowReturn:
+		ret = c.value
+	case flowBreak:
+		if c.label != 0 {
+			return nil, fmt.Errorf("break to unknown label L%d", c.label)
+		}
+		// A branch to the function's own label returns, but the values it
+		// carries are not in the tree.
+		if len(fn.Type.Results) > 0 {
+			return nil, fmt.Errorf("branch out of the function without its result")
+		}
+	case flowContinue:
+		return nil, fmt.Errorf("continue outside a loop")
+	}
+	if len(fn.Type.Results) == 0 {
+		return nil, nil
+	}
+	if ret == nil {
+		return nil, fmt.Errorf("function ends without a result")
+	}
+	v, err := ev.expr(ret)
+	if err != nil {
+		return nil, err
+	}
+	return []uint64{v}, nil
+}
+
+type flowKind int
+
+const (
+	flowNone flowKind = iota
+	flowBreak
+	flowContinue
+	flowReturn
+)
+
+// flow is how a statement left control: by falling through, by breaking or
+// going to a label, by continuing the loop with a label, or by returning, with the
+// return value still unevaluated.
+type flow struct {
+	kind  flowKind
+	label int
+	value Expr
+}
+
+type evaluator struct {
+	inst   *interp.Instance
+	locals []uint64
+	steps  int
+}
+
+func (ev *evaluator) step() error {
+	ev.steps--
+	if ev.steps < 0 {
+		return errors.New("statement budget exhausted")
+	}
+	return nil
+}
+
+// stmts runs list, resuming after a label in it that a goto inside an
+// earlier statement jumps to.
+func (ev *evaluator) stmts(list []Stmt) (flow, error) {
+	for i := 0; i < len(list); i++ {
+		c, err := ev.stmt(list[i])
+		if err != nil {
+			return c, err
+		}
+		if c.kind == flowBreak {
+			if at := labelIndex(list[i+1:], c.label); at >= 0 {
+				i += at + 1
+				continue
+			}
+		}
+		if c.kind != flowNone {
+			return c, nil
+		}
+	}
+	return flow{}, nil
+}
+
+func labelIndex(list []Stmt, label int) int {
+	for i, s := range list {
+		if l, ok := s.(*LabelStmt); ok && l.Label == label {
+			return i
+		}
+	}
+	return -1
+}
+
+func (ev *evaluator) stmt(s Stmt) (flow, error) {
+	if err := ev.step(); err != nil {
+		return flow{}, err
+	}
+	switch s := s.(type) {
+	case *AssignStmt:
+		v, err := ev.expr(s.Value)
+		if err != nil {
+			return flow{}, err
+		}
+		switch t := s.Target.(type) {
+		case *LocalExpr:
+			return flow{}, ev.setLocal(t.Index, v)
+		case *GlobalExpr:
+			g, err := ev.global(t.Index)
+			if err != nil {
+				return flow{}, err
+			}
+			g.Value = v
+			return flow{}, nil
+		}
+		return flow{}, fmt.Errorf("assignment to %T", s.Target)
+
+	case *StoreStmt:
+		addr, err := ev.expr(s.Addr)
+		if err != nil {
+			return flow{}, err
+		}
+		v, err := ev.expr(s.Value)
+		if err != nil {
+			return flow{}, err
+		}
+		_, err = ev.apply(memInstr(s.Op, s.Offset), addr, v)
+		return flow{}, err
+
+	case *CallStmt:
+		_, err := ev.call(s.Call)
+		return flow{}, err
+
+	case *DropStmt:
+		_, err := ev.expr(s.Value)
+		return flow{}, err
+
+	case *ReturnStmt:
+		return flow{kind: flowReturn, value: s.Value}, nil
+
+	case *IfStmt:
+		cond, err := ev.expr(s.Cond)
+		if err != nil {
+			return flow{}, err
+		}
+		if cond != 0 {
+			return ev.stmts(s.Then)
+		}
+		return ev.stmts(s.Else)
+
+	case *BlockStmt:
+		c, err := ev.stmts(s.Body)
+		if c.kind == flowBreak && c.label == s.Label {
+			return flow{}, err
+		}
+		return c, err
+
+	case *LoopStmt:
+		for {
+			c, err := ev.stmts(s.Body)
+			if err != nil || c.kind != flowBreak || c.label != s.Label {
+				return c, err
+			}
+			if err := ev.step(); err != nil {
+				return flow{}, err
+			}
+		}
+
+	case *WhileStmt:
+		for {
+			cond, err := ev.expr(s.Cond)
+			if err != nil || cond == 0 {
+				return flow{}, err
+			}
+			c, err := ev.stmts(s.Body)
+			if err != nil {
+				return flow{}, err
+			}
+			if c, done := loopFlow(c, s.Label); done {
+				return c, nil
+			}
+			if err := ev.step(); err != nil {
+				return flow{}, err
+			}
+		}
+
+	case *DoWhileStmt:
+		for {
+			c, err := ev.stmts(s.Body)
+			if err != nil {
+				return flow{}, err
+			}
+			if c, done := loopFlow(c, s.Label); done {
+				return c, nil
+			}
+			cond, err := ev.expr(s.Cond)
+			if err != nil || cond == 0 {
+				return flow{}, err
+			}
+			if err := ev.step(); err != nil {
+				return flow{}, err
+			}
+		}
+
+	case *ForStmt:
+		if _, err := ev.stmt(s.Init); err != nil {
+			return flow{}, err
+		}
+		for {
+			cond, err := ev.expr(s.Cond)
+			if err != nil || cond == 0 {
+				return flow{}, err
+			}
+			c, err := ev.stmts(s.Body)
+			if err != nil {
+				return flow{}, err
+			}
+			if c, done := loopFlow(c, s.Label); done {
+				return c, nil
+			}
+			if _, err := ev.stmt(s.Post); err != nil {
+				return flow{}, err
+			}
+		}
+
+	case *BreakStmt:
+		if s.Cond != nil {
+			cond, err := ev.expr(s.Cond)
+			if err != nil || cond == 0 {
+				return flow{}, err
+			}
+		}
+		return flow{kind: flowBreak, label: s.Label}, nil
+
+	case *ContinueStmt:
+		return flow{kind: flowContinue, label: s.Label}, nil
+
+	case *GotoStmt:
+		if s.Cond != nil {
+			cond, err := ev.expr(s.Cond)
+			if err != nil || cond == 0 {
+				return flow{}, err
+			}
+		}
+		return flow{kind: flowBreak, label: s.Label}, nil
+
+	case *LabelStmt:
+		return flow{}, nil
+
+	case *SwitchStmt:
+		v, err := ev.expr(s.Value)
+		if err != nil {
+			return flow{}, err
+		}
+		label := s.Default
+		if uint32(v) < uint32(len(s.Cases)) {
+			label = s.Cases[uint32(v)]
+		}
+		return flow{kind: flowBreak, label: label}, nil
+
+	case *FlatSwitchStmt:
+		v, err := ev.expr(s.Value)
+		if err != nil {
+			return flow{}, err
+		}
+		body := s.Default
+		for _, c := range s.Cases {
+			if uint32(c.Value) == uint32(v) {
+				body = c.Body
+				break
+			}
+		}
+		c, err := ev.stmts(body)
+		if c.kind == flowBreak && c.label == s.Label {
+			return flow{}, err
+		}
+		return c, err
+
+	case *ErrorStmt:
+		return flow{}, fmt.Errorf("%w: %s", ErrUnsupported, s.Message)
+	}
+	return flow{}, fmt.Errorf("cannot evaluate %T", s)
+}
+
+// loopFlow reports whether an iteration of the loop label that ended with
+// c leaves the loop, and the flow it leaves with.
+func loopFlow(c flow, label int) (flow, bool) {
+	switch {
+	case c.kind == flowNone, c.kind == flowContinue && c.label == label:
+		return flow{}, false
+	case c.kind == flowBreak && c.label == label:
+		return flow{}, true
+	}
+	return c, true
+}
+
+func (ev *evaluator) expr(e Expr) (uint64, error) {
+	switch e := e.(type) {
+	case nil:
+		return 0, errors.New("missing expression")
+
+	case *LocalExpr:
+		return ev.local(e.Index)
+	case *ParamExpr:
+		return ev.local(e.Index)
+	case *GlobalExpr:
+		g, err := ev.global(e.Index)
+		if err != nil {
+			return 0, err
+		}
+		return g.Value, nil
+
+	case *ConstExpr:
+		return constBits(e)
+
+	case *BinaryExpr:
+		l, err := ev.expr(e.Left)
+		if err != nil {
+			return 0, err
+		}
+		r, err := ev.expr(e.Right)
+		if err != nil {
+			return 0, err
+		}
+		return ev.apply(&wasm.Instruction{Opcode: e.Op}, l, r)
+
+	case *UnaryExpr:
+		// Instructions without an expression form of their own land here
+		// with only their first operand kept.
+		sig, ok := OpSignatures[e.Op]
+		if !ok || len(sig.Outputs) != 1 {
+			return 0, fmt.Errorf("cannot evaluate %s", instrName(e.Op))
+		}
+		var args []uint64
+		switch len(sig.Inputs) {
+		case 0:
+		case 1:
+			v, err := ev.expr(e.Arg)
+			if err != nil {
+				return 0, err
+			}
+			args = []uint64{v}
+		default:
+			return 0, fmt.Errorf("%s has %d operands, the expression keeps 1", instrName(e.Op), len(sig.Inputs))
+		}
+		return ev.apply(&wasm.Instruction{Opcode: e.Op}, args...)
+
+	case *LoadExpr:
+		addr, err := ev.expr(e.Addr)
+		if err != nil {
+			return 0, err
+		}
+		return ev.apply(memInstr(e.Op, e.Offset), addr)
+
+	case *CallExpr:
+		results, err := ev.call(e)
+		if err != nil {
+			return 0, err
+		}
+		if len(results) == 0 {
+			return 0, fmt.Errorf("call to function %d has no result", e.FuncIndex)
+		}
+		return results[0], nil
+
+	case *TernaryExpr:
+		cond, err := ev.expr(e.Cond)
+		if err != nil {
+			return 0, err
+		}
+		if cond != 0 {
+			return ev.expr(e.ThenResult)
+		}
+		return ev.expr(e.ElseResult)
+
+	case *NegExpr:
+		v, err := ev.expr(e.Arg)
+		if err != nil {
+			return 0, err
+		}
+		if e.Type == wasm.ValI64 {
+			return -v, nil
+		}
+		return uint64(-uint32(v)), nil
+
+	case *NotExpr:
+		v, err := ev.expr(e.Arg)
+		if err != nil {
+			return 0, err
+		}
+		if v == 0 {
+			return 1, nil
+		}
+		return 0, nil
+
+	case *ErrorExpr:
+		return 0, fmt.Errorf("%w: %s", ErrUnsupported, e.Message)
+	}
+	return 0, fmt.Errorf("cannot evaluate %T", e)
+}
+
+func (ev *evaluator) local(idx uint32) (uint64, error) {
+	if int(idx) >= len(ev.locals) {
+		return 0, fmt.Errorf("local %d out of range", idx)
+	}
+	return ev.locals[idx], nil
+}
+
+func (ev *evaluator) setLocal(idx uint32, v uint64) error {
+	if int(idx) >= len(ev.locals) {
+		return fmt.Errorf("local %d out of range", idx)
+	}
+	ev.locals[idx] = v
+	return nil
+}
+
+func (ev *evaluator) global(idx uint32) (*interp.Global, error) {
+	if int(idx) >= len(ev.inst.Globals) {
+		return nil, fmt.Errorf("global %d out of range", idx)
+	}
+	return ev.inst.Globals[idx], nil
+}
+
+func (ev *evaluator) apply(ins *wasm.Instruction, args ...uint64) (uint64, error) {
+	results, err := ev.inst.Apply(ins, args...)
+	if err != nil {
+		return 0, err
+	}
+	if len(results) != 1 {
+		return 0, nil
+	}
+	return results[0], nil
+}
+
+// call evaluates the arguments of c from left to right and runs the callee
+// in the interpreter. An indirect call goes through its table with its
+// first argument as the element index, and traps as call_indirect does.
+func (ev *evaluator) call(c *CallExpr) ([]uint64, error) {
+	if c == nil {
+		return nil, errors.New("missing call")
+	}
+	args := make([]uint64, len(c.Args))
+	for i, a := range c.Args {
+		v, err := ev.expr(a)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	if c.FuncIndex != 0xFFFFFFFF {
+		return ev.inst.CallFunc(c.FuncIndex, args...)
+	}
+	if len(args) == 0 || int(c.Table) >= len(ev.inst.Tables) {
+		return nil, errors.New("indirect call without a table index")
+	}
+	tbl, elem := ev.inst.Tables[c.Table], uint32(args[0])
+	if int(elem) >= len(tbl.Elem) {
+		return nil, &interp.Trap{Code: interp.TrapTableOutOfBounds, Details: fmt.Sprintf("index %d", elem)}
+	}
+	callee := tbl.Elem[elem]
+	if callee == nil {
+		return nil, &interp.Trap{Code: interp.TrapUninitializedElement, Details: fmt.Sprintf("index %d", elem)}
+	}
+	types := ev.inst.Module.Types
+	if callee.Type == nil || int(c.TypeIndex) >= len(types) || !types[c.TypeIndex].Equal(callee.Type) {
+		return nil, &interp.Trap{Code: interp.TrapIndirectCallTypeMismatch, Details: fmt.Sprintf("index %d", elem)}
+	}
+	return callee.Call(args[1:]...)
+}
+
+func memInstr(op wasm.Opcode, offset uint32) *wasm.Instruction {
+	return &wasm.Instruction{Opcode: op, Imm: wasm.Immediate{MemArg: wasm.MemArg{Offset: offset}}}
+}
+
+// constBits encodes a constant the way the interpreter holds values of its
+// type. Folded constants may carry an int32 for an i64.
+func constBits(c *ConstExpr) (uint64, error) {
+	switch v := c.Value.(type) {
+	case int32:
+		if c.Type == wasm.ValI64 {
+			return uint64(int64(v)), nil
+		}
+		return uint64(uint32(v)), nil
+	case int64:
+		if c.Type == wasm.ValI32 {
+			return uint64(uint32(v)), nil
+		}
+		return uint64(v), nil
+	case float32:
+		return interp.F32(v), nil
+	case float64:
+		return interp.F64(v), nil
+	}
+	return 0, fmt.Errorf("constant of type %T", c.Value)
+}
+
+func instrName(op wasm.Opcode) string {
+	if name, ok := wasm.OpcodeNames[op]; ok {
+		return name
+	}
+	return fmt.Sprintf("opcode 0x%x", uint16(op))
+}
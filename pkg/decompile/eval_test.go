@@ -0,0 +1,44 @@
+package decompile
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/0xInception/wasmspy/internal/wasmtest"
+	"github.com/0xInception/wasmspy/pkg/interp"
+)
+
+func TestEval(t *testing.T) {
+	rm := wasmtest.Load(t, "control_flow.wasm")
+	inst, err := interp.NewInstance(rm, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sum := rm.GetFunctionByName("sum_to_n")
+	results, err := Eval(BuildBody(sum, rm), sum, inst, []uint64{5}, 0)
+	if err != nil || len(results) != 1 || results[0] != 10 {
+		t.Errorf("sum_to_n(5) = %v, %v", results, err)
+	}
+	if _, err := Eval(BuildBody(sum, rm), sum, inst, []uint64{1000}, 100); err == nil {
+		t.Error("expected the statement budget to run out")
+	}
+
+	store := rm.GetFunctionByName("store_value")
+	if _, err := Eval(BuildBody(store, rm), store, inst, []uint64{8, 0x11223344}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := inst.Memory().ReadUint32(8); v != 0x11223344 {
+		t.Errorf("stored 0x%x", v)
+	}
+	_, err = Eval(BuildBody(store, rm), store, inst, []uint64{0xfffffffe, 0}, 0)
+	var trap *interp.Trap
+	if !errors.As(err, &trap) || trap.Code != interp.TrapMemoryOutOfBounds {
+		t.Errorf("out of bounds store: %v", err)
+	}
+
+	body := &FuncBody{Stmts: []Stmt{&ErrorStmt{Message: "unsupported: x"}}}
+	if _, err := Eval(body, store, inst, []uint64{0, 0}, 0); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("error statement: %v", err)
+	}
+}
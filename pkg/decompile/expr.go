@@ -71,20 +71,16 @@ func opToExpr(v *Value) Expr {
 	}
 
 	if isLoadOp(op) && len(inputs) >= 1 {
-		var offset uint32
-		if len(v.Op.Instr.Immediates) >= 2 {
-			offset = getU32(v.Op.Instr.Immediates, 1)
-		}
 		return &LoadExpr{
 			Op:     op,
 			Addr:   ValueToExpr(inputs[0]),
-			Offset: offset,
+			Offset: v.Op.Instr.MemArg().Offset,
 			Type:   v.Type,
 		}
 	}
 
-	if op == wasm.OpCall && len(v.Op.Instr.Immediates) >= 1 {
-		idx := getU32(v.Op.Instr.Immediates, 0)
+	if op == wasm.OpCall {
+		idx := v.Op.Instr.Index()
 		args := make([]Expr, len(inputs))
 		for i, in := range inputs {
 			args[i] = ValueToExpr(in)
@@ -105,6 +101,8 @@ func opToExpr(v *Value) Expr {
 			FuncIndex: 0xFFFFFFFF,
 			Args:      args,
 			Type:      v.Type,
+			Table:     v.Op.Instr.Index2(),
+			TypeIndex: v.Op.Instr.Index(),
 		}
 	}
 
@@ -135,7 +133,11 @@ func isBinaryOp(op wasm.Opcode) bool {
 		wasm.OpI64Shl, wasm.OpI64ShrS, wasm.OpI64ShrU, wasm.OpI64Rotl, wasm.OpI64Rotr,
 		wasm.OpI64Eq, wasm.OpI64Ne, wasm.OpI64LtS, wasm.OpI64LtU,
 		wasm.OpI64GtS, wasm.OpI64GtU, wasm.OpI64LeS, wasm.OpI64LeU,
-		wasm.OpI64GeS, wasm.OpI64GeU:
+		wasm.OpI64GeS, wasm.OpI64GeU,
+		wasm.OpF32Add, wasm.OpF32Sub, wasm.OpF32Mul, wasm.OpF32Div,
+		wasm.OpF32Eq, wasm.OpF32Ne, wasm.OpF32Lt, wasm.OpF32Gt, wasm.OpF32Le, wasm.OpF32Ge,
+		wasm.OpF64Add, wasm.OpF64Sub, wasm.OpF64Mul, wasm.OpF64Div,
+		wasm.OpF64Eq, wasm.OpF64Ne, wasm.OpF64Lt, wasm.OpF64Gt, wasm.OpF64Le, wasm.OpF64Ge:
 		return true
 	}
 	return false
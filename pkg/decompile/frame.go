@@ -0,0 +1,411 @@
+package decompile
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+// StackFrame is the shadow-stack frame a function allocates by moving a stack
+// pointer global down in its prologue, as clang and rustc do for locals
+// whose address is taken and for arrays and structs.
+type StackFrame struct {
+	// Global is the stack pointer and Local holds the frame's address.
+	Global uint32
+	Local  uint32
+	// Saved is the local the caller's stack pointer is kept in, or -1.
+	Saved int64
+	Size  uint32
+	Slots []*FrameSlot
+	// hidden is the prologue and epilogue statements.
+	hidden map[Stmt]bool
+}
+
+// FrameSlot is a variable kept in a frame. A slot runs from its offset to
+// the next one accessed; it is an array when that is more than one access
+// or when its accesses differ in size.
+type FrameSlot struct {
+	Offset uint32
+	Size   uint32
+	Name   string
+	Type   CType
+	Array  bool
+}
+
+// Count is the number of elements of an array slot.
+func (s *FrameSlot) Count() uint32 {
+	return s.Size / uint32(s.Type.Bits/8)
+}
+
+// Decl renders the declaration of the slot.
+func (s *FrameSlot) Decl() string {
+	if s.Array {
+		return fmt.Sprintf("%s %s[%d]", s.Type, s.Name, s.Count())
+	}
+	return fmt.Sprintf("%s %s", s.Type, s.Name)
+}
+
+// Slot returns the slot offset falls in.
+func (f *StackFrame) Slot(offset uint32) *FrameSlot {
+	if f == nil {
+		return nil
+	}
+	i := sort.Search(len(f.Slots), func(i int) bool { return f.Slots[i].Offset > offset })
+	if i == 0 {
+		return nil
+	}
+	if s := f.Slots[i-1]; offset < s.Offset+s.Size {
+		return s
+	}
+	return nil
+}
+
+// hides reports whether s adjusts the stack pointer and is left out of the
+// output.
+func (f *StackFrame) hides(s Stmt) bool {
+	return f != nil && f.hidden[s]
+}
+
+// owns reports whether local idx is the frame address or the saved stack
+// pointer, which are not declared.
+func (f *StackFrame) owns(idx uint32) bool {
+	return f != nil && (idx == f.Local || int64(idx) == f.Saved)
+}
+
+// slotAccess is an offset of a frame read or written with a type, or whose
+// address is taken when typ is nil.
+type slotAccess struct {
+	offset uint32
+	typ    *CType
+	load   bool
+}
+
+// RecoverFrame finds the shadow-stack frame of fn: a local set once, at the
+// top level of body, to a mutable i32 global minus a constant, and used
+// only as the base of addresses inside the frame. It returns nil when fn
+// has none.
+func RecoverFrame(fn *wasm.ResolvedFunction, module *wasm.ResolvedModule, body *FuncBody) *StackFrame {
+	f := &StackFrame{Saved: -1, hidden: make(map[Stmt]bool)}
+	var prologue Stmt
+	saved := make(map[uint32]Stmt)
+	for _, s := range body.Stmts {
+		a, ok := s.(*AssignStmt)
+		if !ok {
+			continue
+		}
+		dst, ok := a.Target.(*LocalExpr)
+		if !ok {
+			continue
+		}
+		if g, ok := a.Value.(*GlobalExpr); ok && stackGlobal(module, g.Index) {
+			saved[dst.Index] = s
+			continue
+		}
+		sub, ok := a.Value.(*BinaryExpr)
+		if !ok || sub.Op != wasm.OpI32Sub {
+			continue
+		}
+		c, ok := sub.Right.(*ConstExpr)
+		if !ok {
+			continue
+		}
+		n, ok := toInt64(c.Value)
+		if !ok || n <= 0 {
+			continue
+		}
+		switch base := sub.Left.(type) {
+		case *GlobalExpr:
+			if !stackGlobal(module, base.Index) {
+				continue
+			}
+			f.Global = base.Index
+		case *LocalExpr:
+			st, ok := saved[base.Index]
+			if !ok {
+				continue
+			}
+			f.Global = st.(*AssignStmt).Value.(*GlobalExpr).Index
+			f.Saved = int64(base.Index)
+			f.hidden[st] = true
+		default:
+			continue
+		}
+		f.Local = dst.Index
+		f.Size = uint32(n)
+		prologue = s
+		break
+	}
+	if prologue == nil {
+		return nil
+	}
+	f.hidden[prologue] = true
+
+	fs := &frameScan{frame: f, ok: true}
+	fs.stmts(body.Stmts)
+	if body.Return != nil {
+		fs.expr(body.Return)
+	}
+	if !fs.ok || fs.sets != 1 || f.Saved >= 0 && fs.savedSets != 1 {
+		return nil
+	}
+	f.Slots = layoutSlots(fs.accesses, f.Size)
+	return f
+}
+
+// stackGlobal reports whether global idx can be a stack pointer.
+func stackGlobal(module *wasm.ResolvedModule, idx uint32) bool {
+	if module == nil {
+		return false
+	}
+	gt, ok := module.GlobalType(idx)
+	return ok && gt.Mutable && gt.Type == wasm.ValI32
+}
+
+// frameScan checks the uses of a frame and collects its accesses.
+type frameScan struct {
+	frame     *StackFrame
+	accesses  []slotAccess
+	sets      int
+	savedSets int
+	ok        bool
+}
+
+func (fs *frameScan) stmts(list []Stmt) {
+	for _, s := range list {
+		fs.stmt(s)
+	}
+}
+
+func (fs *frameScan) stmt(s Stmt) {
+	f := fs.frame
+	switch s := s.(type) {
+	case *AssignStmt:
+		switch t := s.Target.(type) {
+		case *LocalExpr:
+			if t.Index == f.Local {
+				fs.sets++
+				if !f.hidden[s] {
+					fs.ok = false
+				}
+				return
+			}
+			if int64(t.Index) == f.Saved {
+				fs.savedSets++
+				return
+			}
+		case *GlobalExpr:
+			if t.Index == f.Global && fs.adjusts(s.Value) {
+				f.hidden[s] = true
+				return
+			}
+		}
+		fs.expr(s.Value)
+	case *StoreStmt:
+		fs.access(s.Op, s.Addr, s.Offset, false)
+		fs.expr(s.Value)
+	case *CallStmt:
+		fs.expr(s.Call)
+	case *ReturnStmt:
+		if s.Value != nil {
+			fs.expr(s.Value)
+		}
+	case *DropStmt:
+		fs.expr(s.Value)
+	case *IfStmt:
+		fs.expr(s.Cond)
+		fs.stmts(s.Then)
+		fs.stmts(s.Else)
+	case *LoopStmt:
+		fs.stmts(s.Body)
+	case *BlockStmt:
+		fs.stmts(s.Body)
+	case *BreakStmt:
+		if s.Cond != nil {
+			fs.expr(s.Cond)
+		}
+	case *GotoStmt:
+		if s.Cond != nil {
+			fs.expr(s.Cond)
+		}
+	case *SwitchStmt:
+		fs.expr(s.Value)
+	case *FlatSwitchStmt:
+		fs.expr(s.Value)
+		for _, c := range s.Cases {
+			fs.stmts(c.Body)
+		}
+		fs.stmts(s.Default)
+	case *WhileStmt:
+		fs.expr(s.Cond)
+		fs.stmts(s.Body)
+	case *DoWhileStmt:
+		fs.stmts(s.Body)
+		fs.expr(s.Cond)
+	case *ForStmt:
+		fs.stmt(s.Init)
+		fs.expr(s.Cond)
+		fs.stmts(s.Body)
+		fs.stmt(s.Post)
+	}
+}
+
+// adjusts reports whether setting the stack pointer to v allocates the
+// frame or frees it: v is the frame address, the saved stack pointer or the
+// frame address plus the frame size.
+func (fs *frameScan) adjusts(v Expr) bool {
+	f := fs.frame
+	if idx, ok := localOf(v); ok && int64(idx) == f.Saved {
+		return true
+	}
+	idx, add, ok := addrBase(v)
+	return ok && idx == f.Local && (add == 0 || add == int64(f.Size))
+}
+
+func (fs *frameScan) expr(e Expr) {
+	f := fs.frame
+	if idx, add, ok := addrBase(e); ok && idx == f.Local {
+		if add < 0 || add >= int64(f.Size) {
+			fs.ok = false
+			return
+		}
+		fs.accesses = append(fs.accesses, slotAccess{offset: uint32(add)})
+		return
+	}
+	switch e := e.(type) {
+	case *LocalExpr:
+		if int64(e.Index) == f.Saved {
+			fs.ok = false
+		}
+	case *BinaryExpr:
+		fs.expr(e.Left)
+		fs.expr(e.Right)
+	case *UnaryExpr:
+		fs.expr(e.Arg)
+	case *LoadExpr:
+		fs.access(e.Op, e.Addr, e.Offset, true)
+	case *CallExpr:
+		for _, arg := range e.Args {
+			fs.expr(arg)
+		}
+	case *TernaryExpr:
+		fs.expr(e.Cond)
+		fs.expr(e.ThenResult)
+		fs.expr(e.ElseResult)
+	case *NegExpr:
+		fs.expr(e.Arg)
+	case *NotExpr:
+		fs.expr(e.Arg)
+	}
+}
+
+func (fs *frameScan) access(op wasm.Opcode, addr Expr, offset uint32, load bool) {
+	f := fs.frame
+	idx, add, ok := addrBase(addr)
+	if !ok || idx != f.Local {
+		fs.expr(addr)
+		return
+	}
+	t := memCType(op)
+	end := add + int64(offset) + int64(t.Bits/8)
+	if add < 0 || end > int64(f.Size) {
+		fs.ok = false
+		return
+	}
+	fs.accesses = append(fs.accesses, slotAccess{offset: uint32(add) + offset, typ: &t, load: load})
+}
+
+// layoutSlots starts a slot at each offset accessed or whose address is
+// taken. A slot read and written with one size is a variable of that size,
+// typed as loaded when it is loaded; any other slot is an array of what it
+// is accessed as, or of bytes.
+func layoutSlots(accesses []slotAccess, size uint32) []*FrameSlot {
+	byOffset := make(map[uint32][]slotAccess)
+	var offsets []uint32
+	for _, a := range accesses {
+		if _, ok := byOffset[a.offset]; !ok {
+			offsets = append(offsets, a.offset)
+		}
+		byOffset[a.offset] = append(byOffset[a.offset], a)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+
+	var slots []*FrameSlot
+	for i, off := range offsets {
+		end := size
+		if i+1 < len(offsets) {
+			end = offsets[i+1]
+		}
+		s := &FrameSlot{Offset: off, Size: end - off}
+		var typ *CType
+		taken, uniform := false, true
+		for _, a := range byOffset[off] {
+			switch {
+			case a.typ == nil:
+				taken = true
+			case typ == nil:
+				typ = a.typ
+			case typ.Bits != a.typ.Bits:
+				uniform = false
+			case a.load && !typ.equal(*a.typ):
+				typ = a.typ
+			}
+		}
+		width := uint32(0)
+		if typ != nil {
+			width = uint32(typ.Bits / 8)
+		}
+		switch {
+		case typ != nil && uniform && (width == s.Size || !taken && width < s.Size):
+			s.Type = *typ
+			s.Name = fmt.Sprintf("tmp_%d", off)
+		case typ != nil && uniform && s.Size%width == 0:
+			s.Type = *typ
+			s.Array = true
+			s.Name = fmt.Sprintf("buf_%d", off)
+		default:
+			s.Type = CType{Kind: CInt, Bits: 8, Unsigned: true}
+			s.Array = true
+			s.Name = fmt.Sprintf("buf_%d", off)
+		}
+		slots = append(slots, s)
+	}
+	return slots
+}
+
+// slotAddr renders the address offset bytes into the frame.
+func (f *StackFrame) slotAddr(offset uint32) string {
+	s := f.Slot(offset)
+	k := offset - s.Offset
+	if !s.Array {
+		if k == 0 {
+			return "&" + s.Name
+		}
+		return fmt.Sprintf("((u8*)&%s + %d)", s.Name, k)
+	}
+	width := uint32(s.Type.Bits / 8)
+	switch {
+	case k == 0:
+		return s.Name
+	case k%width == 0:
+		return fmt.Sprintf("&%s[%d]", s.Name, k/width)
+	}
+	return fmt.Sprintf("((u8*)%s + %d)", s.Name, k)
+}
+
+// slotMem renders an access of type t offset bytes into the frame: the
+// variable or element there, or a cast of its address.
+func (f *StackFrame) slotMem(offset uint32, t CType) string {
+	s := f.Slot(offset)
+	k := offset - s.Offset
+	width := uint32(s.Type.Bits / 8)
+	if uint32(t.Bits/8) == width {
+		switch {
+		case !s.Array && k == 0:
+			return s.Name
+		case s.Array && k%width == 0:
+			return fmt.Sprintf("%s[%d]", s.Name, k/width)
+		}
+	}
+	return fmt.Sprintf("*(%s*)%s", t, f.slotAddr(offset))
+}
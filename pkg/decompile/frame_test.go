@@ -0,0 +1,100 @@
+package decompile
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/0xInception/wasmspy/internal/wasmtest"
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+// frameModule holds, by index, with global0 a mutable i32:
+//
+//	0 locals(p0): v1 = global0 - 32; global0 = v1
+//	              store(v1 + 12, p0); id(v1 + 16)
+//	              p0 = load8_u(v1 + 16) + load(v1 + 12); global0 = v1 + 32
+//	1 id(p0):     return p0
+//	2 saved(p0):  v1 = global0; v2 = v1 - 16; global0 = v2
+//	              id(v2); p0 = load(v2 + 8); global0 = v1
+//	3 outside(p0): v1 = global0 - 16; return load(v1 + 4) + load(v1 + 20)
+func frameModule(t *testing.T) *wasm.ResolvedModule {
+	t.Helper()
+	return wasmtest.Module(t,
+		wasmtest.Section(0x01, 0x01, 0x60, 0x01, 0x7f, 0x01, 0x7f),
+		wasmtest.Section(0x03, 0x04, 0x00, 0x00, 0x00, 0x00),
+		wasmtest.Section(0x05, 0x01, 0x00, 0x01),
+		wasmtest.Section(0x06, 0x01, 0x7f, 0x01, 0x41, 0x80, 0x80, 0x04, 0x0b),
+		wasmtest.Code(
+			wasmtest.Body(0x01, 0x01, 0x7f,
+				0x23, 0x00, 0x41, 0x20, 0x6b, 0x22, 0x01, 0x24, 0x00,
+				0x20, 0x01, 0x20, 0x00, 0x36, 0x02, 0x0c,
+				0x20, 0x01, 0x41, 0x10, 0x6a, 0x10, 0x01, 0x1a,
+				0x20, 0x01, 0x2d, 0x00, 0x10, 0x20, 0x01, 0x28, 0x02, 0x0c, 0x6a, 0x21, 0x00,
+				0x20, 0x01, 0x41, 0x20, 0x6a, 0x24, 0x00,
+				0x20, 0x00, 0x0b),
+			wasmtest.Body(0x00, 0x20, 0x00, 0x0b),
+			wasmtest.Body(0x01, 0x02, 0x7f,
+				0x23, 0x00, 0x22, 0x01, 0x41, 0x10, 0x6b, 0x22, 0x02, 0x24, 0x00,
+				0x20, 0x02, 0x10, 0x01, 0x1a,
+				0x20, 0x02, 0x28, 0x02, 0x08, 0x21, 0x00,
+				0x20, 0x01, 0x24, 0x00,
+				0x20, 0x00, 0x0b),
+			wasmtest.Body(0x01, 0x01, 0x7f,
+				0x23, 0x00, 0x41, 0x10, 0x6b, 0x21, 0x01,
+				0x20, 0x01, 0x28, 0x02, 0x04, 0x20, 0x01, 0x28, 0x02, 0x14, 0x6a, 0x0b),
+		),
+	)
+}
+
+func TestRecoverFrame(t *testing.T) {
+	rm := frameModule(t)
+	fn := rm.GetFunction(0)
+	f := RecoverFrame(fn, rm, BuildBody(fn, rm))
+	if f == nil {
+		t.Fatal("no frame")
+	}
+	if f.Global != 0 || f.Local != 1 || f.Size != 32 || len(f.Slots) != 2 {
+		t.Fatalf("unexpected frame %+v", f)
+	}
+	if got := f.Slots[0].Decl(); got != "i32 tmp_12" {
+		t.Errorf("slot 0: got %q", got)
+	}
+	if got := f.Slots[1].Decl(); got != "u8 buf_16[16]" {
+		t.Errorf("slot 1: got %q", got)
+	}
+	if f.Slot(20) != f.Slots[1] || f.Slot(4) != nil {
+		t.Error("wrong slot lookup")
+	}
+
+	fn = rm.GetFunction(3)
+	if f := RecoverFrame(fn, rm, BuildBody(fn, rm)); f != nil {
+		t.Errorf("found a frame in a function reading its caller's: %+v", f)
+	}
+}
+
+func TestDecompileFrame(t *testing.T) {
+	rm := frameModule(t)
+	tests := []struct {
+		idx     uint32
+		want    []string
+		without []string
+	}{
+		{0, []string{"  i32 tmp_12\n  u8 buf_16[16]\n", "tmp_12 = p0", "func_1(buf_16)", "p0 = (buf_16[0] + tmp_12)"},
+			[]string{"global0", "v1"}},
+		{2, []string{"  u8 buf_0[8]\n  i32 tmp_8\n", "func_1(buf_0)", "p0 = tmp_8"}, []string{"global0", "v1", "v2"}},
+		{3, []string{"v1 = (global0 - 16)", "*(i32*)(v1 + 20)"}, nil},
+	}
+	for _, tt := range tests {
+		code := Decompile(rm.GetFunction(tt.idx), rm)
+		for _, w := range tt.want {
+			if !strings.Contains(code, w) {
+				t.Errorf("func %d: missing %q in\n%s", tt.idx, w, code)
+			}
+		}
+		for _, w := range tt.without {
+			if strings.Contains(code, w) {
+				t.Errorf("func %d: unexpected %q in\n%s", tt.idx, w, code)
+			}
+		}
+	}
+}
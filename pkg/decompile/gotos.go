@@ -0,0 +1,354 @@
+package decompile
+
+import "slices"
+
+// StructureGotos removes the blocks the other passes leave. A block whose
+// branches sit at its top level, or end an arm of an if there, becomes ifs
+// on the conditions those branches skip the rest of it under. Any other
+// block becomes a label after its statements that its branches goto; the
+// labels are then merged, forwarded and dropped until only those a goto
+// still needs are left.
+func StructureGotos(body *FuncBody) {
+	labels := make(map[int]bool)
+	stmts := structureBlocks(body.Stmts, newJumpIndex(body.Stmts), labels)
+	body.Stmts = tidyGotos(gotosTo(stmts, labels))
+}
+
+// structureBlocks works from the outside in, so lifting a block into ifs
+// never moves a label away from the gotos outside it. The blocks that
+// become labels are added to labels; whether a block can be lifted only
+// depends on the branches to it, which neither way of removing the blocks
+// around it changes.
+func structureBlocks(stmts []Stmt, jumps *jumpIndex, labels map[int]bool) []Stmt {
+	result := make([]Stmt, 0, len(stmts))
+	for _, stmt := range stmts {
+		b, ok := stmt.(*BlockStmt)
+		if !ok {
+			result = append(result, mapBodies(stmt, func(list []Stmt) []Stmt {
+				return structureBlocks(list, jumps, labels)
+			}))
+			continue
+		}
+		if lifted, ok := liftBreaks(b.Body, b, jumps); ok {
+			result = append(result, structureBlocks(lifted, jumps, labels)...)
+			continue
+		}
+		labels[b.Label] = true
+		result = append(result, structureBlocks(b.Body, jumps, labels)...)
+		result = append(result, &LabelStmt{Label: b.Label, Offsets: []uint64{b.EndOffset}})
+	}
+	return result
+}
+
+// liftBreaks rewrites stmts, the rest of block b, without its branches to
+// b: what follows a conditional branch moves into an if on the negated
+// condition, and what follows an if with an arm ending in a branch moves
+// into its other arm. It fails when a branch is anywhere else.
+func liftBreaks(stmts []Stmt, b *BlockStmt, jumps *jumpIndex) ([]Stmt, bool) {
+	for i, stmt := range stmts {
+		rest := stmts[i+1:]
+		switch s := stmt.(type) {
+		case *BreakStmt:
+			if s.Label != b.Label {
+				continue
+			}
+			if s.Cond == nil {
+				return stmts[:i:i], true
+			}
+			lifted, ok := liftBreaks(rest, b, jumps)
+			if !ok {
+				return nil, false
+			}
+			return append(stmts[:i:i], ifStmt(negateCond(s.Cond), lifted, nil, s.SrcOffset, b.EndOffset, s.Offsets)...), true
+
+		case *IfStmt:
+			if !jumps.jumpsTo(s, b.Label) {
+				continue
+			}
+			then, thenExits, ok := liftArm(s.Then, b, jumps)
+			if !ok {
+				return nil, false
+			}
+			els, elseExits, ok := liftArm(s.Else, b, jumps)
+			if !ok || !thenExits && !elseExits {
+				return nil, false
+			}
+			if !thenExits || !elseExits {
+				lifted, ok := liftBreaks(rest, b, jumps)
+				if !ok {
+					return nil, false
+				}
+				if thenExits {
+					els = append(els, lifted...)
+				} else {
+					then = append(then, lifted...)
+				}
+			}
+			return append(stmts[:i:i], ifStmt(s.Cond, then, els, s.SrcOffset, s.EndOffset, s.Offsets)...), true
+
+		default:
+			if jumps.jumpsTo(stmt, b.Label) {
+				return nil, false
+			}
+		}
+	}
+	return stmts[:len(stmts):len(stmts)], true
+}
+
+// liftArm lifts the branches to b out of an arm of an if, which works when
+// the arm ends in one: every way through it then leaves b. An arm without
+// that branch may not have any other.
+func liftArm(arm []Stmt, b *BlockStmt, jumps *jumpIndex) ([]Stmt, bool, bool) {
+	if n := len(arm); n > 0 {
+		if br, ok := arm[n-1].(*BreakStmt); ok && br.Label == b.Label && br.Cond == nil {
+			lifted, ok := liftBreaks(arm[:n-1], b, jumps)
+			return lifted, true, ok
+		}
+	}
+	if jumps.branchesTo(arm, b.Label) {
+		return nil, false, false
+	}
+	return append([]Stmt(nil), arm...), false, true
+}
+
+// ifStmt builds an if, flipping one with only an else and dropping one with
+// neither arm unless its condition has effects.
+func ifStmt(cond Expr, then, els []Stmt, src, end uint64, offsets []uint64) []Stmt {
+	switch {
+	case len(then) == 0 && len(els) == 0:
+		var a access
+		exprAccess(cond, &a)
+		if a.pure() {
+			return nil
+		}
+		return []Stmt{&DropStmt{Value: cond, SrcOffset: src, Offsets: offsets}}
+	case len(then) == 0:
+		cond, then, els = negateCond(cond), els, nil
+	}
+	return []Stmt{&IfStmt{Cond: cond, Then: then, Else: els, SrcOffset: src, EndOffset: end, Offsets: offsets}}
+}
+
+// gotosTo turns the branches to labels in stmts into gotos.
+func gotosTo(stmts []Stmt, labels map[int]bool) []Stmt {
+	result := make([]Stmt, 0, len(stmts))
+	for _, stmt := range stmts {
+		if br, ok := stmt.(*BreakStmt); ok && labels[br.Label] {
+			result = append(result, &GotoStmt{Label: br.Label, Cond: br.Cond, SrcOffset: br.SrcOffset, Offsets: br.Offsets})
+			continue
+		}
+		result = append(result, mapBodies(stmt, func(list []Stmt) []Stmt {
+			return gotosTo(list, labels)
+		}))
+	}
+	return result
+}
+
+// mapBodies returns stmt with f applied to each statement list in it.
+func mapBodies(stmt Stmt, f func([]Stmt) []Stmt) Stmt {
+	switch s := stmt.(type) {
+	case *IfStmt:
+		return &IfStmt{Cond: s.Cond, Then: f(s.Then), Else: f(s.Else), SrcOffset: s.SrcOffset, EndOffset: s.EndOffset, Offsets: s.Offsets}
+	case *BlockStmt:
+		return &BlockStmt{Label: s.Label, Body: f(s.Body), SrcOffset: s.SrcOffset, EndOffset: s.EndOffset, Offsets: s.Offsets}
+	case *LoopStmt:
+		return &LoopStmt{Label: s.Label, Body: f(s.Body), SrcOffset: s.SrcOffset, EndOffset: s.EndOffset, Offsets: s.Offsets}
+	case *WhileStmt:
+		return &WhileStmt{Label: s.Label, Cond: s.Cond, Body: f(s.Body), Offsets: s.Offsets}
+	case *DoWhileStmt:
+		return &DoWhileStmt{Label: s.Label, Body: f(s.Body), Cond: s.Cond, Offsets: s.Offsets}
+	case *ForStmt:
+		return &ForStmt{Label: s.Label, Init: s.Init, Cond: s.Cond, Post: s.Post, Body: f(s.Body), Offsets: s.Offsets}
+	case *FlatSwitchStmt:
+		cases := make([]SwitchCase, len(s.Cases))
+		for i, c := range s.Cases {
+			cases[i] = SwitchCase{Value: c.Value, Body: f(c.Body)}
+		}
+		return &FlatSwitchStmt{Label: s.Label, Value: s.Value, Cases: cases, Default: f(s.Default), Offsets: s.Offsets}
+	}
+	return stmt
+}
+
+// gotoTidy holds what a round of tidyGotos learned about the labels: the
+// label or goto target each one only leads on to, the return it only leads
+// to, and how many jumps name it.
+type gotoTidy struct {
+	forward map[int]int
+	returns map[int]*ReturnStmt
+	uses    map[int]int
+	changed bool
+}
+
+// tidyGotos sends each goto straight to where its label leads, turns one
+// reaching a plain return into the return, and drops gotos of the label
+// right after them and the labels nothing jumps to.
+func tidyGotos(stmts []Stmt) []Stmt {
+	for {
+		t := &gotoTidy{forward: make(map[int]int), returns: make(map[int]*ReturnStmt), uses: make(map[int]int)}
+		t.scan(stmts)
+		stmts = t.rewrite(stmts, nil)
+		t.count(stmts)
+		stmts = t.dropLabels(stmts)
+		if !t.changed {
+			return stmts
+		}
+	}
+}
+
+func (t *gotoTidy) scan(stmts []Stmt) {
+	for i, stmt := range stmts {
+		if l, ok := stmt.(*LabelStmt); ok && i+1 < len(stmts) {
+			switch next := stmts[i+1].(type) {
+			case *LabelStmt:
+				t.forward[l.Label] = next.Label
+			case *GotoStmt:
+				if next.Cond == nil {
+					t.forward[l.Label] = next.Label
+				}
+			case *ReturnStmt:
+				if simpleReturn(next) {
+					t.returns[l.Label] = next
+				}
+			}
+		}
+		for _, list := range bodies(stmt) {
+			t.scan(list)
+		}
+	}
+}
+
+// simpleReturn reports whether r is cheap enough to repeat at each goto.
+func simpleReturn(r *ReturnStmt) bool {
+	switch r.Value.(type) {
+	case nil, *LocalExpr, *ParamExpr, *ConstExpr:
+		return true
+	}
+	return false
+}
+
+// resolve follows label to the label it leads on to. Gotos only jump
+// forward, so the chain ends; the bound is for safety.
+func (t *gotoTidy) resolve(label int) int {
+	for range len(t.forward) + 1 {
+		next, ok := t.forward[label]
+		if !ok {
+			break
+		}
+		label = next
+	}
+	return label
+}
+
+// rewrite tidies the gotos in stmts, where after is the labels reached by
+// falling off its end.
+func (t *gotoTidy) rewrite(stmts []Stmt, after []int) []Stmt {
+	result := make([]Stmt, 0, len(stmts))
+	for i, stmt := range stmts {
+		next := followingLabels(stmts[i+1:], after)
+		switch s := stmt.(type) {
+		case *GotoStmt:
+			label := t.resolve(s.Label)
+			if slices.Contains(next, label) {
+				t.changed = true
+				result = append(result, ifStmt(s.Cond, nil, nil, s.SrcOffset, s.SrcOffset, s.Offsets)...)
+				continue
+			}
+			if r := t.returns[label]; r != nil {
+				t.changed = true
+				ret := &ReturnStmt{Value: r.Value, SrcOffset: r.SrcOffset, Offsets: s.Offsets}
+				if s.Cond == nil {
+					result = append(result, ret)
+				} else {
+					result = append(result, &IfStmt{Cond: s.Cond, Then: []Stmt{ret}, SrcOffset: s.SrcOffset, EndOffset: s.SrcOffset, Offsets: s.Offsets})
+				}
+				continue
+			}
+			if label != s.Label {
+				t.changed = true
+				stmt = &GotoStmt{Label: label, Cond: s.Cond, SrcOffset: s.SrcOffset, Offsets: s.Offsets}
+			}
+			result = append(result, stmt)
+
+		case *SwitchStmt:
+			cases := make([]int, len(s.Cases))
+			for i, label := range s.Cases {
+				cases[i] = t.resolve(label)
+			}
+			result = append(result, &SwitchStmt{Value: s.Value, Cases: cases, Default: t.resolve(s.Default), Offsets: s.Offsets})
+
+		case *IfStmt:
+			result = append(result, ifStmt(s.Cond, t.rewrite(s.Then, next), t.rewrite(s.Else, next), s.SrcOffset, s.EndOffset, s.Offsets)...)
+
+		case *LoopStmt, *FlatSwitchStmt:
+			result = append(result, mapBodies(s, func(list []Stmt) []Stmt {
+				return t.rewrite(list, next)
+			}))
+
+		default:
+			result = append(result, mapBodies(stmt, func(list []Stmt) []Stmt {
+				return t.rewrite(list, nil)
+			}))
+		}
+	}
+	return result
+}
+
+// followingLabels returns the labels that stmts, what follows a statement,
+// starts with, and after when that is all of them.
+func followingLabels(stmts []Stmt, after []int) []int {
+	var labels []int
+	for _, stmt := range stmts {
+		l, ok := stmt.(*LabelStmt)
+		if !ok {
+			return labels
+		}
+		labels = append(labels, l.Label)
+	}
+	return append(labels, after...)
+}
+
+func (t *gotoTidy) count(stmts []Stmt) {
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *GotoStmt:
+			t.uses[s.Label]++
+		case *SwitchStmt:
+			for _, label := range s.Cases {
+				t.uses[label]++
+			}
+			t.uses[s.Default]++
+		}
+		for _, list := range bodies(stmt) {
+			t.count(list)
+		}
+	}
+}
+
+func (t *gotoTidy) dropLabels(stmts []Stmt) []Stmt {
+	result := make([]Stmt, 0, len(stmts))
+	for _, stmt := range stmts {
+		if l, ok := stmt.(*LabelStmt); ok && t.uses[l.Label] == 0 {
+			t.changed = true
+			continue
+		}
+		result = append(result, mapBodies(stmt, t.dropLabels))
+	}
+	return result
+}
+
+// gotoLabels returns the labels a goto can jump to.
+func gotoLabels(stmts []Stmt) map[int]bool {
+	labels := make(map[int]bool)
+	var walk func([]Stmt)
+	walk = func(list []Stmt) {
+		for _, stmt := range list {
+			if l, ok := stmt.(*LabelStmt); ok {
+				labels[l.Label] = true
+			}
+			for _, inner := range bodies(stmt) {
+				walk(inner)
+			}
+		}
+	}
+	walk(stmts)
+	return labels
+}
@@ -0,0 +1,90 @@
+package decompile
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/0xInception/wasmspy/internal/wasmtest"
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+// gotosModule holds, by index:
+//
+//	0 lift(p0):   block { p0 += 1; br_if 0 (p0 > 10); p0 *= 3; br_if 0 (p0 & 1); p0 += 100 }; return p0
+//	1 arms(p0):   block { if (p0 > 5) { p0 -= 5; br 1 } else { p0 += 1 }; p0 += 7 }; return p0
+//	2 escape(p0): block { loop { p0 -= 3; br_if 1 (p0 < 5); br_if 0 (p0 > 20) }; p0 *= 2 }; return p0
+//	3 fall(p0):   block { block { block { br_table [0, 1] 2 (p0) }; p0 += 10 }; p0 *= 2 }; return p0
+func gotosModule(t *testing.T) *wasm.ResolvedModule {
+	t.Helper()
+	return wasmtest.Module(t,
+		wasmtest.Section(0x01, 0x01, 0x60, 0x01, 0x7f, 0x01, 0x7f),
+		wasmtest.Section(0x03, 0x04, 0x00, 0x00, 0x00, 0x00),
+		wasmtest.Code(
+			wasmtest.Body(0x00,
+				0x02, 0x40,
+				0x20, 0x00, 0x41, 0x01, 0x6a, 0x21, 0x00,
+				0x20, 0x00, 0x41, 0x0a, 0x4a, 0x0d, 0x00,
+				0x20, 0x00, 0x41, 0x03, 0x6c, 0x21, 0x00,
+				0x20, 0x00, 0x41, 0x01, 0x71, 0x0d, 0x00,
+				0x20, 0x00, 0x41, 0xe4, 0x00, 0x6a, 0x21, 0x00,
+				0x0b,
+				0x20, 0x00, 0x0b),
+			wasmtest.Body(0x00,
+				0x02, 0x40,
+				0x20, 0x00, 0x41, 0x05, 0x4a, 0x04, 0x40,
+				0x20, 0x00, 0x41, 0x05, 0x6b, 0x21, 0x00,
+				0x0c, 0x01, 0x05,
+				0x20, 0x00, 0x41, 0x01, 0x6a, 0x21, 0x00,
+				0x0b,
+				0x20, 0x00, 0x41, 0x07, 0x6a, 0x21, 0x00,
+				0x0b,
+				0x20, 0x00, 0x0b),
+			wasmtest.Body(0x00,
+				0x02, 0x40, 0x03, 0x40,
+				0x20, 0x00, 0x41, 0x03, 0x6b, 0x21, 0x00,
+				0x20, 0x00, 0x41, 0x05, 0x48, 0x0d, 0x01,
+				0x20, 0x00, 0x41, 0x14, 0x4a, 0x0d, 0x00,
+				0x0b,
+				0x20, 0x00, 0x41, 0x02, 0x6c, 0x21, 0x00,
+				0x0b,
+				0x20, 0x00, 0x0b),
+			wasmtest.Body(0x00,
+				0x02, 0x40, 0x02, 0x40, 0x02, 0x40,
+				0x20, 0x00, 0x0e, 0x02, 0x00, 0x01, 0x02,
+				0x0b,
+				0x20, 0x00, 0x41, 0x0a, 0x6a, 0x21, 0x00,
+				0x0b,
+				0x20, 0x00, 0x41, 0x02, 0x6c, 0x21, 0x00,
+				0x0b,
+				0x20, 0x00, 0x0b),
+		),
+	)
+}
+
+func TestStructureGotos(t *testing.T) {
+	rm := gotosModule(t)
+	tests := []struct {
+		idx  uint32
+		want []string
+	}{
+		{0, []string{"if (p0 <= 10) {\n    p0 = (p0 * 3)\n    if !((p0 & 1)) {\n      p0 = (p0 + 100)\n    }\n  }"}},
+		{1, []string{"if (p0 > 5) {\n    p0 = (p0 - 5)\n  } else {\n    p0 = (p0 + 1)\n    p0 = (p0 + 7)\n  }"}},
+		{2, []string{"if (p0 < 5) goto L1\n  } while (p0 > 20)\n  p0 = (p0 * 2)\n  L1:\n  return p0"}},
+		{3, []string{"case 0:\n    p0 = (p0 + 10)", "default:\n    goto L1\n  }\n  p0 = (p0 * 2)\n  L1:"}},
+	}
+	for _, tt := range tests {
+		code := Decompile(rm.GetFunction(tt.idx), rm)
+		for _, w := range tt.want {
+			if !strings.Contains(code, w) {
+				t.Errorf("func %d: missing %q in\n%s", tt.idx, w, code)
+			}
+		}
+		if strings.Contains(code, "block L") || strings.Contains(code, "break L") {
+			t.Errorf("func %d: block left unstructured:\n%s", tt.idx, code)
+		}
+	}
+
+	for idx := uint32(0); idx < 4; idx++ {
+		checkEval(t, rm, idx, []uint64{0}, []uint64{1}, []uint64{3}, []uint64{7}, []uint64{30})
+	}
+}
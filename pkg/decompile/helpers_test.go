@@ -0,0 +1,42 @@
+package decompile
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/0xInception/wasmspy/pkg/interp"
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+// checkEval calls function idx with each argument list both through its
+// instructions and through its decompiled body, each on a fresh instance,
+// and reports any difference in the results or the trap.
+func checkEval(t *testing.T, rm *wasm.ResolvedModule, idx uint32, args ...[]uint64) {
+	t.Helper()
+	fn := rm.GetFunction(idx)
+	for _, a := range args {
+		inst, err := interp.NewInstance(rm, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, wantErr := inst.CallFunc(idx, a...)
+		inst, err = interp.NewInstance(rm, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Eval(BuildBody(fn, rm), fn, inst, a, 0)
+
+		var trap, wantTrap *interp.Trap
+		switch {
+		case errors.As(wantErr, &wantTrap):
+			if !errors.As(err, &trap) || trap.Code != wantTrap.Code {
+				t.Errorf("func %d%v: decompiled code gives %v, %v; instructions trap with %v", idx, a, got, err, wantErr)
+			}
+		case wantErr != nil:
+			t.Fatalf("func %d%v: %v", idx, a, wantErr)
+		case err != nil || !slices.Equal(got, want):
+			t.Errorf("func %d%v: decompiled code gives %v, %v; instructions give %v", idx, a, got, err, want)
+		}
+	}
+}
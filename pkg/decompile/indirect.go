@@ -0,0 +1,90 @@
+package decompile
+
+import (
+	"encoding/binary"
+	"strings"
+
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+// IndirectTargets returns the functions a call_indirect of type typeIdx
+// through table can reach, as the element segments fill the table: when
+// elem, the element index, is known statically (for a load, from the
+// initial memory) only the function in that slot, otherwise every
+// function of the type in the table. A function is listed once, in the
+// order of its first slot.
+func IndirectTargets(module *wasm.ResolvedModule, table, typeIdx uint32, elem Expr) []uint32 {
+	if module == nil || int(typeIdx) >= len(module.Types) {
+		return nil
+	}
+	img := module.TableImage(table)
+	if img == nil {
+		return nil
+	}
+	want := &module.Types[typeIdx]
+	matches := func(f int64) bool {
+		if f < 0 {
+			return false
+		}
+		fn := module.GetFunction(uint32(f))
+		return fn != nil && fn.Type != nil && want.Equal(fn.Type)
+	}
+
+	if slot, ok := staticElem(module, elem); ok {
+		if uint64(slot) < uint64(len(img.Funcs)) && matches(img.Funcs[slot]) {
+			return []uint32{uint32(img.Funcs[slot])}
+		}
+		return nil
+	}
+	var targets []uint32
+	seen := make(map[int64]bool)
+	for _, f := range img.Funcs {
+		if !seen[f] && matches(f) {
+			seen[f] = true
+			targets = append(targets, uint32(f))
+		}
+	}
+	return targets
+}
+
+// staticElem evaluates an element index that is a constant, or a load of
+// one from a constant address. A load reads the value the data segments
+// place there, never an attached snapshot, so the result is a guess once
+// the program may have stored to that address.
+func staticElem(module *wasm.ResolvedModule, e Expr) (uint32, bool) {
+	switch e := e.(type) {
+	case *ConstExpr:
+		if v, ok := e.Value.(int32); ok {
+			return uint32(v), true
+		}
+	case *LoadExpr:
+		addr, ok := staticElem(module, e.Addr)
+		if !ok || e.Op != wasm.OpI32Load {
+			return 0, false
+		}
+		mem := module.MemoryImage().Data
+		at := uint64(addr) + uint64(e.Offset)
+		if at+4 > uint64(len(mem)) {
+			return 0, false
+		}
+		return binary.LittleEndian.Uint32(mem[at:]), true
+	}
+	return 0, false
+}
+
+// sigString renders a function type as (i32, i64)->f64, with () for no
+// parameters or results.
+func sigString(t *wasm.FuncType) string {
+	list := func(types []wasm.ValType) string {
+		names := make([]string, len(types))
+		for i, v := range types {
+			names[i] = v.String()
+		}
+		return "(" + strings.Join(names, ", ") + ")"
+	}
+	results := list(t.Results)
+	if len(t.Results) == 1 {
+		results = t.Results[0].String()
+	}
+	return list(t.Params) + "->" + results
+}
@@ -0,0 +1,76 @@
+package decompile
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/0xInception/wasmspy/internal/wasmtest"
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+// indirectModule has table [func 0, func 1] and holds, by index:
+//
+//	0 inc(p0) -> i32:   return p0 + 1
+//	1 seven() -> i32:   return 7
+//	2 fixed(p0) -> i32: return table[0](p0) as (i32)->i32
+//	3 wrong() -> i32:   return table[0]() as ()->i32
+//	4 any(p0) -> i32:   return table[p0]() as ()->i32
+//	5 vtable() -> i32:  return table[load(16)]() as ()->i32, where the data
+//	                    segment stores 1 at 16
+func indirectModule(t *testing.T) *wasm.ResolvedModule {
+	t.Helper()
+	return wasmtest.Module(t,
+		wasmtest.Section(0x01, 0x02, 0x60, 0x01, 0x7f, 0x01, 0x7f, 0x60, 0x00, 0x01, 0x7f),
+		wasmtest.Section(0x03, 0x06, 0x00, 0x01, 0x00, 0x01, 0x00, 0x01),
+		wasmtest.Section(0x04, 0x01, 0x70, 0x00, 0x02),
+		wasmtest.Section(0x05, 0x01, 0x00, 0x01),
+		wasmtest.Section(0x09, 0x01, 0x00, 0x41, 0x00, 0x0b, 0x02, 0x00, 0x01),
+		wasmtest.Code(
+			wasmtest.Body(0x00, 0x20, 0x00, 0x41, 0x01, 0x6a, 0x0b),
+			wasmtest.Body(0x00, 0x41, 0x07, 0x0b),
+			wasmtest.Body(0x00, 0x20, 0x00, 0x41, 0x00, 0x11, 0x00, 0x00, 0x0b),
+			wasmtest.Body(0x00, 0x41, 0x00, 0x11, 0x01, 0x00, 0x0b),
+			wasmtest.Body(0x00, 0x20, 0x00, 0x11, 0x01, 0x00, 0x0b),
+			wasmtest.Body(0x00, 0x41, 0x10, 0x28, 0x02, 0x00, 0x11, 0x01, 0x00, 0x0b),
+		),
+		wasmtest.Section(0x0b, 0x01, 0x00, 0x41, 0x10, 0x0b, 0x04, 0x01, 0x00, 0x00, 0x00),
+	)
+}
+
+func TestIndirectCalls(t *testing.T) {
+	rm := indirectModule(t)
+	tests := []struct {
+		idx  uint32
+		want string
+	}{
+		{2, "return (table[0] as (i32)->i32)(p0) /* targets: func_0 */"},
+		{3, "return (table[0] as ()->i32)() /* no targets */"},
+		{4, "return (table[p0] as ()->i32)() /* targets: func_1 */"},
+		{5, "/* targets: func_1 */"},
+	}
+	for _, tt := range tests {
+		code := Decompile(rm.GetFunction(tt.idx), rm)
+		if !strings.Contains(code, tt.want) {
+			t.Errorf("func %d: missing %q in\n%s", tt.idx, tt.want, code)
+		}
+	}
+
+	cg := BuildCallGraph(rm)
+	for caller, want := range map[uint32][]uint32{2: {0}, 3: nil, 4: nil} {
+		got := cg.Callees[caller]
+		if len(got) != len(want) || len(want) > 0 && (got[0] != want[0] || !cg.Indirect(caller, got[0])) {
+			t.Errorf("callees of func %d: got %v, want %v", caller, got, want)
+		}
+	}
+
+	checkEval(t, rm, 2, []uint64{5})
+	checkEval(t, rm, 3, nil)
+	checkEval(t, rm, 4, []uint64{1})
+	checkEval(t, rm, 5, nil)
+
+	// The slot comes from the data segments even with a snapshot attached.
+	rm.AttachSnapshot(&wasm.Snapshot{Memory: make([]byte, 64)})
+	if code := Decompile(rm.GetFunction(5), rm); !strings.Contains(code, "/* targets: func_1 */") {
+		t.Errorf("func 5 with a snapshot:\n%s", code)
+	}
+}
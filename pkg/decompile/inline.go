@@ -0,0 +1,124 @@
+package decompile
+
+import "github.com/0xInception/wasmspy/pkg/wasm"
+
+// heldSet is a local.set whose only read comes later in the same block. Its
+// statement is not emitted: the value moves into the expression reading it,
+// unless something in between would change the value or reorder it with
+// other effects, in which case the write is emitted at that point.
+type heldSet struct {
+	idx   uint32
+	val   *Value
+	pos   int
+	instr *wasm.Instruction
+}
+
+// hold records a local.set the plan found movable when nothing of the
+// current block is on the stack, so every value pushed later is evaluated
+// after it.
+func (b *stmtBuilder) hold(idx uint32, val *Value, instr *wasm.Instruction) bool {
+	if !b.plan.isMovable(b.pos) || len(b.stack) != b.frameDepth() {
+		return false
+	}
+	b.held = append(b.held, &heldSet{idx: idx, val: val, pos: b.pos, instr: instr})
+	return true
+}
+
+func (b *stmtBuilder) frameDepth() int {
+	if len(b.blocks) == 0 {
+		return 0
+	}
+	return b.blocks[len(b.blocks)-1].StackDepth
+}
+
+// setAccess is what emitting the held write does.
+func (b *stmtBuilder) setAccess(h *heldSet) *access {
+	s := &access{locals: []uint32{h.idx}}
+	s.include(b.valueAccess(h.val))
+	return s
+}
+
+// take returns the value of the held write the local.get at the current
+// position is the only read of, or nil when the read has to go through the
+// local. The value is evaluated after the values on the stack and the held
+// writes after it, so it is only moved when it commutes with them.
+func (b *stmtBuilder) take() *Value {
+	set, ok := b.plan.movedFrom(b.pos)
+	if !ok {
+		return nil
+	}
+	k := -1
+	for i, h := range b.held {
+		if h.pos == set {
+			k = i
+		}
+	}
+	if k < 0 {
+		return nil
+	}
+	h := b.held[k]
+	hv := b.valueAccess(h.val)
+	eh := &access{}
+	eh.include(hv)
+	ok = true
+	for _, x := range b.stack {
+		xv := b.valueAccess(x)
+		ex := &access{}
+		ex.include(xv)
+		ok = ok && !ex.changes(hv) && !eh.changes(xv)
+	}
+	for _, n := range b.held[k+1:] {
+		ok = ok && !b.setAccess(n).changes(hv) && !eh.changes(b.valueAccess(n.val))
+	}
+	b.held = append(b.held[:k], b.held[k+1:]...)
+	if !ok {
+		b.release(b.setAccess(h), k, false)
+		b.emitHeld(h)
+		return nil
+	}
+	return h.val
+}
+
+// release emits the held writes below top that statement s would change
+// or reorder, together with the older ones those would in turn, oldest
+// first. With all set, every held write below top is emitted.
+func (b *stmtBuilder) release(s *access, top int, all bool) {
+	if top == 0 {
+		return
+	}
+	marked := make([]bool, top)
+	for k := top - 1; k >= 0; k-- {
+		h := b.held[k]
+		v := b.valueAccess(h.val)
+		if all || s.changes(v) {
+			marked[k] = true
+			s.locals = append(s.locals, h.idx)
+			s.include(v)
+		}
+	}
+	var kept []*heldSet
+	for k, h := range b.held {
+		if k < top && marked[k] {
+			b.emitHeld(h)
+		} else {
+			kept = append(kept, h)
+		}
+	}
+	b.held = kept
+}
+
+// releaseAll emits every held write, ahead of control flow.
+func (b *stmtBuilder) releaseAll() {
+	b.release(&access{}, len(b.held), true)
+}
+
+func (b *stmtBuilder) emitHeld(h *heldSet) {
+	offsets := CollectValueOffsets(h.val)
+	offsets = append(offsets, h.instr.Offset)
+	b.emit(&AssignStmt{
+		Target:    &LocalExpr{Index: h.idx, Type: h.val.Type},
+		Value:     ValueToExpr(h.val),
+		SrcOffset: h.instr.Offset,
+		Offsets:   offsets,
+	})
+}
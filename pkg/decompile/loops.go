@@ -1,154 +1,522 @@
 package decompile
 
+import (
+	"slices"
+
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+// RecoverLoops turns loop blocks into while, do-while and for loops. A
+// branch to a loop becomes a continue of it and a branch to a block the
+// loop ends becomes a break of it; a block left with no branch to it is
+// dissolved into the statements around it.
 func RecoverLoops(body *FuncBody) {
-	body.Stmts = recoverLoopsInStmts(body.Stmts)
+	body.Stmts = recoverLoopsInStmts(body.Stmts, nil)
 }
 
-func recoverLoopsInStmts(stmts []Stmt) []Stmt {
+// recoverLoopsInStmts recovers the loops of stmts. Branching to one of
+// exits leaves the last statement the way falling off its end does.
+func recoverLoopsInStmts(stmts []Stmt, exits []int) []Stmt {
 	result := make([]Stmt, 0, len(stmts))
-	for _, stmt := range stmts {
-		result = append(result, recoverLoopsInStmt(stmt))
+	for i, stmt := range stmts {
+		var e []int
+		if i == len(stmts)-1 {
+			e = exits
+		}
+		switch s := stmt.(type) {
+		case *BlockStmt:
+			body := recoverLoopsInStmts(s.Body, append(e[:len(e):len(e)], s.Label))
+			if !branchesTo(body, s.Label) {
+				result = append(result, body...)
+				continue
+			}
+			result = append(result, &BlockStmt{Label: s.Label, Body: body, SrcOffset: s.SrcOffset, EndOffset: s.EndOffset, Offsets: s.Offsets})
+		case *LoopStmt:
+			result = append(result, recoverLoop(s, e)...)
+		default:
+			result = append(result, recoverLoopsInStmt(stmt))
+		}
 	}
-	return result
+	return recoverForLoops(result)
 }
 
 func recoverLoopsInStmt(stmt Stmt) Stmt {
 	switch s := stmt.(type) {
-	case *BlockStmt:
-		if w := tryConvertToWhile(s); w != nil {
-			return w
-		}
-		return &BlockStmt{Label: s.Label, Body: recoverLoopsInStmts(s.Body), SrcOffset: s.SrcOffset, EndOffset: s.EndOffset, Offsets: s.Offsets}
-
-	case *LoopStmt:
-		return &LoopStmt{Label: s.Label, Body: recoverLoopsInStmts(s.Body), SrcOffset: s.SrcOffset, EndOffset: s.EndOffset, Offsets: s.Offsets}
-
 	case *IfStmt:
 		return &IfStmt{
 			Cond:      s.Cond,
-			Then:      recoverLoopsInStmts(s.Then),
-			Else:      recoverLoopsInStmts(s.Else),
+			Then:      recoverLoopsInStmts(s.Then, nil),
+			Else:      recoverLoopsInStmts(s.Else, nil),
 			SrcOffset: s.SrcOffset,
 			EndOffset: s.EndOffset,
 			Offsets:   s.Offsets,
 		}
-
-	case *WhileStmt:
-		return &WhileStmt{Cond: s.Cond, Body: recoverLoopsInStmts(s.Body), Offsets: s.Offsets}
 	}
 	return stmt
 }
 
-func tryConvertToWhile(block *BlockStmt) *WhileStmt {
-	if len(block.Body) != 1 {
-		return nil
+// recoverLoop turns a loop into a while loop that breaks where the loop
+// falls off its end, taking a leading exit test as its condition. A loop
+// whose only branch back is a conditional one becomes a do-while, followed
+// by the statements after that branch when they do not branch to the loop.
+// A loop a br_table branches to is kept.
+func recoverLoop(loop *LoopStmt, exits []int) []Stmt {
+	body := recoverLoopsInStmts(loop.Body, nil)
+	if switchesTo(body, loop.Label) {
+		return []Stmt{&LoopStmt{Label: loop.Label, Body: body, SrcOffset: loop.SrcOffset, EndOffset: loop.EndOffset, Offsets: loop.Offsets}}
 	}
-
-	loop, ok := block.Body[0].(*LoopStmt)
-	if !ok || len(loop.Body) < 2 {
-		return nil
+	for _, e := range exits {
+		if switchesTo(body, e) {
+			exits = nil
+		}
 	}
+	body = relabelJumps(body, loop.Label, exits)
 
-	brk, ok := loop.Body[0].(*BreakStmt)
-	if !ok || brk.Cond == nil || brk.Label != block.Label {
-		return nil
+	var cond Expr
+	if len(body) > 0 {
+		if brk, ok := body[0].(*BreakStmt); ok && brk.Label == loop.Label && brk.Cond != nil {
+			cond = negateCond(brk.Cond)
+			body = body[1:]
+		}
 	}
-
-	lastIdx := len(loop.Body) - 1
-	cont, ok := loop.Body[lastIdx].(*BreakStmt)
-	if !ok || cont.Cond != nil || cont.Label != loop.Label {
-		return nil
+	if cond == nil {
+		if stmts := recoverDoWhile(loop, body); stmts != nil {
+			return stmts
+		}
 	}
+	exit := &BreakStmt{Label: loop.Label, SrcOffset: loop.EndOffset, Offsets: []uint64{loop.EndOffset}}
+	if n := len(body); n == 0 {
+		body = append(body, exit)
+	} else if c, ok := backEdge(body[n-1], loop.Label); ok {
+		last := body[n-1].(*IfStmt)
+		body = append(body[:n-1:n-1], &BreakStmt{Label: loop.Label, Cond: negateCond(c), SrcOffset: last.SrcOffset, Offsets: last.Offsets})
+	} else if cont, ok := body[n-1].(*ContinueStmt); ok && cont.Label == loop.Label {
+		body = body[:n-1]
+	} else if fallsThrough(body[n-1]) {
+		body = append(body, exit)
+	}
+	if cond == nil {
+		cond = &ConstExpr{Value: int32(1), Type: wasm.ValI32}
+	}
+	return []Stmt{&WhileStmt{Label: loop.Label, Cond: cond, Body: body, Offsets: loop.Offsets}}
+}
 
-	cond := negateCond(brk.Cond)
-	body := recoverLoopsInStmts(loop.Body[1:lastIdx])
-
-	body = convertBreaksInLoop(body, loop.Label, block.Label)
+// recoverDoWhile makes a do-while of a loop whose last "if c continue" is
+// its only branch back: the statements before it are the body, and those
+// after it, which must only leave the loop, follow the do-while.
+func recoverDoWhile(loop *LoopStmt, body []Stmt) []Stmt {
+	for k := len(body) - 1; k >= 0; k-- {
+		c, ok := backEdge(body[k], loop.Label)
+		if !ok {
+			continue
+		}
+		head, tail := body[:k], body[k+1:]
+		if n := len(tail); n > 0 {
+			if brk, ok := tail[n-1].(*BreakStmt); ok && brk.Label == loop.Label && brk.Cond == nil {
+				tail = tail[:n-1]
+			}
+		}
+		if continuesTo(head, loop.Label) || branchesTo(tail, loop.Label) {
+			return nil
+		}
+		return append([]Stmt{&DoWhileStmt{Label: loop.Label, Body: head, Cond: c, Offsets: loop.Offsets}}, tail...)
+	}
+	return nil
+}
 
-	return &WhileStmt{Cond: cond, Body: body, Offsets: block.Offsets}
+// backEdge returns the condition of an "if c continue" of label.
+func backEdge(s Stmt, label int) (Expr, bool) {
+	ifs, ok := s.(*IfStmt)
+	if !ok || len(ifs.Then) != 1 || len(ifs.Else) != 0 {
+		return nil, false
+	}
+	if cont, ok := ifs.Then[0].(*ContinueStmt); ok && cont.Label == label {
+		return ifs.Cond, true
+	}
+	return nil, false
 }
 
-func negateCond(e Expr) Expr {
-	switch v := e.(type) {
-	case *NotExpr:
-		return v.Arg
-	case *BinaryExpr:
-		switch v.Op {
-		case 0x46, 0x51: // i32.eq, i64.eq
-			return &BinaryExpr{Op: 0x47, Left: v.Left, Right: v.Right, Type: v.Type} // i32.ne
-		case 0x47, 0x52: // i32.ne, i64.ne
-			return &BinaryExpr{Op: 0x46, Left: v.Left, Right: v.Right, Type: v.Type} // i32.eq
-		case 0x48, 0x53: // i32.lt_s, i64.lt_s
-			return &BinaryExpr{Op: 0x4e, Left: v.Left, Right: v.Right, Type: v.Type} // i32.ge_s
-		case 0x4a, 0x55: // i32.gt_s, i64.gt_s
-			return &BinaryExpr{Op: 0x4c, Left: v.Left, Right: v.Right, Type: v.Type} // i32.le_s
-		case 0x4c, 0x57: // i32.le_s, i64.le_s
-			return &BinaryExpr{Op: 0x4a, Left: v.Left, Right: v.Right, Type: v.Type} // i32.gt_s
-		case 0x4e, 0x59: // i32.ge_s, i64.ge_s
-			return &BinaryExpr{Op: 0x48, Left: v.Left, Right: v.Right, Type: v.Type} // i32.lt_s
-		case 0x49, 0x54: // i32.lt_u, i64.lt_u
-			return &BinaryExpr{Op: 0x4f, Left: v.Left, Right: v.Right, Type: v.Type} // i32.ge_u
-		case 0x4b, 0x56: // i32.gt_u, i64.gt_u
-			return &BinaryExpr{Op: 0x4d, Left: v.Left, Right: v.Right, Type: v.Type} // i32.le_u
-		case 0x4d, 0x58: // i32.le_u, i64.le_u
-			return &BinaryExpr{Op: 0x4b, Left: v.Left, Right: v.Right, Type: v.Type} // i32.gt_u
-		case 0x4f, 0x5a: // i32.ge_u, i64.ge_u
-			return &BinaryExpr{Op: 0x49, Left: v.Left, Right: v.Right, Type: v.Type} // i32.lt_u
+// recoverForLoops merges a while loop whose condition reads a local that
+// the statement before it sets and the end of its body steps into a for
+// loop. Loops continued from inside are left alone, since a continue would
+// now run the step.
+func recoverForLoops(stmts []Stmt) []Stmt {
+	for i := 1; i < len(stmts); i++ {
+		w, ok := stmts[i].(*WhileStmt)
+		init, isInit := stmts[i-1].(*AssignStmt)
+		if !ok || !isInit || len(w.Body) == 0 {
+			continue
 		}
-	case *UnaryExpr:
-		if v.Op == 0x45 || v.Op == 0x50 { // i32.eqz, i64.eqz
-			return v.Arg
+		post, ok := w.Body[len(w.Body)-1].(*AssignStmt)
+		if !ok {
+			continue
+		}
+		idx, ok := localOf(init.Target)
+		if step, isLocal := localOf(post.Target); !ok || !isLocal || step != idx {
+			continue
+		}
+		if !readsLocal(w.Cond, idx) || !readsLocal(post.Value, idx) || continuesTo(w.Body, w.Label) {
+			continue
 		}
+		stmts[i-1] = &ForStmt{
+			Label:   w.Label,
+			Init:    init,
+			Cond:    w.Cond,
+			Post:    post,
+			Body:    w.Body[:len(w.Body)-1],
+			Offsets: w.Offsets,
+		}
+		stmts = append(stmts[:i], stmts[i+1:]...)
 	}
-	return &NotExpr{Arg: e}
+	return stmts
 }
 
-func convertBreaksInLoop(stmts []Stmt, loopLabel, blockLabel int) []Stmt {
+func readsLocal(e Expr, idx uint32) bool {
+	a := &access{}
+	exprAccess(e, a)
+	return hasIndex(a.locals, idx)
+}
+
+// relabelJumps rewrites the branches in a loop body: those to the loop
+// continue it and those to exits break out of it.
+func relabelJumps(stmts []Stmt, loop int, exits []int) []Stmt {
 	result := make([]Stmt, 0, len(stmts))
 	for _, stmt := range stmts {
-		result = append(result, convertBreakInStmt(stmt, loopLabel, blockLabel))
+		result = append(result, relabelJump(stmt, loop, exits))
 	}
 	return result
 }
 
-func convertBreakInStmt(stmt Stmt, loopLabel, blockLabel int) Stmt {
+func relabelJump(stmt Stmt, loop int, exits []int) Stmt {
 	switch s := stmt.(type) {
 	case *BreakStmt:
-		if s.Label == loopLabel {
+		if s.Label == loop {
+			cont := &ContinueStmt{Label: loop, Offsets: s.Offsets}
 			if s.Cond != nil {
-				return &IfStmt{Cond: s.Cond, Then: []Stmt{&ContinueStmt{Offsets: s.Offsets}}, Offsets: s.Offsets}
+				return &IfStmt{Cond: s.Cond, Then: []Stmt{cont}, SrcOffset: s.SrcOffset, EndOffset: s.SrcOffset, Offsets: s.Offsets}
 			}
-			return &ContinueStmt{Offsets: s.Offsets}
+			return cont
 		}
-		if s.Label == blockLabel {
-			if s.Cond != nil {
-				return &IfStmt{Cond: s.Cond, Then: []Stmt{&BreakStmt{Label: 0, Offsets: s.Offsets}}, Offsets: s.Offsets}
+		for _, e := range exits {
+			if s.Label == e {
+				return &BreakStmt{Label: loop, Cond: s.Cond, SrcOffset: s.SrcOffset, Offsets: s.Offsets}
 			}
-			return &BreakStmt{Label: 0, Offsets: s.Offsets}
 		}
 
 	case *IfStmt:
 		return &IfStmt{
 			Cond:      s.Cond,
-			Then:      convertBreaksInLoop(s.Then, loopLabel, blockLabel),
-			Else:      convertBreaksInLoop(s.Else, loopLabel, blockLabel),
+			Then:      relabelJumps(s.Then, loop, exits),
+			Else:      relabelJumps(s.Else, loop, exits),
 			SrcOffset: s.SrcOffset,
 			EndOffset: s.EndOffset,
 			Offsets:   s.Offsets,
 		}
 
 	case *LoopStmt:
-		return &LoopStmt{Label: s.Label, Body: convertBreaksInLoop(s.Body, loopLabel, blockLabel), SrcOffset: s.SrcOffset, EndOffset: s.EndOffset, Offsets: s.Offsets}
+		return &LoopStmt{Label: s.Label, Body: relabelJumps(s.Body, loop, exits), SrcOffset: s.SrcOffset, EndOffset: s.EndOffset, Offsets: s.Offsets}
 
 	case *BlockStmt:
-		return &BlockStmt{Label: s.Label, Body: convertBreaksInLoop(s.Body, loopLabel, blockLabel), SrcOffset: s.SrcOffset, EndOffset: s.EndOffset, Offsets: s.Offsets}
+		return &BlockStmt{Label: s.Label, Body: relabelJumps(s.Body, loop, exits), SrcOffset: s.SrcOffset, EndOffset: s.EndOffset, Offsets: s.Offsets}
 
 	case *WhileStmt:
-		return &WhileStmt{Cond: s.Cond, Body: convertBreaksInLoop(s.Body, loopLabel, blockLabel), Offsets: s.Offsets}
+		return &WhileStmt{Label: s.Label, Cond: s.Cond, Body: relabelJumps(s.Body, loop, exits), Offsets: s.Offsets}
+
+	case *DoWhileStmt:
+		return &DoWhileStmt{Label: s.Label, Body: relabelJumps(s.Body, loop, exits), Cond: s.Cond, Offsets: s.Offsets}
+
+	case *ForStmt:
+		return &ForStmt{Label: s.Label, Init: s.Init, Cond: s.Cond, Post: s.Post, Body: relabelJumps(s.Body, loop, exits), Offsets: s.Offsets}
 	}
 	return stmt
 }
 
+// fallsThrough reports whether control can leave s by its end. Blocks are
+// assumed to, as a branch to their own label does.
+func fallsThrough(s Stmt) bool {
+	switch s := s.(type) {
+	case *ReturnStmt, *ContinueStmt, *SwitchStmt:
+		return false
+	case *BreakStmt:
+		return s.Cond != nil
+	case *GotoStmt:
+		return s.Cond != nil
+	case *IfStmt:
+		return len(s.Else) == 0 || len(s.Then) == 0 ||
+			fallsThrough(s.Then[len(s.Then)-1]) || fallsThrough(s.Else[len(s.Else)-1])
+	}
+	return true
+}
+
+// branchesTo reports whether any statement in stmts jumps to label.
+func branchesTo(stmts []Stmt, label int) bool {
+	return findJump(stmts, func(s Stmt) bool {
+		switch s := s.(type) {
+		case *BreakStmt:
+			return s.Label == label
+		case *ContinueStmt:
+			return s.Label == label
+		case *GotoStmt:
+			return s.Label == label
+		case *SwitchStmt:
+			return switchTargets(s, label)
+		}
+		return false
+	})
+}
+
+// switchesTo reports whether a br_table in stmts jumps to label.
+func switchesTo(stmts []Stmt, label int) bool {
+	return findJump(stmts, func(s Stmt) bool {
+		sw, ok := s.(*SwitchStmt)
+		return ok && switchTargets(sw, label)
+	})
+}
+
+// continuesTo reports whether stmts continue the loop label.
+func continuesTo(stmts []Stmt, label int) bool {
+	return findJump(stmts, func(s Stmt) bool {
+		cont, ok := s.(*ContinueStmt)
+		return ok && cont.Label == label
+	})
+}
+
+func switchTargets(s *SwitchStmt, label int) bool {
+	if s.Default == label {
+		return true
+	}
+	for _, c := range s.Cases {
+		if c == label {
+			return true
+		}
+	}
+	return false
+}
+
+// findJump reports whether match holds for a statement anywhere in stmts.
+func findJump(stmts []Stmt, match func(Stmt) bool) bool {
+	for _, stmt := range stmts {
+		if match(stmt) {
+			return true
+		}
+		for _, list := range bodies(stmt) {
+			if findJump(list, match) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// bodies returns the statement lists directly inside stmt.
+func bodies(stmt Stmt) [][]Stmt {
+	switch s := stmt.(type) {
+	case *IfStmt:
+		return [][]Stmt{s.Then, s.Else}
+	case *LoopStmt:
+		return [][]Stmt{s.Body}
+	case *BlockStmt:
+		return [][]Stmt{s.Body}
+	case *WhileStmt:
+		return [][]Stmt{s.Body}
+	case *DoWhileStmt:
+		return [][]Stmt{s.Body}
+	case *ForStmt:
+		return [][]Stmt{s.Body}
+	case *FlatSwitchStmt:
+		lists := [][]Stmt{s.Default}
+		for _, c := range s.Cases {
+			lists = append(lists, c.Body)
+		}
+		return lists
+	}
+	return nil
+}
+
+// jumpIndex answers whether a statement jumps to a label without walking
+// it again, for the passes that ask about the same deeply nested blocks at
+// every level. Statements are numbered in the order they are written: one
+// spans the numbers of those inside it, and each label keeps the numbers of
+// the branches and the br_tables jumping to it.
+type jumpIndex struct {
+	spans    map[Stmt][2]int
+	branches map[int][]int
+	switches map[int][]int
+}
+
+func newJumpIndex(stmts []Stmt) *jumpIndex {
+	ji := &jumpIndex{spans: make(map[Stmt][2]int), branches: make(map[int][]int), switches: make(map[int][]int)}
+	n := 0
+	var walk func([]Stmt)
+	walk = func(list []Stmt) {
+		for _, stmt := range list {
+			start := n
+			n++
+			switch s := stmt.(type) {
+			case *BreakStmt:
+				ji.branches[s.Label] = append(ji.branches[s.Label], start)
+			case *ContinueStmt:
+				ji.branches[s.Label] = append(ji.branches[s.Label], start)
+			case *GotoStmt:
+				ji.branches[s.Label] = append(ji.branches[s.Label], start)
+			case *SwitchStmt:
+				for label := range switchLabels(s) {
+					ji.switches[label] = append(ji.switches[label], start)
+				}
+			}
+			for _, inner := range bodies(stmt) {
+				walk(inner)
+			}
+			ji.spans[stmt] = [2]int{start, n}
+		}
+	}
+	walk(stmts)
+	return ji
+}
+
+// switchLabels returns the labels a br_table jumps to.
+func switchLabels(s *SwitchStmt) map[int]bool {
+	labels := map[int]bool{s.Default: true}
+	for _, label := range s.Cases {
+		labels[label] = true
+	}
+	return labels
+}
+
+// jumpsTo reports whether stmt or a statement inside it jumps to label.
+// Statements made after the index are walked.
+func (ji *jumpIndex) jumpsTo(stmt Stmt, label int) bool {
+	span, ok := ji.spans[stmt]
+	if !ok {
+		return branchesTo([]Stmt{stmt}, label)
+	}
+	return within(ji.branches[label], span) || within(ji.switches[label], span)
+}
+
+func within(at []int, span [2]int) bool {
+	i, _ := slices.BinarySearch(at, span[0])
+	return i < len(at) && at[i] < span[1]
+}
+
+func (ji *jumpIndex) branchesTo(stmts []Stmt, label int) bool {
+	for _, stmt := range stmts {
+		if ji.jumpsTo(stmt, label) {
+			return true
+		}
+	}
+	return false
+}
+
+// onlyFrom reports whether no statement but sw jumps to label.
+func (ji *jumpIndex) onlyFrom(label int, sw *SwitchStmt) bool {
+	at := ji.switches[label]
+	return len(ji.branches[label]) == 0 && (len(at) == 0 || len(at) == 1 && at[0] == ji.spans[sw][0])
+}
+
+// jumpScope is a loop or switch a break or continue is printed inside. A
+// kept loop block has label -1, which no jump can leave out.
+type jumpScope struct {
+	label int
+	loop  bool
+}
+
+// bareJump reports whether a break or, with cont, a continue of label can
+// leave the label out inside scopes, the enclosing loops and switches with
+// the innermost last.
+func bareJump(scopes []jumpScope, label int, cont bool) bool {
+	for i := len(scopes) - 1; i >= 0; i-- {
+		if cont && !scopes[i].loop {
+			continue
+		}
+		return scopes[i].label == label
+	}
+	return false
+}
+
+// labeledLoops returns the loops and switches that a break or continue has
+// to name.
+func labeledLoops(stmts []Stmt) map[int]bool {
+	labeled := make(map[int]bool)
+	var walk func(list []Stmt, scopes []jumpScope)
+	walk = func(list []Stmt, scopes []jumpScope) {
+		inner := func(label int, loop bool) []jumpScope {
+			return append(scopes[:len(scopes):len(scopes)], jumpScope{label, loop})
+		}
+		for _, stmt := range list {
+			switch s := stmt.(type) {
+			case *BreakStmt:
+				if hasScope(scopes, s.Label) && !bareJump(scopes, s.Label, false) {
+					labeled[s.Label] = true
+				}
+			case *ContinueStmt:
+				if !bareJump(scopes, s.Label, true) {
+					labeled[s.Label] = true
+				}
+			case *IfStmt:
+				walk(s.Then, scopes)
+				walk(s.Else, scopes)
+			case *BlockStmt:
+				walk(s.Body, scopes)
+			case *LoopStmt:
+				walk(s.Body, inner(-1, true))
+			case *WhileStmt:
+				walk(s.Body, inner(s.Label, true))
+			case *DoWhileStmt:
+				walk(s.Body, inner(s.Label, true))
+			case *ForStmt:
+				walk(s.Body, inner(s.Label, true))
+			case *FlatSwitchStmt:
+				for _, c := range s.Cases {
+					walk(c.Body, inner(s.Label, false))
+				}
+				walk(s.Default, inner(s.Label, false))
+			}
+		}
+	}
+	walk(stmts, nil)
+	return labeled
+}
+
+func hasScope(scopes []jumpScope, label int) bool {
+	for _, s := range scopes {
+		if s.label == label {
+			return true
+		}
+	}
+	return false
+}
+
+// negatedCompare maps each integer comparison to the one that holds when it
+// does not.
+var negatedCompare = map[wasm.Opcode]wasm.Opcode{
+	0x46: 0x47, 0x47: 0x46, // i32.eq, i32.ne
+	0x48: 0x4e, 0x4e: 0x48, // i32.lt_s, i32.ge_s
+	0x4a: 0x4c, 0x4c: 0x4a, // i32.gt_s, i32.le_s
+	0x49: 0x4f, 0x4f: 0x49, // i32.lt_u, i32.ge_u
+	0x4b: 0x4d, 0x4d: 0x4b, // i32.gt_u, i32.le_u
+	0x51: 0x52, 0x52: 0x51, // i64.eq, i64.ne
+	0x53: 0x59, 0x59: 0x53, // i64.lt_s, i64.ge_s
+	0x55: 0x57, 0x57: 0x55, // i64.gt_s, i64.le_s
+	0x54: 0x5a, 0x5a: 0x54, // i64.lt_u, i64.ge_u
+	0x56: 0x58, 0x58: 0x56, // i64.gt_u, i64.le_u
+}
+
+func negateCond(e Expr) Expr {
+	switch v := e.(type) {
+	case *NotExpr:
+		return v.Arg
+	case *BinaryExpr:
+		if op, ok := negatedCompare[v.Op]; ok {
+			return &BinaryExpr{Op: op, Left: v.Left, Right: v.Right, Type: v.Type}
+		}
+	case *UnaryExpr:
+		if v.Op == 0x45 || v.Op == 0x50 { // i32.eqz, i64.eqz
+			return v.Arg
+		}
+	}
+	return &NotExpr{Arg: e}
+}
+
 func RecoverIfElse(body *FuncBody) {
 	body.Stmts = recoverIfElseInStmts(body.Stmts)
 }
@@ -183,7 +551,13 @@ func recoverIfElseInStmt(stmt Stmt) Stmt {
 		}
 
 	case *WhileStmt:
-		return &WhileStmt{Cond: s.Cond, Body: recoverIfElseInStmts(s.Body), Offsets: s.Offsets}
+		return &WhileStmt{Label: s.Label, Cond: s.Cond, Body: recoverIfElseInStmts(s.Body), Offsets: s.Offsets}
+
+	case *DoWhileStmt:
+		return &DoWhileStmt{Label: s.Label, Body: recoverIfElseInStmts(s.Body), Cond: s.Cond, Offsets: s.Offsets}
+
+	case *ForStmt:
+		return &ForStmt{Label: s.Label, Init: s.Init, Cond: s.Cond, Post: s.Post, Body: recoverIfElseInStmts(s.Body), Offsets: s.Offsets}
 	}
 	return stmt
 }
@@ -193,7 +567,7 @@ func tryConvertBlockToIf(block *BlockStmt) Stmt {
 		return nil
 	}
 	brk, ok := block.Body[0].(*BreakStmt)
-	if !ok || brk.Cond == nil || brk.Label != block.Label {
+	if !ok || brk.Cond == nil || brk.Label != block.Label || branchesTo(block.Body[1:], block.Label) {
 		return nil
 	}
 	thenBody := recoverIfElseInStmts(block.Body[1:])
@@ -0,0 +1,85 @@
+package decompile
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/0xInception/wasmspy/internal/wasmtest"
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+// loopsModule holds, by index:
+//
+//	0 count(p0):  v1 = 0; block { loop { br_if 1 (v1 >= p0); v2 += v1; v1 += 1; br 0 } }; return v2
+//	1 down(p0):   loop { p0 -= 1; br_if 0 (p0 > 0) }; return p0
+//	2 nested(p0): block { loop { p0 += 1; block { loop {
+//	                br_if 3 (p0 > 100); br_if 2 (p0 & 1); p0 += 3; br 0 } }; br 0 } }; return p0
+//	3 tail(p0):   loop { p0 *= 2; br_if 0 (p0 < 100); p0 += 7 }; return p0
+func loopsModule(t *testing.T) *wasm.ResolvedModule {
+	t.Helper()
+	return wasmtest.Module(t,
+		wasmtest.Section(0x01, 0x01, 0x60, 0x01, 0x7f, 0x01, 0x7f),
+		wasmtest.Section(0x03, 0x04, 0x00, 0x00, 0x00, 0x00),
+		wasmtest.Code(
+			wasmtest.Body(0x01, 0x02, 0x7f,
+				0x41, 0x00, 0x21, 0x01,
+				0x02, 0x40, 0x03, 0x40,
+				0x20, 0x01, 0x20, 0x00, 0x4e, 0x0d, 0x01,
+				0x20, 0x02, 0x20, 0x01, 0x6a, 0x21, 0x02,
+				0x20, 0x01, 0x41, 0x01, 0x6a, 0x21, 0x01,
+				0x0c, 0x00, 0x0b, 0x0b,
+				0x20, 0x02, 0x0b),
+			wasmtest.Body(0x00,
+				0x03, 0x40,
+				0x20, 0x00, 0x41, 0x01, 0x6b, 0x21, 0x00,
+				0x20, 0x00, 0x41, 0x00, 0x4a, 0x0d, 0x00,
+				0x0b,
+				0x20, 0x00, 0x0b),
+			wasmtest.Body(0x00,
+				0x02, 0x40, 0x03, 0x40,
+				0x20, 0x00, 0x41, 0x01, 0x6a, 0x21, 0x00,
+				0x02, 0x40, 0x03, 0x40,
+				0x20, 0x00, 0x41, 0xe4, 0x00, 0x4a, 0x0d, 0x03,
+				0x20, 0x00, 0x41, 0x01, 0x71, 0x0d, 0x02,
+				0x20, 0x00, 0x41, 0x03, 0x6a, 0x21, 0x00,
+				0x0c, 0x00, 0x0b, 0x0b,
+				0x0c, 0x00, 0x0b, 0x0b,
+				0x20, 0x00, 0x0b),
+			wasmtest.Body(0x00,
+				0x03, 0x40,
+				0x20, 0x00, 0x41, 0x02, 0x6c, 0x21, 0x00,
+				0x20, 0x00, 0x41, 0xe4, 0x00, 0x48, 0x0d, 0x00,
+				0x20, 0x00, 0x41, 0x07, 0x6a, 0x21, 0x00,
+				0x0b,
+				0x20, 0x00, 0x0b),
+		),
+	)
+}
+
+func TestRecoverLoops(t *testing.T) {
+	rm := loopsModule(t)
+	tests := []struct {
+		idx  uint32
+		want []string
+	}{
+		{0, []string{"for v1 = 0; (v1 < p0); v1 = (v1 + 1) {\n    v2 = (v2 + v1)\n  }"}},
+		{1, []string{"do {\n    p0 = (p0 - 1)\n  } while (p0 > 0)"}},
+		{2, []string{"L2: while true {", "if (p0 > 100) break L2", "continue L2"}},
+		{3, []string{"} while (p0 < 100)\n  p0 = (p0 + 7)"}},
+	}
+	for _, tt := range tests {
+		code := Decompile(rm.GetFunction(tt.idx), rm)
+		for _, w := range tt.want {
+			if !strings.Contains(code, w) {
+				t.Errorf("func %d: missing %q in\n%s", tt.idx, w, code)
+			}
+		}
+		if strings.Contains(code, "loop L") || strings.Contains(code, "block L") {
+			t.Errorf("func %d: loop left unstructured:\n%s", tt.idx, code)
+		}
+	}
+
+	for idx := uint32(0); idx < 4; idx++ {
+		checkEval(t, rm, idx, []uint64{1}, []uint64{7}, []uint64{200})
+	}
+}
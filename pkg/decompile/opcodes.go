@@ -91,6 +91,13 @@ var OpSignatures = map[wasm.Opcode]Signature{
 	wasm.OpI64ExtendI32S: {Inputs: []wasm.ValType{i32}, Outputs: []wasm.ValType{i64}},
 	wasm.OpI64ExtendI32U: {Inputs: []wasm.ValType{i32}, Outputs: []wasm.ValType{i64}},
 
+	wasm.OpF32Eq: {Inputs: []wasm.ValType{f32, f32}, Outputs: []wasm.ValType{i32}},
+	wasm.OpF32Ne: {Inputs: []wasm.ValType{f32, f32}, Outputs: []wasm.ValType{i32}},
+	wasm.OpF32Lt: {Inputs: []wasm.ValType{f32, f32}, Outputs: []wasm.ValType{i32}},
+	wasm.OpF32Gt: {Inputs: []wasm.ValType{f32, f32}, Outputs: []wasm.ValType{i32}},
+	wasm.OpF32Le: {Inputs: []wasm.ValType{f32, f32}, Outputs: []wasm.ValType{i32}},
+	wasm.OpF32Ge: {Inputs: []wasm.ValType{f32, f32}, Outputs: []wasm.ValType{i32}},
+
 	wasm.OpF64Eq: {Inputs: []wasm.ValType{f64, f64}, Outputs: []wasm.ValType{i32}},
 	wasm.OpF64Ne: {Inputs: []wasm.ValType{f64, f64}, Outputs: []wasm.ValType{i32}},
 	wasm.OpF64Lt: {Inputs: []wasm.ValType{f64, f64}, Outputs: []wasm.ValType{i32}},
@@ -98,8 +105,63 @@ var OpSignatures = map[wasm.Opcode]Signature{
 	wasm.OpF64Le: {Inputs: []wasm.ValType{f64, f64}, Outputs: []wasm.ValType{i32}},
 	wasm.OpF64Ge: {Inputs: []wasm.ValType{f64, f64}, Outputs: []wasm.ValType{i32}},
 
+	wasm.OpF32Abs:      {Inputs: []wasm.ValType{f32}, Outputs: []wasm.ValType{f32}},
+	wasm.OpF32Neg:      {Inputs: []wasm.ValType{f32}, Outputs: []wasm.ValType{f32}},
+	wasm.OpF32Ceil:     {Inputs: []wasm.ValType{f32}, Outputs: []wasm.ValType{f32}},
+	wasm.OpF32Floor:    {Inputs: []wasm.ValType{f32}, Outputs: []wasm.ValType{f32}},
+	wasm.OpF32Trunc:    {Inputs: []wasm.ValType{f32}, Outputs: []wasm.ValType{f32}},
+	wasm.OpF32Nearest:  {Inputs: []wasm.ValType{f32}, Outputs: []wasm.ValType{f32}},
+	wasm.OpF32Sqrt:     {Inputs: []wasm.ValType{f32}, Outputs: []wasm.ValType{f32}},
+	wasm.OpF32Add:      {Inputs: []wasm.ValType{f32, f32}, Outputs: []wasm.ValType{f32}},
+	wasm.OpF32Sub:      {Inputs: []wasm.ValType{f32, f32}, Outputs: []wasm.ValType{f32}},
+	wasm.OpF32Mul:      {Inputs: []wasm.ValType{f32, f32}, Outputs: []wasm.ValType{f32}},
+	wasm.OpF32Div:      {Inputs: []wasm.ValType{f32, f32}, Outputs: []wasm.ValType{f32}},
+	wasm.OpF32Min:      {Inputs: []wasm.ValType{f32, f32}, Outputs: []wasm.ValType{f32}},
+	wasm.OpF32Max:      {Inputs: []wasm.ValType{f32, f32}, Outputs: []wasm.ValType{f32}},
+	wasm.OpF32Copysign: {Inputs: []wasm.ValType{f32, f32}, Outputs: []wasm.ValType{f32}},
+
+	wasm.OpF64Abs:      {Inputs: []wasm.ValType{f64}, Outputs: []wasm.ValType{f64}},
+	wasm.OpF64Neg:      {Inputs: []wasm.ValType{f64}, Outputs: []wasm.ValType{f64}},
+	wasm.OpF64Ceil:     {Inputs: []wasm.ValType{f64}, Outputs: []wasm.ValType{f64}},
+	wasm.OpF64Floor:    {Inputs: []wasm.ValType{f64}, Outputs: []wasm.ValType{f64}},
+	wasm.OpF64Trunc:    {Inputs: []wasm.ValType{f64}, Outputs: []wasm.ValType{f64}},
+	wasm.OpF64Nearest:  {Inputs: []wasm.ValType{f64}, Outputs: []wasm.ValType{f64}},
+	wasm.OpF64Sqrt:     {Inputs: []wasm.ValType{f64}, Outputs: []wasm.ValType{f64}},
+	wasm.OpF64Add:      {Inputs: []wasm.ValType{f64, f64}, Outputs: []wasm.ValType{f64}},
+	wasm.OpF64Sub:      {Inputs: []wasm.ValType{f64, f64}, Outputs: []wasm.ValType{f64}},
+	wasm.OpF64Mul:      {Inputs: []wasm.ValType{f64, f64}, Outputs: []wasm.ValType{f64}},
+	wasm.OpF64Div:      {Inputs: []wasm.ValType{f64, f64}, Outputs: []wasm.ValType{f64}},
+	wasm.OpF64Min:      {Inputs: []wasm.ValType{f64, f64}, Outputs: []wasm.ValType{f64}},
+	wasm.OpF64Max:      {Inputs: []wasm.ValType{f64, f64}, Outputs: []wasm.ValType{f64}},
+	wasm.OpF64Copysign: {Inputs: []wasm.ValType{f64, f64}, Outputs: []wasm.ValType{f64}},
+
+	wasm.OpI32TruncF32S:      {Inputs: []wasm.ValType{f32}, Outputs: []wasm.ValType{i32}},
+	wasm.OpI32TruncF32U:      {Inputs: []wasm.ValType{f32}, Outputs: []wasm.ValType{i32}},
+	wasm.OpI32TruncF64S:      {Inputs: []wasm.ValType{f64}, Outputs: []wasm.ValType{i32}},
+	wasm.OpI32TruncF64U:      {Inputs: []wasm.ValType{f64}, Outputs: []wasm.ValType{i32}},
+	wasm.OpI64TruncF32S:      {Inputs: []wasm.ValType{f32}, Outputs: []wasm.ValType{i64}},
+	wasm.OpI64TruncF32U:      {Inputs: []wasm.ValType{f32}, Outputs: []wasm.ValType{i64}},
+	wasm.OpI64TruncF64S:      {Inputs: []wasm.ValType{f64}, Outputs: []wasm.ValType{i64}},
+	wasm.OpI64TruncF64U:      {Inputs: []wasm.ValType{f64}, Outputs: []wasm.ValType{i64}},
+	wasm.OpF32ConvertI32S:    {Inputs: []wasm.ValType{i32}, Outputs: []wasm.ValType{f32}},
+	wasm.OpF32ConvertI32U:    {Inputs: []wasm.ValType{i32}, Outputs: []wasm.ValType{f32}},
+	wasm.OpF32ConvertI64S:    {Inputs: []wasm.ValType{i64}, Outputs: []wasm.ValType{f32}},
+	wasm.OpF32ConvertI64U:    {Inputs: []wasm.ValType{i64}, Outputs: []wasm.ValType{f32}},
+	wasm.OpF32DemoteF64:      {Inputs: []wasm.ValType{f64}, Outputs: []wasm.ValType{f32}},
+	wasm.OpF64ConvertI32S:    {Inputs: []wasm.ValType{i32}, Outputs: []wasm.ValType{f64}},
+	wasm.OpF64ConvertI32U:    {Inputs: []wasm.ValType{i32}, Outputs: []wasm.ValType{f64}},
+	wasm.OpF64ConvertI64S:    {Inputs: []wasm.ValType{i64}, Outputs: []wasm.ValType{f64}},
+	wasm.OpF64ConvertI64U:    {Inputs: []wasm.ValType{i64}, Outputs: []wasm.ValType{f64}},
+	wasm.OpF64PromoteF32:     {Inputs: []wasm.ValType{f32}, Outputs: []wasm.ValType{f64}},
+	wasm.OpI32ReinterpretF32: {Inputs: []wasm.ValType{f32}, Outputs: []wasm.ValType{i32}},
 	wasm.OpI64ReinterpretF64: {Inputs: []wasm.ValType{f64}, Outputs: []wasm.ValType{i64}},
+	wasm.OpF32ReinterpretI32: {Inputs: []wasm.ValType{i32}, Outputs: []wasm.ValType{f32}},
 	wasm.OpF64ReinterpretI64: {Inputs: []wasm.ValType{i64}, Outputs: []wasm.ValType{f64}},
+	wasm.OpI32Extend8S:       {Inputs: []wasm.ValType{i32}, Outputs: []wasm.ValType{i32}},
+	wasm.OpI32Extend16S:      {Inputs: []wasm.ValType{i32}, Outputs: []wasm.ValType{i32}},
+	wasm.OpI64Extend8S:       {Inputs: []wasm.ValType{i64}, Outputs: []wasm.ValType{i64}},
+	wasm.OpI64Extend16S:      {Inputs: []wasm.ValType{i64}, Outputs: []wasm.ValType{i64}},
+	wasm.OpI64Extend32S:      {Inputs: []wasm.ValType{i64}, Outputs: []wasm.ValType{i64}},
 
 	wasm.OpI32Load:    {Inputs: []wasm.ValType{i32}, Outputs: []wasm.ValType{i32}},
 	wasm.OpI64Load:    {Inputs: []wasm.ValType{i32}, Outputs: []wasm.ValType{i64}},
@@ -154,5 +216,7 @@ var OpSignatures = map[wasm.Opcode]Signature{
 	wasm.OpTableCopy:  {Inputs: []wasm.ValType{i32, i32, i32}},
 	wasm.OpTableGrow:  {Inputs: []wasm.ValType{i32, i32}, Outputs: []wasm.ValType{i32}},
 	wasm.OpTableSize:  {Outputs: []wasm.ValType{i32}},
+	wasm.OpTableGet:   {Inputs: []wasm.ValType{i32}, Outputs: []wasm.ValType{wasm.ValFuncRef}},
+	wasm.OpTableSet:   {Inputs: []wasm.ValType{i32, wasm.ValFuncRef}},
 	wasm.OpTableFill:  {Inputs: []wasm.ValType{i32, i32, i32}},
 }
@@ -55,11 +55,7 @@ func (e *CallExpr) String() string {
 }
 
 func (e *LoadExpr) String() string {
-	addr := exprString(e.Addr)
-	if e.Offset > 0 {
-		return fmt.Sprintf("mem[%s + %d]", addr, e.Offset)
-	}
-	return fmt.Sprintf("mem[%s]", addr)
+	return memString(e.Op, e.Addr, e.Offset)
 }
 
 func (e *TernaryExpr) String() string {
@@ -75,12 +71,15 @@ func (s *AssignStmt) String() string {
 }
 
 func (s *StoreStmt) String() string {
-	addr := exprString(s.Addr)
-	val := exprString(s.Value)
-	if s.Offset > 0 {
-		return fmt.Sprintf("mem[%s + %d] = %s", addr, s.Offset, val)
+	return fmt.Sprintf("%s = %s", memString(s.Op, s.Addr, s.Offset), exprString(s.Value))
+}
+
+func memString(op wasm.Opcode, addr Expr, offset uint32) string {
+	t := memCType(op)
+	if offset > 0 {
+		return fmt.Sprintf("*(%s*)(%s + %d)", t, exprString(addr), offset)
 	}
-	return fmt.Sprintf("mem[%s] = %s", addr, val)
+	return fmt.Sprintf("*(%s*)%s", t, exprString(addr))
 }
 
 func (s *CallStmt) String() string {
@@ -125,8 +124,27 @@ func (s *WhileStmt) String() string {
 	return fmt.Sprintf("while %s { ... }", exprString(s.Cond))
 }
 
+func (s *DoWhileStmt) String() string {
+	return fmt.Sprintf("do { ... } while %s", exprString(s.Cond))
+}
+
+func (s *ForStmt) String() string {
+	return fmt.Sprintf("for %s; %s; %s { ... }", s.Init, exprString(s.Cond), s.Post)
+}
+
 func (s *ContinueStmt) String() string {
-	return "continue"
+	return fmt.Sprintf("continue L%d", s.Label)
+}
+
+func (s *GotoStmt) String() string {
+	if s.Cond != nil {
+		return fmt.Sprintf("if %s goto L%d", exprString(s.Cond), s.Label)
+	}
+	return fmt.Sprintf("goto L%d", s.Label)
+}
+
+func (s *LabelStmt) String() string {
+	return fmt.Sprintf("L%d:", s.Label)
 }
 
 func stmtString(s Stmt) string {
@@ -153,8 +171,16 @@ func stmtString(s Stmt) string {
 		return v.String()
 	case *WhileStmt:
 		return v.String()
+	case *DoWhileStmt:
+		return v.String()
+	case *ForStmt:
+		return v.String()
 	case *ContinueStmt:
 		return v.String()
+	case *GotoStmt:
+		return v.String()
+	case *LabelStmt:
+		return v.String()
 	}
 	return "?"
 }
@@ -190,13 +216,13 @@ func exprString(e Expr) string {
 
 func opSymbol(op wasm.Opcode) string {
 	switch op {
-	case wasm.OpI32Add, wasm.OpI64Add:
+	case wasm.OpI32Add, wasm.OpI64Add, wasm.OpF32Add, wasm.OpF64Add:
 		return "+"
-	case wasm.OpI32Sub, wasm.OpI64Sub:
+	case wasm.OpI32Sub, wasm.OpI64Sub, wasm.OpF32Sub, wasm.OpF64Sub:
 		return "-"
-	case wasm.OpI32Mul, wasm.OpI64Mul:
+	case wasm.OpI32Mul, wasm.OpI64Mul, wasm.OpF32Mul, wasm.OpF64Mul:
 		return "*"
-	case wasm.OpI32DivS, wasm.OpI32DivU, wasm.OpI64DivS, wasm.OpI64DivU:
+	case wasm.OpI32DivS, wasm.OpI32DivU, wasm.OpI64DivS, wasm.OpI64DivU, wasm.OpF32Div, wasm.OpF64Div:
 		return "/"
 	case wasm.OpI32RemS, wasm.OpI32RemU, wasm.OpI64RemS, wasm.OpI64RemU:
 		return "%"
@@ -210,17 +236,17 @@ func opSymbol(op wasm.Opcode) string {
 		return "<<"
 	case wasm.OpI32ShrS, wasm.OpI32ShrU, wasm.OpI64ShrS, wasm.OpI64ShrU:
 		return ">>"
-	case wasm.OpI32Eq, wasm.OpI64Eq, wasm.OpF64Eq:
+	case wasm.OpI32Eq, wasm.OpI64Eq, wasm.OpF32Eq, wasm.OpF64Eq:
 		return "=="
-	case wasm.OpI32Ne, wasm.OpI64Ne, wasm.OpF64Ne:
+	case wasm.OpI32Ne, wasm.OpI64Ne, wasm.OpF32Ne, wasm.OpF64Ne:
 		return "!="
-	case wasm.OpI32LtS, wasm.OpI32LtU, wasm.OpI64LtS, wasm.OpI64LtU, wasm.OpF64Lt:
+	case wasm.OpI32LtS, wasm.OpI32LtU, wasm.OpI64LtS, wasm.OpI64LtU, wasm.OpF32Lt, wasm.OpF64Lt:
 		return "<"
-	case wasm.OpI32GtS, wasm.OpI32GtU, wasm.OpI64GtS, wasm.OpI64GtU, wasm.OpF64Gt:
+	case wasm.OpI32GtS, wasm.OpI32GtU, wasm.OpI64GtS, wasm.OpI64GtU, wasm.OpF32Gt, wasm.OpF64Gt:
 		return ">"
-	case wasm.OpI32LeS, wasm.OpI32LeU, wasm.OpI64LeS, wasm.OpI64LeU, wasm.OpF64Le:
+	case wasm.OpI32LeS, wasm.OpI32LeU, wasm.OpI64LeS, wasm.OpI64LeU, wasm.OpF32Le, wasm.OpF64Le:
 		return "<="
-	case wasm.OpI32GeS, wasm.OpI32GeU, wasm.OpI64GeS, wasm.OpI64GeU, wasm.OpF64Ge:
+	case wasm.OpI32GeS, wasm.OpI32GeU, wasm.OpI64GeS, wasm.OpI64GeU, wasm.OpF32Ge, wasm.OpF64Ge:
 		return ">="
 	}
 	return wasm.OpcodeNames[op]
@@ -123,11 +123,18 @@ func simplifyTernary(e *TernaryExpr) Expr {
 	then := Simplify(e.ThenResult)
 	els := Simplify(e.ElseResult)
 
+	// A constant condition picks one side, unless evaluating the other
+	// does something.
 	if c, ok := cond.(*ConstExpr); ok {
-		if !isZero(c) {
-			return then
+		taken, other := then, els
+		if isZero(c) {
+			taken, other = els, then
+		}
+		a := &access{}
+		exprAccess(other, a)
+		if a.pure() {
+			return taken
 		}
-		return els
 	}
 
 	if cond != e.Cond || then != e.ThenResult || els != e.ElseResult {
@@ -183,10 +190,6 @@ func toInt64(v any) (int64, bool) {
 		return int64(x), true
 	case int64:
 		return x, true
-	case uint32:
-		return int64(x), true
-	case uint64:
-		return int64(x), true
 	}
 	return 0, false
 }
@@ -201,41 +204,53 @@ func SimplifyBody(body *FuncBody) {
 }
 
 func CollapseSwitchBlocks(body *FuncBody) {
-	body.Stmts = collapseSwitchInStmts(body.Stmts)
+	body.Stmts = collapseSwitchInStmts(body.Stmts, newJumpIndex(body.Stmts))
 }
 
-func collapseSwitchInStmts(stmts []Stmt) []Stmt {
+func collapseSwitchInStmts(stmts []Stmt, jumps *jumpIndex) []Stmt {
 	result := make([]Stmt, 0, len(stmts))
 	for _, stmt := range stmts {
-		result = append(result, collapseSwitchInStmt(stmt))
+		if b, ok := stmt.(*BlockStmt); ok {
+			if flat := tryCollapseSwitch(b, jumps); flat != nil {
+				result = append(result, flat...)
+				continue
+			}
+		}
+		result = append(result, collapseSwitchInStmt(stmt, jumps))
 	}
 	return result
 }
 
-func collapseSwitchInStmt(stmt Stmt) Stmt {
+func collapseSwitchInStmt(stmt Stmt, jumps *jumpIndex) Stmt {
 	switch s := stmt.(type) {
 	case *BlockStmt:
-		if flat := tryCollapseSwitch(s); flat != nil {
-			return flat
-		}
-		return &BlockStmt{Label: s.Label, Body: collapseSwitchInStmts(s.Body), SrcOffset: s.SrcOffset, EndOffset: s.EndOffset, Offsets: s.Offsets}
+		return &BlockStmt{Label: s.Label, Body: collapseSwitchInStmts(s.Body, jumps), SrcOffset: s.SrcOffset, EndOffset: s.EndOffset, Offsets: s.Offsets}
 	case *IfStmt:
-		return &IfStmt{Cond: s.Cond, Then: collapseSwitchInStmts(s.Then), Else: collapseSwitchInStmts(s.Else), SrcOffset: s.SrcOffset, EndOffset: s.EndOffset, Offsets: s.Offsets}
+		return &IfStmt{Cond: s.Cond, Then: collapseSwitchInStmts(s.Then, jumps), Else: collapseSwitchInStmts(s.Else, jumps), SrcOffset: s.SrcOffset, EndOffset: s.EndOffset, Offsets: s.Offsets}
 	case *LoopStmt:
-		return &LoopStmt{Label: s.Label, Body: collapseSwitchInStmts(s.Body), SrcOffset: s.SrcOffset, EndOffset: s.EndOffset, Offsets: s.Offsets}
+		return &LoopStmt{Label: s.Label, Body: collapseSwitchInStmts(s.Body, jumps), SrcOffset: s.SrcOffset, EndOffset: s.EndOffset, Offsets: s.Offsets}
 	case *WhileStmt:
-		return &WhileStmt{Cond: s.Cond, Body: collapseSwitchInStmts(s.Body), Offsets: s.Offsets}
+		return &WhileStmt{Label: s.Label, Cond: s.Cond, Body: collapseSwitchInStmts(s.Body, jumps), Offsets: s.Offsets}
+	case *DoWhileStmt:
+		return &DoWhileStmt{Label: s.Label, Body: collapseSwitchInStmts(s.Body, jumps), Cond: s.Cond, Offsets: s.Offsets}
+	case *ForStmt:
+		return &ForStmt{Label: s.Label, Init: s.Init, Cond: s.Cond, Post: s.Post, Body: collapseSwitchInStmts(s.Body, jumps), Offsets: s.Offsets}
 	case *FlatSwitchStmt:
 		cases := make([]SwitchCase, len(s.Cases))
 		for i, c := range s.Cases {
-			cases[i] = SwitchCase{Value: c.Value, Body: collapseSwitchInStmts(c.Body)}
+			cases[i] = SwitchCase{Value: c.Value, Body: collapseSwitchInStmts(c.Body, jumps)}
 		}
-		return &FlatSwitchStmt{Value: s.Value, Cases: cases, Default: collapseSwitchInStmts(s.Default), Offsets: s.Offsets}
+		return &FlatSwitchStmt{Label: s.Label, Value: s.Value, Cases: cases, Default: collapseSwitchInStmts(s.Default, jumps), Offsets: s.Offsets}
 	}
 	return stmt
 }
 
-func tryCollapseSwitch(outerBlock *BlockStmt) *FlatSwitchStmt {
+// tryCollapseSwitch turns a chain of blocks ending in a br_table into the
+// statements before the br_table and a switch whose case holds what follows
+// the block it branches out of. A case reaching the next block's statements
+// by falling off its own, or a branch to one of the inner blocks, leaves
+// the chain as it is, since the switch keeps neither.
+func tryCollapseSwitch(outerBlock *BlockStmt, jumps *jumpIndex) []Stmt {
 	blocks := []*BlockStmt{outerBlock}
 	bodies := [][]Stmt{nil}
 	current := outerBlock
@@ -259,9 +274,10 @@ func tryCollapseSwitch(outerBlock *BlockStmt) *FlatSwitchStmt {
 	}
 
 	var sw *SwitchStmt
-	for _, stmt := range current.Body {
+	var pre []Stmt
+	for i, stmt := range current.Body {
 		if s, ok := stmt.(*SwitchStmt); ok {
-			sw = s
+			sw, pre = s, current.Body[:i]
 			break
 		}
 	}
@@ -272,41 +288,58 @@ func tryCollapseSwitch(outerBlock *BlockStmt) *FlatSwitchStmt {
 	labelToIdx := make(map[int]int)
 	for i, b := range blocks {
 		labelToIdx[b.Label] = i
+		if jumps.branchesTo(pre, b.Label) || i > 0 && !jumps.onlyFrom(b.Label, sw) {
+			return nil
+		}
 	}
 
 	outerLabel := blocks[0].Label
+	caseBody := func(label int) ([]Stmt, bool) {
+		idx, ok := labelToIdx[label]
+		if !ok {
+			return []Stmt{&BreakStmt{Label: label, Offsets: sw.Offsets}}, true
+		}
+		for idx > 0 && len(bodies[idx]) == 0 {
+			idx--
+		}
+		if idx > 1 && fallsThrough(bodies[idx][len(bodies[idx])-1]) {
+			return nil, false
+		}
+		return extractCaseBody(bodies[idx], outerLabel, jumps), true
+	}
+
 	cases := make([]SwitchCase, 0, len(sw.Cases))
 	for i, label := range sw.Cases {
-		idx, ok := labelToIdx[label]
+		body, ok := caseBody(label)
 		if !ok {
 			return nil
 		}
-		body := extractCaseBody(bodies[idx], outerLabel)
 		cases = append(cases, SwitchCase{Value: i, Body: body})
 	}
-
-	var defaultBody []Stmt
-	if defIdx, ok := labelToIdx[sw.Default]; ok {
-		defaultBody = extractCaseBody(bodies[defIdx], outerLabel)
+	defaultBody, ok := caseBody(sw.Default)
+	if !ok {
+		return nil
 	}
 
-	return &FlatSwitchStmt{
+	return append(collapseSwitchInStmts(pre, jumps), &FlatSwitchStmt{
+		Label:   outerLabel,
 		Value:   sw.Value,
 		Cases:   cases,
 		Default: defaultBody,
 		Offsets: sw.Offsets,
-	}
+	})
 }
 
-func extractCaseBody(stmts []Stmt, outerLabel int) []Stmt {
-	result := make([]Stmt, 0, len(stmts))
-	for _, stmt := range stmts {
+// extractCaseBody returns the statements of a case up to its branch out of
+// the switch.
+func extractCaseBody(stmts []Stmt, outerLabel int, jumps *jumpIndex) []Stmt {
+	for i, stmt := range stmts {
 		if br, ok := stmt.(*BreakStmt); ok && br.Label == outerLabel && br.Cond == nil {
-			continue
+			stmts = stmts[:i]
+			break
 		}
-		result = append(result, collapseSwitchInStmt(stmt))
 	}
-	return result
+	return collapseSwitchInStmts(stmts, jumps)
 }
 
 func simplifyStmt(s Stmt) Stmt {
@@ -351,6 +384,10 @@ func simplifyStmt(s Stmt) Stmt {
 		if v.Cond != nil {
 			return &BreakStmt{Label: v.Label, Cond: Simplify(v.Cond), SrcOffset: v.SrcOffset, Offsets: v.Offsets}
 		}
+	case *GotoStmt:
+		if v.Cond != nil {
+			return &GotoStmt{Label: v.Label, Cond: Simplify(v.Cond), SrcOffset: v.SrcOffset, Offsets: v.Offsets}
+		}
 	case *SwitchStmt:
 		return &SwitchStmt{Value: Simplify(v.Value), Cases: v.Cases, Default: v.Default, Offsets: v.Offsets}
 	case *FlatSwitchStmt:
@@ -366,13 +403,27 @@ func simplifyStmt(s Stmt) Stmt {
 		for i := range v.Default {
 			def[i] = simplifyStmt(v.Default[i])
 		}
-		return &FlatSwitchStmt{Value: Simplify(v.Value), Cases: cases, Default: def, Offsets: v.Offsets}
+		return &FlatSwitchStmt{Label: v.Label, Value: Simplify(v.Value), Cases: cases, Default: def, Offsets: v.Offsets}
 	case *WhileStmt:
 		body := make([]Stmt, len(v.Body))
 		for i := range v.Body {
 			body[i] = simplifyStmt(v.Body[i])
 		}
-		return &WhileStmt{Cond: Simplify(v.Cond), Body: body, Offsets: v.Offsets}
+		return &WhileStmt{Label: v.Label, Cond: Simplify(v.Cond), Body: body, Offsets: v.Offsets}
+	case *DoWhileStmt:
+		body := make([]Stmt, len(v.Body))
+		for i := range v.Body {
+			body[i] = simplifyStmt(v.Body[i])
+		}
+		return &DoWhileStmt{Label: v.Label, Body: body, Cond: Simplify(v.Cond), Offsets: v.Offsets}
+	case *ForStmt:
+		body := make([]Stmt, len(v.Body))
+		for i := range v.Body {
+			body[i] = simplifyStmt(v.Body[i])
+		}
+		init := simplifyStmt(v.Init).(*AssignStmt)
+		post := simplifyStmt(v.Post).(*AssignStmt)
+		return &ForStmt{Label: v.Label, Init: init, Cond: Simplify(v.Cond), Post: post, Body: body, Offsets: v.Offsets}
 	}
 	return s
 }
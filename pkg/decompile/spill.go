@@ -0,0 +1,211 @@
+package decompile
+
+import "github.com/0xInception/wasmspy/pkg/wasm"
+
+// access summarises what evaluating an expression reads and does, or what
+// a statement changes. Values stay on the stack unevaluated until an
+// instruction consumes them, so before a statement is emitted every value
+// below it whose meaning the statement would change, or whose effects it
+// would reorder, is spilled to a temporary.
+type access struct {
+	locals  []uint32
+	globals []uint32
+	// mem is set by loads and memory.size in a value, and by writes of
+	// memory in a statement.
+	mem bool
+	// effect is a call or another write of memory, tables or globals.
+	effect bool
+	trap   bool
+	// reads is set on a statement evaluating loads or globals itself.
+	reads  bool
+	branch bool
+}
+
+// pure reports whether evaluating the expression can be skipped.
+func (a *access) pure() bool {
+	return !a.effect && !a.trap
+}
+
+func (a *access) constant() bool {
+	return len(a.locals) == 0 && len(a.globals) == 0 && !a.mem && a.pure()
+}
+
+// include adds what evaluating an operand of the statement does.
+func (a *access) include(v *access) {
+	a.effect = a.effect || v.effect
+	a.trap = a.trap || v.trap
+	a.reads = a.reads || v.mem || len(v.globals) > 0
+}
+
+// changes reports whether executing statement a before value v would give v
+// a different result or reorder their effects.
+func (a *access) changes(v *access) bool {
+	for _, l := range a.locals {
+		if hasIndex(v.locals, l) {
+			return true
+		}
+	}
+	for _, g := range a.globals {
+		if hasIndex(v.globals, g) {
+			return true
+		}
+	}
+	writes := a.effect || a.mem || len(a.globals) > 0
+	switch {
+	case a.mem && v.mem, a.effect && (v.mem || len(v.globals) > 0):
+		return true
+	case v.effect && (writes || a.trap || a.reads || a.branch):
+		return true
+	case v.trap && (writes || a.branch):
+		return true
+	}
+	return false
+}
+
+func hasIndex(list []uint32, idx uint32) bool {
+	for _, i := range list {
+		if i == idx {
+			return true
+		}
+	}
+	return false
+}
+
+func exprAccess(e Expr, a *access) {
+	switch e := e.(type) {
+	case *LocalExpr:
+		a.locals = append(a.locals, e.Index)
+	case *ParamExpr:
+		a.locals = append(a.locals, e.Index)
+	case *GlobalExpr:
+		a.globals = append(a.globals, e.Index)
+	case *LoadExpr:
+		a.mem, a.trap = true, true
+		exprAccess(e.Addr, a)
+	case *CallExpr:
+		a.effect, a.trap = true, true
+		for _, arg := range e.Args {
+			exprAccess(arg, a)
+		}
+	case *BinaryExpr:
+		a.trap = a.trap || mayTrap(e.Op)
+		exprAccess(e.Left, a)
+		exprAccess(e.Right, a)
+	case *UnaryExpr:
+		reads, writes := stateAccess(e.Op)
+		a.mem = a.mem || reads
+		a.effect = a.effect || writes
+		a.trap = a.trap || mayTrap(e.Op)
+		exprAccess(e.Arg, a)
+	case *TernaryExpr:
+		exprAccess(e.Cond, a)
+		exprAccess(e.ThenResult, a)
+		exprAccess(e.ElseResult, a)
+	case *NegExpr:
+		exprAccess(e.Arg, a)
+	case *NotExpr:
+		exprAccess(e.Arg, a)
+	}
+}
+
+// valueAccess returns what evaluating v does.
+func (b *stmtBuilder) valueAccess(v *Value) *access {
+	if a, ok := b.accesses[v]; ok {
+		return a
+	}
+	a := &access{}
+	exprAccess(ValueToExpr(v), a)
+	if b.accesses == nil {
+		b.accesses = make(map[*Value]*access)
+	}
+	b.accesses[v] = a
+	return a
+}
+
+// spill evaluates into temporaries the values on the stack, except the top
+// keep ones, that statement s would change. Values it spills are evaluated
+// before s, so values below them are checked against those too.
+func (b *stmtBuilder) spill(s *access, keep int) {
+	n := len(b.stack) - keep
+	if n < 0 {
+		n = 0
+	}
+	marked := make([]bool, n)
+	for k := n - 1; k >= 0; k-- {
+		v := b.valueAccess(b.stack[k])
+		if s.changes(v) {
+			marked[k] = true
+			s.include(v)
+		}
+	}
+	// Held writes are older than the values on the stack, so they go first.
+	b.release(s, len(b.held), false)
+	for k, m := range marked {
+		if m {
+			b.stack[k] = b.materialize(b.stack[k])
+		}
+	}
+}
+
+// spillSelect evaluates into temporaries the operands of a select, the top
+// three values on the stack, that have effects or may trap. The select
+// evaluates all three in order, but the ternary it becomes evaluates the
+// condition first and then only one of the others.
+func (b *stmtBuilder) spillSelect() {
+	n := len(b.stack)
+	for k := n - 3; k < n; k++ {
+		if k < 0 {
+			continue
+		}
+		a := b.valueAccess(b.stack[k])
+		if a.pure() {
+			continue
+		}
+		s := &access{}
+		s.include(a)
+		b.spill(s, n-k)
+		b.stack[k] = b.materialize(b.stack[k])
+	}
+}
+
+// spillAll evaluates every value on the stack that is not a constant, ahead
+// of a block the values are used after.
+func (b *stmtBuilder) spillAll() {
+	b.releaseAll()
+	for k, v := range b.stack {
+		if !b.valueAccess(v).constant() {
+			b.stack[k] = b.materialize(v)
+		}
+	}
+}
+
+// materialize assigns v to a new temporary and returns a read of it.
+func (b *stmtBuilder) materialize(v *Value) *Value {
+	idx := uint32(b.numLocals + len(b.temps))
+	b.temps = append(b.temps, v.Type)
+	var src uint64
+	if v.Instr != nil {
+		src = v.Instr.Offset
+	}
+	b.emit(&AssignStmt{
+		Target:    &LocalExpr{Index: idx, Type: v.Type},
+		Value:     ValueToExpr(v),
+		SrcOffset: src,
+		Offsets:   CollectValueOffsets(v),
+	})
+	return &Value{Type: v.Type, Source: SourceLocal, Index: idx, Instr: v.Instr}
+}
+
+// localValue is a read of local idx.
+func (b *stmtBuilder) localValue(idx uint32, instr *wasm.Instruction) *Value {
+	src := SourceLocal
+	if b.fn.Type != nil && int(idx) < len(b.fn.Type.Params) {
+		src = SourceParam
+	}
+	return &Value{Type: b.locals[idx].Type, Source: src, Index: idx, Instr: instr}
+}
+
+// isLocal reports whether v is a read of local idx.
+func isLocal(v *Value, idx uint32) bool {
+	return v != nil && (v.Source == SourceLocal || v.Source == SourceParam) && v.Index == idx
+}
@@ -0,0 +1,785 @@
+package decompile
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/0xInception/wasmspy/pkg/cfg"
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+// SSAOp is the kind of an SSA value.
+type SSAOp int
+
+const (
+	// SSAParam is an incoming parameter.
+	SSAParam SSAOp = iota
+	// SSAZero is the initial zero of a declared local.
+	SSAZero
+	// SSAEntry is the memory, table and global state on entry.
+	SSAEntry
+	// SSAPhi merges the values reaching a join block, one per incoming
+	// branch.
+	SSAPhi
+	// SSAGet is a read of a local; Args[0] is the value it reads.
+	SSAGet
+	// SSASet is a write of a local by local.set or local.tee; Args[0] is
+	// the value written.
+	SSASet
+	// SSAInstr is any other instruction.
+	SSAInstr
+)
+
+// StateVar is the Local of phis merging the memory, table and global state.
+const StateVar = -2
+
+// SSAValue is a value defined exactly once. Instructions that read or write
+// memory, tables or globals, and calls, are chained through State: a value
+// reading the state refers to the last write before it, and a value writing
+// it becomes the state later ones refer to, so their order is explicit.
+type SSAValue struct {
+	ID    int
+	Op    SSAOp
+	Instr *wasm.Instruction
+	// Pos is the index of Instr in the body, or -1.
+	Pos int
+	// Block is the graph block the value is defined in.
+	Block int
+	Type  wasm.ValType
+	// Local is the local a param, zero, get or set refers to. For phis it
+	// is the merged local, StateVar, or -1 for a block result.
+	Local int
+	Args  []*SSAValue
+	State *SSAValue
+	// Effect is set on values that write the state, and Trap on values that
+	// may trap; neither can be removed.
+	Effect bool
+	Trap   bool
+	// Implicit marks the read a local.tee leaves on the stack.
+	Implicit bool
+
+	replaced *SSAValue
+}
+
+// SSAFunc is the SSA form of a function body over its control-flow graph.
+// Code the graph shows unreachable has no values.
+type SSAFunc struct {
+	Func  *wasm.ResolvedFunction
+	Graph *cfg.Graph
+	// Values lists every value in definition order.
+	Values []*SSAValue
+	// Phis lists the phis of each block.
+	Phis [][]*SSAValue
+	// Entry holds, for each reachable block, the value of each local and
+	// then of the state on entry to it.
+	Entry [][]*SSAValue
+	// ByPos is the value defined by each instruction, or nil.
+	ByPos []*SSAValue
+	// Roots are the values the function's behaviour depends on besides
+	// effects and traps: branch conditions, results and dropped values.
+	Roots []*SSAValue
+
+	// Live marks the values EliminateDeadCode kept.
+	Live []bool
+
+	blockOf []int
+}
+
+type ssaFrame struct {
+	op     wasm.Opcode
+	height int
+	result wasm.ValType
+	live   bool
+	// entry is the locals and state at an if, restored for its else.
+	entry []*SSAValue
+	// phis are a loop header's phis, one per local and the state.
+	phis []*SSAValue
+	// in are the locals and state, then the result, reaching the end.
+	in [][]*SSAValue
+}
+
+type ssaBuilder struct {
+	f       *SSAFunc
+	module  *wasm.ResolvedModule
+	types   []wasm.ValType
+	vars    []*SSAValue
+	stack   []*SSAValue
+	frames  []*ssaFrame
+	dead    bool
+	blockOf []int
+	pos     int
+}
+
+// BuildSSA builds the SSA form of a defined function. Bodies using
+// instructions or block types it does not model give an error.
+func BuildSSA(fn *wasm.ResolvedFunction, module *wasm.ResolvedModule) (*SSAFunc, error) {
+	if fn.Type == nil {
+		return nil, fmt.Errorf("function %d has no type", fn.Index)
+	}
+	if len(fn.Type.Results) > 1 {
+		return nil, fmt.Errorf("function %d returns %d values", fn.Index, len(fn.Type.Results))
+	}
+	g, err := cfg.Build(fn)
+	if err != nil {
+		return nil, err
+	}
+	instrs := fn.Body.Instructions
+	f := &SSAFunc{
+		Func:  fn,
+		Graph: g,
+		Phis:  make([][]*SSAValue, len(g.Blocks)),
+		Entry: make([][]*SSAValue, len(g.Blocks)),
+		ByPos: make([]*SSAValue, len(instrs)),
+	}
+	f.blockOf = make([]int, len(instrs))
+	b := &ssaBuilder{f: f, module: module, blockOf: f.blockOf}
+	for _, blk := range g.Blocks {
+		for i := blk.Start; i < blk.End && i < len(instrs); i++ {
+			b.blockOf[i] = blk.Index
+		}
+	}
+
+	numParams := len(fn.Type.Params)
+	for i, l := range buildLocals(fn) {
+		b.types = append(b.types, l.Type)
+		op := SSAZero
+		if i < numParams {
+			op = SSAParam
+		}
+		b.vars = append(b.vars, b.value(op, l.Type, i))
+	}
+	b.vars = append(b.vars, b.value(SSAEntry, 0, StateVar))
+	b.frames = []*ssaFrame{{op: wasm.OpNop, result: resultOf(fn.Type), live: true}}
+
+	for i := range instrs {
+		b.pos = i
+		ins := &instrs[i]
+		switch ins.Opcode {
+		case wasm.OpLoop, wasm.OpElse, wasm.OpEnd:
+		default:
+			b.enterBlock(i)
+		}
+		if err := b.instr(ins); err != nil {
+			return nil, err
+		}
+		if len(b.frames) == 0 {
+			break
+		}
+		switch ins.Opcode {
+		case wasm.OpLoop, wasm.OpElse, wasm.OpEnd:
+			b.enterBlock(i)
+		}
+	}
+	f.resolve()
+	return f, nil
+}
+
+func resultOf(ft *wasm.FuncType) wasm.ValType {
+	if len(ft.Results) == 0 {
+		return 0
+	}
+	return ft.Results[0]
+}
+
+// enterBlock records the values on entry to the block starting at
+// instruction i.
+func (b *ssaBuilder) enterBlock(i int) {
+	blk := b.blockOf[i]
+	if b.dead || b.f.Graph.Blocks[blk].Start != i || b.f.Entry[blk] != nil {
+		return
+	}
+	b.f.Entry[blk] = append([]*SSAValue(nil), b.vars...)
+}
+
+func (b *ssaBuilder) value(op SSAOp, t wasm.ValType, local int, args ...*SSAValue) *SSAValue {
+	v := &SSAValue{ID: len(b.f.Values), Op: op, Pos: -1, Type: t, Local: local, Args: args}
+	if op != SSAParam && op != SSAZero && op != SSAEntry {
+		v.Block = b.blockOf[b.pos]
+	}
+	b.f.Values = append(b.f.Values, v)
+	return v
+}
+
+func (b *ssaBuilder) push(v *SSAValue) {
+	b.stack = append(b.stack, v)
+}
+
+func (b *ssaBuilder) pop() (*SSAValue, error) {
+	if len(b.stack) <= b.frames[len(b.frames)-1].height {
+		return nil, fmt.Errorf("stack underflow at 0x%x", b.f.Func.Body.Instructions[b.pos].Offset)
+	}
+	v := b.stack[len(b.stack)-1]
+	b.stack = b.stack[:len(b.stack)-1]
+	return v, nil
+}
+
+func (b *ssaBuilder) popN(n int) ([]*SSAValue, error) {
+	vals := make([]*SSAValue, n)
+	for i := n - 1; i >= 0; i-- {
+		v, err := b.pop()
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = v
+	}
+	return vals, nil
+}
+
+// results returns the values a branch to f carries.
+func (b *ssaBuilder) results(f *ssaFrame) ([]*SSAValue, error) {
+	if f.result == 0 || f.op == wasm.OpLoop {
+		return nil, nil
+	}
+	if len(b.stack) == 0 {
+		return nil, fmt.Errorf("stack underflow at 0x%x", b.f.Func.Body.Instructions[b.pos].Offset)
+	}
+	return b.stack[len(b.stack)-1:], nil
+}
+
+// branch records the values reaching the label at depth.
+func (b *ssaBuilder) branch(depth uint32) error {
+	if int(depth) >= len(b.frames) {
+		return fmt.Errorf("branch depth %d out of range", depth)
+	}
+	f := b.frames[len(b.frames)-1-int(depth)]
+	res, err := b.results(f)
+	if err != nil {
+		return err
+	}
+	switch {
+	case f.op == wasm.OpLoop:
+		for i, phi := range f.phis {
+			phi.Args = append(phi.Args, b.vars[i])
+		}
+	case len(b.frames)-1-int(depth) == 0:
+		b.f.Roots = append(b.f.Roots, res...)
+	default:
+		in := append([]*SSAValue(nil), b.vars...)
+		f.in = append(f.in, append(in, res...))
+	}
+	return nil
+}
+
+// merge joins the values reaching the end of f, adding phis where they
+// differ, and continues with them.
+func (b *ssaBuilder) merge(f *ssaFrame) {
+	b.stack = b.stack[:f.height]
+	if len(f.in) == 0 {
+		b.dead = true
+		return
+	}
+	b.dead = false
+	n := len(f.in[0])
+	merged := make([]*SSAValue, n)
+	for i := 0; i < n; i++ {
+		v := f.in[0][i]
+		same := true
+		for _, in := range f.in[1:] {
+			if in[i] != v {
+				same = false
+				break
+			}
+		}
+		if !same {
+			local, t := -1, f.result
+			switch {
+			case i < len(b.types):
+				local, t = i, b.types[i]
+			case i == len(b.types):
+				local, t = StateVar, 0
+			}
+			v = b.value(SSAPhi, t, local)
+			for _, in := range f.in {
+				v.Args = append(v.Args, in[i])
+			}
+			b.f.Phis[v.Block] = append(b.f.Phis[v.Block], v)
+		}
+		merged[i] = v
+	}
+	copy(b.vars, merged)
+	b.stack = append(b.stack, merged[len(b.vars):]...)
+}
+
+func (b *ssaBuilder) instr(ins *wasm.Instruction) error {
+	op := ins.Opcode
+	top := b.frames[len(b.frames)-1]
+
+	switch op {
+	case wasm.OpBlock, wasm.OpLoop, wasm.OpIf:
+		f := &ssaFrame{op: op, result: ins.BlockType().Result(), live: !b.dead}
+		if f.result != 0 && !isValType(f.result) {
+			return fmt.Errorf("unsupported block type 0x%x at 0x%x", byte(ins.BlockType()), ins.Offset)
+		}
+		if !b.dead && op == wasm.OpIf {
+			cond, err := b.pop()
+			if err != nil {
+				return err
+			}
+			b.f.Roots = append(b.f.Roots, cond)
+			f.entry = append([]*SSAValue(nil), b.vars...)
+		}
+		f.height = len(b.stack)
+		if !b.dead && op == wasm.OpLoop {
+			blk := b.blockOf[b.pos]
+			for i, v := range b.vars {
+				local, t := i, wasm.ValType(0)
+				if i < len(b.types) {
+					t = b.types[i]
+				} else {
+					local = StateVar
+				}
+				phi := b.value(SSAPhi, t, local, v)
+				phi.Block = blk
+				b.f.Phis[blk] = append(b.f.Phis[blk], phi)
+				f.phis = append(f.phis, phi)
+				b.vars[i] = phi
+			}
+		}
+		b.frames = append(b.frames, f)
+		return nil
+
+	case wasm.OpElse:
+		if top.op != wasm.OpIf {
+			return fmt.Errorf("else at 0x%x outside an if", ins.Offset)
+		}
+		if !b.dead {
+			if err := b.branch(0); err != nil {
+				return err
+			}
+		}
+		b.stack = b.stack[:top.height]
+		b.dead = !top.live
+		if top.live {
+			copy(b.vars, top.entry)
+		}
+		top.entry = nil
+		return nil
+
+	case wasm.OpEnd:
+		// Falling through is a branch to the frame ending here, so it is
+		// recorded before the frame is popped.
+		if !b.dead && top.op != wasm.OpNop && top.op != wasm.OpLoop {
+			if err := b.branch(0); err != nil {
+				return err
+			}
+		}
+		b.frames = b.frames[:len(b.frames)-1]
+		switch top.op {
+		case wasm.OpNop:
+			if !b.dead {
+				res, err := b.results(top)
+				if err != nil {
+					return err
+				}
+				b.f.Roots = append(b.f.Roots, res...)
+			}
+		case wasm.OpLoop:
+			if !b.dead {
+				res, err := b.popN(len(top.resultTypes()))
+				if err != nil {
+					return err
+				}
+				b.stack = append(b.stack[:top.height], res...)
+			}
+		default:
+			if top.entry != nil && top.result == 0 {
+				// An if without an else falls through when its condition
+				// is false.
+				top.in = append(top.in, top.entry)
+			}
+			b.merge(top)
+		}
+		return nil
+	}
+
+	if b.dead {
+		return nil
+	}
+
+	switch op {
+	case wasm.OpNop:
+		return nil
+
+	case wasm.OpUnreachable:
+		b.dead = true
+		return nil
+
+	case wasm.OpBr:
+		if err := b.branch(ins.Index()); err != nil {
+			return err
+		}
+		b.dead = true
+		return nil
+
+	case wasm.OpBrIf:
+		cond, err := b.pop()
+		if err != nil {
+			return err
+		}
+		b.f.Roots = append(b.f.Roots, cond)
+		return b.branch(ins.Index())
+
+	case wasm.OpBrTable:
+		idx, err := b.pop()
+		if err != nil {
+			return err
+		}
+		b.f.Roots = append(b.f.Roots, idx)
+		for _, depth := range ins.Labels() {
+			if err := b.branch(depth); err != nil {
+				return err
+			}
+		}
+		b.dead = true
+		return nil
+
+	case wasm.OpReturn:
+		if err := b.branch(uint32(len(b.frames) - 1)); err != nil {
+			return err
+		}
+		b.dead = true
+		return nil
+
+	case wasm.OpDrop:
+		v, err := b.pop()
+		if err != nil {
+			return err
+		}
+		b.f.Roots = append(b.f.Roots, v)
+		return nil
+
+	case wasm.OpLocalGet, wasm.OpLocalSet, wasm.OpLocalTee:
+		idx := int(ins.Index())
+		if idx >= len(b.types) {
+			return fmt.Errorf("local index %d out of range at 0x%x", idx, ins.Offset)
+		}
+		if op == wasm.OpLocalGet {
+			b.push(b.def(SSAGet, ins, b.types[idx], idx, b.vars[idx]))
+			return nil
+		}
+		v, err := b.pop()
+		if err != nil {
+			return err
+		}
+		set := b.def(SSASet, ins, b.types[idx], idx, v)
+		b.vars[idx] = set
+		if op == wasm.OpLocalTee {
+			get := b.value(SSAGet, b.types[idx], idx, set)
+			get.Pos, get.Implicit = b.pos, true
+			b.push(get)
+		}
+		return nil
+	}
+
+	var params, results []wasm.ValType
+	switch op {
+	case wasm.OpI32Const, wasm.OpI64Const, wasm.OpF32Const, wasm.OpF64Const:
+		results = OpSignatures[op].Outputs
+		if results == nil {
+			results = []wasm.ValType{constType(op)}
+		}
+	case wasm.OpGlobalGet, wasm.OpGlobalSet:
+		t := wasm.ValI32
+		if b.module != nil && int(ins.Index()) < len(b.module.Globals) {
+			t = b.module.Globals[ins.Index()].Type.Type
+		}
+		if op == wasm.OpGlobalGet {
+			results = []wasm.ValType{t}
+		} else {
+			params = []wasm.ValType{t}
+		}
+	case wasm.OpSelect, wasm.OpSelectTyped:
+		if len(b.stack) < 3 {
+			return fmt.Errorf("stack underflow at 0x%x", ins.Offset)
+		}
+		params = []wasm.ValType{0, 0, wasm.ValI32}
+		results = []wasm.ValType{b.stack[len(b.stack)-3].Type}
+	case wasm.OpCall, wasm.OpCallIndirect:
+		var sig *wasm.FuncType
+		if b.module != nil {
+			if op == wasm.OpCall {
+				if fn := b.module.GetFunction(ins.Index()); fn != nil {
+					sig = fn.Type
+				}
+			} else if int(ins.Index()) < len(b.module.Types) {
+				sig = &b.module.Types[ins.Index()]
+			}
+		}
+		if sig == nil {
+			return fmt.Errorf("unknown signature for %s at 0x%x", ins.Name, ins.Offset)
+		}
+		if len(sig.Results) > 1 {
+			return fmt.Errorf("%s at 0x%x returns %d values", ins.Name, ins.Offset, len(sig.Results))
+		}
+		params, results = sig.Params, sig.Results
+		if op == wasm.OpCallIndirect {
+			params = append(append([]wasm.ValType(nil), params...), wasm.ValI32)
+		}
+	default:
+		sig, ok := OpSignatures[op]
+		if !ok || len(sig.Outputs) > 1 {
+			return fmt.Errorf("unsupported instruction %s at 0x%x", ins.Name, ins.Offset)
+		}
+		params, results = sig.Inputs, sig.Outputs
+	}
+
+	args, err := b.popN(len(params))
+	if err != nil {
+		return err
+	}
+	var t wasm.ValType
+	if len(results) > 0 {
+		t = results[0]
+	}
+	v := b.def(SSAInstr, ins, t, -1, args...)
+	reads, writes := stateAccess(op)
+	if reads || writes {
+		v.State = b.vars[len(b.types)]
+	}
+	if writes {
+		v.Effect = true
+		b.vars[len(b.types)] = v
+	}
+	v.Trap = mayTrap(op)
+	if len(results) > 0 {
+		b.push(v)
+	}
+	return nil
+}
+
+func (f *ssaFrame) resultTypes() []wasm.ValType {
+	if f.result == 0 {
+		return nil
+	}
+	return []wasm.ValType{f.result}
+}
+
+// def adds the value defined by the current instruction.
+func (b *ssaBuilder) def(op SSAOp, ins *wasm.Instruction, t wasm.ValType, local int, args ...*SSAValue) *SSAValue {
+	v := b.value(op, t, local, args...)
+	v.Instr, v.Pos = ins, b.pos
+	b.f.ByPos[b.pos] = v
+	return v
+}
+
+func isValType(t wasm.ValType) bool {
+	switch t {
+	case wasm.ValI32, wasm.ValI64, wasm.ValF32, wasm.ValF64, wasm.ValFuncRef, wasm.ValExternRef:
+		return true
+	}
+	return false
+}
+
+func constType(op wasm.Opcode) wasm.ValType {
+	switch op {
+	case wasm.OpI64Const:
+		return wasm.ValI64
+	case wasm.OpF32Const:
+		return wasm.ValF32
+	case wasm.OpF64Const:
+		return wasm.ValF64
+	}
+	return wasm.ValI32
+}
+
+// stateAccess reports whether an instruction reads and whether it writes
+// memory, tables or globals. Calls do both.
+func stateAccess(op wasm.Opcode) (reads, writes bool) {
+	switch op {
+	case wasm.OpCall, wasm.OpCallIndirect:
+		return true, true
+	case wasm.OpGlobalGet, wasm.OpMemorySize, wasm.OpTableGet, wasm.OpTableSize:
+		return true, false
+	case wasm.OpGlobalSet, wasm.OpMemoryGrow, wasm.OpMemoryInit, wasm.OpDataDrop,
+		wasm.OpMemoryCopy, wasm.OpMemoryFill, wasm.OpTableInit, wasm.OpElemDrop,
+		wasm.OpTableCopy, wasm.OpTableGrow, wasm.OpTableSet, wasm.OpTableFill:
+		return true, true
+	}
+	if isLoadOp(op) {
+		return true, false
+	}
+	if isStoreOp(op) {
+		return true, true
+	}
+	return false, false
+}
+
+// mayTrap reports whether an instruction can trap.
+func mayTrap(op wasm.Opcode) bool {
+	switch op {
+	case wasm.OpCall, wasm.OpCallIndirect, wasm.OpUnreachable,
+		wasm.OpI32DivS, wasm.OpI32DivU, wasm.OpI32RemS, wasm.OpI32RemU,
+		wasm.OpI64DivS, wasm.OpI64DivU, wasm.OpI64RemS, wasm.OpI64RemU,
+		wasm.OpI32TruncF32S, wasm.OpI32TruncF32U, wasm.OpI32TruncF64S, wasm.OpI32TruncF64U,
+		wasm.OpI64TruncF32S, wasm.OpI64TruncF32U, wasm.OpI64TruncF64S, wasm.OpI64TruncF64U,
+		wasm.OpMemoryInit, wasm.OpMemoryCopy, wasm.OpMemoryFill,
+		wasm.OpTableInit, wasm.OpTableCopy, wasm.OpTableGet, wasm.OpTableSet, wasm.OpTableFill:
+		return true
+	}
+	return isLoadOp(op) || isStoreOp(op)
+}
+
+func isStoreOp(op wasm.Opcode) bool {
+	switch op {
+	case wasm.OpI32Store, wasm.OpI64Store, wasm.OpF32Store, wasm.OpF64Store,
+		wasm.OpI32Store8, wasm.OpI32Store16, wasm.OpI64Store8, wasm.OpI64Store16, wasm.OpI64Store32:
+		return true
+	}
+	return false
+}
+
+// find returns the value v stands for after trivial phis were removed.
+func find(v *SSAValue) *SSAValue {
+	for v != nil && v.replaced != nil {
+		v = v.replaced
+	}
+	return v
+}
+
+// resolve removes phis whose operands are all the same value or the phi
+// itself, until none is left, and points every reference at what remains.
+func (f *SSAFunc) resolve() {
+	for changed := true; changed; {
+		changed = false
+		for _, phis := range f.Phis {
+			for _, phi := range phis {
+				if phi.replaced != nil {
+					continue
+				}
+				var same *SSAValue
+				trivial := true
+				for _, a := range phi.Args {
+					a = find(a)
+					if a == phi || a == same {
+						continue
+					}
+					if same != nil {
+						trivial = false
+						break
+					}
+					same = a
+				}
+				if trivial && same != nil {
+					phi.replaced = same
+					changed = true
+				}
+			}
+		}
+	}
+
+	values := f.Values[:0]
+	for _, v := range f.Values {
+		if v.replaced != nil {
+			continue
+		}
+		for i, a := range v.Args {
+			v.Args[i] = find(a)
+		}
+		v.State = find(v.State)
+		v.ID = len(values)
+		values = append(values, v)
+	}
+	f.Values = values
+	for i, phis := range f.Phis {
+		kept := phis[:0]
+		for _, phi := range phis {
+			if phi.replaced == nil {
+				kept = append(kept, phi)
+			}
+		}
+		f.Phis[i] = kept
+	}
+	for _, entry := range f.Entry {
+		for i, v := range entry {
+			entry[i] = find(v)
+		}
+	}
+	for i, v := range f.Roots {
+		f.Roots[i] = find(v)
+	}
+}
+
+// DefAt returns the value local holds just before instruction pos.
+func (f *SSAFunc) DefAt(local, pos int) *SSAValue {
+	blk := f.Graph.Blocks[f.blockOf[pos]]
+	if f.Entry[blk.Index] == nil {
+		return nil
+	}
+	for i := pos - 1; i >= blk.Start; i-- {
+		if v := f.ByPos[i]; v != nil && v.Op == SSASet && v.Local == local {
+			return v
+		}
+	}
+	return f.Entry[blk.Index][local]
+}
+
+func (v *SSAValue) String() string {
+	return fmt.Sprintf("v%d", v.ID)
+}
+
+// String lists the values of each reachable block, phis first.
+func (f *SSAFunc) String() string {
+	byBlock := make([][]*SSAValue, len(f.Graph.Blocks))
+	for _, v := range f.Values {
+		if v.Op != SSAPhi {
+			byBlock[v.Block] = append(byBlock[v.Block], v)
+		}
+	}
+	var sb strings.Builder
+	for _, blk := range f.Graph.Blocks {
+		if f.Entry[blk.Index] == nil {
+			continue
+		}
+		fmt.Fprintf(&sb, "B%d\n", blk.Index)
+		for _, v := range append(append([]*SSAValue(nil), f.Phis[blk.Index]...), byBlock[blk.Index]...) {
+			sb.WriteString("  ")
+			if f.Live != nil && !f.Live[v.ID] {
+				sb.WriteString("dead ")
+			}
+			sb.WriteString(v.describe())
+			sb.WriteByte('\n')
+		}
+	}
+	return sb.String()
+}
+
+func (v *SSAValue) describe() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s = ", v)
+	switch v.Op {
+	case SSAParam:
+		fmt.Fprintf(&sb, "param %d", v.Local)
+	case SSAZero:
+		fmt.Fprintf(&sb, "zero %s (local %d)", v.Type, v.Local)
+	case SSAEntry:
+		sb.WriteString("entry state")
+	case SSAPhi:
+		sb.WriteString("phi")
+	case SSAGet:
+		fmt.Fprintf(&sb, "get %d", v.Local)
+	case SSASet:
+		fmt.Fprintf(&sb, "set %d", v.Local)
+	default:
+		sb.WriteString(v.Instr.Name)
+		if ops := v.Instr.Operands(); len(ops) > 0 {
+			sb.WriteString(" " + strings.Join(ops, " "))
+		}
+	}
+	for _, a := range v.Args {
+		sb.WriteString(" " + a.String())
+	}
+	if v.State != nil {
+		fmt.Fprintf(&sb, " [%s]", v.State)
+	}
+	if v.Op == SSAPhi {
+		switch v.Local {
+		case StateVar:
+			sb.WriteString(" ; state")
+		case -1:
+			sb.WriteString(" ; result")
+		default:
+			fmt.Fprintf(&sb, " ; local %d", v.Local)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,186 @@
+package decompile
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/0xInception/wasmspy/internal/wasmtest"
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+// localsModule holds, by index:
+//
+//	0 copies(p0):    v1 = p0; v2 = 5; v2 = v1 + 1; return v2
+//	1 overwrite(p0): return p0 + (p0 = 1), reading p0 before the write
+//	2 tee(p0):       return (p0 = p0 * 3) + p0
+//	3 bump():        global0 += 1; return global0
+//	4 ordered():     return bump() after global0 = 100 has been written
+//	5 coalesce(p0):  do { v1 = p0 + 1; p0 = v1 } while (p0 < 10); return p0
+//	6 held():        v0 = bump(); global0 = 100; return v0
+//	7 moved():       v0 = bump(); return v0 * 2
+func localsModule(t *testing.T) *wasm.ResolvedModule {
+	t.Helper()
+	return wasmtest.Module(t,
+		wasmtest.Section(0x01, 0x02, 0x60, 0x01, 0x7f, 0x01, 0x7f, 0x60, 0x00, 0x01, 0x7f),
+		wasmtest.Section(0x03, 0x08, 0x00, 0x00, 0x00, 0x01, 0x01, 0x00, 0x01, 0x01),
+		wasmtest.Section(0x06, 0x01, 0x7f, 0x01, 0x41, 0x00, 0x0b),
+		wasmtest.Code(
+			wasmtest.Body(0x01, 0x02, 0x7f,
+				0x20, 0x00, 0x21, 0x01, 0x41, 0x05, 0x21, 0x02,
+				0x20, 0x01, 0x41, 0x01, 0x6a, 0x21, 0x02, 0x20, 0x02, 0x0b),
+			wasmtest.Body(0x00, 0x20, 0x00, 0x41, 0x01, 0x21, 0x00, 0x20, 0x00, 0x6a, 0x0b),
+			wasmtest.Body(0x00, 0x20, 0x00, 0x41, 0x03, 0x6c, 0x22, 0x00, 0x20, 0x00, 0x6a, 0x0b),
+			wasmtest.Body(0x00, 0x23, 0x00, 0x41, 0x01, 0x6a, 0x24, 0x00, 0x23, 0x00, 0x0b),
+			wasmtest.Body(0x00, 0x10, 0x03, 0x41, 0xe4, 0x00, 0x24, 0x00, 0x0b),
+			wasmtest.Body(0x01, 0x01, 0x7f,
+				0x03, 0x40, 0x20, 0x00, 0x41, 0x01, 0x6a, 0x21, 0x01, 0x20, 0x01, 0x21, 0x00,
+				0x20, 0x00, 0x41, 0x0a, 0x48, 0x0d, 0x00, 0x0b, 0x20, 0x00, 0x0b),
+			wasmtest.Body(0x01, 0x01, 0x7f, 0x10, 0x03, 0x21, 0x00, 0x41, 0xe4, 0x00, 0x24, 0x00, 0x20, 0x00, 0x0b),
+			wasmtest.Body(0x01, 0x01, 0x7f, 0x10, 0x03, 0x21, 0x00, 0x20, 0x00, 0x41, 0x02, 0x6c, 0x0b),
+		),
+	)
+}
+
+func TestBuildSSA(t *testing.T) {
+	rm := localsModule(t)
+	f, err := BuildSSA(rm.GetFunction(5), rm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := f.Graph.Entry
+	var locals []int
+	for _, phi := range f.Phis[header] {
+		locals = append(locals, phi.Local)
+	}
+	// The state is not written in the loop, so only the locals get phis.
+	if len(locals) != 2 || locals[0] != 0 || locals[1] != 1 {
+		t.Errorf("loop header phis for locals %v\n%s", locals, f)
+	}
+
+	f, err = BuildSSA(rm.GetFunction(4), rm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var call, set *SSAValue
+	for _, v := range f.Values {
+		switch {
+		case v.Instr == nil:
+		case v.Instr.Opcode == wasm.OpCall:
+			call = v
+		case v.Instr.Opcode == wasm.OpGlobalSet:
+			set = v
+		}
+	}
+	if call == nil || set == nil || !call.Effect || set.State != call {
+		t.Errorf("global.set is not ordered after the call\n%s", f)
+	}
+}
+
+func TestLocalPasses(t *testing.T) {
+	rm := localsModule(t)
+	f, err := BuildSSA(rm.GetFunction(0), rm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := f.PropagateCopies(); n != 1 {
+		t.Errorf("%d reads propagated, want 1", n)
+	}
+	f.EliminateDeadCode()
+	var dead []int
+	for _, v := range f.ByPos {
+		if v != nil && v.Op == SSASet && !f.Live[v.ID] {
+			dead = append(dead, v.Pos)
+		}
+	}
+	// v1 = p0 is no longer read and v2 = 5 is overwritten.
+	if len(dead) != 2 || dead[0] != 1 || dead[1] != 3 {
+		t.Errorf("dead writes at %v\n%s", dead, f)
+	}
+
+	f, err = BuildSSA(rm.GetFunction(5), rm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.PropagateCopies()
+	f.EliminateDeadCode()
+	if rename := f.Coalesce(func(int) bool { return false }); rename[1] != 0 {
+		t.Errorf("v1 not merged into p0: %v", rename)
+	}
+}
+
+func TestDecompileLocals(t *testing.T) {
+	rm := localsModule(t)
+	tests := []struct {
+		idx  uint32
+		want []string
+		not  []string
+	}{
+		{0, []string{"return (p0 + 1)"}, []string{"v1 =", "v2 =", "= 5"}},
+		{1, []string{"v1 = p0", "p0 = 1", "(v1 + p0)"}, nil},
+		{2, []string{"p0 = (p0 * 3)", "(p0 + p0)"}, nil},
+		{4, []string{"v0 = func_3()", "global0 = 100", "return v0"}, nil},
+		{5, []string{"p0 = (p0 + 1)", "(p0 < 10)"}, []string{"v1"}},
+		{6, []string{"v0 = func_3()", "global0 = 100", "return v0"}, nil},
+		{7, []string{"return (func_3() * 2)"}, []string{"v0"}},
+	}
+	for _, tt := range tests {
+		code := Decompile(rm.GetFunction(tt.idx), rm)
+		for _, w := range tt.want {
+			if !strings.Contains(code, w) {
+				t.Errorf("func %d: missing %q in\n%s", tt.idx, w, code)
+			}
+		}
+		for _, n := range tt.not {
+			if strings.Contains(code, n) {
+				t.Errorf("func %d: unexpected %q in\n%s", tt.idx, n, code)
+			}
+		}
+	}
+
+	for idx := uint32(0); idx < 8; idx++ {
+		var args []uint64
+		if len(rm.GetFunction(idx).Type.Params) > 0 {
+			args = []uint64{7}
+		}
+		checkEval(t, rm, idx, args)
+	}
+}
+
+// fallthroughModule holds, by index:
+//
+//	0 nested(p0): block { block { br_if 0 (p0); v1 = 5 }; return v1 }; return 0
+//	1 void(p0):   block { v1 = 5 }; return v1
+func fallthroughModule(t *testing.T) *wasm.ResolvedModule {
+	t.Helper()
+	return wasmtest.Module(t,
+		wasmtest.Section(0x01, 0x01, 0x60, 0x01, 0x7f, 0x01, 0x7e),
+		wasmtest.Section(0x03, 0x02, 0x00, 0x00),
+		wasmtest.Code(
+			wasmtest.Body(0x01, 0x01, 0x7e,
+				0x02, 0x40, 0x02, 0x40,
+				0x20, 0x00, 0x0d, 0x00, 0x42, 0x05, 0x21, 0x01,
+				0x0b,
+				0x20, 0x01, 0x0f,
+				0x0b,
+				0x42, 0x00, 0x0b),
+			wasmtest.Body(0x01, 0x01, 0x7e,
+				0x02, 0x40, 0x42, 0x05, 0x21, 0x01, 0x0b,
+				0x20, 0x01, 0x0b),
+		),
+	)
+}
+
+// A block's fallthrough joins at its own end, not at the enclosing block's.
+func TestBlockFallthrough(t *testing.T) {
+	rm := fallthroughModule(t)
+	for idx := uint32(0); idx < 2; idx++ {
+		fn := rm.GetFunction(idx)
+		if _, err := BuildSSA(fn, rm); err != nil {
+			t.Fatalf("func %d: %v", idx, err)
+		}
+		if code := Decompile(fn, rm); !strings.Contains(code, "v1 = 5") {
+			t.Errorf("func %d: store to v1 dropped in\n%s", idx, code)
+		}
+		checkEval(t, rm, idx, []uint64{0}, []uint64{1})
+	}
+}
@@ -0,0 +1,374 @@
+package decompile
+
+import "github.com/0xInception/wasmspy/pkg/wasm"
+
+// PropagateCopies points reads of a local holding a copy of another local
+// at that other local, wherever it still holds the same value, and returns
+// the number of reads changed. The copies themselves are left to
+// EliminateDeadCode.
+func (f *SSAFunc) PropagateCopies() int {
+	n := 0
+	for changed := true; changed; {
+		changed = false
+		for _, get := range f.ByPos {
+			if get == nil || get.Op != SSAGet {
+				continue
+			}
+			set := get.Args[0]
+			if set.Op != SSASet {
+				continue
+			}
+			src := set.Args[0]
+			if src.Op != SSAGet || src.Local == get.Local || f.DefAt(src.Local, get.Pos) != src.Args[0] {
+				continue
+			}
+			get.Local, get.Args[0] = src.Local, src.Args[0]
+			changed = true
+			n++
+		}
+	}
+	return n
+}
+
+// EliminateDeadCode fills Live with the values that effects, traps and
+// roots depend on. Writes of locals that are never read stay unmarked.
+func (f *SSAFunc) EliminateDeadCode() {
+	f.Live = make([]bool, len(f.Values))
+	var work []*SSAValue
+	mark := func(v *SSAValue) {
+		if v != nil && !f.Live[v.ID] {
+			f.Live[v.ID] = true
+			work = append(work, v)
+		}
+	}
+	for _, v := range f.Values {
+		if v.Effect || v.Trap {
+			mark(v)
+		}
+	}
+	for _, v := range f.Roots {
+		mark(v)
+	}
+	for len(work) > 0 {
+		v := work[len(work)-1]
+		work = work[:len(work)-1]
+		for _, a := range v.Args {
+			mark(a)
+		}
+		mark(v.State)
+	}
+}
+
+// Uses returns the def-use chains: for each value, by ID, the live values
+// taking it as an argument or as their state.
+func (f *SSAFunc) Uses() [][]*SSAValue {
+	uses := make([][]*SSAValue, len(f.Values))
+	for _, v := range f.Values {
+		if !f.live(v) {
+			continue
+		}
+		for _, a := range v.Args {
+			uses[a.ID] = append(uses[a.ID], v)
+		}
+		if v.State != nil {
+			uses[v.State.ID] = append(uses[v.State.ID], v)
+		}
+	}
+	return uses
+}
+
+func (f *SSAFunc) live(v *SSAValue) bool {
+	return f.Live == nil || f.Live[v.ID]
+}
+
+// Coalesce merges locals joined by a copy whose live ranges never overlap
+// while they hold different values, so the copy becomes a write of a local
+// to itself. It returns the local each local is merged into, the lowest
+// index of its group. Locals for which fixed returns true are left alone.
+func (f *SSAFunc) Coalesce(fixed func(local int) bool) []int {
+	locals := buildLocals(f.Func)
+	rename := make([]int, len(locals))
+	for i := range rename {
+		rename[i] = i
+	}
+
+	type pair struct{ a, b int }
+	var pairs []pair
+	for _, set := range f.ByPos {
+		if set == nil || set.Op != SSASet || !f.live(set) {
+			continue
+		}
+		src := set.Args[0]
+		if src.Op != SSAGet || src.Local == set.Local || locals[src.Local].Type != locals[set.Local].Type {
+			continue
+		}
+		if fixed(src.Local) || fixed(set.Local) {
+			continue
+		}
+		pairs = append(pairs, pair{src.Local, set.Local})
+	}
+	if len(pairs) == 0 {
+		return rename
+	}
+
+	liveIn, liveOut := f.liveLocals(len(locals))
+	members := make(map[int][]int)
+	for _, p := range pairs {
+		ra, rb := rename[p.a], rename[p.b]
+		if ra == rb {
+			continue
+		}
+		ga, gb := members[ra], members[rb]
+		if ga == nil {
+			ga = []int{ra}
+		}
+		if gb == nil {
+			gb = []int{rb}
+		}
+		ok := true
+		for _, x := range ga {
+			for _, y := range gb {
+				if f.interferes(x, y, liveIn, liveOut) {
+					ok = false
+					break
+				}
+			}
+			if !ok {
+				break
+			}
+		}
+		if !ok {
+			continue
+		}
+		if rb < ra {
+			ra, rb = rb, ra
+		}
+		group := append(ga, gb...)
+		for _, l := range group {
+			rename[l] = ra
+		}
+		delete(members, rb)
+		members[ra] = group
+	}
+	return rename
+}
+
+type bitset []uint64
+
+func newBitset(n int) bitset { return make(bitset, (n+63)/64) }
+
+func (s bitset) has(i int) bool { return s[i/64]&(1<<(i%64)) != 0 }
+func (s bitset) set(i int)      { s[i/64] |= 1 << (i % 64) }
+func (s bitset) clear(i int)    { s[i/64] &^= 1 << (i % 64) }
+
+// liveLocals computes the locals live on entry to and exit from each
+// block. Reads are the live local.get instructions and every local.set and
+// local.tee is a write.
+func (f *SSAFunc) liveLocals(n int) (liveIn, liveOut []bitset) {
+	blocks := f.Graph.Blocks
+	use := make([]bitset, len(blocks))
+	def := make([]bitset, len(blocks))
+	liveIn = make([]bitset, len(blocks))
+	liveOut = make([]bitset, len(blocks))
+	for _, blk := range blocks {
+		k := blk.Index
+		use[k], def[k], liveIn[k], liveOut[k] = newBitset(n), newBitset(n), newBitset(n), newBitset(n)
+		for i := blk.Start; i < blk.End && i < len(f.ByPos); i++ {
+			v := f.ByPos[i]
+			switch {
+			case v == nil:
+			case v.Op == SSAGet && f.live(v) && !def[k].has(v.Local):
+				use[k].set(v.Local)
+			case v.Op == SSASet:
+				def[k].set(v.Local)
+			}
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for k := len(blocks) - 1; k >= 0; k-- {
+			out := liveOut[k]
+			for _, e := range blocks[k].Succs {
+				for w, bits := range liveIn[e.To] {
+					out[w] |= bits
+				}
+			}
+			for w := range out {
+				in := use[k][w] | out[w]&^def[k][w]
+				if in != liveIn[k][w] {
+					liveIn[k][w] = in
+					changed = true
+				}
+			}
+		}
+	}
+	return liveIn, liveOut
+}
+
+// interferes reports whether a write of one of two locals can happen while
+// the other is live and holds a different value.
+func (f *SSAFunc) interferes(x, y int, liveIn, liveOut []bitset) bool {
+	for _, blk := range f.Graph.Blocks {
+		k := blk.Index
+		entry := f.Entry[k]
+		if entry == nil {
+			continue
+		}
+		// Both live on entry: this covers parameters and the writes phis
+		// stand for on incoming edges.
+		if in := liveIn[k]; in.has(x) && in.has(y) && !sameValue(entry[x], entry[y]) {
+			return true
+		}
+		live := append(bitset(nil), liveOut[k]...)
+		for i := blk.End - 1; i >= blk.Start; i-- {
+			v := f.ByPos[i]
+			if v == nil {
+				continue
+			}
+			switch v.Op {
+			case SSASet:
+				other := -1
+				switch v.Local {
+				case x:
+					other = y
+				case y:
+					other = x
+				}
+				if other >= 0 && live.has(other) && !sameValue(v, f.DefAt(other, i)) {
+					return true
+				}
+				live.clear(v.Local)
+			case SSAGet:
+				if f.live(v) {
+					live.set(v.Local)
+				}
+			}
+		}
+	}
+	return false
+}
+
+// sameValue reports whether two values are known to be equal: the same
+// value seen through copies, or the initial zeros of two locals of a type.
+func sameValue(a, b *SSAValue) bool {
+	a, b = origin(a), origin(b)
+	if a == nil || b == nil {
+		return false
+	}
+	return a == b || a.Op == SSAZero && b.Op == SSAZero && a.Type == b.Type
+}
+
+func origin(v *SSAValue) *SSAValue {
+	for v != nil && (v.Op == SSAGet || v.Op == SSASet) {
+		v = v.Args[0]
+	}
+	return v
+}
+
+// localPlan is what the SSA passes decided about the locals of a function,
+// by instruction index, for the statement builder to apply.
+type localPlan struct {
+	// read gives the local a local.get reads after copy propagation.
+	read map[int]uint32
+	// dead marks the local.set and local.tee whose value is never read.
+	dead   map[int]bool
+	rename []int
+	// moved maps a local.get to the local.set it is the only read of, when
+	// both are in one block, so the value can be written at the read.
+	moved map[int]int
+	// movable marks those local.set instructions.
+	movable map[int]bool
+}
+
+// planLocals runs copy propagation, dead code elimination and coalescing
+// over the SSA form of fn, and finds the writes with a single read. It
+// returns nil when the body has no SSA form, which leaves every local as
+// it is.
+func planLocals(fn *wasm.ResolvedFunction, module *wasm.ResolvedModule) *localPlan {
+	f, err := BuildSSA(fn, module)
+	if err != nil {
+		return nil
+	}
+	f.PropagateCopies()
+	f.EliminateDeadCode()
+	var named map[uint32]string
+	if module != nil && module.Names != nil {
+		named = module.Names.LocalNames[fn.Index]
+	}
+	p := &localPlan{
+		read: make(map[int]uint32),
+		dead: make(map[int]bool),
+		rename: f.Coalesce(func(l int) bool {
+			_, ok := named[uint32(l)]
+			return ok
+		}),
+	}
+	for i, v := range f.ByPos {
+		switch {
+		case v == nil:
+		case v.Op == SSAGet && uint32(v.Local) != fn.Body.Instructions[i].Index():
+			p.read[i] = uint32(v.Local)
+		case v.Op == SSASet && !f.Live[v.ID]:
+			p.dead[i] = true
+		}
+	}
+
+	// A local merged with others is written by each of them, so its writes
+	// stay where they are.
+	group := make(map[int]int)
+	for _, r := range p.rename {
+		group[r]++
+	}
+	p.moved = make(map[int]int)
+	p.movable = make(map[int]bool)
+	uses := f.Uses()
+	for i, v := range f.ByPos {
+		if v == nil || v.Op != SSASet || !f.Live[v.ID] || fn.Body.Instructions[i].Opcode != wasm.OpLocalSet {
+			continue
+		}
+		if group[p.rename[v.Local]] > 1 || len(uses[v.ID]) != 1 {
+			continue
+		}
+		get := uses[v.ID][0]
+		if get.Op != SSAGet || get.Implicit || get.Block != v.Block || get.Pos < i {
+			continue
+		}
+		p.moved[get.Pos] = i
+		p.movable[i] = true
+	}
+	return p
+}
+
+// local returns the local the instruction at pos refers to in place of idx.
+func (p *localPlan) local(pos int, idx uint32) uint32 {
+	if p == nil {
+		return idx
+	}
+	if l, ok := p.read[pos]; ok {
+		idx = l
+	}
+	if int(idx) < len(p.rename) {
+		idx = uint32(p.rename[idx])
+	}
+	return idx
+}
+
+// isMovable reports whether the write of a local at pos may be held back
+// until its only read.
+func (p *localPlan) isMovable(pos int) bool {
+	return p != nil && p.movable[pos]
+}
+
+// movedFrom returns the position of the write whose only read is at pos.
+func (p *localPlan) movedFrom(pos int) (int, bool) {
+	if p == nil {
+		return 0, false
+	}
+	set, ok := p.moved[pos]
+	return set, ok
+}
+
+// isDead reports whether the write of a local at pos can be left out.
+func (p *localPlan) isDead(pos int) bool {
+	return p != nil && p.dead[pos]
+}
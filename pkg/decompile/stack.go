@@ -67,7 +67,7 @@ func buildLocals(fn *wasm.ResolvedFunction) []*Value {
 func simulateInstr(instr *wasm.Instruction, stack []*Value, locals []*Value, fn *wasm.ResolvedFunction, module *wasm.ResolvedModule) ([]*Value, error) {
 	switch instr.Opcode {
 	case wasm.OpLocalGet:
-		idx := getU32(instr.Immediates, 0)
+		idx := instr.Index()
 		if int(idx) >= len(locals) {
 			return stack, newError(ErrInvalidIndex, instr.Offset, instr.Name, "local index %d out of bounds (have %d)", idx, len(locals))
 		}
@@ -78,7 +78,7 @@ func simulateInstr(instr *wasm.Instruction, stack []*Value, locals []*Value, fn
 		})
 
 	case wasm.OpLocalSet:
-		idx := getU32(instr.Immediates, 0)
+		idx := instr.Index()
 		if len(stack) < 1 {
 			return stack, newError(ErrStackUnderflow, instr.Offset, instr.Name, "need 1 value, have %d", len(stack))
 		}
@@ -89,7 +89,7 @@ func simulateInstr(instr *wasm.Instruction, stack []*Value, locals []*Value, fn
 		}
 
 	case wasm.OpLocalTee:
-		idx := getU32(instr.Immediates, 0)
+		idx := instr.Index()
 		if len(stack) < 1 {
 			return stack, newError(ErrStackUnderflow, instr.Offset, instr.Name, "need 1 value, have %d", len(stack))
 		}
@@ -99,7 +99,7 @@ func simulateInstr(instr *wasm.Instruction, stack []*Value, locals []*Value, fn
 		}
 
 	case wasm.OpGlobalGet:
-		idx := getU32(instr.Immediates, 0)
+		idx := instr.Index()
 		var t wasm.ValType = wasm.ValI32
 		if module != nil && int(idx) < len(module.Globals) {
 			t = module.Globals[idx].Type.Type
@@ -120,32 +120,32 @@ func simulateInstr(instr *wasm.Instruction, stack []*Value, locals []*Value, fn
 		stack = append(stack, &Value{
 			Type:   wasm.ValI32,
 			Source: SourceConst,
-			Const:  getImmediate(instr.Immediates, 0),
+			Const:  instr.ConstValue(),
 		})
 
 	case wasm.OpI64Const:
 		stack = append(stack, &Value{
 			Type:   wasm.ValI64,
 			Source: SourceConst,
-			Const:  getImmediate(instr.Immediates, 0),
+			Const:  instr.ConstValue(),
 		})
 
 	case wasm.OpF32Const:
 		stack = append(stack, &Value{
 			Type:   wasm.ValF32,
 			Source: SourceConst,
-			Const:  getImmediate(instr.Immediates, 0),
+			Const:  instr.ConstValue(),
 		})
 
 	case wasm.OpF64Const:
 		stack = append(stack, &Value{
 			Type:   wasm.ValF64,
 			Source: SourceConst,
-			Const:  getImmediate(instr.Immediates, 0),
+			Const:  instr.ConstValue(),
 		})
 
 	case wasm.OpCall:
-		idx := getU32(instr.Immediates, 0)
+		idx := instr.Index()
 		var sig *wasm.FuncType
 		if module != nil {
 			if f := module.GetFunction(idx); f != nil && f.Type != nil {
@@ -168,7 +168,7 @@ func simulateInstr(instr *wasm.Instruction, stack []*Value, locals []*Value, fn
 		}
 
 	case wasm.OpCallIndirect:
-		typeIdx := getU32(instr.Immediates, 0)
+		typeIdx := instr.Index()
 		var sig *wasm.FuncType
 		if module != nil && int(typeIdx) < len(module.Types) {
 			sig = &module.Types[typeIdx]
@@ -221,25 +221,3 @@ func copyStack(stack []*Value) []*Value {
 	copy(cp, stack)
 	return cp
 }
-
-func getU32(imm []any, idx int) uint32 {
-	if idx >= len(imm) {
-		return 0
-	}
-	switch v := imm[idx].(type) {
-	case uint32:
-		return v
-	case int32:
-		return uint32(v)
-	case byte:
-		return uint32(v)
-	}
-	return 0
-}
-
-func getImmediate(imm []any, idx int) any {
-	if idx >= len(imm) {
-		return nil
-	}
-	return imm[idx]
-}
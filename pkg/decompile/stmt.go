@@ -13,10 +13,16 @@ type Block struct {
 	Stmts      []Stmt
 	Else       []Stmt
 	Cond       Expr
+	CondValue  *Value
 	Result     wasm.ValType
-	ThenResult Expr
+	ThenValue  *Value
+	HasElse    bool
 	StackDepth int
 	StartOffset uint64
+	ElseOffset  uint64
+	// ResultVar is the temporary the result goes through, set once a
+	// branch carries the result out.
+	ResultVar *LocalExpr
 }
 
 type BlockKind int
@@ -74,6 +80,9 @@ type FuncBody struct {
 	Return        Expr
 	ReturnOffsets []uint64
 	Errors        []DecompileError
+	// Temps are the types of the temporaries the builder introduced,
+	// numbered after the function's locals.
+	Temps []wasm.ValType
 }
 
 type DecompileError struct {
@@ -91,7 +100,9 @@ func BuildStatements(fn *wasm.ResolvedFunction, module *wasm.ResolvedModule) *Fu
 		fn:     fn,
 		module: module,
 		locals: buildLocals(fn),
+		plan:   planLocals(fn, module),
 	}
+	b.numLocals = len(b.locals)
 
 	return b.build()
 }
@@ -107,12 +118,22 @@ type stmtBuilder struct {
 	currInstr   *wasm.Instruction
 	unreachable bool
 	errors      []DecompileError
+
+	// plan renames and drops locals as the SSA passes decided; pos is the
+	// index of the current instruction in it.
+	plan      *localPlan
+	pos       int
+	numLocals int
+	temps     []wasm.ValType
+	accesses  map[*Value]*access
+	held      []*heldSet
 }
 
 func (b *stmtBuilder) build() *FuncBody {
 	for i := range b.fn.Body.Instructions {
 		instr := &b.fn.Body.Instructions[i]
 		b.currInstr = instr
+		b.pos = i
 		b.processInstr(instr)
 	}
 
@@ -128,6 +149,7 @@ func (b *stmtBuilder) build() *FuncBody {
 		Return:        ret,
 		ReturnOffsets: retOffsets,
 		Errors:        b.errors,
+		Temps:         b.temps,
 	}
 }
 
@@ -140,10 +162,16 @@ func (b *stmtBuilder) recordError(offset uint64, opcode, message string) {
 }
 
 func (b *stmtBuilder) processInstr(instr *wasm.Instruction) {
+	switch instr.Opcode {
+	case wasm.OpElse, wasm.OpEnd, wasm.OpUnreachable, wasm.OpBr, wasm.OpBrIf, wasm.OpBrTable, wasm.OpReturn:
+		b.releaseAll()
+	}
+
 	switch instr.Opcode {
 	case wasm.OpBlock:
+		b.spillAll()
 		b.labelID++
-		result := parseBlockType(instr)
+		result := instr.BlockType().Result()
 		b.blocks = append(b.blocks, &Block{
 			Kind:        BlockPlain,
 			Label:       b.labelID,
@@ -154,8 +182,9 @@ func (b *stmtBuilder) processInstr(instr *wasm.Instruction) {
 		b.unreachable = false
 
 	case wasm.OpLoop:
+		b.spillAll()
 		b.labelID++
-		result := parseBlockType(instr)
+		result := instr.BlockType().Result()
 		b.blocks = append(b.blocks, &Block{
 			Kind:        BlockLoop,
 			Label:       b.labelID,
@@ -167,12 +196,14 @@ func (b *stmtBuilder) processInstr(instr *wasm.Instruction) {
 
 	case wasm.OpIf:
 		b.labelID++
-		result := parseBlockType(instr)
+		result := instr.BlockType().Result()
 		cond := b.pop()
+		b.spillAll()
 		b.blocks = append(b.blocks, &Block{
 			Kind:        BlockIf,
 			Label:       b.labelID,
 			Cond:        ValueToExpr(cond),
+			CondValue:   cond,
 			Stmts:       []Stmt{},
 			Result:      result,
 			StackDepth:  len(b.stack),
@@ -183,10 +214,12 @@ func (b *stmtBuilder) processInstr(instr *wasm.Instruction) {
 	case wasm.OpElse:
 		if len(b.blocks) > 0 {
 			block := b.blocks[len(b.blocks)-1]
-			if block.Result != 0 && len(b.stack) > block.StackDepth {
-				block.ThenResult = ValueToExpr(b.pop())
+			if block.Result != 0 && !b.unreachable && len(b.stack) > block.StackDepth {
+				block.ThenValue = b.pop()
 			}
 			block.Else = block.Stmts
+			block.HasElse = true
+			block.ElseOffset = instr.Offset
 			block.Stmts = []Stmt{}
 			b.unreachable = false
 			b.stack = b.stack[:block.StackDepth]
@@ -195,32 +228,13 @@ func (b *stmtBuilder) processInstr(instr *wasm.Instruction) {
 	case wasm.OpEnd:
 		if len(b.blocks) > 0 {
 			block := b.blocks[len(b.blocks)-1]
-			b.blocks = b.blocks[:len(b.blocks)-1]
-
-			b.stack = b.stack[:block.StackDepth]
 
-			if block.Kind == BlockIf && block.Result != 0 {
-				b.push(&Value{
-					Type:   block.Result,
-					Source: SourceOp,
-					Op: &OpValue{
-						Instr:   nil,
-						Inputs:  nil,
-						Ternary: &TernaryValue{
-							Cond:       block.Cond,
-							ThenResult: block.ThenResult,
-							ElseResult: nil,
-						},
-					},
-				})
-			} else if block.Result != 0 {
-				b.push(&Value{
-					Type:   block.Result,
-					Source: SourceConst,
-					Const:  int32(0),
-				})
+			var result *Value
+			if block.Result != 0 {
+				result = b.blockResult(block, instr)
 			}
-
+			b.blocks = b.blocks[:len(b.blocks)-1]
+			b.stack = b.stack[:block.StackDepth]
 			b.unreachable = false
 
 			var stmt Stmt
@@ -244,42 +258,101 @@ func (b *stmtBuilder) processInstr(instr *wasm.Instruction) {
 					Offsets:   []uint64{block.StartOffset, instr.Offset},
 				}
 			case BlockIf:
-				stmt = &IfStmt{
-					Cond:      block.Cond,
-					Then:      block.Else,
-					Else:      block.Stmts,
-					SrcOffset: block.StartOffset,
-					EndOffset: instr.Offset,
-					Offsets:   []uint64{block.StartOffset, instr.Offset},
+				then, els := block.Stmts, []Stmt(nil)
+				if block.HasElse {
+					then, els = block.Else, block.Stmts
+				}
+				// An if whose result became a ternary leaves no statement.
+				if result == nil || result.Op == nil || result.Op.Ternary == nil {
+					stmt = &IfStmt{
+						Cond:      block.Cond,
+						Then:      then,
+						Else:      els,
+						SrcOffset: block.StartOffset,
+						EndOffset: instr.Offset,
+						Offsets:   []uint64{block.StartOffset, instr.Offset},
+					}
 				}
 			}
 
 			if stmt != nil {
 				b.emit(stmt)
 			}
+			if result != nil {
+				b.push(result)
+			}
 		}
 
 	case wasm.OpUnreachable:
 		b.unreachable = true
 
 	case wasm.OpBr:
-		label := getU32(instr.Immediates, 0)
-		target := b.getBlockLabel(int(label))
+		depth := int(instr.Index())
+		if depth == len(b.blocks) {
+			b.emitReturn(instr)
+			break
+		}
+		target := b.getBlockLabel(depth)
+		s := &access{branch: true}
+		var v *Value
+		block := b.valueTarget(depth)
+		if block != nil {
+			v = b.pop()
+			s.include(b.valueAccess(v))
+		}
+		b.spill(s, 0)
+		if block != nil {
+			b.emit(b.resultAssign(block, v, instr.Offset))
+		}
 		b.emit(&BreakStmt{Label: target, SrcOffset: instr.Offset, Offsets: []uint64{instr.Offset}})
 		b.unreachable = true
 
 	case wasm.OpBrIf:
-		label := getU32(instr.Immediates, 0)
+		depth := int(instr.Index())
 		cond := b.pop()
-		target := b.getBlockLabel(int(label))
+		target := b.getBlockLabel(depth)
+		s := &access{branch: true}
+		s.include(b.valueAccess(cond))
+		b.spill(s, 0)
 		offsets := CollectValueOffsets(cond)
 		offsets = append(offsets, instr.Offset)
+		if depth == len(b.blocks) {
+			ret := &ReturnStmt{SrcOffset: instr.Offset, Offsets: []uint64{instr.Offset}}
+			if b.returnsValue() && len(b.stack) > 0 {
+				v := b.top()
+				ret.Value = ValueToExpr(v)
+				ret.Offsets = append(CollectValueOffsets(v), instr.Offset)
+			}
+			b.emit(&IfStmt{Cond: ValueToExpr(cond), Then: []Stmt{ret}, SrcOffset: instr.Offset, EndOffset: instr.Offset, Offsets: offsets})
+			break
+		}
+		if block := b.valueTarget(depth); block != nil && len(b.stack) > 0 {
+			b.emit(b.resultAssign(block, b.top(), instr.Offset))
+		}
 		b.emit(&BreakStmt{Label: target, Cond: ValueToExpr(cond), SrcOffset: instr.Offset, Offsets: offsets})
 
 	case wasm.OpBrTable:
 		idx := b.pop()
-		labels, ok := instr.Immediates[0].([]uint32)
-		if ok && len(labels) > 0 {
+		labels := instr.Labels()
+		s := &access{branch: true}
+		s.include(b.valueAccess(idx))
+		b.spill(s, 0)
+		if len(labels) > 0 && len(b.stack) > 0 {
+			var v *Value
+			assigned := make(map[*Block]bool)
+			for _, l := range labels {
+				block := b.valueTarget(int(l))
+				if block == nil || assigned[block] {
+					continue
+				}
+				if v == nil {
+					v = b.top()
+				}
+				assigned[block] = true
+				b.emit(b.resultAssign(block, v, instr.Offset))
+			}
+		}
+		if len(labels) > 0 {
 			cases := make([]int, len(labels)-1)
 			for i := 0; i < len(labels)-1; i++ {
 				cases[i] = b.getBlockLabel(int(labels[i]))
@@ -292,9 +365,18 @@ func (b *stmtBuilder) processInstr(instr *wasm.Instruction) {
 		b.unreachable = true
 
 	case wasm.OpLocalSet:
-		idx := getU32(instr.Immediates, 0)
+		idx := b.plan.local(b.pos, instr.Index())
 		val := b.pop()
+		if b.plan.isDead(b.pos) && b.valueAccess(val).pure() || isLocal(val, idx) {
+			break
+		}
 		b.locals[idx] = val
+		if b.hold(idx, val, instr) {
+			break
+		}
+		s := &access{locals: []uint32{idx}}
+		s.include(b.valueAccess(val))
+		b.spill(s, 0)
 		offsets := CollectValueOffsets(val)
 		offsets = append(offsets, instr.Offset)
 		b.emit(&AssignStmt{
@@ -305,10 +387,17 @@ func (b *stmtBuilder) processInstr(instr *wasm.Instruction) {
 		})
 
 	case wasm.OpLocalTee:
-		idx := getU32(instr.Immediates, 0)
+		idx := b.plan.local(b.pos, instr.Index())
 		if len(b.stack) > 0 {
 			val := b.stack[len(b.stack)-1]
+			a := b.valueAccess(val)
+			if b.plan.isDead(b.pos) && a.pure() || isLocal(val, idx) {
+				break
+			}
 			b.locals[idx] = val
+			s := &access{locals: []uint32{idx}}
+			s.include(a)
+			b.spill(s, 1)
 			offsets := CollectValueOffsets(val)
 			offsets = append(offsets, instr.Offset)
 			b.emit(&AssignStmt{
@@ -317,15 +406,23 @@ func (b *stmtBuilder) processInstr(instr *wasm.Instruction) {
 				SrcOffset: instr.Offset,
 				Offsets:   offsets,
 			})
+			// Later uses read the local rather than repeat the expression,
+			// unless it is a constant.
+			if val.Source != SourceConst {
+				b.stack[len(b.stack)-1] = b.localValue(idx, instr)
+			}
 		}
 
 	case wasm.OpGlobalSet:
-		idx := getU32(instr.Immediates, 0)
+		idx := instr.Index()
 		val := b.pop()
 		var t wasm.ValType = wasm.ValI32
 		if val != nil {
 			t = val.Type
 		}
+		s := &access{globals: []uint32{idx}}
+		s.include(b.valueAccess(val))
+		b.spill(s, 0)
 		offsets := CollectValueOffsets(val)
 		offsets = append(offsets, instr.Offset)
 		b.emit(&AssignStmt{
@@ -339,10 +436,11 @@ func (b *stmtBuilder) processInstr(instr *wasm.Instruction) {
 		wasm.OpI32Store8, wasm.OpI32Store16, wasm.OpI64Store8, wasm.OpI64Store16, wasm.OpI64Store32:
 		val := b.pop()
 		addr := b.pop()
-		var offset uint32
-		if len(instr.Immediates) >= 2 {
-			offset = getU32(instr.Immediates, 1)
-		}
+		s := &access{mem: true, trap: true}
+		s.include(b.valueAccess(addr))
+		s.include(b.valueAccess(val))
+		b.spill(s, 0)
+		offset := instr.MemArg().Offset
 		offsets := CollectValueOffsets(val)
 		offsets = append(offsets, CollectValueOffsets(addr)...)
 		offsets = append(offsets, instr.Offset)
@@ -357,11 +455,19 @@ func (b *stmtBuilder) processInstr(instr *wasm.Instruction) {
 
 	case wasm.OpDrop:
 		val := b.pop()
+		a := b.valueAccess(val)
+		if a.pure() {
+			break
+		}
+		s := &access{}
+		s.include(a)
+		b.spill(s, 0)
 		offsets := CollectValueOffsets(val)
 		offsets = append(offsets, instr.Offset)
 		b.emit(&DropStmt{Value: ValueToExpr(val), SrcOffset: instr.Offset, Offsets: offsets})
 
-	case wasm.OpSelect:
+	case wasm.OpSelect, wasm.OpSelectTyped:
+		b.spillSelect()
 		cond := b.pop()
 		val2 := b.pop()
 		val1 := b.pop()
@@ -387,19 +493,10 @@ func (b *stmtBuilder) processInstr(instr *wasm.Instruction) {
 		})
 
 	case wasm.OpReturn:
-		var val Expr
-		var offsets []uint64
-		if len(b.stack) > 0 {
-			v := b.pop()
-			val = ValueToExpr(v)
-			offsets = CollectValueOffsets(v)
-		}
-		offsets = append(offsets, instr.Offset)
-		b.emit(&ReturnStmt{Value: val, SrcOffset: instr.Offset, Offsets: offsets})
-		b.unreachable = true
+		b.emitReturn(instr)
 
 	case wasm.OpCall:
-		idx := getU32(instr.Immediates, 0)
+		idx := instr.Index()
 		var sig *wasm.FuncType
 		var name string
 		if b.module != nil {
@@ -431,12 +528,17 @@ func (b *stmtBuilder) processInstr(instr *wasm.Instruction) {
 					Instr:  instr,
 				})
 			} else {
+				s := &access{effect: true, trap: true}
+				for _, v := range argVals {
+					s.include(b.valueAccess(v))
+				}
+				b.spill(s, 0)
 				b.emit(&CallStmt{Call: call, SrcOffset: instr.Offset, Offsets: offsets})
 			}
 		}
 
 	case wasm.OpCallIndirect:
-		typeIdx := getU32(instr.Immediates, 0)
+		typeIdx := instr.Index()
 		funcIdx := b.pop()
 		var sig *wasm.FuncType
 		if b.module != nil && int(typeIdx) < len(b.module.Types) {
@@ -455,7 +557,7 @@ func (b *stmtBuilder) processInstr(instr *wasm.Instruction) {
 				offsets = append(offsets, CollectValueOffsets(v)...)
 			}
 			offsets = append(offsets, instr.Offset)
-			call := &CallExpr{FuncIndex: 0xFFFFFFFF, Args: args}
+			call := &CallExpr{FuncIndex: 0xFFFFFFFF, Args: args, Table: instr.Index2(), TypeIndex: typeIdx}
 			if len(sig.Results) > 0 {
 				b.push(&Value{
 					Type:   sig.Results[0],
@@ -464,12 +566,17 @@ func (b *stmtBuilder) processInstr(instr *wasm.Instruction) {
 					Instr:  instr,
 				})
 			} else {
+				s := &access{effect: true, trap: true}
+				for _, v := range argVals {
+					s.include(b.valueAccess(v))
+				}
+				b.spill(s, 0)
 				b.emit(&CallStmt{Call: call, SrcOffset: instr.Offset, Offsets: offsets})
 			}
 		} else {
 			offsets := CollectValueOffsets(funcIdx)
 			offsets = append(offsets, instr.Offset)
-			b.emit(&CallStmt{Call: &CallExpr{FuncIndex: 0xFFFFFFFF, Args: []Expr{ValueToExpr(funcIdx)}}, SrcOffset: instr.Offset, Offsets: offsets})
+			b.emit(&CallStmt{Call: &CallExpr{FuncIndex: 0xFFFFFFFF, Args: []Expr{ValueToExpr(funcIdx)}, Table: instr.Index2(), TypeIndex: typeIdx}, SrcOffset: instr.Offset, Offsets: offsets})
 		}
 
 	default:
@@ -480,7 +587,11 @@ func (b *stmtBuilder) processInstr(instr *wasm.Instruction) {
 func (b *stmtBuilder) simulateOp(instr *wasm.Instruction) {
 	switch instr.Opcode {
 	case wasm.OpLocalGet:
-		idx := getU32(instr.Immediates, 0)
+		if v := b.take(); v != nil {
+			b.push(v)
+			break
+		}
+		idx := b.plan.local(b.pos, instr.Index())
 		if int(idx) < len(b.locals) {
 			var src SourceKind = SourceLocal
 			numParams := 0
@@ -499,7 +610,7 @@ func (b *stmtBuilder) simulateOp(instr *wasm.Instruction) {
 		}
 
 	case wasm.OpGlobalGet:
-		idx := getU32(instr.Immediates, 0)
+		idx := instr.Index()
 		var t wasm.ValType = wasm.ValI32
 		if b.module != nil && int(idx) < len(b.module.Globals) {
 			t = b.module.Globals[idx].Type.Type
@@ -507,13 +618,13 @@ func (b *stmtBuilder) simulateOp(instr *wasm.Instruction) {
 		b.push(&Value{Type: t, Source: SourceGlobal, Index: idx, Instr: instr})
 
 	case wasm.OpI32Const:
-		b.push(&Value{Type: wasm.ValI32, Source: SourceConst, Const: getImmediate(instr.Immediates, 0), Instr: instr})
+		b.push(&Value{Type: wasm.ValI32, Source: SourceConst, Const: instr.ConstValue(), Instr: instr})
 	case wasm.OpI64Const:
-		b.push(&Value{Type: wasm.ValI64, Source: SourceConst, Const: getImmediate(instr.Immediates, 0), Instr: instr})
+		b.push(&Value{Type: wasm.ValI64, Source: SourceConst, Const: instr.ConstValue(), Instr: instr})
 	case wasm.OpF32Const:
-		b.push(&Value{Type: wasm.ValF32, Source: SourceConst, Const: getImmediate(instr.Immediates, 0), Instr: instr})
+		b.push(&Value{Type: wasm.ValF32, Source: SourceConst, Const: instr.ConstValue(), Instr: instr})
 	case wasm.OpF64Const:
-		b.push(&Value{Type: wasm.ValF64, Source: SourceConst, Const: getImmediate(instr.Immediates, 0), Instr: instr})
+		b.push(&Value{Type: wasm.ValF64, Source: SourceConst, Const: instr.ConstValue(), Instr: instr})
 
 	default:
 		sig, ok := OpSignatures[instr.Opcode]
@@ -593,24 +704,115 @@ func (b *stmtBuilder) emit(s Stmt) {
 	}
 }
 
-func (b *stmtBuilder) getBlockLabel(depth int) int {
+// emitReturn emits the return of the function's result from the top of
+// the stack, for a return or a branch to the function's own block.
+func (b *stmtBuilder) emitReturn(instr *wasm.Instruction) {
+	var val Expr
+	var offsets []uint64
+	s := &access{branch: true}
+	if b.returnsValue() && len(b.stack) > 0 {
+		v := b.pop()
+		val = ValueToExpr(v)
+		offsets = CollectValueOffsets(v)
+		s.include(b.valueAccess(v))
+	}
+	b.spill(s, 0)
+	offsets = append(offsets, instr.Offset)
+	b.emit(&ReturnStmt{Value: val, SrcOffset: instr.Offset, Offsets: offsets})
+	b.unreachable = true
+}
+
+func (b *stmtBuilder) returnsValue() bool {
+	return b.fn.Type == nil || len(b.fn.Type.Results) > 0
+}
+
+// valueTarget returns the block a branch of depth carries a result out of,
+// or nil when it carries none, as a branch to a loop never does.
+func (b *stmtBuilder) valueTarget(depth int) *Block {
 	idx := len(b.blocks) - 1 - depth
-	if idx >= 0 && idx < len(b.blocks) {
-		return b.blocks[idx].Label
+	if idx < 0 || idx >= len(b.blocks) {
+		return nil
 	}
-	return 0
+	if block := b.blocks[idx]; block.Kind != BlockLoop && block.Result != 0 {
+		return block
+	}
+	return nil
 }
 
-func parseBlockType(instr *wasm.Instruction) wasm.ValType {
-	if len(instr.Immediates) == 0 {
-		return 0
+// top returns the value on top of the stack for a use that leaves it
+// there, evaluating it into a temporary first unless repeating it is
+// harmless.
+func (b *stmtBuilder) top() *Value {
+	k := len(b.stack) - 1
+	if !b.valueAccess(b.stack[k]).pure() {
+		b.stack[k] = b.materialize(b.stack[k])
 	}
-	bt, ok := instr.Immediates[0].(byte)
-	if !ok {
-		return 0
+	return b.stack[k]
+}
+
+// blockResult pops the value block ends with. A block no branch carried
+// its result out of keeps the value it falls through with, and an if with
+// nothing but a value in each arm becomes a ternary. Otherwise the value
+// goes through the result temporary, which each arm and the fallthrough
+// assign like the branches did.
+func (b *stmtBuilder) blockResult(block *Block, end *wasm.Instruction) *Value {
+	var v *Value
+	if !b.unreachable && len(b.stack) > block.StackDepth {
+		v = b.pop()
 	}
-	if bt == 0x40 {
-		return 0
+	if block.ResultVar == nil && v != nil {
+		switch block.Kind {
+		case BlockPlain, BlockLoop:
+			return v
+		case BlockIf:
+			if block.ThenValue != nil && len(block.Else) == 0 && len(block.Stmts) == 0 {
+				return &Value{
+					Type:   block.Result,
+					Source: SourceOp,
+					Op: &OpValue{
+						Inputs: []*Value{block.CondValue, block.ThenValue, v},
+						Ternary: &TernaryValue{
+							Cond:       block.Cond,
+							ThenResult: ValueToExpr(block.ThenValue),
+							ElseResult: ValueToExpr(v),
+						},
+					},
+				}
+			}
+		}
+	}
+	if block.Kind == BlockIf && block.ThenValue != nil {
+		block.Else = append(block.Else, b.resultAssign(block, block.ThenValue, block.ElseOffset))
+	}
+	if v != nil {
+		b.emit(b.resultAssign(block, v, end.Offset))
+	}
+	r := b.resultVar(block)
+	return &Value{Type: r.Type, Source: SourceLocal, Index: r.Index, Instr: end}
+}
+
+// resultVar returns the result temporary of block, adding it on first use.
+func (b *stmtBuilder) resultVar(block *Block) *LocalExpr {
+	if block.ResultVar == nil {
+		block.ResultVar = &LocalExpr{Index: uint32(b.numLocals + len(b.temps)), Type: block.Result}
+		b.temps = append(b.temps, block.Result)
 	}
-	return wasm.ValType(bt)
+	return block.ResultVar
+}
+
+// resultAssign assigns v to the result temporary of block, for the branch
+// or arm end at offset.
+func (b *stmtBuilder) resultAssign(block *Block, v *Value, offset uint64) *AssignStmt {
+	offsets := CollectValueOffsets(v)
+	offsets = append(offsets, offset)
+	r := b.resultVar(block)
+	return &AssignStmt{Target: &LocalExpr{Index: r.Index, Type: r.Type}, Value: ValueToExpr(v), SrcOffset: offset, Offsets: offsets}
+}
+
+func (b *stmtBuilder) getBlockLabel(depth int) int {
+	idx := len(b.blocks) - 1 - depth
+	if idx >= 0 && idx < len(b.blocks) {
+		return b.blocks[idx].Label
+	}
+	return 0
 }
@@ -2,8 +2,10 @@ package decompile
 
 import (
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/0xInception/wasmspy/internal/wasmtest"
 	"github.com/0xInception/wasmspy/pkg/wasm"
 )
 
@@ -23,3 +25,77 @@ func TestDecompileControlFlow(t *testing.T) {
 	result := DecompileModule(rm)
 	t.Logf("Decompiled:\n%s", result)
 }
+
+// resultsModule holds, by index:
+//
+//	0 pick(p0):  return if (p0 > 5) { 10 } else { 20 }
+//	1 arms(p0):  return if (p0 & 1) { mem[0] = p0; p0 + 1 } else { p0 - 1 }
+//	2 early(p0): return block { 7; br_if 0 (p0 > 10); drop; p0 * 2 }
+//	3 exit(p0):  block { 42; br_if 1 (p0 == 0); drop }; return p0
+//	4 table(p0): return block { block { 100; br_table [1] 0 (p0) } + 1 }
+func resultsModule(t *testing.T) *wasm.ResolvedModule {
+	t.Helper()
+	return wasmtest.Module(t,
+		wasmtest.Section(0x01, 0x01, 0x60, 0x01, 0x7f, 0x01, 0x7f),
+		wasmtest.Section(0x03, 0x05, 0x00, 0x00, 0x00, 0x00, 0x00),
+		wasmtest.Section(0x05, 0x01, 0x00, 0x01),
+		wasmtest.Code(
+			wasmtest.Body(0x00,
+				0x20, 0x00, 0x41, 0x05, 0x4a, 0x04, 0x7f,
+				0x41, 0x0a, 0x05, 0x41, 0x14, 0x0b,
+				0x0b),
+			wasmtest.Body(0x00,
+				0x20, 0x00, 0x41, 0x01, 0x71, 0x04, 0x7f,
+				0x41, 0x00, 0x20, 0x00, 0x36, 0x02, 0x00,
+				0x20, 0x00, 0x41, 0x01, 0x6a,
+				0x05,
+				0x20, 0x00, 0x41, 0x01, 0x6b,
+				0x0b,
+				0x0b),
+			wasmtest.Body(0x00,
+				0x02, 0x7f,
+				0x41, 0x07, 0x20, 0x00, 0x41, 0x0a, 0x4a, 0x0d, 0x00,
+				0x1a, 0x20, 0x00, 0x41, 0x02, 0x6c,
+				0x0b,
+				0x0b),
+			wasmtest.Body(0x00,
+				0x02, 0x40,
+				0x41, 0x2a, 0x20, 0x00, 0x45, 0x0d, 0x01, 0x1a,
+				0x0b,
+				0x20, 0x00, 0x0b),
+			wasmtest.Body(0x00,
+				0x02, 0x7f, 0x02, 0x7f,
+				0x41, 0xe4, 0x00, 0x20, 0x00, 0x0e, 0x01, 0x01, 0x00,
+				0x0b,
+				0x41, 0x01, 0x6a,
+				0x0b,
+				0x0b),
+		),
+	)
+}
+
+func TestBlockResults(t *testing.T) {
+	rm := resultsModule(t)
+	tests := []struct {
+		idx  uint32
+		want []string
+	}{
+		{0, []string{"return ((p0 > 5) ? 10 : 20)"}},
+		{1, []string{"*(i32*)0 = p0\n    v1 = (p0 + 1)\n  } else {\n    v1 = (p0 - 1)\n  }\n  return v1"}},
+		{2, []string{"v1 = 7\n  if (p0 <= 10) {\n    v1 = (p0 * 2)\n  }\n  return v1"}},
+		{3, []string{"if !(p0) {\n    return 42\n  }\n  return p0"}},
+		{4, []string{"v1 = 100\n  v2 = 100\n  switch p0 {", "v1 = (v2 + 1)"}},
+	}
+	for _, tt := range tests {
+		code := Decompile(rm.GetFunction(tt.idx), rm)
+		for _, w := range tt.want {
+			if !strings.Contains(code, w) {
+				t.Errorf("func %d: missing %q in\n%s", tt.idx, w, code)
+			}
+		}
+	}
+
+	for idx := uint32(0); idx < 5; idx++ {
+		checkEval(t, rm, idx, []uint64{0}, []uint64{1}, []uint64{6}, []uint64{11})
+	}
+}
@@ -0,0 +1,454 @@
+package decompile
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+// StructField is a field of a recovered struct at a byte offset.
+type StructField struct {
+	Offset uint32 `json:"offset"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+}
+
+// StructUse is a local of a function pointing to a struct.
+type StructUse struct {
+	Func  uint32 `json:"func"`
+	Local uint32 `json:"local"`
+}
+
+// Struct is a layout proposed from the offsets a group of pointers is
+// accessed at. ID is derived from the first local of the group, so names and
+// types given to it can be stored and applied again.
+type Struct struct {
+	ID     string        `json:"id"`
+	Name   string        `json:"name"`
+	Size   uint32        `json:"size"`
+	Fields []StructField `json:"fields"`
+	Uses   []StructUse   `json:"uses"`
+}
+
+// Field returns the field at offset, or nil.
+func (s *Struct) Field(offset uint32) *StructField {
+	for i := range s.Fields {
+		if s.Fields[i].Offset == offset {
+			return &s.Fields[i]
+		}
+	}
+	return nil
+}
+
+func (s *Struct) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "struct %s { // %d bytes\n", s.Name, s.Size)
+	for _, f := range s.Fields {
+		fmt.Fprintf(&b, "  %s %s; // +%d\n", f.Type, f.Name, f.Offset)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// StructSet is the structs of a module and the locals pointing to them.
+type StructSet struct {
+	Structs []*Struct
+	byLocal map[StructUse]*Struct
+}
+
+// Lookup returns the struct local of function fn points to, or nil.
+func (s *StructSet) Lookup(fn, local uint32) *Struct {
+	if s == nil {
+		return nil
+	}
+	return s.byLocal[StructUse{Func: fn, Local: local}]
+}
+
+// Get returns the struct with the given ID, or nil.
+func (s *StructSet) Get(id string) *Struct {
+	if s == nil {
+		return nil
+	}
+	for _, st := range s.Structs {
+		if st.ID == id {
+			return st
+		}
+	}
+	return nil
+}
+
+// Clone returns a copy whose structs can be renamed and retyped without
+// changing s. The copy of a nil set is nil.
+func (s *StructSet) Clone() *StructSet {
+	if s == nil {
+		return nil
+	}
+	c := &StructSet{byLocal: make(map[StructUse]*Struct)}
+	for _, st := range s.Structs {
+		cp := *st
+		cp.Fields = append([]StructField(nil), st.Fields...)
+		c.Structs = append(c.Structs, &cp)
+		for _, u := range cp.Uses {
+			c.byLocal[u] = &cp
+		}
+	}
+	return c
+}
+
+// SetField names and types the field at offset, adding it when the
+// accesses did not show one there. Empty strings keep the current values.
+func (s *Struct) SetField(offset uint32, name, typ string) {
+	f := s.Field(offset)
+	if f == nil {
+		s.Fields = append(s.Fields, StructField{Offset: offset, Name: fieldName(offset), Type: "i32"})
+		sort.Slice(s.Fields, func(i, j int) bool { return s.Fields[i].Offset < s.Fields[j].Offset })
+		f = s.Field(offset)
+	}
+	if name != "" {
+		f.Name = name
+	}
+	if typ != "" {
+		f.Type = typ
+	}
+	if end := offset + typeSize(typ); end > s.Size {
+		s.Size = end
+	}
+}
+
+func fieldName(offset uint32) string {
+	return fmt.Sprintf("field_%d", offset)
+}
+
+// typeSize is the size in bytes of a type as printed, or 0 when it is not
+// one the decompiler knows.
+func typeSize(typ string) uint32 {
+	if strings.HasSuffix(typ, "*") {
+		return 4
+	}
+	switch typ {
+	case "i8", "u8", "bool":
+		return 1
+	case "i16", "u16":
+		return 2
+	case "i32", "u32", "f32":
+		return 4
+	case "i64", "u64", "f64":
+		return 8
+	}
+	return 0
+}
+
+// structFacts gathers, over a module, the offsets each pointer local is
+// accessed at and which locals hold the same pointer.
+type structFacts struct {
+	module  *wasm.ResolvedModule
+	fn      uint32
+	types   []wasm.ValType
+	frame   *StackFrame
+	parent  map[StructUse]StructUse
+	offsets map[StructUse][]fieldAccess
+	// copies and args are the pairs of locals joined by an assignment and
+	// by passing an argument.
+	copies, args [][2]StructUse
+	// sizes is the size accessed at each offset by a group, by its root.
+	sizes map[StructUse]map[uint32]uint32
+}
+
+type fieldAccess struct {
+	offset uint32
+	typ    CType
+}
+
+// RecoverStructs proposes struct layouts for the module. Locals copied into
+// one another or passed as arguments are taken to point to the same struct
+// unless they are accessed with different sizes at an offset, which keeps
+// functions taking any pointer from merging the structs of their callers. A
+// group accessed at two or more offsets from its address becomes a struct
+// with a field at each offset.
+func RecoverStructs(module *wasm.ResolvedModule) *StructSet {
+	sf := &structFacts{
+		module:  module,
+		parent:  make(map[StructUse]StructUse),
+		offsets: make(map[StructUse][]fieldAccess),
+	}
+	for i := range module.Functions {
+		fn := &module.Functions[i]
+		if fn.Imported || fn.Body == nil {
+			continue
+		}
+		body := BuildBody(fn, module)
+		sf.fn = fn.Index
+		sf.frame = RecoverFrame(fn, module, body)
+		sf.types = sf.types[:0]
+		for _, l := range buildLocals(fn) {
+			sf.types = append(sf.types, l.Type)
+		}
+		sf.types = append(sf.types, body.Temps...)
+		sf.stmts(body.Stmts)
+		if body.Return != nil {
+			sf.expr(body.Return)
+		}
+	}
+	sf.sizes = make(map[StructUse]map[uint32]uint32)
+	for u, list := range sf.offsets {
+		sizes := make(map[uint32]uint32)
+		for _, a := range list {
+			sizes[a.offset] = uint32(a.typ.Bits / 8)
+		}
+		sf.sizes[u] = sizes
+	}
+	for _, e := range sf.copies {
+		sf.union(e[0], e[1])
+	}
+	for _, e := range sf.args {
+		sf.union(e[0], e[1])
+	}
+	return sf.build()
+}
+
+func (sf *structFacts) find(u StructUse) StructUse {
+	for {
+		p, ok := sf.parent[u]
+		if !ok || p == u {
+			return u
+		}
+		u = p
+	}
+}
+
+func (sf *structFacts) union(a, b StructUse) {
+	ra, rb := sf.find(a), sf.find(b)
+	if ra == rb {
+		return
+	}
+	sa, sb := sf.sizes[ra], sf.sizes[rb]
+	for off, n := range sb {
+		if m, ok := sa[off]; ok && m != n {
+			return
+		}
+	}
+	if rb.Func < ra.Func || rb.Func == ra.Func && rb.Local < ra.Local {
+		ra, rb = rb, ra
+		sa, sb = sb, sa
+	}
+	sf.parent[rb] = ra
+	if len(sb) > 0 {
+		if sa == nil {
+			sa = make(map[uint32]uint32)
+			sf.sizes[ra] = sa
+		}
+		for off, n := range sb {
+			sa[off] = n
+		}
+	}
+	delete(sf.sizes, rb)
+}
+
+// pointer reports whether local idx can point to a struct; the address of
+// a shadow-stack frame is rendered through its slots instead.
+func (sf *structFacts) pointer(idx uint32) bool {
+	return int(idx) < len(sf.types) && sf.types[idx] == wasm.ValI32 && !sf.frame.owns(idx)
+}
+
+func (sf *structFacts) stmts(list []Stmt) {
+	for _, s := range list {
+		sf.stmt(s)
+	}
+}
+
+func (sf *structFacts) stmt(s Stmt) {
+	switch s := s.(type) {
+	case *AssignStmt:
+		sf.expr(s.Value)
+		dst, ok := localOf(s.Target)
+		src, isLocal := localOf(s.Value)
+		if ok && isLocal && sf.pointer(dst) && sf.pointer(src) {
+			sf.copies = append(sf.copies, [2]StructUse{{sf.fn, dst}, {sf.fn, src}})
+		}
+	case *StoreStmt:
+		sf.access(s.Op, s.Addr, s.Offset)
+		sf.expr(s.Addr)
+		sf.expr(s.Value)
+	case *CallStmt:
+		sf.expr(s.Call)
+	case *ReturnStmt:
+		if s.Value != nil {
+			sf.expr(s.Value)
+		}
+	case *DropStmt:
+		sf.expr(s.Value)
+	case *IfStmt:
+		sf.expr(s.Cond)
+		sf.stmts(s.Then)
+		sf.stmts(s.Else)
+	case *LoopStmt:
+		sf.stmts(s.Body)
+	case *BlockStmt:
+		sf.stmts(s.Body)
+	case *BreakStmt:
+		if s.Cond != nil {
+			sf.expr(s.Cond)
+		}
+	case *GotoStmt:
+		if s.Cond != nil {
+			sf.expr(s.Cond)
+		}
+	case *SwitchStmt:
+		sf.expr(s.Value)
+	case *FlatSwitchStmt:
+		sf.expr(s.Value)
+		for _, c := range s.Cases {
+			sf.stmts(c.Body)
+		}
+		sf.stmts(s.Default)
+	case *WhileStmt:
+		sf.expr(s.Cond)
+		sf.stmts(s.Body)
+	case *DoWhileStmt:
+		sf.stmts(s.Body)
+		sf.expr(s.Cond)
+	case *ForStmt:
+		sf.stmt(s.Init)
+		sf.expr(s.Cond)
+		sf.stmts(s.Body)
+		sf.stmt(s.Post)
+	}
+}
+
+func (sf *structFacts) expr(e Expr) {
+	switch e := e.(type) {
+	case *BinaryExpr:
+		sf.expr(e.Left)
+		sf.expr(e.Right)
+	case *UnaryExpr:
+		sf.expr(e.Arg)
+	case *LoadExpr:
+		sf.access(e.Op, e.Addr, e.Offset)
+		sf.expr(e.Addr)
+	case *CallExpr:
+		var callee *wasm.ResolvedFunction
+		if e.FuncIndex != 0xFFFFFFFF {
+			callee = sf.module.GetFunction(e.FuncIndex)
+		}
+		for i, arg := range e.Args {
+			sf.expr(arg)
+			idx, ok := localOf(arg)
+			if !ok || !sf.pointer(idx) || callee == nil || callee.Imported || callee.Type == nil {
+				continue
+			}
+			if i < len(callee.Type.Params) && callee.Type.Params[i] == wasm.ValI32 {
+				sf.args = append(sf.args, [2]StructUse{{sf.fn, idx}, {callee.Index, uint32(i)}})
+			}
+		}
+	case *TernaryExpr:
+		sf.expr(e.Cond)
+		sf.expr(e.ThenResult)
+		sf.expr(e.ElseResult)
+	case *NegExpr:
+		sf.expr(e.Arg)
+	case *NotExpr:
+		sf.expr(e.Arg)
+	}
+}
+
+func (sf *structFacts) access(op wasm.Opcode, addr Expr, offset uint32) {
+	idx, add, ok := addrBase(addr)
+	if !ok || add < 0 || !sf.pointer(idx) {
+		return
+	}
+	u := StructUse{sf.fn, idx}
+	sf.offsets[u] = append(sf.offsets[u], fieldAccess{offset: uint32(add) + offset, typ: memCType(op)})
+}
+
+func (sf *structFacts) build() *StructSet {
+	groups := make(map[StructUse][]StructUse)
+	for u := range sf.offsets {
+		r := sf.find(u)
+		groups[r] = append(groups[r], u)
+	}
+	// Locals only passed along join the group of those accessed.
+	for u := range sf.parent {
+		for _, x := range []StructUse{u, sf.find(u)} {
+			if members, ok := groups[sf.find(x)]; ok && !hasUse(members, x) {
+				groups[sf.find(x)] = append(members, x)
+			}
+		}
+	}
+
+	set := &StructSet{byLocal: make(map[StructUse]*Struct)}
+	for root, members := range groups {
+		var accesses []fieldAccess
+		for _, u := range members {
+			accesses = append(accesses, sf.offsets[u]...)
+		}
+		fields := layoutFields(accesses)
+		if len(fields) < 2 {
+			continue
+		}
+		sort.Slice(members, func(i, j int) bool {
+			if members[i].Func != members[j].Func {
+				return members[i].Func < members[j].Func
+			}
+			return members[i].Local < members[j].Local
+		})
+		id := fmt.Sprintf("struct_%d_%d", root.Func, root.Local)
+		st := &Struct{ID: id, Name: id, Fields: fields, Uses: members}
+		for _, f := range fields {
+			if end := f.Offset + typeSize(f.Type); end > st.Size {
+				st.Size = end
+			}
+		}
+		set.Structs = append(set.Structs, st)
+		for _, u := range members {
+			set.byLocal[u] = st
+		}
+	}
+	sort.Slice(set.Structs, func(i, j int) bool {
+		a, b := set.Structs[i].Uses[0], set.Structs[j].Uses[0]
+		if a.Func != b.Func {
+			return a.Func < b.Func
+		}
+		return a.Local < b.Local
+	})
+	return set
+}
+
+func hasUse(list []StructUse, u StructUse) bool {
+	for _, x := range list {
+		if x == u {
+			return true
+		}
+	}
+	return false
+}
+
+// layoutFields makes a field at each offset accessed, typed by the access
+// seen most often there.
+func layoutFields(accesses []fieldAccess) []StructField {
+	counts := make(map[uint32]map[string]int)
+	var order []string
+	for _, a := range accesses {
+		if counts[a.offset] == nil {
+			counts[a.offset] = make(map[string]int)
+		}
+		t := a.typ.String()
+		if counts[a.offset][t] == 0 {
+			order = append(order, t)
+		}
+		counts[a.offset][t]++
+	}
+	var fields []StructField
+	for off, byType := range counts {
+		best := ""
+		for _, t := range order {
+			if n := byType[t]; n > 0 && (best == "" || n > byType[best]) {
+				best = t
+			}
+		}
+		fields = append(fields, StructField{Offset: off, Name: fieldName(off), Type: best})
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Offset < fields[j].Offset })
+	return fields
+}
@@ -0,0 +1,77 @@
+package decompile
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/0xInception/wasmspy/internal/wasmtest"
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+// structsModule holds, by index:
+//
+//	0 sum(p0):   return load(p0) + load(p0 + 4)
+//	1 init(p0):  store(p0 + 8, 1); return sum(p0) + first(p0)
+//	2 first(p0): return load8_u(p0)
+func structsModule(t *testing.T) *wasm.ResolvedModule {
+	t.Helper()
+	return wasmtest.Module(t,
+		wasmtest.Section(0x01, 0x01, 0x60, 0x01, 0x7f, 0x01, 0x7f),
+		wasmtest.Section(0x03, 0x03, 0x00, 0x00, 0x00),
+		wasmtest.Section(0x05, 0x01, 0x00, 0x01),
+		wasmtest.Code(
+			wasmtest.Body(0x00, 0x20, 0x00, 0x28, 0x02, 0x00, 0x20, 0x00, 0x28, 0x02, 0x04, 0x6a, 0x0b),
+			wasmtest.Body(0x00, 0x20, 0x00, 0x41, 0x01, 0x36, 0x02, 0x08,
+				0x20, 0x00, 0x10, 0x00, 0x20, 0x00, 0x10, 0x02, 0x6a, 0x0b),
+			wasmtest.Body(0x00, 0x20, 0x00, 0x2d, 0x00, 0x00, 0x0b),
+		),
+	)
+}
+
+func TestRecoverStructs(t *testing.T) {
+	rm := structsModule(t)
+	set := RecoverStructs(rm)
+	if len(set.Structs) != 1 {
+		t.Fatalf("got %d structs, want 1", len(set.Structs))
+	}
+	s := set.Structs[0]
+	if s.ID != "struct_0_0" || s.Size != 12 || len(s.Fields) != 3 || s.Fields[2].Offset != 8 {
+		t.Errorf("unexpected layout:\n%s", s)
+	}
+	if set.Lookup(1, 0) != s {
+		t.Error("the argument of init is not the struct of sum")
+	}
+	// first reads a byte where the struct has an i32.
+	if set.Lookup(2, 0) != nil {
+		t.Error("first was merged into the struct")
+	}
+}
+
+func TestDecompileStructs(t *testing.T) {
+	rm := structsModule(t)
+	set := RecoverStructs(rm)
+	code := DecompileWithStructs(rm.GetFunction(1), rm, set).Code
+	for _, w := range []string{"(struct_0_0* p0)", "p0->field_8 = 1"} {
+		if !strings.Contains(code, w) {
+			t.Errorf("missing %q in\n%s", w, code)
+		}
+	}
+
+	named := set.Clone()
+	s := named.Get("struct_0_0")
+	s.Name = "vec"
+	s.SetField(4, "len", "u32")
+	s.SetField(0, "", "u8")
+	code = DecompileWithStructs(rm.GetFunction(0), rm, named).Code
+	for _, w := range []string{"(vec* p0)", "p0->len", "*(i32*)p0"} {
+		if !strings.Contains(code, w) {
+			t.Errorf("missing %q in\n%s", w, code)
+		}
+	}
+	if set.Structs[0].Name != "struct_0_0" {
+		t.Error("renaming the clone changed the original")
+	}
+	if (*StructSet)(nil).Clone() != nil {
+		t.Error("clone of a nil set is not nil")
+	}
+}
@@ -0,0 +1,320 @@
+// Package diffcheck tests the decompiler against the interpreter: it runs
+// a function's original instructions and its decompiled tree, evaluated
+// with decompile.Eval, on the same random inputs and reports the first
+// input on which their results, traps, memory or globals differ. Every
+// simplification and structuring pass is checked this way without writing
+// expectations by hand.
+package diffcheck
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/0xInception/wasmspy/pkg/decompile"
+	"github.com/0xInception/wasmspy/pkg/interp"
+	"github.com/0xInception/wasmspy/pkg/stubs"
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+const (
+	// DefaultRuns is the number of inputs tried when Options.Runs is zero.
+	DefaultRuns = 32
+	// DefaultMaxSteps bounds each run when Options.MaxSteps is zero.
+	DefaultMaxSteps = 1_000_000
+)
+
+type Options struct {
+	Runs     int
+	Seed     int64
+	MaxSteps uint64
+	// Stubs configures the imports, which both sides share. Stub state is
+	// not carried between runs.
+	Stubs stubs.Options
+}
+
+type Status int
+
+const (
+	// Agree means every conclusive run gave the same outcome.
+	Agree Status = iota
+	// Diverge means a run gave different outcomes, or the decompiled tree
+	// could not be evaluated.
+	Diverge
+	// Skip means the function could not be compared.
+	Skip
+)
+
+func (s Status) String() string {
+	switch s {
+	case Agree:
+		return "agree"
+	case Diverge:
+		return "diverge"
+	}
+	return "skip"
+}
+
+// Result is the verdict for one function. For Diverge, Args is the input
+// that showed the difference and Reason describes it; for Skip, Reason says
+// why nothing was compared.
+type Result struct {
+	Func   uint32
+	Name   string
+	Status Status
+	Reason string
+	Args   []uint64
+	// Runs counts the inputs on which both sides finished.
+	Runs int
+}
+
+// outcome is what one side of a run produced.
+type outcome struct {
+	results []uint64
+	err     error
+	memory  []byte
+	globals []uint64
+}
+
+// Check compares function idx of rm with its decompiled tree. The returned
+// error covers setup failures only.
+func Check(rm *wasm.ResolvedModule, idx uint32, opts Options) (*Result, error) {
+	fn := rm.GetFunction(idx)
+	if fn == nil {
+		return nil, fmt.Errorf("function %d not found", idx)
+	}
+	res := &Result{Func: idx, Name: fn.Name}
+	if fn.Imported || fn.Body == nil || fn.Type == nil {
+		res.Status, res.Reason = Skip, "no body"
+		return res, nil
+	}
+	if opts.Runs <= 0 {
+		opts.Runs = DefaultRuns
+	}
+	if opts.MaxSteps == 0 {
+		opts.MaxSteps = DefaultMaxSteps
+	}
+
+	body := decompile.BuildBody(fn, rm)
+	if len(body.Errors) > 0 {
+		res.Status = Skip
+		res.Reason = fmt.Sprintf("decompiler error at 0x%x: %s", body.Errors[0].Offset, body.Errors[0].Message)
+		return res, nil
+	}
+
+	rng := rand.New(rand.NewSource(opts.Seed + int64(idx)))
+	memSize := len(rm.BuildMemory())
+	for run := 0; run < opts.Runs; run++ {
+		args := make([]uint64, len(fn.Type.Params))
+		if run > 0 {
+			for i, t := range fn.Type.Params {
+				args[i] = randomValue(rng, t, memSize)
+			}
+		}
+
+		want, err := runInstructions(rm, idx, args, opts)
+		if err != nil {
+			return nil, err
+		}
+		var t *interp.Trap
+		if errors.As(want.err, &t) && t.Code == interp.TrapOutOfFuel {
+			continue
+		}
+		got, err := runTree(rm, fn, body, args, opts)
+		if err != nil {
+			return nil, err
+		}
+		if errors.Is(got.err, decompile.ErrUnsupported) {
+			res.Status, res.Reason = Skip, got.err.Error()
+			return res, nil
+		}
+		res.Runs++
+		if reason := compare(fn.Type, want, got); reason != "" {
+			res.Status, res.Reason, res.Args = Diverge, reason, args
+			return res, nil
+		}
+	}
+	if res.Runs == 0 {
+		res.Status, res.Reason = Skip, "no run finished within the step budget"
+	}
+	return res, nil
+}
+
+// CheckModule runs Check on every defined function of rm.
+func CheckModule(rm *wasm.ResolvedModule, opts Options) ([]Result, error) {
+	var results []Result
+	for i := range rm.Functions {
+		fn := &rm.Functions[i]
+		if fn.Imported {
+			continue
+		}
+		r, err := Check(rm, fn.Index, opts)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, *r)
+	}
+	return results, nil
+}
+
+// newInstance instantiates rm with stubbed imports and memory 0 holding the
+// static image, the way the emulate package does, without running the start
+// function.
+func newInstance(rm *wasm.ResolvedModule, opts Options) (*interp.Instance, error) {
+	imports := interp.NewImports()
+	if err := stubs.Register(rm, imports, opts.Stubs); err != nil {
+		return nil, err
+	}
+	inst, err := interp.NewInstance(rm, imports)
+	if err != nil {
+		return nil, err
+	}
+	if mem := inst.Memory(); mem != nil {
+		image := rm.BuildMemory()
+		if len(image) > len(mem.Data) {
+			return nil, fmt.Errorf("static memory image of %d bytes exceeds memory size %d", len(image), len(mem.Data))
+		}
+		clear(mem.Data)
+		copy(mem.Data, image)
+	}
+	inst.Fuel, inst.Metered = opts.MaxSteps, true
+	return inst, nil
+}
+
+func runInstructions(rm *wasm.ResolvedModule, idx uint32, args []uint64, opts Options) (*outcome, error) {
+	inst, err := newInstance(rm, opts)
+	if err != nil {
+		return nil, err
+	}
+	out := &outcome{}
+	out.results, out.err = inst.CallFunc(idx, args...)
+	out.snapshot(inst)
+	return out, nil
+}
+
+func runTree(rm *wasm.ResolvedModule, fn *wasm.ResolvedFunction, body *decompile.FuncBody, args []uint64, opts Options) (*outcome, error) {
+	inst, err := newInstance(rm, opts)
+	if err != nil {
+		return nil, err
+	}
+	out := &outcome{}
+	out.results, out.err = decompile.Eval(body, fn, inst, args, int(opts.MaxSteps))
+	out.snapshot(inst)
+	return out, nil
+}
+
+func (o *outcome) snapshot(inst *interp.Instance) {
+	if mem := inst.Memory(); mem != nil {
+		o.memory = mem.Data
+	}
+	for _, g := range inst.Globals {
+		o.globals = append(o.globals, g.Value)
+	}
+}
+
+// compare describes the first difference between the outcome of the
+// instructions and that of the tree, or returns "" if there is none. Two
+// traps agree whatever their cause.
+func compare(ft *wasm.FuncType, want, got *outcome) string {
+	var trap *interp.Trap
+	if got.err != nil && !errors.As(got.err, &trap) {
+		return fmt.Sprintf("decompiled code cannot be evaluated: %v", got.err)
+	}
+	switch {
+	case want.err != nil && got.err == nil:
+		return fmt.Sprintf("instructions fail with %v, decompiled code returns", want.err)
+	case want.err == nil && got.err != nil:
+		return fmt.Sprintf("decompiled code fails with %v, instructions return", got.err)
+	case want.err != nil:
+		return ""
+	}
+	for i, t := range ft.Results {
+		if i >= len(got.results) {
+			return fmt.Sprintf("decompiled code returns %d results, want %d", len(got.results), len(ft.Results))
+		}
+		if !sameValue(t, want.results[i], got.results[i]) {
+			return fmt.Sprintf("result %d: instructions give %s, decompiled code gives %s",
+				i, interp.FormatValue(t, want.results[i]), interp.FormatValue(t, got.results[i]))
+		}
+	}
+	if len(want.memory) != len(got.memory) {
+		return fmt.Sprintf("memory size: instructions leave %d bytes, decompiled code %d", len(want.memory), len(got.memory))
+	}
+	if !bytes.Equal(want.memory, got.memory) {
+		for a := range want.memory {
+			if want.memory[a] != got.memory[a] {
+				return fmt.Sprintf("memory at 0x%x: instructions leave %02x, decompiled code %02x", a, want.memory[a], got.memory[a])
+			}
+		}
+	}
+	for i := range want.globals {
+		if want.globals[i] != got.globals[i] {
+			return fmt.Sprintf("global %d: instructions leave 0x%x, decompiled code 0x%x", i, want.globals[i], got.globals[i])
+		}
+	}
+	return ""
+}
+
+// sameValue compares two values of type t, treating every NaN as equal.
+func sameValue(t wasm.ValType, a, b uint64) bool {
+	switch t {
+	case wasm.ValF32:
+		if math.IsNaN(float64(interp.AsF32(a))) && math.IsNaN(float64(interp.AsF32(b))) {
+			return true
+		}
+	case wasm.ValF64:
+		if math.IsNaN(interp.AsF64(a)) && math.IsNaN(interp.AsF64(b)) {
+			return true
+		}
+	}
+	return a == b
+}
+
+// randomValue picks an argument of type t. Integers favour small numbers,
+// edge cases and addresses inside the static memory image, which take the
+// interesting paths of most functions, over uniformly random bits.
+func randomValue(rng *rand.Rand, t wasm.ValType, memSize int) uint64 {
+	switch t {
+	case wasm.ValI32, wasm.ValI64:
+		var v uint64
+		switch rng.Intn(5) {
+		case 0:
+			v = uint64(int64(rng.Intn(17) - 8))
+		case 1:
+			edges := []uint64{0, 1, math.MaxInt32, 1 << 31, math.MaxUint32, math.MaxInt64, 1 << 63, math.MaxUint64}
+			v = edges[rng.Intn(len(edges))]
+		case 2:
+			if memSize > 0 {
+				v = uint64(rng.Intn(memSize))
+				break
+			}
+			fallthrough
+		case 3:
+			v = uint64(rng.Intn(256))
+		default:
+			v = rng.Uint64()
+		}
+		if t == wasm.ValI32 {
+			v = uint64(uint32(v))
+		}
+		return v
+	case wasm.ValF32, wasm.ValF64:
+		var f float64
+		switch rng.Intn(4) {
+		case 0:
+			specials := []float64{0, math.Copysign(0, -1), 1, -1, 0.5, math.Inf(1), math.Inf(-1), math.NaN()}
+			f = specials[rng.Intn(len(specials))]
+		case 1:
+			f = float64(rng.Intn(201) - 100)
+		default:
+			f = rng.NormFloat64() * 1000
+		}
+		if t == wasm.ValF32 {
+			return interp.F32(float32(f))
+		}
+		return interp.F64(f)
+	}
+	return wasm.NullRef
+}
@@ -0,0 +1,73 @@
+package diffcheck
+
+import (
+	"testing"
+
+	"github.com/0xInception/wasmspy/internal/wasmtest"
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+func TestCheckModule(t *testing.T) {
+	for _, file := range []string{"arithmetic.wasm", "with_elem.wasm", "with_import.wasm"} {
+		results, err := CheckModule(wasmtest.Load(t, file), Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range results {
+			if r.Status != Agree || r.Runs == 0 {
+				t.Errorf("%s %s: %s %s after %d runs", file, r.Name, r.Status, r.Reason, r.Runs)
+			}
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	rm := wasmtest.Load(t, "control_flow.wasm")
+	for _, name := range []string{"abs", "sum_to_n", "store_value"} {
+		r, err := Check(rm, rm.GetFunctionByName(name).Index, Options{Runs: 16, Seed: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Status != Agree {
+			t.Errorf("%s: %s %s", name, r.Status, r.Reason)
+		}
+	}
+
+	if _, err := Check(rm, 99, Options{}); err == nil {
+		t.Error("expected error for a missing function")
+	}
+}
+
+// selectModule holds, by index:
+//
+//	0 set(p0):   global0 = p0; return p0
+//	1 order():   return select(global0, 34, set(13)), reading global0 first
+//	2 skipped(): return select(1, set(5), 1) + global0
+func selectModule(t *testing.T) *wasm.ResolvedModule {
+	t.Helper()
+	return wasmtest.Module(t,
+		wasmtest.Section(0x01, 0x02, 0x60, 0x01, 0x7f, 0x01, 0x7f, 0x60, 0x00, 0x01, 0x7f),
+		wasmtest.Section(0x03, 0x03, 0x00, 0x01, 0x01),
+		wasmtest.Section(0x06, 0x01, 0x7f, 0x01, 0x41, 0x07, 0x0b),
+		wasmtest.Code(
+			wasmtest.Body(0x00, 0x20, 0x00, 0x24, 0x00, 0x20, 0x00, 0x0b),
+			wasmtest.Body(0x00, 0x23, 0x00, 0x41, 0x22, 0x41, 0x0d, 0x10, 0x00, 0x1b, 0x0b),
+			wasmtest.Body(0x00, 0x41, 0x01, 0x41, 0x05, 0x10, 0x00, 0x41, 0x01, 0x1b, 0x23, 0x00, 0x6a, 0x0b),
+		),
+	)
+}
+
+// A select evaluates every operand in order, so a call among them keeps
+// its place and runs whichever value is picked.
+func TestCheckSelect(t *testing.T) {
+	rm := selectModule(t)
+	for idx := uint32(1); idx < 3; idx++ {
+		r, err := Check(rm, idx, Options{Runs: 4, Seed: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Status != Agree {
+			t.Errorf("func %d: %s %s", idx, r.Status, r.Reason)
+		}
+	}
+}
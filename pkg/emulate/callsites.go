@@ -0,0 +1,102 @@
+package emulate
+
+import (
+	"github.com/0xInception/wasmspy/pkg/decompile"
+	"github.com/0xInception/wasmspy/pkg/interp"
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+// CallSite is a direct call to the emulated function. Args holds the
+// arguments when the static analysis found all of them to be constants;
+// Known is false otherwise.
+type CallSite struct {
+	Caller uint32
+	Offset uint64
+	Args   []uint64
+	Known  bool
+}
+
+// CallSites finds the direct calls to function idx and recovers their
+// constant arguments.
+func CallSites(rm *wasm.ResolvedModule, idx uint32) []CallSite {
+	fn := rm.GetFunction(idx)
+	if fn == nil || fn.Type == nil {
+		return nil
+	}
+	nparams := len(fn.Type.Params)
+
+	var sites []CallSite
+	for i := range rm.Functions {
+		caller := &rm.Functions[i]
+		if caller.Body == nil || !callsFunc(caller.Body, idx) {
+			continue
+		}
+		analysis := decompile.Analyze(caller, rm)
+		for _, frame := range analysis.Frames {
+			if frame.Instr.Opcode != wasm.OpCall || frame.Instr.Imm.Index != idx {
+				continue
+			}
+			site := CallSite{Caller: caller.Index, Offset: frame.Instr.Offset}
+			if len(frame.Stack) >= nparams {
+				site.Args, site.Known = constArgs(frame.Stack[len(frame.Stack)-nparams:])
+			}
+			sites = append(sites, site)
+		}
+	}
+	return sites
+}
+
+func callsFunc(body *wasm.FunctionBody, idx uint32) bool {
+	for i := range body.Instructions {
+		if ins := &body.Instructions[i]; ins.Opcode == wasm.OpCall && ins.Imm.Index == idx {
+			return true
+		}
+	}
+	return false
+}
+
+func constArgs(values []*decompile.Value) ([]uint64, bool) {
+	args := make([]uint64, len(values))
+	for i, v := range values {
+		if v == nil || v.Source != decompile.SourceConst {
+			return nil, false
+		}
+		switch c := v.Const.(type) {
+		case int32:
+			args[i] = interp.I32(c)
+		case int64:
+			args[i] = interp.I64(c)
+		case float32:
+			args[i] = interp.F32(c)
+		case float64:
+			args[i] = interp.F64(c)
+		default:
+			return nil, false
+		}
+	}
+	return args, true
+}
+
+// SiteResult pairs a call site with its emulation; Result is nil when the
+// arguments are unknown.
+type SiteResult struct {
+	CallSite
+	Result *Result
+	Err    error
+}
+
+// RunCallSites emulates function idx once per call site whose arguments are
+// constant. Each run starts from a fresh copy of the static memory image.
+func RunCallSites(rm *wasm.ResolvedModule, idx uint32, opts Options) []SiteResult {
+	var results []SiteResult
+	for _, site := range CallSites(rm, idx) {
+		sr := SiteResult{CallSite: site}
+		if site.Known {
+			siteOpts := opts
+			siteOpts.Args = site.Args
+			sr.Result, sr.Err = Run(rm, idx, siteOpts)
+		}
+		results = append(results, sr)
+	}
+	return results
+}
@@ -0,0 +1,218 @@
+// Package emulate runs single functions of a module in isolation, the way
+// string decryption and unpacking helpers are analysed: on a copy of the
+// static memory image, with imports stubbed out and a bounded number of
+// steps, reporting which memory the function changed.
+package emulate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/0xInception/wasmspy/pkg/interp"
+	"github.com/0xInception/wasmspy/pkg/stubs"
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+// DefaultMaxSteps is the instruction budget when Options.MaxSteps is zero.
+const DefaultMaxSteps = 10_000_000
+
+type Options struct {
+	Args []uint64
+	// MaxSteps bounds the number of executed instructions.
+	MaxSteps uint64
+	// Imports optionally provides real implementations; every import it
+	// leaves out is stubbed as configured by Stubs.
+	Imports *interp.Imports
+	Stubs   stubs.Options
+	// Patches are written over the static image before the call; the
+	// reported changes are relative to the patched memory.
+	Patches []Patch
+}
+
+// Patch is data to place in memory 0 at Addr.
+type Patch struct {
+	Addr uint32
+	Data []byte
+}
+
+// Result is the outcome of one emulation. Err holds the trap or error that
+// ended the call, if any; the memory diff is reported either way.
+type Result struct {
+	Results []uint64
+	Err     error
+	Steps   uint64
+	Changes []Change
+	// ImportCalls counts calls to imported functions by "module.name".
+	ImportCalls map[string]int
+
+	Initial []byte
+	Final   []byte
+}
+
+// Change is a range of memory 0 whose contents differ after the call.
+type Change struct {
+	Addr   uint32
+	Before []byte
+	After  []byte
+}
+
+// Text returns the new contents as a string when they look like text:
+// printable after trailing NULs are trimmed. It returns "" otherwise.
+func (c *Change) Text() string {
+	b := c.After
+	for len(b) > 0 && b[len(b)-1] == 0 {
+		b = b[:len(b)-1]
+	}
+	if len(b) < 2 {
+		return ""
+	}
+	for _, ch := range b {
+		if (ch < 0x20 || ch > 0x7e) && ch != '\n' && ch != '\r' && ch != '\t' {
+			return ""
+		}
+	}
+	return string(b)
+}
+
+// Run emulates function idx of rm. The start function is not run: memory 0
+// starts as a copy of the static image from BuildMemory. The returned error
+// covers setup failures only.
+func Run(rm *wasm.ResolvedModule, idx uint32, opts Options) (*Result, error) {
+	res := &Result{ImportCalls: make(map[string]int)}
+	imports := interp.NewImports()
+	if opts.Imports != nil {
+		for mod, funcs := range opts.Imports.Funcs {
+			for name, fn := range funcs {
+				imports.AddFunc(mod, name, fn)
+			}
+		}
+		for mod, globals := range opts.Imports.Globals {
+			for name, g := range globals {
+				imports.AddGlobal(mod, name, g)
+			}
+		}
+		for mod, mems := range opts.Imports.Memories {
+			for name, m := range mems {
+				imports.AddMemory(mod, name, m)
+			}
+		}
+		for mod, tables := range opts.Imports.Tables {
+			for name, t := range tables {
+				imports.AddTable(mod, name, t)
+			}
+		}
+	}
+	stubOpts := opts.Stubs
+	onCall := stubOpts.OnCall
+	stubOpts.OnCall = func(c *stubs.Call) {
+		res.ImportCalls[c.Import]++
+		if onCall != nil {
+			onCall(c)
+		}
+	}
+	if err := stubs.Register(rm, imports, stubOpts); err != nil {
+		return nil, err
+	}
+
+	inst, err := interp.NewInstance(rm, imports)
+	if err != nil {
+		return nil, err
+	}
+	if mem := inst.Memory(); mem != nil {
+		image := rm.BuildMemory()
+		if len(image) > len(mem.Data) {
+			return nil, fmt.Errorf("static memory image of %d bytes exceeds memory size %d", len(image), len(mem.Data))
+		}
+		clear(mem.Data)
+		copy(mem.Data, image)
+		for _, p := range opts.Patches {
+			if !mem.Write(p.Addr, p.Data) {
+				return nil, fmt.Errorf("patch of %d bytes at 0x%x exceeds memory size %d", len(p.Data), p.Addr, len(mem.Data))
+			}
+		}
+		res.Initial = append([]byte(nil), mem.Data...)
+	} else if len(opts.Patches) > 0 {
+		return nil, fmt.Errorf("module has no memory to patch")
+	}
+
+	budget := opts.MaxSteps
+	if budget == 0 {
+		budget = DefaultMaxSteps
+	}
+	inst.Fuel, inst.Metered = budget, true
+	res.Results, res.Err = inst.CallFunc(idx, opts.Args...)
+	res.Steps = budget - inst.Fuel
+
+	if mem := inst.Memory(); mem != nil {
+		res.Final = mem.Data
+		res.Changes = diff(res.Initial, res.Final)
+	}
+	return res, nil
+}
+
+// mergeGap joins changed runs separated by fewer unchanged bytes, so a
+// decrypted string that happens to keep some of its bytes stays in one
+// piece.
+const mergeGap = 4
+
+func diff(before, after []byte) []Change {
+	var changes []Change
+	start, last := -1, -1
+	flush := func() {
+		if start >= 0 {
+			end := last + 1
+			var old []byte
+			if start < len(before) {
+				old = before[start:min(end, len(before))]
+			}
+			changes = append(changes, Change{
+				Addr:   uint32(start),
+				Before: append([]byte(nil), old...),
+				After:  append([]byte(nil), after[start:end]...),
+			})
+		}
+		start, last = -1, -1
+	}
+	for i := range after {
+		var was byte
+		if i < len(before) {
+			was = before[i]
+		}
+		if was == after[i] {
+			continue
+		}
+		if start >= 0 && i-last > mergeGap {
+			flush()
+		}
+		if start < 0 {
+			start = i
+		}
+		last = i
+	}
+	flush()
+	return changes
+}
+
+// Summary describes the result in one line, suitable for a comment at the
+// call site: the decrypted strings, or the changed ranges, or the trap.
+func (r *Result) Summary() string {
+	var parts []string
+	for i := range r.Changes {
+		c := &r.Changes[i]
+		if text := c.Text(); text != "" {
+			parts = append(parts, fmt.Sprintf("%q @0x%x", text, c.Addr))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d bytes @0x%x", len(c.After), c.Addr))
+		}
+	}
+	summary := "emulated: "
+	if len(parts) == 0 {
+		summary += "no memory changes"
+	} else {
+		summary += strings.Join(parts, ", ")
+	}
+	if r.Err != nil {
+		summary += " (" + r.Err.Error() + ")"
+	}
+	return summary
+}
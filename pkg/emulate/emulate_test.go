@@ -0,0 +1,130 @@
+package emulate
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/0xInception/wasmspy/internal/wasmtest"
+	"github.com/0xInception/wasmspy/pkg/interp"
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+// decryptModule has a "hello" XORed with 42 at address 16 and:
+//
+//	func 0: import env.tick
+//	func 1: decrypt(ptr, len), which calls tick and XORs the buffer in place
+//	func 2: main, calling decrypt(16, 5)
+//	func 3: other(ptr, len), forwarding its parameters to decrypt
+//	func 4: spin, an endless loop
+func decryptModule(t *testing.T) *wasm.ResolvedModule {
+	t.Helper()
+	decrypt := []byte{0x01, 0x01, 0x7f,
+		0x10, 0x00,
+		0x02, 0x40, 0x03, 0x40,
+		0x20, 0x02, 0x20, 0x01, 0x4f, 0x0d, 0x01,
+		0x20, 0x00, 0x20, 0x02, 0x6a,
+		0x20, 0x00, 0x20, 0x02, 0x6a, 0x2d, 0x00, 0x00,
+		0x41, 0x2a, 0x73,
+		0x3a, 0x00, 0x00,
+		0x20, 0x02, 0x41, 0x01, 0x6a, 0x21, 0x02,
+		0x0c, 0x00,
+		0x0b, 0x0b, 0x0b}
+	main := []byte{0x00, 0x41, 0x10, 0x41, 0x05, 0x10, 0x01, 0x0b}
+	other := []byte{0x00, 0x20, 0x00, 0x20, 0x01, 0x10, 0x01, 0x0b}
+	spin := []byte{0x00, 0x03, 0x40, 0x0c, 0x00, 0x0b, 0x0b}
+
+	imports := wasmtest.Cat([]byte{0x01},
+		wasmtest.Name("env"), wasmtest.Name("tick"), []byte{0x00, 0x01})
+	exports := wasmtest.Cat([]byte{0x03},
+		wasmtest.Name("decrypt"), []byte{0x00, 0x01},
+		wasmtest.Name("main"), []byte{0x00, 0x02},
+		wasmtest.Name("spin"), []byte{0x00, 0x04})
+
+	seg := []byte("hello")
+	for i := range seg {
+		seg[i] ^= 42
+	}
+
+	return wasmtest.Module(t,
+		wasmtest.Section(0x01,
+			0x02,
+			0x60, 0x02, 0x7f, 0x7f, 0x00,
+			0x60, 0x00, 0x00),
+		wasmtest.Section(0x02, imports...),
+		wasmtest.Section(0x03, 0x04, 0x00, 0x01, 0x00, 0x01),
+		wasmtest.Section(0x05, 0x01, 0x00, 0x01),
+		wasmtest.Section(0x07, exports...),
+		wasmtest.Code(wasmtest.Body(decrypt...), wasmtest.Body(main...), wasmtest.Body(other...), wasmtest.Body(spin...)),
+		wasmtest.Section(0x0b, wasmtest.Cat([]byte{0x01, 0x00, 0x41, 0x10, 0x0b, byte(len(seg))}, seg)...),
+	)
+}
+
+func TestRun(t *testing.T) {
+	rm := decryptModule(t)
+	res, err := Run(rm, 1, Options{Args: []uint64{16, 5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Err != nil {
+		t.Fatalf("emulation failed: %v", res.Err)
+	}
+	if len(res.Changes) != 1 || res.Changes[0].Addr != 16 || res.Changes[0].Text() != "hello" {
+		t.Fatalf("unexpected changes %+v", res.Changes)
+	}
+	if res.ImportCalls["env.tick"] != 1 {
+		t.Errorf("import calls %v", res.ImportCalls)
+	}
+	if res.Steps == 0 {
+		t.Error("expected steps to be counted")
+	}
+	if !strings.Contains(res.Summary(), `"hello" @0x10`) {
+		t.Errorf("summary %q", res.Summary())
+	}
+
+	// Each run starts from the static image again.
+	again, err := Run(rm, 1, Options{Args: []uint64{16, 5}})
+	if err != nil || len(again.Changes) != 1 || again.Changes[0].Text() != "hello" {
+		t.Errorf("second run: %+v, %v", again.Changes, err)
+	}
+}
+
+func TestStepBudget(t *testing.T) {
+	rm := decryptModule(t)
+	res, err := Run(rm, 4, Options{MaxSteps: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var trap *interp.Trap
+	if !errors.As(res.Err, &trap) || trap.Code != interp.TrapOutOfFuel {
+		t.Errorf("expected out of fuel trap, got %v", res.Err)
+	}
+	if res.Steps != 100 {
+		t.Errorf("steps = %d, want 100", res.Steps)
+	}
+}
+
+func TestCallSites(t *testing.T) {
+	rm := decryptModule(t)
+	results := RunCallSites(rm, 1, Options{})
+	if len(results) != 2 {
+		t.Fatalf("expected 2 call sites, got %d", len(results))
+	}
+	for _, sr := range results {
+		switch sr.Caller {
+		case 2:
+			if !sr.Known || len(sr.Args) != 2 || sr.Args[0] != 16 || sr.Args[1] != 5 {
+				t.Errorf("main call site args %v known=%v", sr.Args, sr.Known)
+			}
+			if sr.Err != nil || sr.Result == nil || len(sr.Result.Changes) != 1 || sr.Result.Changes[0].Text() != "hello" {
+				t.Errorf("main call site result %+v, %v", sr.Result, sr.Err)
+			}
+		case 3:
+			if sr.Known || sr.Result != nil {
+				t.Errorf("expected unknown args for forwarding call site, got %v", sr.Args)
+			}
+		default:
+			t.Errorf("unexpected caller %d", sr.Caller)
+		}
+	}
+}
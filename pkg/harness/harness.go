@@ -0,0 +1,274 @@
+// Package harness runs unit tests for single functions of a module: each
+// case calls a function in isolation, as the emulate package does, and
+// checks its results, trap and memory against expectations. Suites are
+// written in YAML or JSON:
+//
+//	stubs: zero
+//	cases:
+//	  - name: decrypts greeting
+//	    func: decrypt
+//	    args: [16, 5]
+//	    memory:
+//	      - {addr: 0x10, hex: "3d3a2f2f2a"}
+//	    expect:
+//	      results: [0]
+//	      memory:
+//	        - {addr: 0x10, string: "hello"}
+//
+// Values are numbers or strings in the syntax of interp.ParseValue.
+package harness
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/0xInception/wasmspy/pkg/emulate"
+	"github.com/0xInception/wasmspy/pkg/interp"
+	"github.com/0xInception/wasmspy/pkg/stubs"
+	"github.com/0xInception/wasmspy/pkg/wasm"
+	"gopkg.in/yaml.v3"
+)
+
+type Suite struct {
+	// Stubs is the behavior of unscripted imports: "zero" (the default)
+	// or "trap".
+	Stubs string `yaml:"stubs" json:"stubs"`
+	// Presets names toolchain presets, or "auto" to detect them.
+	Presets []string     `yaml:"presets" json:"presets"`
+	Script  stubs.Script `yaml:"script" json:"script"`
+	// Steps bounds the instructions of each case.
+	Steps uint64 `yaml:"steps" json:"steps"`
+	Cases []Case `yaml:"cases" json:"cases"`
+}
+
+type Case struct {
+	Name string `yaml:"name" json:"name"`
+	// Func is a function name, export name or index.
+	Func   string  `yaml:"func" json:"func"`
+	Args   []any   `yaml:"args" json:"args"`
+	Memory []Bytes `yaml:"memory" json:"memory"`
+	Expect Expect  `yaml:"expect" json:"expect"`
+}
+
+// Expect lists what a case checks; anything left out is not checked.
+type Expect struct {
+	Results []any `yaml:"results" json:"results"`
+	// Trap, when set, requires the call to fail with an error containing
+	// it.
+	Trap   string  `yaml:"trap" json:"trap"`
+	Memory []Bytes `yaml:"memory" json:"memory"`
+}
+
+// Bytes is memory contents at Addr given as hex or as a string.
+type Bytes struct {
+	Addr   uint32 `yaml:"addr" json:"addr"`
+	Hex    string `yaml:"hex" json:"hex"`
+	String string `yaml:"string" json:"string"`
+}
+
+func (b *Bytes) data() ([]byte, error) {
+	if b.Hex != "" {
+		data, err := hex.DecodeString(strings.ReplaceAll(b.Hex, " ", ""))
+		if err != nil {
+			return nil, fmt.Errorf("memory at 0x%x: %w", b.Addr, err)
+		}
+		return data, nil
+	}
+	return []byte(b.String), nil
+}
+
+// ParseSuite reads a suite in YAML or JSON.
+func ParseSuite(data []byte) (*Suite, error) {
+	var s Suite
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	for name, r := range s.Script {
+		if r == nil {
+			return nil, fmt.Errorf("script %s: empty response", name)
+		}
+	}
+	for i := range s.Cases {
+		c := &s.Cases[i]
+		if c.Func == "" {
+			return nil, fmt.Errorf("case %d: no function", i)
+		}
+		if c.Name == "" {
+			c.Name = fmt.Sprintf("%s #%d", c.Func, i+1)
+		}
+	}
+	return &s, nil
+}
+
+func LoadSuite(path string) (*Suite, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSuite(data)
+}
+
+// CaseResult is the outcome of one case. Failures is empty when it passed.
+type CaseResult struct {
+	Name     string
+	Passed   bool
+	Failures []string
+	Results  []string
+	Err      error
+	Steps    uint64
+}
+
+type Report struct {
+	Cases  []CaseResult
+	Passed int
+	Failed int
+}
+
+func (s *Suite) stubOptions(rm *wasm.ResolvedModule) (stubs.Options, error) {
+	opts, err := stubs.ParseOptions(rm, s.Stubs, s.Presets)
+	opts.Script = s.Script
+	return opts, err
+}
+
+// Run executes every case of the suite against rm. The returned error
+// covers problems with the suite as a whole; a case that cannot run fails.
+func Run(rm *wasm.ResolvedModule, s *Suite) (*Report, error) {
+	stubOpts, err := s.stubOptions(rm)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{}
+	for i := range s.Cases {
+		r := runCase(rm, &s.Cases[i], emulate.Options{MaxSteps: s.Steps, Stubs: stubOpts})
+		r.Passed = len(r.Failures) == 0
+		if r.Passed {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+		report.Cases = append(report.Cases, r)
+	}
+	return report, nil
+}
+
+func lookupFunc(rm *wasm.ResolvedModule, ref string) *wasm.ResolvedFunction {
+	if idx, err := strconv.ParseUint(ref, 0, 32); err == nil {
+		return rm.GetFunction(uint32(idx))
+	}
+	if fn := rm.GetFunctionByName(ref); fn != nil {
+		return fn
+	}
+	return rm.GetFunctionByExport(ref)
+}
+
+func parseValues(types []wasm.ValType, values []any) ([]uint64, error) {
+	if len(values) != len(types) {
+		return nil, fmt.Errorf("want %d values, got %d", len(types), len(values))
+	}
+	out := make([]uint64, len(values))
+	for i, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			s = fmt.Sprint(v)
+		}
+		r, err := interp.ParseValue(types[i], s)
+		if err != nil {
+			return nil, fmt.Errorf("value %d: %w", i, err)
+		}
+		out[i] = r
+	}
+	return out, nil
+}
+
+// sameValue compares two values of type t, treating every NaN as equal.
+func sameValue(t wasm.ValType, a, b uint64) bool {
+	switch t {
+	case wasm.ValF32:
+		if math.IsNaN(float64(interp.AsF32(a))) && math.IsNaN(float64(interp.AsF32(b))) {
+			return true
+		}
+	case wasm.ValF64:
+		if math.IsNaN(interp.AsF64(a)) && math.IsNaN(interp.AsF64(b)) {
+			return true
+		}
+	}
+	return a == b
+}
+
+func runCase(rm *wasm.ResolvedModule, c *Case, opts emulate.Options) CaseResult {
+	r := CaseResult{Name: c.Name}
+	fail := func(format string, args ...any) CaseResult {
+		r.Failures = append(r.Failures, fmt.Sprintf(format, args...))
+		return r
+	}
+
+	fn := lookupFunc(rm, c.Func)
+	if fn == nil || fn.Type == nil {
+		return fail("function not found: %s", c.Func)
+	}
+	args, err := parseValues(fn.Type.Params, c.Args)
+	if err != nil {
+		return fail("arguments: %v", err)
+	}
+	opts.Args = args
+	for i := range c.Memory {
+		data, err := c.Memory[i].data()
+		if err != nil {
+			return fail("%v", err)
+		}
+		opts.Patches = append(opts.Patches, emulate.Patch{Addr: c.Memory[i].Addr, Data: data})
+	}
+	var want []uint64
+	if c.Expect.Results != nil {
+		if want, err = parseValues(fn.Type.Results, c.Expect.Results); err != nil {
+			return fail("expected results: %v", err)
+		}
+	}
+
+	res, err := emulate.Run(rm, fn.Index, opts)
+	if err != nil {
+		return fail("%v", err)
+	}
+	r.Err, r.Steps = res.Err, res.Steps
+	for i, v := range res.Results {
+		r.Results = append(r.Results, interp.FormatValue(fn.Type.Results[i], v))
+	}
+
+	switch {
+	case c.Expect.Trap != "" && res.Err == nil:
+		fail("expected trap %q, returned normally", c.Expect.Trap)
+	case c.Expect.Trap != "" && !strings.Contains(res.Err.Error(), c.Expect.Trap):
+		fail("expected trap %q, got %v", c.Expect.Trap, res.Err)
+	case c.Expect.Trap == "" && res.Err != nil:
+		fail("unexpected error: %v", res.Err)
+	}
+	if want != nil && res.Err == nil {
+		for i, t := range fn.Type.Results {
+			if !sameValue(t, res.Results[i], want[i]) {
+				fail("result %d: got %s, want %s", i, interp.FormatValue(t, res.Results[i]), interp.FormatValue(t, want[i]))
+			}
+		}
+	}
+	for i := range c.Expect.Memory {
+		m := &c.Expect.Memory[i]
+		data, err := m.data()
+		if err != nil {
+			fail("expected %v", err)
+			continue
+		}
+		end := uint64(m.Addr) + uint64(len(data))
+		if end > uint64(len(res.Final)) {
+			fail("memory at 0x%x: out of bounds", m.Addr)
+			continue
+		}
+		if got := res.Final[m.Addr:end]; !bytes.Equal(got, data) {
+			fail("memory at 0x%x: got %s, want %s", m.Addr, hex.EncodeToString(got), hex.EncodeToString(data))
+		}
+	}
+	return r
+}
@@ -0,0 +1,74 @@
+package harness
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/0xInception/wasmspy/internal/wasmtest"
+)
+
+const suite = `
+cases:
+  - name: abs of negative
+    func: abs
+    args: [-5]
+    expect: {results: [5]}
+  - func: sum_to_n
+    args: [4]
+    expect: {results: [6]}
+  - name: store
+    func: store_value
+    args: [0x20, 0x64636261]
+    memory:
+      - {addr: 0x10, string: "seed"}
+    expect:
+      memory:
+        - {addr: 0x10, hex: "73 65 65 64"}
+        - {addr: 0x20, string: "abcd"}
+  - name: wrong result
+    func: 0
+    args: [3]
+    expect: {results: [4]}
+  - name: out of bounds
+    func: store_value
+    args: [0x10000, 1]
+    expect: {trap: "out of bounds"}
+`
+
+func TestRun(t *testing.T) {
+	rm := wasmtest.Load(t, "control_flow.wasm")
+	s, err := ParseSuite([]byte(suite))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := Run(rm, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Passed != 4 || report.Failed != 1 {
+		for _, c := range report.Cases {
+			t.Logf("%s: %v", c.Name, c.Failures)
+		}
+		t.Fatalf("passed %d, failed %d", report.Passed, report.Failed)
+	}
+	if report.Cases[1].Name != "sum_to_n #2" {
+		t.Errorf("default name %q", report.Cases[1].Name)
+	}
+	wrong := report.Cases[3]
+	if wrong.Passed || len(wrong.Failures) != 1 || !strings.Contains(wrong.Failures[0], "got 3, want 4") {
+		t.Errorf("wrong result: %v", wrong.Failures)
+	}
+}
+
+func TestParseSuiteJSON(t *testing.T) {
+	s, err := ParseSuite([]byte(`{"stubs": "trap", "cases": [{"func": "abs", "args": ["-1"], "expect": {"results": ["1"]}}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Stubs != "trap" || len(s.Cases) != 1 || s.Cases[0].Func != "abs" {
+		t.Errorf("suite %+v", s)
+	}
+	if _, err := ParseSuite([]byte("cases:\n  - args: [1]\n")); err == nil {
+		t.Error("expected error for a case without a function")
+	}
+}
@@ -0,0 +1,85 @@
+package interp
+
+import (
+	"fmt"
+
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+// maxLocals guards against bodies declaring absurd local counts.
+const maxLocals = 50000
+
+// compiledFunc is a function body with its control structure resolved:
+// match maps every block, loop, if and else to its end, and elseAt maps an
+// if to its else (or -1).
+type compiledFunc struct {
+	instrs []wasm.Instruction
+	match  []int
+	elseAt []int
+	locals []uint64
+}
+
+func (f *Function) compiled() (*compiledFunc, error) {
+	if f.code != nil {
+		return f.code, nil
+	}
+	if f.def == nil || f.def.Body == nil {
+		return nil, fmt.Errorf("function %d has no body", f.Index)
+	}
+	body := f.def.Body
+
+	code := &compiledFunc{
+		instrs: body.Instructions,
+		match:  make([]int, len(body.Instructions)),
+		elseAt: make([]int, len(body.Instructions)),
+	}
+
+	var total uint64
+	for _, l := range body.Locals {
+		total += uint64(l.Count)
+		if total > maxLocals {
+			return nil, fmt.Errorf("function %d declares more than %d locals", f.Index, maxLocals)
+		}
+		init := uint64(0)
+		if t := wasm.ValType(l.Type); t == wasm.ValFuncRef || t == wasm.ValExternRef {
+			init = wasm.NullRef
+		}
+		for i := uint32(0); i < l.Count; i++ {
+			code.locals = append(code.locals, init)
+		}
+	}
+
+	var open []int
+	for i := range code.instrs {
+		code.elseAt[i] = -1
+		switch code.instrs[i].Opcode {
+		case wasm.OpBlock, wasm.OpLoop, wasm.OpIf:
+			open = append(open, i)
+		case wasm.OpElse:
+			if len(open) == 0 || code.instrs[open[len(open)-1]].Opcode != wasm.OpIf {
+				return nil, fmt.Errorf("function %d: else without if at offset 0x%x", f.Index, code.instrs[i].Offset)
+			}
+			code.elseAt[open[len(open)-1]] = i
+			open = append(open, i)
+		case wasm.OpEnd:
+			if len(open) == 0 {
+				code.match[i] = -1
+				continue
+			}
+			start := open[len(open)-1]
+			open = open[:len(open)-1]
+			code.match[start] = i
+			if code.instrs[start].Opcode == wasm.OpElse {
+				ifStart := open[len(open)-1]
+				open = open[:len(open)-1]
+				code.match[ifStart] = i
+			}
+		}
+	}
+	if len(open) != 0 {
+		return nil, fmt.Errorf("function %d: unterminated block", f.Index)
+	}
+
+	f.code = code
+	return code, nil
+}
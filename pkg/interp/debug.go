@@ -0,0 +1,28 @@
+package interp
+
+import "github.com/0xInception/wasmspy/pkg/wasm"
+
+// Step describes the instruction about to execute, as passed to an
+// instance's Hook. Locals and Stack alias the live frame, so a debugger may
+// modify them; they are only valid during the hook call.
+type Step struct {
+	Func  uint32
+	PC    int
+	Instr *wasm.Instruction
+	// Depth is the number of active wasm frames, 1 for the outermost call.
+	Depth  int
+	Locals []uint64
+	// Stack is the frame's operand stack, bottom first.
+	Stack []uint64
+}
+
+// CallStack returns the active wasm frames, innermost first. Outer frames
+// carry the offset of their pending call; the innermost frame's offset is
+// only current while execution is paused in a Hook.
+func (in *Instance) CallStack() []Frame {
+	frames := make([]Frame, len(in.frames))
+	for i := range in.frames {
+		frames[i] = in.frames[len(in.frames)-1-i]
+	}
+	return frames
+}
@@ -0,0 +1,103 @@
+package interp
+
+import (
+	"fmt"
+	"strings"
+)
+
+type TrapCode int
+
+const (
+	TrapUnreachable TrapCode = iota + 1
+	TrapMemoryOutOfBounds
+	TrapTableOutOfBounds
+	TrapDivideByZero
+	TrapIntegerOverflow
+	TrapInvalidConversion
+	TrapUninitializedElement
+	TrapIndirectCallTypeMismatch
+	TrapCallStackExhausted
+	TrapOutOfFuel
+	TrapUnresolvedImport
+	TrapMalformedCode
+)
+
+var trapMessages = map[TrapCode]string{
+	TrapUnreachable:              "unreachable executed",
+	TrapMemoryOutOfBounds:        "out of bounds memory access",
+	TrapTableOutOfBounds:         "undefined element",
+	TrapDivideByZero:             "integer divide by zero",
+	TrapIntegerOverflow:          "integer overflow",
+	TrapInvalidConversion:        "invalid conversion to integer",
+	TrapUninitializedElement:     "uninitialized element",
+	TrapIndirectCallTypeMismatch: "indirect call type mismatch",
+	TrapCallStackExhausted:       "call stack exhausted",
+	TrapOutOfFuel:                "instruction budget exhausted",
+	TrapUnresolvedImport:         "unresolved import called",
+	TrapMalformedCode:            "malformed code",
+}
+
+// Frame is one entry of a trap backtrace: the function and the offset of the
+// instruction that was executing in it.
+type Frame struct {
+	Func   uint32
+	Offset uint64
+}
+
+// Trap is a runtime failure of the WebAssembly program. Frames lists the
+// call stack at the point of the trap, innermost first.
+type Trap struct {
+	Code    TrapCode
+	Details string
+	Frames  []Frame
+}
+
+func (t *Trap) Error() string {
+	msg := trapMessages[t.Code]
+	if t.Details != "" {
+		msg += ": " + t.Details
+	}
+	if len(t.Frames) == 0 {
+		return "trap: " + msg
+	}
+	return fmt.Sprintf("trap: %s in func %d at offset 0x%x", msg, t.Frames[0].Func, t.Frames[0].Offset)
+}
+
+// Backtrace formats the call stack of the trap, naming functions through
+// name when it is non-nil.
+func (t *Trap) Backtrace(name func(idx uint32) string) string {
+	var b strings.Builder
+	for i, f := range t.Frames {
+		fn := fmt.Sprintf("func_%d", f.Func)
+		if name != nil {
+			if n := name(f.Func); n != "" {
+				fn = n
+			}
+		}
+		fmt.Fprintf(&b, "  #%d %s at 0x%x\n", i, fn, f.Offset)
+	}
+	return b.String()
+}
+
+func newTrap(code TrapCode, format string, args ...any) *Trap {
+	t := &Trap{Code: code}
+	if format != "" {
+		t.Details = fmt.Sprintf(format, args...)
+	}
+	return t
+}
+
+// LinkError reports an import that could not be satisfied or a segment that
+// does not fit at instantiation.
+type LinkError struct {
+	Module string
+	Name   string
+	Msg    string
+}
+
+func (e *LinkError) Error() string {
+	if e.Module == "" && e.Name == "" {
+		return "link error: " + e.Msg
+	}
+	return fmt.Sprintf("link error: %s.%s: %s", e.Module, e.Name, e.Msg)
+}
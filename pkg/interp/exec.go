@@ -0,0 +1,331 @@
+package interp
+
+import (
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+type label struct {
+	arity  int
+	height int
+	cont   int
+	loop   bool
+}
+
+func blockArity(bt wasm.BlockType) int {
+	if bt == wasm.BlockEmpty {
+		return 0
+	}
+	return 1
+}
+
+func (in *Instance) push(v uint64) {
+	in.stack = append(in.stack, v)
+}
+
+func (in *Instance) pop() uint64 {
+	n := len(in.stack) - 1
+	v := in.stack[n]
+	in.stack = in.stack[:n]
+	return v
+}
+
+func (in *Instance) top() *uint64 {
+	return &in.stack[len(in.stack)-1]
+}
+
+// exec runs a defined function. Its arguments are on top of the operand
+// stack on entry and are replaced by its results on return.
+func (in *Instance) exec(fn *Function) error {
+	code, err := fn.compiled()
+	if err != nil {
+		return in.trapAt(newTrap(TrapMalformedCode, "%v", err))
+	}
+
+	nparams := len(fn.Type.Params)
+	nresults := len(fn.Type.Results)
+	base := len(in.stack) - nparams
+	locals := make([]uint64, nparams+len(code.locals))
+	copy(locals, in.stack[base:])
+	copy(locals[nparams:], code.locals)
+	in.stack = in.stack[:base]
+
+	in.frames = append(in.frames, Frame{Func: fn.Index})
+	frame := len(in.frames) - 1
+	tracing := in.Tracer != nil
+	if tracing {
+		in.Tracer(Event{Kind: EventCall, Func: fn.Index})
+	}
+
+	labels := []label{{arity: nresults, height: base, cont: len(code.instrs) - 1}}
+	instrs := code.instrs
+
+	branch := func(depth uint32) int {
+		l := labels[len(labels)-1-int(depth)]
+		if l.loop {
+			in.stack = in.stack[:l.height]
+			labels = labels[:len(labels)-int(depth)]
+			return l.cont + 1
+		}
+		vals := in.stack[len(in.stack)-l.arity:]
+		copy(in.stack[l.height:], vals)
+		in.stack = in.stack[:l.height+l.arity]
+		labels = labels[:len(labels)-1-int(depth)]
+		return l.cont + 1
+	}
+
+	trap := func(pc int, t *Trap) error {
+		in.frames[frame].Offset = instrs[pc].Offset
+		return in.trapAt(t)
+	}
+
+	pc := 0
+	for pc < len(instrs) && len(labels) > 0 {
+		ins := &instrs[pc]
+		if tracing {
+			in.Tracer(Event{Kind: EventInstr, Func: fn.Index, Offset: ins.Offset})
+		}
+		if in.Hook != nil {
+			in.frames[frame].Offset = ins.Offset
+			step := Step{Func: fn.Index, PC: pc, Instr: ins, Depth: len(in.frames), Locals: locals, Stack: in.stack[base:]}
+			if err := in.Hook(&step); err != nil {
+				return err
+			}
+		}
+
+		if in.Metered {
+			if in.Fuel == 0 {
+				return trap(pc, newTrap(TrapOutOfFuel, ""))
+			}
+			in.Fuel--
+		}
+
+		switch ins.Opcode {
+		case wasm.OpUnreachable:
+			return trap(pc, newTrap(TrapUnreachable, ""))
+
+		case wasm.OpNop:
+
+		case wasm.OpBlock:
+			labels = append(labels, label{arity: blockArity(ins.Imm.Block), height: len(in.stack), cont: code.match[pc]})
+
+		case wasm.OpLoop:
+			labels = append(labels, label{height: len(in.stack), cont: pc, loop: true})
+
+		case wasm.OpIf:
+			cond := uint32(in.pop())
+			labels = append(labels, label{arity: blockArity(ins.Imm.Block), height: len(in.stack), cont: code.match[pc]})
+			if cond == 0 {
+				if e := code.elseAt[pc]; e >= 0 {
+					pc = e + 1
+				} else {
+					pc = code.match[pc]
+				}
+				continue
+			}
+
+		case wasm.OpElse:
+			// End of the taken then-branch: skip to the matching end.
+			pc = code.match[pc]
+			continue
+
+		case wasm.OpEnd:
+			labels = labels[:len(labels)-1]
+
+		case wasm.OpBr:
+			pc = branch(ins.Imm.Index)
+			continue
+
+		case wasm.OpBrIf:
+			if uint32(in.pop()) != 0 {
+				pc = branch(ins.Imm.Index)
+				continue
+			}
+
+		case wasm.OpBrTable:
+			i := uint32(in.pop())
+			targets := ins.Imm.Labels
+			depth := targets[len(targets)-1]
+			if int(i) < len(targets)-1 {
+				depth = targets[i]
+			}
+			pc = branch(depth)
+			continue
+
+		case wasm.OpReturn:
+			pc = branch(uint32(len(labels) - 1))
+			continue
+
+		case wasm.OpCall:
+			idx := ins.Imm.Index
+			if int(idx) >= len(in.Funcs) {
+				return trap(pc, newTrap(TrapMalformedCode, "call to function %d out of range", idx))
+			}
+			in.frames[frame].Offset = ins.Offset
+			if err := in.call(in.Funcs[idx]); err != nil {
+				return err
+			}
+
+		case wasm.OpCallIndirect:
+			elem := uint32(in.pop())
+			tableIdx := ins.Imm.Index2
+			if int(tableIdx) >= len(in.Tables) {
+				return trap(pc, newTrap(TrapMalformedCode, "table %d out of range", tableIdx))
+			}
+			tbl := in.Tables[tableIdx]
+			if int(elem) >= len(tbl.Elem) {
+				return trap(pc, newTrap(TrapTableOutOfBounds, "index %d, table size %d", elem, len(tbl.Elem)))
+			}
+			callee := tbl.Elem[elem]
+			if callee == nil {
+				return trap(pc, newTrap(TrapUninitializedElement, "index %d", elem))
+			}
+			typeIdx := ins.Imm.Index
+			if int(typeIdx) >= len(in.Module.Types) || callee.Type == nil || !in.Module.Types[typeIdx].Equal(callee.Type) {
+				return trap(pc, newTrap(TrapIndirectCallTypeMismatch, "index %d", elem))
+			}
+			in.frames[frame].Offset = ins.Offset
+			if err := in.call(callee); err != nil {
+				return err
+			}
+
+		case wasm.OpDrop:
+			in.pop()
+
+		case wasm.OpSelect, wasm.OpSelectTyped:
+			cond := uint32(in.pop())
+			b := in.pop()
+			if cond == 0 {
+				*in.top() = b
+			}
+
+		case wasm.OpLocalGet:
+			in.push(locals[ins.Imm.Index])
+		case wasm.OpLocalSet:
+			locals[ins.Imm.Index] = in.pop()
+		case wasm.OpLocalTee:
+			locals[ins.Imm.Index] = *in.top()
+
+		case wasm.OpGlobalGet:
+			in.push(in.Globals[ins.Imm.Index].Value)
+		case wasm.OpGlobalSet:
+			in.Globals[ins.Imm.Index].Value = in.pop()
+
+		case wasm.OpTableGet:
+			tbl := in.Tables[ins.Imm.Index]
+			i := uint32(in.pop())
+			if int(i) >= len(tbl.Elem) {
+				return trap(pc, newTrap(TrapTableOutOfBounds, "index %d, table size %d", i, len(tbl.Elem)))
+			}
+			in.push(in.refOf(tbl.Elem[i]))
+		case wasm.OpTableSet:
+			tbl := in.Tables[ins.Imm.Index]
+			ref := in.pop()
+			i := uint32(in.pop())
+			if int(i) >= len(tbl.Elem) {
+				return trap(pc, newTrap(TrapTableOutOfBounds, "index %d, table size %d", i, len(tbl.Elem)))
+			}
+			tbl.Elem[i] = in.funcOfRef(ref)
+
+		case wasm.OpMemorySize:
+			in.push(uint64(in.mem().Pages()))
+		case wasm.OpMemoryGrow:
+			delta := uint32(in.pop())
+			old, ok := in.mem().Grow(delta)
+			if ok {
+				in.push(uint64(old))
+			} else {
+				in.push(uint64(0xffffffff))
+			}
+
+		case wasm.OpI32Const, wasm.OpI64Const, wasm.OpF32Const, wasm.OpF64Const:
+			in.push(ins.Imm.Bits)
+
+		case wasm.OpRefNull:
+			in.push(wasm.NullRef)
+		case wasm.OpRefIsNull:
+			if in.pop() == wasm.NullRef {
+				in.push(1)
+			} else {
+				in.push(0)
+			}
+		case wasm.OpRefFunc:
+			in.push(uint64(ins.Imm.Index))
+
+		default:
+			var t *Trap
+			switch {
+			case ins.Opcode.IsMemoryAccess():
+				t = in.memoryAccess(ins)
+			case ins.Opcode >= wasm.OpMemoryInit && ins.Opcode <= wasm.OpTableFill:
+				t = in.bulk(ins)
+			default:
+				t = in.numeric(ins)
+			}
+			if t != nil {
+				return trap(pc, t)
+			}
+		}
+		pc++
+	}
+
+	in.frames = in.frames[:frame]
+	if tracing {
+		in.Tracer(Event{Kind: EventReturn, Func: fn.Index})
+	}
+	if len(in.stack) != base+nresults {
+		copy(in.stack[base:], in.stack[len(in.stack)-nresults:])
+		in.stack = in.stack[:base+nresults]
+	}
+	return nil
+}
+
+// Apply executes one instruction that neither branches nor calls, such as
+// an arithmetic, conversion, memory or bulk instruction, with args as its
+// operands, and returns the values it leaves on the stack. Evaluators of
+// other representations of the code use it to share the interpreter's
+// semantics, traps included.
+func (in *Instance) Apply(ins *wasm.Instruction, args ...uint64) (results []uint64, err error) {
+	height := len(in.stack)
+	defer func() {
+		if r := recover(); r != nil {
+			t, ok := r.(*Trap)
+			if !ok {
+				t = newTrap(TrapMalformedCode, "%v", r)
+			}
+			results, err = nil, t
+		}
+		in.stack = in.stack[:height]
+	}()
+
+	in.stack = append(in.stack, args...)
+	var t *Trap
+	switch {
+	case ins.Opcode == wasm.OpMemorySize:
+		in.push(uint64(in.mem().Pages()))
+	case ins.Opcode == wasm.OpMemoryGrow:
+		old, ok := in.mem().Grow(uint32(in.pop()))
+		if !ok {
+			old = 0xffffffff
+		}
+		in.push(uint64(old))
+	case ins.Opcode.IsMemoryAccess():
+		t = in.memoryAccess(ins)
+	case ins.Opcode >= wasm.OpMemoryInit && ins.Opcode <= wasm.OpTableFill:
+		t = in.bulk(ins)
+	default:
+		t = in.numeric(ins)
+	}
+	if t != nil {
+		return nil, t
+	}
+	return append([]uint64(nil), in.stack[height:]...), nil
+}
+
+// mem returns memory 0. Validated code only uses memory instructions when a
+// memory exists, so a missing one is reported as malformed code.
+func (in *Instance) mem() *Memory {
+	if len(in.Memories) == 0 {
+		panic(newTrap(TrapMalformedCode, "no memory"))
+	}
+	return in.Memories[0]
+}
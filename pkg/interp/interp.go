@@ -0,0 +1,473 @@
+package interp
+
+import (
+	"fmt"
+
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+// HostFunc implements an imported function in Go. args holds one raw value
+// per parameter of the import's declared type and the returned slice must
+// hold one per result. A returned error aborts execution and is passed to
+// the caller of Call unchanged.
+type HostFunc func(inst *Instance, args []uint64) ([]uint64, error)
+
+// Imports supplies the values an instance's imports are bound to, keyed by
+// module and field name.
+type Imports struct {
+	Funcs    map[string]map[string]HostFunc
+	Globals  map[string]map[string]*Global
+	Memories map[string]map[string]*Memory
+	Tables   map[string]map[string]*Table
+
+	// Fallback, when set, is consulted for function imports with no entry
+	// in Funcs. Returning nil leaves the import unresolved.
+	Fallback func(imp *wasm.Import) HostFunc
+}
+
+// TrapUnresolved is an Imports.Fallback that binds every missing function
+// import to a stub trapping with TrapUnresolvedImport, so modules can be
+// instantiated and explored without providing all of their imports.
+func TrapUnresolved(imp *wasm.Import) HostFunc {
+	name := imp.Module + "." + imp.Name
+	return func(*Instance, []uint64) ([]uint64, error) {
+		return nil, newTrap(TrapUnresolvedImport, "%s", name)
+	}
+}
+
+func NewImports() *Imports {
+	return &Imports{
+		Funcs:    make(map[string]map[string]HostFunc),
+		Globals:  make(map[string]map[string]*Global),
+		Memories: make(map[string]map[string]*Memory),
+		Tables:   make(map[string]map[string]*Table),
+	}
+}
+
+func (im *Imports) AddFunc(module, name string, fn HostFunc) {
+	if im.Funcs[module] == nil {
+		im.Funcs[module] = make(map[string]HostFunc)
+	}
+	im.Funcs[module][name] = fn
+}
+
+func (im *Imports) AddGlobal(module, name string, g *Global) {
+	if im.Globals[module] == nil {
+		im.Globals[module] = make(map[string]*Global)
+	}
+	im.Globals[module][name] = g
+}
+
+func (im *Imports) AddMemory(module, name string, m *Memory) {
+	if im.Memories[module] == nil {
+		im.Memories[module] = make(map[string]*Memory)
+	}
+	im.Memories[module][name] = m
+}
+
+func (im *Imports) AddTable(module, name string, t *Table) {
+	if im.Tables[module] == nil {
+		im.Tables[module] = make(map[string]*Table)
+	}
+	im.Tables[module][name] = t
+}
+
+// Function is a callable entry of an instance's function index space, either
+// defined in the module or bound to a host implementation.
+type Function struct {
+	Index uint32
+	Type  *wasm.FuncType
+
+	inst *Instance
+	def  *wasm.ResolvedFunction
+	host HostFunc
+	code *compiledFunc
+}
+
+func (f *Function) IsHost() bool {
+	return f.host != nil
+}
+
+// Call invokes f in the instance it belongs to.
+func (f *Function) Call(args ...uint64) ([]uint64, error) {
+	return f.inst.CallFunc(f.Index, args...)
+}
+
+// Instance is an instantiated module.
+type Instance struct {
+	Module   *wasm.ResolvedModule
+	Funcs    []*Function
+	Tables   []*Table
+	Memories []*Memory
+	Globals  []*Global
+
+	// MaxCallDepth bounds the wasm call stack; exceeding it traps with
+	// TrapCallStackExhausted.
+	MaxCallDepth int
+
+	// Fuel is the number of instructions left to run when Metered is set.
+	// It is decremented as code runs, and an instruction found with no
+	// fuel left traps with TrapOutOfFuel instead of running.
+	Fuel    uint64
+	Metered bool
+
+	// Tracer, when set, is called for every executed instruction, call,
+	// return, memory access and host call.
+	Tracer func(ev Event)
+
+	// Hook, when set, is called before each instruction of a defined
+	// function executes. A returned error aborts the call with that error.
+	Hook func(s *Step) error
+
+	data   [][]byte
+	elems  [][]uint32
+	stack  []uint64
+	frames []Frame
+	refs   map[*Function]uint64
+}
+
+const defaultMaxCallDepth = 10000
+
+// Instantiate binds imports, allocates tables, memories and globals, applies
+// active element and data segments and runs the start function.
+func Instantiate(rm *wasm.ResolvedModule, imports *Imports) (*Instance, error) {
+	in, err := NewInstance(rm, imports)
+	if err != nil {
+		return nil, err
+	}
+	if err := in.RunStart(); err != nil {
+		return nil, err
+	}
+	return in, nil
+}
+
+// NewInstance is Instantiate without running the start function, for
+// callers that want to configure the instance first or skip it entirely.
+func NewInstance(rm *wasm.ResolvedModule, imports *Imports) (*Instance, error) {
+	if imports == nil {
+		imports = NewImports()
+	}
+	in := &Instance{
+		Module:       rm,
+		MaxCallDepth: defaultMaxCallDepth,
+		refs:         make(map[*Function]uint64),
+	}
+
+	if err := in.bindImports(imports); err != nil {
+		return nil, err
+	}
+
+	for i := range rm.Functions {
+		fn := &rm.Functions[i]
+		if fn.Imported {
+			continue
+		}
+		in.Funcs = append(in.Funcs, &Function{Index: fn.Index, Type: fn.Type, inst: in, def: fn})
+	}
+	for _, t := range rm.Tables {
+		in.Tables = append(in.Tables, NewTable(t.Limits))
+	}
+	for _, m := range rm.Memories {
+		if m.Min > MaxPages {
+			return nil, &LinkError{Msg: fmt.Sprintf("memory of %d pages exceeds the 4GiB limit", m.Min)}
+		}
+		in.Memories = append(in.Memories, NewMemory(m))
+	}
+
+	if err := in.initGlobals(); err != nil {
+		return nil, err
+	}
+	if err := in.initElements(); err != nil {
+		return nil, err
+	}
+	if err := in.initData(); err != nil {
+		return nil, err
+	}
+
+	return in, nil
+}
+
+// RunStart runs the module's start function, if it has one.
+func (in *Instance) RunStart() error {
+	if in.Module.Start == nil {
+		return nil
+	}
+	_, err := in.CallFunc(*in.Module.Start)
+	return err
+}
+
+func (in *Instance) bindImports(imports *Imports) error {
+	rm := in.Module
+	var funcIdx uint32
+	for i := range rm.Imports {
+		imp := &rm.Imports[i]
+		switch imp.Kind {
+		case wasm.ImportFunc:
+			fn := imports.Funcs[imp.Module][imp.Name]
+			if fn == nil && imports.Fallback != nil {
+				fn = imports.Fallback(imp)
+			}
+			if fn == nil {
+				return &LinkError{Module: imp.Module, Name: imp.Name, Msg: "function import not provided"}
+			}
+			var typ *wasm.FuncType
+			if int(imp.TypeIdx) < len(rm.Types) {
+				typ = &rm.Types[imp.TypeIdx]
+			}
+			in.Funcs = append(in.Funcs, &Function{Index: funcIdx, Type: typ, inst: in, host: fn})
+			funcIdx++
+
+		case wasm.ImportTable:
+			t := imports.Tables[imp.Module][imp.Name]
+			if t == nil {
+				t = NewTable(*imp.Table)
+			}
+			in.Tables = append(in.Tables, t)
+
+		case wasm.ImportMemory:
+			m := imports.Memories[imp.Module][imp.Name]
+			if m == nil {
+				if imp.Memory.Min > MaxPages {
+					return &LinkError{Module: imp.Module, Name: imp.Name, Msg: "memory exceeds the 4GiB limit"}
+				}
+				m = NewMemory(*imp.Memory)
+			} else if m.Pages() < imp.Memory.Min {
+				return &LinkError{Module: imp.Module, Name: imp.Name, Msg: fmt.Sprintf("memory has %d pages, import needs %d", m.Pages(), imp.Memory.Min)}
+			}
+			in.Memories = append(in.Memories, m)
+
+		case wasm.ImportGlobal:
+			g := imports.Globals[imp.Module][imp.Name]
+			if g == nil {
+				return &LinkError{Module: imp.Module, Name: imp.Name, Msg: "global import not provided"}
+			}
+			if g.Type.Type != imp.Global.Type || g.Type.Mutable != imp.Global.Mutable {
+				return &LinkError{Module: imp.Module, Name: imp.Name, Msg: "global type mismatch"}
+			}
+			in.Globals = append(in.Globals, g)
+		}
+	}
+	return nil
+}
+
+func (in *Instance) initGlobals() error {
+	values := make([]wasm.ConstValue, len(in.Globals))
+	for i, g := range in.Globals {
+		values[i] = wasm.ConstValue{Type: g.Type.Type, Bits: g.Value}
+	}
+	for i := range in.Module.Globals {
+		def := &in.Module.Globals[i]
+		v, err := in.Module.EvalConstExpr(def.Init, values)
+		if err != nil {
+			return &LinkError{Msg: fmt.Sprintf("global %d: %v", len(in.Globals), err)}
+		}
+		in.Globals = append(in.Globals, &Global{Type: def.Type, Value: v.Bits})
+		values = append(values, v)
+	}
+	return nil
+}
+
+func (in *Instance) globalValues() []wasm.ConstValue {
+	values := make([]wasm.ConstValue, len(in.Globals))
+	for i, g := range in.Globals {
+		values[i] = wasm.ConstValue{Type: g.Type.Type, Bits: g.Value}
+	}
+	return values
+}
+
+// initElements applies the active element segments. Active and
+// declarative segments are dropped once instantiated, so in.elems only
+// keeps the passive ones for table.init.
+func (in *Instance) initElements() error {
+	globals := in.globalValues()
+	in.elems = make([][]uint32, len(in.Module.Elements))
+	for i := range in.Module.Elements {
+		seg := &in.Module.Elements[i]
+		if seg.Passive {
+			in.elems[i] = seg.FuncIdxs
+			continue
+		}
+		if seg.Declarative {
+			continue
+		}
+		off, err := in.Module.EvalConstExpr(seg.Offset, globals)
+		if err != nil {
+			return &LinkError{Msg: fmt.Sprintf("element segment %d: %v", i, err)}
+		}
+		if int(seg.TableIndex) >= len(in.Tables) {
+			return &LinkError{Msg: fmt.Sprintf("element segment %d: table %d out of range", i, seg.TableIndex)}
+		}
+		tbl := in.Tables[seg.TableIndex]
+		start := uint64(uint32(off.Bits))
+		if start+uint64(len(seg.FuncIdxs)) > uint64(len(tbl.Elem)) {
+			return &LinkError{Msg: fmt.Sprintf("element segment %d does not fit table %d", i, seg.TableIndex)}
+		}
+		for j, idx := range seg.FuncIdxs {
+			if idx == wasm.NullElem {
+				tbl.Elem[start+uint64(j)] = nil
+				continue
+			}
+			if int(idx) >= len(in.Funcs) {
+				return &LinkError{Msg: fmt.Sprintf("element segment %d: function %d out of range", i, idx)}
+			}
+			tbl.Elem[start+uint64(j)] = in.Funcs[idx]
+		}
+	}
+	return nil
+}
+
+func (in *Instance) initData() error {
+	globals := in.globalValues()
+	in.data = make([][]byte, len(in.Module.Data))
+	for i := range in.Module.Data {
+		seg := &in.Module.Data[i]
+		if seg.Passive {
+			in.data[i] = seg.Data
+			continue
+		}
+		if int(seg.MemoryIndex) >= len(in.Memories) {
+			return &LinkError{Msg: fmt.Sprintf("data segment %d: memory %d out of range", i, seg.MemoryIndex)}
+		}
+		off, err := in.Module.EvalConstExpr(seg.Offset, globals)
+		if err != nil {
+			return &LinkError{Msg: fmt.Sprintf("data segment %d: %v", i, err)}
+		}
+		if !in.Memories[seg.MemoryIndex].Write(uint32(off.Bits), seg.Data) {
+			return &LinkError{Msg: fmt.Sprintf("data segment %d does not fit memory %d", i, seg.MemoryIndex)}
+		}
+	}
+	return nil
+}
+
+// Memory returns memory 0, or nil if the module has none.
+func (in *Instance) Memory() *Memory {
+	if len(in.Memories) == 0 {
+		return nil
+	}
+	return in.Memories[0]
+}
+
+// Call invokes the function exported under name.
+func (in *Instance) Call(name string, args ...uint64) ([]uint64, error) {
+	exp := in.Module.GetExport(name)
+	if exp == nil || exp.Kind != wasm.ExportFunc {
+		return nil, fmt.Errorf("no exported function %q", name)
+	}
+	return in.CallFunc(exp.Index, args...)
+}
+
+// CallFunc invokes function idx of the instance's index space. It may be
+// called re-entrantly from host functions.
+func (in *Instance) CallFunc(idx uint32, args ...uint64) (results []uint64, err error) {
+	if int(idx) >= len(in.Funcs) {
+		return nil, fmt.Errorf("function %d out of range", idx)
+	}
+	fn := in.Funcs[idx]
+	if fn.Type == nil {
+		return nil, fmt.Errorf("function %d has no type", idx)
+	}
+	if len(args) != len(fn.Type.Params) {
+		return nil, fmt.Errorf("function %d takes %d arguments, got %d", idx, len(fn.Type.Params), len(args))
+	}
+
+	height := len(in.stack)
+	depth := len(in.frames)
+	defer func() {
+		if r := recover(); r != nil {
+			// Malformed bodies that slip past compilation surface as
+			// runtime panics; report them as traps.
+			t, ok := r.(*Trap)
+			if !ok {
+				t = newTrap(TrapMalformedCode, "%v", r)
+			}
+			results, err = nil, in.trapAt(t)
+		}
+		in.stack = in.stack[:height]
+		in.frames = in.frames[:depth]
+	}()
+
+	in.stack = append(in.stack, args...)
+	if err := in.call(fn); err != nil {
+		return nil, err
+	}
+	results = make([]uint64, len(fn.Type.Results))
+	copy(results, in.stack[len(in.stack)-len(results):])
+	return results, nil
+}
+
+// call runs fn with its arguments on top of the operand stack, leaving its
+// results in their place.
+func (in *Instance) call(fn *Function) error {
+	if fn.inst != in {
+		// A function from another instance reached through a shared table.
+		args := in.popN(len(fn.Type.Params))
+		results, err := fn.inst.CallFunc(fn.Index, args...)
+		if err != nil {
+			return err
+		}
+		in.stack = append(in.stack, results...)
+		return nil
+	}
+
+	if fn.host != nil {
+		in.trace(Event{Kind: EventHostCall, Func: fn.Index})
+		args := make([]uint64, len(fn.Type.Params))
+		copy(args, in.popN(len(args)))
+		results, err := fn.host(in, args)
+		if err != nil {
+			if t, ok := err.(*Trap); ok {
+				return in.trapAt(t)
+			}
+			return err
+		}
+		if len(results) != len(fn.Type.Results) {
+			return newTrap(TrapUnresolvedImport, "host function %d returned %d values, want %d", fn.Index, len(results), len(fn.Type.Results))
+		}
+		in.stack = append(in.stack, results...)
+		return nil
+	}
+
+	if len(in.frames) >= in.MaxCallDepth {
+		return in.trapAt(newTrap(TrapCallStackExhausted, ""))
+	}
+	return in.exec(fn)
+}
+
+func (in *Instance) popN(n int) []uint64 {
+	vals := in.stack[len(in.stack)-n:]
+	in.stack = in.stack[:len(in.stack)-n]
+	return vals
+}
+
+// trapAt attaches the current call stack to t.
+func (in *Instance) trapAt(t *Trap) *Trap {
+	if t.Frames == nil {
+		t.Frames = in.CallStack()
+	}
+	return t
+}
+
+// refOf returns the reference value for fn: its index in this instance, or
+// a fresh index past the module's functions for a foreign function.
+func (in *Instance) refOf(fn *Function) uint64 {
+	if fn == nil {
+		return wasm.NullRef
+	}
+	if fn.inst == in {
+		return uint64(fn.Index)
+	}
+	if r, ok := in.refs[fn]; ok {
+		return r
+	}
+	r := uint64(len(in.Funcs))
+	in.Funcs = append(in.Funcs, fn)
+	in.refs[fn] = r
+	return r
+}
+
+func (in *Instance) funcOfRef(ref uint64) *Function {
+	if ref == wasm.NullRef || ref >= uint64(len(in.Funcs)) {
+		return nil
+	}
+	return in.Funcs[ref]
+}
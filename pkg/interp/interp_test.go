@@ -0,0 +1,255 @@
+package interp
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/0xInception/wasmspy/internal/wasmtest"
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+// singleFunc builds a module with one memory page and one function exported
+// as "f".
+func singleFunc(t *testing.T, params, results []wasm.ValType, body ...byte) *Instance {
+	t.Helper()
+	typ := []byte{0x01, 0x60, byte(len(params))}
+	for _, p := range params {
+		typ = append(typ, byte(p))
+	}
+	typ = append(typ, byte(len(results)))
+	for _, r := range results {
+		typ = append(typ, byte(r))
+	}
+	entry := append([]byte{0x00}, body...)
+	entry = append(entry, 0x0b)
+	code := append([]byte{0x01, byte(len(entry))}, entry...)
+
+	data := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	for _, s := range []struct {
+		id      byte
+		content []byte
+	}{
+		{0x01, typ},
+		{0x03, []byte{0x01, 0x00}},
+		{0x05, []byte{0x01, 0x00, 0x01}},
+		{0x07, []byte{0x01, 0x01, 'f', 0x00, 0x00}},
+		{0x0a, code},
+	} {
+		data = append(data, s.id, byte(len(s.content)))
+		data = append(data, s.content...)
+	}
+
+	mod, err := wasm.Parse(data)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	rm, err := wasm.Resolve(mod)
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	inst, err := Instantiate(rm, nil)
+	if err != nil {
+		t.Fatalf("instantiate: %v", err)
+	}
+	return inst
+}
+
+func TestRunTestdata(t *testing.T) {
+	tests := []struct {
+		file string
+		fn   string
+		args []uint64
+		want uint64
+	}{
+		{"arithmetic.wasm", "multiply", []uint64{6, 7}, 42},
+		{"arithmetic.wasm", "is_zero", []uint64{0}, 1},
+		{"arithmetic.wasm", "is_zero", []uint64{3}, 0},
+		{"control_flow.wasm", "abs", []uint64{I32(-5)}, 5},
+		{"control_flow.wasm", "abs", []uint64{9}, 9},
+		{"control_flow.wasm", "sum_to_n", []uint64{10}, 45},
+	}
+	for _, tt := range tests {
+		inst, err := Instantiate(wasmtest.Load(t, tt.file), nil)
+		if err != nil {
+			t.Fatalf("%s: instantiate: %v", tt.file, err)
+		}
+		got, err := inst.Call(tt.fn, tt.args...)
+		if err != nil {
+			t.Errorf("%s(%v): %v", tt.fn, tt.args, err)
+			continue
+		}
+		if len(got) != 1 || got[0] != tt.want {
+			t.Errorf("%s(%v) = %v, want %d", tt.fn, tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestRunMemory(t *testing.T) {
+	inst, err := Instantiate(wasmtest.Load(t, "control_flow.wasm"), nil)
+	if err != nil {
+		t.Fatalf("instantiate: %v", err)
+	}
+	if _, err := inst.Call("store_value", 16, 0xdeadbeef); err != nil {
+		t.Fatalf("store_value: %v", err)
+	}
+	if v, ok := inst.Memory().ReadUint32(16); !ok || v != 0xdeadbeef {
+		t.Errorf("memory[16] = 0x%x, %v", v, ok)
+	}
+
+	_, err = inst.Call("store_value", 65534, 1)
+	var trap *Trap
+	if !errors.As(err, &trap) || trap.Code != TrapMemoryOutOfBounds {
+		t.Errorf("expected out of bounds trap, got %v", err)
+	}
+}
+
+func TestHostImport(t *testing.T) {
+	rm := wasmtest.Load(t, "with_import.wasm")
+	if _, err := Instantiate(rm, nil); err == nil {
+		t.Fatal("expected link error for missing import")
+	}
+
+	imports := NewImports()
+	imports.AddFunc("env", "log", func(inst *Instance, args []uint64) ([]uint64, error) {
+		return nil, nil
+	})
+	inst, err := Instantiate(rm, imports)
+	if err != nil {
+		t.Fatalf("instantiate: %v", err)
+	}
+	got, err := inst.Call("main")
+	if err != nil || len(got) != 1 || got[0] != 42 {
+		t.Errorf("main() = %v, %v", got, err)
+	}
+}
+
+func TestTraps(t *testing.T) {
+	i32 := []wasm.ValType{wasm.ValI32}
+	tests := []struct {
+		name string
+		body []byte
+		code TrapCode
+	}{
+		{"unreachable", []byte{0x00}, TrapUnreachable},
+		{"div by zero", []byte{0x41, 0x01, 0x41, 0x00, 0x6d}, TrapDivideByZero},
+		{"div overflow", []byte{0x41, 0x80, 0x80, 0x80, 0x80, 0x78, 0x41, 0x7f, 0x6d}, TrapIntegerOverflow},
+		{"trunc nan", []byte{0x43, 0x00, 0x00, 0xc0, 0x7f, 0xa8}, TrapInvalidConversion},
+		{"trunc range", []byte{0x43, 0x00, 0x00, 0x00, 0x4f, 0xa8}, TrapIntegerOverflow},
+	}
+	for _, tt := range tests {
+		inst := singleFunc(t, nil, i32, tt.body...)
+		_, err := inst.Call("f")
+		var trap *Trap
+		if !errors.As(err, &trap) || trap.Code != tt.code {
+			t.Errorf("%s: expected %v trap, got %v", tt.name, tt.code, err)
+			continue
+		}
+		if len(trap.Frames) != 1 || trap.Frames[0].Func != 0 {
+			t.Errorf("%s: unexpected frames %v", tt.name, trap.Frames)
+		}
+	}
+}
+
+func TestNumeric(t *testing.T) {
+	i32 := []wasm.ValType{wasm.ValI32}
+	f64 := []wasm.ValType{wasm.ValF64}
+	tests := []struct {
+		name    string
+		params  []wasm.ValType
+		results []wasm.ValType
+		body    []byte
+		args    []uint64
+		want    uint64
+	}{
+		{"rotl", []wasm.ValType{wasm.ValI32, wasm.ValI32}, i32, []byte{0x20, 0x00, 0x20, 0x01, 0x77}, []uint64{0x80000001, 1}, 3},
+		{"shr_s masked", []wasm.ValType{wasm.ValI32, wasm.ValI32}, i32, []byte{0x20, 0x00, 0x20, 0x01, 0x75}, []uint64{I32(-8), 33}, I32(-4)},
+		{"rem_s -1", []wasm.ValType{wasm.ValI32, wasm.ValI32}, i32, []byte{0x20, 0x00, 0x20, 0x01, 0x6f}, []uint64{I32(math.MinInt32), I32(-1)}, 0},
+		{"clz", i32, i32, []byte{0x20, 0x00, 0x67}, []uint64{1}, 31},
+		{"extend8_s", i32, i32, []byte{0x20, 0x00, 0xc0}, []uint64{0xff}, I32(-1)},
+		{"nearest", f64, f64, []byte{0x20, 0x00, 0x9e}, []uint64{F64(2.5)}, F64(2)},
+		{"min zero", f64, f64, []byte{0x44, 0, 0, 0, 0, 0, 0, 0, 0, 0x20, 0x00, 0xa4}, []uint64{F64(math.Copysign(0, -1))}, F64(math.Copysign(0, -1))},
+		{"trunc_sat", f64, i32, []byte{0x20, 0x00, 0xfc, 0x02}, []uint64{F64(1e20)}, I32(math.MaxInt32)},
+		{"f64 lt", f64, i32, []byte{0x20, 0x00, 0x44, 0, 0, 0, 0, 0, 0, 0xf0, 0x3f, 0x63}, []uint64{F64(0.5)}, 1},
+	}
+	for _, tt := range tests {
+		inst := singleFunc(t, tt.params, tt.results, tt.body...)
+		got, err := inst.Call("f", tt.args...)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(got) != 1 || got[0] != tt.want {
+			t.Errorf("%s = %#x, want %#x", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFuel(t *testing.T) {
+	// loop br 0 end
+	inst := singleFunc(t, nil, nil, 0x03, 0x40, 0x0c, 0x00, 0x0b)
+	inst.Fuel, inst.Metered = 1000, true
+	_, err := inst.Call("f")
+	var trap *Trap
+	if !errors.As(err, &trap) || trap.Code != TrapOutOfFuel {
+		t.Errorf("expected out of fuel trap, got %v", err)
+	}
+	if inst.Fuel != 0 {
+		t.Errorf("%d fuel left after the trap", inst.Fuel)
+	}
+
+	// nop nop end runs on exactly its three instructions, and running
+	// out of fuel does not lift the limit.
+	inst = singleFunc(t, nil, nil, 0x01, 0x01, 0x0b)
+	inst.Fuel, inst.Metered = 3, true
+	if _, err := inst.Call("f"); err != nil || inst.Fuel != 0 {
+		t.Errorf("with exact fuel: %v, %d left", err, inst.Fuel)
+	}
+	if _, err := inst.Call("f"); !errors.As(err, &trap) || trap.Code != TrapOutOfFuel {
+		t.Errorf("with no fuel left: %v", err)
+	}
+}
+
+func TestValues(t *testing.T) {
+	for _, tt := range []struct {
+		t wasm.ValType
+		s string
+	}{
+		{wasm.ValI32, "-1"},
+		{wasm.ValI64, "0x7fffffffffffffff"},
+		{wasm.ValF32, "1.5"},
+		{wasm.ValF64, "-0.25"},
+	} {
+		v, err := ParseValue(tt.t, tt.s)
+		if err != nil {
+			t.Fatalf("ParseValue(%s): %v", tt.s, err)
+		}
+		back, err := ParseValue(tt.t, FormatValue(tt.t, v))
+		if err != nil || back != v {
+			t.Errorf("round trip of %s: %s", tt.s, FormatValue(tt.t, v))
+		}
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	fn := &wasm.ResolvedFunction{Index: 2, Type: &wasm.FuncType{Params: []wasm.ValType{wasm.ValI32, wasm.ValF64}}}
+	values, err := ParseArgs(fn, []string{"-1", "0.5"})
+	if err != nil || len(values) != 2 || values[0] != 0xffffffff || values[1] != F64(0.5) {
+		t.Errorf("ParseArgs: %v, %v", values, err)
+	}
+	if _, err := ParseArgs(fn, []string{"1"}); err == nil {
+		t.Error("missing argument accepted")
+	}
+	if _, err := ParseArgs(fn, []string{"1", "x"}); err == nil {
+		t.Error("bad argument accepted")
+	}
+
+	fixed, err := ParseFixedArgs(fn, []string{"?"}, "?")
+	if err != nil || len(fixed) != 0 {
+		t.Errorf("ParseFixedArgs: %v, %v", fixed, err)
+	}
+	fixed, err = ParseFixedArgs(fn, []string{"?", "2"}, "?")
+	if err != nil || len(fixed) != 1 || fixed[1] != F64(2) {
+		t.Errorf("ParseFixedArgs: %v, %v", fixed, err)
+	}
+}
@@ -0,0 +1,179 @@
+package interp
+
+import (
+	"encoding/binary"
+
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+const (
+	PageSize = 65536
+	MaxPages = 65536
+)
+
+// Memory is a linear memory. Host functions read and write it through the
+// bounds-checked helpers; Data may also be accessed directly.
+type Memory struct {
+	Data   []byte
+	Max    uint32
+	HasMax bool
+}
+
+func NewMemory(limits wasm.Limits) *Memory {
+	return &Memory{
+		Data:   make([]byte, uint64(limits.Min)*PageSize),
+		Max:    limits.Max,
+		HasMax: limits.HasMax,
+	}
+}
+
+func (m *Memory) Pages() uint32 {
+	return uint32(len(m.Data) / PageSize)
+}
+
+// Grow adds delta pages and returns the previous size in pages, or false if
+// the memory cannot grow that far.
+func (m *Memory) Grow(delta uint32) (uint32, bool) {
+	old := m.Pages()
+	next := uint64(old) + uint64(delta)
+	if next > MaxPages || (m.HasMax && next > uint64(m.Max)) {
+		return old, false
+	}
+	if delta > 0 {
+		m.Data = append(m.Data, make([]byte, uint64(delta)*PageSize)...)
+	}
+	return old, true
+}
+
+func (m *Memory) inBounds(addr uint64, n uint64) bool {
+	return addr+n <= uint64(len(m.Data))
+}
+
+// Read returns n bytes at addr, aliasing the memory.
+func (m *Memory) Read(addr, n uint32) ([]byte, bool) {
+	if !m.inBounds(uint64(addr), uint64(n)) {
+		return nil, false
+	}
+	return m.Data[addr : addr+n], true
+}
+
+func (m *Memory) Write(addr uint32, b []byte) bool {
+	if !m.inBounds(uint64(addr), uint64(len(b))) {
+		return false
+	}
+	copy(m.Data[addr:], b)
+	return true
+}
+
+// ReadString returns the n bytes at addr as a string.
+func (m *Memory) ReadString(addr, n uint32) (string, bool) {
+	b, ok := m.Read(addr, n)
+	return string(b), ok
+}
+
+// ReadCString returns the NUL-terminated string at addr.
+func (m *Memory) ReadCString(addr uint32) (string, bool) {
+	if uint64(addr) >= uint64(len(m.Data)) {
+		return "", false
+	}
+	for i := addr; int(i) < len(m.Data); i++ {
+		if m.Data[i] == 0 {
+			return string(m.Data[addr:i]), true
+		}
+	}
+	return "", false
+}
+
+func (m *Memory) ReadUint8(addr uint32) (byte, bool) {
+	if !m.inBounds(uint64(addr), 1) {
+		return 0, false
+	}
+	return m.Data[addr], true
+}
+
+func (m *Memory) ReadUint16(addr uint32) (uint16, bool) {
+	if !m.inBounds(uint64(addr), 2) {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint16(m.Data[addr:]), true
+}
+
+func (m *Memory) ReadUint32(addr uint32) (uint32, bool) {
+	if !m.inBounds(uint64(addr), 4) {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint32(m.Data[addr:]), true
+}
+
+func (m *Memory) ReadUint64(addr uint32) (uint64, bool) {
+	if !m.inBounds(uint64(addr), 8) {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint64(m.Data[addr:]), true
+}
+
+func (m *Memory) WriteUint8(addr uint32, v byte) bool {
+	if !m.inBounds(uint64(addr), 1) {
+		return false
+	}
+	m.Data[addr] = v
+	return true
+}
+
+func (m *Memory) WriteUint16(addr uint32, v uint16) bool {
+	if !m.inBounds(uint64(addr), 2) {
+		return false
+	}
+	binary.LittleEndian.PutUint16(m.Data[addr:], v)
+	return true
+}
+
+func (m *Memory) WriteUint32(addr uint32, v uint32) bool {
+	if !m.inBounds(uint64(addr), 4) {
+		return false
+	}
+	binary.LittleEndian.PutUint32(m.Data[addr:], v)
+	return true
+}
+
+func (m *Memory) WriteUint64(addr uint32, v uint64) bool {
+	if !m.inBounds(uint64(addr), 8) {
+		return false
+	}
+	binary.LittleEndian.PutUint64(m.Data[addr:], v)
+	return true
+}
+
+// Table holds function references; nil entries are null.
+type Table struct {
+	Elem   []*Function
+	Max    uint32
+	HasMax bool
+}
+
+func NewTable(limits wasm.Limits) *Table {
+	return &Table{
+		Elem:   make([]*Function, limits.Min),
+		Max:    limits.Max,
+		HasMax: limits.HasMax,
+	}
+}
+
+func (t *Table) Grow(delta uint32, init *Function) (uint32, bool) {
+	old := uint32(len(t.Elem))
+	next := uint64(old) + uint64(delta)
+	if next > 0xffffffff || (t.HasMax && next > uint64(t.Max)) {
+		return old, false
+	}
+	for i := uint32(0); i < delta; i++ {
+		t.Elem = append(t.Elem, init)
+	}
+	return old, true
+}
+
+// Global is a global variable holding a raw value; see the value helpers
+// for conversions.
+type Global struct {
+	Type  wasm.GlobalType
+	Value uint64
+}
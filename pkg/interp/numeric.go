@@ -0,0 +1,656 @@
+package interp
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+func (in *Instance) memoryAccess(ins *wasm.Instruction) *Trap {
+	mem := in.mem()
+	var size uint64
+	switch ins.Opcode {
+	case wasm.OpI32Load8S, wasm.OpI32Load8U, wasm.OpI64Load8S, wasm.OpI64Load8U, wasm.OpI32Store8, wasm.OpI64Store8:
+		size = 1
+	case wasm.OpI32Load16S, wasm.OpI32Load16U, wasm.OpI64Load16S, wasm.OpI64Load16U, wasm.OpI32Store16, wasm.OpI64Store16:
+		size = 2
+	case wasm.OpI32Load, wasm.OpF32Load, wasm.OpI64Load32S, wasm.OpI64Load32U, wasm.OpI32Store, wasm.OpF32Store, wasm.OpI64Store32:
+		size = 4
+	default:
+		size = 8
+	}
+
+	isStore := ins.Opcode >= wasm.OpI32Store
+	var value uint64
+	if isStore {
+		value = in.pop()
+	}
+	ea := uint64(uint32(in.pop())) + uint64(ins.Imm.MemArg.Offset)
+	if !mem.inBounds(ea, size) {
+		return newTrap(TrapMemoryOutOfBounds, "address 0x%x, size %d, memory size 0x%x", ea, size, len(mem.Data))
+	}
+	b := mem.Data[ea : ea+size]
+
+	if isStore {
+		in.trace(Event{Kind: EventStore, Offset: ins.Offset, Addr: ea, Size: size})
+		switch size {
+		case 1:
+			b[0] = byte(value)
+		case 2:
+			binary.LittleEndian.PutUint16(b, uint16(value))
+		case 4:
+			binary.LittleEndian.PutUint32(b, uint32(value))
+		default:
+			binary.LittleEndian.PutUint64(b, value)
+		}
+		return nil
+	}
+
+	var v uint64
+	switch ins.Opcode {
+	case wasm.OpI32Load8S:
+		v = uint64(uint32(int32(int8(b[0]))))
+	case wasm.OpI32Load8U, wasm.OpI64Load8U:
+		v = uint64(b[0])
+	case wasm.OpI32Load16S:
+		v = uint64(uint32(int32(int16(binary.LittleEndian.Uint16(b)))))
+	case wasm.OpI32Load16U, wasm.OpI64Load16U:
+		v = uint64(binary.LittleEndian.Uint16(b))
+	case wasm.OpI64Load8S:
+		v = uint64(int64(int8(b[0])))
+	case wasm.OpI64Load16S:
+		v = uint64(int64(int16(binary.LittleEndian.Uint16(b))))
+	case wasm.OpI64Load32S:
+		v = uint64(int64(int32(binary.LittleEndian.Uint32(b))))
+	case wasm.OpI32Load, wasm.OpF32Load, wasm.OpI64Load32U:
+		v = uint64(binary.LittleEndian.Uint32(b))
+	default:
+		v = binary.LittleEndian.Uint64(b)
+	}
+	in.trace(Event{Kind: EventLoad, Offset: ins.Offset, Addr: ea, Size: size})
+	in.push(v)
+	return nil
+}
+
+// bulk implements the bulk memory and table instructions.
+func (in *Instance) bulk(ins *wasm.Instruction) *Trap {
+	switch ins.Opcode {
+	case wasm.OpMemoryInit:
+		n, src, dst := uint64(uint32(in.pop())), uint64(uint32(in.pop())), uint64(uint32(in.pop()))
+		mem := in.mem()
+		if int(ins.Imm.Index) >= len(in.data) {
+			return newTrap(TrapMalformedCode, "data segment %d out of range", ins.Imm.Index)
+		}
+		seg := in.data[ins.Imm.Index]
+		if src+n > uint64(len(seg)) || !mem.inBounds(dst, n) {
+			return newTrap(TrapMemoryOutOfBounds, "memory.init of %d bytes", n)
+		}
+		copy(mem.Data[dst:], seg[src:src+n])
+		in.trace(Event{Kind: EventStore, Offset: ins.Offset, Addr: dst, Size: n})
+
+	case wasm.OpDataDrop:
+		if int(ins.Imm.Index) < len(in.data) {
+			in.data[ins.Imm.Index] = nil
+		}
+
+	case wasm.OpMemoryCopy:
+		n, src, dst := uint64(uint32(in.pop())), uint64(uint32(in.pop())), uint64(uint32(in.pop()))
+		mem := in.mem()
+		if !mem.inBounds(src, n) || !mem.inBounds(dst, n) {
+			return newTrap(TrapMemoryOutOfBounds, "memory.copy of %d bytes", n)
+		}
+		copy(mem.Data[dst:dst+n], mem.Data[src:src+n])
+		in.trace(Event{Kind: EventLoad, Offset: ins.Offset, Addr: src, Size: n})
+		in.trace(Event{Kind: EventStore, Offset: ins.Offset, Addr: dst, Size: n})
+
+	case wasm.OpMemoryFill:
+		n, val, dst := uint64(uint32(in.pop())), byte(in.pop()), uint64(uint32(in.pop()))
+		mem := in.mem()
+		if !mem.inBounds(dst, n) {
+			return newTrap(TrapMemoryOutOfBounds, "memory.fill of %d bytes", n)
+		}
+		for i := dst; i < dst+n; i++ {
+			mem.Data[i] = val
+		}
+		in.trace(Event{Kind: EventStore, Offset: ins.Offset, Addr: dst, Size: n})
+
+	case wasm.OpTableInit:
+		n, src, dst := uint64(uint32(in.pop())), uint64(uint32(in.pop())), uint64(uint32(in.pop()))
+		tbl := in.Tables[ins.Imm.Index2]
+		var seg []uint32
+		if int(ins.Imm.Index) < len(in.elems) {
+			seg = in.elems[ins.Imm.Index]
+		}
+		if src+n > uint64(len(seg)) || dst+n > uint64(len(tbl.Elem)) {
+			return newTrap(TrapTableOutOfBounds, "table.init of %d elements", n)
+		}
+		for i := uint64(0); i < n; i++ {
+			var fn *Function
+			if f := seg[src+i]; f != wasm.NullElem && int(f) < len(in.Funcs) {
+				fn = in.Funcs[f]
+			}
+			tbl.Elem[dst+i] = fn
+		}
+
+	case wasm.OpElemDrop:
+		if int(ins.Imm.Index) < len(in.elems) {
+			in.elems[ins.Imm.Index] = nil
+		}
+
+	case wasm.OpTableCopy:
+		n, src, dst := uint64(uint32(in.pop())), uint64(uint32(in.pop())), uint64(uint32(in.pop()))
+		dt, st := in.Tables[ins.Imm.Index], in.Tables[ins.Imm.Index2]
+		if src+n > uint64(len(st.Elem)) || dst+n > uint64(len(dt.Elem)) {
+			return newTrap(TrapTableOutOfBounds, "table.copy of %d elements", n)
+		}
+		copy(dt.Elem[dst:dst+n], st.Elem[src:src+n])
+
+	case wasm.OpTableGrow:
+		n := uint32(in.pop())
+		init := in.funcOfRef(in.pop())
+		old, ok := in.Tables[ins.Imm.Index].Grow(n, init)
+		if ok {
+			in.push(uint64(old))
+		} else {
+			in.push(uint64(0xffffffff))
+		}
+
+	case wasm.OpTableSize:
+		in.push(uint64(len(in.Tables[ins.Imm.Index].Elem)))
+
+	case wasm.OpTableFill:
+		n, ref, dst := uint64(uint32(in.pop())), in.pop(), uint64(uint32(in.pop()))
+		tbl := in.Tables[ins.Imm.Index]
+		if dst+n > uint64(len(tbl.Elem)) {
+			return newTrap(TrapTableOutOfBounds, "table.fill of %d elements", n)
+		}
+		fn := in.funcOfRef(ref)
+		for i := dst; i < dst+n; i++ {
+			tbl.Elem[i] = fn
+		}
+	}
+	return nil
+}
+
+func b2u(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// numeric implements the comparison, arithmetic and conversion instructions.
+func (in *Instance) numeric(ins *wasm.Instruction) *Trap {
+	op := ins.Opcode
+	switch op {
+	// Unary i32
+	case wasm.OpI32Eqz:
+		*in.top() = b2u(uint32(*in.top()) == 0)
+		return nil
+	case wasm.OpI32Clz:
+		*in.top() = uint64(bits.LeadingZeros32(uint32(*in.top())))
+		return nil
+	case wasm.OpI32Ctz:
+		*in.top() = uint64(bits.TrailingZeros32(uint32(*in.top())))
+		return nil
+	case wasm.OpI32Popcnt:
+		*in.top() = uint64(bits.OnesCount32(uint32(*in.top())))
+		return nil
+	case wasm.OpI32Extend8S:
+		*in.top() = uint64(uint32(int32(int8(*in.top()))))
+		return nil
+	case wasm.OpI32Extend16S:
+		*in.top() = uint64(uint32(int32(int16(*in.top()))))
+		return nil
+
+	// Unary i64
+	case wasm.OpI64Eqz:
+		*in.top() = b2u(*in.top() == 0)
+		return nil
+	case wasm.OpI64Clz:
+		*in.top() = uint64(bits.LeadingZeros64(*in.top()))
+		return nil
+	case wasm.OpI64Ctz:
+		*in.top() = uint64(bits.TrailingZeros64(*in.top()))
+		return nil
+	case wasm.OpI64Popcnt:
+		*in.top() = uint64(bits.OnesCount64(*in.top()))
+		return nil
+	case wasm.OpI64Extend8S:
+		*in.top() = uint64(int64(int8(*in.top())))
+		return nil
+	case wasm.OpI64Extend16S:
+		*in.top() = uint64(int64(int16(*in.top())))
+		return nil
+	case wasm.OpI64Extend32S:
+		*in.top() = uint64(int64(int32(*in.top())))
+		return nil
+	}
+
+	if op >= wasm.OpI32Eq && op <= wasm.OpI32GeU || op >= wasm.OpI32Add && op <= wasm.OpI32Rotr {
+		b := uint32(in.pop())
+		a := uint32(in.pop())
+		r, t := i32Binary(op, a, b)
+		if t != nil {
+			return t
+		}
+		in.push(uint64(r))
+		return nil
+	}
+	if op >= wasm.OpI64Eq && op <= wasm.OpI64GeU || op >= wasm.OpI64Add && op <= wasm.OpI64Rotr {
+		b := in.pop()
+		a := in.pop()
+		r, t := i64Binary(op, a, b)
+		if t != nil {
+			return t
+		}
+		in.push(r)
+		return nil
+	}
+	if op >= wasm.OpF32Eq && op <= wasm.OpF32Ge || op >= wasm.OpF32Add && op <= wasm.OpF32Copysign {
+		b := AsF32(in.pop())
+		a := AsF32(in.pop())
+		in.push(f32Binary(op, a, b))
+		return nil
+	}
+	if op >= wasm.OpF64Eq && op <= wasm.OpF64Ge || op >= wasm.OpF64Add && op <= wasm.OpF64Copysign {
+		b := AsF64(in.pop())
+		a := AsF64(in.pop())
+		in.push(f64Binary(op, a, b))
+		return nil
+	}
+	if op >= wasm.OpF32Abs && op <= wasm.OpF32Sqrt {
+		*in.top() = F32(float32(floatUnary(op-wasm.OpF32Abs, float64(AsF32(*in.top())), true)))
+		return nil
+	}
+	if op >= wasm.OpF64Abs && op <= wasm.OpF64Sqrt {
+		*in.top() = F64(floatUnary(op-wasm.OpF64Abs, AsF64(*in.top()), false))
+		return nil
+	}
+	if op >= wasm.OpI32WrapI64 && op <= wasm.OpF64ReinterpretI64 || op >= wasm.OpI32TruncSatF32S && op <= wasm.OpI64TruncSatF64U {
+		r, t := convert(op, *in.top())
+		if t != nil {
+			return t
+		}
+		*in.top() = r
+		return nil
+	}
+	return newTrap(TrapMalformedCode, "unsupported instruction %s", ins.Name)
+}
+
+func i32Binary(op wasm.Opcode, a, b uint32) (uint32, *Trap) {
+	switch op {
+	case wasm.OpI32Eq:
+		return uint32(b2u(a == b)), nil
+	case wasm.OpI32Ne:
+		return uint32(b2u(a != b)), nil
+	case wasm.OpI32LtS:
+		return uint32(b2u(int32(a) < int32(b))), nil
+	case wasm.OpI32LtU:
+		return uint32(b2u(a < b)), nil
+	case wasm.OpI32GtS:
+		return uint32(b2u(int32(a) > int32(b))), nil
+	case wasm.OpI32GtU:
+		return uint32(b2u(a > b)), nil
+	case wasm.OpI32LeS:
+		return uint32(b2u(int32(a) <= int32(b))), nil
+	case wasm.OpI32LeU:
+		return uint32(b2u(a <= b)), nil
+	case wasm.OpI32GeS:
+		return uint32(b2u(int32(a) >= int32(b))), nil
+	case wasm.OpI32GeU:
+		return uint32(b2u(a >= b)), nil
+	case wasm.OpI32Add:
+		return a + b, nil
+	case wasm.OpI32Sub:
+		return a - b, nil
+	case wasm.OpI32Mul:
+		return a * b, nil
+	case wasm.OpI32DivS:
+		if b == 0 {
+			return 0, newTrap(TrapDivideByZero, "")
+		}
+		if int32(a) == math.MinInt32 && int32(b) == -1 {
+			return 0, newTrap(TrapIntegerOverflow, "")
+		}
+		return uint32(int32(a) / int32(b)), nil
+	case wasm.OpI32DivU:
+		if b == 0 {
+			return 0, newTrap(TrapDivideByZero, "")
+		}
+		return a / b, nil
+	case wasm.OpI32RemS:
+		if b == 0 {
+			return 0, newTrap(TrapDivideByZero, "")
+		}
+		if int32(b) == -1 {
+			return 0, nil
+		}
+		return uint32(int32(a) % int32(b)), nil
+	case wasm.OpI32RemU:
+		if b == 0 {
+			return 0, newTrap(TrapDivideByZero, "")
+		}
+		return a % b, nil
+	case wasm.OpI32And:
+		return a & b, nil
+	case wasm.OpI32Or:
+		return a | b, nil
+	case wasm.OpI32Xor:
+		return a ^ b, nil
+	case wasm.OpI32Shl:
+		return a << (b & 31), nil
+	case wasm.OpI32ShrS:
+		return uint32(int32(a) >> (b & 31)), nil
+	case wasm.OpI32ShrU:
+		return a >> (b & 31), nil
+	case wasm.OpI32Rotl:
+		return bits.RotateLeft32(a, int(b&31)), nil
+	default: // OpI32Rotr
+		return bits.RotateLeft32(a, -int(b&31)), nil
+	}
+}
+
+func i64Binary(op wasm.Opcode, a, b uint64) (uint64, *Trap) {
+	switch op {
+	case wasm.OpI64Eq:
+		return b2u(a == b), nil
+	case wasm.OpI64Ne:
+		return b2u(a != b), nil
+	case wasm.OpI64LtS:
+		return b2u(int64(a) < int64(b)), nil
+	case wasm.OpI64LtU:
+		return b2u(a < b), nil
+	case wasm.OpI64GtS:
+		return b2u(int64(a) > int64(b)), nil
+	case wasm.OpI64GtU:
+		return b2u(a > b), nil
+	case wasm.OpI64LeS:
+		return b2u(int64(a) <= int64(b)), nil
+	case wasm.OpI64LeU:
+		return b2u(a <= b), nil
+	case wasm.OpI64GeS:
+		return b2u(int64(a) >= int64(b)), nil
+	case wasm.OpI64GeU:
+		return b2u(a >= b), nil
+	case wasm.OpI64Add:
+		return a + b, nil
+	case wasm.OpI64Sub:
+		return a - b, nil
+	case wasm.OpI64Mul:
+		return a * b, nil
+	case wasm.OpI64DivS:
+		if b == 0 {
+			return 0, newTrap(TrapDivideByZero, "")
+		}
+		if int64(a) == math.MinInt64 && int64(b) == -1 {
+			return 0, newTrap(TrapIntegerOverflow, "")
+		}
+		return uint64(int64(a) / int64(b)), nil
+	case wasm.OpI64DivU:
+		if b == 0 {
+			return 0, newTrap(TrapDivideByZero, "")
+		}
+		return a / b, nil
+	case wasm.OpI64RemS:
+		if b == 0 {
+			return 0, newTrap(TrapDivideByZero, "")
+		}
+		if int64(b) == -1 {
+			return 0, nil
+		}
+		return uint64(int64(a) % int64(b)), nil
+	case wasm.OpI64RemU:
+		if b == 0 {
+			return 0, newTrap(TrapDivideByZero, "")
+		}
+		return a % b, nil
+	case wasm.OpI64And:
+		return a & b, nil
+	case wasm.OpI64Or:
+		return a | b, nil
+	case wasm.OpI64Xor:
+		return a ^ b, nil
+	case wasm.OpI64Shl:
+		return a << (b & 63), nil
+	case wasm.OpI64ShrS:
+		return uint64(int64(a) >> (b & 63)), nil
+	case wasm.OpI64ShrU:
+		return a >> (b & 63), nil
+	case wasm.OpI64Rotl:
+		return bits.RotateLeft64(a, int(b&63)), nil
+	default: // OpI64Rotr
+		return bits.RotateLeft64(a, -int(b&63)), nil
+	}
+}
+
+func f32Binary(op wasm.Opcode, a, b float32) uint64 {
+	switch op {
+	case wasm.OpF32Eq:
+		return b2u(a == b)
+	case wasm.OpF32Ne:
+		return b2u(a != b)
+	case wasm.OpF32Lt:
+		return b2u(a < b)
+	case wasm.OpF32Gt:
+		return b2u(a > b)
+	case wasm.OpF32Le:
+		return b2u(a <= b)
+	case wasm.OpF32Ge:
+		return b2u(a >= b)
+	case wasm.OpF32Add:
+		return F32(a + b)
+	case wasm.OpF32Sub:
+		return F32(a - b)
+	case wasm.OpF32Mul:
+		return F32(a * b)
+	case wasm.OpF32Div:
+		return F32(a / b)
+	case wasm.OpF32Min:
+		return F32(float32(wasmMin(float64(a), float64(b))))
+	case wasm.OpF32Max:
+		return F32(float32(wasmMax(float64(a), float64(b))))
+	default: // OpF32Copysign
+		return uint64(math.Float32bits(a)&0x7fffffff | math.Float32bits(b)&0x80000000)
+	}
+}
+
+func f64Binary(op wasm.Opcode, a, b float64) uint64 {
+	switch op {
+	case wasm.OpF64Eq:
+		return b2u(a == b)
+	case wasm.OpF64Ne:
+		return b2u(a != b)
+	case wasm.OpF64Lt:
+		return b2u(a < b)
+	case wasm.OpF64Gt:
+		return b2u(a > b)
+	case wasm.OpF64Le:
+		return b2u(a <= b)
+	case wasm.OpF64Ge:
+		return b2u(a >= b)
+	case wasm.OpF64Add:
+		return F64(a + b)
+	case wasm.OpF64Sub:
+		return F64(a - b)
+	case wasm.OpF64Mul:
+		return F64(a * b)
+	case wasm.OpF64Div:
+		return F64(a / b)
+	case wasm.OpF64Min:
+		return F64(wasmMin(a, b))
+	case wasm.OpF64Max:
+		return F64(wasmMax(a, b))
+	default: // OpF64Copysign
+		return F64(math.Copysign(a, b))
+	}
+}
+
+// wasmMin and wasmMax propagate NaN and order -0 below +0, unlike a plain
+// comparison.
+func wasmMin(a, b float64) float64 {
+	if math.IsNaN(a) || math.IsNaN(b) {
+		return math.NaN()
+	}
+	return math.Min(a, b)
+}
+
+func wasmMax(a, b float64) float64 {
+	if math.IsNaN(a) || math.IsNaN(b) {
+		return math.NaN()
+	}
+	return math.Max(a, b)
+}
+
+// floatUnary applies abs..sqrt, indexed from abs. single selects f32
+// rounding for sqrt.
+func floatUnary(idx wasm.Opcode, x float64, single bool) float64 {
+	switch idx {
+	case 0:
+		return math.Abs(x)
+	case 1:
+		return -x
+	case 2:
+		return math.Ceil(x)
+	case 3:
+		return math.Floor(x)
+	case 4:
+		return math.Trunc(x)
+	case 5:
+		return math.RoundToEven(x)
+	default:
+		if single {
+			return float64(float32(math.Sqrt(x)))
+		}
+		return math.Sqrt(x)
+	}
+}
+
+// truncRange checks that x truncates into [lo, hi) and reports the trap if
+// not.
+func truncRange(x, lo, hi float64) *Trap {
+	if math.IsNaN(x) {
+		return newTrap(TrapInvalidConversion, "")
+	}
+	if t := math.Trunc(x); t < lo || t >= hi {
+		return newTrap(TrapIntegerOverflow, "")
+	}
+	return nil
+}
+
+func satI64(x, lo, hi float64) float64 {
+	switch {
+	case math.IsNaN(x):
+		return 0
+	case x <= lo:
+		return lo
+	case x >= hi:
+		return hi
+	}
+	return x
+}
+
+const (
+	two31 = 2147483648.0
+	two32 = 4294967296.0
+	two63 = 9223372036854775808.0
+	two64 = 18446744073709551616.0
+)
+
+func convert(op wasm.Opcode, v uint64) (uint64, *Trap) {
+	switch op {
+	case wasm.OpI32WrapI64:
+		return uint64(uint32(v)), nil
+	case wasm.OpI64ExtendI32S:
+		return uint64(int64(int32(v))), nil
+	case wasm.OpI64ExtendI32U:
+		return uint64(uint32(v)), nil
+
+	case wasm.OpI32TruncF32S, wasm.OpI32TruncF64S:
+		x := floatArg(op == wasm.OpI32TruncF32S, v)
+		if t := truncRange(x, -two31, two31); t != nil {
+			return 0, t
+		}
+		return uint64(uint32(int32(x))), nil
+	case wasm.OpI32TruncF32U, wasm.OpI32TruncF64U:
+		x := floatArg(op == wasm.OpI32TruncF32U, v)
+		if t := truncRange(x, 0, two32); t != nil {
+			return 0, t
+		}
+		return uint64(uint32(x)), nil
+	case wasm.OpI64TruncF32S, wasm.OpI64TruncF64S:
+		x := floatArg(op == wasm.OpI64TruncF32S, v)
+		if t := truncRange(x, -two63, two63); t != nil {
+			return 0, t
+		}
+		return uint64(int64(x)), nil
+	case wasm.OpI64TruncF32U, wasm.OpI64TruncF64U:
+		x := floatArg(op == wasm.OpI64TruncF32U, v)
+		if t := truncRange(x, 0, two64); t != nil {
+			return 0, t
+		}
+		return uint64(x), nil
+
+	case wasm.OpI32TruncSatF32S, wasm.OpI32TruncSatF64S:
+		x := satI64(floatArg(op == wasm.OpI32TruncSatF32S, v), -two31, two31-1)
+		return uint64(uint32(int32(x))), nil
+	case wasm.OpI32TruncSatF32U, wasm.OpI32TruncSatF64U:
+		x := satI64(floatArg(op == wasm.OpI32TruncSatF32U, v), 0, two32-1)
+		return uint64(uint32(x)), nil
+	case wasm.OpI64TruncSatF32S, wasm.OpI64TruncSatF64S:
+		x := floatArg(op == wasm.OpI64TruncSatF32S, v)
+		switch {
+		case math.IsNaN(x):
+			return 0, nil
+		case x < -two63:
+			return uint64(1) << 63, nil
+		case x >= two63:
+			return math.MaxInt64, nil
+		}
+		return uint64(int64(x)), nil
+	case wasm.OpI64TruncSatF32U, wasm.OpI64TruncSatF64U:
+		x := floatArg(op == wasm.OpI64TruncSatF32U, v)
+		switch {
+		case math.IsNaN(x) || x <= 0:
+			return 0, nil
+		case x >= two64:
+			return math.MaxUint64, nil
+		}
+		return uint64(x), nil
+
+	case wasm.OpF32ConvertI32S:
+		return F32(float32(int32(v))), nil
+	case wasm.OpF32ConvertI32U:
+		return F32(float32(uint32(v))), nil
+	case wasm.OpF32ConvertI64S:
+		return F32(float32(int64(v))), nil
+	case wasm.OpF32ConvertI64U:
+		return F32(float32(v)), nil
+	case wasm.OpF32DemoteF64:
+		return F32(float32(AsF64(v))), nil
+	case wasm.OpF64ConvertI32S:
+		return F64(float64(int32(v))), nil
+	case wasm.OpF64ConvertI32U:
+		return F64(float64(uint32(v))), nil
+	case wasm.OpF64ConvertI64S:
+		return F64(float64(int64(v))), nil
+	case wasm.OpF64ConvertI64U:
+		return F64(float64(v)), nil
+	case wasm.OpF64PromoteF32:
+		return F64(float64(AsF32(v))), nil
+
+	case wasm.OpI32ReinterpretF32, wasm.OpF32ReinterpretI32:
+		return uint64(uint32(v)), nil
+	default: // OpI64ReinterpretF64, OpF64ReinterpretI64
+		return v, nil
+	}
+}
+
+func floatArg(single bool, v uint64) float64 {
+	if single {
+		return float64(AsF32(v))
+	}
+	return AsF64(v)
+}
@@ -0,0 +1,46 @@
+package interp
+
+type EventKind uint8
+
+const (
+	EventInstr EventKind = iota
+	EventCall
+	EventReturn
+	EventLoad
+	EventStore
+	EventHostCall
+)
+
+var eventKindNames = [...]string{"instr", "call", "return", "load", "store", "host-call"}
+
+func (k EventKind) String() string {
+	if int(k) < len(eventKindNames) {
+		return eventKindNames[k]
+	}
+	return "unknown"
+}
+
+// Event is one step reported to an instance's Tracer.
+//
+// Instruction events carry the executing function and the instruction's file
+// offset. Call and return events name the function being entered or left,
+// and host calls the imported function index. Loads and stores carry the
+// instruction offset, the effective address and the access size; bulk
+// memory instructions report one load or store per touched range.
+type Event struct {
+	Kind   EventKind
+	Func   uint32
+	Offset uint64
+	Addr   uint64
+	Size   uint64
+}
+
+func (in *Instance) trace(ev Event) {
+	if in.Tracer == nil {
+		return
+	}
+	if (ev.Kind == EventLoad || ev.Kind == EventStore) && len(in.frames) > 0 {
+		ev.Func = in.frames[len(in.frames)-1].Func
+	}
+	in.Tracer(ev)
+}
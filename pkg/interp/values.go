@@ -0,0 +1,130 @@
+package interp
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+// Values cross the API as raw uint64 bit patterns: i32 zero-extended, i64 as
+// is, floats as their IEEE-754 bits and references as function indices, or
+// wasm.NullRef. These helpers convert to and from Go types.
+
+func I32(v int32) uint64     { return uint64(uint32(v)) }
+func I64(v int64) uint64     { return uint64(v) }
+func F32(v float32) uint64   { return uint64(math.Float32bits(v)) }
+func F64(v float64) uint64   { return math.Float64bits(v) }
+func AsI32(v uint64) int32   { return int32(uint32(v)) }
+func AsI64(v uint64) int64   { return int64(v) }
+func AsF32(v uint64) float32 { return math.Float32frombits(uint32(v)) }
+func AsF64(v uint64) float64 { return math.Float64frombits(v) }
+
+// ParseValue parses a command-line argument as a value of type t. Integers
+// accept decimal, 0x hex and negative forms.
+func ParseValue(t wasm.ValType, s string) (uint64, error) {
+	switch t {
+	case wasm.ValI32:
+		v, err := parseInt(s, 32)
+		if err != nil {
+			return 0, err
+		}
+		return uint64(uint32(v)), nil
+	case wasm.ValI64:
+		v, err := parseInt(s, 64)
+		if err != nil {
+			return 0, err
+		}
+		return v, nil
+	case wasm.ValF32:
+		v, err := strconv.ParseFloat(s, 32)
+		if err != nil {
+			return 0, err
+		}
+		return F32(float32(v)), nil
+	case wasm.ValF64:
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, err
+		}
+		return F64(v), nil
+	case wasm.ValFuncRef, wasm.ValExternRef:
+		if s == "null" {
+			return wasm.NullRef, nil
+		}
+		v, err := strconv.ParseUint(s, 0, 32)
+		if err != nil {
+			return 0, err
+		}
+		return v, nil
+	}
+	return 0, fmt.Errorf("unsupported value type %s", t)
+}
+
+// ParseArgs parses the arguments of a call to fn, one per parameter, with
+// ParseValue.
+func ParseArgs(fn *wasm.ResolvedFunction, args []string) ([]uint64, error) {
+	if len(args) != len(fn.Type.Params) {
+		return nil, fmt.Errorf("function %d takes %d arguments, got %d", fn.Index, len(fn.Type.Params), len(args))
+	}
+	values := make([]uint64, len(args))
+	for i, arg := range args {
+		v, err := ParseValue(fn.Type.Params[i], arg)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i, err)
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// ParseFixedArgs parses the leading arguments of a call to fn like
+// ParseArgs, keyed by parameter. Arguments equal to unknown, and any
+// parameters past the last argument, are left out.
+func ParseFixedArgs(fn *wasm.ResolvedFunction, args []string, unknown string) (map[int]uint64, error) {
+	if len(args) > len(fn.Type.Params) {
+		return nil, fmt.Errorf("function %d takes %d arguments, got %d", fn.Index, len(fn.Type.Params), len(args))
+	}
+	fixed := make(map[int]uint64)
+	for i, arg := range args {
+		if arg == unknown {
+			continue
+		}
+		v, err := ParseValue(fn.Type.Params[i], arg)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i, err)
+		}
+		fixed[i] = v
+	}
+	return fixed, nil
+}
+
+func parseInt(s string, bits int) (uint64, error) {
+	if strings.HasPrefix(s, "-") {
+		v, err := strconv.ParseInt(s, 0, bits)
+		return uint64(v), err
+	}
+	return strconv.ParseUint(s, 0, bits)
+}
+
+// FormatValue renders v as a value of type t. Integers are shown signed.
+func FormatValue(t wasm.ValType, v uint64) string {
+	switch t {
+	case wasm.ValI32:
+		return strconv.FormatInt(int64(AsI32(v)), 10)
+	case wasm.ValI64:
+		return strconv.FormatInt(AsI64(v), 10)
+	case wasm.ValF32:
+		return strconv.FormatFloat(float64(AsF32(v)), 'g', -1, 32)
+	case wasm.ValF64:
+		return strconv.FormatFloat(AsF64(v), 'g', -1, 64)
+	case wasm.ValFuncRef, wasm.ValExternRef:
+		if v == wasm.NullRef {
+			return "null"
+		}
+		return fmt.Sprintf("ref %d", v)
+	}
+	return fmt.Sprintf("0x%x", v)
+}
@@ -0,0 +1,188 @@
+package stubs
+
+import (
+	"strings"
+
+	"github.com/0xInception/wasmspy/pkg/interp"
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+// isBindgenModule reports whether an import module name is one wasm-bindgen
+// generates: "wbg" in current versions, the placeholder module, or the
+// "<crate>_bg.js" glue file in older ones.
+func isBindgenModule(module string) bool {
+	return module == "wbg" || module == "__wbindgen_placeholder__" || strings.HasSuffix(module, "_bg.js")
+}
+
+// WasmBindgen covers the __wbindgen_* intrinsics with a small emulation of
+// the JavaScript object heap: strings and numbers passed to JavaScript are
+// kept so they can be read back, cloned and dropped, and __wbindgen_throw
+// aborts with its message. The __wbg_* bindings to JavaScript APIs are not
+// covered and fall through to the default behavior.
+var WasmBindgen = &Preset{
+	Name: "wasm-bindgen",
+	Detect: func(rm *wasm.ResolvedModule) bool {
+		for i := range rm.Imports {
+			if isBindgenModule(rm.Imports[i].Module) && strings.HasPrefix(rm.Imports[i].Name, "__wbindgen_") {
+				return true
+			}
+		}
+		return false
+	},
+	bind: bindWasmBindgen,
+}
+
+// bindgenHeap mirrors the heap array of the generated glue: the first
+// heapReserved slots are unused and followed by undefined, null, true and
+// false.
+type bindgenHeap struct {
+	slots []any
+	free  []uint32
+}
+
+const heapReserved = 128
+
+type jsUndefined struct{}
+type jsNull struct{}
+
+func newBindgenHeap() *bindgenHeap {
+	h := &bindgenHeap{slots: make([]any, heapReserved)}
+	h.slots = append(h.slots, jsUndefined{}, jsNull{}, true, false)
+	return h
+}
+
+func (h *bindgenHeap) add(v any) uint64 {
+	if n := len(h.free); n > 0 {
+		idx := h.free[n-1]
+		h.free = h.free[:n-1]
+		h.slots[idx] = v
+		return uint64(idx)
+	}
+	h.slots = append(h.slots, v)
+	return uint64(len(h.slots) - 1)
+}
+
+func (h *bindgenHeap) get(idx uint64) any {
+	if idx >= uint64(len(h.slots)) {
+		return jsUndefined{}
+	}
+	if v := h.slots[idx]; v != nil {
+		return v
+	}
+	return jsUndefined{}
+}
+
+func (h *bindgenHeap) drop(idx uint64) {
+	if idx < heapReserved+4 || idx >= uint64(len(h.slots)) {
+		return
+	}
+	h.slots[idx] = nil
+	h.free = append(h.free, uint32(idx))
+}
+
+func bindWasmBindgen(rm *wasm.ResolvedModule) lookup {
+	heap := newBindgenHeap()
+
+	is := func(ft *wasm.FuncType, pred func(v any) bool) interp.HostFunc {
+		return func(_ *interp.Instance, args []uint64) ([]uint64, error) {
+			return results(ft, b2u(pred(heap.get(arg(args, 0))))), nil
+		}
+	}
+
+	return func(imp *wasm.Import, ft *wasm.FuncType) interp.HostFunc {
+		if !isBindgenModule(imp.Module) {
+			return nil
+		}
+		name := imp.Module + "." + imp.Name
+
+		switch imp.Name {
+		case "__wbindgen_throw", "__wbindgen_error_new":
+			return func(inst *interp.Instance, args []uint64) ([]uint64, error) {
+				var msg string
+				if mem := inst.Memory(); mem != nil {
+					msg, _ = mem.ReadString(uint32(arg(args, 0)), uint32(arg(args, 1)))
+				}
+				return nil, &AbortError{Import: name, Message: msg}
+			}
+		case "__wbindgen_string_new":
+			return func(inst *interp.Instance, args []uint64) ([]uint64, error) {
+				mem, err := memoryOf(inst)
+				if err != nil {
+					return nil, err
+				}
+				s, ok := mem.ReadString(uint32(arg(args, 0)), uint32(arg(args, 1)))
+				if !ok {
+					return nil, &interp.Trap{Code: interp.TrapMemoryOutOfBounds, Details: name}
+				}
+				return results(ft, heap.add(s)), nil
+			}
+		case "__wbindgen_number_new":
+			return func(_ *interp.Instance, args []uint64) ([]uint64, error) {
+				return results(ft, heap.add(interp.AsF64(arg(args, 0)))), nil
+			}
+		case "__wbindgen_object_clone_ref":
+			return func(_ *interp.Instance, args []uint64) ([]uint64, error) {
+				return results(ft, heap.add(heap.get(arg(args, 0)))), nil
+			}
+		case "__wbindgen_object_drop_ref":
+			return func(_ *interp.Instance, args []uint64) ([]uint64, error) {
+				heap.drop(arg(args, 0))
+				return results(ft), nil
+			}
+		case "__wbindgen_is_undefined":
+			return is(ft, func(v any) bool { _, ok := v.(jsUndefined); return ok })
+		case "__wbindgen_is_null":
+			return is(ft, func(v any) bool { _, ok := v.(jsNull); return ok })
+		case "__wbindgen_is_string":
+			return is(ft, func(v any) bool { _, ok := v.(string); return ok })
+		case "__wbindgen_string_get":
+			// Writes a (ptr, len) pair for a heap string at the return
+			// pointer, copying the string into memory allocated with
+			// the module's __wbindgen_malloc; a zero pointer means
+			// the value is not a string.
+			return func(inst *interp.Instance, args []uint64) ([]uint64, error) {
+				mem, err := memoryOf(inst)
+				if err != nil {
+					return nil, err
+				}
+				ret := uint32(arg(args, 0))
+				var ptr, n uint32
+				if s, ok := heap.get(arg(args, 1)).(string); ok {
+					n = uint32(len(s))
+					// Newer versions pass an alignment as well.
+					mallocArgs := []uint64{uint64(n), 1}
+					if f := inst.Module.GetFunctionByExport("__wbindgen_malloc"); f != nil && f.Type != nil && len(f.Type.Params) < 2 {
+						mallocArgs = mallocArgs[:len(f.Type.Params)]
+					}
+					alloc, ok, err := callExport(inst, "__wbindgen_malloc", mallocArgs...)
+					if err != nil {
+						return nil, err
+					}
+					if ok && len(alloc) == 1 {
+						ptr = uint32(alloc[0])
+						if !mem.Write(ptr, []byte(s)) {
+							return nil, &interp.Trap{Code: interp.TrapMemoryOutOfBounds, Details: name}
+						}
+					}
+				}
+				if !mem.WriteUint32(ret, ptr) || !mem.WriteUint32(ret+4, n) {
+					return nil, &interp.Trap{Code: interp.TrapMemoryOutOfBounds, Details: name}
+				}
+				return results(ft), nil
+			}
+		}
+		if strings.HasPrefix(imp.Name, "__wbindgen_describe") {
+			return func(*interp.Instance, []uint64) ([]uint64, error) {
+				return results(ft), nil
+			}
+		}
+		return nil
+	}
+}
+
+func b2u(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
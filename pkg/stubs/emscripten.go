@@ -0,0 +1,180 @@
+package stubs
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/0xInception/wasmspy/pkg/interp"
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+// thrown is raised by the Emscripten exception and longjmp helpers. The
+// invoke_* trampolines catch it the way the generated JavaScript does.
+type thrown struct {
+	Import string
+}
+
+func (e *thrown) Error() string {
+	return e.Import + ": exception thrown"
+}
+
+// Emscripten covers the runtime imports of the "env" module: abort and
+// assertion helpers, memcpy and heap resizing, clocks, the tempRet0 pair,
+// C++ exception and longjmp helpers, and the invoke_* trampolines that call
+// through table 0.
+var Emscripten = &Preset{
+	Name: "emscripten",
+	Detect: func(rm *wasm.ResolvedModule) bool {
+		for i := range rm.Imports {
+			imp := &rm.Imports[i]
+			if imp.Module != "env" {
+				continue
+			}
+			if strings.HasPrefix(imp.Name, "emscripten_") || strings.HasPrefix(imp.Name, "_emscripten_") || strings.HasPrefix(imp.Name, "invoke_") {
+				return true
+			}
+		}
+		return false
+	},
+	bind: bindEmscripten,
+}
+
+func bindEmscripten(rm *wasm.ResolvedModule) lookup {
+	var tempRet0 uint64
+	start := time.Now()
+
+	return func(imp *wasm.Import, ft *wasm.FuncType) interp.HostFunc {
+		if imp.Module != "env" {
+			return nil
+		}
+		name := imp.Module + "." + imp.Name
+		if strings.HasPrefix(imp.Name, "invoke_") {
+			return invoke(name, ft)
+		}
+
+		switch imp.Name {
+		case "abort", "_abort", "segfault", "alignfault":
+			return func(*interp.Instance, []uint64) ([]uint64, error) {
+				return nil, &AbortError{Import: name}
+			}
+		case "__assert_fail":
+			return func(inst *interp.Instance, args []uint64) ([]uint64, error) {
+				msg := "assertion failed"
+				if mem := inst.Memory(); mem != nil {
+					cond, _ := mem.ReadCString(uint32(arg(args, 0)))
+					file, _ := mem.ReadCString(uint32(arg(args, 1)))
+					msg = "assertion failed: " + cond + " at " + file
+				}
+				return nil, &AbortError{Import: name, Message: msg}
+			}
+		case "__cxa_throw", "_emscripten_throw_longjmp", "emscripten_longjmp":
+			return func(*interp.Instance, []uint64) ([]uint64, error) {
+				return nil, &thrown{Import: name}
+			}
+		case "emscripten_memcpy_big", "emscripten_memcpy_js", "_emscripten_memcpy_js":
+			return func(inst *interp.Instance, args []uint64) ([]uint64, error) {
+				mem, err := memoryOf(inst)
+				if err != nil {
+					return nil, err
+				}
+				dst, src, n := uint32(arg(args, 0)), uint32(arg(args, 1)), uint32(arg(args, 2))
+				b, ok := mem.Read(src, n)
+				if !ok || !mem.Write(dst, append([]byte(nil), b...)) {
+					return nil, &interp.Trap{Code: interp.TrapMemoryOutOfBounds, Details: name}
+				}
+				return results(ft, arg(args, 0)), nil
+			}
+		case "emscripten_resize_heap":
+			return func(inst *interp.Instance, args []uint64) ([]uint64, error) {
+				mem, err := memoryOf(inst)
+				if err != nil {
+					return nil, err
+				}
+				want := arg(args, 0)
+				if have := uint64(len(mem.Data)); want > have {
+					pages := (want - have + interp.PageSize - 1) / interp.PageSize
+					if _, ok := mem.Grow(uint32(pages)); !ok {
+						return results(ft, 0), nil
+					}
+				}
+				return results(ft, 1), nil
+			}
+		case "emscripten_get_heap_max":
+			return func(*interp.Instance, []uint64) ([]uint64, error) {
+				return results(ft, 2<<30), nil
+			}
+		case "emscripten_notify_memory_growth", "emscripten_scan_registers", "_emscripten_notify_mailbox_postmessage":
+			return func(*interp.Instance, []uint64) ([]uint64, error) {
+				return results(ft), nil
+			}
+		case "emscripten_get_now", "_emscripten_get_now":
+			return func(*interp.Instance, []uint64) ([]uint64, error) {
+				return results(ft, interp.F64(float64(time.Since(start).Nanoseconds())/1e6)), nil
+			}
+		case "emscripten_date_now", "_emscripten_date_now":
+			return func(*interp.Instance, []uint64) ([]uint64, error) {
+				return results(ft, interp.F64(float64(time.Now().UnixMilli()))), nil
+			}
+		case "_emscripten_get_now_is_monotonic":
+			return func(*interp.Instance, []uint64) ([]uint64, error) {
+				return results(ft, 1), nil
+			}
+		case "setTempRet0", "_setTempRet0":
+			return func(_ *interp.Instance, args []uint64) ([]uint64, error) {
+				tempRet0 = arg(args, 0)
+				return results(ft), nil
+			}
+		case "getTempRet0", "_getTempRet0":
+			return func(*interp.Instance, []uint64) ([]uint64, error) {
+				return results(ft, tempRet0), nil
+			}
+		}
+		return nil
+	}
+}
+
+// invoke implements invoke_<sig>(index, args...): it calls entry index of
+// table 0 and, when the callee throws, restores the stack pointer and calls
+// setThrew(1, 0) as the JavaScript glue does.
+func invoke(name string, ft *wasm.FuncType) interp.HostFunc {
+	return func(inst *interp.Instance, args []uint64) ([]uint64, error) {
+		if len(inst.Tables) == 0 || len(args) == 0 {
+			return nil, &interp.Trap{Code: interp.TrapTableOutOfBounds, Details: name}
+		}
+		elems := inst.Tables[0].Elem
+		idx := uint32(args[0])
+		if uint64(idx) >= uint64(len(elems)) || elems[idx] == nil {
+			return nil, &interp.Trap{Code: interp.TrapUninitializedElement, Details: name}
+		}
+		fn := elems[idx]
+		if int(fn.Index) >= len(inst.Funcs) || inst.Funcs[fn.Index] != fn {
+			return nil, &interp.Trap{Code: interp.TrapUninitializedElement, Details: name + ": foreign function"}
+		}
+
+		sp, _, err := callExport(inst, "stackSave")
+		if err != nil {
+			return nil, err
+		}
+		res, err := inst.CallFunc(fn.Index, args[1:]...)
+		var t *thrown
+		if !errors.As(err, &t) {
+			if err != nil {
+				return nil, err
+			}
+			return results(ft, res...), nil
+		}
+		if len(sp) == 1 {
+			if _, _, err := callExport(inst, "stackRestore", sp[0]); err != nil {
+				return nil, err
+			}
+		}
+		if _, ok, err := callExport(inst, "setThrew", 1, 0); err != nil || !ok {
+			if err == nil {
+				err = t
+			}
+			return nil, err
+		}
+		return results(ft), nil
+	}
+}
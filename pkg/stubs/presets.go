@@ -0,0 +1,74 @@
+package stubs
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/0xInception/wasmspy/pkg/interp"
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+// lookup returns the implementation of an import, or nil if the preset
+// does not provide it.
+type lookup func(imp *wasm.Import, ft *wasm.FuncType) interp.HostFunc
+
+// Preset implements the helper imports a toolchain's generated JavaScript
+// normally provides.
+type Preset struct {
+	Name string
+	// Detect reports whether rm looks like it was built by the toolchain.
+	Detect func(rm *wasm.ResolvedModule) bool
+	// bind returns a lookup with fresh state for one Register call.
+	bind func(rm *wasm.ResolvedModule) lookup
+}
+
+var presets = map[string]*Preset{
+	Emscripten.Name:  Emscripten,
+	WasmBindgen.Name: WasmBindgen,
+}
+
+func LookupPreset(name string) (*Preset, error) {
+	if p := presets[name]; p != nil {
+		return p, nil
+	}
+	return nil, fmt.Errorf("unknown preset %q (have %s)", name, strings.Join(PresetNames(), ", "))
+}
+
+func PresetNames() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DetectPresets returns the presets whose toolchain rm appears to come from.
+func DetectPresets(rm *wasm.ResolvedModule) []*Preset {
+	var found []*Preset
+	for _, name := range PresetNames() {
+		if p := presets[name]; p.Detect(rm) {
+			found = append(found, p)
+		}
+	}
+	return found
+}
+
+func memoryOf(inst *interp.Instance) (*interp.Memory, error) {
+	if mem := inst.Memory(); mem != nil {
+		return mem, nil
+	}
+	return nil, &interp.Trap{Code: interp.TrapMemoryOutOfBounds, Details: "module has no memory"}
+}
+
+// callExport calls the function exported under name, reporting false when
+// there is no such export.
+func callExport(inst *interp.Instance, name string, args ...uint64) ([]uint64, bool, error) {
+	exp := inst.Module.GetExport(name)
+	if exp == nil || exp.Kind != wasm.ExportFunc {
+		return nil, false, nil
+	}
+	results, err := inst.CallFunc(exp.Index, args...)
+	return results, true, err
+}
@@ -0,0 +1,110 @@
+package stubs
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/0xInception/wasmspy/pkg/interp"
+	"github.com/0xInception/wasmspy/pkg/wasm"
+	"gopkg.in/yaml.v3"
+)
+
+// Script holds canned import behavior keyed by "module.name". It is read
+// from YAML or JSON:
+//
+//	env.get_config:
+//	  returns: [42]
+//	env.next_byte:
+//	  sequence: [[1], [2], [3]]
+//	env.fatal:
+//	  trap: fatal error
+//
+// Values are numbers or strings in the syntax of interp.ParseValue.
+type Script map[string]*Response
+
+// Response is the behavior of one scripted import. Sequence gives the
+// results of successive calls, repeating its last entry; Returns is used
+// when there is no sequence. Trap aborts the call with a message instead.
+type Response struct {
+	Returns  []any   `yaml:"returns" json:"returns"`
+	Sequence [][]any `yaml:"sequence" json:"sequence"`
+	Trap     string  `yaml:"trap" json:"trap"`
+}
+
+// ParseScript reads a script in YAML or JSON.
+func ParseScript(data []byte) (Script, error) {
+	var s Script
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	for name, r := range s {
+		if r == nil {
+			return nil, fmt.Errorf("%s: empty response", name)
+		}
+	}
+	return s, nil
+}
+
+func LoadScript(path string) (Script, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseScript(data)
+}
+
+func parseResults(name string, ft *wasm.FuncType, values []any) ([]uint64, error) {
+	if len(values) != len(ft.Results) {
+		return nil, fmt.Errorf("%s: script gives %d results, import returns %d", name, len(values), len(ft.Results))
+	}
+	out := make([]uint64, len(values))
+	for i, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			s = fmt.Sprint(v)
+		}
+		r, err := interp.ParseValue(ft.Results[i], s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: result %d: %w", name, i, err)
+		}
+		out[i] = r
+	}
+	return out, nil
+}
+
+func (r *Response) hostFunc(name string, ft *wasm.FuncType) (interp.HostFunc, error) {
+	if r.Trap != "" {
+		return func(*interp.Instance, []uint64) ([]uint64, error) {
+			return nil, &AbortError{Import: name, Message: r.Trap}
+		}, nil
+	}
+
+	seq := r.Sequence
+	if len(seq) == 0 {
+		seq = [][]any{r.Returns}
+		if r.Returns == nil {
+			seq[0] = make([]any, len(ft.Results))
+			for i := range seq[0] {
+				seq[0][i] = 0
+			}
+		}
+	}
+	parsed := make([][]uint64, len(seq))
+	for i, values := range seq {
+		var err error
+		if parsed[i], err = parseResults(name, ft, values); err != nil {
+			return nil, err
+		}
+	}
+
+	var mu sync.Mutex
+	calls := 0
+	return func(*interp.Instance, []uint64) ([]uint64, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		out := parsed[min(calls, len(parsed)-1)]
+		calls++
+		return append([]uint64(nil), out...), nil
+	}, nil
+}
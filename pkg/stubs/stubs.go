@@ -0,0 +1,206 @@
+// Package stubs synthesizes implementations for a module's imports so it
+// can be executed without its real host: zero-returning stand-ins derived
+// from the import signatures, canned responses from a script, and presets
+// for the helper imports of common toolchains. Every call can be observed
+// through a callback.
+package stubs
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/0xInception/wasmspy/pkg/interp"
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+// Behavior is what a function import does when nothing else implements it.
+type Behavior int
+
+const (
+	// ReturnZero returns a zero value for every result.
+	ReturnZero Behavior = iota
+	// TrapCall traps with TrapUnresolvedImport, like interp.TrapUnresolved.
+	TrapCall
+)
+
+type Options struct {
+	Default Behavior
+	Script  Script
+	// Presets are consulted in order for imports the script does not
+	// cover.
+	Presets []*Preset
+	// OnCall, when set, is called after every call to a function import,
+	// including imports that were already bound before Register.
+	OnCall func(c *Call)
+}
+
+// ParseOptions builds Options from their textual form: behavior is "zero",
+// "trap" or empty for zero, and presets are preset names or "auto" for the
+// presets DetectPresets finds in rm.
+func ParseOptions(rm *wasm.ResolvedModule, behavior string, presets []string) (Options, error) {
+	var opts Options
+	switch behavior {
+	case "", "zero":
+		opts.Default = ReturnZero
+	case "trap":
+		opts.Default = TrapCall
+	default:
+		return opts, fmt.Errorf("unknown stub behavior %q, want trap or zero", behavior)
+	}
+	for _, name := range presets {
+		if name == "auto" {
+			opts.Presets = append(opts.Presets, DetectPresets(rm)...)
+			continue
+		}
+		p, err := LookupPreset(name)
+		if err != nil {
+			return opts, err
+		}
+		opts.Presets = append(opts.Presets, p)
+	}
+	return opts, nil
+}
+
+// Call records one call to a function import.
+type Call struct {
+	Import  string
+	Type    *wasm.FuncType
+	Args    []uint64
+	Results []uint64
+	Err     error
+}
+
+// String formats the call as "module.name(args) -> results".
+func (c *Call) String() string {
+	var b strings.Builder
+	b.WriteString(c.Import)
+	b.WriteByte('(')
+	for i, a := range c.Args {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(formatValue(c.Type.Params, i, a))
+	}
+	b.WriteByte(')')
+	if c.Err != nil {
+		fmt.Fprintf(&b, " !! %v", c.Err)
+	} else if len(c.Results) > 0 {
+		b.WriteString(" -> ")
+		for i, r := range c.Results {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(formatValue(c.Type.Results, i, r))
+		}
+	}
+	return b.String()
+}
+
+func formatValue(types []wasm.ValType, i int, v uint64) string {
+	if i < len(types) {
+		return interp.FormatValue(types[i], v)
+	}
+	return fmt.Sprint(v)
+}
+
+// AbortError ends execution from a stub, for imports such as abort or
+// wasm-bindgen's throw helper that never return to the module.
+type AbortError struct {
+	Import  string
+	Message string
+}
+
+func (e *AbortError) Error() string {
+	if e.Message == "" {
+		return e.Import + " called"
+	}
+	return e.Import + ": " + e.Message
+}
+
+// Register binds every import of rm that imports leaves unbound: function
+// imports to the script, the presets or the default behavior, in that
+// order, and globals, memories and tables to zeroed values of their minimum
+// size. It fails when a script entry does not match its import's type.
+func Register(rm *wasm.ResolvedModule, imports *interp.Imports, opts Options) error {
+	lookups := make([]lookup, len(opts.Presets))
+	for i, p := range opts.Presets {
+		lookups[i] = p.bind(rm)
+	}
+	for i := range rm.Imports {
+		imp := &rm.Imports[i]
+		switch imp.Kind {
+		case wasm.ImportFunc:
+			if int(imp.TypeIdx) >= len(rm.Types) {
+				continue
+			}
+			ft := &rm.Types[imp.TypeIdx]
+			fn := imports.Funcs[imp.Module][imp.Name]
+			if fn == nil {
+				var err error
+				if fn, err = synthesize(imp, ft, opts, lookups); err != nil {
+					return err
+				}
+			}
+			if opts.OnCall != nil {
+				fn = observe(imp.Module+"."+imp.Name, ft, fn, opts.OnCall)
+			}
+			imports.AddFunc(imp.Module, imp.Name, fn)
+		case wasm.ImportGlobal:
+			if imports.Globals[imp.Module][imp.Name] == nil && imp.Global != nil {
+				imports.AddGlobal(imp.Module, imp.Name, &interp.Global{Type: *imp.Global})
+			}
+		case wasm.ImportMemory:
+			if imports.Memories[imp.Module][imp.Name] == nil && imp.Memory != nil {
+				imports.AddMemory(imp.Module, imp.Name, interp.NewMemory(*imp.Memory))
+			}
+		case wasm.ImportTable:
+			if imports.Tables[imp.Module][imp.Name] == nil && imp.Table != nil {
+				imports.AddTable(imp.Module, imp.Name, interp.NewTable(*imp.Table))
+			}
+		}
+	}
+	return nil
+}
+
+func synthesize(imp *wasm.Import, ft *wasm.FuncType, opts Options, lookups []lookup) (interp.HostFunc, error) {
+	name := imp.Module + "." + imp.Name
+	if entry := opts.Script[name]; entry != nil {
+		return entry.hostFunc(name, ft)
+	}
+	for _, lookup := range lookups {
+		if fn := lookup(imp, ft); fn != nil {
+			return fn, nil
+		}
+	}
+	if opts.Default == TrapCall {
+		return interp.TrapUnresolved(imp), nil
+	}
+	return func(*interp.Instance, []uint64) ([]uint64, error) {
+		return make([]uint64, len(ft.Results)), nil
+	}, nil
+}
+
+func observe(name string, ft *wasm.FuncType, fn interp.HostFunc, onCall func(c *Call)) interp.HostFunc {
+	return func(inst *interp.Instance, args []uint64) ([]uint64, error) {
+		c := &Call{Import: name, Type: ft, Args: append([]uint64(nil), args...)}
+		results, err := fn(inst, args)
+		c.Results, c.Err = results, err
+		onCall(c)
+		return results, err
+	}
+}
+
+// results returns a result slice for ft with the leading values set.
+func results(ft *wasm.FuncType, values ...uint64) []uint64 {
+	out := make([]uint64, len(ft.Results))
+	copy(out, values)
+	return out
+}
+
+// arg returns argument i, or zero when the import declares fewer.
+func arg(args []uint64, i int) uint64 {
+	if i < len(args) {
+		return args[i]
+	}
+	return 0
+}
@@ -0,0 +1,169 @@
+package stubs
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/0xInception/wasmspy/internal/wasmtest"
+	"github.com/0xInception/wasmspy/pkg/interp"
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+func run(t *testing.T, rm *wasm.ResolvedModule, opts Options, export string) ([]uint64, error) {
+	t.Helper()
+	imports := interp.NewImports()
+	if err := Register(rm, imports, opts); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	inst, err := interp.Instantiate(rm, imports)
+	if err != nil {
+		t.Fatalf("instantiate: %v", err)
+	}
+	return inst.Call(export)
+}
+
+// counterModule imports env.next () -> i32 and env.log (i32), and exports
+// main, which returns next() + next() after logging 7.
+func counterModule(t *testing.T) *wasm.ResolvedModule {
+	return wasmtest.Module(t,
+		wasmtest.Section(0x01, 0x02, 0x60, 0x00, 0x01, 0x7f, 0x60, 0x01, 0x7f, 0x00),
+		wasmtest.Section(0x02, wasmtest.Cat([]byte{0x02},
+			wasmtest.Name("env"), wasmtest.Name("next"), []byte{0x00, 0x00},
+			wasmtest.Name("env"), wasmtest.Name("log"), []byte{0x00, 0x01})...),
+		wasmtest.Section(0x03, 0x01, 0x00),
+		wasmtest.Section(0x07, wasmtest.Cat([]byte{0x01}, wasmtest.Name("main"), []byte{0x00, 0x02})...),
+		wasmtest.Section(0x0a, 0x01, 0x0b, 0x00, 0x41, 0x07, 0x10, 0x01, 0x10, 0x00, 0x10, 0x00, 0x6a, 0x0b),
+	)
+}
+
+func TestScript(t *testing.T) {
+	rm := counterModule(t)
+	script, err := ParseScript([]byte("env.next:\n  sequence: [[1], [2]]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls []string
+	results, err := run(t, rm, Options{Script: script, OnCall: func(c *Call) { calls = append(calls, c.String()) }}, "main")
+	if err != nil || len(results) != 1 || results[0] != 3 {
+		t.Fatalf("main: %v, %v", results, err)
+	}
+	want := []string{"env.log(7)", "env.next() -> 1", "env.next() -> 2"}
+	if len(calls) != len(want) {
+		t.Fatalf("calls %v", calls)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Errorf("call %d: got %q, want %q", i, calls[i], want[i])
+		}
+	}
+
+	script, err = ParseScript([]byte(`{"env.next": {"trap": "boom"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = run(t, rm, Options{Script: script}, "main")
+	var abort *AbortError
+	if !errors.As(err, &abort) || abort.Message != "boom" {
+		t.Errorf("expected abort, got %v", err)
+	}
+
+	script, _ = ParseScript([]byte("env.next:\n  returns: [1, 2]\n"))
+	if err := Register(rm, interp.NewImports(), Options{Script: script}); err == nil {
+		t.Error("expected result count mismatch")
+	}
+}
+
+func TestDefaults(t *testing.T) {
+	rm := counterModule(t)
+	if results, err := run(t, rm, Options{}, "main"); err != nil || results[0] != 0 {
+		t.Errorf("zero stubs: %v, %v", results, err)
+	}
+	_, err := run(t, rm, Options{Default: TrapCall}, "main")
+	var trap *interp.Trap
+	if !errors.As(err, &trap) || trap.Code != interp.TrapUnresolvedImport {
+		t.Errorf("expected unresolved import trap, got %v", err)
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	rm := counterModule(t)
+	opts, err := ParseOptions(rm, "trap", []string{"emscripten", "auto"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Default != TrapCall || len(opts.Presets) != 1 || opts.Presets[0] != Emscripten {
+		t.Errorf("got default %v, presets %v", opts.Default, opts.Presets)
+	}
+	if _, err := ParseOptions(rm, "panic", nil); err == nil {
+		t.Error("unknown behavior accepted")
+	}
+	if _, err := ParseOptions(rm, "", []string{"go"}); err == nil {
+		t.Error("unknown preset accepted")
+	}
+}
+
+func TestEmscriptenInvoke(t *testing.T) {
+	// thrower calls __cxa_throw; main calls it through invoke_v and
+	// returns the flag setThrew stored.
+	rm := wasmtest.Module(t,
+		wasmtest.Section(0x01, 0x04,
+			0x60, 0x01, 0x7f, 0x00,
+			0x60, 0x00, 0x00,
+			0x60, 0x02, 0x7f, 0x7f, 0x00,
+			0x60, 0x00, 0x01, 0x7f),
+		wasmtest.Section(0x02, wasmtest.Cat([]byte{0x02},
+			wasmtest.Name("env"), wasmtest.Name("invoke_v"), []byte{0x00, 0x00},
+			wasmtest.Name("env"), wasmtest.Name("__cxa_throw"), []byte{0x00, 0x01})...),
+		wasmtest.Section(0x03, 0x03, 0x01, 0x02, 0x03),
+		wasmtest.Section(0x04, 0x01, 0x70, 0x00, 0x01),
+		wasmtest.Section(0x06, 0x01, 0x7f, 0x01, 0x41, 0x00, 0x0b),
+		wasmtest.Section(0x07, wasmtest.Cat([]byte{0x02},
+			wasmtest.Name("setThrew"), []byte{0x00, 0x03},
+			wasmtest.Name("main"), []byte{0x00, 0x04})...),
+		wasmtest.Section(0x09, 0x01, 0x00, 0x41, 0x00, 0x0b, 0x01, 0x02),
+		wasmtest.Section(0x0a, 0x03,
+			0x04, 0x00, 0x10, 0x01, 0x0b,
+			0x06, 0x00, 0x20, 0x00, 0x24, 0x00, 0x0b,
+			0x08, 0x00, 0x41, 0x00, 0x10, 0x00, 0x23, 0x00, 0x0b),
+	)
+	if found := DetectPresets(rm); len(found) != 1 || found[0] != Emscripten {
+		t.Errorf("detected %v", found)
+	}
+	results, err := run(t, rm, Options{Presets: []*Preset{Emscripten}}, "main")
+	if err != nil || results[0] != 1 {
+		t.Errorf("main: %v, %v", results, err)
+	}
+}
+
+func TestWasmBindgen(t *testing.T) {
+	rm := wasmtest.Module(t,
+		wasmtest.Section(0x01, 0x03,
+			0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7f,
+			0x60, 0x02, 0x7f, 0x7f, 0x00,
+			0x60, 0x00, 0x01, 0x7f),
+		wasmtest.Section(0x02, wasmtest.Cat([]byte{0x02},
+			wasmtest.Name("wbg"), wasmtest.Name("__wbindgen_string_new"), []byte{0x00, 0x00},
+			wasmtest.Name("wbg"), wasmtest.Name("__wbindgen_throw"), []byte{0x00, 0x01})...),
+		wasmtest.Section(0x03, 0x02, 0x02, 0x02),
+		wasmtest.Section(0x05, 0x01, 0x00, 0x01),
+		wasmtest.Section(0x07, wasmtest.Cat([]byte{0x02},
+			wasmtest.Name("str"), []byte{0x00, 0x02},
+			wasmtest.Name("fail"), []byte{0x00, 0x03})...),
+		wasmtest.Section(0x0a, 0x02,
+			0x08, 0x00, 0x41, 0x00, 0x41, 0x04, 0x10, 0x00, 0x0b,
+			0x0a, 0x00, 0x41, 0x00, 0x41, 0x04, 0x10, 0x01, 0x41, 0x00, 0x0b),
+		wasmtest.Section(0x0b, 0x01, 0x00, 0x41, 0x00, 0x0b, 0x04, 'o', 'o', 'p', 's'),
+	)
+	presets := DetectPresets(rm)
+	if len(presets) != 1 || presets[0] != WasmBindgen {
+		t.Fatalf("detected %v", presets)
+	}
+	if results, err := run(t, rm, Options{Presets: presets}, "str"); err != nil || results[0] != heapReserved+4 {
+		t.Errorf("string_new: %v, %v", results, err)
+	}
+	_, err := run(t, rm, Options{Presets: presets}, "fail")
+	var abort *AbortError
+	if !errors.As(err, &abort) || abort.Message != "oops" {
+		t.Errorf("expected abort with message, got %v", err)
+	}
+}
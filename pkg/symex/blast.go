@@ -0,0 +1,394 @@
+package symex
+
+// blaster translates terms into clauses over their bits (Tseitin encoding).
+// Bit vectors are least significant bit first.
+type blaster struct {
+	s     *sat
+	t     lit // a literal fixed to true
+	vars  map[string][]lit
+	memo  map[*Term][]lit
+	gates map[[3]lit]lit
+}
+
+func newBlaster() *blaster {
+	b := &blaster{
+		s:     newSat(),
+		vars:  make(map[string][]lit),
+		memo:  make(map[*Term][]lit),
+		gates: make(map[[3]lit]lit),
+	}
+	b.t = mkLit(b.s.newVar(), false)
+	b.s.addClause(b.t)
+	return b
+}
+
+func (b *blaster) f() lit { return b.t.not() }
+
+func (b *blaster) fresh() lit {
+	return mkLit(b.s.newVar(), false)
+}
+
+func (b *blaster) and(x, y lit) lit {
+	switch {
+	case x == b.f() || y == b.f() || x == y.not():
+		return b.f()
+	case x == b.t || x == y:
+		return y
+	case y == b.t:
+		return x
+	}
+	if x > y {
+		x, y = y, x
+	}
+	key := [3]lit{0, x, y}
+	if o, ok := b.gates[key]; ok {
+		return o
+	}
+	o := b.fresh()
+	b.s.addClause(o.not(), x)
+	b.s.addClause(o.not(), y)
+	b.s.addClause(o, x.not(), y.not())
+	b.gates[key] = o
+	return o
+}
+
+func (b *blaster) or(x, y lit) lit {
+	return b.and(x.not(), y.not()).not()
+}
+
+func (b *blaster) xor(x, y lit) lit {
+	switch {
+	case x == b.f():
+		return y
+	case y == b.f():
+		return x
+	case x == b.t:
+		return y.not()
+	case y == b.t:
+		return x.not()
+	case x == y:
+		return b.f()
+	case x == y.not():
+		return b.t
+	}
+	if x > y {
+		x, y = y, x
+	}
+	key := [3]lit{1, x, y}
+	if o, ok := b.gates[key]; ok {
+		return o
+	}
+	o := b.fresh()
+	b.s.addClause(o.not(), x, y)
+	b.s.addClause(o.not(), x.not(), y.not())
+	b.s.addClause(o, x.not(), y)
+	b.s.addClause(o, x, y.not())
+	b.gates[key] = o
+	return o
+}
+
+// mux is sel ? x : y.
+func (b *blaster) mux(sel, x, y lit) lit {
+	switch {
+	case sel == b.t || x == y:
+		return x
+	case sel == b.f():
+		return y
+	}
+	o := b.fresh()
+	b.s.addClause(sel.not(), x.not(), o)
+	b.s.addClause(sel.not(), x, o.not())
+	b.s.addClause(sel, y.not(), o)
+	b.s.addClause(sel, y, o.not())
+	return o
+}
+
+func (b *blaster) constBits(width uint8, v uint64) []lit {
+	out := make([]lit, width)
+	for i := range out {
+		if v>>uint(i)&1 != 0 {
+			out[i] = b.t
+		} else {
+			out[i] = b.f()
+		}
+	}
+	return out
+}
+
+// add returns x + y + carry truncated to the width of x, and the carry out.
+func (b *blaster) add(x, y []lit, carry lit) ([]lit, lit) {
+	out := make([]lit, len(x))
+	for i := range x {
+		p := b.xor(x[i], y[i])
+		out[i] = b.xor(p, carry)
+		carry = b.or(b.and(x[i], y[i]), b.and(p, carry))
+	}
+	return out, carry
+}
+
+func (b *blaster) not(x []lit) []lit {
+	out := make([]lit, len(x))
+	for i, l := range x {
+		out[i] = l.not()
+	}
+	return out
+}
+
+func (b *blaster) sub(x, y []lit) ([]lit, lit) {
+	return b.add(x, b.not(y), b.t)
+}
+
+func (b *blaster) neg(x []lit) []lit {
+	out, _ := b.sub(b.constBits(uint8(len(x)), 0), x)
+	return out
+}
+
+func (b *blaster) muxBits(sel lit, x, y []lit) []lit {
+	out := make([]lit, len(x))
+	for i := range x {
+		out[i] = b.mux(sel, x[i], y[i])
+	}
+	return out
+}
+
+func (b *blaster) mul(x, y []lit) []lit {
+	w := len(x)
+	acc := b.constBits(uint8(w), 0)
+	for i := 0; i < w; i++ {
+		if y[i] == b.f() {
+			continue
+		}
+		partial := make([]lit, w)
+		for j := range partial {
+			if j < i {
+				partial[j] = b.f()
+			} else {
+				partial[j] = b.and(x[j-i], y[i])
+			}
+		}
+		acc, _ = b.add(acc, partial, b.f())
+	}
+	return acc
+}
+
+// ult is x < y unsigned: the subtraction x - y borrows.
+func (b *blaster) ult(x, y []lit) lit {
+	_, carry := b.sub(x, y)
+	return carry.not()
+}
+
+func (b *blaster) slt(x, y []lit) lit {
+	w := len(x)
+	xs := append(append([]lit(nil), x[:w-1]...), x[w-1].not())
+	ys := append(append([]lit(nil), y[:w-1]...), y[w-1].not())
+	return b.ult(xs, ys)
+}
+
+func (b *blaster) eq(x, y []lit) lit {
+	o := b.t
+	for i := range x {
+		o = b.and(o, b.xor(x[i], y[i]).not())
+	}
+	return o
+}
+
+func (b *blaster) isZero(x []lit) lit {
+	return b.eq(x, b.constBits(uint8(len(x)), 0))
+}
+
+// shift implements the barrel shifter for every shift and rotate kind; the
+// amount is taken modulo the width.
+func (b *blaster) shift(kind Kind, x, amount []lit) []lit {
+	w := len(x)
+	fill := b.f()
+	if kind == KindAShr {
+		fill = x[w-1]
+	}
+	cur := x
+	for k := 0; 1<<k < w; k++ {
+		d := 1 << k
+		moved := make([]lit, w)
+		for i := range moved {
+			switch kind {
+			case KindShl:
+				if i >= d {
+					moved[i] = cur[i-d]
+				} else {
+					moved[i] = b.f()
+				}
+			case KindLShr, KindAShr:
+				if i+d < w {
+					moved[i] = cur[i+d]
+				} else {
+					moved[i] = fill
+				}
+			case KindRotl:
+				moved[i] = cur[(i-d+w)%w]
+			case KindRotr:
+				moved[i] = cur[(i+d)%w]
+			}
+		}
+		cur = b.muxBits(amount[k], moved, cur)
+	}
+	return cur
+}
+
+// udiv is restoring division. A zero divisor yields zero for both results,
+// matching Eval.
+func (b *blaster) udiv(x, y []lit) (q, r []lit) {
+	w := len(x)
+	q = make([]lit, w)
+	rem := b.constBits(uint8(w+1), 0)
+	wide := append(append([]lit(nil), y...), b.f())
+	for i := w - 1; i >= 0; i-- {
+		rem = append([]lit{x[i]}, rem[:w]...)
+		diff, carry := b.sub(rem, wide)
+		q[i] = carry
+		rem = b.muxBits(carry, diff, rem)
+	}
+	zero := b.isZero(y)
+	q = b.muxBits(zero, b.constBits(uint8(w), 0), q)
+	r = b.muxBits(zero, b.constBits(uint8(w), 0), rem[:w])
+	return q, r
+}
+
+func (b *blaster) sdiv(x, y []lit) (q, r []lit) {
+	w := len(x)
+	sx, sy := x[w-1], y[w-1]
+	ax := b.muxBits(sx, b.neg(x), x)
+	ay := b.muxBits(sy, b.neg(y), y)
+	uq, ur := b.udiv(ax, ay)
+	q = b.muxBits(b.xor(sx, sy), b.neg(uq), uq)
+	r = b.muxBits(sx, b.neg(ur), ur)
+	return q, r
+}
+
+func (b *blaster) count(kind Kind, x []lit) []lit {
+	w := len(x)
+	out := b.constBits(uint8(w), 0)
+	switch kind {
+	case KindPopcnt:
+		for _, l := range x {
+			inc := make([]lit, w)
+			for i := range inc {
+				inc[i] = b.f()
+			}
+			inc[0] = l
+			out, _ = b.add(out, inc, b.f())
+		}
+	case KindClz, KindCtz:
+		// Scan from the far end: the count is the position of the
+		// nearest set bit, or the width when none is set.
+		out = b.constBits(uint8(w), uint64(w))
+		for i := 0; i < w; i++ {
+			bit, n := x[i], i
+			if kind == KindClz {
+				n = w - 1 - i
+			} else {
+				bit = x[w-1-i]
+				n = w - 1 - i
+			}
+			out = b.muxBits(bit, b.constBits(uint8(w), uint64(n)), out)
+		}
+	}
+	return out
+}
+
+func (b *blaster) bits(t *Term) []lit {
+	if out, ok := b.memo[t]; ok {
+		return out
+	}
+	var out []lit
+	switch t.Kind {
+	case KindConst:
+		out = b.constBits(t.Width, t.Val)
+	case KindVar:
+		out = b.vars[t.Name]
+		if out == nil {
+			out = make([]lit, t.Width)
+			for i := range out {
+				out[i] = b.fresh()
+			}
+			b.vars[t.Name] = out
+		}
+	case KindNot:
+		out = b.not(b.bits(t.Args[0]))
+	case KindIte:
+		out = b.muxBits(b.bits(t.Args[0])[0], b.bits(t.Args[1]), b.bits(t.Args[2]))
+	case KindZext, KindSext:
+		in := b.bits(t.Args[0])
+		fill := b.f()
+		if t.Kind == KindSext {
+			fill = in[len(in)-1]
+		}
+		out = append([]lit(nil), in...)
+		for len(out) < int(t.Width) {
+			out = append(out, fill)
+		}
+	case KindExtract:
+		out = b.bits(t.Args[0])[t.Lo : t.Lo+t.Width]
+	case KindConcat:
+		out = append(append([]lit(nil), b.bits(t.Args[1])...), b.bits(t.Args[0])...)
+	case KindClz, KindCtz, KindPopcnt:
+		out = b.count(t.Kind, b.bits(t.Args[0]))
+	default:
+		x, y := b.bits(t.Args[0]), b.bits(t.Args[1])
+		switch t.Kind {
+		case KindAdd:
+			out, _ = b.add(x, y, b.f())
+		case KindSub:
+			out, _ = b.sub(x, y)
+		case KindMul:
+			out = b.mul(x, y)
+		case KindUDiv:
+			out, _ = b.udiv(x, y)
+		case KindURem:
+			_, out = b.udiv(x, y)
+		case KindSDiv:
+			out, _ = b.sdiv(x, y)
+		case KindSRem:
+			_, out = b.sdiv(x, y)
+		case KindAnd, KindOr, KindXor:
+			out = make([]lit, len(x))
+			for i := range x {
+				switch t.Kind {
+				case KindAnd:
+					out[i] = b.and(x[i], y[i])
+				case KindOr:
+					out[i] = b.or(x[i], y[i])
+				default:
+					out[i] = b.xor(x[i], y[i])
+				}
+			}
+		case KindShl, KindLShr, KindAShr, KindRotl, KindRotr:
+			out = b.shift(t.Kind, x, y)
+		case KindEq:
+			out = []lit{b.eq(x, y)}
+		case KindUlt:
+			out = []lit{b.ult(x, y)}
+		case KindSlt:
+			out = []lit{b.slt(x, y)}
+		}
+	}
+	b.memo[t] = out
+	return out
+}
+
+// assert requires a width-1 term to be true.
+func (b *blaster) assert(t *Term) {
+	b.s.addClause(b.bits(t)[0])
+}
+
+func (b *blaster) model() map[string]uint64 {
+	m := make(map[string]uint64, len(b.vars))
+	for name, bits := range b.vars {
+		var v uint64
+		for i, l := range bits {
+			if b.s.value(l) == 1 {
+				v |= 1 << uint(i)
+			}
+		}
+		m[name] = v
+	}
+	return m
+}
@@ -0,0 +1,942 @@
+package symex
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/0xInception/wasmspy/pkg/interp"
+	"github.com/0xInception/wasmspy/pkg/stubs"
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+const (
+	DefaultMaxSteps     = 1_000_000
+	DefaultMaxPaths     = 10_000
+	DefaultLoopBound    = 32
+	DefaultMaxCallDepth = 8
+)
+
+// Region marks Size bytes of memory 0 at Addr as symbolic input; byte i is
+// the variable "Name[i]".
+type Region struct {
+	Name string
+	Addr uint32
+	Size uint32
+}
+
+type Options struct {
+	// Fixed gives concrete values to parameters by index; the others are
+	// the symbolic variables "p0", "p1", ...
+	Fixed    map[int]uint64
+	Symbolic []Region
+	// MaxSteps bounds the instructions executed over all paths and
+	// MaxPaths the number of paths.
+	MaxSteps int
+	MaxPaths int
+	// LoopBound is how often one path may branch back to a loop before it
+	// is abandoned.
+	LoopBound int
+	// MaxCallDepth bounds inlining of calls; deeper calls return
+	// unconstrained results.
+	MaxCallDepth int
+	// MaxConflicts is the solver budget per query.
+	MaxConflicts int
+}
+
+// Result is the outcome of Reach. When Reached is set, Params and Memory
+// hold inputs that drive execution to the target along the path described
+// by Condition.
+type Result struct {
+	Reached bool
+	Params  []uint64
+	// Memory holds the solved contents of each symbolic region by name.
+	Memory    map[string][]byte
+	Condition string
+	Paths     int
+	Steps     int
+	// Incomplete reports that some behavior was approximated or some paths
+	// abandoned, so failing to reach the target is not a proof that it is
+	// unreachable, and a solution may not reproduce.
+	Incomplete bool
+	// Verified reports that running the function concretely on the
+	// solution, with zero-returning import stubs, reached the target.
+	Verified bool
+}
+
+// body is a function body with its control structure resolved as in the
+// interpreter: match maps every block, loop, if and else to its end, and
+// elseAt maps an if to its else (or -1).
+type body struct {
+	fn     *wasm.ResolvedFunction
+	instrs []wasm.Instruction
+	match  []int
+	elseAt []int
+	locals []wasm.ValType
+}
+
+func compile(fn *wasm.ResolvedFunction) (*body, error) {
+	b := &body{
+		fn:     fn,
+		instrs: fn.Body.Instructions,
+		match:  make([]int, len(fn.Body.Instructions)),
+		elseAt: make([]int, len(fn.Body.Instructions)),
+	}
+	for _, l := range fn.Body.Locals {
+		for i := uint32(0); i < l.Count; i++ {
+			b.locals = append(b.locals, wasm.ValType(l.Type))
+		}
+	}
+	var open []int
+	for i := range b.instrs {
+		b.elseAt[i] = -1
+		switch b.instrs[i].Opcode {
+		case wasm.OpBlock, wasm.OpLoop, wasm.OpIf:
+			open = append(open, i)
+		case wasm.OpElse:
+			if len(open) == 0 || b.instrs[open[len(open)-1]].Opcode != wasm.OpIf {
+				return nil, fmt.Errorf("function %d: else without if at offset 0x%x", fn.Index, b.instrs[i].Offset)
+			}
+			b.elseAt[open[len(open)-1]] = i
+			open = append(open, i)
+		case wasm.OpEnd:
+			if len(open) == 0 {
+				b.match[i] = -1
+				continue
+			}
+			start := open[len(open)-1]
+			open = open[:len(open)-1]
+			b.match[start] = i
+			if b.instrs[start].Opcode == wasm.OpElse {
+				ifStart := open[len(open)-1]
+				open = open[:len(open)-1]
+				b.match[ifStart] = i
+			}
+		}
+	}
+	if len(open) != 0 {
+		return nil, fmt.Errorf("function %d: unterminated block", fn.Index)
+	}
+	return b, nil
+}
+
+type label struct {
+	arity  int
+	height int
+	// cont is where a branch to the label continues: past the end of a
+	// block, at the start of a loop body, or -1 to return.
+	cont int
+	loop bool
+	// at is the loop instruction, whose iterations are bounded.
+	at int
+}
+
+type frame struct {
+	body   *body
+	pc     int
+	locals []*Term
+	labels []label
+	base   int
+}
+
+type iterKey struct {
+	depth, pc int
+}
+
+// state is one path: its frames and operand stack, the memory bytes and
+// globals it has written, and the conditions it has taken.
+type state struct {
+	frames  []*frame
+	stack   []*Term
+	mem     map[uint32]*Term
+	globals map[uint32]*Term
+	path    []*Term
+	iters   map[iterKey]int
+}
+
+func (s *state) clone() *state {
+	c := &state{
+		frames:  make([]*frame, len(s.frames)),
+		stack:   append([]*Term(nil), s.stack...),
+		mem:     make(map[uint32]*Term, len(s.mem)),
+		globals: make(map[uint32]*Term, len(s.globals)),
+		path:    append([]*Term(nil), s.path...),
+		iters:   make(map[iterKey]int, len(s.iters)),
+	}
+	for i, f := range s.frames {
+		nf := *f
+		nf.locals = append([]*Term(nil), f.locals...)
+		nf.labels = append([]label(nil), f.labels...)
+		c.frames[i] = &nf
+	}
+	for k, v := range s.mem {
+		c.mem[k] = v
+	}
+	for k, v := range s.globals {
+		c.globals[k] = v
+	}
+	for k, v := range s.iters {
+		c.iters[k] = v
+	}
+	return c
+}
+
+func (s *state) push(t *Term) { s.stack = append(s.stack, t) }
+
+func (s *state) pop() *Term {
+	t := s.stack[len(s.stack)-1]
+	s.stack = s.stack[:len(s.stack)-1]
+	return t
+}
+
+func (s *state) top() *frame { return s.frames[len(s.frames)-1] }
+
+type executor struct {
+	rm      *wasm.ResolvedModule
+	opts    Options
+	target  uint64
+	image   []byte
+	memSize uint64
+	bodies  map[uint32]*body
+	res     *Result
+	fresh   int
+}
+
+func widthOf(t wasm.ValType) uint8 {
+	if t == wasm.ValI32 || t == wasm.ValF32 {
+		return 32
+	}
+	return 64
+}
+
+// Reach searches the paths of function funcIdx for one that executes the
+// instruction at offset target, which may lie in a callee. Paths are
+// explored depth first; the first feasible one is solved and verified.
+func Reach(rm *wasm.ResolvedModule, funcIdx uint32, target uint64, opts Options) (*Result, error) {
+	fn := rm.GetFunction(funcIdx)
+	if fn == nil || fn.Type == nil {
+		return nil, fmt.Errorf("function %d not found", funcIdx)
+	}
+	if fn.Imported || fn.Body == nil {
+		return nil, fmt.Errorf("function %d is imported", funcIdx)
+	}
+	if !hasInstruction(rm, target) {
+		return nil, fmt.Errorf("no instruction at offset 0x%x", target)
+	}
+	if opts.MaxSteps <= 0 {
+		opts.MaxSteps = DefaultMaxSteps
+	}
+	if opts.MaxPaths <= 0 {
+		opts.MaxPaths = DefaultMaxPaths
+	}
+	if opts.LoopBound <= 0 {
+		opts.LoopBound = DefaultLoopBound
+	}
+	if opts.MaxCallDepth <= 0 {
+		opts.MaxCallDepth = DefaultMaxCallDepth
+	}
+
+	e := &executor{
+		rm:      rm,
+		opts:    opts,
+		target:  target,
+		image:   rm.MemoryImage().Data,
+		memSize: max(memorySize(rm), uint64(len(rm.MemoryImage().Data))),
+		bodies:  make(map[uint32]*body),
+		res:     &Result{Memory: make(map[string][]byte)},
+	}
+	b, err := e.body(funcIdx)
+	if err != nil {
+		return nil, err
+	}
+
+	init := &state{
+		mem:     make(map[uint32]*Term),
+		globals: make(map[uint32]*Term),
+		iters:   make(map[iterKey]int),
+	}
+	for _, r := range opts.Symbolic {
+		if uint64(r.Addr)+uint64(r.Size) > e.memSize {
+			return nil, fmt.Errorf("region %s at 0x%x+%d exceeds memory size %d", r.Name, r.Addr, r.Size, e.memSize)
+		}
+		for i := uint32(0); i < r.Size; i++ {
+			init.mem[r.Addr+i] = Var(fmt.Sprintf("%s[%d]", r.Name, i), 8)
+		}
+	}
+	args := make([]*Term, len(fn.Type.Params))
+	for i, t := range fn.Type.Params {
+		if v, ok := opts.Fixed[i]; ok {
+			args[i] = Const(widthOf(t), v)
+		} else {
+			args[i] = Var(fmt.Sprintf("p%d", i), widthOf(t))
+		}
+	}
+	e.call(init, b, args)
+
+	work := []*state{init}
+	for len(work) > 0 {
+		if e.res.Paths >= opts.MaxPaths || e.res.Steps >= opts.MaxSteps {
+			e.res.Incomplete = true
+			break
+		}
+		st := work[len(work)-1]
+		work = work[:len(work)-1]
+		succ, reached := e.run(st)
+		if reached {
+			e.res.Paths++
+			status, model := Solve(st.path, opts.MaxConflicts)
+			switch status {
+			case Sat:
+				e.solution(st, fn, model)
+				e.res.Verified = verify(rm, funcIdx, target, opts.Symbolic, e.res)
+				return e.res, nil
+			case Unknown:
+				e.res.Incomplete = true
+			}
+			continue
+		}
+		if len(succ) == 0 {
+			e.res.Paths++
+		}
+		for i := len(succ) - 1; i >= 0; i-- {
+			work = append(work, succ[i])
+		}
+	}
+	return e.res, nil
+}
+
+func hasInstruction(rm *wasm.ResolvedModule, offset uint64) bool {
+	for i := range rm.Functions {
+		fn := &rm.Functions[i]
+		if fn.Body == nil {
+			continue
+		}
+		for j := range fn.Body.Instructions {
+			if fn.Body.Instructions[j].Offset == offset {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// memorySize is the initial size in bytes of memory 0.
+func memorySize(rm *wasm.ResolvedModule) uint64 {
+	for i := range rm.Imports {
+		if imp := &rm.Imports[i]; imp.Kind == wasm.ImportMemory && imp.Memory != nil {
+			return uint64(imp.Memory.Min) * interp.PageSize
+		}
+	}
+	if len(rm.Memories) > 0 {
+		return uint64(rm.Memories[0].Min) * interp.PageSize
+	}
+	return 0
+}
+
+func (e *executor) body(idx uint32) (*body, error) {
+	if b := e.bodies[idx]; b != nil {
+		return b, nil
+	}
+	fn := e.rm.GetFunction(idx)
+	if fn == nil || fn.Type == nil || fn.Body == nil {
+		return nil, fmt.Errorf("function %d has no body", idx)
+	}
+	b, err := compile(fn)
+	if err != nil {
+		return nil, err
+	}
+	e.bodies[idx] = b
+	return b, nil
+}
+
+func (e *executor) solution(st *state, fn *wasm.ResolvedFunction, model map[string]uint64) {
+	e.res.Reached = true
+	for i, t := range fn.Type.Params {
+		v, ok := e.opts.Fixed[i]
+		if !ok {
+			v = model[fmt.Sprintf("p%d", i)]
+		}
+		e.res.Params = append(e.res.Params, v&mask(widthOf(t)))
+	}
+	for _, r := range e.opts.Symbolic {
+		data := make([]byte, r.Size)
+		for i := range data {
+			data[i] = byte(model[fmt.Sprintf("%s[%d]", r.Name, i)])
+		}
+		e.res.Memory[r.Name] = data
+	}
+	conds := make([]string, 0, len(st.path))
+	for _, c := range st.path {
+		conds = append(conds, c.String())
+	}
+	e.res.Condition = strings.Join(conds, " && ")
+}
+
+// havoc returns a fresh unconstrained value for a result the executor does
+// not model.
+func (e *executor) havoc(width uint8) *Term {
+	e.fresh++
+	return Var(fmt.Sprintf("$%d", e.fresh), width)
+}
+
+// assume adds c to the path and reports whether the path can still be
+// feasible; only constant conditions are decided here.
+func assume(st *state, c *Term) bool {
+	if c.IsConst() {
+		return c.Val != 0
+	}
+	st.path = append(st.path, c)
+	return true
+}
+
+// feasible reports whether the path of st extended by c has a solution.
+func (e *executor) feasible(st *state, c *Term) bool {
+	if c.IsConst() {
+		return c.Val != 0
+	}
+	status, _ := Solve(append(st.path[:len(st.path):len(st.path)], c), e.opts.MaxConflicts)
+	if status == Unknown {
+		e.res.Incomplete = true
+	}
+	return status == Sat
+}
+
+type branch struct {
+	cond  *Term
+	apply func(*state) bool
+}
+
+// fork returns the successors of st along each feasible branch. A branch
+// whose apply reports false ends its path.
+func (e *executor) fork(st *state, branches []branch) []*state {
+	var live []branch
+	for _, br := range branches {
+		if e.feasible(st, br.cond) {
+			live = append(live, br)
+		}
+	}
+	var succ []*state
+	for i, br := range live {
+		s := st
+		if i < len(live)-1 {
+			s = st.clone()
+		}
+		assume(s, br.cond)
+		if br.apply(s) {
+			succ = append(succ, s)
+		} else {
+			e.res.Paths++
+		}
+	}
+	return succ
+}
+
+func nonzero(t *Term) *Term {
+	return Not(Binary(KindEq, t, Const(t.Width, 0)))
+}
+
+func (e *executor) call(st *state, b *body, args []*Term) {
+	f := &frame{body: b, base: len(st.stack)}
+	f.locals = append(f.locals, args...)
+	for _, t := range b.locals {
+		if t == wasm.ValFuncRef || t == wasm.ValExternRef {
+			f.locals = append(f.locals, Const(64, wasm.NullRef))
+		} else {
+			f.locals = append(f.locals, Const(widthOf(t), 0))
+		}
+	}
+	f.labels = []label{{arity: len(b.fn.Type.Results), height: f.base, cont: -1}}
+	st.frames = append(st.frames, f)
+}
+
+// ret returns from the innermost frame and reports whether the path goes
+// on.
+func (e *executor) ret(st *state) bool {
+	f := st.top()
+	n := len(f.body.fn.Type.Results)
+	st.stack = append(st.stack[:f.base], st.stack[len(st.stack)-n:]...)
+	st.frames = st.frames[:len(st.frames)-1]
+	return len(st.frames) > 0
+}
+
+// branch takes the label depth levels out and reports whether the path goes
+// on.
+func (e *executor) branch(st *state, depth uint32) bool {
+	f := st.top()
+	idx := len(f.labels) - 1 - int(depth)
+	l := f.labels[idx]
+	st.stack = append(st.stack[:l.height], st.stack[len(st.stack)-l.arity:]...)
+	if l.cont < 0 {
+		return e.ret(st)
+	}
+	if l.loop {
+		k := iterKey{len(st.frames), l.at}
+		st.iters[k]++
+		if st.iters[k] > e.opts.LoopBound {
+			e.res.Incomplete = true
+			return false
+		}
+		f.labels = f.labels[:idx+1]
+	} else {
+		f.labels = f.labels[:idx]
+	}
+	f.pc = l.cont
+	return true
+}
+
+func arity(bt wasm.BlockType) int {
+	if bt == wasm.BlockEmpty {
+		return 0
+	}
+	return 1
+}
+
+// run executes st until it forks, ends or arrives at the target. The path
+// ends without successors on return, traps, unsupported instructions and
+// exhausted bounds.
+func (e *executor) run(st *state) (succ []*state, reached bool) {
+	for {
+		if e.res.Steps >= e.opts.MaxSteps {
+			e.res.Incomplete = true
+			return nil, false
+		}
+		f := st.top()
+		pc := f.pc
+		ins := &f.body.instrs[pc]
+		if ins.Offset == e.target {
+			return nil, true
+		}
+		e.res.Steps++
+
+		switch op := ins.Opcode; op {
+		case wasm.OpUnreachable:
+			return nil, false
+		case wasm.OpNop:
+			f.pc++
+
+		case wasm.OpBlock:
+			f.labels = append(f.labels, label{arity: arity(ins.BlockType()), height: len(st.stack), cont: f.body.match[pc] + 1})
+			f.pc++
+		case wasm.OpLoop:
+			f.labels = append(f.labels, label{height: len(st.stack), cont: pc + 1, loop: true, at: pc})
+			st.iters[iterKey{len(st.frames), pc}] = 0
+			f.pc++
+		case wasm.OpIf:
+			cond := nonzero(st.pop())
+			l := label{arity: arity(ins.BlockType()), height: len(st.stack), cont: f.body.match[pc] + 1}
+			elseAt := f.body.elseAt[pc]
+			then := func(s *state) bool {
+				g := s.top()
+				g.labels = append(g.labels, l)
+				g.pc = pc + 1
+				return true
+			}
+			otherwise := func(s *state) bool {
+				g := s.top()
+				if elseAt >= 0 {
+					g.labels = append(g.labels, l)
+					g.pc = elseAt + 1
+				} else {
+					g.pc = l.cont
+				}
+				return true
+			}
+			if succ := e.fork(st, []branch{{cond, then}, {Not(cond), otherwise}}); len(succ) != 1 || succ[0] != st {
+				return succ, false
+			}
+		case wasm.OpElse:
+			e.branch(st, 0)
+		case wasm.OpEnd:
+			if f.body.match[pc] < 0 {
+				if !e.ret(st) {
+					return nil, false
+				}
+				continue
+			}
+			f.labels = f.labels[:len(f.labels)-1]
+			f.pc++
+
+		case wasm.OpBr:
+			if !e.branch(st, ins.Index()) {
+				return nil, false
+			}
+		case wasm.OpBrIf:
+			cond := nonzero(st.pop())
+			depth := ins.Index()
+			taken := func(s *state) bool { return e.branch(s, depth) }
+			fall := func(s *state) bool { s.top().pc = pc + 1; return true }
+			if succ := e.fork(st, []branch{{cond, taken}, {Not(cond), fall}}); len(succ) != 1 || succ[0] != st {
+				return succ, false
+			}
+		case wasm.OpBrTable:
+			idx := st.pop()
+			labels := ins.Labels()
+			n := len(labels) - 1
+			if idx.IsConst() {
+				d := labels[n]
+				if idx.Val < uint64(n) {
+					d = labels[idx.Val]
+				}
+				if !e.branch(st, d) {
+					return nil, false
+				}
+				continue
+			}
+			conds := make(map[uint32]*Term)
+			var order []uint32
+			add := func(d uint32, c *Term) {
+				if conds[d] == nil {
+					order = append(order, d)
+					conds[d] = c
+				} else {
+					conds[d] = Or(conds[d], c)
+				}
+			}
+			for i, d := range labels[:n] {
+				add(d, Binary(KindEq, idx, Const(32, uint64(i))))
+			}
+			add(labels[n], Not(Binary(KindUlt, idx, Const(32, uint64(n)))))
+			branches := make([]branch, len(order))
+			for i, d := range order {
+				d := d
+				branches[i] = branch{conds[d], func(s *state) bool { return e.branch(s, d) }}
+			}
+			return e.fork(st, branches), false
+		case wasm.OpReturn:
+			if !e.ret(st) {
+				return nil, false
+			}
+
+		case wasm.OpCall:
+			callee := e.rm.GetFunction(ins.Index())
+			if callee == nil || callee.Type == nil {
+				return nil, false
+			}
+			args := make([]*Term, len(callee.Type.Params))
+			for i := len(args) - 1; i >= 0; i-- {
+				args[i] = st.pop()
+			}
+			f.pc++
+			if !callee.Imported && len(st.frames) <= e.opts.MaxCallDepth {
+				b, err := e.body(callee.Index)
+				if err != nil {
+					e.res.Incomplete = true
+					return nil, false
+				}
+				e.call(st, b, args)
+				continue
+			}
+			e.res.Incomplete = true
+			for _, t := range callee.Type.Results {
+				st.push(e.havoc(widthOf(t)))
+			}
+		case wasm.OpCallIndirect:
+			if int(ins.Index()) >= len(e.rm.Types) {
+				return nil, false
+			}
+			ft := &e.rm.Types[ins.Index()]
+			st.pop()
+			st.stack = st.stack[:len(st.stack)-len(ft.Params)]
+			e.res.Incomplete = true
+			for _, t := range ft.Results {
+				st.push(e.havoc(widthOf(t)))
+			}
+			f.pc++
+
+		case wasm.OpDrop:
+			st.pop()
+			f.pc++
+		case wasm.OpSelect, wasm.OpSelectTyped:
+			cond := nonzero(st.pop())
+			b := st.pop()
+			a := st.pop()
+			st.push(Ite(cond, a, b))
+			f.pc++
+
+		case wasm.OpLocalGet:
+			st.push(f.locals[ins.Index()])
+			f.pc++
+		case wasm.OpLocalSet:
+			f.locals[ins.Index()] = st.pop()
+			f.pc++
+		case wasm.OpLocalTee:
+			f.locals[ins.Index()] = st.stack[len(st.stack)-1]
+			f.pc++
+		case wasm.OpGlobalGet:
+			st.push(e.global(st, ins.Index()))
+			f.pc++
+		case wasm.OpGlobalSet:
+			st.globals[ins.Index()] = st.pop()
+			f.pc++
+
+		case wasm.OpI32Const:
+			st.push(Const(32, ins.Imm.Bits))
+			f.pc++
+		case wasm.OpF32Const:
+			st.push(Const(32, ins.Imm.Bits))
+			f.pc++
+		case wasm.OpI64Const, wasm.OpF64Const:
+			st.push(Const(64, ins.Imm.Bits))
+			f.pc++
+
+		case wasm.OpMemorySize:
+			st.push(Const(32, e.memSize/interp.PageSize))
+			f.pc++
+		case wasm.OpMemoryGrow:
+			st.pop()
+			e.res.Incomplete = true
+			st.push(e.havoc(32))
+			f.pc++
+		case wasm.OpMemoryFill, wasm.OpMemoryCopy:
+			if !e.bulk(st, op) {
+				return nil, false
+			}
+			f.pc++
+
+		case wasm.OpRefNull:
+			st.push(Const(64, wasm.NullRef))
+			f.pc++
+		case wasm.OpRefIsNull:
+			st.push(Zext(Binary(KindEq, st.pop(), Const(64, wasm.NullRef)), 32))
+			f.pc++
+		case wasm.OpRefFunc:
+			st.push(Const(64, uint64(ins.Index())))
+			f.pc++
+
+		default:
+			if ld, ok := loads[op]; ok {
+				addr, ok := e.address(st, st.pop(), ins.MemArg().Offset, ld.size)
+				if !ok {
+					return nil, false
+				}
+				v := e.load(st, addr, ld.size)
+				if ld.signed {
+					v = Sext(v, ld.width)
+				} else {
+					v = Zext(v, ld.width)
+				}
+				st.push(v)
+				f.pc++
+				continue
+			}
+			if size, ok := stores[op]; ok {
+				v := st.pop()
+				addr, ok := e.address(st, st.pop(), ins.MemArg().Offset, size)
+				if !ok {
+					return nil, false
+				}
+				for i := uint32(0); i < size; i++ {
+					st.mem[addr+i] = Extract(v, uint8(8*i), 8)
+				}
+				f.pc++
+				continue
+			}
+			if bo, ok := binOps[op]; ok {
+				if !e.binary(st, bo) {
+					return nil, false
+				}
+				f.pc++
+				continue
+			}
+			if un, ok := unOps[op]; ok {
+				st.push(un(st.pop()))
+				f.pc++
+				continue
+			}
+			if pops, width, ok := floatOp(op); ok {
+				st.stack = st.stack[:len(st.stack)-pops]
+				e.res.Incomplete = true
+				st.push(Zext(e.havoc(width), max(width, 32)))
+				f.pc++
+				continue
+			}
+			// Tables, passive segments and SIMD are not modelled.
+			e.res.Incomplete = true
+			return nil, false
+		}
+	}
+}
+
+func (e *executor) global(st *state, idx uint32) *Term {
+	if t := st.globals[idx]; t != nil {
+		return t
+	}
+	var typ wasm.ValType
+	n := uint32(0)
+	for i := range e.rm.Imports {
+		if imp := &e.rm.Imports[i]; imp.Kind == wasm.ImportGlobal {
+			if n == idx && imp.Global != nil {
+				typ = imp.Global.Type
+			}
+			n++
+		}
+	}
+	if idx >= n && int(idx-n) < len(e.rm.Globals) {
+		typ = e.rm.Globals[idx-n].Type.Type
+	}
+	var t *Term
+	if v, err := e.rm.GlobalValue(idx); err == nil {
+		t = Const(widthOf(typ), v.Bits)
+	} else {
+		// Imported globals are inputs too.
+		t = Var(fmt.Sprintf("$global%d", idx), widthOf(typ))
+	}
+	st.globals[idx] = t
+	return t
+}
+
+func (e *executor) binary(st *state, bo binOp) bool {
+	b := st.pop()
+	a := st.pop()
+	if bo.swap {
+		a, b = b, a
+	}
+	w := a.Width
+	switch bo.kind {
+	case KindUDiv, KindURem, KindSDiv, KindSRem:
+		// Paths that trap are not followed.
+		if !assume(st, nonzero(b)) {
+			return false
+		}
+		if bo.kind == KindSDiv {
+			overflow := And(Binary(KindEq, a, Const(w, 1<<(w-1))), Binary(KindEq, b, Const(w, mask(w))))
+			if !assume(st, Not(overflow)) {
+				return false
+			}
+		}
+	}
+	r := Binary(bo.kind, a, b)
+	if bo.negate {
+		r = Not(r)
+	}
+	if r.Width == 1 {
+		r = Zext(r, 32)
+	}
+	st.push(r)
+	return true
+}
+
+// concrete returns a value of t allowed by the path and pins t to it.
+func (e *executor) concrete(st *state, t *Term) (uint64, bool) {
+	if t.IsConst() {
+		return t.Val, true
+	}
+	status, model := Solve(st.path, e.opts.MaxConflicts)
+	if status != Sat {
+		if status == Unknown {
+			e.res.Incomplete = true
+		}
+		return 0, false
+	}
+	v := t.Eval(model)
+	e.res.Incomplete = true
+	st.path = append(st.path, Binary(KindEq, t, Const(t.Width, v)))
+	return v, true
+}
+
+// address computes the effective address of an access of size bytes. A
+// symbolic address is kept in bounds and then concretized to one value the
+// path allows. It reports false when the access traps.
+func (e *executor) address(st *state, base *Term, offset, size uint32) (uint32, bool) {
+	ea := Binary(KindAdd, Zext(base, 64), Const(64, uint64(offset)))
+	if e.memSize < uint64(size) {
+		return 0, false
+	}
+	limit := e.memSize - uint64(size)
+	if !ea.IsConst() {
+		if !assume(st, Not(Binary(KindUlt, Const(64, limit), ea))) {
+			return 0, false
+		}
+	}
+	v, ok := e.concrete(st, ea)
+	if !ok || v > limit {
+		return 0, false
+	}
+	return uint32(v), true
+}
+
+func (e *executor) loadByte(st *state, addr uint32) *Term {
+	if t := st.mem[addr]; t != nil {
+		return t
+	}
+	if int(addr) < len(e.image) {
+		return Const(8, uint64(e.image[addr]))
+	}
+	return Const(8, 0)
+}
+
+// load reads size little-endian bytes.
+func (e *executor) load(st *state, addr, size uint32) *Term {
+	v := e.loadByte(st, addr)
+	for i := uint32(1); i < size; i++ {
+		v = Concat(e.loadByte(st, addr+i), v)
+	}
+	return v
+}
+
+// maxBulk bounds the length of a modelled memory.fill or memory.copy.
+const maxBulk = 1 << 16
+
+func (e *executor) bulk(st *state, op wasm.Opcode) bool {
+	n, ok := e.concrete(st, st.pop())
+	if !ok || n > maxBulk {
+		e.res.Incomplete = true
+		return false
+	}
+	src := st.pop()
+	dst, ok := e.concrete(st, st.pop())
+	if !ok || dst+n > e.memSize {
+		return false
+	}
+	if op == wasm.OpMemoryFill {
+		b := Extract(src, 0, 8)
+		for i := uint64(0); i < n; i++ {
+			st.mem[uint32(dst+i)] = b
+		}
+		return true
+	}
+	s, ok := e.concrete(st, src)
+	if !ok || s+n > e.memSize {
+		return false
+	}
+	data := make([]*Term, n)
+	for i := range data {
+		data[i] = e.loadByte(st, uint32(s+uint64(i)))
+	}
+	for i, b := range data {
+		st.mem[uint32(dst+uint64(i))] = b
+	}
+	return true
+}
+
+var errReached = errors.New("target reached")
+
+// verifyFuel bounds the concrete run that checks a solution.
+const verifyFuel = 10_000_000
+
+func verify(rm *wasm.ResolvedModule, funcIdx uint32, target uint64, regions []Region, res *Result) bool {
+	imports := interp.NewImports()
+	if err := stubs.Register(rm, imports, stubs.Options{}); err != nil {
+		return false
+	}
+	inst, err := interp.NewInstance(rm, imports)
+	if err != nil {
+		return false
+	}
+	if mem := inst.Memory(); mem != nil {
+		clear(mem.Data)
+		copy(mem.Data, rm.MemoryImage().Data)
+		for _, r := range regions {
+			mem.Write(r.Addr, res.Memory[r.Name])
+		}
+	}
+	inst.Fuel, inst.Metered = verifyFuel, true
+	inst.Hook = func(s *interp.Step) error {
+		if s.Instr.Offset == target {
+			return errReached
+		}
+		return nil
+	}
+	_, err = inst.CallFunc(funcIdx, res.Params...)
+	return errors.Is(err, errReached)
+}
@@ -0,0 +1,133 @@
+package symex
+
+import "github.com/0xInception/wasmspy/pkg/wasm"
+
+// binOp describes an integer instruction with two operands. Comparisons
+// missing from the term IR swap their operands or negate the result.
+type binOp struct {
+	kind         Kind
+	swap, negate bool
+}
+
+var binOps = map[wasm.Opcode]binOp{
+	wasm.OpI32Add: {kind: KindAdd}, wasm.OpI64Add: {kind: KindAdd},
+	wasm.OpI32Sub: {kind: KindSub}, wasm.OpI64Sub: {kind: KindSub},
+	wasm.OpI32Mul: {kind: KindMul}, wasm.OpI64Mul: {kind: KindMul},
+	wasm.OpI32DivS: {kind: KindSDiv}, wasm.OpI64DivS: {kind: KindSDiv},
+	wasm.OpI32DivU: {kind: KindUDiv}, wasm.OpI64DivU: {kind: KindUDiv},
+	wasm.OpI32RemS: {kind: KindSRem}, wasm.OpI64RemS: {kind: KindSRem},
+	wasm.OpI32RemU: {kind: KindURem}, wasm.OpI64RemU: {kind: KindURem},
+	wasm.OpI32And: {kind: KindAnd}, wasm.OpI64And: {kind: KindAnd},
+	wasm.OpI32Or: {kind: KindOr}, wasm.OpI64Or: {kind: KindOr},
+	wasm.OpI32Xor: {kind: KindXor}, wasm.OpI64Xor: {kind: KindXor},
+	wasm.OpI32Shl: {kind: KindShl}, wasm.OpI64Shl: {kind: KindShl},
+	wasm.OpI32ShrS: {kind: KindAShr}, wasm.OpI64ShrS: {kind: KindAShr},
+	wasm.OpI32ShrU: {kind: KindLShr}, wasm.OpI64ShrU: {kind: KindLShr},
+	wasm.OpI32Rotl: {kind: KindRotl}, wasm.OpI64Rotl: {kind: KindRotl},
+	wasm.OpI32Rotr: {kind: KindRotr}, wasm.OpI64Rotr: {kind: KindRotr},
+
+	wasm.OpI32Eq: {kind: KindEq}, wasm.OpI64Eq: {kind: KindEq},
+	wasm.OpI32Ne: {kind: KindEq, negate: true}, wasm.OpI64Ne: {kind: KindEq, negate: true},
+	wasm.OpI32LtS: {kind: KindSlt}, wasm.OpI64LtS: {kind: KindSlt},
+	wasm.OpI32LtU: {kind: KindUlt}, wasm.OpI64LtU: {kind: KindUlt},
+	wasm.OpI32GtS: {kind: KindSlt, swap: true}, wasm.OpI64GtS: {kind: KindSlt, swap: true},
+	wasm.OpI32GtU: {kind: KindUlt, swap: true}, wasm.OpI64GtU: {kind: KindUlt, swap: true},
+	wasm.OpI32LeS: {kind: KindSlt, swap: true, negate: true}, wasm.OpI64LeS: {kind: KindSlt, swap: true, negate: true},
+	wasm.OpI32LeU: {kind: KindUlt, swap: true, negate: true}, wasm.OpI64LeU: {kind: KindUlt, swap: true, negate: true},
+	wasm.OpI32GeS: {kind: KindSlt, negate: true}, wasm.OpI64GeS: {kind: KindSlt, negate: true},
+	wasm.OpI32GeU: {kind: KindUlt, negate: true}, wasm.OpI64GeU: {kind: KindUlt, negate: true},
+}
+
+func isZero(a *Term) *Term {
+	return Zext(Binary(KindEq, a, Const(a.Width, 0)), 32)
+}
+
+var unOps = map[wasm.Opcode]func(*Term) *Term{
+	wasm.OpI32Clz:    func(a *Term) *Term { return Unary(KindClz, a) },
+	wasm.OpI64Clz:    func(a *Term) *Term { return Unary(KindClz, a) },
+	wasm.OpI32Ctz:    func(a *Term) *Term { return Unary(KindCtz, a) },
+	wasm.OpI64Ctz:    func(a *Term) *Term { return Unary(KindCtz, a) },
+	wasm.OpI32Popcnt: func(a *Term) *Term { return Unary(KindPopcnt, a) },
+	wasm.OpI64Popcnt: func(a *Term) *Term { return Unary(KindPopcnt, a) },
+	wasm.OpI32Eqz:    isZero,
+	wasm.OpI64Eqz:    isZero,
+
+	wasm.OpI32WrapI64:        func(a *Term) *Term { return Extract(a, 0, 32) },
+	wasm.OpI64ExtendI32S:     func(a *Term) *Term { return Sext(a, 64) },
+	wasm.OpI64ExtendI32U:     func(a *Term) *Term { return Zext(a, 64) },
+	wasm.OpI32Extend8S:       func(a *Term) *Term { return Sext(Extract(a, 0, 8), 32) },
+	wasm.OpI32Extend16S:      func(a *Term) *Term { return Sext(Extract(a, 0, 16), 32) },
+	wasm.OpI64Extend8S:       func(a *Term) *Term { return Sext(Extract(a, 0, 8), 64) },
+	wasm.OpI64Extend16S:      func(a *Term) *Term { return Sext(Extract(a, 0, 16), 64) },
+	wasm.OpI64Extend32S:      func(a *Term) *Term { return Sext(Extract(a, 0, 32), 64) },
+	wasm.OpI32ReinterpretF32: func(a *Term) *Term { return a },
+	wasm.OpI64ReinterpretF64: func(a *Term) *Term { return a },
+	wasm.OpF32ReinterpretI32: func(a *Term) *Term { return a },
+	wasm.OpF64ReinterpretI64: func(a *Term) *Term { return a },
+}
+
+type loadOp struct {
+	size   uint32
+	width  uint8
+	signed bool
+}
+
+var loads = map[wasm.Opcode]loadOp{
+	wasm.OpI32Load:    {4, 32, false},
+	wasm.OpF32Load:    {4, 32, false},
+	wasm.OpI64Load:    {8, 64, false},
+	wasm.OpF64Load:    {8, 64, false},
+	wasm.OpI32Load8S:  {1, 32, true},
+	wasm.OpI32Load8U:  {1, 32, false},
+	wasm.OpI32Load16S: {2, 32, true},
+	wasm.OpI32Load16U: {2, 32, false},
+	wasm.OpI64Load8S:  {1, 64, true},
+	wasm.OpI64Load8U:  {1, 64, false},
+	wasm.OpI64Load16S: {2, 64, true},
+	wasm.OpI64Load16U: {2, 64, false},
+	wasm.OpI64Load32S: {4, 64, true},
+	wasm.OpI64Load32U: {4, 64, false},
+}
+
+// stores maps each store to the number of bytes it writes.
+var stores = map[wasm.Opcode]uint32{
+	wasm.OpI32Store:   4,
+	wasm.OpF32Store:   4,
+	wasm.OpI64Store:   8,
+	wasm.OpF64Store:   8,
+	wasm.OpI32Store8:  1,
+	wasm.OpI32Store16: 2,
+	wasm.OpI64Store8:  1,
+	wasm.OpI64Store16: 2,
+	wasm.OpI64Store32: 4,
+}
+
+// floatOp returns the operand count and result width of a floating-point
+// instruction, 1 for comparisons. Their results are not modelled.
+func floatOp(op wasm.Opcode) (pops int, width uint8, ok bool) {
+	switch {
+	case op >= wasm.OpF32Eq && op <= wasm.OpF64Ge:
+		return 2, 1, true
+	case op >= wasm.OpF32Abs && op <= wasm.OpF32Sqrt:
+		return 1, 32, true
+	case op >= wasm.OpF32Add && op <= wasm.OpF32Copysign:
+		return 2, 32, true
+	case op >= wasm.OpF64Abs && op <= wasm.OpF64Sqrt:
+		return 1, 64, true
+	case op >= wasm.OpF64Add && op <= wasm.OpF64Copysign:
+		return 2, 64, true
+	case op >= wasm.OpI32TruncF32S && op <= wasm.OpI32TruncF64U:
+		return 1, 32, true
+	case op >= wasm.OpI64TruncF32S && op <= wasm.OpI64TruncF64U:
+		return 1, 64, true
+	case op >= wasm.OpF32ConvertI32S && op <= wasm.OpF32DemoteF64:
+		return 1, 32, true
+	case op >= wasm.OpF64ConvertI32S && op <= wasm.OpF64PromoteF32:
+		return 1, 64, true
+	case op >= wasm.OpI32TruncSatF32S && op <= wasm.OpI32TruncSatF64U:
+		return 1, 32, true
+	case op >= wasm.OpI64TruncSatF32S && op <= wasm.OpI64TruncSatF64U:
+		return 1, 64, true
+	}
+	return 0, 0, false
+}
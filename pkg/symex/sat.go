@@ -0,0 +1,405 @@
+package symex
+
+// lit is a literal of the SAT solver: variable v<<1, negated when the low
+// bit is set.
+type lit int32
+
+func mkLit(v int, neg bool) lit {
+	l := lit(v << 1)
+	if neg {
+		l |= 1
+	}
+	return l
+}
+
+func (l lit) v() int     { return int(l >> 1) }
+func (l lit) neg() bool  { return l&1 != 0 }
+func (l lit) not() lit   { return l ^ 1 }
+func (l lit) index() int { return int(l) }
+
+// sat is a conflict-driven clause-learning solver with two watched
+// literals, first-UIP learning, activity-based decisions, phase saving and
+// Luby restarts.
+type sat struct {
+	clauses [][]lit
+	watches [][]int
+
+	assign   []int8 // 0 unassigned, 1 true, -1 false
+	level    []int
+	reason   []int
+	phase    []bool
+	activity []float64
+	varInc   float64
+	heap     varHeap
+
+	trail    []lit
+	trailLim []int
+	qhead    int
+	unsat    bool
+
+	seen []bool
+}
+
+func newSat() *sat {
+	s := &sat{varInc: 1}
+	s.heap.act = &s.activity
+	return s
+}
+
+func (s *sat) newVar() int {
+	v := len(s.assign)
+	s.assign = append(s.assign, 0)
+	s.level = append(s.level, 0)
+	s.reason = append(s.reason, -1)
+	s.phase = append(s.phase, false)
+	s.activity = append(s.activity, 0)
+	s.seen = append(s.seen, false)
+	s.watches = append(s.watches, nil, nil)
+	s.heap.insert(v)
+	return v
+}
+
+func (s *sat) value(l lit) int8 {
+	a := s.assign[l.v()]
+	if l.neg() {
+		return -a
+	}
+	return a
+}
+
+func (s *sat) decisionLevel() int {
+	return len(s.trailLim)
+}
+
+func (s *sat) enqueue(l lit, reason int) {
+	v := l.v()
+	if l.neg() {
+		s.assign[v] = -1
+	} else {
+		s.assign[v] = 1
+	}
+	s.level[v] = s.decisionLevel()
+	s.reason[v] = reason
+	s.trail = append(s.trail, l)
+}
+
+// addClause adds a clause at decision level 0.
+func (s *sat) addClause(lits ...lit) {
+	if s.unsat {
+		return
+	}
+	var c []lit
+	seen := make(map[lit]bool, len(lits))
+	for _, l := range lits {
+		switch {
+		case s.value(l) == 1 && s.level[l.v()] == 0, seen[l.not()]:
+			return
+		case s.value(l) == -1 && s.level[l.v()] == 0, seen[l]:
+			continue
+		}
+		seen[l] = true
+		c = append(c, l)
+	}
+	switch len(c) {
+	case 0:
+		s.unsat = true
+	case 1:
+		s.enqueue(c[0], -1)
+		if s.propagate() >= 0 {
+			s.unsat = true
+		}
+	default:
+		s.attach(c)
+	}
+}
+
+func (s *sat) attach(c []lit) int {
+	idx := len(s.clauses)
+	s.clauses = append(s.clauses, c)
+	s.watches[c[0].not().index()] = append(s.watches[c[0].not().index()], idx)
+	s.watches[c[1].not().index()] = append(s.watches[c[1].not().index()], idx)
+	return idx
+}
+
+// propagate performs unit propagation and returns a conflicting clause, or
+// -1.
+func (s *sat) propagate() int {
+	for s.qhead < len(s.trail) {
+		p := s.trail[s.qhead]
+		s.qhead++
+		falseLit := p.not()
+		ws := s.watches[p.index()]
+		kept := ws[:0]
+		conflict := -1
+		for i, ci := range ws {
+			if conflict >= 0 {
+				kept = append(kept, ws[i:]...)
+				break
+			}
+			c := s.clauses[ci]
+			if c[0] == falseLit {
+				c[0], c[1] = c[1], c[0]
+			}
+			if s.value(c[0]) == 1 {
+				kept = append(kept, ci)
+				continue
+			}
+			moved := false
+			for k := 2; k < len(c); k++ {
+				if s.value(c[k]) != -1 {
+					c[1], c[k] = c[k], c[1]
+					w := c[1].not().index()
+					s.watches[w] = append(s.watches[w], ci)
+					moved = true
+					break
+				}
+			}
+			if moved {
+				continue
+			}
+			kept = append(kept, ci)
+			if s.value(c[0]) == -1 {
+				conflict = ci
+			} else {
+				s.enqueue(c[0], ci)
+			}
+		}
+		s.watches[p.index()] = kept
+		if conflict >= 0 {
+			s.qhead = len(s.trail)
+			return conflict
+		}
+	}
+	return -1
+}
+
+func (s *sat) bump(v int) {
+	s.activity[v] += s.varInc
+	if s.activity[v] > 1e100 {
+		for i := range s.activity {
+			s.activity[i] *= 1e-100
+		}
+		s.varInc *= 1e-100
+	}
+	s.heap.update(v)
+}
+
+// analyze derives the first-UIP clause of a conflict and the level to
+// backtrack to.
+func (s *sat) analyze(confl int) ([]lit, int) {
+	learnt := []lit{0}
+	pathC := 0
+	var p lit = -1
+	idx := len(s.trail) - 1
+	for {
+		c := s.clauses[confl]
+		start := 0
+		if p != -1 {
+			start = 1
+		}
+		for _, q := range c[start:] {
+			v := q.v()
+			if s.seen[v] || s.level[v] == 0 {
+				continue
+			}
+			s.seen[v] = true
+			s.bump(v)
+			if s.level[v] >= s.decisionLevel() {
+				pathC++
+			} else {
+				learnt = append(learnt, q)
+			}
+		}
+		for !s.seen[s.trail[idx].v()] {
+			idx--
+		}
+		p = s.trail[idx]
+		idx--
+		confl = s.reason[p.v()]
+		s.seen[p.v()] = false
+		pathC--
+		if pathC == 0 {
+			break
+		}
+	}
+	learnt[0] = p.not()
+
+	bt := 0
+	for i := 1; i < len(learnt); i++ {
+		if lv := s.level[learnt[i].v()]; lv > bt {
+			bt = lv
+			learnt[1], learnt[i] = learnt[i], learnt[1]
+		}
+	}
+	for _, l := range learnt {
+		s.seen[l.v()] = false
+	}
+	s.varInc /= 0.95
+	return learnt, bt
+}
+
+func (s *sat) cancelUntil(level int) {
+	if s.decisionLevel() <= level {
+		return
+	}
+	for i := len(s.trail) - 1; i >= s.trailLim[level]; i-- {
+		v := s.trail[i].v()
+		s.phase[v] = !s.trail[i].neg()
+		s.assign[v] = 0
+		s.reason[v] = -1
+		if !s.heap.contains(v) {
+			s.heap.insert(v)
+		}
+	}
+	s.trail = s.trail[:s.trailLim[level]]
+	s.trailLim = s.trailLim[:level]
+	s.qhead = len(s.trail)
+}
+
+func luby(i int) int {
+	size, seq := 1, 0
+	for size < i+1 {
+		seq++
+		size = 2*size + 1
+	}
+	for size-1 != i {
+		size = (size - 1) >> 1
+		seq--
+		i = i % size
+	}
+	return 1 << seq
+}
+
+// solve searches for a satisfying assignment within maxConflicts conflicts.
+// It returns true when one was found; ok is false when the budget ran out.
+func (s *sat) solve(maxConflicts int) (satisfied, ok bool) {
+	if s.unsat {
+		return false, true
+	}
+	conflicts := 0
+	for restart := 0; ; restart++ {
+		limit := luby(restart) * 100
+		for n := 0; ; {
+			confl := s.propagate()
+			if confl >= 0 {
+				conflicts++
+				n++
+				if s.decisionLevel() == 0 {
+					s.unsat = true
+					return false, true
+				}
+				learnt, bt := s.analyze(confl)
+				s.cancelUntil(bt)
+				if len(learnt) == 1 {
+					s.enqueue(learnt[0], -1)
+				} else {
+					s.enqueue(learnt[0], s.attach(learnt))
+				}
+				if conflicts >= maxConflicts {
+					s.cancelUntil(0)
+					return false, false
+				}
+				continue
+			}
+			if n >= limit {
+				s.cancelUntil(0)
+				break
+			}
+			v := s.pickBranch()
+			if v < 0 {
+				return true, true
+			}
+			s.trailLim = append(s.trailLim, len(s.trail))
+			s.enqueue(mkLit(v, !s.phase[v]), -1)
+		}
+	}
+}
+
+func (s *sat) pickBranch() int {
+	for s.heap.len() > 0 {
+		v := s.heap.pop()
+		if s.assign[v] == 0 {
+			return v
+		}
+	}
+	return -1
+}
+
+// varHeap is a max-heap of variables ordered by activity.
+type varHeap struct {
+	act  *[]float64
+	heap []int
+	pos  []int
+}
+
+func (h *varHeap) len() int { return len(h.heap) }
+
+func (h *varHeap) contains(v int) bool {
+	return v < len(h.pos) && h.pos[v] >= 0
+}
+
+func (h *varHeap) less(i, j int) bool {
+	return (*h.act)[h.heap[i]] > (*h.act)[h.heap[j]]
+}
+
+func (h *varHeap) swap(i, j int) {
+	h.heap[i], h.heap[j] = h.heap[j], h.heap[i]
+	h.pos[h.heap[i]] = i
+	h.pos[h.heap[j]] = j
+}
+
+func (h *varHeap) up(i int) {
+	for i > 0 {
+		p := (i - 1) / 2
+		if !h.less(i, p) {
+			break
+		}
+		h.swap(i, p)
+		i = p
+	}
+}
+
+func (h *varHeap) down(i int) {
+	for {
+		l := 2*i + 1
+		if l >= len(h.heap) {
+			return
+		}
+		best := l
+		if r := l + 1; r < len(h.heap) && h.less(r, l) {
+			best = r
+		}
+		if !h.less(best, i) {
+			return
+		}
+		h.swap(i, best)
+		i = best
+	}
+}
+
+func (h *varHeap) insert(v int) {
+	for len(h.pos) <= v {
+		h.pos = append(h.pos, -1)
+	}
+	h.pos[v] = len(h.heap)
+	h.heap = append(h.heap, v)
+	h.up(len(h.heap) - 1)
+}
+
+func (h *varHeap) update(v int) {
+	if h.contains(v) {
+		h.up(h.pos[v])
+	}
+}
+
+func (h *varHeap) pop() int {
+	v := h.heap[0]
+	last := len(h.heap) - 1
+	h.swap(0, last)
+	h.heap = h.heap[:last]
+	h.pos[v] = -1
+	if last > 0 {
+		h.down(0)
+	}
+	return v
+}
@@ -0,0 +1,51 @@
+package symex
+
+// Status is the outcome of a satisfiability check.
+type Status int
+
+const (
+	Unsat Status = iota
+	Sat
+	// Unknown means the solver gave up within its conflict budget.
+	Unknown
+)
+
+func (s Status) String() string {
+	switch s {
+	case Sat:
+		return "sat"
+	case Unsat:
+		return "unsat"
+	}
+	return "unknown"
+}
+
+// DefaultConflicts is the conflict budget Solve uses when given zero.
+const DefaultConflicts = 100_000
+
+// Solve looks for an assignment of the variables that makes every width-1
+// constraint true. On Sat the model holds a value for each variable the
+// constraints mention.
+func Solve(constraints []*Term, maxConflicts int) (Status, map[string]uint64) {
+	if maxConflicts <= 0 {
+		maxConflicts = DefaultConflicts
+	}
+	b := newBlaster()
+	for _, c := range constraints {
+		if c.IsConst() {
+			if c.Val == 0 {
+				return Unsat, nil
+			}
+			continue
+		}
+		b.assert(c)
+	}
+	satisfied, ok := b.s.solve(maxConflicts)
+	switch {
+	case !ok:
+		return Unknown, nil
+	case !satisfied:
+		return Unsat, nil
+	}
+	return Sat, b.model()
+}
@@ -0,0 +1,146 @@
+package symex
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/0xInception/wasmspy/internal/wasmtest"
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+// checkModule exports check(x), which returns 1 when x*7+3 == 0x1337, and
+// key(), which returns 1 when the four bytes at 16 xor 0x5a equal "key!"
+// at 32.
+func checkModule(t *testing.T) *wasm.ResolvedModule {
+	t.Helper()
+	return wasmtest.Module(t,
+		wasmtest.Section(0x01, 0x02, 0x60, 0x01, 0x7f, 0x01, 0x7f, 0x60, 0x00, 0x01, 0x7f),
+		wasmtest.Section(0x03, 0x02, 0x00, 0x01),
+		wasmtest.Section(0x05, 0x01, 0x00, 0x01),
+		wasmtest.Section(0x07, wasmtest.Cat([]byte{0x02},
+			wasmtest.Name("check"), []byte{0x00, 0x00},
+			wasmtest.Name("key"), []byte{0x00, 0x01})...),
+		wasmtest.Code(
+			wasmtest.Body(0x00, 0x20, 0x00, 0x41, 0x07, 0x6c, 0x41, 0x03, 0x6a, 0x41, 0xb7, 0x26, 0x46,
+				0x04, 0x7f, 0x41, 0x01, 0x05, 0x41, 0x00, 0x0b, 0x0b),
+			wasmtest.Body(0x01, 0x01, 0x7f,
+				0x02, 0x40, 0x03, 0x40,
+				0x20, 0x00, 0x41, 0x04, 0x4f, 0x0d, 0x01,
+				0x20, 0x00, 0x2d, 0x00, 0x10, 0x41, 0xda, 0x00, 0x73,
+				0x20, 0x00, 0x2d, 0x00, 0x20,
+				0x47, 0x04, 0x40, 0x41, 0x00, 0x0f, 0x0b,
+				0x20, 0x00, 0x41, 0x01, 0x6a, 0x21, 0x00,
+				0x0c, 0x00, 0x0b, 0x0b,
+				0x41, 0x01, 0x0b)),
+		wasmtest.Section(0x0b, 0x01, 0x00, 0x41, 0x20, 0x0b, 0x04, 'k', 'e', 'y', '!'),
+	)
+}
+
+// constOne returns the offset of the last i32.const 1 in a function.
+func constOne(t *testing.T, rm *wasm.ResolvedModule, idx uint32) uint64 {
+	t.Helper()
+	var off uint64
+	for _, ins := range rm.GetFunction(idx).Body.Instructions {
+		if ins.Opcode == wasm.OpI32Const && ins.Imm.Bits == 1 {
+			off = ins.Offset
+		}
+	}
+	if off == 0 {
+		t.Fatal("no i32.const 1")
+	}
+	return off
+}
+
+func TestSolve(t *testing.T) {
+	x := Var("x", 32)
+	status, model := Solve([]*Term{
+		Binary(KindEq, Binary(KindAdd, Binary(KindMul, x, Const(32, 3)), Const(32, 7)), Const(32, 100)),
+	}, 0)
+	if status != Sat || model["x"]*3+7 != 100 {
+		t.Errorf("3x+7 == 100: %v %v", status, model)
+	}
+	status, _ = Solve([]*Term{
+		Binary(KindUlt, x, Const(32, 5)),
+		Binary(KindUlt, Const(32, 10), x),
+	}, 0)
+	if status != Unsat {
+		t.Errorf("x < 5 && x > 10: %v", status)
+	}
+}
+
+// TestBlast checks every operation of the circuit against Eval on random
+// operands.
+func TestBlast(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	binary := []Kind{KindAdd, KindSub, KindMul, KindUDiv, KindSDiv, KindURem, KindSRem, KindAnd, KindOr, KindXor,
+		KindShl, KindLShr, KindAShr, KindRotl, KindRotr, KindEq, KindUlt, KindSlt}
+	for _, w := range []uint8{8, 32} {
+		for i := 0; i < 40; i++ {
+			av, bv := rng.Uint64()&mask(w), rng.Uint64()&mask(w)
+			if i%4 == 0 {
+				bv &= 7
+			}
+			a, b := Var("a", w), Var("b", w)
+			terms := []*Term{
+				Unary(KindClz, a), Unary(KindCtz, a), Unary(KindPopcnt, a),
+				Sext(Extract(a, 0, w/2), w), Concat(Extract(b, 0, w/2), Extract(a, w/2, w/2)),
+				Ite(Binary(KindUlt, a, b), a, b),
+			}
+			for _, k := range binary {
+				terms = append(terms, Binary(k, a, b))
+			}
+			for _, term := range terms {
+				r := Var("r", term.Width)
+				status, model := Solve([]*Term{
+					Binary(KindEq, a, Const(w, av)),
+					Binary(KindEq, b, Const(w, bv)),
+					Binary(KindEq, r, term),
+				}, 0)
+				want := term.Eval(map[string]uint64{"a": av, "b": bv})
+				if status != Sat || model["r"] != want {
+					t.Fatalf("%s with a=%d b=%d: %v, got %d, want %d", term, av, bv, status, model["r"], want)
+				}
+			}
+		}
+	}
+}
+
+func TestReach(t *testing.T) {
+	rm := checkModule(t)
+	res, err := Reach(rm, 0, constOne(t, rm, 0), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Reached || !res.Verified || uint32(res.Params[0])*7+3 != 0x1337 {
+		t.Fatalf("check: %+v", res)
+	}
+	if res.Incomplete {
+		t.Error("check should be explored completely")
+	}
+
+	res, err = Reach(rm, 1, constOne(t, rm, 1), Options{Symbolic: []Region{{Name: "key", Addr: 16, Size: 4}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := res.Memory["key"]
+	if !res.Reached || !res.Verified || len(key) != 4 {
+		t.Fatalf("key: %+v", res)
+	}
+	for i, c := range []byte("key!") {
+		if key[i]^0x5a != c {
+			t.Errorf("key byte %d: 0x%02x", i, key[i])
+		}
+	}
+
+	res, err = Reach(rm, 1, constOne(t, rm, 1), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Reached {
+		t.Errorf("key reached with zeroed memory: %+v", res)
+	}
+
+	if _, err := Reach(rm, 0, 1, Options{}); err == nil {
+		t.Error("expected error for an offset without an instruction")
+	}
+}
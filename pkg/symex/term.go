@@ -0,0 +1,448 @@
+// Package symex executes single functions symbolically to find inputs that
+// reach a chosen instruction. Parameters and selected memory regions are
+// bit-vector variables; every path through the function collects the branch
+// conditions it takes, and a built-in bit-vector solver turns the
+// conditions of a path reaching the target into concrete values.
+package symex
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Kind is the operation of a term.
+type Kind uint8
+
+const (
+	KindConst Kind = iota
+	KindVar
+	KindAdd
+	KindSub
+	KindMul
+	KindUDiv
+	KindSDiv
+	KindURem
+	KindSRem
+	KindAnd
+	KindOr
+	KindXor
+	KindShl
+	KindLShr
+	KindAShr
+	KindRotl
+	KindRotr
+	KindClz
+	KindCtz
+	KindPopcnt
+	// KindEq, KindUlt and KindSlt compare two operands and have width 1.
+	KindEq
+	KindUlt
+	KindSlt
+	// KindNot is the bitwise complement.
+	KindNot
+	// KindIte selects Args[1] when the width-1 Args[0] is set, else Args[2].
+	KindIte
+	KindZext
+	KindSext
+	// KindExtract takes the Width bits of Args[0] starting at bit Lo.
+	KindExtract
+	// KindConcat places Args[0] above Args[1].
+	KindConcat
+)
+
+var kindNames = [...]string{
+	KindAdd: "+", KindSub: "-", KindMul: "*", KindUDiv: "/u", KindSDiv: "/s",
+	KindURem: "%u", KindSRem: "%s", KindAnd: "&", KindOr: "|", KindXor: "^",
+	KindShl: "<<", KindLShr: ">>u", KindAShr: ">>s", KindRotl: "rotl", KindRotr: "rotr",
+	KindClz: "clz", KindCtz: "ctz", KindPopcnt: "popcnt",
+	KindEq: "==", KindUlt: "<u", KindSlt: "<s", KindNot: "~",
+}
+
+// Term is a bit-vector expression of Width bits. Terms are immutable and
+// built through the constructors, which fold constants.
+type Term struct {
+	Kind  Kind
+	Width uint8
+	// Val is the value of a constant.
+	Val uint64
+	// Name identifies a variable.
+	Name string
+	// Lo is the lowest extracted bit.
+	Lo   uint8
+	Args []*Term
+}
+
+func mask(width uint8) uint64 {
+	if width >= 64 {
+		return ^uint64(0)
+	}
+	return 1<<width - 1
+}
+
+func signExtend(v uint64, width uint8) int64 {
+	shift := 64 - width
+	return int64(v<<shift) >> shift
+}
+
+func Const(width uint8, v uint64) *Term {
+	return &Term{Kind: KindConst, Width: width, Val: v & mask(width)}
+}
+
+func Var(name string, width uint8) *Term {
+	return &Term{Kind: KindVar, Width: width, Name: name}
+}
+
+var (
+	True  = Const(1, 1)
+	False = Const(1, 0)
+)
+
+func (t *Term) IsConst() bool {
+	return t.Kind == KindConst
+}
+
+func Bool(b bool) *Term {
+	if b {
+		return True
+	}
+	return False
+}
+
+// Binary builds a two-operand arithmetic, bitwise or comparison term.
+func Binary(kind Kind, a, b *Term) *Term {
+	if a.Width != b.Width {
+		panic(fmt.Sprintf("symex: width mismatch %d and %d", a.Width, b.Width))
+	}
+	w := a.Width
+	if a.IsConst() && b.IsConst() {
+		if v, ok := foldBinary(kind, w, a.Val, b.Val); ok {
+			if kind == KindEq || kind == KindUlt || kind == KindSlt {
+				return Const(1, v)
+			}
+			return Const(w, v)
+		}
+	}
+	switch kind {
+	case KindAdd, KindOr, KindXor:
+		if a.IsConst() && a.Val == 0 {
+			return b
+		}
+		if b.IsConst() && b.Val == 0 {
+			return a
+		}
+	case KindSub, KindShl, KindLShr, KindAShr, KindRotl, KindRotr:
+		if b.IsConst() && b.Val&uint64(w-1) == 0 && kind != KindSub {
+			return a
+		}
+		if kind == KindSub && b.IsConst() && b.Val == 0 {
+			return a
+		}
+	case KindMul:
+		if a.IsConst() && a.Val == 1 {
+			return b
+		}
+		if b.IsConst() && b.Val == 1 {
+			return a
+		}
+		if (a.IsConst() && a.Val == 0) || (b.IsConst() && b.Val == 0) {
+			return Const(w, 0)
+		}
+	case KindAnd:
+		if (a.IsConst() && a.Val == 0) || (b.IsConst() && b.Val == 0) {
+			return Const(w, 0)
+		}
+		if a.IsConst() && a.Val == mask(w) {
+			return b
+		}
+		if b.IsConst() && b.Val == mask(w) {
+			return a
+		}
+	case KindEq:
+		if a == b {
+			return True
+		}
+		// A widened condition compared with zero is the negated condition.
+		if b.IsConst() && b.Val == 0 && a.Kind == KindZext && a.Args[0].Width == 1 {
+			return Not(a.Args[0])
+		}
+		if w == 1 && b.IsConst() {
+			if b.Val == 1 {
+				return a
+			}
+			return Not(a)
+		}
+	}
+	width := w
+	if kind == KindEq || kind == KindUlt || kind == KindSlt {
+		width = 1
+	}
+	return &Term{Kind: kind, Width: width, Args: []*Term{a, b}}
+}
+
+func foldBinary(kind Kind, w uint8, a, b uint64) (uint64, bool) {
+	m := mask(w)
+	sa, sb := signExtend(a, w), signExtend(b, w)
+	n := uint64(w)
+	switch kind {
+	case KindAdd:
+		return (a + b) & m, true
+	case KindSub:
+		return (a - b) & m, true
+	case KindMul:
+		return (a * b) & m, true
+	case KindUDiv:
+		if b == 0 {
+			return 0, false
+		}
+		return a / b, true
+	case KindURem:
+		if b == 0 {
+			return 0, false
+		}
+		return a % b, true
+	case KindSDiv:
+		if b == 0 {
+			return 0, false
+		}
+		if sb == -1 {
+			return uint64(-sa) & m, true
+		}
+		return uint64(sa/sb) & m, true
+	case KindSRem:
+		if b == 0 {
+			return 0, false
+		}
+		if sb == -1 {
+			return 0, true
+		}
+		return uint64(sa%sb) & m, true
+	case KindAnd:
+		return a & b, true
+	case KindOr:
+		return a | b, true
+	case KindXor:
+		return a ^ b, true
+	case KindShl:
+		return (a << (b % n)) & m, true
+	case KindLShr:
+		return a >> (b % n), true
+	case KindAShr:
+		return uint64(sa>>(b%n)) & m, true
+	case KindRotl:
+		s := b % n
+		return (a<<s | a>>((n-s)%n)) & m, true
+	case KindRotr:
+		s := b % n
+		return (a>>s | a<<((n-s)%n)) & m, true
+	case KindEq:
+		return b2u(a == b), true
+	case KindUlt:
+		return b2u(a < b), true
+	case KindSlt:
+		return b2u(sa < sb), true
+	}
+	return 0, false
+}
+
+func b2u(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Unary builds clz, ctz or popcnt.
+func Unary(kind Kind, a *Term) *Term {
+	if a.IsConst() {
+		var n uint64
+		switch kind {
+		case KindClz:
+			n = uint64(a.Width)
+			for i := int(a.Width) - 1; i >= 0; i-- {
+				if a.Val>>uint(i)&1 != 0 {
+					n = uint64(int(a.Width) - 1 - i)
+					break
+				}
+			}
+		case KindCtz:
+			n = uint64(a.Width)
+			for i := 0; i < int(a.Width); i++ {
+				if a.Val>>uint(i)&1 != 0 {
+					n = uint64(i)
+					break
+				}
+			}
+		case KindPopcnt:
+			for v := a.Val; v != 0; v &= v - 1 {
+				n++
+			}
+		}
+		return Const(a.Width, n)
+	}
+	return &Term{Kind: kind, Width: a.Width, Args: []*Term{a}}
+}
+
+func Not(a *Term) *Term {
+	if a.IsConst() {
+		return Const(a.Width, ^a.Val)
+	}
+	if a.Kind == KindNot {
+		return a.Args[0]
+	}
+	return &Term{Kind: KindNot, Width: a.Width, Args: []*Term{a}}
+}
+
+func Ite(cond, a, b *Term) *Term {
+	if cond.IsConst() {
+		if cond.Val != 0 {
+			return a
+		}
+		return b
+	}
+	if a == b {
+		return a
+	}
+	return &Term{Kind: KindIte, Width: a.Width, Args: []*Term{cond, a, b}}
+}
+
+func Zext(a *Term, width uint8) *Term {
+	if a.Width == width {
+		return a
+	}
+	if a.IsConst() {
+		return Const(width, a.Val)
+	}
+	return &Term{Kind: KindZext, Width: width, Args: []*Term{a}}
+}
+
+func Sext(a *Term, width uint8) *Term {
+	if a.Width == width {
+		return a
+	}
+	if a.IsConst() {
+		return Const(width, uint64(signExtend(a.Val, a.Width)))
+	}
+	return &Term{Kind: KindSext, Width: width, Args: []*Term{a}}
+}
+
+func Extract(a *Term, lo, width uint8) *Term {
+	if lo == 0 && width == a.Width {
+		return a
+	}
+	if a.IsConst() {
+		return Const(width, a.Val>>lo)
+	}
+	switch a.Kind {
+	case KindConcat:
+		// Reading back a byte of a value assembled from bytes.
+		low := a.Args[1]
+		if lo+width <= low.Width {
+			return Extract(low, lo, width)
+		}
+		if lo >= low.Width {
+			return Extract(a.Args[0], lo-low.Width, width)
+		}
+	case KindZext:
+		inner := a.Args[0]
+		if lo+width <= inner.Width {
+			return Extract(inner, lo, width)
+		}
+		if lo >= inner.Width {
+			return Const(width, 0)
+		}
+	case KindExtract:
+		return Extract(a.Args[0], a.Lo+lo, width)
+	}
+	return &Term{Kind: KindExtract, Width: width, Lo: lo, Args: []*Term{a}}
+}
+
+func Concat(hi, lo *Term) *Term {
+	if hi.IsConst() && lo.IsConst() && hi.Width+lo.Width <= 64 {
+		return Const(hi.Width+lo.Width, hi.Val<<lo.Width|lo.Val)
+	}
+	// Reassembling adjacent bytes of one value yields the value itself.
+	if hi.Kind == KindExtract && lo.Kind == KindExtract && hi.Args[0] == lo.Args[0] && hi.Lo == lo.Lo+lo.Width {
+		return Extract(hi.Args[0], lo.Lo, hi.Width+lo.Width)
+	}
+	return &Term{Kind: KindConcat, Width: hi.Width + lo.Width, Args: []*Term{hi, lo}}
+}
+
+// And and Or combine width-1 conditions.
+func And(a, b *Term) *Term { return Binary(KindAnd, a, b) }
+func Or(a, b *Term) *Term  { return Binary(KindOr, a, b) }
+
+func (t *Term) String() string {
+	switch t.Kind {
+	case KindConst:
+		if t.Width == 1 {
+			return fmt.Sprint(t.Val == 1)
+		}
+		return fmt.Sprint(t.Val)
+	case KindVar:
+		return t.Name
+	case KindNot:
+		return "~" + t.Args[0].String()
+	case KindIte:
+		return fmt.Sprintf("(%s ? %s : %s)", t.Args[0], t.Args[1], t.Args[2])
+	case KindZext:
+		return fmt.Sprintf("zext%d(%s)", t.Width, t.Args[0])
+	case KindSext:
+		return fmt.Sprintf("sext%d(%s)", t.Width, t.Args[0])
+	case KindExtract:
+		return fmt.Sprintf("%s[%d:%d]", t.Args[0], t.Lo, t.Lo+t.Width)
+	case KindConcat:
+		return fmt.Sprintf("(%s ++ %s)", t.Args[0], t.Args[1])
+	case KindClz, KindCtz, KindPopcnt:
+		return fmt.Sprintf("%s(%s)", kindNames[t.Kind], t.Args[0])
+	}
+	parts := make([]string, len(t.Args))
+	for i, a := range t.Args {
+		parts[i] = a.String()
+	}
+	return "(" + strings.Join(parts, " "+kindNames[t.Kind]+" ") + ")"
+}
+
+// Eval computes the value of t under an assignment of its variables;
+// unassigned variables are zero.
+func (t *Term) Eval(model map[string]uint64) uint64 {
+	return t.eval(model, make(map[*Term]uint64))
+}
+
+func (t *Term) eval(model map[string]uint64, memo map[*Term]uint64) uint64 {
+	if v, ok := memo[t]; ok {
+		return v
+	}
+	var v uint64
+	switch t.Kind {
+	case KindConst:
+		v = t.Val
+	case KindVar:
+		v = model[t.Name] & mask(t.Width)
+	case KindNot:
+		v = ^t.Args[0].eval(model, memo) & mask(t.Width)
+	case KindIte:
+		if t.Args[0].eval(model, memo) != 0 {
+			v = t.Args[1].eval(model, memo)
+		} else {
+			v = t.Args[2].eval(model, memo)
+		}
+	case KindZext:
+		v = t.Args[0].eval(model, memo)
+	case KindSext:
+		a := t.Args[0]
+		v = uint64(signExtend(a.eval(model, memo), a.Width)) & mask(t.Width)
+	case KindExtract:
+		v = t.Args[0].eval(model, memo) >> t.Lo & mask(t.Width)
+	case KindConcat:
+		v = t.Args[0].eval(model, memo)<<t.Args[1].Width | t.Args[1].eval(model, memo)
+	case KindClz, KindCtz, KindPopcnt:
+		v = Unary(t.Kind, Const(t.Width, t.Args[0].eval(model, memo))).Val
+	default:
+		a, b := t.Args[0], t.Args[1]
+		// Division by zero is excluded by path conditions; evaluate it
+		// as zero like the solver's circuit.
+		v, _ = foldBinary(t.Kind, a.Width, a.eval(model, memo), b.eval(model, memo))
+	}
+	memo[t] = v
+	return v
+}
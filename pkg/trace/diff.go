@@ -0,0 +1,129 @@
+package trace
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/0xInception/wasmspy/pkg/interp"
+)
+
+// Diff describes how two traces of the same module differ.
+type Diff struct {
+	// SameModule is false when the traces were recorded against different
+	// module files, in which case offsets may not be comparable.
+	SameModule bool
+
+	// Divergence is the index of the first event that differs, or -1 when
+	// one trace is a prefix of the other (or they are equal).
+	Divergence int
+	A, B       *interp.Event
+
+	LenA, LenB int
+
+	// OnlyA and OnlyB list, per function, the instruction offsets executed
+	// by one trace but not the other.
+	OnlyA map[uint32][]uint64
+	OnlyB map[uint32][]uint64
+}
+
+func Compare(a, b *Trace) *Diff {
+	d := &Diff{
+		SameModule: a.ModuleHash == b.ModuleHash,
+		Divergence: -1,
+		LenA:       len(a.Events),
+		LenB:       len(b.Events),
+	}
+	for i := 0; i < len(a.Events) && i < len(b.Events); i++ {
+		if a.Events[i] != b.Events[i] {
+			d.Divergence = i
+			d.A, d.B = &a.Events[i], &b.Events[i]
+			break
+		}
+	}
+	ca, cb := a.Coverage(), b.Coverage()
+	d.OnlyA = coverageMinus(ca, cb)
+	d.OnlyB = coverageMinus(cb, ca)
+	return d
+}
+
+func coverageMinus(x, y *Coverage) map[uint32][]uint64 {
+	result := make(map[uint32][]uint64)
+	for _, fn := range x.FuncIndices() {
+		for _, off := range x.Offsets(fn) {
+			if y.Hits(fn, off) == 0 {
+				result[fn] = append(result[fn], off)
+			}
+		}
+	}
+	return result
+}
+
+// Identical reports whether both traces hold the same events.
+func (d *Diff) Identical() bool {
+	return d.Divergence < 0 && d.LenA == d.LenB
+}
+
+func funcName(idx uint32, name func(uint32) string) string {
+	if name != nil {
+		if n := name(idx); n != "" {
+			return n
+		}
+	}
+	return fmt.Sprintf("func_%d", idx)
+}
+
+func formatEvent(ev *interp.Event, name func(uint32) string) string {
+	fn := funcName(ev.Func, name)
+	switch ev.Kind {
+	case interp.EventInstr:
+		return fmt.Sprintf("instr %s at 0x%x", fn, ev.Offset)
+	case interp.EventLoad, interp.EventStore:
+		return fmt.Sprintf("%s of %d bytes at 0x%x in %s at 0x%x", ev.Kind, ev.Size, ev.Addr, fn, ev.Offset)
+	}
+	return fmt.Sprintf("%s %s", ev.Kind, fn)
+}
+
+// String renders the diff, naming functions through name when it is
+// non-nil.
+func (d *Diff) String(name func(uint32) string) string {
+	var b strings.Builder
+	if !d.SameModule {
+		b.WriteString("warning: traces were recorded against different modules\n")
+	}
+	fmt.Fprintf(&b, "events: %d vs %d\n", d.LenA, d.LenB)
+	switch {
+	case d.Identical():
+		b.WriteString("traces are identical\n")
+		return b.String()
+	case d.Divergence >= 0:
+		fmt.Fprintf(&b, "first divergence at event %d:\n", d.Divergence)
+		fmt.Fprintf(&b, "  a: %s\n", formatEvent(d.A, name))
+		fmt.Fprintf(&b, "  b: %s\n", formatEvent(d.B, name))
+	default:
+		b.WriteString("one trace is a prefix of the other\n")
+	}
+
+	for _, side := range []struct {
+		label string
+		only  map[uint32][]uint64
+	}{{"a", d.OnlyA}, {"b", d.OnlyB}} {
+		if len(side.only) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\nexecuted only in %s:\n", side.label)
+		fns := make([]uint32, 0, len(side.only))
+		for fn := range side.only {
+			fns = append(fns, fn)
+		}
+		sort.Slice(fns, func(i, j int) bool { return fns[i] < fns[j] })
+		for _, fn := range fns {
+			fmt.Fprintf(&b, "  %s:", funcName(fn, name))
+			for _, off := range side.only[fn] {
+				fmt.Fprintf(&b, " 0x%x", off)
+			}
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,148 @@
+package trace
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/0xInception/wasmspy/pkg/interp"
+)
+
+// The file format is the magic "WSTR", a version byte, the module hash and
+// the event count, followed by one record per event: a kind byte and
+// varint fields. Instructions store the signed delta from the previous
+// instruction offset; calls, returns and host calls store the function
+// index; loads and stores store address and size. The function of
+// instructions and memory accesses and the offset of memory accesses are
+// implied by the surrounding records and rebuilt on reading.
+var magic = [4]byte{'W', 'S', 'T', 'R'}
+
+const formatVersion = 1
+
+func Write(w io.Writer, t *Trace) error {
+	bw := bufio.NewWriter(w)
+	bw.Write(magic[:])
+	bw.WriteByte(formatVersion)
+	bw.Write(t.ModuleHash[:])
+
+	buf := make([]byte, 0, 2*binary.MaxVarintLen64+1)
+	buf = binary.AppendUvarint(buf, uint64(len(t.Events)))
+	bw.Write(buf)
+
+	var last uint64
+	for _, ev := range t.Events {
+		buf = append(buf[:0], byte(ev.Kind))
+		switch ev.Kind {
+		case interp.EventInstr:
+			buf = binary.AppendVarint(buf, int64(ev.Offset-last))
+			last = ev.Offset
+		case interp.EventCall, interp.EventReturn, interp.EventHostCall:
+			buf = binary.AppendUvarint(buf, uint64(ev.Func))
+		case interp.EventLoad, interp.EventStore:
+			buf = binary.AppendUvarint(buf, ev.Addr)
+			buf = binary.AppendUvarint(buf, ev.Size)
+		default:
+			return fmt.Errorf("unknown event kind %d", ev.Kind)
+		}
+		if _, err := bw.Write(buf); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func Read(r io.Reader) (*Trace, error) {
+	br := bufio.NewReader(r)
+	var header [4 + 1 + 32]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return nil, fmt.Errorf("reading trace header: %w", err)
+	}
+	if [4]byte(header[:4]) != magic {
+		return nil, errors.New("not a trace file")
+	}
+	if header[4] != formatVersion {
+		return nil, fmt.Errorf("unsupported trace version %d", header[4])
+	}
+	t := &Trace{ModuleHash: [32]byte(header[5:])}
+
+	count, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, fmt.Errorf("reading event count: %w", err)
+	}
+
+	var stack []uint32
+	var last uint64
+	current := func() uint32 {
+		if len(stack) == 0 {
+			return 0
+		}
+		return stack[len(stack)-1]
+	}
+
+	for i := uint64(0); i < count; i++ {
+		kind, err := br.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("event %d: %w", i, err)
+		}
+		ev := interp.Event{Kind: interp.EventKind(kind)}
+		switch ev.Kind {
+		case interp.EventInstr:
+			delta, err := binary.ReadVarint(br)
+			if err != nil {
+				return nil, fmt.Errorf("event %d: %w", i, err)
+			}
+			last += uint64(delta)
+			ev.Func, ev.Offset = current(), last
+		case interp.EventCall, interp.EventReturn, interp.EventHostCall:
+			fn, err := binary.ReadUvarint(br)
+			if err != nil {
+				return nil, fmt.Errorf("event %d: %w", i, err)
+			}
+			ev.Func = uint32(fn)
+			switch ev.Kind {
+			case interp.EventCall:
+				stack = append(stack, ev.Func)
+			case interp.EventReturn:
+				if len(stack) > 0 {
+					stack = stack[:len(stack)-1]
+				}
+			}
+		case interp.EventLoad, interp.EventStore:
+			if ev.Addr, err = binary.ReadUvarint(br); err == nil {
+				ev.Size, err = binary.ReadUvarint(br)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("event %d: %w", i, err)
+			}
+			ev.Func, ev.Offset = current(), last
+		default:
+			return nil, fmt.Errorf("event %d: unknown kind %d", i, kind)
+		}
+		t.Events = append(t.Events, ev)
+	}
+	return t, nil
+}
+
+func WriteFile(path string, t *Trace) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := Write(f, t); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func ReadFile(path string) (*Trace, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
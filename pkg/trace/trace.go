@@ -0,0 +1,93 @@
+// Package trace records interpreter executions, stores them in a compact
+// file format and derives coverage and differences from them.
+package trace
+
+import (
+	"crypto/sha256"
+	"sort"
+
+	"github.com/0xInception/wasmspy/pkg/interp"
+)
+
+// Trace is the ordered event stream of one execution. ModuleHash is the
+// SHA-256 of the module file the trace was recorded against.
+type Trace struct {
+	ModuleHash [32]byte
+	Events     []interp.Event
+}
+
+// HashModule returns the hash identifying module file data in a trace.
+func HashModule(data []byte) [32]byte {
+	return sha256.Sum256(data)
+}
+
+// Recorder collects events from an instance. Install it with
+//
+//	inst.Tracer = rec.Record
+type Recorder struct {
+	Trace *Trace
+	// Limit, when non-zero, caps the number of recorded events; later
+	// events are counted in Dropped.
+	Limit   int
+	Dropped int
+}
+
+func NewRecorder(moduleData []byte) *Recorder {
+	return &Recorder{Trace: &Trace{ModuleHash: HashModule(moduleData)}}
+}
+
+func (r *Recorder) Record(ev interp.Event) {
+	if r.Limit > 0 && len(r.Trace.Events) >= r.Limit {
+		r.Dropped++
+		return
+	}
+	r.Trace.Events = append(r.Trace.Events, ev)
+}
+
+// Coverage counts how often each instruction executed, keyed by function
+// index and instruction offset.
+type Coverage struct {
+	Funcs map[uint32]map[uint64]uint64
+}
+
+func (t *Trace) Coverage() *Coverage {
+	c := &Coverage{Funcs: make(map[uint32]map[uint64]uint64)}
+	for _, ev := range t.Events {
+		if ev.Kind != interp.EventInstr {
+			continue
+		}
+		hits := c.Funcs[ev.Func]
+		if hits == nil {
+			hits = make(map[uint64]uint64)
+			c.Funcs[ev.Func] = hits
+		}
+		hits[ev.Offset]++
+	}
+	return c
+}
+
+// Offsets returns the executed instruction offsets of fn in order.
+func (c *Coverage) Offsets(fn uint32) []uint64 {
+	hits := c.Funcs[fn]
+	offsets := make([]uint64, 0, len(hits))
+	for off := range hits {
+		offsets = append(offsets, off)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	return offsets
+}
+
+// Hits returns how often the instruction at offset in fn executed.
+func (c *Coverage) Hits(fn uint32, offset uint64) uint64 {
+	return c.Funcs[fn][offset]
+}
+
+// FuncIndices returns the functions with any coverage in order.
+func (c *Coverage) FuncIndices() []uint32 {
+	indices := make([]uint32, 0, len(c.Funcs))
+	for idx := range c.Funcs {
+		indices = append(indices, idx)
+	}
+	sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+	return indices
+}
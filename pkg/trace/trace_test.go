@@ -0,0 +1,90 @@
+package trace
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/0xInception/wasmspy/pkg/interp"
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+func record(t *testing.T, name string, fn string, args ...uint64) *Trace {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("..", "..", "tests", "testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mod, err := wasm.Parse(data)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	rm, err := wasm.Resolve(mod)
+	if err != nil {
+		t.Fatalf("resolve error: %v", err)
+	}
+	inst, err := interp.Instantiate(rm, nil)
+	if err != nil {
+		t.Fatalf("instantiate: %v", err)
+	}
+	rec := NewRecorder(data)
+	inst.Tracer = rec.Record
+	if _, err := inst.Call(fn, args...); err != nil {
+		t.Fatalf("%s: %v", fn, err)
+	}
+	return rec.Trace
+}
+
+func TestRoundTrip(t *testing.T) {
+	tr := record(t, "control_flow.wasm", "sum_to_n", 3)
+	tr.Events = append(tr.Events, record(t, "control_flow.wasm", "store_value", 8, 1).Events...)
+
+	var buf bytes.Buffer
+	if err := Write(&buf, tr); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	got, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if got.ModuleHash != tr.ModuleHash || len(got.Events) != len(tr.Events) {
+		t.Fatalf("header mismatch: %d events, want %d", len(got.Events), len(tr.Events))
+	}
+	for i := range tr.Events {
+		if got.Events[i] != tr.Events[i] {
+			t.Fatalf("event %d: got %+v, want %+v", i, got.Events[i], tr.Events[i])
+		}
+	}
+
+	var stores int
+	for _, ev := range got.Events {
+		if ev.Kind == interp.EventStore && ev.Addr == 8 && ev.Size == 4 {
+			stores++
+		}
+	}
+	if stores != 1 {
+		t.Errorf("expected one 4-byte store at 8, got %d", stores)
+	}
+}
+
+func TestCoverageAndDiff(t *testing.T) {
+	a := record(t, "control_flow.wasm", "abs", interp.I32(-1))
+	b := record(t, "control_flow.wasm", "abs", 1)
+
+	cov := a.Coverage()
+	if len(cov.FuncIndices()) != 1 || len(cov.Offsets(0)) == 0 {
+		t.Fatalf("unexpected coverage %v", cov.Funcs)
+	}
+
+	d := Compare(a, b)
+	if d.Identical() || d.Divergence < 0 {
+		t.Fatalf("expected divergence")
+	}
+	if len(d.OnlyA[0]) == 0 || len(d.OnlyB[0]) == 0 {
+		t.Errorf("expected branch-specific coverage, got %v / %v", d.OnlyA, d.OnlyB)
+	}
+	if !Compare(a, a).Identical() {
+		t.Errorf("trace differs from itself")
+	}
+}
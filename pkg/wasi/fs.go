@@ -0,0 +1,446 @@
+package wasi
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/0xInception/wasmspy/pkg/interp"
+)
+
+type fdKind int
+
+const (
+	fdStdin fdKind = iota
+	fdStdout
+	fdStderr
+	fdDir
+	fdFile
+)
+
+const (
+	filetypeUnknown     = 0
+	filetypeCharDevice  = 2
+	filetypeDirectory   = 3
+	filetypeRegularFile = 4
+)
+
+const (
+	oflagCreat     = 1 << 0
+	oflagDirectory = 1 << 1
+	oflagExcl      = 1 << 2
+	oflagTrunc     = 1 << 3
+
+	fdflagAppend = 1 << 0
+
+	rightFdRead  = 1 << 1
+	rightFdWrite = 1 << 6
+	allRights    = 1<<30 - 1
+)
+
+// fileDesc is an entry of the guest's file descriptor table. Directories
+// are held as an os.Root, which confines every lookup to the directory
+// tree, symlinks included.
+type fileDesc struct {
+	kind fdKind
+	file *os.File
+	root *os.Root
+	// guest is the preopened name of a preopen directory, and empty for
+	// directories opened through path_open.
+	guest string
+}
+
+func (fd *fileDesc) close() {
+	if fd.file != nil {
+		fd.file.Close()
+	}
+	if fd.root != nil {
+		fd.root.Close()
+	}
+}
+
+func openPreopen(p Preopen) (*fileDesc, error) {
+	root, err := os.OpenRoot(p.HostPath)
+	if err != nil {
+		return nil, err
+	}
+	guest := p.GuestPath
+	if guest == "" {
+		guest = "/"
+	}
+	return &fileDesc{kind: fdDir, root: root, guest: guest}, nil
+}
+
+func errnoOf(err error) Errno {
+	switch {
+	case err == nil:
+		return ErrnoSuccess
+	case errors.Is(err, fs.ErrNotExist):
+		return ErrnoNoent
+	case errors.Is(err, fs.ErrExist):
+		return ErrnoExist
+	case errors.Is(err, fs.ErrPermission):
+		return ErrnoAcces
+	case strings.Contains(err.Error(), "escapes"):
+		return ErrnoNotcapable
+	}
+	return ErrnoIO
+}
+
+// iovecs walks the (buf, len) pairs of an iovec array.
+func iovecs(mem *interp.Memory, ptr, count uint32, fn func(b []byte) (int, error)) (uint32, Errno) {
+	var total uint32
+	for i := uint32(0); i < count; i++ {
+		base, ok1 := mem.ReadUint32(ptr + i*8)
+		n, ok2 := mem.ReadUint32(ptr + i*8 + 4)
+		if !ok1 || !ok2 {
+			return total, ErrnoFault
+		}
+		buf, ok := mem.Read(base, n)
+		if !ok {
+			return total, ErrnoFault
+		}
+		done, err := fn(buf)
+		total += uint32(done)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return total, errnoOf(err)
+		}
+		if done < len(buf) {
+			break
+		}
+	}
+	return total, ErrnoSuccess
+}
+
+func (h *Host) fd(n uint64) *fileDesc {
+	return h.fds[uint32(n)]
+}
+
+func (h *Host) writer(fd *fileDesc) io.Writer {
+	switch fd.kind {
+	case fdStdout:
+		if h.cfg.Stdout != nil {
+			return io.MultiWriter(&h.stdout, h.cfg.Stdout)
+		}
+		return &h.stdout
+	case fdStderr:
+		if h.cfg.Stderr != nil {
+			return io.MultiWriter(&h.stderr, h.cfg.Stderr)
+		}
+		return &h.stderr
+	case fdFile:
+		return fd.file
+	}
+	return nil
+}
+
+func fdWrite(h *Host, mem *interp.Memory, args []uint64) Errno {
+	fd := h.fd(args[0])
+	if fd == nil {
+		return ErrnoBadf
+	}
+	w := h.writer(fd)
+	if w == nil {
+		return ErrnoBadf
+	}
+	n, errno := iovecs(mem, uint32(args[1]), uint32(args[2]), w.Write)
+	if errno != ErrnoSuccess {
+		return errno
+	}
+	if !mem.WriteUint32(uint32(args[3]), n) {
+		return ErrnoFault
+	}
+	return ErrnoSuccess
+}
+
+func fdRead(h *Host, mem *interp.Memory, args []uint64) Errno {
+	fd := h.fd(args[0])
+	if fd == nil {
+		return ErrnoBadf
+	}
+	var r io.Reader
+	switch fd.kind {
+	case fdStdin:
+		r = h.cfg.Stdin
+	case fdFile:
+		r = fd.file
+	default:
+		return ErrnoBadf
+	}
+	n, errno := iovecs(mem, uint32(args[1]), uint32(args[2]), r.Read)
+	if errno != ErrnoSuccess {
+		return errno
+	}
+	if !mem.WriteUint32(uint32(args[3]), n) {
+		return ErrnoFault
+	}
+	return ErrnoSuccess
+}
+
+func fdClose(h *Host, mem *interp.Memory, args []uint64) Errno {
+	fd := h.fd(args[0])
+	if fd == nil {
+		return ErrnoBadf
+	}
+	fd.close()
+	delete(h.fds, uint32(args[0]))
+	return ErrnoSuccess
+}
+
+func seek(h *Host, fdNum uint64, offset int64, whence int) (int64, Errno) {
+	fd := h.fd(fdNum)
+	if fd == nil {
+		return 0, ErrnoBadf
+	}
+	if fd.kind != fdFile {
+		return 0, ErrnoSpipe
+	}
+	pos, err := fd.file.Seek(offset, whence)
+	if err != nil {
+		return 0, ErrnoInval
+	}
+	return pos, ErrnoSuccess
+}
+
+func fdSeek(h *Host, mem *interp.Memory, args []uint64) Errno {
+	whence := int(uint32(args[2]))
+	if whence > io.SeekEnd {
+		return ErrnoInval
+	}
+	pos, errno := seek(h, args[0], int64(args[1]), whence)
+	if errno != ErrnoSuccess {
+		return errno
+	}
+	if !mem.WriteUint64(uint32(args[3]), uint64(pos)) {
+		return ErrnoFault
+	}
+	return ErrnoSuccess
+}
+
+func fdTell(h *Host, mem *interp.Memory, args []uint64) Errno {
+	pos, errno := seek(h, args[0], 0, io.SeekCurrent)
+	if errno != ErrnoSuccess {
+		return errno
+	}
+	if !mem.WriteUint64(uint32(args[1]), uint64(pos)) {
+		return ErrnoFault
+	}
+	return ErrnoSuccess
+}
+
+func (fd *fileDesc) filetype() byte {
+	switch fd.kind {
+	case fdStdin, fdStdout, fdStderr:
+		return filetypeCharDevice
+	case fdDir:
+		return filetypeDirectory
+	case fdFile:
+		return filetypeRegularFile
+	}
+	return filetypeUnknown
+}
+
+// fdstat layout: filetype u8, flags u16 at 2, rights base and inheriting
+// u64 at 8 and 16.
+func fdFdstatGet(h *Host, mem *interp.Memory, args []uint64) Errno {
+	fd := h.fd(args[0])
+	if fd == nil {
+		return ErrnoBadf
+	}
+	buf, ok := mem.Read(uint32(args[1]), 24)
+	if !ok {
+		return ErrnoFault
+	}
+	clear(buf)
+	buf[0] = fd.filetype()
+	ptr := uint32(args[1])
+	mem.WriteUint64(ptr+8, allRights)
+	mem.WriteUint64(ptr+16, allRights)
+	return ErrnoSuccess
+}
+
+// writeFilestat stores a filestat: dev, ino, filetype at 16, nlink, size at
+// 32 and the three timestamps.
+func writeFilestat(mem *interp.Memory, ptr uint32, ft byte, info fs.FileInfo) Errno {
+	buf, ok := mem.Read(ptr, 64)
+	if !ok {
+		return ErrnoFault
+	}
+	clear(buf)
+	buf[16] = ft
+	mem.WriteUint64(ptr+24, 1)
+	if info != nil {
+		mem.WriteUint64(ptr+32, uint64(info.Size()))
+		ts := uint64(info.ModTime().UnixNano())
+		mem.WriteUint64(ptr+40, ts)
+		mem.WriteUint64(ptr+48, ts)
+		mem.WriteUint64(ptr+56, ts)
+	}
+	return ErrnoSuccess
+}
+
+func fileInfoType(info fs.FileInfo) byte {
+	switch {
+	case info.IsDir():
+		return filetypeDirectory
+	case info.Mode().IsRegular():
+		return filetypeRegularFile
+	}
+	return filetypeUnknown
+}
+
+func fdFilestatGet(h *Host, mem *interp.Memory, args []uint64) Errno {
+	fd := h.fd(args[0])
+	if fd == nil {
+		return ErrnoBadf
+	}
+	var info fs.FileInfo
+	var err error
+	switch fd.kind {
+	case fdFile:
+		info, err = fd.file.Stat()
+	case fdDir:
+		info, err = fd.root.Stat(".")
+	}
+	if err != nil {
+		return errnoOf(err)
+	}
+	return writeFilestat(mem, uint32(args[1]), fd.filetype(), info)
+}
+
+func fdPrestatGet(h *Host, mem *interp.Memory, args []uint64) Errno {
+	fd := h.fd(args[0])
+	if fd == nil || fd.guest == "" {
+		return ErrnoBadf
+	}
+	ptr := uint32(args[1])
+	if !mem.WriteUint32(ptr, 0) || !mem.WriteUint32(ptr+4, uint32(len(fd.guest))) {
+		return ErrnoFault
+	}
+	return ErrnoSuccess
+}
+
+func fdPrestatDirName(h *Host, mem *interp.Memory, args []uint64) Errno {
+	fd := h.fd(args[0])
+	if fd == nil || fd.guest == "" {
+		return ErrnoBadf
+	}
+	if uint32(args[2]) < uint32(len(fd.guest)) {
+		return ErrnoInval
+	}
+	if !mem.Write(uint32(args[1]), []byte(fd.guest)) {
+		return ErrnoFault
+	}
+	return ErrnoSuccess
+}
+
+// guestPath reads a path argument and makes it relative to its directory
+// descriptor. Absolute paths and paths climbing out of the directory are
+// refused before the host is consulted; os.Root catches symlinks.
+func guestPath(h *Host, mem *interp.Memory, dirArg, ptrArg, lenArg uint64) (*fileDesc, string, Errno) {
+	dir := h.fd(dirArg)
+	if dir == nil {
+		return nil, "", ErrnoBadf
+	}
+	if dir.kind != fdDir {
+		return nil, "", ErrnoNotdir
+	}
+	p, ok := mem.ReadString(uint32(ptrArg), uint32(lenArg))
+	if !ok {
+		return nil, "", ErrnoFault
+	}
+	if strings.HasPrefix(p, "/") {
+		return nil, "", ErrnoNotcapable
+	}
+	p = path.Clean(p)
+	if p == ".." || strings.HasPrefix(p, "../") {
+		return nil, "", ErrnoNotcapable
+	}
+	return dir, p, ErrnoSuccess
+}
+
+// path_open(dirfd, dirflags, path, path_len, oflags, rights_base,
+// rights_inheriting, fdflags, fd_ptr)
+func pathOpen(h *Host, mem *interp.Memory, args []uint64) Errno {
+	dir, p, errno := guestPath(h, mem, args[0], args[2], args[3])
+	if errno != ErrnoSuccess {
+		return errno
+	}
+	oflags := uint32(args[4])
+	rights := args[5]
+	fdflags := uint32(args[7])
+
+	var fd *fileDesc
+	if oflags&oflagDirectory != 0 {
+		root, err := dir.root.OpenRoot(p)
+		if err != nil {
+			return errnoOf(err)
+		}
+		fd = &fileDesc{kind: fdDir, root: root}
+	} else {
+		flag := os.O_RDONLY
+		if rights&rightFdWrite != 0 {
+			flag = os.O_RDWR
+			if rights&rightFdRead == 0 {
+				flag = os.O_WRONLY
+			}
+		}
+		if oflags&oflagCreat != 0 {
+			flag |= os.O_CREATE
+		}
+		if oflags&oflagExcl != 0 {
+			flag |= os.O_EXCL
+		}
+		if oflags&oflagTrunc != 0 {
+			flag |= os.O_TRUNC
+		}
+		if fdflags&fdflagAppend != 0 {
+			flag |= os.O_APPEND
+		}
+		f, err := dir.root.OpenFile(p, flag, 0o644)
+		if err != nil {
+			return errnoOf(err)
+		}
+		if info, err := f.Stat(); err == nil && info.IsDir() {
+			// Directories opened without O_DIRECTORY still need a root
+			// for further lookups.
+			f.Close()
+			root, err := dir.root.OpenRoot(p)
+			if err != nil {
+				return errnoOf(err)
+			}
+			fd = &fileDesc{kind: fdDir, root: root}
+		} else {
+			fd = &fileDesc{kind: fdFile, file: f}
+		}
+	}
+
+	n := h.nextFD
+	h.nextFD++
+	h.fds[n] = fd
+	if !mem.WriteUint32(uint32(args[8]), n) {
+		fd.close()
+		delete(h.fds, n)
+		return ErrnoFault
+	}
+	return ErrnoSuccess
+}
+
+// path_filestat_get(dirfd, lookupflags, path, path_len, buf)
+func pathFilestatGet(h *Host, mem *interp.Memory, args []uint64) Errno {
+	dir, p, errno := guestPath(h, mem, args[0], args[2], args[3])
+	if errno != ErrnoSuccess {
+		return errno
+	}
+	info, err := dir.root.Stat(p)
+	if err != nil {
+		return errnoOf(err)
+	}
+	return writeFilestat(mem, uint32(args[4]), fileInfoType(info), info)
+}
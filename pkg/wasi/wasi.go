@@ -0,0 +1,321 @@
+// Package wasi implements the wasi_snapshot_preview1 host functions on top
+// of the interp package, so WASI command modules can be run locally.
+//
+// Standard output and error are always captured. The filesystem is denied by
+// default: guests can only reach host directories that are explicitly
+// preopened, and paths cannot escape them.
+package wasi
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/0xInception/wasmspy/pkg/interp"
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+const ModuleName = "wasi_snapshot_preview1"
+
+// Errno is a WASI error number.
+type Errno uint32
+
+const (
+	ErrnoSuccess    Errno = 0
+	ErrnoAcces      Errno = 2
+	ErrnoBadf       Errno = 8
+	ErrnoExist      Errno = 20
+	ErrnoFault      Errno = 21
+	ErrnoInval      Errno = 28
+	ErrnoIO         Errno = 29
+	ErrnoIsdir      Errno = 31
+	ErrnoNoent      Errno = 44
+	ErrnoNosys      Errno = 52
+	ErrnoNotdir     Errno = 54
+	ErrnoSpipe      Errno = 70
+	ErrnoNotcapable Errno = 76
+)
+
+// ExitError is returned from a call when the guest invokes proc_exit.
+type ExitError struct {
+	Code uint32
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// Preopen maps a host directory into the guest under GuestPath.
+type Preopen struct {
+	HostPath  string
+	GuestPath string
+}
+
+type Config struct {
+	// Args is the guest's argv, including the program name.
+	Args []string
+	// Env holds KEY=VALUE entries.
+	Env []string
+
+	Stdin io.Reader
+	// Stdout and Stderr, when set, receive output as it is written in
+	// addition to the captured copy.
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Dirs lists the directories the guest may access. With none, every
+	// path operation fails.
+	Dirs []Preopen
+
+	// Now and Rand default to the host clock and crypto/rand. Tests and
+	// reproducible runs can replace them.
+	Now  func() time.Time
+	Rand io.Reader
+}
+
+// Host holds the state of one WASI process: its file descriptor table and
+// captured output.
+type Host struct {
+	cfg    Config
+	start  time.Time
+	stdout bytes.Buffer
+	stderr bytes.Buffer
+	fds    map[uint32]*fileDesc
+	nextFD uint32
+}
+
+// New creates a host for cfg, opening its preopened directories.
+func New(cfg Config) (*Host, error) {
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	if cfg.Rand == nil {
+		cfg.Rand = rand.Reader
+	}
+	if cfg.Stdin == nil {
+		cfg.Stdin = bytes.NewReader(nil)
+	}
+
+	h := &Host{cfg: cfg, start: cfg.Now(), fds: make(map[uint32]*fileDesc)}
+	h.fds[0] = &fileDesc{kind: fdStdin}
+	h.fds[1] = &fileDesc{kind: fdStdout}
+	h.fds[2] = &fileDesc{kind: fdStderr}
+	h.nextFD = 3
+	for _, d := range cfg.Dirs {
+		fd, err := openPreopen(d)
+		if err != nil {
+			h.Close()
+			return nil, err
+		}
+		h.fds[h.nextFD] = fd
+		h.nextFD++
+	}
+	return h, nil
+}
+
+// Close releases every open file descriptor.
+func (h *Host) Close() {
+	for n, fd := range h.fds {
+		fd.close()
+		delete(h.fds, n)
+	}
+}
+
+// Stdout returns everything the guest has written to file descriptor 1.
+func (h *Host) Stdout() []byte {
+	return h.stdout.Bytes()
+}
+
+// Stderr returns everything the guest has written to file descriptor 2.
+func (h *Host) Stderr() []byte {
+	return h.stderr.Bytes()
+}
+
+// Imports reports whether rm imports anything from the WASI module.
+func Imports(rm *wasm.ResolvedModule) bool {
+	for _, imp := range rm.Imports {
+		if imp.Module == ModuleName {
+			return true
+		}
+	}
+	return false
+}
+
+type hostFunc func(h *Host, mem *interp.Memory, args []uint64) Errno
+
+var funcs = map[string]hostFunc{
+	"args_get":              argsGet,
+	"args_sizes_get":        argsSizesGet,
+	"environ_get":           environGet,
+	"environ_sizes_get":     environSizesGet,
+	"clock_res_get":         clockResGet,
+	"clock_time_get":        clockTimeGet,
+	"random_get":            randomGet,
+	"sched_yield":           func(*Host, *interp.Memory, []uint64) Errno { return ErrnoSuccess },
+	"fd_read":               fdRead,
+	"fd_write":              fdWrite,
+	"fd_close":              fdClose,
+	"fd_seek":               fdSeek,
+	"fd_tell":               fdTell,
+	"fd_fdstat_get":         fdFdstatGet,
+	"fd_filestat_get":       fdFilestatGet,
+	"fd_prestat_get":        fdPrestatGet,
+	"fd_prestat_dir_name":   fdPrestatDirName,
+	"path_open":             pathOpen,
+	"path_filestat_get":     pathFilestatGet,
+	"fd_fdstat_set_flags":   nosys,
+	"fd_readdir":            nosys,
+	"fd_sync":               nosys,
+	"fd_datasync":           nosys,
+	"fd_advise":             nosys,
+	"fd_allocate":           nosys,
+	"fd_pread":              nosys,
+	"fd_pwrite":             nosys,
+	"fd_renumber":           nosys,
+	"fd_filestat_set_size":  nosys,
+	"path_create_directory": nosys,
+	"path_remove_directory": nosys,
+	"path_unlink_file":      nosys,
+	"path_rename":           nosys,
+	"path_readlink":         nosys,
+	"path_symlink":          nosys,
+	"path_link":             nosys,
+	"poll_oneoff":           nosys,
+	"proc_raise":            nosys,
+	"sock_accept":           nosys,
+	"sock_recv":             nosys,
+	"sock_send":             nosys,
+	"sock_shutdown":         nosys,
+}
+
+func nosys(*Host, *interp.Memory, []uint64) Errno {
+	return ErrnoNosys
+}
+
+// Register adds the WASI functions to imports. Calls that need guest memory
+// use the calling instance's memory 0.
+func (h *Host) Register(imports *interp.Imports) {
+	for name, fn := range funcs {
+		imports.AddFunc(ModuleName, name, h.wrap(fn))
+	}
+	imports.AddFunc(ModuleName, "proc_exit", func(_ *interp.Instance, args []uint64) ([]uint64, error) {
+		return nil, &ExitError{Code: uint32(args[0])}
+	})
+}
+
+func (h *Host) wrap(fn hostFunc) interp.HostFunc {
+	return func(inst *interp.Instance, args []uint64) ([]uint64, error) {
+		mem := inst.Memory()
+		if mem == nil {
+			return []uint64{uint64(ErrnoFault)}, nil
+		}
+		return []uint64{uint64(fn(h, mem, args))}, nil
+	}
+}
+
+// RunStart calls the _start export of inst and returns the guest's exit
+// code. Returning from _start without calling proc_exit exits with 0.
+func RunStart(inst *interp.Instance) (uint32, error) {
+	_, err := inst.Call("_start")
+	if exit, ok := err.(*ExitError); ok {
+		return exit.Code, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
+
+// stringsSizes returns the count and total NUL-terminated size of list.
+func stringsSizes(list []string) (uint32, uint32) {
+	var size uint32
+	for _, s := range list {
+		size += uint32(len(s)) + 1
+	}
+	return uint32(len(list)), size
+}
+
+// writeStrings lays list out as NUL-terminated strings at buf and stores
+// their addresses in the pointer array at ptrs.
+func writeStrings(mem *interp.Memory, list []string, ptrs, buf uint32) Errno {
+	for i, s := range list {
+		if !mem.WriteUint32(ptrs+uint32(i)*4, buf) {
+			return ErrnoFault
+		}
+		if !mem.Write(buf, append([]byte(s), 0)) {
+			return ErrnoFault
+		}
+		buf += uint32(len(s)) + 1
+	}
+	return ErrnoSuccess
+}
+
+func writeSizes(mem *interp.Memory, list []string, countPtr, sizePtr uint32) Errno {
+	count, size := stringsSizes(list)
+	if !mem.WriteUint32(countPtr, count) || !mem.WriteUint32(sizePtr, size) {
+		return ErrnoFault
+	}
+	return ErrnoSuccess
+}
+
+func argsGet(h *Host, mem *interp.Memory, args []uint64) Errno {
+	return writeStrings(mem, h.cfg.Args, uint32(args[0]), uint32(args[1]))
+}
+
+func argsSizesGet(h *Host, mem *interp.Memory, args []uint64) Errno {
+	return writeSizes(mem, h.cfg.Args, uint32(args[0]), uint32(args[1]))
+}
+
+func environGet(h *Host, mem *interp.Memory, args []uint64) Errno {
+	return writeStrings(mem, h.cfg.Env, uint32(args[0]), uint32(args[1]))
+}
+
+func environSizesGet(h *Host, mem *interp.Memory, args []uint64) Errno {
+	return writeSizes(mem, h.cfg.Env, uint32(args[0]), uint32(args[1]))
+}
+
+const (
+	clockRealtime = iota
+	clockMonotonic
+	clockProcessCPUTime
+	clockThreadCPUTime
+)
+
+func clockResGet(h *Host, mem *interp.Memory, args []uint64) Errno {
+	if uint32(args[0]) > clockThreadCPUTime {
+		return ErrnoInval
+	}
+	if !mem.WriteUint64(uint32(args[1]), 1000) {
+		return ErrnoFault
+	}
+	return ErrnoSuccess
+}
+
+func clockTimeGet(h *Host, mem *interp.Memory, args []uint64) Errno {
+	var ns uint64
+	switch uint32(args[0]) {
+	case clockRealtime:
+		ns = uint64(h.cfg.Now().UnixNano())
+	case clockMonotonic, clockProcessCPUTime, clockThreadCPUTime:
+		ns = uint64(h.cfg.Now().Sub(h.start).Nanoseconds())
+	default:
+		return ErrnoInval
+	}
+	if !mem.WriteUint64(uint32(args[2]), ns) {
+		return ErrnoFault
+	}
+	return ErrnoSuccess
+}
+
+func randomGet(h *Host, mem *interp.Memory, args []uint64) Errno {
+	buf, ok := mem.Read(uint32(args[0]), uint32(args[1]))
+	if !ok {
+		return ErrnoFault
+	}
+	if _, err := io.ReadFull(h.cfg.Rand, buf); err != nil {
+		return ErrnoIO
+	}
+	return ErrnoSuccess
+}
@@ -0,0 +1,166 @@
+package wasi
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/0xInception/wasmspy/internal/wasmtest"
+	"github.com/0xInception/wasmspy/pkg/interp"
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+// helloModule writes "hi\n" to stdout through fd_write and exits with 3.
+func helloModule(t *testing.T) *wasm.ResolvedModule {
+	t.Helper()
+	imports := wasmtest.Cat([]byte{0x02},
+		wasmtest.Name(ModuleName), wasmtest.Name("fd_write"), []byte{0x00, 0x00},
+		wasmtest.Name(ModuleName), wasmtest.Name("proc_exit"), []byte{0x00, 0x01})
+	exports := wasmtest.Cat([]byte{0x02},
+		wasmtest.Name("_start"), []byte{0x00, 0x02},
+		wasmtest.Name("memory"), []byte{0x02, 0x00})
+	seg := []byte{16, 0, 0, 0, 3, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 'h', 'i', '\n'}
+
+	return wasmtest.Module(t,
+		wasmtest.Section(0x01,
+			0x03,
+			0x60, 0x04, 0x7f, 0x7f, 0x7f, 0x7f, 0x01, 0x7f,
+			0x60, 0x01, 0x7f, 0x00,
+			0x60, 0x00, 0x00),
+		wasmtest.Section(0x02, imports...),
+		wasmtest.Section(0x03, 0x01, 0x02),
+		wasmtest.Section(0x05, 0x01, 0x00, 0x01),
+		wasmtest.Section(0x07, exports...),
+		wasmtest.Code(wasmtest.Body(0x00,
+			0x41, 0x01, 0x41, 0x00, 0x41, 0x01, 0x41, 0x08, 0x10, 0x00, 0x1a,
+			0x41, 0x03, 0x10, 0x01, 0x0b)),
+		wasmtest.Section(0x0b, wasmtest.Cat([]byte{0x01, 0x00, 0x41, 0x00, 0x0b, byte(len(seg))}, seg)...),
+	)
+}
+
+func TestRunStart(t *testing.T) {
+	rm := helloModule(t)
+	if !Imports(rm) {
+		t.Fatal("expected module to import WASI")
+	}
+
+	h, err := New(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	imports := interp.NewImports()
+	h.Register(imports)
+
+	inst, err := interp.Instantiate(rm, imports)
+	if err != nil {
+		t.Fatalf("instantiate: %v", err)
+	}
+	code, err := RunStart(inst)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if code != 3 {
+		t.Errorf("exit code %d, want 3", code)
+	}
+	if got := string(h.Stdout()); got != "hi\n" {
+		t.Errorf("stdout %q", got)
+	}
+}
+
+func testMemory() *interp.Memory {
+	return interp.NewMemory(wasm.Limits{Min: 1})
+}
+
+func TestArgsAndClock(t *testing.T) {
+	now := time.Unix(100, 0)
+	h, err := New(Config{Args: []string{"prog", "x"}, Now: func() time.Time { return now }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := testMemory()
+
+	if e := argsSizesGet(h, mem, []uint64{0, 4}); e != ErrnoSuccess {
+		t.Fatalf("args_sizes_get: %d", e)
+	}
+	count, _ := mem.ReadUint32(0)
+	size, _ := mem.ReadUint32(4)
+	if count != 2 || size != 7 {
+		t.Errorf("args sizes %d, %d", count, size)
+	}
+	if e := argsGet(h, mem, []uint64{16, 64}); e != ErrnoSuccess {
+		t.Fatalf("args_get: %d", e)
+	}
+	ptr, _ := mem.ReadUint32(20)
+	if s, _ := mem.ReadCString(ptr); s != "x" {
+		t.Errorf("argv[1] = %q", s)
+	}
+
+	if e := clockTimeGet(h, mem, []uint64{0, 0, 128}); e != ErrnoSuccess {
+		t.Fatalf("clock_time_get: %d", e)
+	}
+	if ns, _ := mem.ReadUint64(128); ns != uint64(now.UnixNano()) {
+		t.Errorf("realtime %d", ns)
+	}
+}
+
+func TestSandbox(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "in.txt"), []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(t.TempDir(), filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	open := func(h *Host, mem *interp.Memory, p string) Errno {
+		mem.Write(256, []byte(p))
+		return pathOpen(h, mem, []uint64{3, 0, 256, uint64(len(p)), 0, rightFdRead, 0, 0, 512})
+	}
+
+	h, err := New(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := testMemory()
+	if e := open(h, mem, "in.txt"); e != ErrnoBadf {
+		t.Errorf("open without preopen: %d", e)
+	}
+
+	h, err = New(Config{Dirs: []Preopen{{HostPath: dir, GuestPath: "/sandbox"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	if e := fdPrestatDirName(h, mem, []uint64{3, 0, 8}); e != ErrnoSuccess {
+		t.Fatalf("fd_prestat_dir_name: %d", e)
+	}
+	if s, _ := mem.ReadString(0, 8); s != "/sandbox" {
+		t.Errorf("preopen name %q", s)
+	}
+
+	for _, p := range []string{"../in.txt", "/etc/passwd", "a/../../x", "link/x"} {
+		if e := open(h, mem, p); e != ErrnoNotcapable {
+			t.Errorf("open %q: errno %d, want notcapable", p, e)
+		}
+	}
+	if e := open(h, mem, "missing"); e != ErrnoNoent {
+		t.Errorf("open missing: %d", e)
+	}
+
+	if e := open(h, mem, "in.txt"); e != ErrnoSuccess {
+		t.Fatalf("open in.txt: %d", e)
+	}
+	fd, _ := mem.ReadUint32(512)
+	mem.WriteUint32(0, 1024)
+	mem.WriteUint32(4, 16)
+	if e := fdRead(h, mem, []uint64{uint64(fd), 0, 1, 8}); e != ErrnoSuccess {
+		t.Fatalf("fd_read: %d", e)
+	}
+	n, _ := mem.ReadUint32(8)
+	if s, _ := mem.ReadString(1024, n); s != "data" {
+		t.Errorf("read %q", s)
+	}
+}
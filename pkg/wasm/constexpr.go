@@ -0,0 +1,219 @@
+package wasm
+
+import "math"
+
+// ConstValue is the result of evaluating a constant expression. Integer
+// values are stored zero-extended, floats as their IEEE-754 bit patterns and
+// function references as the function index.
+type ConstValue struct {
+	Type ValType
+	Bits uint64
+}
+
+func (v ConstValue) I32() int32 {
+	return int32(uint32(v.Bits))
+}
+
+func (v ConstValue) I64() int64 {
+	return int64(v.Bits)
+}
+
+func (v ConstValue) F32() float32 {
+	return math.Float32frombits(uint32(v.Bits))
+}
+
+func (v ConstValue) F64() float64 {
+	return math.Float64frombits(v.Bits)
+}
+
+// NullRef is the Bits value of a null reference.
+const NullRef = math.MaxUint64
+
+// EvalConstExpr evaluates a constant expression as used by global, data and
+// element initializers: numeric constants, global.get, ref.null, ref.func and
+// the extended-const i32/i64 add, sub and mul.
+//
+// globals supplies the values of the global index space. When it is nil,
+// global.get is resolved statically: immutable defined globals are evaluated
+// from their own initializers, while imported and mutable globals have no
+// static value and yield an error.
+func (rm *ResolvedModule) EvalConstExpr(expr []Instruction, globals []ConstValue) (ConstValue, error) {
+	return rm.evalConstExpr(expr, globals, nil)
+}
+
+func (rm *ResolvedModule) evalConstExpr(expr []Instruction, globals []ConstValue, visiting map[uint32]bool) (ConstValue, error) {
+	var stack []ConstValue
+
+	pop2 := func(instr *Instruction) (ConstValue, ConstValue, error) {
+		if len(stack) < 2 {
+			return ConstValue{}, ConstValue{}, newError(ErrInvalidConstExpr, int64(instr.Offset), "%s: stack underflow", instr.Name)
+		}
+		a, b := stack[len(stack)-2], stack[len(stack)-1]
+		stack = stack[:len(stack)-2]
+		return a, b, nil
+	}
+
+loop:
+	for i := range expr {
+		instr := &expr[i]
+		switch instr.Opcode {
+		case OpI32Const:
+			stack = append(stack, ConstValue{Type: ValI32, Bits: uint64(uint32(instr.I32()))})
+		case OpI64Const:
+			stack = append(stack, ConstValue{Type: ValI64, Bits: uint64(instr.I64())})
+		case OpF32Const, OpF64Const:
+			t := ValF32
+			if instr.Opcode == OpF64Const {
+				t = ValF64
+			}
+			stack = append(stack, ConstValue{Type: t, Bits: instr.Imm.Bits})
+		case OpRefNull:
+			stack = append(stack, ConstValue{Type: instr.HeapType(), Bits: NullRef})
+		case OpRefFunc:
+			stack = append(stack, ConstValue{Type: ValFuncRef, Bits: uint64(instr.Index())})
+
+		case OpGlobalGet:
+			v, err := rm.constGlobal(instr, globals, visiting)
+			if err != nil {
+				return ConstValue{}, err
+			}
+			stack = append(stack, v)
+
+		case OpI32Add, OpI32Sub, OpI32Mul:
+			a, b, err := pop2(instr)
+			if err != nil {
+				return ConstValue{}, err
+			}
+			x, y := uint32(a.Bits), uint32(b.Bits)
+			var r uint32
+			switch instr.Opcode {
+			case OpI32Add:
+				r = x + y
+			case OpI32Sub:
+				r = x - y
+			default:
+				r = x * y
+			}
+			stack = append(stack, ConstValue{Type: ValI32, Bits: uint64(r)})
+
+		case OpI64Add, OpI64Sub, OpI64Mul:
+			a, b, err := pop2(instr)
+			if err != nil {
+				return ConstValue{}, err
+			}
+			var r uint64
+			switch instr.Opcode {
+			case OpI64Add:
+				r = a.Bits + b.Bits
+			case OpI64Sub:
+				r = a.Bits - b.Bits
+			default:
+				r = a.Bits * b.Bits
+			}
+			stack = append(stack, ConstValue{Type: ValI64, Bits: r})
+
+		case OpEnd:
+			break loop
+
+		default:
+			return ConstValue{}, newError(ErrInvalidConstExpr, int64(instr.Offset), "%s is not a constant instruction", instr.Name)
+		}
+	}
+
+	if len(stack) != 1 {
+		var offset int64 = -1
+		if len(expr) > 0 {
+			offset = int64(expr[0].Offset)
+		}
+		return ConstValue{}, newError(ErrInvalidConstExpr, offset, "constant expression leaves %d values", len(stack))
+	}
+	return stack[0], nil
+}
+
+func (rm *ResolvedModule) constGlobal(instr *Instruction, globals []ConstValue, visiting map[uint32]bool) (ConstValue, error) {
+	idx := instr.Index()
+	if globals != nil {
+		if int(idx) >= len(globals) {
+			return ConstValue{}, newError(ErrInvalidConstExpr, int64(instr.Offset), "global %d out of range", idx)
+		}
+		return globals[idx], nil
+	}
+
+	numImported := rm.NumImportedGlobals()
+	if idx < numImported {
+		return ConstValue{}, newError(ErrInvalidConstExpr, int64(instr.Offset), "imported global %d has no static value", idx)
+	}
+	def := idx - numImported
+	if int(def) >= len(rm.Globals) {
+		return ConstValue{}, newError(ErrInvalidConstExpr, int64(instr.Offset), "global %d out of range", idx)
+	}
+	if rm.Globals[def].Type.Mutable {
+		return ConstValue{}, newError(ErrInvalidConstExpr, int64(instr.Offset), "global %d is mutable", idx)
+	}
+	if visiting[idx] {
+		return ConstValue{}, newError(ErrInvalidConstExpr, int64(instr.Offset), "global %d initializer is cyclic", idx)
+	}
+	if visiting == nil {
+		visiting = make(map[uint32]bool)
+	}
+	visiting[idx] = true
+	defer delete(visiting, idx)
+	return rm.evalConstExpr(rm.Globals[def].Init, nil, visiting)
+}
+
+// NumImportedGlobals returns how many entries of the global index space are
+// imports; defined globals in rm.Globals follow them.
+func (rm *ResolvedModule) NumImportedGlobals() uint32 {
+	var n uint32
+	for i := range rm.Imports {
+		if rm.Imports[i].Kind == ImportGlobal {
+			n++
+		}
+	}
+	return n
+}
+
+// GlobalType returns the type of global idx in the global index space,
+// imports first.
+func (rm *ResolvedModule) GlobalType(idx uint32) (GlobalType, bool) {
+	var n uint32
+	for i := range rm.Imports {
+		imp := &rm.Imports[i]
+		if imp.Kind != ImportGlobal {
+			continue
+		}
+		if n == idx {
+			if imp.Global == nil {
+				return GlobalType{}, false
+			}
+			return *imp.Global, true
+		}
+		n++
+	}
+	if idx < n || int(idx-n) >= len(rm.Globals) {
+		return GlobalType{}, false
+	}
+	return rm.Globals[idx-n].Type, true
+}
+
+// GlobalValue statically evaluates the initial value of global idx.
+func (rm *ResolvedModule) GlobalValue(idx uint32) (ConstValue, error) {
+	instr := Instruction{Opcode: OpGlobalGet, Name: "global.get", Imm: Immediate{Index: idx}}
+	return rm.constGlobal(&instr, nil, nil)
+}
+
+// ConstOffset statically evaluates a data or element segment offset.
+func (rm *ResolvedModule) ConstOffset(expr []Instruction) (uint32, error) {
+	v, err := rm.EvalConstExpr(expr, nil)
+	if err != nil {
+		return 0, err
+	}
+	if v.Type != ValI32 {
+		var offset int64 = -1
+		if len(expr) > 0 {
+			offset = int64(expr[0].Offset)
+		}
+		return 0, newError(ErrInvalidConstExpr, offset, "segment offset has type %s, want i32", v.Type)
+	}
+	return uint32(v.Bits), nil
+}
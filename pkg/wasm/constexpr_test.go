@@ -0,0 +1,142 @@
+package wasm
+
+import (
+	"slices"
+	"testing"
+)
+
+func mustDisassemble(t *testing.T, code []byte) []Instruction {
+	t.Helper()
+	instrs, err := DisassembleCode(code, 0)
+	if err != nil {
+		t.Fatalf("disassemble: %v", err)
+	}
+	return instrs
+}
+
+func TestEvalConstExpr(t *testing.T) {
+	rm := &ResolvedModule{
+		Imports: []Import{{Module: "env", Name: "base", Kind: ImportGlobal, Global: &GlobalType{Type: ValI32}}},
+		Globals: []Global{
+			{Type: GlobalType{Type: ValI32}, Init: mustDisassemble(t, []byte{0x41, 0x80, 0x08, 0x0b})},             // i32.const 1024
+			{Type: GlobalType{Type: ValI32, Mutable: true}, Init: mustDisassemble(t, []byte{0x41, 0x10, 0x0b})},    // i32.const 16
+			{Type: GlobalType{Type: ValI32}, Init: mustDisassemble(t, []byte{0x23, 0x01, 0x41, 0x08, 0x6a, 0x0b})}, // global.get 1; i32.const 8; i32.add
+		},
+	}
+
+	tests := []struct {
+		name    string
+		code    []byte
+		want    uint32
+		wantErr bool
+	}{
+		{"i32.const", []byte{0x41, 0x7f, 0x0b}, 0xffffffff, false},
+		{"immutable global", []byte{0x23, 0x01, 0x0b}, 1024, false},
+		{"nested global", []byte{0x23, 0x03, 0x0b}, 1032, false},
+		{"extended const", []byte{0x41, 0x04, 0x41, 0x03, 0x6c, 0x41, 0x02, 0x6b, 0x0b}, 10, false},
+		{"mutable global", []byte{0x23, 0x02, 0x0b}, 0, true},
+		{"imported global", []byte{0x23, 0x00, 0x0b}, 0, true},
+		{"not constant", []byte{0x41, 0x01, 0x45, 0x0b}, 0, true},
+		{"i64 offset", []byte{0x42, 0x01, 0x0b}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rm.ConstOffset(mustDisassemble(t, tt.code))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %d", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	v, err := rm.EvalConstExpr(mustDisassemble(t, []byte{0x23, 0x00, 0x0b}), []ConstValue{{Type: ValI32, Bits: 7}})
+	if err != nil || v.I32() != 7 {
+		t.Errorf("supplied globals: got %v, %v", v, err)
+	}
+
+	for idx, want := range []GlobalType{{Type: ValI32}, {Type: ValI32}, {Type: ValI32, Mutable: true}} {
+		if gt, ok := rm.GlobalType(uint32(idx)); !ok || gt != want {
+			t.Errorf("global %d: got %+v, %v", idx, gt, ok)
+		}
+	}
+	if _, ok := rm.GlobalType(4); ok {
+		t.Error("global 4 has a type")
+	}
+}
+
+func TestMemoryImage(t *testing.T) {
+	rm := &ResolvedModule{
+		Globals: []Global{
+			{Type: GlobalType{Type: ValI32}, Init: mustDisassemble(t, []byte{0x41, 0x04, 0x0b})},
+		},
+		Data: []DataSegment{
+			{Offset: mustDisassemble(t, []byte{0x41, 0x00, 0x0b}), Data: []byte("hello")},
+			{Offset: mustDisassemble(t, []byte{0x23, 0x00, 0x0b}), Data: []byte("XY")},
+			{Passive: true, Data: []byte("passive")},
+		},
+	}
+
+	img := rm.MemoryImage()
+	if string(img.Data) != "hellXY" {
+		t.Errorf("image: got %q", img.Data)
+	}
+	if len(img.Overlaps) != 1 {
+		t.Fatalf("overlaps: got %d, want 1", len(img.Overlaps))
+	}
+	if o := img.Overlaps[0]; o.First != 0 || o.Second != 1 || o.Start != 4 || o.End != 5 {
+		t.Errorf("overlap: got %+v", o)
+	}
+	if rm.MemoryImage() != img {
+		t.Error("memory image not cached")
+	}
+	if s := rm.ReadString(4, 2); s != "XY" {
+		t.Errorf("ReadString: got %q", s)
+	}
+}
+
+func TestTableImage(t *testing.T) {
+	rm := &ResolvedModule{
+		Imports: []Import{{Module: "env", Name: "table", Kind: ImportTable, Table: &Limits{Min: 1}}},
+		Tables: []Table{
+			{Type: ElemFuncRef, Limits: Limits{Min: 4}},
+			{Type: ElemFuncRef, Limits: Limits{Min: 0xffffffff}},
+		},
+		Elements: []ElementSegment{
+			{TableIndex: 1, Offset: mustDisassemble(t, []byte{0x41, 0x01, 0x0b}), FuncIdxs: []uint32{5, 6}},
+			{TableIndex: 1, Offset: mustDisassemble(t, []byte{0x41, 0x03, 0x0b}), FuncIdxs: []uint32{7, 8}},
+			{TableIndex: 0, Offset: mustDisassemble(t, []byte{0x41, 0x00, 0x0b}), FuncIdxs: []uint32{9}},
+			{TableIndex: 2, Offset: mustDisassemble(t, []byte{0x41, 0x02, 0x0b}), FuncIdxs: []uint32{10}},
+		},
+	}
+
+	if img := rm.TableImage(0); img == nil || len(img.Funcs) != 1 || img.Funcs[0] != 9 {
+		t.Errorf("imported table: got %+v", img)
+	}
+	img := rm.TableImage(1)
+	if img == nil {
+		t.Fatal("no image of table 1")
+	}
+	// The segment at 3 overruns the table and is left out.
+	if want := []int64{-1, 5, 6}; !slices.Equal(img.Funcs, want) {
+		t.Errorf("table 1: got %v, want %v", img.Funcs, want)
+	}
+	// A huge table is only as large as its segments reach.
+	if big := rm.TableImage(2); big == nil || !slices.Equal(big.Funcs, []int64{-1, -1, 10}) {
+		t.Errorf("table 2: got %+v", big)
+	}
+	if rm.TableImage(3) != nil {
+		t.Error("image of a missing table")
+	}
+	if rm.TableImage(1) != img {
+		t.Error("table image not cached")
+	}
+}
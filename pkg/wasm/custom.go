@@ -0,0 +1,193 @@
+package wasm
+
+import (
+	"fmt"
+	"sync"
+)
+
+// CustomSection is a custom section as found in the file. Data is the payload
+// following the section name and Offset its position in the file.
+//
+// Value holds the result of the registered decoder for Name, if any; Err is
+// set when that decoder failed.
+type CustomSection struct {
+	Name   string
+	Offset uint64
+	Data   []byte
+	Value  any
+	Err    error
+}
+
+// Decoded reports whether a decoder understood the section.
+func (cs *CustomSection) Decoded() bool {
+	return cs.Value != nil && cs.Err == nil
+}
+
+// CustomDecoder decodes the payload of a named custom section. It runs at the
+// end of Resolve, once functions, imports and exports are in place, and may
+// annotate rm as well as returning a value for CustomSection.Value.
+type CustomDecoder func(rm *ResolvedModule, data []byte, offset int) (any, error)
+
+var (
+	customDecodersMu sync.RWMutex
+	customDecoders   = map[string]CustomDecoder{
+		"name":                decodeNameSection,
+		"producers":           decodeProducersSection,
+		"target_features":     decodeTargetFeatures,
+		"sourceMappingURL":    decodeStringSection,
+		"external_debug_info": decodeStringSection,
+	}
+)
+
+// RegisterCustomDecoder installs dec for custom sections called name,
+// replacing any previous decoder. A nil dec removes the decoder. Modules
+// resolved afterwards pick it up.
+func RegisterCustomDecoder(name string, dec CustomDecoder) {
+	customDecodersMu.Lock()
+	defer customDecodersMu.Unlock()
+	if dec == nil {
+		delete(customDecoders, name)
+		return
+	}
+	customDecoders[name] = dec
+}
+
+func lookupCustomDecoder(name string) CustomDecoder {
+	customDecodersMu.RLock()
+	defer customDecodersMu.RUnlock()
+	return customDecoders[name]
+}
+
+func (rm *ResolvedModule) decodeCustomSections() {
+	for i := range rm.CustomSections {
+		cs := &rm.CustomSections[i]
+		dec := lookupCustomDecoder(cs.Name)
+		if dec == nil {
+			continue
+		}
+		cs.Value, cs.Err = dec(rm, cs.Data, int(cs.Offset))
+	}
+}
+
+// CustomSection returns the first custom section called name, or nil.
+func (rm *ResolvedModule) CustomSection(name string) *CustomSection {
+	for i := range rm.CustomSections {
+		if rm.CustomSections[i].Name == name {
+			return &rm.CustomSections[i]
+		}
+	}
+	return nil
+}
+
+func decodeNameSection(rm *ResolvedModule, data []byte, offset int) (any, error) {
+	names, err := ParseNameSection(data, offset)
+	if err != nil {
+		return nil, err
+	}
+	if rm.Names == nil {
+		rm.Names = names
+		for idx, name := range names.FunctionNames {
+			if rm.FuncExportName(idx) == "" && int(idx) < len(rm.Functions) {
+				rm.Functions[idx].Name = name
+			}
+		}
+	}
+	return names, nil
+}
+
+type ProducerValue struct {
+	Name    string
+	Version string
+}
+
+// ProducersSection is the toolchain metadata from the "producers" section,
+// keyed by field ("language", "processed-by", "sdk").
+type ProducersSection struct {
+	Fields map[string][]ProducerValue
+}
+
+func decodeProducersSection(rm *ResolvedModule, data []byte, offset int) (any, error) {
+	p := &parser{data: data}
+	count, err := p.readU32()
+	if err != nil {
+		return nil, wrapError(ErrInvalidSection, int64(offset), err, "producers field count")
+	}
+	ps := &ProducersSection{Fields: make(map[string][]ProducerValue, count)}
+	for i := uint32(0); i < count; i++ {
+		field, err := p.readString()
+		if err != nil {
+			return nil, wrapError(ErrInvalidSection, int64(offset+p.offset), err, "producers field name")
+		}
+		n, err := p.readU32()
+		if err != nil {
+			return nil, wrapError(ErrInvalidSection, int64(offset+p.offset), err, "producers value count")
+		}
+		for j := uint32(0); j < n; j++ {
+			name, err := p.readString()
+			if err != nil {
+				return nil, wrapError(ErrInvalidSection, int64(offset+p.offset), err, "producer name")
+			}
+			version, err := p.readString()
+			if err != nil {
+				return nil, wrapError(ErrInvalidSection, int64(offset+p.offset), err, "producer version")
+			}
+			ps.Fields[field] = append(ps.Fields[field], ProducerValue{Name: name, Version: version})
+		}
+	}
+	return ps, nil
+}
+
+// TargetFeature is one entry of the "target_features" section. Prefix is '+'
+// for a used feature, '-' for a disallowed one and '=' for a required one.
+type TargetFeature struct {
+	Prefix byte
+	Name   string
+}
+
+func decodeTargetFeatures(rm *ResolvedModule, data []byte, offset int) (any, error) {
+	p := &parser{data: data}
+	count, err := p.readU32()
+	if err != nil {
+		return nil, wrapError(ErrInvalidSection, int64(offset), err, "feature count")
+	}
+	features := make([]TargetFeature, 0, count)
+	for i := uint32(0); i < count; i++ {
+		prefix, err := p.readByte()
+		if err != nil {
+			return nil, wrapError(ErrInvalidSection, int64(offset+p.offset), err, "feature prefix")
+		}
+		name, err := p.readString()
+		if err != nil {
+			return nil, wrapError(ErrInvalidSection, int64(offset+p.offset), err, "feature name")
+		}
+		features = append(features, TargetFeature{Prefix: prefix, Name: name})
+	}
+	return features, nil
+}
+
+// decodeStringSection handles sections whose payload is a single string,
+// such as "sourceMappingURL" and "external_debug_info".
+func decodeStringSection(rm *ResolvedModule, data []byte, offset int) (any, error) {
+	p := &parser{data: data}
+	s, err := p.readString()
+	if err != nil {
+		return nil, wrapError(ErrInvalidSection, int64(offset), err, "string payload")
+	}
+	if p.offset != len(data) {
+		return nil, newError(ErrInvalidSection, int64(offset+p.offset), "%d trailing bytes", len(data)-p.offset)
+	}
+	return s, nil
+}
+
+func (ps *ProducersSection) String() string {
+	s := ""
+	for _, field := range []string{"language", "processed-by", "sdk"} {
+		for _, v := range ps.Fields[field] {
+			if s != "" {
+				s += ", "
+			}
+			s += fmt.Sprintf("%s %s", v.Name, v.Version)
+		}
+	}
+	return s
+}
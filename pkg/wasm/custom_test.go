@@ -0,0 +1,68 @@
+package wasm
+
+import (
+	"errors"
+	"testing"
+)
+
+func customSection(name string, payload []byte) []byte {
+	content := append([]byte{byte(len(name))}, name...)
+	content = append(content, payload...)
+	return append([]byte{0x00, byte(len(content))}, content...)
+}
+
+func TestCustomSections(t *testing.T) {
+	RegisterCustomDecoder("test.upper", func(rm *ResolvedModule, data []byte, offset int) (any, error) {
+		if len(data) == 0 {
+			return nil, errors.New("empty")
+		}
+		return string(data), nil
+	})
+	defer RegisterCustomDecoder("test.upper", nil)
+
+	data := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	data = append(data, customSection("test.upper", []byte("ABC"))...)
+	data = append(data, customSection("test.upper", nil)...)
+	data = append(data, customSection("producers", []byte{
+		0x01, 0x08, 'l', 'a', 'n', 'g', 'u', 'a', 'g', 'e',
+		0x01, 0x04, 'R', 'u', 's', 't', 0x04, '1', '.', '7', '0',
+	})...)
+	data = append(data, customSection("opaque", []byte{0xde, 0xad})...)
+
+	mod, err := Parse(data)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	rm, err := Resolve(mod)
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+
+	if len(rm.CustomSections) != 4 {
+		t.Fatalf("expected 4 custom sections, got %d", len(rm.CustomSections))
+	}
+
+	first := &rm.CustomSections[0]
+	if !first.Decoded() || first.Value != "ABC" {
+		t.Errorf("registered decoder: got %v, %v", first.Value, first.Err)
+	}
+	if got := data[first.Offset : first.Offset+uint64(len(first.Data))]; string(got) != "ABC" {
+		t.Errorf("payload offset points at %q", got)
+	}
+	if second := &rm.CustomSections[1]; second.Decoded() || second.Err == nil {
+		t.Errorf("expected decoder error for empty payload")
+	}
+
+	ps, ok := rm.CustomSection("producers").Value.(*ProducersSection)
+	if !ok {
+		t.Fatalf("producers not decoded: %v", rm.CustomSection("producers").Err)
+	}
+	if v := ps.Fields["language"]; len(v) != 1 || v[0].Name != "Rust" || v[0].Version != "1.70" {
+		t.Errorf("producers language: %+v", v)
+	}
+
+	opaque := rm.CustomSection("opaque")
+	if opaque == nil || opaque.Decoded() || opaque.Err != nil || len(opaque.Data) != 2 {
+		t.Errorf("opaque section: %+v", opaque)
+	}
+}
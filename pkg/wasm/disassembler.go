@@ -3,7 +3,6 @@ package wasm
 import (
 	"encoding/binary"
 	"fmt"
-	"math"
 )
 
 func DisassembleCode(code []byte, baseOffset int) ([]Instruction, error) {
@@ -43,9 +42,8 @@ func DisassembleCode(code []byte, baseOffset int) ([]Instruction, error) {
 			if pc >= len(code) {
 				return nil, newError(ErrTruncated, int64(baseOffset+pc), "unexpected end reading block type")
 			}
-			blockType := code[pc]
+			instr.Imm.Block = BlockType(code[pc])
 			pc++
-			instr.Immediates = append(instr.Immediates, blockType)
 
 		case OpBr, OpBrIf:
 			if pc >= len(code) {
@@ -55,7 +53,7 @@ func DisassembleCode(code []byte, baseOffset int) ([]Instruction, error) {
 			if err != nil {
 				return nil, wrapError(ErrInvalidLEB128, int64(baseOffset+pc), err, "invalid branch index")
 			}
-			instr.Immediates = append(instr.Immediates, val)
+			instr.Imm.Index = val
 			pc += n
 
 		case OpBrTable:
@@ -77,7 +75,7 @@ func DisassembleCode(code []byte, baseOffset int) ([]Instruction, error) {
 				labels[i] = label
 				pc += n
 			}
-			instr.Immediates = append(instr.Immediates, labels)
+			instr.Imm.Labels = labels
 
 		case OpCall:
 			if pc >= len(code) {
@@ -87,7 +85,7 @@ func DisassembleCode(code []byte, baseOffset int) ([]Instruction, error) {
 			if err != nil {
 				return nil, wrapError(ErrInvalidLEB128, int64(baseOffset+pc), err, "invalid call index")
 			}
-			instr.Immediates = append(instr.Immediates, val)
+			instr.Imm.Index = val
 			pc += n
 
 		case OpCallIndirect:
@@ -106,9 +104,22 @@ func DisassembleCode(code []byte, baseOffset int) ([]Instruction, error) {
 			}
 			pc += n
 
-			instr.Immediates = append(instr.Immediates, typeIdx, tableIdx)
+			instr.Imm.Index = typeIdx
+			instr.Imm.Index2 = tableIdx
 
-		case OpLocalGet, OpLocalSet, OpLocalTee, OpGlobalGet, OpGlobalSet:
+		case OpSelectTyped:
+			count, n, err := ReadLEB128U32FromSlice(code[pc:])
+			if err != nil {
+				return nil, wrapError(ErrInvalidLEB128, int64(baseOffset+pc), err, "invalid select type count")
+			}
+			pc += n
+			if count != 1 || pc >= len(code) {
+				return nil, newError(ErrTruncated, int64(baseOffset+pc), "select expects exactly one result type")
+			}
+			instr.Imm.Block = BlockType(code[pc])
+			pc++
+
+		case OpLocalGet, OpLocalSet, OpLocalTee, OpGlobalGet, OpGlobalSet, OpTableGet, OpTableSet:
 			if pc >= len(code) {
 				return nil, newError(ErrTruncated, int64(baseOffset+pc), "unexpected end reading index")
 			}
@@ -116,7 +127,7 @@ func DisassembleCode(code []byte, baseOffset int) ([]Instruction, error) {
 			if err != nil {
 				return nil, wrapError(ErrInvalidLEB128, int64(baseOffset+pc), err, "invalid index")
 			}
-			instr.Immediates = append(instr.Immediates, val)
+			instr.Imm.Index = val
 			pc += n
 
 		case OpI32Load, OpI64Load, OpF32Load, OpF64Load,
@@ -141,7 +152,7 @@ func DisassembleCode(code []byte, baseOffset int) ([]Instruction, error) {
 			}
 			pc += n
 
-			instr.Immediates = append(instr.Immediates, align, offset)
+			instr.Imm.MemArg = MemArg{Align: align, Offset: offset}
 
 		case OpMemorySize, OpMemoryGrow:
 			if pc >= len(code) {
@@ -157,7 +168,7 @@ func DisassembleCode(code []byte, baseOffset int) ([]Instruction, error) {
 			if err != nil {
 				return nil, wrapError(ErrInvalidLEB128, int64(baseOffset+pc), err, "invalid i32.const")
 			}
-			instr.Immediates = append(instr.Immediates, val)
+			instr.Imm.Bits = uint64(uint32(val))
 			pc += n
 
 		case OpI64Const:
@@ -168,25 +179,21 @@ func DisassembleCode(code []byte, baseOffset int) ([]Instruction, error) {
 			if err != nil {
 				return nil, wrapError(ErrInvalidLEB128, int64(baseOffset+pc), err, "invalid i64.const")
 			}
-			instr.Immediates = append(instr.Immediates, val)
+			instr.Imm.Bits = uint64(val)
 			pc += n
 
 		case OpF32Const:
 			if pc+4 > len(code) {
 				return nil, newError(ErrTruncated, int64(baseOffset+pc), "unexpected end reading f32.const")
 			}
-			bits := binary.LittleEndian.Uint32(code[pc:])
-			val := math.Float32frombits(bits)
-			instr.Immediates = append(instr.Immediates, val)
+			instr.Imm.Bits = uint64(binary.LittleEndian.Uint32(code[pc:]))
 			pc += 4
 
 		case OpF64Const:
 			if pc+8 > len(code) {
 				return nil, newError(ErrTruncated, int64(baseOffset+pc), "unexpected end reading f64.const")
 			}
-			bits := binary.LittleEndian.Uint64(code[pc:])
-			val := math.Float64frombits(bits)
-			instr.Immediates = append(instr.Immediates, val)
+			instr.Imm.Bits = binary.LittleEndian.Uint64(code[pc:])
 			pc += 8
 
 		case OpMemoryInit:
@@ -199,7 +206,7 @@ func DisassembleCode(code []byte, baseOffset int) ([]Instruction, error) {
 				return nil, newError(ErrTruncated, int64(baseOffset+pc), "unexpected end reading memory.init")
 			}
 			pc++
-			instr.Immediates = append(instr.Immediates, dataIdx)
+			instr.Imm.Index = dataIdx
 
 		case OpDataDrop:
 			dataIdx, n, err := ReadLEB128U32FromSlice(code[pc:])
@@ -207,7 +214,7 @@ func DisassembleCode(code []byte, baseOffset int) ([]Instruction, error) {
 				return nil, wrapError(ErrInvalidLEB128, int64(baseOffset+pc), err, "invalid data.drop index")
 			}
 			pc += n
-			instr.Immediates = append(instr.Immediates, dataIdx)
+			instr.Imm.Index = dataIdx
 
 		case OpMemoryCopy:
 			if pc+2 > len(code) {
@@ -232,7 +239,8 @@ func DisassembleCode(code []byte, baseOffset int) ([]Instruction, error) {
 				return nil, wrapError(ErrInvalidLEB128, int64(baseOffset+pc), err, "invalid table.init table index")
 			}
 			pc += n
-			instr.Immediates = append(instr.Immediates, elemIdx, tableIdx)
+			instr.Imm.Index = elemIdx
+			instr.Imm.Index2 = tableIdx
 
 		case OpElemDrop:
 			elemIdx, n, err := ReadLEB128U32FromSlice(code[pc:])
@@ -240,7 +248,7 @@ func DisassembleCode(code []byte, baseOffset int) ([]Instruction, error) {
 				return nil, wrapError(ErrInvalidLEB128, int64(baseOffset+pc), err, "invalid elem.drop index")
 			}
 			pc += n
-			instr.Immediates = append(instr.Immediates, elemIdx)
+			instr.Imm.Index = elemIdx
 
 		case OpTableCopy:
 			dstIdx, n, err := ReadLEB128U32FromSlice(code[pc:])
@@ -253,7 +261,8 @@ func DisassembleCode(code []byte, baseOffset int) ([]Instruction, error) {
 				return nil, wrapError(ErrInvalidLEB128, int64(baseOffset+pc), err, "invalid table.copy src index")
 			}
 			pc += n
-			instr.Immediates = append(instr.Immediates, dstIdx, srcIdx)
+			instr.Imm.Index = dstIdx
+			instr.Imm.Index2 = srcIdx
 
 		case OpTableGrow, OpTableSize, OpTableFill:
 			tableIdx, n, err := ReadLEB128U32FromSlice(code[pc:])
@@ -261,15 +270,14 @@ func DisassembleCode(code []byte, baseOffset int) ([]Instruction, error) {
 				return nil, wrapError(ErrInvalidLEB128, int64(baseOffset+pc), err, "invalid table index")
 			}
 			pc += n
-			instr.Immediates = append(instr.Immediates, tableIdx)
+			instr.Imm.Index = tableIdx
 
 		case OpRefNull:
 			if pc >= len(code) {
 				return nil, newError(ErrTruncated, int64(baseOffset+pc), "unexpected end reading ref.null heaptype")
 			}
-			heapType := code[pc]
+			instr.Imm.Index = uint32(code[pc])
 			pc++
-			instr.Immediates = append(instr.Immediates, heapType)
 
 		case OpRefFunc:
 			funcIdx, n, err := ReadLEB128U32FromSlice(code[pc:])
@@ -277,7 +285,7 @@ func DisassembleCode(code []byte, baseOffset int) ([]Instruction, error) {
 				return nil, wrapError(ErrInvalidLEB128, int64(baseOffset+pc), err, "invalid ref.func index")
 			}
 			pc += n
-			instr.Immediates = append(instr.Immediates, funcIdx)
+			instr.Imm.Index = funcIdx
 		}
 
 		instructions = append(instructions, instr)
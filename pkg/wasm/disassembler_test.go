@@ -42,9 +42,9 @@ func TestDisassembleCode(t *testing.T) {
 				0x0b, // end
 			},
 			expected: []Instruction{
-				{Offset: 0, Opcode: 0x01, Name: "nop", Immediates: nil},
-				{Offset: 1, Opcode: 0x6a, Name: "i32.add", Immediates: nil},
-				{Offset: 2, Opcode: 0x0b, Name: "end", Immediates: nil},
+				{Offset: 0, Opcode: 0x01, Name: "nop"},
+				{Offset: 1, Opcode: 0x6a, Name: "i32.add"},
+				{Offset: 2, Opcode: 0x0b, Name: "end"},
 			},
 		},
 		{
@@ -55,9 +55,9 @@ func TestDisassembleCode(t *testing.T) {
 				0x20, 0x00,       // local.get 0
 			},
 			expected: []Instruction{
-				{Offset: 0, Opcode: OpI32Const, Name: "i32.const", Immediates: []any{int32(10)}},
-				{Offset: 2, Opcode: OpI32Const, Name: "i32.const", Immediates: []any{int32(128)}},
-				{Offset: 5, Opcode: OpLocalGet, Name: "local.get", Immediates: []any{uint32(0)}},
+				{Offset: 0, Opcode: OpI32Const, Name: "i32.const", Imm: Immediate{Bits: 10}},
+				{Offset: 2, Opcode: OpI32Const, Name: "i32.const", Imm: Immediate{Bits: 128}},
+				{Offset: 5, Opcode: OpLocalGet, Name: "local.get", Imm: Immediate{Index: 0}},
 			},
 		},
 		{
@@ -66,7 +66,22 @@ func TestDisassembleCode(t *testing.T) {
 				0x41, 0x7f, // i32.const -1
 			},
 			expected: []Instruction{
-				{Offset: 0, Opcode: OpI32Const, Name: "i32.const", Immediates: []any{int32(-1)}},
+				{Offset: 0, Opcode: OpI32Const, Name: "i32.const", Imm: Immediate{Bits: 0xffffffff}},
+			},
+		},
+		{
+			name: "Typed Immediates",
+			input: []byte{
+				0x02, 0x7f, // block (result i32)
+				0x28, 0x02, 0x08, // i32.load align=2 offset=8
+				0x0e, 0x02, 0x00, 0x01, 0x00, // br_table 0 1 0
+				0x11, 0x03, 0x00, // call_indirect type 3 table 0
+			},
+			expected: []Instruction{
+				{Offset: 0, Opcode: OpBlock, Name: "block", Imm: Immediate{Block: BlockType(ValI32)}},
+				{Offset: 2, Opcode: OpI32Load, Name: "i32.load", Imm: Immediate{MemArg: MemArg{Align: 2, Offset: 8}}},
+				{Offset: 5, Opcode: OpBrTable, Name: "br_table", Imm: Immediate{Labels: []uint32{0, 1, 0}}},
+				{Offset: 10, Opcode: OpCallIndirect, Name: "call_indirect", Imm: Immediate{Index: 3}},
 			},
 		},
 	}
@@ -90,10 +105,34 @@ func TestDisassembleCode(t *testing.T) {
 					t.Errorf("inst[%d] opcode mismatch: got %s, want %s", i, got[i].Name, tt.expected[i].Name)
 				}
 
-				if !reflect.DeepEqual(got[i].Immediates, tt.expected[i].Immediates) {
-					t.Errorf("inst[%d] args mismatch: got %v, want %v", i, got[i].Immediates, tt.expected[i].Immediates)
+				if !reflect.DeepEqual(got[i].Imm, tt.expected[i].Imm) {
+					t.Errorf("inst[%d] args mismatch: got %v, want %v", i, got[i].Imm, tt.expected[i].Imm)
 				}
 			}
 		})
 	}
 }
+
+func TestInstructionAccessors(t *testing.T) {
+	instrs, err := DisassembleCode([]byte{
+		0x41, 0x7f, // i32.const -1
+		0x42, 0x80, 0x7f, // i64.const -128
+		0x44, 0, 0, 0, 0, 0, 0, 0xf8, 0x3f, // f64.const 1.5
+	}, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if v := instrs[0].I32(); v != -1 {
+		t.Errorf("i32.const: got %d, want -1", v)
+	}
+	if v := instrs[1].I64(); v != -128 {
+		t.Errorf("i64.const: got %d, want -128", v)
+	}
+	if v := instrs[2].F64(); v != 1.5 {
+		t.Errorf("f64.const: got %v, want 1.5", v)
+	}
+	if v, ok := instrs[0].ConstValue().(int32); !ok || v != -1 {
+		t.Errorf("ConstValue: got %#v", instrs[0].ConstValue())
+	}
+}
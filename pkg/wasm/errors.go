@@ -13,6 +13,7 @@ const (
 	ErrInvalidSection
 	ErrInvalidIndex
 	ErrSectionOverflow
+	ErrInvalidConstExpr
 )
 
 type ParseError struct {
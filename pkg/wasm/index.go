@@ -0,0 +1,146 @@
+package wasm
+
+type importKey struct {
+	module string
+	name   string
+}
+
+type moduleIndex struct {
+	funcsByName map[string]uint32
+	funcExports map[uint32]string
+	exports     map[string]int
+	typeFuncs   map[uint32][]uint32
+	canonTypes  []uint32
+	imports     map[importKey]int
+}
+
+// BuildIndex rebuilds the lookup tables behind the query methods. Resolve
+// calls it; callers that edit Functions, Exports, Imports or Types afterwards
+// must call it again.
+func (rm *ResolvedModule) BuildIndex() {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.buildIndex()
+}
+
+func (rm *ResolvedModule) buildIndex() {
+	idx := &moduleIndex{
+		funcsByName: make(map[string]uint32, len(rm.Functions)),
+		funcExports: make(map[uint32]string),
+		exports:     make(map[string]int, len(rm.Exports)),
+		typeFuncs:   make(map[uint32][]uint32),
+		canonTypes:  make([]uint32, len(rm.Types)),
+		imports:     make(map[importKey]int, len(rm.Imports)),
+	}
+
+	seen := make(map[string]uint32, len(rm.Types))
+	for i := range rm.Types {
+		sig := rm.Types[i].String()
+		if first, ok := seen[sig]; ok {
+			idx.canonTypes[i] = first
+		} else {
+			seen[sig] = uint32(i)
+			idx.canonTypes[i] = uint32(i)
+		}
+	}
+
+	for i := range rm.Functions {
+		fn := &rm.Functions[i]
+		if _, dup := idx.funcsByName[fn.Name]; !dup {
+			idx.funcsByName[fn.Name] = fn.Index
+		}
+		if int(fn.TypeIdx) < len(idx.canonTypes) {
+			canon := idx.canonTypes[fn.TypeIdx]
+			idx.typeFuncs[canon] = append(idx.typeFuncs[canon], fn.Index)
+		}
+	}
+
+	for i, exp := range rm.Exports {
+		if _, dup := idx.exports[exp.Name]; !dup {
+			idx.exports[exp.Name] = i
+		}
+		if exp.Kind == ExportFunc {
+			if _, dup := idx.funcExports[exp.Index]; !dup {
+				idx.funcExports[exp.Index] = exp.Name
+			}
+		}
+	}
+
+	for i, imp := range rm.Imports {
+		idx.imports[importKey{imp.Module, imp.Name}] = i
+	}
+
+	rm.index = idx
+}
+
+func (rm *ResolvedModule) ensureIndex() *moduleIndex {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	if rm.index == nil {
+		rm.buildIndex()
+	}
+	return rm.index
+}
+
+func (rm *ResolvedModule) GetFunction(index uint32) *ResolvedFunction {
+	if int(index) < len(rm.Functions) && rm.Functions[index].Index == index {
+		return &rm.Functions[index]
+	}
+	for i := range rm.Functions {
+		if rm.Functions[i].Index == index {
+			return &rm.Functions[i]
+		}
+	}
+	return nil
+}
+
+func (rm *ResolvedModule) GetFunctionByName(name string) *ResolvedFunction {
+	idx, ok := rm.ensureIndex().funcsByName[name]
+	if !ok {
+		return nil
+	}
+	return rm.GetFunction(idx)
+}
+
+// GetFunctionByExport returns the function exported under name, or nil if
+// there is no such function export.
+func (rm *ResolvedModule) GetFunctionByExport(name string) *ResolvedFunction {
+	exp := rm.GetExport(name)
+	if exp == nil || exp.Kind != ExportFunc {
+		return nil
+	}
+	return rm.GetFunction(exp.Index)
+}
+
+func (rm *ResolvedModule) GetExport(name string) *Export {
+	i, ok := rm.ensureIndex().exports[name]
+	if !ok {
+		return nil
+	}
+	return &rm.Exports[i]
+}
+
+// FuncExportName returns the first name a function is exported under, or ""
+// if it is not exported.
+func (rm *ResolvedModule) FuncExportName(index uint32) string {
+	return rm.ensureIndex().funcExports[index]
+}
+
+func (rm *ResolvedModule) GetImport(module, name string) *Import {
+	i, ok := rm.ensureIndex().imports[importKey{module, name}]
+	if !ok {
+		return nil
+	}
+	return &rm.Imports[i]
+}
+
+// FunctionsByType returns the indices of all functions whose signature is
+// structurally equal to type typeIdx, which is the set call_indirect with
+// that type index can reach.
+func (rm *ResolvedModule) FunctionsByType(typeIdx uint32) []uint32 {
+	idx := rm.ensureIndex()
+	if int(typeIdx) >= len(idx.canonTypes) {
+		return nil
+	}
+	return idx.typeFuncs[idx.canonTypes[typeIdx]]
+}
@@ -0,0 +1,116 @@
+package wasm
+
+import (
+	"fmt"
+	"math"
+)
+
+func (i *Instruction) Index() uint32 {
+	return i.Imm.Index
+}
+
+func (i *Instruction) Index2() uint32 {
+	return i.Imm.Index2
+}
+
+func (i *Instruction) MemArg() MemArg {
+	return i.Imm.MemArg
+}
+
+func (i *Instruction) BlockType() BlockType {
+	return i.Imm.Block
+}
+
+func (i *Instruction) Labels() []uint32 {
+	return i.Imm.Labels
+}
+
+func (i *Instruction) Lane() byte {
+	return i.Imm.Lane
+}
+
+func (i *Instruction) HeapType() ValType {
+	return ValType(i.Imm.Index)
+}
+
+func (i *Instruction) I32() int32 {
+	return int32(uint32(i.Imm.Bits))
+}
+
+func (i *Instruction) I64() int64 {
+	return int64(i.Imm.Bits)
+}
+
+func (i *Instruction) F32() float32 {
+	return math.Float32frombits(uint32(i.Imm.Bits))
+}
+
+func (i *Instruction) F64() float64 {
+	return math.Float64frombits(i.Imm.Bits)
+}
+
+// ConstValue returns the value of a numeric constant instruction as int32,
+// int64, float32 or float64, or nil for any other opcode.
+func (i *Instruction) ConstValue() any {
+	switch i.Opcode {
+	case OpI32Const:
+		return i.I32()
+	case OpI64Const:
+		return i.I64()
+	case OpF32Const:
+		return i.F32()
+	case OpF64Const:
+		return i.F64()
+	}
+	return nil
+}
+
+// Operands renders the immediates of the instruction in the order they
+// appear in the binary encoding. br_table labels are rendered individually,
+// default label last.
+func (i *Instruction) Operands() []string {
+	switch i.Opcode {
+	case OpBlock, OpLoop, OpIf, OpSelectTyped:
+		if i.Imm.Block == BlockEmpty {
+			return nil
+		}
+		return []string{i.Imm.Block.Result().String()}
+
+	case OpBrTable:
+		ops := make([]string, len(i.Imm.Labels))
+		for j, l := range i.Imm.Labels {
+			ops[j] = fmt.Sprintf("%d", l)
+		}
+		return ops
+
+	case OpBr, OpBrIf, OpCall, OpLocalGet, OpLocalSet, OpLocalTee, OpGlobalGet, OpGlobalSet, OpTableGet, OpTableSet,
+		OpMemoryInit, OpDataDrop, OpElemDrop, OpTableGrow, OpTableSize, OpTableFill, OpRefFunc:
+		return []string{fmt.Sprintf("%d", i.Imm.Index)}
+
+	case OpCallIndirect, OpTableInit, OpTableCopy:
+		return []string{fmt.Sprintf("%d", i.Imm.Index), fmt.Sprintf("%d", i.Imm.Index2)}
+
+	case OpRefNull:
+		return []string{i.HeapType().String()}
+
+	case OpI32Const:
+		return []string{fmt.Sprintf("%d", i.I32())}
+	case OpI64Const:
+		return []string{fmt.Sprintf("%d", i.I64())}
+	case OpF32Const:
+		return []string{fmt.Sprintf("%v", i.F32())}
+	case OpF64Const:
+		return []string{fmt.Sprintf("%v", i.F64())}
+	}
+
+	if i.Opcode.IsMemoryAccess() {
+		return []string{fmt.Sprintf("%d", i.Imm.MemArg.Align), fmt.Sprintf("%d", i.Imm.MemArg.Offset)}
+	}
+	return nil
+}
+
+// IsMemoryAccess reports whether the opcode is a load or store carrying a
+// memarg immediate.
+func (op Opcode) IsMemoryAccess() bool {
+	return op >= OpI32Load && op <= OpI64Store32
+}
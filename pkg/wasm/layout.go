@@ -0,0 +1,413 @@
+package wasm
+
+import (
+	"fmt"
+	"sort"
+)
+
+type RegionKind string
+
+const (
+	RegionHeader        RegionKind = "header"
+	RegionSection       RegionKind = "section"
+	RegionSectionHeader RegionKind = "section-header"
+	RegionCount         RegionKind = "count"
+	RegionSize          RegionKind = "size"
+	RegionEntry         RegionKind = "entry"
+	RegionLocals        RegionKind = "locals"
+	RegionCode          RegionKind = "code"
+	RegionPayload       RegionKind = "payload"
+	RegionName          RegionKind = "name"
+	RegionUnparsed      RegionKind = "unparsed"
+)
+
+// Region is a half-open byte range [Start, End) of the file. Children are
+// sorted, non-overlapping and contained in their parent.
+//
+// Index is the entry's position in its index space: the function index for
+// function and code entries, the import, export, type, global, table,
+// memory, element or data index otherwise, and -1 for regions that are not
+// entries.
+type Region struct {
+	Kind     RegionKind
+	Label    string
+	Start    uint64
+	End      uint64
+	Section  SectionID
+	Index    int
+	Children []Region
+}
+
+func (r *Region) Contains(offset uint64) bool {
+	return offset >= r.Start && offset < r.End
+}
+
+// Layout is an interval map of a module file.
+type Layout struct {
+	Size    uint64
+	Regions []Region
+}
+
+// Lookup returns the chain of regions containing offset, outermost first.
+func (l *Layout) Lookup(offset uint64) []*Region {
+	var chain []*Region
+	regions := l.Regions
+	for {
+		i := sort.Search(len(regions), func(i int) bool { return regions[i].End > offset })
+		if i == len(regions) || !regions[i].Contains(offset) {
+			return chain
+		}
+		chain = append(chain, &regions[i])
+		regions = regions[i].Children
+	}
+}
+
+// BuildLayout maps every byte of the module to the structure that owns it.
+// Entries that cannot be decoded end the walk of their section; the rest of
+// the section is reported as a single RegionUnparsed region.
+func BuildLayout(mod *Module) *Layout {
+	l := &Layout{Size: 8}
+	l.Regions = append(l.Regions, Region{Kind: RegionHeader, Label: "magic and version", Start: 0, End: 8, Index: -1})
+
+	b := &layoutBuilder{}
+	for i := range mod.Sections {
+		sec := &mod.Sections[i]
+		r := b.section(sec)
+		if r.End > l.Size {
+			l.Size = r.End
+		}
+		l.Regions = append(l.Regions, r)
+	}
+	return l
+}
+
+type layoutBuilder struct {
+	funcImports   int
+	globalImports int
+	tableImports  int
+	memImports    int
+}
+
+func (b *layoutBuilder) section(sec *Section) Region {
+	base := sec.ContentOffset
+	r := Region{
+		Kind:    RegionSection,
+		Label:   sec.ID.String(),
+		Start:   sec.Offset,
+		End:     base + uint64(sec.Size),
+		Section: sec.ID,
+		Index:   -1,
+	}
+	r.Children = append(r.Children, Region{Kind: RegionSectionHeader, Start: sec.Offset, End: base, Section: sec.ID, Index: -1})
+
+	p := &parser{data: sec.Content}
+	var err error
+	switch sec.ID {
+	case SectionCustom:
+		err = b.custom(&r, p, base)
+	case SectionType:
+		err = b.vector(&r, p, base, 0, b.typeEntry)
+	case SectionImport:
+		err = b.vector(&r, p, base, 0, b.importEntry)
+	case SectionFunction:
+		err = b.vector(&r, p, base, b.funcImports, b.funcEntry)
+	case SectionTable:
+		err = b.vector(&r, p, base, b.tableImports, b.tableEntry)
+	case SectionMemory:
+		err = b.vector(&r, p, base, b.memImports, b.memoryEntry)
+	case SectionGlobal:
+		err = b.vector(&r, p, base, b.globalImports, b.globalEntry)
+	case SectionExport:
+		err = b.vector(&r, p, base, 0, b.exportEntry)
+	case SectionStart:
+		var idx uint32
+		if idx, err = p.readU32(); err == nil {
+			r.Children = append(r.Children, Region{Kind: RegionEntry, Label: fmt.Sprintf("start func %d", idx), Start: base, End: base + uint64(p.offset), Section: sec.ID, Index: int(idx)})
+		}
+	case SectionElement:
+		err = b.vector(&r, p, base, 0, b.elementEntry)
+	case SectionCode:
+		err = b.vector(&r, p, base, b.funcImports, b.codeEntry)
+	case SectionData:
+		err = b.vector(&r, p, base, 0, b.dataEntry)
+	case SectionDataCount:
+		var n uint32
+		if n, err = p.readU32(); err == nil {
+			r.Children = append(r.Children, Region{Kind: RegionCount, Label: fmt.Sprintf("%d data segments", n), Start: base, End: base + uint64(p.offset), Section: sec.ID, Index: -1})
+		}
+	}
+
+	if err != nil || p.offset < len(p.data) {
+		label := "trailing bytes"
+		if err != nil {
+			label = err.Error()
+		}
+		r.Children = append(r.Children, Region{Kind: RegionUnparsed, Label: label, Start: base + uint64(p.offset), End: r.End, Section: sec.ID, Index: -1})
+	}
+	return r
+}
+
+func (b *layoutBuilder) custom(r *Region, p *parser, base uint64) error {
+	name, err := p.readString()
+	if err != nil {
+		return err
+	}
+	r.Label = "custom " + name
+	r.Children = append(r.Children,
+		Region{Kind: RegionName, Label: name, Start: base, End: base + uint64(p.offset), Section: SectionCustom, Index: -1},
+		Region{Kind: RegionPayload, Label: name, Start: base + uint64(p.offset), End: base + uint64(len(p.data)), Section: SectionCustom, Index: -1},
+	)
+	p.offset = len(p.data)
+	return nil
+}
+
+// layoutEntry decodes one vector entry starting at p.offset. It fills in the
+// label and any children; vector sets the bounds, kind and index.
+type layoutEntry func(p *parser, base uint64, e *Region) error
+
+func (b *layoutBuilder) vector(r *Region, p *parser, base uint64, firstIndex int, entry layoutEntry) error {
+	count, err := p.readU32()
+	if err != nil {
+		return err
+	}
+	r.Children = append(r.Children, Region{Kind: RegionCount, Label: fmt.Sprintf("%d entries", count), Start: base, End: base + uint64(p.offset), Section: r.Section, Index: -1})
+
+	for i := 0; i < int(count); i++ {
+		start := p.offset
+		e := Region{Kind: RegionEntry, Section: r.Section, Index: firstIndex + i}
+		if err := entry(p, base, &e); err != nil {
+			p.offset = start
+			return err
+		}
+		e.Start = base + uint64(start)
+		e.End = base + uint64(p.offset)
+		r.Children = append(r.Children, e)
+	}
+	return nil
+}
+
+func (p *parser) skipValTypes() ([]ValType, error) {
+	n, err := p.readU32()
+	if err != nil {
+		return nil, err
+	}
+	b, err := p.readBytes(int(n))
+	if err != nil {
+		return nil, err
+	}
+	types := make([]ValType, n)
+	for i, t := range b {
+		types[i] = ValType(t)
+	}
+	return types, nil
+}
+
+func (b *layoutBuilder) typeEntry(p *parser, base uint64, e *Region) error {
+	if _, err := p.readByte(); err != nil {
+		return err
+	}
+	params, err := p.skipValTypes()
+	if err != nil {
+		return err
+	}
+	results, err := p.skipValTypes()
+	if err != nil {
+		return err
+	}
+	ft := FuncType{Params: params, Results: results}
+	e.Label = fmt.Sprintf("type %d %s", e.Index, ft.String())
+	return nil
+}
+
+func (b *layoutBuilder) importEntry(p *parser, base uint64, e *Region) error {
+	module, err := p.readString()
+	if err != nil {
+		return err
+	}
+	name, err := p.readString()
+	if err != nil {
+		return err
+	}
+	kind, err := p.readByte()
+	if err != nil {
+		return err
+	}
+	switch ImportKind(kind) {
+	case ImportFunc:
+		_, err = p.readU32()
+		b.funcImports++
+	case ImportTable:
+		if _, err = p.readByte(); err == nil {
+			_, err = p.readLimits(0)
+		}
+		b.tableImports++
+	case ImportMemory:
+		_, err = p.readLimits(0)
+		b.memImports++
+	case ImportGlobal:
+		_, err = p.readBytes(2)
+		b.globalImports++
+	default:
+		err = newError(ErrInvalidSection, int64(base)+int64(p.offset), "unknown import kind 0x%02x", kind)
+	}
+	e.Label = fmt.Sprintf("import %s.%s", module, name)
+	return err
+}
+
+func (b *layoutBuilder) funcEntry(p *parser, base uint64, e *Region) error {
+	typeIdx, err := p.readU32()
+	e.Label = fmt.Sprintf("func %d type %d", e.Index, typeIdx)
+	return err
+}
+
+func (b *layoutBuilder) tableEntry(p *parser, base uint64, e *Region) error {
+	if _, err := p.readByte(); err != nil {
+		return err
+	}
+	_, err := p.readLimits(0)
+	e.Label = fmt.Sprintf("table %d", e.Index)
+	return err
+}
+
+func (b *layoutBuilder) memoryEntry(p *parser, base uint64, e *Region) error {
+	_, err := p.readLimits(0)
+	e.Label = fmt.Sprintf("memory %d", e.Index)
+	return err
+}
+
+func (b *layoutBuilder) globalEntry(p *parser, base uint64, e *Region) error {
+	if _, err := p.readBytes(2); err != nil {
+		return err
+	}
+	_, err := p.readInitExpr()
+	e.Label = fmt.Sprintf("global %d", e.Index)
+	return err
+}
+
+func (b *layoutBuilder) exportEntry(p *parser, base uint64, e *Region) error {
+	name, err := p.readString()
+	if err != nil {
+		return err
+	}
+	if _, err := p.readByte(); err != nil {
+		return err
+	}
+	_, err = p.readU32()
+	e.Label = "export " + name
+	return err
+}
+
+// elementEntry walks all eight element segment encodings: bit 0 marks a
+// passive or declarative segment, bit 1 an explicit table index (active) or
+// declarative segment, and bit 2 a vector of expressions instead of function
+// indices.
+func (b *layoutBuilder) elementEntry(p *parser, base uint64, e *Region) error {
+	flags, err := p.readU32()
+	if err != nil {
+		return err
+	}
+	if flags > 7 {
+		return newError(ErrInvalidSection, int64(base)+int64(p.offset), "unknown element segment flags %d", flags)
+	}
+	if flags&1 == 0 {
+		if flags&2 != 0 {
+			if _, err := p.readU32(); err != nil {
+				return err
+			}
+		}
+		if _, err := p.readInitExpr(); err != nil {
+			return err
+		}
+	}
+	if flags&3 != 0 {
+		if _, err := p.readByte(); err != nil {
+			return err
+		}
+	}
+	n, err := p.readU32()
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < n; i++ {
+		if flags&4 != 0 {
+			_, err = p.readInitExpr()
+		} else {
+			_, err = p.readU32()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	e.Label = fmt.Sprintf("elem %d (%d entries)", e.Index, n)
+	return nil
+}
+
+func (b *layoutBuilder) codeEntry(p *parser, base uint64, e *Region) error {
+	sizeStart := p.offset
+	size, err := p.readU32()
+	if err != nil {
+		return err
+	}
+	bodyStart := p.offset
+	if p.remaining() < int(size) {
+		return newError(ErrSectionOverflow, int64(base)+int64(p.offset), "function %d body exceeds section bounds", e.Index)
+	}
+	bodyEnd := bodyStart + int(size)
+
+	body := &parser{data: p.data[:bodyEnd], offset: bodyStart}
+	decls, err := body.readU32()
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < decls; i++ {
+		if _, err := body.readU32(); err != nil {
+			return err
+		}
+		if _, err := body.readByte(); err != nil {
+			return err
+		}
+	}
+	p.offset = bodyEnd
+
+	e.Label = fmt.Sprintf("func %d body", e.Index)
+	e.Children = []Region{
+		{Kind: RegionSize, Label: fmt.Sprintf("%d bytes", size), Start: base + uint64(sizeStart), End: base + uint64(bodyStart), Section: SectionCode, Index: e.Index},
+		{Kind: RegionLocals, Label: fmt.Sprintf("%d local declarations", decls), Start: base + uint64(bodyStart), End: base + uint64(body.offset), Section: SectionCode, Index: e.Index},
+		{Kind: RegionCode, Label: fmt.Sprintf("func %d code", e.Index), Start: base + uint64(body.offset), End: base + uint64(bodyEnd), Section: SectionCode, Index: e.Index},
+	}
+	return nil
+}
+
+func (b *layoutBuilder) dataEntry(p *parser, base uint64, e *Region) error {
+	flags, err := p.readU32()
+	if err != nil {
+		return err
+	}
+	if flags > 2 {
+		return newError(ErrInvalidSection, int64(base)+int64(p.offset), "unknown data segment flags %d", flags)
+	}
+	if flags == 2 {
+		if _, err := p.readU32(); err != nil {
+			return err
+		}
+	}
+	if flags != 1 {
+		if _, err := p.readInitExpr(); err != nil {
+			return err
+		}
+	}
+	size, err := p.readU32()
+	if err != nil {
+		return err
+	}
+	payloadStart := p.offset
+	if _, err := p.readBytes(int(size)); err != nil {
+		return err
+	}
+
+	e.Label = fmt.Sprintf("data %d (%d bytes)", e.Index, size)
+	e.Children = []Region{
+		{Kind: RegionPayload, Label: fmt.Sprintf("data %d payload", e.Index), Start: base + uint64(payloadStart), End: base + uint64(p.offset), Section: SectionData, Index: e.Index},
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package wasm
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func checkCoverage(t *testing.T, label string, start, end uint64, regions []Region) {
+	t.Helper()
+	pos := start
+	for i := range regions {
+		r := &regions[i]
+		if r.Start < pos || r.End < r.Start || r.End > end {
+			t.Errorf("%s: region %q [%d,%d) out of order or bounds [%d,%d)", label, r.Label, r.Start, r.End, pos, end)
+		}
+		if r.Kind == RegionUnparsed {
+			t.Errorf("%s: unparsed bytes [%d,%d): %s", label, r.Start, r.End, r.Label)
+		}
+		checkCoverage(t, r.Label, r.Start, r.End, r.Children)
+		pos = r.End
+	}
+}
+
+func TestBuildLayout(t *testing.T) {
+	for _, name := range []string{"add.wasm", "with_import.wasm", "with_elem.wasm", "with_table_data.wasm"} {
+		t.Run(name, func(t *testing.T) {
+			mod, err := ParseFile(filepath.Join("..", "..", "tests", "testdata", name))
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			rm, err := Resolve(mod)
+			if err != nil {
+				t.Fatalf("resolve: %v", err)
+			}
+
+			l := BuildLayout(mod)
+			checkCoverage(t, name, 0, l.Size, l.Regions)
+			if last := l.Regions[len(l.Regions)-1]; last.End != l.Size {
+				t.Errorf("layout ends at %d, size %d", last.End, l.Size)
+			}
+
+			// The children of a code entry leave none of its bytes out.
+			for _, sec := range l.Regions {
+				if sec.Section != SectionCode {
+					continue
+				}
+				for _, e := range sec.Children {
+					if e.Kind != RegionEntry {
+						continue
+					}
+					pos := e.Start
+					for _, c := range e.Children {
+						if c.Start != pos {
+							t.Errorf("%s: gap at [%d,%d)", e.Label, pos, c.Start)
+						}
+						pos = c.End
+					}
+					if pos != e.End {
+						t.Errorf("%s: children end at %d, entry at %d", e.Label, pos, e.End)
+					}
+				}
+			}
+
+			for _, fn := range rm.Functions {
+				if fn.Body == nil || len(fn.Body.Instructions) == 0 {
+					continue
+				}
+				chain := l.Lookup(fn.Body.Instructions[0].Offset)
+				if len(chain) == 0 {
+					t.Fatalf("func %d: no region at first instruction", fn.Index)
+				}
+				inner := chain[len(chain)-1]
+				if inner.Kind != RegionCode || inner.Index != int(fn.Index) {
+					t.Errorf("func %d: first instruction in %s %q (index %d)", fn.Index, inner.Kind, inner.Label, inner.Index)
+				}
+				if entry := chain[len(chain)-2]; entry.Start != uint64(fn.Body.Offset) {
+					t.Errorf("func %d: body entry at %d, FunctionBody.Offset %d", fn.Index, entry.Start, fn.Body.Offset)
+				}
+			}
+		})
+	}
+}
+
+func TestLayoutLookupOutside(t *testing.T) {
+	l := &Layout{Size: 8, Regions: []Region{{Kind: RegionHeader, Start: 0, End: 8}}}
+	if chain := l.Lookup(8); chain != nil {
+		t.Errorf("expected no region past the end, got %v", chain)
+	}
+	if chain := l.Lookup(3); len(chain) != 1 || chain[0].Kind != RegionHeader {
+		t.Errorf("expected header, got %v", chain)
+	}
+}
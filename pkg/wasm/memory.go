@@ -0,0 +1,135 @@
+package wasm
+
+import "sort"
+
+// PlacedSegment records where an active data segment lands in the static
+// memory image. Err is set when the offset expression cannot be evaluated
+// statically; such segments are left out of the image.
+type PlacedSegment struct {
+	Index  int
+	Offset uint32
+	Size   uint32
+	Err    error
+}
+
+func (s *PlacedSegment) End() uint32 {
+	return s.Offset + s.Size
+}
+
+// SegmentOverlap reports two data segments that write the same bytes. The
+// later segment wins, as it does at instantiation.
+type SegmentOverlap struct {
+	First  int
+	Second int
+	Start  uint32
+	End    uint32
+}
+
+// MemoryImage is the initial contents of memory 0 as produced by its active
+// data segments.
+type MemoryImage struct {
+	Data     []byte
+	Segments []PlacedSegment
+	Overlaps []SegmentOverlap
+}
+
+// MemoryImage returns the static image of memory 0. It is computed once and
+// cached; callers must not modify the returned data.
+func (rm *ResolvedModule) MemoryImage() *MemoryImage {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	if rm.memImage == nil {
+		rm.memImage = rm.buildMemoryImage()
+	}
+	return rm.memImage
+}
+
+func (rm *ResolvedModule) buildMemoryImage() *MemoryImage {
+	img := &MemoryImage{}
+
+	var maxEnd uint64
+	for i := range rm.Data {
+		seg := &rm.Data[i]
+		if seg.Passive || seg.MemoryIndex != 0 {
+			continue
+		}
+		placed := PlacedSegment{Index: i, Size: uint32(len(seg.Data))}
+		placed.Offset, placed.Err = rm.ConstOffset(seg.Offset)
+		if placed.Err == nil && uint64(placed.Offset)+uint64(placed.Size) > 1<<32 {
+			placed.Err = newError(ErrInvalidConstExpr, -1, "data segment %d ends beyond 4GiB", i)
+		}
+		if placed.Err == nil {
+			if end := uint64(placed.Offset) + uint64(placed.Size); end > maxEnd {
+				maxEnd = end
+			}
+		}
+		img.Segments = append(img.Segments, placed)
+	}
+
+	if maxEnd == 0 {
+		return img
+	}
+
+	img.Data = make([]byte, maxEnd)
+	var placed []*PlacedSegment
+	for i := range img.Segments {
+		seg := &img.Segments[i]
+		if seg.Err != nil {
+			continue
+		}
+		copy(img.Data[seg.Offset:], rm.Data[seg.Index].Data)
+		if seg.Size > 0 {
+			placed = append(placed, seg)
+		}
+	}
+	img.Overlaps = findOverlaps(placed)
+
+	return img
+}
+
+func findOverlaps(segs []*PlacedSegment) []SegmentOverlap {
+	sort.SliceStable(segs, func(i, j int) bool { return segs[i].Offset < segs[j].Offset })
+
+	var overlaps []SegmentOverlap
+	var widest *PlacedSegment
+	for _, seg := range segs {
+		if widest != nil && seg.Offset < widest.End() {
+			first, second := widest, seg
+			if first.Index > second.Index {
+				first, second = second, first
+			}
+			overlaps = append(overlaps, SegmentOverlap{
+				First:  first.Index,
+				Second: second.Index,
+				Start:  seg.Offset,
+				End:    min(widest.End(), seg.End()),
+			})
+		}
+		if widest == nil || seg.End() > widest.End() {
+			widest = seg
+		}
+	}
+	return overlaps
+}
+
+// BuildMemory returns a fresh copy of the static memory image that the caller
+// may modify. It is built from the data segments alone, whether or not a
+// snapshot is attached.
+func (rm *ResolvedModule) BuildMemory() []byte {
+	data := rm.MemoryImage().Data
+	if data == nil {
+		return nil
+	}
+	mem := make([]byte, len(data))
+	copy(mem, data)
+	return mem
+}
+
+// ReadString reads length bytes of memory 0 as returned by MemoryData.
+func (rm *ResolvedModule) ReadString(addr, length uint32) string {
+	mem := rm.MemoryData()
+	if mem == nil || uint64(addr)+uint64(length) > uint64(len(mem)) {
+		return ""
+	}
+	return string(mem[addr : addr+length])
+}
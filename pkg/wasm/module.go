@@ -13,7 +13,7 @@ func Resolve(mod *Module) (*ResolvedModule, error) {
 	}
 
 	if sec := sections[SectionType]; sec != nil {
-		types, err := ParseTypeSection(sec.Content, int(sec.Offset))
+		types, err := ParseTypeSection(sec.Content, int(sec.ContentOffset))
 		if err != nil {
 			return nil, fmt.Errorf("type section: %w", err)
 		}
@@ -21,7 +21,7 @@ func Resolve(mod *Module) (*ResolvedModule, error) {
 	}
 
 	if sec := sections[SectionImport]; sec != nil {
-		imports, err := ParseImportSection(sec.Content, int(sec.Offset))
+		imports, err := ParseImportSection(sec.Content, int(sec.ContentOffset))
 		if err != nil {
 			return nil, fmt.Errorf("import section: %w", err)
 		}
@@ -30,7 +30,7 @@ func Resolve(mod *Module) (*ResolvedModule, error) {
 
 	var funcTypeIndices []uint32
 	if sec := sections[SectionFunction]; sec != nil {
-		indices, err := ParseFunctionSection(sec.Content, int(sec.Offset))
+		indices, err := ParseFunctionSection(sec.Content, int(sec.ContentOffset))
 		if err != nil {
 			return nil, fmt.Errorf("function section: %w", err)
 		}
@@ -38,7 +38,7 @@ func Resolve(mod *Module) (*ResolvedModule, error) {
 	}
 
 	if sec := sections[SectionTable]; sec != nil {
-		tables, err := ParseTableSection(sec.Content, int(sec.Offset))
+		tables, err := ParseTableSection(sec.Content, int(sec.ContentOffset))
 		if err != nil {
 			return nil, fmt.Errorf("table section: %w", err)
 		}
@@ -46,7 +46,7 @@ func Resolve(mod *Module) (*ResolvedModule, error) {
 	}
 
 	if sec := sections[SectionMemory]; sec != nil {
-		memories, err := ParseMemorySection(sec.Content, int(sec.Offset))
+		memories, err := ParseMemorySection(sec.Content, int(sec.ContentOffset))
 		if err != nil {
 			return nil, fmt.Errorf("memory section: %w", err)
 		}
@@ -54,7 +54,7 @@ func Resolve(mod *Module) (*ResolvedModule, error) {
 	}
 
 	if sec := sections[SectionGlobal]; sec != nil {
-		globals, err := ParseGlobalSection(sec.Content, int(sec.Offset))
+		globals, err := ParseGlobalSection(sec.Content, int(sec.ContentOffset))
 		if err != nil {
 			return nil, fmt.Errorf("global section: %w", err)
 		}
@@ -62,7 +62,7 @@ func Resolve(mod *Module) (*ResolvedModule, error) {
 	}
 
 	if sec := sections[SectionExport]; sec != nil {
-		exports, err := ParseExportSection(sec.Content, int(sec.Offset))
+		exports, err := ParseExportSection(sec.Content, int(sec.ContentOffset))
 		if err != nil {
 			return nil, fmt.Errorf("export section: %w", err)
 		}
@@ -70,7 +70,7 @@ func Resolve(mod *Module) (*ResolvedModule, error) {
 	}
 
 	if sec := sections[SectionStart]; sec != nil {
-		startIdx, err := ParseStartSection(sec.Content, int(sec.Offset))
+		startIdx, err := ParseStartSection(sec.Content, int(sec.ContentOffset))
 		if err != nil {
 			return nil, fmt.Errorf("start section: %w", err)
 		}
@@ -78,7 +78,7 @@ func Resolve(mod *Module) (*ResolvedModule, error) {
 	}
 
 	if sec := sections[SectionElement]; sec != nil {
-		elements, err := ParseElementSection(sec.Content, int(sec.Offset))
+		elements, err := ParseElementSection(sec.Content, int(sec.ContentOffset))
 		if err != nil {
 			return nil, fmt.Errorf("element section: %w", err)
 		}
@@ -86,7 +86,7 @@ func Resolve(mod *Module) (*ResolvedModule, error) {
 	}
 
 	if sec := sections[SectionData]; sec != nil {
-		data, err := ParseDataSection(sec.Content, int(sec.Offset))
+		data, err := ParseDataSection(sec.Content, int(sec.ContentOffset))
 		if err != nil {
 			return nil, fmt.Errorf("data section: %w", err)
 		}
@@ -95,7 +95,7 @@ func Resolve(mod *Module) (*ResolvedModule, error) {
 
 	var bodies []FunctionBody
 	if sec := sections[SectionCode]; sec != nil {
-		b, err := ParseCodeSection(sec.Content, int(sec.Offset))
+		b, err := ParseCodeSection(sec.Content, int(sec.ContentOffset))
 		if err != nil {
 			return nil, fmt.Errorf("code section: %w", err)
 		}
@@ -112,6 +112,7 @@ func Resolve(mod *Module) (*ResolvedModule, error) {
 		fn := ResolvedFunction{
 			Index:    funcIndex,
 			Name:     fmt.Sprintf("%s.%s", rm.Imports[i].Module, rm.Imports[i].Name),
+			TypeIdx:  rm.Imports[i].TypeIdx,
 			Imported: true,
 			Import:   &rm.Imports[i],
 		}
@@ -128,6 +129,7 @@ func Resolve(mod *Module) (*ResolvedModule, error) {
 		fn := ResolvedFunction{
 			Index:    funcIndex,
 			Name:     fmt.Sprintf("func_%d", funcIndex),
+			TypeIdx:  typeIdx,
 			Imported: false,
 		}
 
@@ -143,9 +145,11 @@ func Resolve(mod *Module) (*ResolvedModule, error) {
 		funcIndex++
 	}
 
+	// A function exported under several names is named after the first,
+	// as FuncExportName reports it.
 	exportNames := make(map[uint32]string)
 	for _, exp := range rm.Exports {
-		if exp.Kind == ExportFunc {
+		if _, dup := exportNames[exp.Index]; exp.Kind == ExportFunc && !dup {
 			exportNames[exp.Index] = exp.Name
 		}
 	}
@@ -157,97 +161,24 @@ func Resolve(mod *Module) (*ResolvedModule, error) {
 	}
 
 	for i := range mod.Sections {
-		if mod.Sections[i].ID != SectionCustom {
+		sec := &mod.Sections[i]
+		if sec.ID != SectionCustom {
 			continue
 		}
-		content := mod.Sections[i].Content
-		if len(content) < 5 {
-			continue
-		}
-		nameLen, n, err := ReadLEB128U32FromSlice(content)
-		if err != nil || int(nameLen)+n > len(content) {
+		p := &parser{data: sec.Content}
+		name, err := p.readString()
+		if err != nil {
 			continue
 		}
-		secName := string(content[n : n+int(nameLen)])
-		if secName == "name" {
-			payload := content[n+int(nameLen):]
-			names, err := ParseNameSection(payload, int(mod.Sections[i].Offset)+n+int(nameLen))
-			if err == nil && names != nil {
-				rm.Names = names
-				for idx, name := range names.FunctionNames {
-					if _, hasExport := exportNames[idx]; !hasExport {
-						for j := range rm.Functions {
-							if rm.Functions[j].Index == idx {
-								rm.Functions[j].Name = name
-								break
-							}
-						}
-					}
-				}
-			}
-			break
-		}
-	}
-
-	return rm, nil
-}
-
-func (rm *ResolvedModule) GetFunction(index uint32) *ResolvedFunction {
-	for i := range rm.Functions {
-		if rm.Functions[i].Index == index {
-			return &rm.Functions[i]
-		}
-	}
-	return nil
-}
-
-func (rm *ResolvedModule) GetFunctionByName(name string) *ResolvedFunction {
-	for i := range rm.Functions {
-		if rm.Functions[i].Name == name {
-			return &rm.Functions[i]
-		}
-	}
-	return nil
-}
-
-func (rm *ResolvedModule) BuildMemory() []byte {
-	if len(rm.Data) == 0 {
-		return nil
-	}
-	var maxEnd uint32
-	for _, seg := range rm.Data {
-		offset := getDataOffset(seg.Offset)
-		end := offset + uint32(len(seg.Data))
-		if end > maxEnd {
-			maxEnd = end
-		}
+		rm.CustomSections = append(rm.CustomSections, CustomSection{
+			Name:   name,
+			Offset: sec.ContentOffset + uint64(p.offset),
+			Data:   sec.Content[p.offset:],
+		})
 	}
-	mem := make([]byte, maxEnd)
-	for _, seg := range rm.Data {
-		offset := getDataOffset(seg.Offset)
-		copy(mem[offset:], seg.Data)
-	}
-	return mem
-}
+	rm.decodeCustomSections()
 
-func getDataOffset(instrs []Instruction) uint32 {
-	for _, instr := range instrs {
-		if instr.Opcode == OpI32Const && len(instr.Immediates) > 0 {
-			if v, ok := instr.Immediates[0].(int32); ok {
-				return uint32(v)
-			}
-			if v, ok := instr.Immediates[0].(uint32); ok {
-				return v
-			}
-		}
-	}
-	return 0
-}
+	rm.BuildIndex()
 
-func (rm *ResolvedModule) ReadString(addr, length uint32) string {
-	mem := rm.BuildMemory()
-	if mem == nil || int(addr+length) > len(mem) {
-		return ""
-	}
-	return string(mem[addr : addr+length])
+	return rm, nil
 }
@@ -17,14 +17,17 @@ const (
 	OpCall        Opcode = 0x10
 	OpCallIndirect Opcode = 0x11
 
-	OpDrop   Opcode = 0x1a
-	OpSelect Opcode = 0x1b
+	OpDrop        Opcode = 0x1a
+	OpSelect      Opcode = 0x1b
+	OpSelectTyped Opcode = 0x1c
 
 	OpLocalGet  Opcode = 0x20
 	OpLocalSet  Opcode = 0x21
 	OpLocalTee  Opcode = 0x22
 	OpGlobalGet Opcode = 0x23
 	OpGlobalSet Opcode = 0x24
+	OpTableGet  Opcode = 0x25
+	OpTableSet  Opcode = 0x26
 
 	OpI32Load    Opcode = 0x28
 	OpI64Load    Opcode = 0x29
@@ -119,19 +122,82 @@ const (
 	OpI64Rotl   Opcode = 0x89
 	OpI64Rotr   Opcode = 0x8a
 
-	OpF64Eq Opcode = 0x60
-	OpF64Ne Opcode = 0x61
-	OpF64Lt Opcode = 0x62
-	OpF64Gt Opcode = 0x63
-	OpF64Le Opcode = 0x64
-	OpF64Ge Opcode = 0x65
+	OpF32Eq Opcode = 0x5b
+	OpF32Ne Opcode = 0x5c
+	OpF32Lt Opcode = 0x5d
+	OpF32Gt Opcode = 0x5e
+	OpF32Le Opcode = 0x5f
+	OpF32Ge Opcode = 0x60
+
+	OpF64Eq Opcode = 0x61
+	OpF64Ne Opcode = 0x62
+	OpF64Lt Opcode = 0x63
+	OpF64Gt Opcode = 0x64
+	OpF64Le Opcode = 0x65
+	OpF64Ge Opcode = 0x66
+
+	OpF32Abs      Opcode = 0x8b
+	OpF32Neg      Opcode = 0x8c
+	OpF32Ceil     Opcode = 0x8d
+	OpF32Floor    Opcode = 0x8e
+	OpF32Trunc    Opcode = 0x8f
+	OpF32Nearest  Opcode = 0x90
+	OpF32Sqrt     Opcode = 0x91
+	OpF32Add      Opcode = 0x92
+	OpF32Sub      Opcode = 0x93
+	OpF32Mul      Opcode = 0x94
+	OpF32Div      Opcode = 0x95
+	OpF32Min      Opcode = 0x96
+	OpF32Max      Opcode = 0x97
+	OpF32Copysign Opcode = 0x98
+
+	OpF64Abs      Opcode = 0x99
+	OpF64Neg      Opcode = 0x9a
+	OpF64Ceil     Opcode = 0x9b
+	OpF64Floor    Opcode = 0x9c
+	OpF64Trunc    Opcode = 0x9d
+	OpF64Nearest  Opcode = 0x9e
+	OpF64Sqrt     Opcode = 0x9f
+	OpF64Add      Opcode = 0xa0
+	OpF64Sub      Opcode = 0xa1
+	OpF64Mul      Opcode = 0xa2
+	OpF64Div      Opcode = 0xa3
+	OpF64Min      Opcode = 0xa4
+	OpF64Max      Opcode = 0xa5
+	OpF64Copysign Opcode = 0xa6
 
 	OpI32WrapI64        Opcode = 0xa7
+	OpI32TruncF32S      Opcode = 0xa8
+	OpI32TruncF32U      Opcode = 0xa9
+	OpI32TruncF64S      Opcode = 0xaa
+	OpI32TruncF64U      Opcode = 0xab
 	OpI64ExtendI32S     Opcode = 0xac
 	OpI64ExtendI32U     Opcode = 0xad
+	OpI64TruncF32S      Opcode = 0xae
+	OpI64TruncF32U      Opcode = 0xaf
+	OpI64TruncF64S      Opcode = 0xb0
+	OpI64TruncF64U      Opcode = 0xb1
+	OpF32ConvertI32S    Opcode = 0xb2
+	OpF32ConvertI32U    Opcode = 0xb3
+	OpF32ConvertI64S    Opcode = 0xb4
+	OpF32ConvertI64U    Opcode = 0xb5
+	OpF32DemoteF64      Opcode = 0xb6
+	OpF64ConvertI32S    Opcode = 0xb7
+	OpF64ConvertI32U    Opcode = 0xb8
+	OpF64ConvertI64S    Opcode = 0xb9
+	OpF64ConvertI64U    Opcode = 0xba
+	OpF64PromoteF32     Opcode = 0xbb
+	OpI32ReinterpretF32 Opcode = 0xbc
 	OpI64ReinterpretF64 Opcode = 0xbd
+	OpF32ReinterpretI32 Opcode = 0xbe
 	OpF64ReinterpretI64 Opcode = 0xbf
 
+	OpI32Extend8S  Opcode = 0xc0
+	OpI32Extend16S Opcode = 0xc1
+	OpI64Extend8S  Opcode = 0xc2
+	OpI64Extend16S Opcode = 0xc3
+	OpI64Extend32S Opcode = 0xc4
+
 	OpRefNull   Opcode = 0xd0
 	OpRefIsNull Opcode = 0xd1
 	OpRefFunc   Opcode = 0xd2
@@ -176,12 +242,15 @@ var OpcodeNames = map[Opcode]string{
 
 	0x1a: "drop",
 	0x1b: "select",
+	0x1c: "select",
 
 	0x20: "local.get",
 	0x21: "local.set",
 	0x22: "local.tee",
 	0x23: "global.get",
 	0x24: "global.set",
+	0x25: "table.get",
+	0x26: "table.set",
 
 	0x28: "i32.load",
 	0x29: "i64.load",
@@ -276,19 +345,82 @@ var OpcodeNames = map[Opcode]string{
 	0x89: "i64.rotl",
 	0x8a: "i64.rotr",
 
-	0x60: "f64.eq",
-	0x61: "f64.ne",
-	0x62: "f64.lt",
-	0x63: "f64.gt",
-	0x64: "f64.le",
-	0x65: "f64.ge",
+	0x5b: "f32.eq",
+	0x5c: "f32.ne",
+	0x5d: "f32.lt",
+	0x5e: "f32.gt",
+	0x5f: "f32.le",
+	0x60: "f32.ge",
+
+	0x61: "f64.eq",
+	0x62: "f64.ne",
+	0x63: "f64.lt",
+	0x64: "f64.gt",
+	0x65: "f64.le",
+	0x66: "f64.ge",
+
+	0x8b: "f32.abs",
+	0x8c: "f32.neg",
+	0x8d: "f32.ceil",
+	0x8e: "f32.floor",
+	0x8f: "f32.trunc",
+	0x90: "f32.nearest",
+	0x91: "f32.sqrt",
+	0x92: "f32.add",
+	0x93: "f32.sub",
+	0x94: "f32.mul",
+	0x95: "f32.div",
+	0x96: "f32.min",
+	0x97: "f32.max",
+	0x98: "f32.copysign",
+
+	0x99: "f64.abs",
+	0x9a: "f64.neg",
+	0x9b: "f64.ceil",
+	0x9c: "f64.floor",
+	0x9d: "f64.trunc",
+	0x9e: "f64.nearest",
+	0x9f: "f64.sqrt",
+	0xa0: "f64.add",
+	0xa1: "f64.sub",
+	0xa2: "f64.mul",
+	0xa3: "f64.div",
+	0xa4: "f64.min",
+	0xa5: "f64.max",
+	0xa6: "f64.copysign",
 
 	0xa7: "i32.wrap_i64",
+	0xa8: "i32.trunc_f32_s",
+	0xa9: "i32.trunc_f32_u",
+	0xaa: "i32.trunc_f64_s",
+	0xab: "i32.trunc_f64_u",
 	0xac: "i64.extend_i32_s",
 	0xad: "i64.extend_i32_u",
+	0xae: "i64.trunc_f32_s",
+	0xaf: "i64.trunc_f32_u",
+	0xb0: "i64.trunc_f64_s",
+	0xb1: "i64.trunc_f64_u",
+	0xb2: "f32.convert_i32_s",
+	0xb3: "f32.convert_i32_u",
+	0xb4: "f32.convert_i64_s",
+	0xb5: "f32.convert_i64_u",
+	0xb6: "f32.demote_f64",
+	0xb7: "f64.convert_i32_s",
+	0xb8: "f64.convert_i32_u",
+	0xb9: "f64.convert_i64_s",
+	0xba: "f64.convert_i64_u",
+	0xbb: "f64.promote_f32",
+	0xbc: "i32.reinterpret_f32",
 	0xbd: "i64.reinterpret_f64",
+	0xbe: "f32.reinterpret_i32",
 	0xbf: "f64.reinterpret_i64",
 
+	0xc0: "i32.extend8_s",
+	0xc1: "i32.extend16_s",
+	0xc2: "i64.extend8_s",
+	0xc3: "i64.extend16_s",
+	0xc4: "i64.extend32_s",
+
 	0xd0: "ref.null",
 	0xd1: "ref.is_null",
 	0xd2: "ref.func",
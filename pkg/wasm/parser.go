@@ -108,13 +108,15 @@ func Parse(data []byte) (*Module, error) {
 			return nil, newError(ErrSectionOverflow, int64(sectionStart), "section %d claims %d bytes, only %d available", idByte, size, p.remaining())
 		}
 
+		contentStart := p.offset
 		content, _ := p.readBytes(int(size))
 
 		mod.Sections = append(mod.Sections, Section{
-			ID:      SectionID(idByte),
-			Offset:  uint64(sectionStart),
-			Size:    size,
-			Content: content,
+			ID:            SectionID(idByte),
+			Offset:        uint64(sectionStart),
+			ContentOffset: uint64(contentStart),
+			Size:          size,
+			Content:       content,
 		})
 	}
 
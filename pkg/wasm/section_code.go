@@ -22,9 +22,10 @@ func ParseCodeSection(content []byte, baseOffset int) ([]FunctionBody, error) {
 			return nil, newError(ErrSectionOverflow, int64(funcOffset), "function %d body exceeds section bounds", i)
 		}
 
+		bodyStart := baseOffset + p.offset
 		bodyData, _ := p.readBytes(int(bodySize))
 
-		body, err := parseFunctionBody(bodyData, funcOffset)
+		body, err := parseFunctionBody(bodyData, bodyStart)
 		if err != nil {
 			return nil, err
 		}
@@ -11,20 +11,33 @@ func ParseDataSection(content []byte, baseOffset int) ([]DataSegment, error) {
 	segments := make([]DataSegment, 0, count)
 
 	for i := uint32(0); i < count; i++ {
-		memIdx, err := p.readU32()
+		flags, err := p.readU32()
 		if err != nil {
-			return nil, wrapError(ErrInvalidLEB128, int64(baseOffset+p.offset), err, "memory index")
+			return nil, wrapError(ErrInvalidLEB128, int64(baseOffset+p.offset), err, "data segment flags")
 		}
 
-		initStart := p.offset
-		initBytes, err := p.readInitExpr()
-		if err != nil {
-			return nil, wrapError(ErrInvalidSection, int64(baseOffset+initStart), err, "offset expr")
+		var memIdx uint32
+		if flags == 2 {
+			memIdx, err = p.readU32()
+			if err != nil {
+				return nil, wrapError(ErrInvalidLEB128, int64(baseOffset+p.offset), err, "memory index")
+			}
+		} else if flags > 2 {
+			return nil, newError(ErrInvalidSection, int64(baseOffset+p.offset), "unknown data segment flags %d", flags)
 		}
 
-		offsetInstrs, err := DisassembleCode(initBytes, baseOffset+initStart)
-		if err != nil {
-			return nil, wrapError(ErrInvalidSection, int64(baseOffset+initStart), err, "disassemble offset")
+		var offsetInstrs []Instruction
+		if flags != 1 {
+			initStart := p.offset
+			initBytes, err := p.readInitExpr()
+			if err != nil {
+				return nil, wrapError(ErrInvalidSection, int64(baseOffset+initStart), err, "offset expr")
+			}
+
+			offsetInstrs, err = DisassembleCode(initBytes, baseOffset+initStart)
+			if err != nil {
+				return nil, wrapError(ErrInvalidSection, int64(baseOffset+initStart), err, "disassemble offset")
+			}
 		}
 
 		size, err := p.readU32()
@@ -42,6 +55,7 @@ func ParseDataSection(content []byte, baseOffset int) ([]DataSegment, error) {
 
 		segments = append(segments, DataSegment{
 			MemoryIndex: memIdx,
+			Passive:     flags == 1,
 			Offset:      offsetInstrs,
 			Data:        data,
 		})
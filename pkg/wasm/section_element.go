@@ -1,5 +1,8 @@
 package wasm
 
+// ParseElementSection decodes the element section, accepting every segment
+// encoding (flags 0 to 7). Element expressions are reduced to the function
+// a ref.func names, or NullElem.
 func ParseElementSection(content []byte, baseOffset int) ([]ElementSegment, error) {
 	p := &parser{data: content}
 
@@ -11,20 +14,41 @@ func ParseElementSection(content []byte, baseOffset int) ([]ElementSegment, erro
 	segments := make([]ElementSegment, 0, count)
 
 	for i := uint32(0); i < count; i++ {
-		tableIdx, err := p.readU32()
+		flags, err := p.readU32()
 		if err != nil {
-			return nil, wrapError(ErrInvalidLEB128, int64(baseOffset+p.offset), err, "table index")
+			return nil, wrapError(ErrInvalidLEB128, int64(baseOffset+p.offset), err, "element segment flags")
+		}
+		if flags > 7 {
+			return nil, newError(ErrInvalidSection, int64(baseOffset+p.offset), "unknown element segment flags %d", flags)
 		}
 
-		initStart := p.offset
-		initBytes, err := p.readInitExpr()
-		if err != nil {
-			return nil, wrapError(ErrInvalidSection, int64(baseOffset+initStart), err, "offset expr")
+		var tableIdx uint32
+		var offsetInstrs []Instruction
+		if flags&1 == 0 {
+			if flags&2 != 0 {
+				tableIdx, err = p.readU32()
+				if err != nil {
+					return nil, wrapError(ErrInvalidLEB128, int64(baseOffset+p.offset), err, "table index")
+				}
+			}
+
+			initStart := p.offset
+			initBytes, err := p.readInitExpr()
+			if err != nil {
+				return nil, wrapError(ErrInvalidSection, int64(baseOffset+initStart), err, "offset expr")
+			}
+
+			offsetInstrs, err = DisassembleCode(initBytes, baseOffset+initStart)
+			if err != nil {
+				return nil, wrapError(ErrInvalidSection, int64(baseOffset+initStart), err, "disassemble offset")
+			}
 		}
 
-		offsetInstrs, err := DisassembleCode(initBytes, baseOffset+initStart)
-		if err != nil {
-			return nil, wrapError(ErrInvalidSection, int64(baseOffset+initStart), err, "disassemble offset")
+		// The element kind (0x00, funcref) or reference type.
+		if flags&3 != 0 {
+			if _, err := p.readByte(); err != nil {
+				return nil, wrapError(ErrTruncated, int64(baseOffset+p.offset), err, "element kind")
+			}
 		}
 
 		funcCount, err := p.readU32()
@@ -34,17 +58,36 @@ func ParseElementSection(content []byte, baseOffset int) ([]ElementSegment, erro
 
 		funcIdxs := make([]uint32, funcCount)
 		for j := uint32(0); j < funcCount; j++ {
-			idx, err := p.readU32()
+			if flags&4 == 0 {
+				idx, err := p.readU32()
+				if err != nil {
+					return nil, wrapError(ErrInvalidLEB128, int64(baseOffset+p.offset), err, "func index")
+				}
+				funcIdxs[j] = idx
+				continue
+			}
+
+			exprStart := p.offset
+			exprBytes, err := p.readInitExpr()
+			if err != nil {
+				return nil, wrapError(ErrInvalidSection, int64(baseOffset+exprStart), err, "element expr")
+			}
+			expr, err := DisassembleCode(exprBytes, baseOffset+exprStart)
 			if err != nil {
-				return nil, wrapError(ErrInvalidLEB128, int64(baseOffset+p.offset), err, "func index")
+				return nil, wrapError(ErrInvalidSection, int64(baseOffset+exprStart), err, "disassemble element expr")
+			}
+			funcIdxs[j] = NullElem
+			if len(expr) > 0 && expr[0].Opcode == OpRefFunc {
+				funcIdxs[j] = expr[0].Index()
 			}
-			funcIdxs[j] = idx
 		}
 
 		segments = append(segments, ElementSegment{
-			TableIndex: tableIdx,
-			Offset:     offsetInstrs,
-			FuncIdxs:   funcIdxs,
+			TableIndex:  tableIdx,
+			Passive:     flags&3 == 1,
+			Declarative: flags&3 == 3,
+			Offset:      offsetInstrs,
+			FuncIdxs:    funcIdxs,
 		})
 	}
 
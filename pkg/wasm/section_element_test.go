@@ -0,0 +1,127 @@
+package wasm
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseElementSection(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []byte
+		expected ElementSegment
+		offset   bool
+	}{
+		{
+			name: "active, table 0, indices",
+			input: []byte{
+				0x00,             // flags
+				0x41, 0x01, 0x0b, // offset: i32.const 1
+				0x02, 0x03, 0x04, // 2 funcs: 3, 4
+			},
+			expected: ElementSegment{FuncIdxs: []uint32{3, 4}},
+			offset:   true,
+		},
+		{
+			name: "passive, indices",
+			input: []byte{
+				0x01,       // flags
+				0x00,       // elemkind: funcref
+				0x01, 0x02, // 1 func: 2
+			},
+			expected: ElementSegment{Passive: true, FuncIdxs: []uint32{2}},
+		},
+		{
+			name: "active, explicit table, indices",
+			input: []byte{
+				0x02,             // flags
+				0x01,             // table 1
+				0x41, 0x00, 0x0b, // offset: i32.const 0
+				0x00,       // elemkind: funcref
+				0x01, 0x05, // 1 func: 5
+			},
+			expected: ElementSegment{TableIndex: 1, FuncIdxs: []uint32{5}},
+			offset:   true,
+		},
+		{
+			name: "declarative, indices",
+			input: []byte{
+				0x03,       // flags
+				0x00,       // elemkind: funcref
+				0x01, 0x06, // 1 func: 6
+			},
+			expected: ElementSegment{Declarative: true, FuncIdxs: []uint32{6}},
+		},
+		{
+			name: "active, table 0, expressions",
+			input: []byte{
+				0x04,             // flags
+				0x41, 0x00, 0x0b, // offset: i32.const 0
+				0x02,             // 2 exprs
+				0xd2, 0x07, 0x0b, // ref.func 7
+				0xd0, 0x70, 0x0b, // ref.null func
+			},
+			expected: ElementSegment{FuncIdxs: []uint32{7, NullElem}},
+			offset:   true,
+		},
+		{
+			name: "passive, expressions",
+			input: []byte{
+				0x05,             // flags
+				0x70,             // reftype: funcref
+				0x01,             // 1 expr
+				0xd2, 0x01, 0x0b, // ref.func 1
+			},
+			expected: ElementSegment{Passive: true, FuncIdxs: []uint32{1}},
+		},
+		{
+			name: "active, explicit table, expressions",
+			input: []byte{
+				0x06,             // flags
+				0x02,             // table 2
+				0x41, 0x03, 0x0b, // offset: i32.const 3
+				0x70,             // reftype: funcref
+				0x01,             // 1 expr
+				0xd2, 0x00, 0x0b, // ref.func 0
+			},
+			expected: ElementSegment{TableIndex: 2, FuncIdxs: []uint32{0}},
+			offset:   true,
+		},
+		{
+			name: "declarative, expressions",
+			input: []byte{
+				0x07,             // flags
+				0x70,             // reftype: funcref
+				0x01,             // 1 expr
+				0xd2, 0x08, 0x0b, // ref.func 8
+			},
+			expected: ElementSegment{Declarative: true, FuncIdxs: []uint32{8}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseElementSection(append([]byte{0x01}, tt.input...), 0)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(got) != 1 {
+				t.Fatalf("count mismatch: got %d, want 1", len(got))
+			}
+			seg := got[0]
+			if seg.TableIndex != tt.expected.TableIndex || seg.Passive != tt.expected.Passive || seg.Declarative != tt.expected.Declarative {
+				t.Errorf("mode: got table %d passive %v declarative %v, want %+v", seg.TableIndex, seg.Passive, seg.Declarative, tt.expected)
+			}
+			if (len(seg.Offset) > 0) != tt.offset {
+				t.Errorf("offset: got %v", seg.Offset)
+			}
+			if !slices.Equal(seg.FuncIdxs, tt.expected.FuncIdxs) {
+				t.Errorf("funcs: got %v, want %v", seg.FuncIdxs, tt.expected.FuncIdxs)
+			}
+		})
+	}
+
+	if _, err := ParseElementSection([]byte{0x01, 0x08}, 0); err == nil {
+		t.Error("flags 8 accepted")
+	}
+}
@@ -62,12 +62,18 @@ func (p *parser) readInitExpr() ([]byte, error) {
 				return nil, err
 			}
 			p.offset += n
-		case OpGlobalGet:
+		case OpGlobalGet, OpRefFunc:
 			_, n, err := ReadLEB128U32FromSlice(p.data[p.offset:])
 			if err != nil {
 				return nil, err
 			}
 			p.offset += n
+		case OpF32Const:
+			p.offset += 4
+		case OpF64Const:
+			p.offset += 8
+		case OpRefNull:
+			p.offset++
 		}
 	}
 
@@ -23,7 +23,7 @@ func TestParseGlobalSection(t *testing.T) {
 				{
 					Type: GlobalType{Type: ValI32, Mutable: false},
 					Init: []Instruction{
-						{Offset: 0x3, Opcode: OpI32Const, Name: "i32.const", Immediates: []any{int32(42)}},
+						{Offset: 0x3, Opcode: OpI32Const, Name: "i32.const", Imm: Immediate{Bits: 42}},
 						{Offset: 0x5, Opcode: OpEnd, Name: "end"},
 					},
 				},
@@ -42,7 +42,7 @@ func TestParseGlobalSection(t *testing.T) {
 				{
 					Type: GlobalType{Type: ValI64, Mutable: true},
 					Init: []Instruction{
-						{Offset: 0x3, Opcode: OpI64Const, Name: "i64.const", Immediates: []any{int64(0)}},
+						{Offset: 0x3, Opcode: OpI64Const, Name: "i64.const", Imm: Immediate{Bits: 0}},
 						{Offset: 0x5, Opcode: OpEnd, Name: "end"},
 					},
 				},
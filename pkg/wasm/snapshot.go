@@ -0,0 +1,75 @@
+package wasm
+
+import "encoding/binary"
+
+// Snapshot is the state of memory 0 captured from a running instance, such
+// as a WebAssembly.Memory buffer dumped from a browser. Globals optionally
+// holds captured global values by index, in the raw encoding of ConstValue.
+type Snapshot struct {
+	Memory  []byte
+	Globals map[uint32]uint64
+}
+
+// AttachSnapshot makes MemoryData, and the reads built on it, see s instead
+// of the data segments. A nil s restores the static image.
+func (rm *ResolvedModule) AttachSnapshot(s *Snapshot) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.snapshot = s
+}
+
+// Snapshot returns the attached snapshot, or nil.
+func (rm *ResolvedModule) Snapshot() *Snapshot {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	return rm.snapshot
+}
+
+// MemoryData returns the contents of memory 0 to show: the attached
+// snapshot if there is one, the static image otherwise. Callers must not
+// modify it. Static analyses and emulation start from the data segments
+// instead, through MemoryImage or BuildMemory, so their results do not
+// change with a snapshot; only string and pointer lookups read one.
+func (rm *ResolvedModule) MemoryData() []byte {
+	if s := rm.Snapshot(); s != nil {
+		return s.Memory
+	}
+	return rm.MemoryImage().Data
+}
+
+// SnapshotGlobal returns the captured value of global idx, if the attached
+// snapshot has one.
+func (rm *ResolvedModule) SnapshotGlobal(idx uint32) (uint64, bool) {
+	s := rm.Snapshot()
+	if s == nil {
+		return 0, false
+	}
+	v, ok := s.Globals[idx]
+	return v, ok
+}
+
+// ReadCString reads the NUL-terminated string at addr, up to max bytes. It
+// reports false when no terminator is found within max bytes or the end of
+// memory.
+func (rm *ResolvedModule) ReadCString(addr, max uint32) (string, bool) {
+	mem := rm.MemoryData()
+	if uint64(addr) >= uint64(len(mem)) {
+		return "", false
+	}
+	end := min(uint64(addr)+uint64(max), uint64(len(mem)))
+	for i := uint64(addr); i < end; i++ {
+		if mem[i] == 0 {
+			return string(mem[addr:i]), true
+		}
+	}
+	return "", false
+}
+
+// ReadPointer reads the little-endian 32-bit pointer stored at addr.
+func (rm *ResolvedModule) ReadPointer(addr uint32) (uint32, bool) {
+	mem := rm.MemoryData()
+	if uint64(addr)+4 > uint64(len(mem)) {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint32(mem[addr:]), true
+}
@@ -0,0 +1,40 @@
+package wasm
+
+import "testing"
+
+func TestSnapshot(t *testing.T) {
+	rm := &ResolvedModule{
+		Data: []DataSegment{
+			{Offset: mustDisassemble(t, []byte{0x41, 0x00, 0x0b}), Data: []byte("static\x00")},
+		},
+	}
+	if s, ok := rm.ReadCString(0, 16); !ok || s != "static" {
+		t.Errorf("static ReadCString: got %q, %v", s, ok)
+	}
+
+	mem := []byte{8, 0, 0, 0, 0, 0, 0, 0, 'l', 'i', 'v', 'e', 0}
+	rm.AttachSnapshot(&Snapshot{Memory: mem, Globals: map[uint32]uint64{0: 8}})
+	if s := rm.ReadString(8, 4); s != "live" {
+		t.Errorf("ReadString: got %q", s)
+	}
+	if p, ok := rm.ReadPointer(0); !ok || p != 8 {
+		t.Errorf("ReadPointer: got %d, %v", p, ok)
+	}
+	if s, ok := rm.ReadCString(8, 16); !ok || s != "live" {
+		t.Errorf("ReadCString: got %q, %v", s, ok)
+	}
+	if _, ok := rm.ReadCString(8, 3); ok {
+		t.Error("ReadCString should fail without a terminator in range")
+	}
+	if v, ok := rm.SnapshotGlobal(0); !ok || v != 8 {
+		t.Errorf("SnapshotGlobal: got %d, %v", v, ok)
+	}
+	if _, ok := rm.ReadPointer(12); ok {
+		t.Error("ReadPointer past the end should fail")
+	}
+
+	rm.AttachSnapshot(nil)
+	if s := rm.ReadString(0, 6); s != "static" {
+		t.Errorf("after detach: got %q", s)
+	}
+}
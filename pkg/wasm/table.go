@@ -0,0 +1,76 @@
+package wasm
+
+// TableImage is the initial contents of a table as produced by the active
+// element segments. Funcs holds the function index in each slot, or -1 for
+// a slot no segment fills. It ends at the last slot a segment fills, so
+// the slots past it, up to the table's size, are empty too.
+type TableImage struct {
+	Funcs []int64
+}
+
+// TableImage returns the static image of table idx, counting imported
+// tables first, or nil when there is no such table. An imported table
+// starts out empty. Segments whose offset cannot be evaluated
+// statically, or that do not fit the table, are left out. Images are
+// computed once and cached; callers must not modify them.
+func (rm *ResolvedModule) TableImage(idx uint32) *TableImage {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	if rm.tableImages == nil {
+		rm.tableImages = rm.buildTableImages()
+	}
+	if int(idx) >= len(rm.tableImages) {
+		return nil
+	}
+	return rm.tableImages[idx]
+}
+
+func (rm *ResolvedModule) buildTableImages() []*TableImage {
+	var limits []Limits
+	for _, imp := range rm.Imports {
+		if imp.Kind == ImportTable && imp.Table != nil {
+			limits = append(limits, *imp.Table)
+		}
+	}
+	for _, t := range rm.Tables {
+		limits = append(limits, t.Limits)
+	}
+	// The declared size only bounds the segments; the image is sized by
+	// what they fill, so a huge empty table costs nothing.
+	type placed struct {
+		seg    *ElementSegment
+		offset uint32
+	}
+	fits := make([][]placed, len(limits))
+	for i := range rm.Elements {
+		seg := &rm.Elements[i]
+		if seg.Passive || seg.Declarative || int(seg.TableIndex) >= len(limits) {
+			continue
+		}
+		offset, err := rm.ConstOffset(seg.Offset)
+		if err != nil || uint64(offset)+uint64(len(seg.FuncIdxs)) > uint64(limits[seg.TableIndex].Min) {
+			continue
+		}
+		fits[seg.TableIndex] = append(fits[seg.TableIndex], placed{seg, offset})
+	}
+	images := make([]*TableImage, len(limits))
+	for i, segs := range fits {
+		size := 0
+		for _, p := range segs {
+			size = max(size, int(p.offset)+len(p.seg.FuncIdxs))
+		}
+		funcs := make([]int64, size)
+		for j := range funcs {
+			funcs[j] = -1
+		}
+		for _, p := range segs {
+			for j, f := range p.seg.FuncIdxs {
+				if f != NullElem {
+					funcs[int(p.offset)+j] = int64(f)
+				}
+			}
+		}
+		images[i] = &TableImage{Funcs: funcs}
+	}
+	return images
+}
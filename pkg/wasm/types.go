@@ -1,39 +1,116 @@
 package wasm
 
+import "sync"
+
 type SectionID byte
 
 const (
-	SectionCustom   SectionID = 0
-	SectionType     SectionID = 1
-	SectionImport   SectionID = 2
-	SectionFunction SectionID = 3
-	SectionTable    SectionID = 4
-	SectionMemory   SectionID = 5
-	SectionGlobal   SectionID = 6
-	SectionExport   SectionID = 7
-	SectionStart    SectionID = 8
-	SectionElement  SectionID = 9
-	SectionCode     SectionID = 10
-	SectionData     SectionID = 11
+	SectionCustom    SectionID = 0
+	SectionType      SectionID = 1
+	SectionImport    SectionID = 2
+	SectionFunction  SectionID = 3
+	SectionTable     SectionID = 4
+	SectionMemory    SectionID = 5
+	SectionGlobal    SectionID = 6
+	SectionExport    SectionID = 7
+	SectionStart     SectionID = 8
+	SectionElement   SectionID = 9
+	SectionCode      SectionID = 10
+	SectionData      SectionID = 11
+	SectionDataCount SectionID = 12
 )
 
+func (id SectionID) String() string {
+	switch id {
+	case SectionCustom:
+		return "custom"
+	case SectionType:
+		return "type"
+	case SectionImport:
+		return "import"
+	case SectionFunction:
+		return "function"
+	case SectionTable:
+		return "table"
+	case SectionMemory:
+		return "memory"
+	case SectionGlobal:
+		return "global"
+	case SectionExport:
+		return "export"
+	case SectionStart:
+		return "start"
+	case SectionElement:
+		return "element"
+	case SectionCode:
+		return "code"
+	case SectionData:
+		return "data"
+	case SectionDataCount:
+		return "datacount"
+	default:
+		return "unknown"
+	}
+}
+
 type Module struct {
 	Version  uint32
 	Sections []Section
 }
 
 type Section struct {
-	ID      SectionID
-	Offset  uint64
-	Size    uint32
-	Content []byte
+	ID            SectionID
+	Offset        uint64
+	ContentOffset uint64
+	Size          uint32
+	Content       []byte
 }
 
 type Instruction struct {
-	Offset     uint64
-	Opcode     Opcode
-	Name       string
-	Immediates []any
+	Offset uint64
+	Opcode Opcode
+	Name   string
+	Imm    Immediate
+}
+
+// Immediate holds the decoded immediate operands of an instruction. Which
+// fields are meaningful depends on the opcode, so consumers should go through
+// the accessor methods on Instruction instead of reading fields directly.
+type Immediate struct {
+	// Index is the primary index operand: local, global, function, label,
+	// type, data segment, element segment or table, or the heap type of
+	// ref.null.
+	Index uint32
+	// Index2 is the secondary index operand: the table of call_indirect and
+	// table.init, or the source table of table.copy.
+	Index2 uint32
+	// Bits holds the raw bits of a constant: i32 values zero-extended, f32
+	// and f64 values as their IEEE-754 bit patterns.
+	Bits   uint64
+	MemArg MemArg
+	Block  BlockType
+	// Lane is the lane index of SIMD lane instructions.
+	Lane byte
+	// Labels holds the br_table targets, default label last.
+	Labels []uint32
+}
+
+type MemArg struct {
+	Align  uint32
+	Offset uint32
+}
+
+// BlockType is the signature byte of block, loop and if: either BlockEmpty
+// or the single result value type.
+type BlockType byte
+
+const BlockEmpty BlockType = 0x40
+
+func (bt BlockType) Result() ValType {
+	if bt == BlockEmpty {
+		return 0
+	}
+	return ValType(bt)
 }
 
 type ValType byte
@@ -71,6 +148,25 @@ type FuncType struct {
 	Results []ValType
 }
 
+// Equal reports whether f and g have the same parameters and results,
+// which is what call_indirect checks.
+func (f *FuncType) Equal(g *FuncType) bool {
+	if len(f.Params) != len(g.Params) || len(f.Results) != len(g.Results) {
+		return false
+	}
+	for i := range f.Params {
+		if f.Params[i] != g.Params[i] {
+			return false
+		}
+	}
+	for i := range f.Results {
+		if f.Results[i] != g.Results[i] {
+			return false
+		}
+	}
+	return true
+}
+
 func (f *FuncType) String() string {
 	s := "(func"
 	if len(f.Params) > 0 {
@@ -165,16 +261,25 @@ type Table struct {
 
 type DataSegment struct {
 	MemoryIndex uint32
+	Passive     bool
 	Offset      []Instruction
 	Data        []byte
 }
 
+// ElementSegment is an element segment. Only active segments, neither
+// Passive nor Declarative, have a table and Offset.
 type ElementSegment struct {
-	TableIndex uint32
-	Offset     []Instruction
-	FuncIdxs   []uint32
+	TableIndex  uint32
+	Passive     bool
+	Declarative bool
+	Offset      []Instruction
+	FuncIdxs    []uint32
 }
 
+// NullElem stands in FuncIdxs for an element expression that is not a
+// ref.func, such as ref.null.
+const NullElem = ^uint32(0)
+
 type NameMap struct {
 	FunctionNames map[uint32]string
 	LocalNames    map[uint32]map[uint32]string
@@ -193,11 +298,20 @@ type ResolvedModule struct {
 	Elements  []ElementSegment
 	Data      []DataSegment
 	Names     *NameMap
+
+	CustomSections []CustomSection
+
+	mu          sync.Mutex
+	index       *moduleIndex
+	memImage    *MemoryImage
+	tableImages []*TableImage
+	snapshot    *Snapshot
 }
 
 type ResolvedFunction struct {
 	Index    uint32
 	Name     string
+	TypeIdx  uint32
 	Type     *FuncType
 	Imported bool
 	Import   *Import
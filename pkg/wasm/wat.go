@@ -2,6 +2,7 @@ package wasm
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 )
 
@@ -182,32 +183,25 @@ func formatFunction(fn *ResolvedFunction, exportName string) string {
 }
 
 func formatInstruction(instr *Instruction) string {
-	if len(instr.Immediates) == 0 {
-		return instr.Name
+	if instr.Opcode == OpCallIndirect {
+		return fmt.Sprintf("call_indirect (type %d)", instr.Index())
 	}
 
-	if instr.Opcode == OpCallIndirect && len(instr.Immediates) >= 1 {
-		typeIdx := instr.Immediates[0]
-		return fmt.Sprintf("call_indirect (type %v)", typeIdx)
+	ops := instr.Operands()
+	if len(ops) == 0 {
+		return instr.Name
 	}
-
-	var args []string
-	for _, imm := range instr.Immediates {
-		switch v := imm.(type) {
-		case uint32:
-			args = append(args, fmt.Sprintf("%d", v))
-		case int32:
-			args = append(args, fmt.Sprintf("%d", v))
-		case int64:
-			args = append(args, fmt.Sprintf("%d", v))
-		case byte:
-			args = append(args, fmt.Sprintf("%d", v))
-		default:
-			args = append(args, fmt.Sprintf("%v", v))
+	if instr.Opcode == OpBlock || instr.Opcode == OpLoop || instr.Opcode == OpIf || instr.Opcode == OpSelectTyped {
+		return fmt.Sprintf("%s (result %s)", instr.Name, ops[0])
+	}
+	if instr.Opcode.IsMemoryAccess() {
+		ma := instr.MemArg()
+		if ma.Offset == 0 {
+			return fmt.Sprintf("%s align=%d", instr.Name, uint32(1)<<ma.Align)
 		}
+		return fmt.Sprintf("%s offset=%d align=%d", instr.Name, ma.Offset, uint32(1)<<ma.Align)
 	}
-
-	return fmt.Sprintf("%s %s", instr.Name, strings.Join(args, " "))
+	return fmt.Sprintf("%s %s", instr.Name, strings.Join(ops, " "))
 }
 
 func formatGlobal(glob *Global, exportName string) string {
@@ -276,6 +270,12 @@ func formatElementSegment(elem *ElementSegment) string {
 	var b strings.Builder
 
 	b.WriteString("  (elem")
+	if elem.Declarative {
+		b.WriteString(" declare")
+	}
+	if elem.TableIndex != 0 {
+		b.WriteString(fmt.Sprintf(" (table %d)", elem.TableIndex))
+	}
 
 	for _, instr := range elem.Offset {
 		if instr.Opcode == OpEnd {
@@ -284,8 +284,24 @@ func formatElementSegment(elem *ElementSegment) string {
 		b.WriteString(fmt.Sprintf(" (%s)", formatInstruction(&instr)))
 	}
 
+	// A null entry needs the expression form of the list, and a segment
+	// written other than as (elem offset idx...) needs the elemkind.
+	exprs := slices.Contains(elem.FuncIdxs, NullElem)
+	switch {
+	case exprs:
+		b.WriteString(" funcref")
+	case elem.Passive || elem.Declarative || elem.TableIndex != 0:
+		b.WriteString(" func")
+	}
 	for _, idx := range elem.FuncIdxs {
-		b.WriteString(fmt.Sprintf(" %d", idx))
+		switch {
+		case idx == NullElem:
+			b.WriteString(" (ref.null func)")
+		case exprs:
+			b.WriteString(fmt.Sprintf(" (ref.func %d)", idx))
+		default:
+			b.WriteString(fmt.Sprintf(" %d", idx))
+		}
 	}
 
 	b.WriteString(")\n")
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/0xInception/wasmspy/pkg/interp"
+	"github.com/0xInception/wasmspy/pkg/symex"
+)
+
+type SymbolicRegion struct {
+	Name string `json:"name"`
+	Addr uint32 `json:"addr"`
+	Size uint32 `json:"size"`
+}
+
+type RegionValue struct {
+	Name string `json:"name"`
+	Addr uint32 `json:"addr"`
+	Hex  string `json:"hex"`
+	Text string `json:"text"`
+}
+
+type ReachResult struct {
+	Reached    bool          `json:"reached"`
+	Params     []string      `json:"params"`
+	Memory     []RegionValue `json:"memory"`
+	Condition  string        `json:"condition"`
+	Paths      int           `json:"paths"`
+	Steps      int           `json:"steps"`
+	Incomplete bool          `json:"incomplete"`
+	Verified   bool          `json:"verified"`
+}
+
+// FindInputs searches for parameter values and contents of the symbolic
+// regions that make a function execute the instruction at target. An empty
+// argument leaves that parameter symbolic; others are parsed as fixed values.
+func (a *App) FindInputs(path string, index uint32, target uint64, args []string, regions []SymbolicRegion) (*ReachResult, error) {
+	module := a.modules[path]
+	if module == nil {
+		return nil, fmt.Errorf("module not loaded: %s", path)
+	}
+	fn := module.GetFunction(index)
+	if fn == nil || fn.Type == nil {
+		return nil, fmt.Errorf("function %d not found", index)
+	}
+	fixed, err := interp.ParseFixedArgs(fn, args, "")
+	if err != nil {
+		return nil, err
+	}
+	opts := symex.Options{Fixed: fixed}
+	for _, r := range regions {
+		opts.Symbolic = append(opts.Symbolic, symex.Region{Name: r.Name, Addr: r.Addr, Size: r.Size})
+	}
+
+	res, err := symex.Reach(module, index, target, opts)
+	if err != nil {
+		return nil, err
+	}
+	out := &ReachResult{
+		Reached:    res.Reached,
+		Params:     []string{},
+		Memory:     []RegionValue{},
+		Condition:  res.Condition,
+		Paths:      res.Paths,
+		Steps:      res.Steps,
+		Incomplete: res.Incomplete,
+		Verified:   res.Verified,
+	}
+	if !res.Reached {
+		return out, nil
+	}
+	for i, v := range res.Params {
+		out.Params = append(out.Params, interp.FormatValue(fn.Type.Params[i], v))
+	}
+	for _, r := range regions {
+		data := res.Memory[r.Name]
+		out.Memory = append(out.Memory, RegionValue{Name: r.Name, Addr: r.Addr, Hex: hex.EncodeToString(data), Text: printable(data)})
+	}
+	return out, nil
+}
+
+// printable returns data as a string when every byte is printable ASCII,
+// or "" otherwise.
+func printable(data []byte) string {
+	for _, c := range data {
+		if c < 0x20 || c > 0x7e {
+			return ""
+		}
+	}
+	return string(data)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/0xInception/wasmspy/pkg/interp"
+	"github.com/0xInception/wasmspy/pkg/wasm"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+type SnapshotInfo struct {
+	Size    int `json:"size"`
+	Globals int `json:"globals"`
+}
+
+type GlobalValueInfo struct {
+	Index    uint32 `json:"index"`
+	Type     string `json:"type"`
+	Value    string `json:"value"`
+	Snapshot bool   `json:"snapshot"`
+}
+
+type PointerInfo struct {
+	Addr   uint32 `json:"addr"`
+	Target uint32 `json:"target"`
+	String string `json:"string"`
+}
+
+// parseSnapshotGlobals reads a JSON object mapping globals, by index or
+// export name, to values. Values are numbers or strings in the syntax of
+// interp.ParseValue.
+func parseSnapshotGlobals(module *wasm.ResolvedModule, data []byte) (map[uint32]uint64, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var raw map[string]any
+	if err := dec.Decode(&raw); err != nil {
+		return nil, err
+	}
+	globals := make(map[uint32]uint64, len(raw))
+	for key, val := range raw {
+		var idx uint32
+		if n, err := strconv.ParseUint(key, 10, 32); err == nil {
+			idx = uint32(n)
+		} else if exp := module.GetExport(key); exp != nil && exp.Kind == wasm.ExportGlobal {
+			idx = exp.Index
+		} else {
+			return nil, fmt.Errorf("unknown global %q", key)
+		}
+		gt, ok := module.GlobalType(idx)
+		if !ok {
+			return nil, fmt.Errorf("global %d out of range", idx)
+		}
+		var s string
+		switch v := val.(type) {
+		case json.Number:
+			s = v.String()
+		case string:
+			s = v
+		default:
+			return nil, fmt.Errorf("global %q: value must be a number or string", key)
+		}
+		v, err := interp.ParseValue(gt.Type, s)
+		if err != nil {
+			return nil, fmt.Errorf("global %q: %w", key, err)
+		}
+		globals[idx] = v
+	}
+	return globals, nil
+}
+
+// AttachMemorySnapshot attaches a raw dump of memory 0 and, when
+// globalsPath is not empty, a JSON file of global values. Memory views,
+// string reads and the decompiler use the snapshot until it is detached or
+// the module is reloaded.
+func (a *App) AttachMemorySnapshot(path, dumpPath, globalsPath string) (*SnapshotInfo, error) {
+	module := a.modules[path]
+	if module == nil {
+		return nil, fmt.Errorf("module not loaded: %s", path)
+	}
+	mem, err := os.ReadFile(dumpPath)
+	if err != nil {
+		return nil, err
+	}
+	snap := &wasm.Snapshot{Memory: mem}
+	if globalsPath != "" {
+		data, err := os.ReadFile(globalsPath)
+		if err != nil {
+			return nil, err
+		}
+		if snap.Globals, err = parseSnapshotGlobals(module, data); err != nil {
+			return nil, fmt.Errorf("%s: %w", globalsPath, err)
+		}
+	}
+	module.AttachSnapshot(snap)
+	return &SnapshotInfo{Size: len(snap.Memory), Globals: len(snap.Globals)}, nil
+}
+
+// OpenMemorySnapshot asks for a memory dump and then an optional globals
+// file, and attaches them. It returns nil if the first dialog is cancelled.
+func (a *App) OpenMemorySnapshot(path string) (*SnapshotInfo, error) {
+	dumpPath, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: "Open Memory Dump",
+		Filters: []runtime.FileFilter{
+			{DisplayName: "Memory Dumps", Pattern: "*.bin;*.dump;*.mem"},
+			{DisplayName: "All Files", Pattern: "*"},
+		},
+	})
+	if err != nil || dumpPath == "" {
+		return nil, err
+	}
+	globalsPath, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: "Open Globals (optional)",
+		Filters: []runtime.FileFilter{
+			{DisplayName: "JSON Files", Pattern: "*.json"},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a.AttachMemorySnapshot(path, dumpPath, globalsPath)
+}
+
+func (a *App) DetachMemorySnapshot(path string) error {
+	module := a.modules[path]
+	if module == nil {
+		return fmt.Errorf("module not loaded: %s", path)
+	}
+	module.AttachSnapshot(nil)
+	return nil
+}
+
+func (a *App) GetMemorySnapshot(path string) (*SnapshotInfo, error) {
+	module := a.modules[path]
+	if module == nil {
+		return nil, fmt.Errorf("module not loaded: %s", path)
+	}
+	snap := module.Snapshot()
+	if snap == nil {
+		return nil, nil
+	}
+	return &SnapshotInfo{Size: len(snap.Memory), Globals: len(snap.Globals)}, nil
+}
+
+// GetGlobalValues returns the value of every global: the captured value
+// when the snapshot has one, otherwise the statically known initial value,
+// or "" when there is none.
+func (a *App) GetGlobalValues(path string) ([]GlobalValueInfo, error) {
+	module := a.modules[path]
+	if module == nil {
+		return nil, fmt.Errorf("module not loaded: %s", path)
+	}
+	values := []GlobalValueInfo{}
+	total := module.NumImportedGlobals() + uint32(len(module.Globals))
+	for idx := uint32(0); idx < total; idx++ {
+		gt, _ := module.GlobalType(idx)
+		info := GlobalValueInfo{Index: idx, Type: gt.Type.String()}
+		if v, ok := module.SnapshotGlobal(idx); ok {
+			info.Value, info.Snapshot = interp.FormatValue(gt.Type, v), true
+		} else if cv, err := module.GlobalValue(idx); err == nil {
+			info.Value = interp.FormatValue(gt.Type, cv.Bits)
+		}
+		values = append(values, info)
+	}
+	return values, nil
+}
+
+// ReadCString reads the NUL-terminated string at addr from the snapshot or
+// static memory.
+func (a *App) ReadCString(path string, addr uint32, maxLen uint32) (string, error) {
+	module := a.modules[path]
+	if module == nil {
+		return "", fmt.Errorf("module not loaded: %s", path)
+	}
+	str, ok := module.ReadCString(addr, maxLen)
+	if !ok {
+		return "", fmt.Errorf("no string terminator within %d bytes of 0x%x", maxLen, addr)
+	}
+	return str, nil
+}
+
+// FollowPointer reads the 32-bit pointer stored at addr, along with the
+// string it points to when it points to one.
+func (a *App) FollowPointer(path string, addr uint32) (*PointerInfo, error) {
+	module := a.modules[path]
+	if module == nil {
+		return nil, fmt.Errorf("module not loaded: %s", path)
+	}
+	target, ok := module.ReadPointer(addr)
+	if !ok {
+		return nil, fmt.Errorf("address 0x%x outside memory", addr)
+	}
+	info := &PointerInfo{Addr: addr, Target: target}
+	if str, ok := module.ReadCString(target, 256); ok {
+		info.String = str
+	}
+	return info, nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/0xInception/wasmspy/pkg/decompile"
+	"github.com/0xInception/wasmspy/pkg/wasm"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// structRecovery is the struct recovery of a module. It looks at every
+// function, so it runs in the background from the time the module is
+// loaded; set is written before done is closed.
+type structRecovery struct {
+	done chan struct{}
+	set  *decompile.StructSet
+}
+
+// recoverStructs starts recovering the structs of a module and emits
+// "structs:ready" with its path once they are known.
+func (a *App) recoverStructs(path string, module *wasm.ResolvedModule) *structRecovery {
+	r := &structRecovery{done: make(chan struct{})}
+	go func() {
+		r.set = a.runStructRecovery(path, module)
+		close(r.done)
+		if a.ctx != nil {
+			runtime.EventsEmit(a.ctx, "structs:ready", path)
+		}
+	}()
+	return r
+}
+
+// runStructRecovery recovers the structs of a module. A panic in the
+// recovery is logged and leaves the module without structs, rather than
+// taking the application down from a background goroutine.
+func (a *App) runStructRecovery(path string, module *wasm.ResolvedModule) (set *decompile.StructSet) {
+	defer func() {
+		if err := recover(); err != nil {
+			set = nil
+			if a.ctx != nil {
+				runtime.LogErrorf(a.ctx, "struct recovery of %s failed: %v", path, err)
+			}
+		}
+	}()
+	return decompile.RecoverStructs(module)
+}
+
+// structSet returns the structs recovered for a module with the names and
+// types from its annotations applied. Unless wait is set it returns nil
+// while recovery is still running, so decompiling does not stall on it.
+func (a *App) structSet(path string, module *wasm.ResolvedModule, wait bool) *decompile.StructSet {
+	r := a.structs[path]
+	if r == nil {
+		r = a.recoverStructs(path, module)
+		a.structs[path] = r
+	}
+	if wait {
+		<-r.done
+	} else {
+		select {
+		case <-r.done:
+		default:
+			return nil
+		}
+	}
+	set := r.set.Clone()
+	ann := a.annotations[path]
+	if ann == nil {
+		return set
+	}
+	for id, sa := range ann.Structs {
+		s := set.Get(id)
+		if s == nil {
+			continue
+		}
+		if sa.Name != "" {
+			s.Name = sa.Name
+		}
+		for key, fa := range sa.Fields {
+			offset, err := strconv.ParseUint(key, 10, 32)
+			if err != nil {
+				continue
+			}
+			s.SetField(uint32(offset), fa.Name, fa.Type)
+		}
+	}
+	return set
+}
+
+// GetStructs returns the structs proposed for a module from the offsets its
+// pointers are accessed at, as named and typed in its annotations.
+func (a *App) GetStructs(path string) ([]*decompile.Struct, error) {
+	module := a.modules[path]
+	if module == nil {
+		return nil, fmt.Errorf("module not loaded: %s", path)
+	}
+	structs := a.structSet(path, module, true).Structs
+	if structs == nil {
+		structs = []*decompile.Struct{}
+	}
+	return structs, nil
+}
+
+func (a *App) structAnnotation(path, id string) (*StructAnnotation, error) {
+	module := a.modules[path]
+	if module == nil {
+		return nil, fmt.Errorf("module not loaded: %s", path)
+	}
+	if a.structSet(path, module, true).Get(id) == nil {
+		return nil, fmt.Errorf("struct %s not found", id)
+	}
+	ann := a.annotations[path]
+	if ann == nil {
+		ann = NewAnnotations()
+		a.annotations[path] = ann
+	}
+	if ann.Structs == nil {
+		ann.Structs = make(map[string]*StructAnnotation)
+	}
+	if ann.Structs[id] == nil {
+		ann.Structs[id] = &StructAnnotation{}
+	}
+	return ann.Structs[id], nil
+}
+
+// SetStructName names a recovered struct; an empty name restores the one
+// derived from its ID.
+func (a *App) SetStructName(path, id, name string) error {
+	sa, err := a.structAnnotation(path, id)
+	if err != nil {
+		return err
+	}
+	sa.Name = name
+	return nil
+}
+
+// SetStructField names and types the field of a struct at offset, adding
+// one when the accesses did not show it. Empty strings leave the recovered
+// name or type.
+func (a *App) SetStructField(path, id string, offset uint32, name, typ string) error {
+	sa, err := a.structAnnotation(path, id)
+	if err != nil {
+		return err
+	}
+	if sa.Fields == nil {
+		sa.Fields = make(map[string]*FieldAnnotation)
+	}
+	sa.Fields[strconv.FormatUint(uint64(offset), 10)] = &FieldAnnotation{Name: name, Type: typ}
+	return nil
+}
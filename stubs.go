@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/0xInception/wasmspy/pkg/emulate"
+	"github.com/0xInception/wasmspy/pkg/interp"
+	"github.com/0xInception/wasmspy/pkg/stubs"
+	"github.com/0xInception/wasmspy/pkg/wasi"
+	"github.com/0xInception/wasmspy/pkg/wasm"
+)
+
+// StubConfig chooses how imports are synthesized. Default is "zero" or
+// "trap"; Presets names toolchain presets, or "auto" to detect them; Script
+// is the path of a YAML or JSON response script.
+type StubConfig struct {
+	Default string   `json:"default"`
+	Presets []string `json:"presets"`
+	Script  string   `json:"script"`
+}
+
+type ImportCallInfo struct {
+	Import  string   `json:"import"`
+	Args    []string `json:"args"`
+	Results []string `json:"results"`
+	Error   string   `json:"error"`
+}
+
+type StubRunResult struct {
+	Results      []string         `json:"results"`
+	Error        string           `json:"error"`
+	Steps        uint64           `json:"steps"`
+	Stdout       string           `json:"stdout"`
+	Calls        []ImportCallInfo `json:"calls"`
+	DroppedCalls int              `json:"droppedCalls"`
+}
+
+// maxLoggedCalls bounds the import calls kept by RunWithStubs.
+const maxLoggedCalls = 10_000
+
+func stubOptions(module *wasm.ResolvedModule, cfg StubConfig) (stubs.Options, error) {
+	opts, err := stubs.ParseOptions(module, cfg.Default, cfg.Presets)
+	if err != nil {
+		return opts, err
+	}
+	if cfg.Script != "" {
+		if opts.Script, err = stubs.LoadScript(cfg.Script); err != nil {
+			return opts, err
+		}
+	}
+	return opts, nil
+}
+
+// GetStubPresets lists the available toolchain presets.
+func (a *App) GetStubPresets() []string {
+	return stubs.PresetNames()
+}
+
+// DetectStubPresets returns the presets that match the module's imports.
+func (a *App) DetectStubPresets(path string) ([]string, error) {
+	module := a.modules[path]
+	if module == nil {
+		return nil, fmt.Errorf("module not loaded: %s", path)
+	}
+	names := []string{}
+	for _, p := range stubs.DetectPresets(module) {
+		names = append(names, p.Name)
+	}
+	return names, nil
+}
+
+// RunWithStubs runs a function with synthesized imports and returns every
+// import call it made. WASI imports are served by a WASI host with no
+// directory access; stubs only fill in what remains. A maxSteps of zero
+// uses the default budget. Traps, including running out of steps, are
+// reported in the result rather than as an error.
+func (a *App) RunWithStubs(path string, index uint32, args []string, cfg StubConfig, maxSteps uint64) (*StubRunResult, error) {
+	module := a.modules[path]
+	if module == nil {
+		return nil, fmt.Errorf("module not loaded: %s", path)
+	}
+	fn := module.GetFunction(index)
+	if fn == nil || fn.Type == nil {
+		return nil, fmt.Errorf("function %d not found", index)
+	}
+	values, err := interp.ParseArgs(fn, args)
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := stubOptions(module, cfg)
+	if err != nil {
+		return nil, err
+	}
+	result := &StubRunResult{Results: []string{}, Calls: []ImportCallInfo{}}
+	opts.OnCall = func(c *stubs.Call) {
+		if len(result.Calls) >= maxLoggedCalls {
+			result.DroppedCalls++
+			return
+		}
+		info := ImportCallInfo{Import: c.Import, Args: []string{}, Results: []string{}}
+		for i, v := range c.Args {
+			info.Args = append(info.Args, interp.FormatValue(c.Type.Params[i], v))
+		}
+		for i, v := range c.Results {
+			if i < len(c.Type.Results) {
+				info.Results = append(info.Results, interp.FormatValue(c.Type.Results[i], v))
+			}
+		}
+		if c.Err != nil {
+			info.Error = c.Err.Error()
+		}
+		result.Calls = append(result.Calls, info)
+	}
+
+	imports := interp.NewImports()
+	var host *wasi.Host
+	if wasi.Imports(module) {
+		host, err = wasi.New(wasi.Config{Args: []string{fn.Name}})
+		if err != nil {
+			return nil, err
+		}
+		defer host.Close()
+		host.Register(imports)
+	}
+	if err := stubs.Register(module, imports, opts); err != nil {
+		return nil, err
+	}
+
+	inst, err := interp.Instantiate(module, imports)
+	if err != nil {
+		return nil, err
+	}
+	budget := maxSteps
+	if budget == 0 {
+		budget = emulate.DefaultMaxSteps
+	}
+	inst.Fuel, inst.Metered = budget, true
+	results, err := inst.CallFunc(index, values...)
+	result.Steps = budget - inst.Fuel
+	if err != nil {
+		result.Error = err.Error()
+	}
+	for i, r := range results {
+		result.Results = append(result.Results, interp.FormatValue(fn.Type.Results[i], r))
+	}
+	if host != nil {
+		result.Stdout = string(host.Stdout())
+	}
+	return result, nil
+}
@@ -4,6 +4,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/0xInception/wasmspy/internal/wasmtest"
 	"github.com/0xInception/wasmspy/pkg/wasm"
 )
 
@@ -40,7 +41,7 @@ func TestResolve(t *testing.T) {
 	t.Logf("  Instructions: %d", len(fn.Body.Instructions))
 
 	for _, instr := range fn.Body.Instructions {
-		t.Logf("    %s %v", instr.Name, instr.Immediates)
+		t.Logf("    %s %v", instr.Name, instr.Operands())
 	}
 
 	if fn.Type.String() != "(func (param i32 i32) (result i32))" {
@@ -124,3 +125,60 @@ func TestWATOutputWithImports(t *testing.T) {
 	wat := rm.ToWAT()
 	t.Logf("WAT output:\n%s", wat)
 }
+
+func TestResolveIndexLookups(t *testing.T) {
+	path := filepath.Join("testdata", "with_import.wasm")
+
+	mod, err := wasm.ParseFile(path)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+
+	rm, err := wasm.Resolve(mod)
+	if err != nil {
+		t.Fatalf("resolve error: %v", err)
+	}
+
+	if fn := rm.GetFunctionByExport("main"); fn == nil || fn.Index != 1 {
+		t.Errorf("GetFunctionByExport(main): got %+v", fn)
+	}
+	if name := rm.FuncExportName(1); name != "main" {
+		t.Errorf("FuncExportName(1): got %q", name)
+	}
+	if fn := rm.GetFunctionByName("env.log"); fn == nil || !fn.Imported {
+		t.Errorf("GetFunctionByName(env.log): got %+v", fn)
+	}
+	if imp := rm.GetImport("env", "log"); imp == nil || imp.Kind != wasm.ImportFunc {
+		t.Errorf("GetImport(env, log): got %+v", imp)
+	}
+	if rm.GetImport("env", "missing") != nil {
+		t.Error("GetImport(env, missing): expected nil")
+	}
+
+	fn := rm.GetFunction(0)
+	found := false
+	for _, idx := range rm.FunctionsByType(fn.TypeIdx) {
+		if idx == 0 {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("FunctionsByType(%d) does not contain function 0", fn.TypeIdx)
+	}
+}
+
+func TestResolveDoubleExport(t *testing.T) {
+	rm := wasmtest.Module(t,
+		wasmtest.Section(0x01, 0x01, 0x60, 0x00, 0x00),
+		wasmtest.Section(0x03, 0x01, 0x00),
+		wasmtest.Section(0x07, wasmtest.Cat([]byte{0x02},
+			wasmtest.Name("first"), []byte{0x00, 0x00},
+			wasmtest.Name("second"), []byte{0x00, 0x00})...),
+		wasmtest.Code(wasmtest.Body(0x00, 0x0b)),
+	)
+
+	fn := rm.GetFunction(0)
+	if fn.Name != "first" || rm.FuncExportName(0) != fn.Name {
+		t.Errorf("function named %q, FuncExportName %q; want both first", fn.Name, rm.FuncExportName(0))
+	}
+}
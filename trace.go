@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/0xInception/wasmspy/pkg/decompile"
+	"github.com/0xInception/wasmspy/pkg/interp"
+	"github.com/0xInception/wasmspy/pkg/trace"
+	"github.com/0xInception/wasmspy/pkg/wasi"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+type TraceSummary struct {
+	Events       int      `json:"events"`
+	Instructions int      `json:"instructions"`
+	Functions    []uint32 `json:"functions"`
+	Results      []string `json:"results"`
+	Steps        uint64   `json:"steps"`
+	Stdout       string   `json:"stdout"`
+	Error        string   `json:"error"`
+	SameModule   bool     `json:"sameModule"`
+}
+
+type FunctionCoverage struct {
+	Offsets        []uint64 `json:"offsets"`
+	Hits           []uint64 `json:"hits"`
+	DecompileLines []int    `json:"decompileLines"`
+}
+
+const (
+	// maxTraceEvents bounds traces recorded from the GUI.
+	maxTraceEvents = 10_000_000
+	// defaultTraceSteps is the instruction budget of RunWithTrace when
+	// maxSteps is zero.
+	defaultTraceSteps = 100_000_000
+)
+
+func (a *App) traceSummary(path string, t *trace.Trace) *TraceSummary {
+	cov := t.Coverage()
+	summary := &TraceSummary{
+		Events:     len(t.Events),
+		Functions:  cov.FuncIndices(),
+		SameModule: t.ModuleHash == trace.HashModule(a.files[path]),
+	}
+	for _, ev := range t.Events {
+		if ev.Kind == interp.EventInstr {
+			summary.Instructions++
+		}
+	}
+	return summary
+}
+
+// RunWithTrace runs a function in the interpreter and keeps its trace as the
+// module's current trace. A maxSteps of zero uses the default budget. Traps,
+// including running out of steps, are reported in the summary rather than
+// as an error. WASI modules run with no directory access.
+func (a *App) RunWithTrace(path string, index uint32, args []string, maxSteps uint64) (*TraceSummary, error) {
+	module := a.modules[path]
+	if module == nil {
+		return nil, fmt.Errorf("module not loaded: %s", path)
+	}
+	fn := module.GetFunction(index)
+	if fn == nil || fn.Type == nil {
+		return nil, fmt.Errorf("function %d not found", index)
+	}
+	values, err := interp.ParseArgs(fn, args)
+	if err != nil {
+		return nil, err
+	}
+
+	imports := interp.NewImports()
+	imports.Fallback = interp.TrapUnresolved
+	var host *wasi.Host
+	if wasi.Imports(module) {
+		host, err = wasi.New(wasi.Config{Args: []string{fn.Name}})
+		if err != nil {
+			return nil, err
+		}
+		defer host.Close()
+		host.Register(imports)
+	}
+
+	inst, err := interp.Instantiate(module, imports)
+	if err != nil {
+		return nil, err
+	}
+	rec := trace.NewRecorder(a.files[path])
+	rec.Limit = maxTraceEvents
+	inst.Tracer = rec.Record
+
+	budget := maxSteps
+	if budget == 0 {
+		budget = defaultTraceSteps
+	}
+	inst.Fuel, inst.Metered = budget, true
+	results, err := inst.CallFunc(index, values...)
+	a.traces[path] = rec.Trace
+
+	summary := a.traceSummary(path, rec.Trace)
+	summary.Steps = budget - inst.Fuel
+	if err != nil {
+		summary.Error = err.Error()
+	}
+	if rec.Dropped > 0 {
+		summary.Error += fmt.Sprintf(" (trace truncated, %d events dropped)", rec.Dropped)
+	}
+	for i, r := range results {
+		summary.Results = append(summary.Results, interp.FormatValue(fn.Type.Results[i], r))
+	}
+	if host != nil {
+		summary.Stdout = string(host.Stdout())
+	}
+	return summary, nil
+}
+
+func (a *App) ClearTrace(path string) {
+	delete(a.traces, path)
+}
+
+// GetFunctionCoverage returns the executed instructions of a function in the
+// current trace, and the decompiled lines they map to.
+func (a *App) GetFunctionCoverage(path string, index uint32) (*FunctionCoverage, error) {
+	module := a.modules[path]
+	if module == nil {
+		return nil, fmt.Errorf("module not loaded: %s", path)
+	}
+	result := &FunctionCoverage{Offsets: []uint64{}, Hits: []uint64{}, DecompileLines: []int{}}
+	t := a.traces[path]
+	if t == nil {
+		return result, nil
+	}
+
+	cov := t.Coverage()
+	for _, off := range cov.Offsets(index) {
+		result.Offsets = append(result.Offsets, off)
+		result.Hits = append(result.Hits, cov.Hits(index, off))
+	}
+
+	fn := module.GetFunction(index)
+	if fn == nil || fn.Imported || len(result.Offsets) == 0 {
+		return result, nil
+	}
+	for _, m := range decompile.DecompileWithMappings(fn, module).Mappings {
+		for _, off := range m.Offsets {
+			if cov.Hits(index, off) > 0 {
+				result.DecompileLines = append(result.DecompileLines, m.Line)
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+func (a *App) SaveTraceToFile(path string) (string, error) {
+	t := a.traces[path]
+	if t == nil {
+		return "", fmt.Errorf("no trace recorded for %s", path)
+	}
+	savePath, err := runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+		Title:           "Save Trace",
+		DefaultFilename: "execution.trace",
+		Filters: []runtime.FileFilter{
+			{DisplayName: "WasmSpy Traces", Pattern: "*.trace"},
+		},
+	})
+	if err != nil || savePath == "" {
+		return "", err
+	}
+	if err := trace.WriteFile(savePath, t); err != nil {
+		return "", err
+	}
+	return savePath, nil
+}
+
+func (a *App) LoadTraceFromFile(path string) (*TraceSummary, error) {
+	if a.modules[path] == nil {
+		return nil, fmt.Errorf("module not loaded: %s", path)
+	}
+	openPath, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: "Load Trace",
+		Filters: []runtime.FileFilter{
+			{DisplayName: "WasmSpy Traces", Pattern: "*.trace"},
+		},
+	})
+	if err != nil || openPath == "" {
+		return nil, err
+	}
+	t, err := trace.ReadFile(openPath)
+	if err != nil {
+		return nil, err
+	}
+	a.traces[path] = t
+	return a.traceSummary(path, t), nil
+}
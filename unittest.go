@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/0xInception/wasmspy/pkg/harness"
+)
+
+type UnitTestCase struct {
+	Name     string   `json:"name"`
+	Passed   bool     `json:"passed"`
+	Failures []string `json:"failures"`
+	Results  []string `json:"results"`
+	Error    string   `json:"error"`
+	Steps    uint64   `json:"steps"`
+}
+
+type UnitTestReport struct {
+	Cases  []UnitTestCase `json:"cases"`
+	Passed int            `json:"passed"`
+	Failed int            `json:"failed"`
+}
+
+// RunUnitTests runs the cases of a YAML or JSON suite file against a loaded
+// module.
+func (a *App) RunUnitTests(path, suitePath string) (*UnitTestReport, error) {
+	module := a.modules[path]
+	if module == nil {
+		return nil, fmt.Errorf("module not loaded: %s", path)
+	}
+	suite, err := harness.LoadSuite(suitePath)
+	if err != nil {
+		return nil, err
+	}
+	report, err := harness.Run(module, suite)
+	if err != nil {
+		return nil, err
+	}
+	out := &UnitTestReport{Cases: []UnitTestCase{}, Passed: report.Passed, Failed: report.Failed}
+	for _, c := range report.Cases {
+		tc := UnitTestCase{Name: c.Name, Passed: c.Passed, Failures: []string{}, Results: []string{}, Steps: c.Steps}
+		tc.Failures = append(tc.Failures, c.Failures...)
+		tc.Results = append(tc.Results, c.Results...)
+		if c.Err != nil {
+			tc.Error = c.Err.Error()
+		}
+		out.Cases = append(out.Cases, tc)
+	}
+	return out, nil
+}